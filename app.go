@@ -6,8 +6,13 @@ import (
 	"errors"
 	"io"
 	"net"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
+	"time"
+
+	"LocalShare/pkg/shareserver"
 
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
@@ -15,7 +20,7 @@ import (
 // App struct
 type App struct {
 	ctx          context.Context
-	shareServer  *ShareServer
+	shareServer  *shareserver.Server
 	initialShare string
 
 	ipcOnce     sync.Once
@@ -23,18 +28,200 @@ type App struct {
 
 	pendingUpdateMu sync.Mutex
 	pendingUpdate   *pendingUpdate
+
+	folderSize folderSizeJobs
+	checksums  checksumJobs
+
+	serverInfoEvents *throttledEmitter
+
+	launchMu sync.Mutex
+	launch   launchState
 }
 
+// emitServerInfoChanged tells the UI the share changed. Bursts (start +
+// port switch + IPC) are throttled; see sendServerInfo.
 func (a *App) emitServerInfoChanged() {
+	a.serverInfoEvents.trigger()
+}
+
+// sendServerInfo emits serverInfoChanged with the current ServerInfo (null
+// when not sharing), so the UI needn't call GetServerInfo again.
+func (a *App) sendServerInfo() {
 	if a.ctx == nil {
 		return
 	}
-	runtime.EventsEmit(a.ctx, "serverInfoChanged")
+	info, _ := a.shareServer.GetServerInfo()
+	runtime.EventsEmit(a.ctx, "serverInfoChanged", info)
 }
 
 // NewApp creates a new App application struct
 func NewApp(initialShare string) *App {
-	return &App{shareServer: NewShareServer(), initialShare: initialShare}
+	a := &App{initialShare: initialShare}
+	a.serverInfoEvents = newThrottledEmitter(serverInfoEventWindow, a.sendServerInfo)
+	a.shareServer = newShareServer(shareserver.Options{
+		Settings:              newSettingsStore(),
+		RememberLastShare:     true,
+		OnClientConnected:     a.onClientConnected,
+		OnClientDisconnected:  a.onClientDisconnected,
+		OnPanic:               a.onServerPanic,
+		OnCustomPortAvailable: a.onCustomPortAvailable,
+		OnShareRootLost:       a.onShareRootLost,
+		OnShareFailed:         a.onShareFailed,
+		OnShareRestarted:      a.onShareRestarted,
+		OnShareExpired:        a.onShareExpired,
+		OnShareIdleStopped:    a.onShareIdleStopped,
+		OnRemoteAdmin:         a.onRemoteAdmin,
+		OnPathProbe:           a.onPathProbe,
+	})
+	return a
+}
+
+func (a *App) emitToastError(msg string) {
+	if a.ctx == nil {
+		return
+	}
+	runtime.EventsEmit(a.ctx, "toastError", msg)
+}
+
+func (a *App) onServerPanic(id string, msg string) {
+	if a.ctx == nil {
+		return
+	}
+	runtime.EventsEmit(a.ctx, "serverPanic", map[string]any{
+		"id":      id,
+		"message": msg,
+	})
+}
+
+func (a *App) onClientConnected(ip string, userAgent string) {
+	if a.ctx == nil {
+		return
+	}
+	runtime.EventsEmit(a.ctx, "clientConnected", map[string]any{
+		"ip":        ip,
+		"userAgent": userAgent,
+	})
+	if a.shareServer.BoolSetting(shareserver.SettingKeyNotifyClientConnected) {
+		go func() {
+			if err := showDesktopNotification(a.tr(msgClientConnectedTitle), a.tr(msgClientConnectedBody, ip)); err != nil {
+				appendLaunchLogf("notify clientConnected err=%v", err)
+			}
+		}()
+	}
+}
+
+func (a *App) onClientDisconnected(ip string) {
+	if a.ctx == nil {
+		return
+	}
+	runtime.EventsEmit(a.ctx, "clientDisconnected", map[string]any{"ip": ip})
+}
+
+func (a *App) onCustomPortAvailable(port int, switched bool) {
+	if a.ctx == nil {
+		return
+	}
+	runtime.EventsEmit(a.ctx, "customPortAvailable", map[string]any{
+		"port":     port,
+		"switched": switched,
+	})
+	if switched {
+		a.emitServerInfoChanged()
+	}
+}
+
+// onShareRootLost tells the UI that sharing stopped because the folder (or
+// the drive it was on) went away; the share can be resumed once it's back.
+func (a *App) onShareRootLost(root string, reason string) {
+	appendLaunchLogf("share root lost root=%q reason=%s", root, reason)
+	if a.ctx == nil {
+		return
+	}
+	runtime.EventsEmit(a.ctx, "shareRootLost", map[string]any{
+		"root":   root,
+		"reason": reason,
+	})
+	a.emitServerInfoChanged()
+}
+
+// onShareFailed tells the UI that sharing stopped because the server quit
+// with an error, and whether it is being restarted.
+func (a *App) onShareFailed(root string, err error, restarting bool) {
+	appendLaunchLogf("share failed root=%q err=%v restarting=%v", root, err, restarting)
+	if a.ctx == nil {
+		return
+	}
+	runtime.EventsEmit(a.ctx, "shareFailed", map[string]any{
+		"root":       root,
+		"error":      err.Error(),
+		"restarting": restarting,
+	})
+	a.emitServerInfoChanged()
+}
+
+func (a *App) onShareRestarted(root string, attempt int) {
+	appendLaunchLogf("share restarted root=%q attempt=%d", root, attempt)
+	if a.ctx == nil {
+		return
+	}
+	runtime.EventsEmit(a.ctx, "shareRestarted", map[string]any{
+		"root":    root,
+		"attempt": attempt,
+	})
+	a.emitServerInfoChanged()
+}
+
+// onShareExpired tells the UI that the timer set with SetShareExpiry ended
+// the share.
+func (a *App) onShareExpired(root string) {
+	appendLaunchLogf("share expired root=%q", root)
+	if a.ctx == nil {
+		return
+	}
+	runtime.EventsEmit(a.ctx, "shareExpired", map[string]any{
+		"root": root,
+	})
+	a.emitServerInfoChanged()
+}
+
+// onShareIdleStopped tells the UI that nobody used the share for the time set
+// under SettingKeyIdleStopMinutes, so it was stopped.
+func (a *App) onShareIdleStopped(root string) {
+	appendLaunchLogf("share idle stopped root=%q", root)
+	if a.ctx == nil {
+		return
+	}
+	runtime.EventsEmit(a.ctx, "shareIdleStopped", map[string]any{
+		"root": root,
+	})
+	a.emitServerInfoChanged()
+}
+
+// onRemoteAdmin tells the UI a web client used the admin API (the server
+// has already logged it).
+func (a *App) onRemoteAdmin(action string, ip string) {
+	if action == shareserver.RemoteAdminStop {
+		a.emitServerInfoChanged()
+	}
+	if a.ctx == nil {
+		return
+	}
+	runtime.EventsEmit(a.ctx, "remoteAdmin", map[string]any{
+		"action": action,
+		"ip":     ip,
+	})
+}
+
+// onPathProbe warns that a client keeps asking for paths outside the share.
+func (a *App) onPathProbe(ip string, attempts int) {
+	appendLaunchLogf("path probe ip=%s attempts=%d", ip, attempts)
+	if a.ctx == nil {
+		return
+	}
+	runtime.EventsEmit(a.ctx, "pathProbe", map[string]any{
+		"ip":       ip,
+		"attempts": attempts,
+	})
 }
 
 func (a *App) setIPCListener(ln net.Listener) {
@@ -45,6 +232,7 @@ func (a *App) setIPCListener(ln net.Listener) {
 // so we can call the runtime methods
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
+	defer a.recoverCrash("startup")
 	a.startIPCListener()
 
 	sharePath := strings.TrimSpace(a.initialShare)
@@ -54,29 +242,87 @@ func (a *App) startup(ctx context.Context) {
 
 	// 启动时自动共享（来自右键菜单 --share=...）。
 	// 这里不要吞掉错误：否则用户会觉得“点了没反应”。
-	info, err := a.shareServer.Start(ctx, sharePath)
+	info, err := a.startShare(ctx, sharePath)
+	a.recordInitialShare(info, err)
 	appendLaunchLogf("startup --share=%q err=%v url=%v", sharePath, err, func() string {
 		if info == nil {
 			return ""
 		}
 		return info.URL
 	}())
-	a.emitServerInfoChanged()
 	if err != nil {
 		_, _ = runtime.MessageDialog(ctx, runtime.MessageDialogOptions{
 			Type:    runtime.ErrorDialog,
-			Title:   "共享失败",
+			Title:   a.tr(msgShareFailedTitle),
 			Message: err.Error(),
 		})
 	}
 }
 
+// domReady reports where settings live, checks how the last update went,
+// resumes the last share once the frontend can receive events and then
+// handles the share requests other instances sent while the window loaded.
+func (a *App) domReady(ctx context.Context) {
+	defer a.recoverCrash("domReady")
+	runtime.EventsEmit(ctx, "settingsLocation", currentSettingsLocation())
+	a.checkLastUpdate()
+	if strings.TrimSpace(a.initialShare) == "" {
+		a.autoResume(ctx)
+	}
+	if pending := a.launchReady(); len(pending) > 0 {
+		go a.replayIPCShares(pending)
+	}
+}
+
+// autoResume shares the remembered folder again when auto-resume is on and the
+// folder was still shared when the app quit. A folder that is gone only gets a
+// "lastShareMissing" event: nothing the user did just now failed.
+func (a *App) autoResume(ctx context.Context) {
+	if !a.shareServer.BoolSetting(shareserver.SettingKeyAutoResume) {
+		return
+	}
+	last, ok := a.shareServer.LastShare()
+	if !ok || !last.Active || a.shareServer.IsRunning() {
+		return
+	}
+	if !isDir(last.Root) {
+		appendLaunchLogf("auto-resume missing root=%q", last.Root)
+		runtime.EventsEmit(ctx, "lastShareMissing", last.Root)
+		return
+	}
+	info, err := a.startShare(ctx, last.Root)
+	appendLaunchLogf("auto-resume root=%q err=%v url=%v", last.Root, err, func() string {
+		if info == nil {
+			return ""
+		}
+		return info.URL
+	}())
+	if err != nil {
+		a.emitToastError(a.tr(msgResumeFailed, err))
+	}
+}
+
+// GetLastShare returns the folder shared last time, or nil if there is none.
+func (a *App) GetLastShare() *LastShareInfo {
+	last, ok := a.shareServer.LastShare()
+	if !ok {
+		return nil
+	}
+	return &LastShareInfo{Root: last.Root, Active: last.Active, Exists: isDir(last.Root)}
+}
+
+func isDir(p string) bool {
+	st, err := os.Stat(p)
+	return err == nil && st.IsDir()
+}
+
 func (a *App) startIPCListener() {
 	if a.ipcListener == nil {
 		return
 	}
 	a.ipcOnce.Do(func() {
 		go func() {
+			defer a.recoverCrash("ipc accept")
 			for {
 				conn, err := a.ipcListener.Accept()
 				if err != nil {
@@ -89,6 +335,7 @@ func (a *App) startIPCListener() {
 }
 
 func (a *App) handleIPCConn(conn net.Conn) {
+	defer a.recoverCrash("ipc")
 	defer func() { _ = conn.Close() }()
 	if a.ctx == nil {
 		return
@@ -97,7 +344,17 @@ func (a *App) handleIPCConn(conn net.Conn) {
 	data, _ := io.ReadAll(io.LimitReader(conn, 16*1024))
 	sharePath := strings.TrimSpace(string(data))
 	sharePath = strings.Trim(sharePath, "\"")
+	// A request racing startup waits for the window instead of the dialogs
+	// and events going nowhere.
+	if a.queueIPCShare(sharePath) {
+		return
+	}
+	a.handleIPCShare(sharePath)
+}
 
+// handleIPCShare brings the window forward and shares sharePath ("" only
+// shows the window).
+func (a *App) handleIPCShare(sharePath string) {
 	// 尽量把窗口拉到前台。
 	runtime.WindowShow(a.ctx)
 	runtime.WindowUnminimise(a.ctx)
@@ -110,27 +367,72 @@ func (a *App) handleIPCConn(conn net.Conn) {
 		return
 	}
 
-	info, err := a.shareServer.Start(a.ctx, sharePath)
+	info, err := a.startShare(a.ctx, sharePath)
 	appendLaunchLogf("ipc --share=%q err=%v url=%v", sharePath, err, func() string {
 		if info == nil {
 			return ""
 		}
 		return info.URL
 	}())
-	a.emitServerInfoChanged()
 	if err != nil {
 		_, _ = runtime.MessageDialog(a.ctx, runtime.MessageDialogOptions{
 			Type:    runtime.ErrorDialog,
-			Title:   "共享失败",
+			Title:   a.tr(msgShareFailedTitle),
 			Message: err.Error(),
 		})
 	}
 }
 
-func (a *App) StartSharing(folderPath string) (*ServerInfo, error) {
-	info, err := a.shareServer.Start(a.ctx, folderPath)
+// StartSharing shares folderPath and returns what Start did, warnings
+// included.
+func (a *App) StartSharing(folderPath string) (*shareserver.StartResult, error) {
+	return a.startShareResult(a.ctx, folderPath)
+}
+
+// startShareTimeout bounds a share attempt so a slow network drive or a huge
+// folder can't leave the UI waiting.
+const startShareTimeout = 5 * time.Second
+
+// startShare starts (or retargets) the share and shows its warnings as toasts.
+func (a *App) startShare(ctx context.Context, folderPath string) (*shareserver.ServerInfo, error) {
+	res, err := a.startShareResult(ctx, folderPath)
+	if err != nil {
+		return nil, err
+	}
+	return res.Info, nil
+}
+
+// startShareResult is startShare returning the whole StartResult.
+func (a *App) startShareResult(ctx context.Context, folderPath string) (*shareserver.StartResult, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, startShareTimeout)
+	defer cancel()
+
+	res, err := a.shareServer.Start(ctx, folderPath)
 	a.emitServerInfoChanged()
-	return info, err
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, errors.New(a.tr(msgShareTimeout))
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range res.Warnings {
+		if w == shareserver.WarningRootOverlap {
+			continue
+		}
+		a.emitToastError(a.warningText(w))
+	}
+	if res.Overlap != nil && res.Overlap.Relation != shareserver.RootOverlapSame && a.ctx != nil {
+		// The UI offers to go back to the previous folder.
+		runtime.EventsEmit(a.ctx, "shareRootOverlap", map[string]any{
+			"previous": res.Overlap.Previous,
+			"current":  res.Info.SharedFolder,
+			"relation": res.Overlap.Relation,
+		})
+	}
+	return res, nil
 }
 
 func (a *App) StopSharing() error {
@@ -139,16 +441,106 @@ func (a *App) StopSharing() error {
 	return err
 }
 
-func (a *App) GetServerInfo() (*ServerInfo, error) {
+func (a *App) GetServerInfo() (*shareserver.ServerInfo, error) {
 	return a.shareServer.GetServerInfo()
 }
 
-func (a *App) ApplyCustomPorts(input string) (*ServerInfo, error) {
+func (a *App) ApplyCustomPorts(input string) (*shareserver.ServerInfo, error) {
 	info, err := a.shareServer.ApplyCustomPorts(a.ctx, input)
 	a.emitServerInfoChanged()
 	return info, err
 }
 
+// SetShareExpiry stops sharing after the given number of minutes; 0 clears
+// the timer. It is rearmed on every new share until cleared, and returns the
+// current ServerInfo (nil when not sharing).
+func (a *App) SetShareExpiry(minutes int) (*shareserver.ServerInfo, error) {
+	info, err := a.shareServer.SetExpiry(time.Duration(minutes) * time.Minute)
+	a.emitServerInfoChanged()
+	return info, err
+}
+
+// ResetUploadQuota clears the upload counter of the given client IP.
+// Pass "" to reset every client.
+func (a *App) ResetUploadQuota(ip string) {
+	a.shareServer.ResetUploadQuota(ip)
+}
+
+// GetServerMeta reports the share server's version, endpoints and auth mode,
+// the same data the web UI reads from /api/meta.
+func (a *App) GetServerMeta() shareserver.Meta {
+	return a.shareServer.Meta()
+}
+
+// GetAccessLog returns up to limit recent HTTP requests of the share server,
+// newest first (limit <= 0 returns everything kept in memory).
+func (a *App) GetAccessLog(limit int) []shareserver.AccessLogEntry {
+	return a.shareServer.AccessLog(limit)
+}
+
+// GetWebServeMode reports where the share web UI is served from:
+// "embedded", "disk", "custom" or "missing".
+func (a *App) GetWebServeMode() string {
+	return a.shareServer.WebServeMode()
+}
+
+// SetWebDistDir serves the share web UI from dir (a web/dist build) instead of
+// the bundled copy, without restarting. Pass "" to go back to the bundled one.
+func (a *App) SetWebDistDir(dir string) error {
+	dir = strings.TrimSpace(dir)
+	if dir == "" {
+		return a.shareServer.SetSetting(shareserver.SettingKeyWebDistDir, nil)
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if !shareserver.IsWebDistDir(abs) {
+		return errors.New("该目录下没有 index.html")
+	}
+	b, err := json.Marshal(abs)
+	if err != nil {
+		return err
+	}
+	return a.shareServer.SetSetting(shareserver.SettingKeyWebDistDir, b)
+}
+
+// errUseAccessPassBinding keeps the access pass from being read or written
+// as a raw setting, which would skip validation and token revocation.
+var errUseAccessPassBinding = errors.New("访问口令请通过 SetAccessPass / ClearAccessPass 设置")
+
+func isAccessPassSettingKey(key string) bool {
+	return key == shareserver.SettingKeyAccessPass || key == shareserver.SettingKeyAccessPassChangedAt
+}
+
+// SetAccessPass validates and stores the access pass ("" turns it off) and
+// signs out every web client.
+func (a *App) SetAccessPass(pass string) error {
+	if err := a.shareServer.SetAccessPass(pass); err != nil {
+		return err
+	}
+	a.emitAccessPassChanged()
+	return nil
+}
+
+// ClearAccessPass turns the access pass off and signs out every web client.
+func (a *App) ClearAccessPass() error {
+	return a.SetAccessPass("")
+}
+
+// GetAccessPassStatus reports whether a pass is set and when it last changed,
+// never the pass itself.
+func (a *App) GetAccessPassStatus() shareserver.AccessPassStatus {
+	return a.shareServer.AccessPassStatus()
+}
+
+func (a *App) emitAccessPassChanged() {
+	if a.ctx == nil {
+		return
+	}
+	runtime.EventsEmit(a.ctx, "accessPassChanged", a.shareServer.AccessPassStatus())
+}
+
 // GetSetting returns a JSON string previously stored under key.
 // If the key does not exist, it returns an empty string.
 func (a *App) GetSetting(key string) (string, error) {
@@ -156,14 +548,17 @@ func (a *App) GetSetting(key string) (string, error) {
 	if key == "" {
 		return "", nil
 	}
-	if !isValidSettingKey(key) {
+	if !shareserver.IsValidSettingKey(key) {
 		return "", errors.New("invalid key")
 	}
-	if a.shareServer == nil || a.shareServer.settings == nil {
+	if isAccessPassSettingKey(key) {
+		return "", errUseAccessPassBinding
+	}
+	if a.shareServer == nil {
 		return "", errors.New("settings store not available")
 	}
 
-	raw, ok, err := a.shareServer.settings.Get(key)
+	raw, ok, err := a.shareServer.Setting(key)
 	if err != nil {
 		return "", err
 	}
@@ -179,31 +574,93 @@ func (a *App) SetSetting(key string, value string) error {
 	if key == "" {
 		return nil
 	}
-	if !isValidSettingKey(key) {
+	if !shareserver.IsValidSettingKey(key) {
 		return errors.New("invalid key")
 	}
-	if a.shareServer == nil || a.shareServer.settings == nil {
+	if isAccessPassSettingKey(key) {
+		return errUseAccessPassBinding
+	}
+	if a.shareServer == nil {
 		return errors.New("settings store not available")
 	}
 
 	value = strings.TrimSpace(value)
-	if value == "" || value == "null" {
-		if err := a.shareServer.settings.Delete(key); err != nil {
+	var raw json.RawMessage
+	if value != "" && value != "null" {
+		if !json.Valid([]byte(value)) {
+			return errors.New("invalid json")
+		}
+		raw = json.RawMessage(value)
+	}
+	if key == shareserver.SettingKeyTempDir && raw != nil {
+		if err := validateTempDir(raw); err != nil {
 			return err
 		}
-		a.shareServer.emitSettingChanged(key, json.RawMessage("null"))
-		return nil
 	}
-	if !json.Valid([]byte(value)) {
-		return errors.New("invalid json")
+	if key == shareserver.SettingKeyLanguage && raw != nil {
+		if err := validateLanguage(raw); err != nil {
+			return err
+		}
 	}
-	if err := a.shareServer.settings.Set(key, json.RawMessage(value)); err != nil {
+	if err := a.shareServer.SetSetting(key, raw); err != nil {
 		return err
 	}
-	a.shareServer.emitSettingChanged(key, json.RawMessage(value))
+	if key == shareserver.SettingKeyPortRedirect || key == shareserver.SettingKeyReadOnly {
+		// The redirect listener was (un)bound or read-only mode toggled:
+		// ServerInfo.RedirectFrom / ReadOnly changed.
+		a.emitServerInfoChanged()
+	}
 	return nil
 }
 
+// SetReadOnly turns the single read-only switch on or off. While on, web
+// clients can only browse and download, whatever the permission settings say.
+func (a *App) SetReadOnly(readOnly bool) error {
+	var raw json.RawMessage
+	if readOnly {
+		raw = json.RawMessage("true")
+	}
+	return a.SetSetting(shareserver.SettingKeyReadOnly, string(raw))
+}
+
+// GetMarkUploads reports whether uploaded files get Mark-of-the-Web
+// (shareserver.SettingKeyMarkUploads).
+func (a *App) GetMarkUploads() bool {
+	return a.shareServer.BoolSetting(shareserver.SettingKeyMarkUploads)
+}
+
+// SetMarkUploads turns Mark-of-the-Web on uploaded files on or off. It only
+// has an effect on Windows, where the mark is an NTFS stream.
+func (a *App) SetMarkUploads(mark bool) error {
+	var raw json.RawMessage
+	if mark {
+		raw = json.RawMessage("true")
+	}
+	return a.SetSetting(shareserver.SettingKeyMarkUploads, string(raw))
+}
+
+// GetSettingHistory returns the last few values of key, newest first, with
+// when and from where (desktop or a web client's IP) each was written.
+func (a *App) GetSettingHistory(key string) ([]shareserver.SettingHistoryEntry, error) {
+	key = strings.TrimSpace(key)
+	if !shareserver.IsValidSettingKey(key) {
+		return nil, errors.New("invalid key")
+	}
+	return a.shareServer.SettingHistory(key)
+}
+
+// RevertSetting restores the value at index of GetSettingHistory(key).
+func (a *App) RevertSetting(key string, index int) error {
+	key = strings.TrimSpace(key)
+	if !shareserver.IsValidSettingKey(key) {
+		return errors.New("invalid key")
+	}
+	if isAccessPassSettingKey(key) {
+		return errUseAccessPassBinding
+	}
+	return a.shareServer.RevertSetting(key, index)
+}
+
 // OpenFolder opens the given path in the OS file explorer.
 // Used by the frontend when clicking the shared folder path.
 func (a *App) OpenFolder(path string) error {
@@ -214,11 +671,45 @@ func (a *App) OpenFolder(path string) error {
 	return openFolderInOS(path)
 }
 
+// ListSharedDirectory lists a directory of the current share exactly as the
+// web UI would see it via /api/files, without going through HTTP/auth.
+func (a *App) ListSharedDirectory(relPath string) ([]shareserver.DirectoryItem, error) {
+	return a.shareServer.ListDirectory(relPath)
+}
+
+// GetFolderShareURL returns a link (and its QR code) that opens the web UI
+// directly in the shared sub-folder relPath. With an access pass set, the
+// link works once without typing the pass.
+func (a *App) GetFolderShareURL(relPath string) (*FolderShareURL, error) {
+	u, err := a.shareServer.FolderURL(relPath)
+	if err != nil {
+		return nil, err
+	}
+	modules, err := encodeQR(u)
+	if err != nil {
+		return nil, err
+	}
+	qr, err := qrPNGDataURI(modules, 8)
+	if err != nil {
+		return nil, err
+	}
+	return &FolderShareURL{URL: u, QRDataURI: qr}, nil
+}
+
+// RevealInShare selects the given share-relative path in the OS file explorer.
+func (a *App) RevealInShare(relPath string) error {
+	fullPath, err := a.shareServer.ResolvePath(relPath)
+	if err != nil {
+		return err
+	}
+	return revealInOS(fullPath)
+}
+
 func (a *App) PickFolder() (string, error) {
 	if a.ctx == nil {
 		return "", nil
 	}
 	return runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{
-		Title: "选择要共享的文件夹",
+		Title: a.tr(msgPickFolderTitle),
 	})
 }
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"LocalShare/pkg/shareserver"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// checksumProgress is emitted as "checksumProgress"; the last event has
+// Done=true, or Error set when the job couldn't start walking.
+type checksumProgress struct {
+	JobID string `json:"jobId"`
+	shareserver.ChecksumProgress
+	Error string `json:"error,omitempty"`
+}
+
+type checksumJob struct {
+	id     string
+	cancel context.CancelFunc
+}
+
+type checksumJobs struct {
+	mu      sync.Mutex
+	seq     int
+	current *checksumJob
+}
+
+// GenerateChecksums writes "<name>.sha256" sidecars for the shared file or
+// folder relPath (recursive: every file below it) in the background and
+// returns a job ID right away. Progress arrives via "checksumProgress"
+// events. Files with an up-to-date sidecar are skipped, so a canceled job
+// resumes cheaply. Starting a new job cancels the previous one.
+func (a *App) GenerateChecksums(relPath string, recursive bool) (string, error) {
+	if _, err := a.shareServer.ResolvePath(relPath); err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.checksums.mu.Lock()
+	if a.checksums.current != nil {
+		a.checksums.current.cancel()
+	}
+	a.checksums.seq++
+	job := &checksumJob{id: strconv.Itoa(a.checksums.seq), cancel: cancel}
+	a.checksums.current = job
+	a.checksums.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		res, err := a.shareServer.GenerateChecksums(ctx, relPath, recursive, func(p shareserver.ChecksumProgress) {
+			a.emitChecksumProgress(checksumProgress{JobID: job.id, ChecksumProgress: p})
+		})
+		if err != nil {
+			res.Done = true
+			a.emitChecksumProgress(checksumProgress{JobID: job.id, ChecksumProgress: res, Error: err.Error()})
+		}
+
+		a.checksums.mu.Lock()
+		if a.checksums.current == job {
+			a.checksums.current = nil
+		}
+		a.checksums.mu.Unlock()
+	}()
+	return job.id, nil
+}
+
+// CancelChecksums cancels the running GenerateChecksums job, if any.
+func (a *App) CancelChecksums() {
+	a.checksums.mu.Lock()
+	defer a.checksums.mu.Unlock()
+	if a.checksums.current != nil {
+		a.checksums.current.cancel()
+		a.checksums.current = nil
+	}
+}
+
+func (a *App) emitChecksumProgress(p checksumProgress) {
+	if a.ctx == nil {
+		return
+	}
+	runtime.EventsEmit(a.ctx, "checksumProgress", p)
+}
@@ -25,24 +25,73 @@ async function getRemoteSetting<T>(key: string): Promise<T | undefined> {
     return JSON.parse(raw) as T;
   }
 
-  const token = getWebToken();
+  return (await batchedWebGet(key)) as T | undefined;
+}
 
-  const res = await fetch(`/api/settings/${encodeURIComponent(key)}`, {
-    method: "GET",
-    headers: {
-      Accept: "application/json",
-      ...(token ? { "X-Share-Token": token } : {}),
-    },
+/** Server limit of GET /api/settings?keys= */
+const MAX_BATCH_KEYS = 100;
+
+interface PendingGet {
+  resolve: (value: unknown) => void;
+  reject: (err: unknown) => void;
+}
+
+let pendingGets: Map<string, PendingGet[]> | null = null;
+
+/**
+ * Reads issued in the same tick (every useRemoteSetting on startup) go out
+ * as one GET /api/settings?keys=a,b,c instead of a request per key.
+ */
+function batchedWebGet(key: string): Promise<unknown> {
+  return new Promise((resolve, reject) => {
+    if (!pendingGets) {
+      pendingGets = new Map();
+      setTimeout(flushWebGets, 0);
+    }
+    const waiters = pendingGets.get(key) ?? [];
+    waiters.push({ resolve, reject });
+    pendingGets.set(key, waiters);
   });
+}
 
-  if (res.status === 404) return undefined;
-  if (!res.ok) {
-    throw new Error(`get setting failed: ${res.status}`);
+function flushWebGets() {
+  const batch = pendingGets;
+  pendingGets = null;
+  if (!batch) return;
+  const keys = [...batch.keys()];
+  for (let i = 0; i < keys.length; i += MAX_BATCH_KEYS) {
+    void fetchSettingsBatch(keys.slice(i, i + MAX_BATCH_KEYS), batch);
   }
+}
 
-  const data = (await res.json()) as { value?: T };
-  if (!data || !("value" in data)) return undefined;
-  return data.value as T;
+async function fetchSettingsBatch(
+  keys: string[],
+  batch: Map<string, PendingGet[]>,
+) {
+  try {
+    const token = getWebToken();
+    const res = await fetch(
+      `/api/settings?keys=${encodeURIComponent(keys.join(","))}`,
+      {
+        method: "GET",
+        headers: {
+          Accept: "application/json",
+          ...(token ? { "X-Share-Token": token } : {}),
+        },
+      },
+    );
+    if (!res.ok) {
+      throw new Error(`get setting failed: ${res.status}`);
+    }
+    const data = (await res.json()) as { values?: Record<string, unknown> };
+    for (const key of keys) {
+      batch.get(key)?.forEach((w) => w.resolve(data?.values?.[key]));
+    }
+  } catch (err) {
+    for (const key of keys) {
+      batch.get(key)?.forEach((w) => w.reject(err));
+    }
+  }
 }
 
 async function setRemoteSetting<T>(
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	wruntime "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// crashReportDir lives next to settings.json so users can find both in one place.
+func crashReportDir() string {
+	cfgDir, err := os.UserConfigDir()
+	if err != nil || cfgDir == "" {
+		cfgDir = "."
+	}
+	return filepath.Join(cfgDir, "local-share-golang", "crash")
+}
+
+// writeCrashReport saves a panic and its stack to a new file and returns its path.
+func writeCrashReport(where string, v any, stack []byte) (string, error) {
+	dir := crashReportDir()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	p := filepath.Join(dir, "crash-"+now.Format("20060102-150405.000")+".txt")
+	report := fmt.Sprintf("LocalShare %s (%s/%s)\ntime: %s\nwhere: %s\npanic: %v\n\n%s",
+		Version, runtime.GOOS, runtime.GOARCH, now.Format(time.RFC3339), where, v, stack)
+	if err := os.WriteFile(p, []byte(report), 0o644); err != nil {
+		return "", err
+	}
+	return p, nil
+}
+
+// recoverCrash must be deferred directly (defer a.recoverCrash("...")).
+// It writes a crash report, offers to show it, and keeps the app running.
+func (a *App) recoverCrash(where string) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	p, err := writeCrashReport(where, v, debug.Stack())
+	appendLaunchLogf("panic in %s: %v report=%q err=%v", where, v, p, err)
+	if a == nil || a.ctx == nil || err != nil {
+		return
+	}
+	open, closeLabel := a.tr(msgButtonOpen), a.tr(msgButtonClose)
+	res, _ := wruntime.MessageDialog(a.ctx, wruntime.MessageDialogOptions{
+		Type:          wruntime.QuestionDialog,
+		Title:         a.tr(msgCrashTitle),
+		Message:       a.tr(msgCrashBody, p),
+		Buttons:       []string{open, closeLabel},
+		DefaultButton: open,
+		CancelButton:  closeLabel,
+	})
+	// Windows only offers Yes/No for question dialogs.
+	if res == open || res == "Yes" {
+		if err := revealInOS(p); err != nil {
+			appendLaunchLogf("reveal crash report err=%v", err)
+		}
+	}
+}
+
+// recoverMainCrash records a panic on the startup path before Wails is up
+// (no dialog possible yet), then lets it continue to terminate the process.
+func recoverMainCrash() {
+	v := recover()
+	if v == nil {
+		return
+	}
+	p, err := writeCrashReport("main", v, debug.Stack())
+	appendLaunchLogf("panic in main: %v report=%q err=%v", v, p, err)
+	panic(v)
+}
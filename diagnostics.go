@@ -0,0 +1,246 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"LocalShare/pkg/shareserver"
+)
+
+const (
+	// diagLaunchLogLines is how much of the launch log goes into a report.
+	diagLaunchLogLines = 500
+	// diagAccessLogEntries is how many recent requests go into a report.
+	diagAccessLogEntries = 200
+)
+
+// diagReport is report.json of a diagnostics zip.
+type diagReport struct {
+	GeneratedAt       string                      `json:"generatedAt"`
+	Version           string                      `json:"version"`
+	OS                string                      `json:"os"`
+	Arch              string                      `json:"arch"`
+	GoVersion         string                      `json:"goVersion"`
+	ServerInfo        *shareserver.ServerInfo     `json:"serverInfo"`
+	WebServeMode      string                      `json:"webServeMode"`
+	AccessPassEnabled bool                        `json:"accessPassEnabled"`
+	Permissions       shareserver.Permissions     `json:"permissions"`
+	ContextMenu       string                      `json:"contextMenu"`
+	Network           []shareserver.IPv4Candidate `json:"network"`
+	NetworkError      string                      `json:"networkError,omitempty"`
+	TempDir           string                      `json:"tempDir"`
+	Settings          SettingsLocation            `json:"settings"`
+}
+
+// GenerateDiagnostics writes a zip for support requests to the temp dir (see
+// tempDir) and returns its path; openFolder reveals it in the file explorer.
+// Pass, tokens and paths outside the shared folder are redacted.
+func (a *App) GenerateDiagnostics(openFolder bool) (string, error) {
+	info, _ := a.shareServer.GetServerInfo()
+	red := a.diagRedactor(info)
+
+	report := diagReport{
+		GeneratedAt:       time.Now().Format(time.RFC3339),
+		Version:           Version,
+		OS:                runtime.GOOS,
+		Arch:              runtime.GOARCH,
+		GoVersion:         runtime.Version(),
+		ServerInfo:        info,
+		WebServeMode:      a.shareServer.WebServeMode(),
+		AccessPassEnabled: a.shareServer.AccessPassStatus().Enabled,
+		Permissions:       a.shareServer.Permissions(),
+		TempDir:           a.tempDir(),
+		Settings:          currentSettingsLocation(),
+	}
+	if st, err := a.CheckContextMenuExists(); err != nil {
+		report.ContextMenu = "检测失败: " + err.Error()
+	} else if st.Exists {
+		report.ContextMenu = "已添加"
+	} else {
+		report.ContextMenu = "未添加"
+	}
+	if cands, err := shareserver.LocalIPv4Candidates(); err != nil {
+		report.NetworkError = err.Error()
+	} else {
+		report.Network = cands
+	}
+	reportJSON, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	var access strings.Builder
+	for _, e := range a.shareServer.AccessLog(diagAccessLogEntries) {
+		if b, err := json.Marshal(e); err == nil {
+			access.Write(b)
+			access.WriteByte('\n')
+		}
+	}
+
+	files := []struct{ name, content string }{
+		{"report.json", string(reportJSON)},
+		{"launch.log", tailLines(readLaunchLog(), diagLaunchLogLines)},
+		{"access-log.jsonl", access.String()},
+		{"firewall.txt", firewallStatus()},
+	}
+
+	p := filepath.Join(report.TempDir, "localshare-diagnostics-"+time.Now().Format("20060102-150405")+".zip")
+	f, err := os.Create(p)
+	if err != nil {
+		return "", err
+	}
+	zw := zip.NewWriter(f)
+	for _, file := range files {
+		w, err := zw.Create(file.name)
+		if err == nil {
+			_, err = w.Write([]byte(red.redact(file.content)))
+		}
+		if err != nil {
+			_ = zw.Close()
+			_ = f.Close()
+			_ = os.Remove(p)
+			return "", err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		_ = f.Close()
+		_ = os.Remove(p)
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(p)
+		return "", err
+	}
+	appendLaunchLogf("diagnostics written path=%q", p)
+
+	if openFolder {
+		if err := revealInOS(p); err != nil {
+			return p, err
+		}
+	}
+	return p, nil
+}
+
+func (a *App) diagRedactor(info *shareserver.ServerInfo) diagRedactor {
+	r := diagRedactor{}
+	r.home, _ = os.UserHomeDir()
+	if info != nil {
+		r.shareRoot = info.SharedFolder
+		r.secrets = append(r.secrets, info.ShortCode)
+	}
+	if raw, ok, err := a.shareServer.Setting(shareserver.SettingKeyAccessPass); err == nil && ok {
+		var pass string
+		if json.Unmarshal(raw, &pass) == nil {
+			r.secrets = append(r.secrets, strings.TrimSpace(pass))
+		}
+	}
+	if exe, err := os.Executable(); err == nil {
+		r.exe = exe
+	}
+	return r
+}
+
+func readLaunchLog() string {
+	s, err := readLaunchLogFrom(launchLogPath())
+	if err != nil {
+		return fmt.Sprintf("(launch log unavailable: %v)\n", err)
+	}
+	return s
+}
+
+// tailLines returns the last n lines of s.
+func tailLines(s string, n int) string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "")
+}
+
+// diagRedactor scrubs diagnostics text. Paths inside the shared folder keep
+// their share-relative part ("<share>\docs\a.txt"); any other file path
+// becomes "<path>", erring on the side of redacting too much.
+type diagRedactor struct {
+	shareRoot string
+	home      string
+	exe       string
+	// secrets are replaced wherever they appear as a whole word.
+	secrets []string
+}
+
+var (
+	diagSecretQuery = regexp.MustCompile(`(?i)\b(token|pass|password|dl|link|ott)=[^&\s"']+`)
+	diagQuoted      = regexp.MustCompile(`"(?:[^"\\\n]|\\.)*"`)
+	diagWindowsPath = regexp.MustCompile(`(?:\b[A-Za-z]:|\\\\[^\\\s"]+)[\\/][^:*?"<>|\r\n]*`)
+	diagWindowsAbs  = regexp.MustCompile(`^(?:[A-Za-z]:[\\/]|\\\\)`)
+)
+
+func (r diagRedactor) redact(s string) string {
+	for _, secret := range r.secrets {
+		if secret == "" {
+			continue
+		}
+		re := regexp.MustCompile(`\b` + regexp.QuoteMeta(secret) + `\b`)
+		s = re.ReplaceAllString(s, "REDACTED")
+	}
+	s = diagSecretQuery.ReplaceAllString(s, "$1=REDACTED")
+	if r.exe != "" {
+		s = strings.ReplaceAll(s, r.exe, "<exe>")
+		s = strings.ReplaceAll(s, strings.ReplaceAll(r.exe, `\`, `\\`), "<exe>")
+	}
+	// Quoted strings (%q in logs, JSON) are redacted as a whole, so paths
+	// with spaces don't leak their tail.
+	s = diagQuoted.ReplaceAllStringFunc(s, func(q string) string {
+		v, err := strconv.Unquote(q)
+		if err != nil || !r.isFilePath(v) {
+			return q
+		}
+		return strconv.Quote(r.path(v))
+	})
+	s = diagWindowsPath.ReplaceAllStringFunc(s, r.path)
+	if r.home != "" && r.home != "/" && !diagWindowsAbs.MatchString(r.home) {
+		re := regexp.MustCompile(regexp.QuoteMeta(r.home) + `(?:/[^:"\s]*)?`)
+		s = re.ReplaceAllStringFunc(s, r.path)
+	}
+	return s
+}
+
+func (r diagRedactor) isFilePath(v string) bool {
+	if diagWindowsAbs.MatchString(v) {
+		return true
+	}
+	return r.under(v, r.shareRoot) || r.under(v, r.home)
+}
+
+// path maps p into the share ("<share>/rest") or hides it.
+func (r diagRedactor) path(p string) string {
+	if r.under(p, r.shareRoot) {
+		return "<share>" + p[len(r.shareRoot):]
+	}
+	return "<path>"
+}
+
+// under reports whether p is dir or inside it. Windows paths compare
+// case-insensitively.
+func (r diagRedactor) under(p, dir string) bool {
+	if dir == "" || len(p) < len(dir) {
+		return false
+	}
+	head := p[:len(dir)]
+	if head != dir && !(diagWindowsAbs.MatchString(dir) && strings.EqualFold(head, dir)) {
+		return false
+	}
+	rest := p[len(dir):]
+	return rest == "" || rest[0] == '\\' || rest[0] == '/' || strings.HasSuffix(dir, `\`) || strings.HasSuffix(dir, "/")
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiagRedactor(t *testing.T) {
+	r := diagRedactor{
+		shareRoot: `C:\Users\Bob\Share Folder`,
+		home:      "/home/bob",
+		exe:       `C:\Apps\LocalShare\localshare.exe`,
+		secrets:   []string{"s3cret", "123456"},
+	}
+	in := strings.Join([]string{
+		`startup --share="C:\\Users\\Bob\\Share Folder\\docs" err=<nil>`,
+		`auto-resume root="C:\\Users\\Bob\\My Documents\\plan.docx"`,
+		`watcher not started err=open D:\private\notes.txt: access denied`,
+		`open c:\users\bob\share folder\a.txt: locked`,
+		`GET /api/files?path=docs&token=abc.def -> 200`,
+		`GET /api/download?path=a.txt&dl=abc.def&link=xyz -> 200`,
+		`pass s3cret shortURL http://10.0.0.2:8080/c/123456 port 41234567`,
+		`main exe="C:\\Apps\\LocalShare\\localshare.exe"`,
+		`{"sharedFolder": "C:\\Users\\Bob\\Share Folder"}`,
+		`save err=open /home/bob/.config/x.json: denied "/home/bob/a b.txt"`,
+	}, "\n")
+	want := strings.Join([]string{
+		`startup --share="<share>\\docs" err=<nil>`,
+		`auto-resume root="<path>"`,
+		`watcher not started err=open <path>: access denied`,
+		`open <share>\a.txt: locked`,
+		`GET /api/files?path=docs&token=REDACTED -> 200`,
+		`GET /api/download?path=a.txt&dl=REDACTED&link=REDACTED -> 200`,
+		`pass REDACTED shortURL http://10.0.0.2:8080/c/REDACTED port 41234567`,
+		`main exe="<exe>"`,
+		`{"sharedFolder": "<share>"}`,
+		`save err=open <path>: denied "<path>"`,
+	}, "\n")
+	if got := r.redact(in); got != want {
+		t.Fatalf("redact mismatch:\n got: %s\nwant: %s", got, want)
+	}
+
+	if got := tailLines("a\nb\nc\n", 2); got != "b\nc\n" {
+		t.Fatalf("tailLines = %q", got)
+	}
+}
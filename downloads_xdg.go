@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// getDownloadsDirXDG returns XDG_DOWNLOAD_DIR from the environment or from
+// $XDG_CONFIG_HOME/user-dirs.dirs, so a renamed or localized Downloads folder
+// ("~/下载") is found on Linux desktops.
+func getDownloadsDirXDG() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	if v := os.Getenv("XDG_DOWNLOAD_DIR"); strings.TrimSpace(v) != "" {
+		if p := expandXDGUserDir(v, home); p != "" {
+			return p, nil
+		}
+	}
+	cfg := os.Getenv("XDG_CONFIG_HOME")
+	if cfg == "" || !filepath.IsAbs(cfg) {
+		cfg = filepath.Join(home, ".config")
+	}
+	b, err := os.ReadFile(filepath.Join(cfg, "user-dirs.dirs"))
+	if err != nil {
+		return "", err
+	}
+	if p := parseXDGUserDir(string(b), "XDG_DOWNLOAD_DIR", home); p != "" {
+		return p, nil
+	}
+	return "", errors.New("XDG_DOWNLOAD_DIR not set")
+}
+
+// parseXDGUserDir reads key from a user-dirs.dirs file: shell-style
+// KEY="$HOME/dir" lines, where the value is absolute or relative to $HOME.
+func parseXDGUserDir(content string, key string, home string) string {
+	found := ""
+	sc := bufio.NewScanner(strings.NewReader(content))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok || strings.TrimSpace(k) != key {
+			continue
+		}
+		v = strings.TrimSpace(v)
+		if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+			v = v[1 : len(v)-1]
+		}
+		v = strings.ReplaceAll(v, `\"`, `"`)
+		// Like the shell, the last assignment wins.
+		found = expandXDGUserDir(v, home)
+	}
+	return found
+}
+
+// expandXDGUserDir resolves "$HOME/..." and absolute values; anything else is
+// not allowed by the spec and yields "". A value of just $HOME means the
+// folder is disabled.
+func expandXDGUserDir(v string, home string) string {
+	switch {
+	case v == "$HOME" || v == "$HOME/":
+		return ""
+	case strings.HasPrefix(v, "$HOME/"):
+		return filepath.Join(home, filepath.FromSlash(strings.TrimPrefix(v, "$HOME/")))
+	case strings.HasPrefix(v, "${HOME}/"):
+		return filepath.Join(home, filepath.FromSlash(strings.TrimPrefix(v, "${HOME}/")))
+	case strings.HasPrefix(v, "/"):
+		return filepath.Clean(filepath.FromSlash(v))
+	}
+	return ""
+}
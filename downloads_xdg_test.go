@@ -0,0 +1,29 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestParseXDGUserDir(t *testing.T) {
+	home := filepath.FromSlash("/home/me")
+	content := `# This file is written by xdg-user-dirs-update
+XDG_DESKTOP_DIR="$HOME/桌面"
+XDG_DOWNLOAD_DIR="$HOME/下载"
+`
+	if got := parseXDGUserDir(content, "XDG_DOWNLOAD_DIR", home); got != filepath.Join(home, "下载") {
+		t.Fatalf("unexpected download dir %q", got)
+	}
+	cases := map[string]string{
+		`XDG_DOWNLOAD_DIR="/data/dl"`:          filepath.FromSlash("/data/dl"),
+		`XDG_DOWNLOAD_DIR="${HOME}/My \"DL\""`: filepath.Join(home, `My "DL"`),
+		`XDG_DOWNLOAD_DIR="$HOME/"`:            "",
+		`XDG_DOWNLOAD_DIR="relative/dl"`:       "",
+		`XDG_MUSIC_DIR="$HOME/Music"`:          "",
+	}
+	for line, want := range cases {
+		if got := parseXDGUserDir(line, "XDG_DOWNLOAD_DIR", home); got != want {
+			t.Fatalf("%s: got %q, want %q", line, got, want)
+		}
+	}
+}
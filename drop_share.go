@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"LocalShare/pkg/shareserver"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// Why paths dropped onto the window didn't start a share ("dropRejected").
+const (
+	dropRejectedEmpty    = "empty"
+	dropRejectedMultiple = "multiple"
+	dropRejectedFile     = "file"
+	dropRejectedMissing  = "missing"
+)
+
+// droppedShareDir picks the folder to share from paths dropped onto the
+// window: exactly one existing directory. Otherwise reason says what's wrong.
+// There is no single-file share yet, so a dropped file is rejected too.
+func droppedShareDir(paths []string) (dir string, reason string) {
+	var list []string
+	for _, p := range paths {
+		if p = strings.TrimSpace(p); p != "" {
+			list = append(list, p)
+		}
+	}
+	switch {
+	case len(list) == 0:
+		return "", dropRejectedEmpty
+	case len(list) > 1:
+		return "", dropRejectedMultiple
+	}
+	st, err := os.Stat(list[0])
+	if err != nil {
+		return "", dropRejectedMissing
+	}
+	if !st.IsDir() {
+		return "", dropRejectedFile
+	}
+	return list[0], ""
+}
+
+// ShareDroppedPaths starts sharing a folder dropped onto the window, the same
+// way StartSharing does. Invalid drops emit "dropRejected" and return nil.
+func (a *App) ShareDroppedPaths(paths []string) (*shareserver.ServerInfo, error) {
+	dir, reason := droppedShareDir(paths)
+	if reason != "" {
+		if a.ctx != nil {
+			runtime.EventsEmit(a.ctx, "dropRejected", map[string]any{
+				"reason": reason,
+				"count":  len(paths),
+			})
+		}
+		return nil, nil
+	}
+	return a.startShare(a.ctx, dir)
+}
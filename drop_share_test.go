@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDroppedShareDir(t *testing.T) {
+	tmp := t.TempDir()
+	dir := filepath.Join(tmp, "photos")
+	file := filepath.Join(tmp, "a.txt")
+	_ = os.MkdirAll(dir, 0o755)
+	_ = os.WriteFile(file, []byte("a"), 0o644)
+
+	cases := []struct {
+		paths      []string
+		wantDir    string
+		wantReason string
+	}{
+		{[]string{dir}, dir, ""},
+		{[]string{" ", dir}, dir, ""},
+		{nil, "", dropRejectedEmpty},
+		{[]string{""}, "", dropRejectedEmpty},
+		{[]string{dir, tmp}, "", dropRejectedMultiple},
+		{[]string{file}, "", dropRejectedFile},
+		{[]string{filepath.Join(tmp, "missing")}, "", dropRejectedMissing},
+	}
+	for _, tc := range cases {
+		gotDir, gotReason := droppedShareDir(tc.paths)
+		if gotDir != tc.wantDir || gotReason != tc.wantReason {
+			t.Errorf("droppedShareDir(%q) = %q, %q; want %q, %q", tc.paths, gotDir, gotReason, tc.wantDir, tc.wantReason)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// serverInfoEventWindow is how long serverInfoChanged events are batched.
+const serverInfoEventWindow = 200 * time.Millisecond
+
+// throttledEmitter runs emit at most once per window. The first trigger emits
+// right away; triggers during the window are folded into one emission when it
+// closes, so the last state is always sent.
+type throttledEmitter struct {
+	window time.Duration
+	emit   func()
+
+	mu sync.Mutex
+	// open is true from an emission until its window closes.
+	open    bool
+	pending bool
+}
+
+func newThrottledEmitter(window time.Duration, emit func()) *throttledEmitter {
+	return &throttledEmitter{window: window, emit: emit}
+}
+
+func (t *throttledEmitter) trigger() {
+	t.mu.Lock()
+	if t.open {
+		t.pending = true
+		t.mu.Unlock()
+		return
+	}
+	t.open = true
+	t.mu.Unlock()
+
+	t.emit()
+	time.AfterFunc(t.window, t.windowClosed)
+}
+
+func (t *throttledEmitter) windowClosed() {
+	t.mu.Lock()
+	if !t.pending {
+		t.open = false
+		t.mu.Unlock()
+		return
+	}
+	// The trailing emission opens a window of its own.
+	t.pending = false
+	t.mu.Unlock()
+
+	t.emit()
+	time.AfterFunc(t.window, t.windowClosed)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestThrottledEmitter(t *testing.T) {
+	var mu sync.Mutex
+	var emits []time.Time
+	emitted := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(emits)
+	}
+	window := 50 * time.Millisecond
+	e := newThrottledEmitter(window, func() {
+		mu.Lock()
+		emits = append(emits, time.Now())
+		mu.Unlock()
+	})
+
+	// A lone trigger emits at once and nothing follows.
+	e.trigger()
+	if n := emitted(); n != 1 {
+		t.Fatalf("expected immediate emit, got %d", n)
+	}
+	time.Sleep(3 * window)
+	if n := emitted(); n != 1 {
+		t.Fatalf("expected no trailing emit, got %d", n)
+	}
+
+	// A burst: one now, one when the window closes.
+	for i := 0; i < 10; i++ {
+		e.trigger()
+	}
+	if n := emitted(); n != 2 {
+		t.Fatalf("expected one emit for the start of a burst, got %d", n)
+	}
+	time.Sleep(3 * window)
+	if n := emitted(); n != 3 {
+		t.Fatalf("expected exactly one trailing emit, got %d", n)
+	}
+	mu.Lock()
+	gap := emits[2].Sub(emits[1])
+	mu.Unlock()
+	if gap < window {
+		t.Fatalf("trailing emit came %v after the first, before the %v window closed", gap, window)
+	}
+
+	// Triggers spread over several windows are spaced at least a window apart.
+	stop := time.After(5 * window)
+	for loop := true; loop; {
+		select {
+		case <-stop:
+			loop = false
+		default:
+			e.trigger()
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	time.Sleep(3 * window)
+	mu.Lock()
+	defer mu.Unlock()
+	for i := 4; i < len(emits); i++ {
+		if d := emits[i].Sub(emits[i-1]); d < window {
+			t.Fatalf("emits %d and %d only %v apart", i-1, i, d)
+		}
+	}
+	if n := len(emits); n < 5 || n > 9 {
+		t.Fatalf("expected about one emit per window, got %d", n-3)
+	}
+}
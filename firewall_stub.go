@@ -0,0 +1,7 @@
+//go:build !windows
+
+package main
+
+func firewallStatus() string {
+	return "仅支持 Windows\n"
+}
@@ -0,0 +1,50 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// firewallStatus reports the Windows Firewall profile states and the inbound
+// rules that name this exe. LocalShare adds no rules itself; they come from
+// the "allow access" prompt on first launch. netsh output is localized and
+// kept as is.
+func firewallStatus() string {
+	var b strings.Builder
+	b.WriteString(runNetsh("advfirewall", "show", "allprofiles", "state"))
+
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(&b, "\nexe path unavailable: %v\n", err)
+		return b.String()
+	}
+	rules := strings.ReplaceAll(runNetsh("advfirewall", "firewall", "show", "rule", "name=all", "dir=in", "verbose"), "\r\n", "\n")
+	matched := 0
+	for _, block := range strings.Split(rules, "\n\n") {
+		if strings.Contains(strings.ToLower(block), strings.ToLower(exe)) {
+			b.WriteString("\n" + strings.TrimSpace(block) + "\n")
+			matched++
+		}
+	}
+	if matched == 0 {
+		b.WriteString("\n没有入站规则指向本程序\n")
+	}
+	return b.String()
+}
+
+func runNetsh(args ...string) string {
+	cmd := exec.Command("netsh", args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true, CreationFlags: windows.CREATE_NO_WINDOW}
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Sprintf("netsh %s: %v\n", strings.Join(args, " "), err)
+	}
+	return string(out)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+const folderSizeProgressInterval = 200 * time.Millisecond
+
+// folderSizeResult is emitted as "folderSizeProgress"; the last event has Done=true.
+type folderSizeResult struct {
+	JobID    string `json:"jobId"`
+	Path     string `json:"path"`
+	Bytes    int64  `json:"bytes"`
+	Files    int64  `json:"files"`
+	Dirs     int64  `json:"dirs"`
+	Skipped  int64  `json:"skipped"` // unreadable entries, e.g. permission denied
+	Done     bool   `json:"done"`
+	Canceled bool   `json:"canceled"`
+}
+
+type folderSizeJob struct {
+	id     string
+	cancel context.CancelFunc
+}
+
+type folderSizeJobs struct {
+	mu      sync.Mutex
+	seq     int
+	current *folderSizeJob
+}
+
+// ComputeFolderSize starts measuring path in the background and returns a job ID
+// right away. Progress and the final totals arrive via "folderSizeProgress" events.
+// Starting a new computation cancels the previous one.
+func (a *App) ComputeFolderSize(path string) (string, error) {
+	path = strings.Trim(strings.TrimSpace(path), "\"")
+	if path == "" {
+		return "", errors.New("路径为空")
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	st, err := os.Stat(abs)
+	if err != nil {
+		return "", err
+	}
+	if !st.IsDir() {
+		return "", errors.New("路径不是文件夹")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.folderSize.mu.Lock()
+	if a.folderSize.current != nil {
+		a.folderSize.current.cancel()
+	}
+	a.folderSize.seq++
+	job := &folderSizeJob{id: strconv.Itoa(a.folderSize.seq), cancel: cancel}
+	a.folderSize.current = job
+	a.folderSize.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		res := walkFolderSize(ctx, abs, func(p folderSizeResult) {
+			p.JobID = job.id
+			a.emitFolderSizeProgress(p)
+		})
+		res.JobID = job.id
+		a.emitFolderSizeProgress(res)
+
+		a.folderSize.mu.Lock()
+		if a.folderSize.current == job {
+			a.folderSize.current = nil
+		}
+		a.folderSize.mu.Unlock()
+	}()
+	return job.id, nil
+}
+
+// CancelFolderSize cancels the running ComputeFolderSize job, if any.
+func (a *App) CancelFolderSize() {
+	a.folderSize.mu.Lock()
+	defer a.folderSize.mu.Unlock()
+	if a.folderSize.current != nil {
+		a.folderSize.current.cancel()
+		a.folderSize.current = nil
+	}
+}
+
+func (a *App) emitFolderSizeProgress(p folderSizeResult) {
+	if a.ctx == nil {
+		return
+	}
+	runtime.EventsEmit(a.ctx, "folderSizeProgress", p)
+}
+
+// walkFolderSize counts regular files and bytes under root, skipping symlinks and
+// unreadable subtrees. progress is called at most every folderSizeProgressInterval.
+func walkFolderSize(ctx context.Context, root string, progress func(folderSizeResult)) folderSizeResult {
+	res := folderSizeResult{Path: root}
+	lastReport := time.Now()
+	errCanceled := errors.New("canceled")
+
+	walkErr := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return errCanceled
+		}
+		if err != nil {
+			res.Skipped++
+			if d != nil && d.IsDir() && p != root {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+		if d.IsDir() {
+			if p != root {
+				res.Dirs++
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			res.Skipped++
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		res.Files++
+		res.Bytes += info.Size()
+
+		if progress != nil && time.Since(lastReport) >= folderSizeProgressInterval {
+			lastReport = time.Now()
+			progress(res)
+		}
+		return nil
+	})
+	res.Done = true
+	res.Canceled = errors.Is(walkErr, errCanceled)
+	return res
+}
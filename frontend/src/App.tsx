@@ -1,6 +1,9 @@
-import { Divider, Grid } from "@mui/material";
+import { Button, Divider, Grid } from "@mui/material";
+import { useEffect } from "react";
 import { mutate } from "swr";
 import toast from "react-hot-toast";
+import { shareserver } from "wailsjs/go/models";
+import { GetStartupState, StartSharing } from "wailsjs/go/main/App";
 
 import { GithubBadge } from "./sections/GithubBadge";
 import { UpdateSection } from "./sections/UpdateSection";
@@ -10,20 +13,178 @@ import { ShareControlSection } from "./sections/ShareControlSection";
 import { ShareInfoSection } from "./sections/ShareInfoSection";
 import { ShareQrSection } from "./sections/ShareQrSection";
 import {
+  SettingOfAccessLog,
   SettingOfAccessPass,
+  SettingOfAutoReclaimPort,
+  SettingOfAutoRestart,
+  SettingOfAutoResume,
   SettingOfContextMenu,
   SettingOfCustomPort,
+  SettingOfDiagnostics,
+  SettingOfHiddenRules,
+  SettingOfLanguage,
+  SettingOfLaunchLog,
+  SettingOfMarkUploads,
   SettingOfPermissions,
+  SettingOfPortRedirect,
+  SettingOfProtectWebUI,
+  SettingOfRemoteAdmin,
+  SettingOfSettingsLocation,
+  SettingOfTempDir,
 } from "./sections/SettingsSection";
 
 export default function App() {
-  useEventsOn("serverInfoChanged", () => mutate("GetServerInfo"));
+  // A --share launch may finish before we listen for serverInfoChanged;
+  // ask once mounted, and again while that attempt is still running.
+  useEffect(() => {
+    let timer: number | undefined;
+    const load = () => {
+      GetStartupState()
+        .then((state) => {
+          void mutate("GetServerInfo", state.serverInfo ?? null, {
+            revalidate: false,
+          });
+          if (state.sharePending) {
+            timer = window.setTimeout(load, 500);
+          }
+        })
+        .catch(() => {});
+    };
+    load();
+    return () => window.clearTimeout(timer);
+  }, []);
+  // The event carries the fresh ServerInfo (null when sharing stopped).
+  useEventsOn("serverInfoChanged", (info: unknown) => {
+    void mutate(
+      "GetServerInfo",
+      (info ?? null) as shareserver.ServerInfo | null,
+      { revalidate: false },
+    );
+  });
   useEventsOn("toastError", (msg: unknown) => {
     const text = typeof msg === "string" ? msg : String(msg ?? "");
     if (text) {
       toast.error(text);
     }
   });
+  useEventsOn("settingsLocation", (payload: unknown) => {
+    const { reason, writable, error } =
+      (payload as {
+        reason?: string;
+        writable?: boolean;
+        error?: string;
+      } | null) ?? {};
+    if (writable === false) {
+      toast.error(`设置无法保存，重启后将恢复默认：${error ?? ""}`);
+    } else if (reason === "fallback") {
+      toast.error(
+        `配置目录不可写，设置已改存到程序所在文件夹：${error ?? ""}`,
+      );
+    }
+  });
+  useEventsOn("lastShareMissing", (root: unknown) => {
+    toast.error(`上次共享的文件夹已不存在：${String(root ?? "")}`);
+  });
+  useEventsOn("customPortAvailable", (payload: unknown) => {
+    const { port, switched } =
+      (payload as { port?: number; switched?: boolean } | null) ?? {};
+    if (switched) {
+      toast.success(`已切换回自定义端口 ${port}`);
+    } else {
+      toast(`自定义端口 ${port} 已空闲，可在“自定义端口”中重新应用`);
+    }
+  });
+  useEventsOn("shareRootLost", (payload: unknown) => {
+    const { root, reason } =
+      (payload as { root?: string; reason?: string } | null) ?? {};
+    toast.error(
+      reason === "device removed"
+        ? `共享文件夹所在的设备已被移除，共享已停止：${root ?? ""}`
+        : `共享文件夹已无法访问，共享已停止：${root ?? ""}`,
+    );
+  });
+  useEventsOn("shareExpired", (payload: unknown) => {
+    const { root } = (payload as { root?: string } | null) ?? {};
+    toast(`共享已到时自动停止：${root ?? ""}`);
+  });
+  useEventsOn("shareIdleStopped", (payload: unknown) => {
+    const { root } = (payload as { root?: string } | null) ?? {};
+    toast(`共享长时间无人使用，已自动停止：${root ?? ""}`);
+  });
+  useEventsOn("shareFailed", (payload: unknown) => {
+    const { error, restarting } =
+      (payload as { error?: string; restarting?: boolean } | null) ?? {};
+    toast.error(
+      restarting
+        ? `共享服务异常停止，正在尝试重新共享：${error ?? ""}`
+        : `共享服务异常停止：${error ?? ""}`,
+    );
+  });
+  useEventsOn("shareRootOverlap", (payload: unknown) => {
+    const { previous, current, relation } =
+      (payload as {
+        previous?: string;
+        current?: string;
+        relation?: string;
+      } | null) ?? {};
+    if (!previous) return;
+    const text =
+      relation === "inside"
+        ? `已改为共享原共享文件夹中的子文件夹：${current ?? ""}`
+        : `已改为共享包含原共享文件夹的上级文件夹：${current ?? ""}`;
+    toast(
+      (t) => (
+        <span>
+          {text}
+          <Button
+            size="small"
+            onClick={() => {
+              toast.dismiss(t.id);
+              StartSharing(previous).catch((e: unknown) => {
+                toast.error(`恢复原共享失败：${String(e)}`);
+              });
+            }}
+          >
+            恢复共享 {previous}
+          </Button>
+        </span>
+      ),
+      { duration: 10000 },
+    );
+  });
+  useEventsOn("dropRejected", (payload: unknown) => {
+    const { reason } = (payload as { reason?: string } | null) ?? {};
+    const text: Record<string, string> = {
+      empty: "没有识别到可共享的文件夹路径（请拖到提示面板上）",
+      multiple: "一次只能共享一个文件夹，请只拖拽一个文件夹",
+      file: "请拖拽文件夹开始共享，暂不支持共享单个文件",
+      missing: "拖拽的文件夹不存在或无法访问",
+    };
+    toast.error(text[reason ?? ""] ?? "无法共享拖拽的内容");
+  });
+  useEventsOn("shareRestarted", () => {
+    toast.success("已重新共享");
+  });
+  useEventsOn("remoteAdmin", (payload: unknown) => {
+    const { action, ip } =
+      (payload as { action?: string; ip?: string } | null) ?? {};
+    toast(
+      action === "stop"
+        ? `${ip ?? "网页端"} 远程停止了共享`
+        : `${ip ?? "网页端"} 远程修改了访问权限`,
+    );
+  });
+  useEventsOn("pathProbe", (payload: unknown) => {
+    const { ip, attempts } =
+      (payload as { ip?: string; attempts?: number } | null) ?? {};
+    toast.error(
+      `安全提醒：${ip ?? "未知设备"} 已 ${attempts ?? 0} 次尝试访问共享目录之外的路径，详见访问日志`,
+    );
+  });
+  useEventsOn("serverPanic", (payload: unknown) => {
+    const id = (payload as { id?: string } | null)?.id ?? "";
+    toast.error(`共享服务内部错误${id ? `（编号 ${id}）` : ""}，详情见启动日志`);
+  });
 
   return (
     <>
@@ -59,6 +220,48 @@ export default function App() {
           <Grid size={6}>
             <SettingOfPermissions />
           </Grid>
+          <Grid size={6}>
+            <SettingOfHiddenRules />
+          </Grid>
+          <Grid size={6}>
+            <SettingOfProtectWebUI />
+          </Grid>
+          <Grid size={6}>
+            <SettingOfAccessLog />
+          </Grid>
+          <Grid size={6}>
+            <SettingOfAutoResume />
+          </Grid>
+          <Grid size={6}>
+            <SettingOfAutoRestart />
+          </Grid>
+          <Grid size={6}>
+            <SettingOfAutoReclaimPort />
+          </Grid>
+          <Grid size={6}>
+            <SettingOfPortRedirect />
+          </Grid>
+          <Grid size={6}>
+            <SettingOfMarkUploads />
+          </Grid>
+          <Grid size={6}>
+            <SettingOfRemoteAdmin />
+          </Grid>
+          <Grid size={6}>
+            <SettingOfDiagnostics />
+          </Grid>
+          <Grid size={6}>
+            <SettingOfLaunchLog />
+          </Grid>
+          <Grid size={6}>
+            <SettingOfTempDir />
+          </Grid>
+          <Grid size={6}>
+            <SettingOfSettingsLocation />
+          </Grid>
+          <Grid size={6}>
+            <SettingOfLanguage />
+          </Grid>
           <Grid size={12} sx={{ py: 1.5 }}>
             <Divider />
           </Grid>
@@ -0,0 +1,120 @@
+import {
+  Checkbox,
+  Dialog,
+  DialogContent,
+  DialogTitle,
+  FormControlLabel,
+  Table,
+  TableBody,
+  TableCell,
+  TableHead,
+  TableRow,
+  Typography,
+} from "@mui/material";
+import useSWR from "swr";
+
+import NiceModal, { useModal } from "@ebay/nice-modal-react";
+
+import { muiDialogV5ReplaceOnClose } from "common/utils/muiDialogV5ReplaceOnClose";
+import { useRemoteSetting } from "common/storage";
+import { GetAccessLog } from "wailsjs/go/main/App";
+
+const ACCESS_LOG_FILE_KEY = "local-share:access-log-file" as const;
+
+function formatTime(value: unknown) {
+  const d = new Date(String(value ?? ""));
+  if (Number.isNaN(d.getTime())) return "";
+  return d.toLocaleTimeString();
+}
+
+function statusColor(status: number) {
+  if (status >= 500) return "error.main";
+  if (status >= 400) return "warning.main";
+  return "inherit";
+}
+
+export const AccessLogDialog = NiceModal.create(() => {
+  const modal = useModal();
+  const [logToFile, setLogToFile] = useRemoteSetting<boolean>(
+    ACCESS_LOG_FILE_KEY,
+    false,
+  );
+  const { data: entries } = useSWR("GetAccessLog", () => GetAccessLog(200), {
+    refreshInterval: 2000,
+  });
+
+  return (
+    <Dialog
+      {...muiDialogV5ReplaceOnClose(modal)}
+      maxWidth="md"
+      fullWidth
+      slotProps={{
+        paper: {
+          sx: {
+            backgroundColor: "#01132d",
+          },
+        },
+      }}
+    >
+      <DialogTitle>访问日志</DialogTitle>
+      <DialogContent>
+        <FormControlLabel
+          label="同时写入日志文件"
+          control={
+            <Checkbox
+              size="small"
+              checked={!!logToFile}
+              onChange={(e) => setLogToFile(e.target.checked)}
+            />
+          }
+        />
+        {!entries?.length ? (
+          <Typography color="action.disabled" sx={{ py: 2 }}>
+            暂无请求
+          </Typography>
+        ) : (
+          <Table size="small" stickyHeader>
+            <TableHead>
+              <TableRow>
+                <TableCell>时间</TableCell>
+                <TableCell>设备 IP</TableCell>
+                <TableCell>请求</TableCell>
+                <TableCell align="right">状态</TableCell>
+                <TableCell align="right">字节</TableCell>
+                <TableCell align="right">耗时(ms)</TableCell>
+              </TableRow>
+            </TableHead>
+            <TableBody>
+              {entries.map((e, i) => (
+                <TableRow key={`${String(e.time)}-${i}`}>
+                  <TableCell>{formatTime(e.time)}</TableCell>
+                  <TableCell>{e.clientIP}</TableCell>
+                  <TableCell sx={{ wordBreak: "break-all" }}>
+                    {e.method} {e.path}
+                    {e.event === "path_forbidden" && (
+                      <Typography
+                        variant="caption"
+                        color="error"
+                        component="div"
+                      >
+                        越界路径：{e.detail}
+                      </Typography>
+                    )}
+                  </TableCell>
+                  <TableCell
+                    align="right"
+                    sx={{ color: statusColor(e.status) }}
+                  >
+                    {e.status}
+                  </TableCell>
+                  <TableCell align="right">{e.bytes}</TableCell>
+                  <TableCell align="right">{e.durationMs}</TableCell>
+                </TableRow>
+              ))}
+            </TableBody>
+          </Table>
+        )}
+      </DialogContent>
+    </Dialog>
+  );
+});
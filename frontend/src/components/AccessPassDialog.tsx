@@ -10,9 +10,8 @@ import {
 import NiceModal, { useModal } from "@ebay/nice-modal-react";
 
 import { muiDialogV5ReplaceOnClose } from "common/utils/muiDialogV5ReplaceOnClose";
-import { useThrottlingState } from "common/utils/useThrottle";
 
-import { useMemo } from "react";
+import { useMemo, useState } from "react";
 import { autoFocus } from "common/utils/autoFocus";
 
 function parseAccessPassInputText(input: string): {
@@ -31,19 +30,17 @@ function parseAccessPassInputText(input: string): {
 }
 
 export interface AccessPassDialogProps {
-  value: string;
-  onSave?: (value: string) => void;
+  /** 当前是否已设置口令（口令本身不会回传给前端） */
+  enabled: boolean;
+  onSave?: (value: string) => Promise<void>;
 }
 
 export const AccessPassDialog = NiceModal.create(
   (props: AccessPassDialogProps) => {
     const modal = useModal();
 
-    const [text, setText] = useThrottlingState(props.value ?? "", (v) => {
-      if (!parseAccessPassInputText(v).error) {
-        props.onSave?.(v);
-      }
-    });
+    const [text, setText] = useState("");
+    const [saveError, setSaveError] = useState<string | null>(null);
     const parsed = useMemo(() => parseAccessPassInputText(text), [text]);
 
     return (
@@ -67,8 +64,16 @@ export const AccessPassDialog = NiceModal.create(
             onSubmit={(e) => {
               e.preventDefault();
               if (parsed.error) return;
-              modal.resolve(parsed.value);
-              void modal.hide();
+              // 保存后所有已登录的网页端都需要重新输入口令
+              void (async () => {
+                try {
+                  await props.onSave?.(parsed.value);
+                  modal.resolve(parsed.value);
+                  void modal.hide();
+                } catch (err) {
+                  setSaveError(String((err as any)?.message ?? err));
+                }
+              })();
             }}
           >
             <TextField
@@ -77,10 +82,17 @@ export const AccessPassDialog = NiceModal.create(
               fullWidth
               label="访问口令"
               value={text}
-              onChange={(e) => setText(e.target.value)}
-              error={!!parsed.error}
+              onChange={(e) => {
+                setText(e.target.value);
+                setSaveError(null);
+              }}
+              error={!!parsed.error || !!saveError}
               helperText={
-                parsed.error ?? "1-16 位数字/大小写字母，留空 表示不启用"
+                parsed.error ??
+                saveError ??
+                (props.enabled
+                  ? "输入新口令后回车保存；留空回车 表示关闭口令"
+                  : "1-16 位数字/大小写字母，回车保存")
               }
               slotProps={{
                 input: {
@@ -13,7 +13,7 @@ import { muiDialogV5ReplaceOnClose } from "common/utils/muiDialogV5ReplaceOnClos
 import { FormEvent, useMemo } from "react";
 import { TextButton } from "./TextButton";
 import { useLoading } from "@zimi/hooks";
-import { main } from "wailsjs/go/models";
+import { shareserver } from "wailsjs/go/models";
 import { useThrottlingState } from "common/utils/useThrottle";
 import { cat } from "common/error/catch-and-toast";
 import { autoFocus } from "common/utils/autoFocus";
@@ -34,7 +34,7 @@ function parsePortInputText(input: string): {
 
 export interface CustomPortDialogProps {
   value: string;
-  serverInfo?: main.ServerInfo | undefined;
+  serverInfo?: shareserver.ServerInfo | undefined;
   onSave?: ((value: string) => void) | undefined;
   onApply?: ((value: string) => Promise<void>) | undefined;
 }
@@ -0,0 +1,85 @@
+import {
+  Box,
+  Button,
+  Dialog,
+  DialogContent,
+  DialogTitle,
+  Stack,
+  Typography,
+} from "@mui/material";
+import useSWR from "swr";
+
+import NiceModal, { useModal } from "@ebay/nice-modal-react";
+
+import { cat } from "common/error/catch-and-toast";
+import { muiDialogV5ReplaceOnClose } from "common/utils/muiDialogV5ReplaceOnClose";
+import {
+  ClearLaunchLog,
+  OpenLaunchLogFolder,
+  ReadLaunchLog,
+} from "wailsjs/go/main/App";
+
+const LAUNCH_LOG_LINES = 300;
+
+export const LaunchLogDialog = NiceModal.create(() => {
+  const modal = useModal();
+  const { data: text, mutate } = useSWR(
+    "ReadLaunchLog",
+    () => ReadLaunchLog(LAUNCH_LOG_LINES),
+    { refreshInterval: 2000 },
+  );
+
+  return (
+    <Dialog
+      {...muiDialogV5ReplaceOnClose(modal)}
+      maxWidth="md"
+      fullWidth
+      slotProps={{
+        paper: {
+          sx: {
+            backgroundColor: "#01132d",
+          },
+        },
+      }}
+    >
+      <DialogTitle>启动日志</DialogTitle>
+      <DialogContent>
+        <Typography variant="body2" color="text.secondary">
+          记录右键菜单、单实例唤起、自动更新等过程，最近 {LAUNCH_LOG_LINES}{" "}
+          行。超过 1MB 自动轮换，只保留上一份。
+        </Typography>
+        <Box
+          component="pre"
+          sx={{
+            mt: 2,
+            p: 1,
+            height: "55vh",
+            overflow: "auto",
+            fontSize: 12,
+            whiteSpace: "pre-wrap",
+            wordBreak: "break-all",
+            backgroundColor: "rgba(255, 255, 255, 0.05)",
+            borderRadius: 1,
+          }}
+        >
+          {text || "（暂无日志）"}
+        </Box>
+        <Stack direction="row" spacing={1} sx={{ mt: 2 }}>
+          <Button size="small" onClick={cat(() => OpenLaunchLogFolder())}>
+            打开所在位置
+          </Button>
+          <Button
+            size="small"
+            color="warning"
+            onClick={cat(async () => {
+              await ClearLaunchLog();
+              await mutate();
+            })}
+          >
+            清空
+          </Button>
+        </Stack>
+      </DialogContent>
+    </Dialog>
+  );
+});
@@ -0,0 +1,144 @@
+import {
+  Box,
+  Button,
+  Dialog,
+  DialogContent,
+  DialogTitle,
+  Stack,
+  TextField,
+  Typography,
+} from "@mui/material";
+
+import NiceModal, { useModal } from "@ebay/nice-modal-react";
+
+import { muiDialogV5ReplaceOnClose } from "common/utils/muiDialogV5ReplaceOnClose";
+
+import { useMemo, useState } from "react";
+
+function parseIPs(input: string): { value: string[]; error: string | null } {
+  const value = input
+    .split(/[\s,，]+/)
+    .map((it) => it.trim())
+    .filter(Boolean);
+  const bad = value.find((it) => !/^[0-9A-Fa-f:.]+$/.test(it));
+  return { value, error: bad ? `不是有效的 IP 地址：${bad}` : null };
+}
+
+export interface RemoteAdminDialogProps {
+  /** 当前是否已设置管理口令（口令本身不回显） */
+  passEnabled: boolean;
+  ips: string[];
+  onSave?: (value: { pass?: string; ips: string[] }) => Promise<void>;
+}
+
+export const RemoteAdminDialog = NiceModal.create(
+  (props: RemoteAdminDialogProps) => {
+    const modal = useModal();
+
+    const [pass, setPass] = useState("");
+    const [ipText, setIpText] = useState(props.ips.join(", "));
+    const [saveError, setSaveError] = useState<string | null>(null);
+    const ips = useMemo(() => parseIPs(ipText), [ipText]);
+    const passError =
+      pass && (pass.length < 8 || pass.length > 64 || /\s/.test(pass))
+        ? "8-64 位，不能包含空白字符"
+        : null;
+
+    async function save(value: { pass?: string; ips: string[] }) {
+      try {
+        await props.onSave?.(value);
+        void modal.hide();
+      } catch (err) {
+        setSaveError(String((err as any)?.message ?? err));
+      }
+    }
+
+    return (
+      <Dialog
+        {...muiDialogV5ReplaceOnClose(modal)}
+        maxWidth="xs"
+        fullWidth
+        slotProps={{
+          paper: {
+            sx: {
+              backgroundColor: "#01132d",
+            },
+          },
+        }}
+      >
+        <DialogTitle>远程管理</DialogTitle>
+        <DialogContent>
+          <Typography variant="body2" color="text.secondary">
+            允许网页端停止共享、修改权限。管理口令与访问口令相互独立；
+            授权 IP 的设备无需口令。两者都为空时关闭。
+          </Typography>
+          <Box
+            component="form"
+            sx={{ width: "100%", pt: 2 }}
+            onSubmit={(e) => {
+              e.preventDefault();
+              if (passError || ips.error) return;
+              void save({ pass: pass || undefined, ips: ips.value });
+            }}
+          >
+            <Stack spacing={2}>
+              <TextField
+                size="small"
+                fullWidth
+                label="管理口令"
+                type="password"
+                value={pass}
+                onChange={(e) => {
+                  setPass(e.target.value);
+                  setSaveError(null);
+                }}
+                error={!!passError || !!saveError}
+                helperText={
+                  passError ??
+                  saveError ??
+                  (props.passEnabled
+                    ? "已设置；留空表示不修改"
+                    : "8-64 位，留空表示不启用")
+                }
+                slotProps={{
+                  input: {
+                    autoComplete: "new-password",
+                  },
+                }}
+              />
+              <TextField
+                size="small"
+                fullWidth
+                label="授权 IP"
+                value={ipText}
+                onChange={(e) => {
+                  setIpText(e.target.value);
+                  setSaveError(null);
+                }}
+                error={!!ips.error}
+                helperText={ips.error ?? "多个 IP 用逗号分隔"}
+              />
+              <Stack direction="row" spacing={1} justifyContent="flex-end">
+                {props.passEnabled && (
+                  <Button
+                    size="small"
+                    color="error"
+                    onClick={() => {
+                      if (ips.error) return;
+                      void save({ pass: "", ips: ips.value });
+                    }}
+                  >
+                    清除口令
+                  </Button>
+                )}
+                <Button size="small" variant="contained" type="submit">
+                  保存
+                </Button>
+              </Stack>
+            </Stack>
+          </Box>
+        </DialogContent>
+      </Dialog>
+    );
+  },
+);
@@ -0,0 +1,132 @@
+import {
+  Box,
+  Button,
+  Dialog,
+  DialogContent,
+  DialogTitle,
+  Stack,
+  Typography,
+} from "@mui/material";
+
+import NiceModal, { useModal } from "@ebay/nice-modal-react";
+import { useLoading } from "@zimi/hooks";
+
+import { cat } from "common/error/catch-and-toast";
+import { muiDialogV5ReplaceOnClose } from "common/utils/muiDialogV5ReplaceOnClose";
+import { checkForUpdate, openFolder } from "src/utils";
+import { main } from "wailsjs/go/models";
+import { DismissUpdateFailure, RollbackUpdate } from "wailsjs/go/main/App";
+
+function dirOf(path: string) {
+  const i = Math.max(path.lastIndexOf("\\"), path.lastIndexOf("/"));
+  return i > 0 ? path.slice(0, i) : path;
+}
+
+export interface UpdateFailedDialogProps {
+  failure: main.UpdateFailure;
+}
+
+export const UpdateFailedDialog = NiceModal.create(
+  ({ failure }: UpdateFailedDialogProps) => {
+    const modal = useModal();
+    const [isLoading, withLoading] = useLoading();
+
+    return (
+      <Dialog
+        {...muiDialogV5ReplaceOnClose(modal)}
+        maxWidth="sm"
+        fullWidth
+        slotProps={{
+          paper: {
+            sx: {
+              backgroundColor: "#01132d",
+            },
+          },
+        }}
+      >
+        <DialogTitle>上次更新失败</DialogTitle>
+        <DialogContent>
+          <Typography variant="body2" color="text.secondary">
+            尝试从 {failure.fromVersion || "(未知)"} 更新到{" "}
+            {failure.toVersion}，但当前运行的是{" "}
+            {failure.currentVersion || "(未知)"}。
+          </Typography>
+          {failure.logTail && (
+            <Box
+              component="pre"
+              sx={{
+                mt: 2,
+                p: 1,
+                maxHeight: 240,
+                overflow: "auto",
+                fontSize: 12,
+                whiteSpace: "pre-wrap",
+                wordBreak: "break-all",
+                backgroundColor: "rgba(255, 255, 255, 0.05)",
+                borderRadius: 1,
+              }}
+            >
+              {failure.logTail}
+            </Box>
+          )}
+          <Stack direction="row" spacing={1} sx={{ mt: 2 }}>
+            {failure.logPath && (
+              <Button
+                size="small"
+                disabled={isLoading}
+                onClick={() => void openFolder(dirOf(failure.logPath))}
+              >
+                查看日志
+              </Button>
+            )}
+            <Button
+              size="small"
+              disabled={isLoading}
+              onClick={withLoading(
+                cat(async () => {
+                  await DismissUpdateFailure();
+                  void modal.hide();
+                  await checkForUpdate();
+                }),
+              )}
+            >
+              重试
+            </Button>
+            {failure.canRollback && (
+              <Button
+                size="small"
+                color="warning"
+                disabled={isLoading}
+                onClick={withLoading(
+                  cat(async () => {
+                    const ok = window.confirm(
+                      `是否恢复为 ${failure.fromVersion}？\n\n提示：恢复会导致 app 重启。`,
+                    );
+                    if (!ok) return;
+                    await RollbackUpdate();
+                  }),
+                )}
+              >
+                回滚到 {failure.fromVersion}
+              </Button>
+            )}
+            <Box sx={{ flex: 1 }} />
+            <Button
+              size="small"
+              color="inherit"
+              disabled={isLoading}
+              onClick={withLoading(
+                cat(async () => {
+                  await DismissUpdateFailure();
+                  void modal.hide();
+                }),
+              )}
+            >
+              忽略
+            </Button>
+          </Stack>
+        </DialogContent>
+      </Dialog>
+    );
+  },
+);
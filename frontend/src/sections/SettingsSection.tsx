@@ -5,6 +5,8 @@ import {
   Checkbox,
   FormControlLabel,
   FormGroup,
+  Radio,
+  RadioGroup,
   SxProps,
   Theme,
   Typography,
@@ -13,21 +15,44 @@ import {
 import {
   ApplyCustomPorts,
   CheckContextMenuExists,
+  GenerateDiagnostics,
+  GetAccessPassStatus,
+  GetMarkUploads,
   GetServerInfo,
+  GetSettingsLocation,
+  PickFolder,
+  SetAccessPass,
   SetContextMenuEnabled,
+  SetMarkUploads,
 } from "wailsjs/go/main/App";
 
-import { useRemoteSetting } from "common/storage";
+import { remoteSetting, useRemoteSetting } from "common/storage";
 import { cat } from "common/error/catch-and-toast";
 
 import { KV } from "src/components/KV";
 import { TextButton } from "src/components/TextButton";
 import { CustomPortDialog } from "src/components/CustomPortDialog";
 import { AccessPassDialog } from "src/components/AccessPassDialog";
+import { AccessLogDialog } from "src/components/AccessLogDialog";
+import { LaunchLogDialog } from "src/components/LaunchLogDialog";
+import { RemoteAdminDialog } from "src/components/RemoteAdminDialog";
+import { useEventsOn } from "src/hooks/useEventsOn";
 
 const CUSTOM_PORT_KEY = "local-share:custom-port" as const;
-const ACCESS_PASS_KEY = "local-share:access-pass" as const;
 const PERMISSIONS_KEY = "local-share:permissions" as const;
+const READ_ONLY_KEY = "local-share:read-only" as const;
+const PROTECT_WEB_UI_KEY = "local-share:protect-web-ui" as const;
+const AUTO_RESUME_KEY = "local-share:auto-resume" as const;
+const AUTO_RESTART_KEY = "local-share:auto-restart" as const;
+const AUTO_RECLAIM_PORT_KEY = "local-share:auto-reclaim-custom-port" as const;
+const PORT_REDIRECT_KEY = "local-share:port-redirect" as const;
+const ADMIN_PASS_KEY = "local-share:admin-pass" as const;
+const ADMIN_IPS_KEY = "local-share:admin-ips" as const;
+const TEMP_DIR_KEY = "local-share:temp-dir" as const;
+const HIDDEN_RULES_KEY = "local-share:hidden-rules" as const;
+const LANGUAGE_KEY = "local-share:language" as const;
+const TRASH_MAX_MB_KEY = "local-share:trash-max-mb" as const;
+const TRASH_TOO_LARGE_KEY = "local-share:trash-too-large" as const;
 
 function ctxMenuExistsLabel(res: SWRResponse<boolean, unknown>) {
   if (res.error) return "检测失败（点击重试）";
@@ -101,10 +126,14 @@ export function SettingOfCustomPort() {
 }
 
 export function SettingOfAccessPass() {
-  const [accessPassText, setAccessPassText] = useRemoteSetting<string>(
-    ACCESS_PASS_KEY,
-    "",
+  const { data: status, mutate } = useSWR("GetAccessPassStatus", () =>
+    GetAccessPassStatus(),
   );
+  useEventsOn("accessPassChanged", () => mutate());
+
+  const changedAt = status?.changedAt
+    ? new Date(status.changedAt).toLocaleString()
+    : "";
 
   return (
     <KV
@@ -112,15 +141,23 @@ export function SettingOfAccessPass() {
         <TextButton
           onClick={() => {
             void NiceModal.show(AccessPassDialog, {
-              value: accessPassText,
-              onSave: (v) => setAccessPassText(v),
+              enabled: !!status?.enabled,
+              onSave: async (v) => {
+                await SetAccessPass(v);
+                await mutate();
+              },
             });
           }}
         >
           访问口令
         </TextButton>
       }
-      v={<Typography color="action.disabled">{accessPassText}</Typography>}
+      v={
+        <Typography color="action.disabled">
+          {status?.enabled ? "已启用" : "未启用"}
+          {changedAt ? `（${changedAt} 更改）` : ""}
+        </Typography>
+      }
     />
   );
 }
@@ -160,42 +197,171 @@ export function SettingOfPermissions() {
   const update = (patch: Partial<PermissionSetting>) => {
     setPermissions({ ...current, ...patch });
   };
+  // 只读模式优先于下面的读/写/删除设置，关闭后恢复原设置
+  const [readOnly, setReadOnly] = useRemoteSetting<boolean>(
+    READ_ONLY_KEY,
+    false,
+  );
+
+  const [trashMaxMB] = useRemoteSetting<number>(TRASH_MAX_MB_KEY, 20 * 1024);
+  const [trashTooLarge] = useRemoteSetting<string>(
+    TRASH_TOO_LARGE_KEY,
+    "confirm",
+  );
+  const trashLimit =
+    (trashMaxMB ?? 0) >= 1024
+      ? `${+((trashMaxMB ?? 0) / 1024).toFixed(1)} GB`
+      : `${trashMaxMB} MB`;
 
   return (
     <KV
       k="权限管理"
+      v={
+        <>
+          <FormGroup row sx={{ pl: 1 }}>
+            <FormControlLabel
+              label="只读模式"
+              control={
+                <Checkbox
+                  size="small"
+                  checked={!!readOnly}
+                  sx={checkBoxSx}
+                  onChange={(e) => setReadOnly(e.target.checked)}
+                />
+              }
+            />
+          </FormGroup>
+          <FormGroup row sx={{ pl: 1 }}>
+            <FormControlLabel
+              label="读"
+              control={
+                <Checkbox
+                  size="small"
+                  checked={current.read}
+                  sx={checkBoxSx}
+                  onChange={(e) => update({ read: e.target.checked })}
+                />
+              }
+            />
+            <FormControlLabel
+              label="写"
+              control={
+                <Checkbox
+                  size="small"
+                  checked={current.write && !readOnly}
+                  disabled={!!readOnly}
+                  sx={checkBoxSx}
+                  onChange={(e) => update({ write: e.target.checked })}
+                />
+              }
+            />
+            <FormControlLabel
+              label="删除"
+              control={
+                <Checkbox
+                  size="small"
+                  checked={current.delete && !readOnly}
+                  disabled={!!readOnly}
+                  sx={checkBoxSx}
+                  onChange={(e) => update({ delete: e.target.checked })}
+                />
+              }
+            />
+          </FormGroup>
+          {current.delete && !readOnly && (
+            <Typography
+              variant="caption"
+              color="action.disabled"
+              sx={{ pl: 1 }}
+            >
+              {trashTooLarge === "refuse"
+                ? `Windows 下删除会移入回收站，超过 ${trashLimit} 的内容不允许从网页删除`
+                : `Windows 下删除会移入回收站，超过 ${trashLimit} 的内容需网页端确认后永久删除`}
+            </Typography>
+          )}
+        </>
+      }
+    />
+  );
+}
+
+type HiddenRulesSetting = {
+  dotfiles?: boolean | undefined;
+  hiddenAttr?: boolean | undefined;
+  systemAttr?: boolean | undefined;
+  checksums?: boolean | undefined;
+};
+
+const DEFAULT_HIDDEN_RULES: HiddenRulesSetting = {
+  dotfiles: true,
+  hiddenAttr: true,
+  systemAttr: true,
+  checksums: false,
+};
+
+export function SettingOfHiddenRules() {
+  const [rules, setRules] = useRemoteSetting<HiddenRulesSetting>(
+    HIDDEN_RULES_KEY,
+    DEFAULT_HIDDEN_RULES,
+  );
+
+  const current = {
+    dotfiles: rules?.dotfiles ?? DEFAULT_HIDDEN_RULES.dotfiles,
+    hiddenAttr: rules?.hiddenAttr ?? DEFAULT_HIDDEN_RULES.hiddenAttr,
+    systemAttr: rules?.systemAttr ?? DEFAULT_HIDDEN_RULES.systemAttr,
+    checksums: rules?.checksums ?? DEFAULT_HIDDEN_RULES.checksums,
+  };
+
+  const update = (patch: Partial<HiddenRulesSetting>) => {
+    setRules({ ...current, ...patch });
+  };
+
+  return (
+    <KV
+      k="视为隐藏"
       v={
         <FormGroup row sx={{ pl: 1 }}>
           <FormControlLabel
-            label="读"
+            label=". 开头"
             control={
               <Checkbox
                 size="small"
-                checked={current.read}
+                checked={current.dotfiles}
                 sx={checkBoxSx}
-                onChange={(e) => update({ read: e.target.checked })}
+                onChange={(e) => update({ dotfiles: e.target.checked })}
               />
             }
           />
           <FormControlLabel
-            label="写"
+            label="隐藏属性"
             control={
               <Checkbox
                 size="small"
-                checked={current.write}
+                checked={current.hiddenAttr}
                 sx={checkBoxSx}
-                onChange={(e) => update({ write: e.target.checked })}
+                onChange={(e) => update({ hiddenAttr: e.target.checked })}
               />
             }
           />
           <FormControlLabel
-            label="删除"
+            label="系统属性"
             control={
               <Checkbox
                 size="small"
-                checked={current.delete}
+                checked={current.systemAttr}
                 sx={checkBoxSx}
-                onChange={(e) => update({ delete: e.target.checked })}
+                onChange={(e) => update({ systemAttr: e.target.checked })}
+              />
+            }
+          />
+          <FormControlLabel
+            label=".sha256 校验文件"
+            control={
+              <Checkbox
+                size="small"
+                checked={current.checksums}
+                sx={checkBoxSx}
+                onChange={(e) => update({ checksums: e.target.checked })}
               />
             }
           />
@@ -204,3 +370,376 @@ export function SettingOfPermissions() {
     />
   );
 }
+
+export function SettingOfProtectWebUI() {
+  const [protectWebUI, setProtectWebUI] = useRemoteSetting<boolean>(
+    PROTECT_WEB_UI_KEY,
+    false,
+  );
+
+  return (
+    <KV
+      k="网页保护"
+      v={
+        <FormControlLabel
+          sx={{ pl: 1 }}
+          label="设置口令后，网页本身也需口令"
+          control={
+            <Checkbox
+              size="small"
+              checked={!!protectWebUI}
+              sx={checkBoxSx}
+              onChange={(e) => setProtectWebUI(e.target.checked)}
+            />
+          }
+        />
+      }
+    />
+  );
+}
+
+export function SettingOfAccessLog() {
+  return (
+    <KV
+      k={
+        <TextButton
+          onClick={() => {
+            void NiceModal.show(AccessLogDialog);
+          }}
+        >
+          访问日志
+        </TextButton>
+      }
+      v={<Typography color="action.disabled">排查设备访问问题</Typography>}
+    />
+  );
+}
+
+export function SettingOfLaunchLog() {
+  return (
+    <KV
+      k={
+        <TextButton
+          onClick={() => {
+            void NiceModal.show(LaunchLogDialog);
+          }}
+        >
+          启动日志
+        </TextButton>
+      }
+      v={
+        <Typography color="action.disabled">
+          排查右键菜单、自动更新问题
+        </Typography>
+      }
+    />
+  );
+}
+
+export function SettingOfDiagnostics() {
+  return (
+    <KV
+      k={
+        <TextButton
+          onClick={cat(async () => {
+            // 生成后在资源管理器中定位到 zip，方便直接发给开发者
+            await GenerateDiagnostics(true);
+          })}
+        >
+          诊断信息
+        </TextButton>
+      }
+      v={
+        <Typography color="action.disabled">
+          导出问题报告（已隐去口令与路径）
+        </Typography>
+      }
+    />
+  );
+}
+
+export function SettingOfTempDir() {
+  const [tempDir] = useRemoteSetting<string>(TEMP_DIR_KEY, "");
+
+  return (
+    <KV
+      k={
+        <TextButton
+          onClick={cat(async () => {
+            const dir = await PickFolder();
+            if (!dir) return;
+            // 后端会校验目录存在且可写，失败时提示原因
+            await remoteSetting.set(TEMP_DIR_KEY, dir);
+          })}
+        >
+          临时目录
+        </TextButton>
+      }
+      v={
+        <Typography color="action.disabled" noWrap title={tempDir || ""}>
+          {tempDir ? (
+            <>
+              {tempDir}{" "}
+              <TextButton
+                onClick={cat(async () => {
+                  await remoteSetting.set(TEMP_DIR_KEY, null);
+                })}
+              >
+                恢复默认
+              </TextButton>
+            </>
+          ) : (
+            "系统默认（打包下载、更新解压、诊断信息）"
+          )}
+        </Typography>
+      }
+    />
+  );
+}
+
+function settingsLocationLabel(loc: {
+  portable: boolean;
+  reason: string;
+  writable: boolean;
+}) {
+  if (!loc.writable) return "无法保存，重启后恢复默认";
+  if (loc.reason === "fallback") return "配置目录不可写，已改存程序目录";
+  if (loc.portable) return "便携模式（程序目录）";
+  return "用户配置目录";
+}
+
+export function SettingOfSettingsLocation() {
+  const { data: loc } = useSWR("GetSettingsLocation", () =>
+    GetSettingsLocation(),
+  );
+
+  return (
+    <KV
+      k="设置位置"
+      v={
+        <Typography
+          color={loc && !loc.writable ? "error" : "action.disabled"}
+          noWrap
+          title={[loc?.path, loc?.error].filter(Boolean).join("\n")}
+        >
+          {loc ? settingsLocationLabel(loc) : "检测中..."}
+        </Typography>
+      }
+    />
+  );
+}
+
+export function SettingOfAutoResume() {
+  const [autoResume, setAutoResume] = useRemoteSetting<boolean>(
+    AUTO_RESUME_KEY,
+    false,
+  );
+
+  return (
+    <KV
+      k="自动恢复"
+      v={
+        <FormControlLabel
+          sx={{ pl: 1 }}
+          label="启动时继续共享上次的文件夹"
+          control={
+            <Checkbox
+              size="small"
+              checked={!!autoResume}
+              sx={checkBoxSx}
+              onChange={(e) => setAutoResume(e.target.checked)}
+            />
+          }
+        />
+      }
+    />
+  );
+}
+
+export function SettingOfAutoRestart() {
+  const [autoRestart, setAutoRestart] = useRemoteSetting<boolean>(
+    AUTO_RESTART_KEY,
+    false,
+  );
+
+  return (
+    <KV
+      k="自动重启"
+      v={
+        <FormControlLabel
+          sx={{ pl: 1 }}
+          label="共享服务异常停止时自动重新共享"
+          control={
+            <Checkbox
+              size="small"
+              checked={!!autoRestart}
+              sx={checkBoxSx}
+              onChange={(e) => setAutoRestart(e.target.checked)}
+            />
+          }
+        />
+      }
+    />
+  );
+}
+
+export function SettingOfLanguage() {
+  const [language, setLanguage] = useRemoteSetting<string>(LANGUAGE_KEY, "");
+
+  return (
+    <KV
+      k="对话框语言"
+      v={
+        <RadioGroup
+          row
+          sx={{ pl: 1 }}
+          value={language ?? ""}
+          onChange={(e) => setLanguage(e.target.value)}
+        >
+          <FormControlLabel
+            value=""
+            label="跟随系统"
+            control={<Radio size="small" />}
+          />
+          <FormControlLabel
+            value="zh-CN"
+            label="中文"
+            control={<Radio size="small" />}
+          />
+          <FormControlLabel
+            value="en"
+            label="English"
+            control={<Radio size="small" />}
+          />
+        </RadioGroup>
+      }
+    />
+  );
+}
+
+export function SettingOfPortRedirect() {
+  const [portRedirect, setPortRedirect] = useRemoteSetting<boolean>(
+    PORT_REDIRECT_KEY,
+    false,
+  );
+
+  return (
+    <KV
+      k="免端口访问"
+      v={
+        <FormControlLabel
+          sx={{ pl: 1 }}
+          label="80/8080 端口空闲时，只输入 IP 也能打开"
+          control={
+            <Checkbox
+              size="small"
+              checked={!!portRedirect}
+              sx={checkBoxSx}
+              onChange={(e) => setPortRedirect(e.target.checked)}
+            />
+          }
+        />
+      }
+    />
+  );
+}
+
+export function SettingOfMarkUploads() {
+  const { data: markUploads, mutate: mutateMarkUploads } = useSWR(
+    "GetMarkUploads",
+    () => GetMarkUploads(),
+  );
+  const toggleMarkUploads = cat(async (mark: boolean) => {
+    await SetMarkUploads(mark);
+    await mutateMarkUploads();
+  });
+
+  return (
+    <KV
+      k="上传标记"
+      v={
+        <FormControlLabel
+          sx={{ pl: 1 }}
+          label="将收到的文件标记为来自网络（运行前提示）"
+          control={
+            <Checkbox
+              size="small"
+              checked={!!markUploads}
+              sx={checkBoxSx}
+              onChange={(e) => toggleMarkUploads(e.target.checked)}
+            />
+          }
+        />
+      }
+    />
+  );
+}
+
+export function SettingOfRemoteAdmin() {
+  const [adminPass] = useRemoteSetting<string>(ADMIN_PASS_KEY, "");
+  const [adminIPs] = useRemoteSetting<string[]>(ADMIN_IPS_KEY, []);
+  const ips = adminIPs ?? [];
+
+  let status = "未开启";
+  if (adminPass && ips.length > 0) {
+    status = `口令 + ${ips.length} 个 IP`;
+  } else if (adminPass) {
+    status = "口令";
+  } else if (ips.length > 0) {
+    status = `${ips.length} 个 IP`;
+  }
+
+  return (
+    <KV
+      k={
+        <TextButton
+          onClick={() => {
+            void NiceModal.show(RemoteAdminDialog, {
+              passEnabled: !!adminPass,
+              ips,
+              onSave: async (v) => {
+                if (v.pass !== undefined) {
+                  await remoteSetting.set(ADMIN_PASS_KEY, v.pass || null);
+                }
+                await remoteSetting.set(
+                  ADMIN_IPS_KEY,
+                  v.ips.length > 0 ? v.ips : null,
+                );
+              },
+            });
+          }}
+        >
+          远程管理
+        </TextButton>
+      }
+      v={<Typography color="action.disabled">{status}</Typography>}
+    />
+  );
+}
+
+export function SettingOfAutoReclaimPort() {
+  const [autoReclaim, setAutoReclaim] = useRemoteSetting<boolean>(
+    AUTO_RECLAIM_PORT_KEY,
+    false,
+  );
+
+  return (
+    <KV
+      k="端口回收"
+      v={
+        <FormControlLabel
+          sx={{ pl: 1 }}
+          label="自定义端口空闲后自动切回"
+          control={
+            <Checkbox
+              size="small"
+              checked={!!autoReclaim}
+              sx={checkBoxSx}
+              onChange={(e) => setAutoReclaim(e.target.checked)}
+            />
+          }
+        />
+      }
+    />
+  );
+}
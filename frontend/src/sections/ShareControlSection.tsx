@@ -1,8 +1,9 @@
 import { cat } from "common/error/catch-and-toast";
-import { Box, Button, ButtonGroup } from "@mui/material";
+import { Box, Button, ButtonGroup, Typography } from "@mui/material";
 import ChatIcon from "@mui/icons-material/Chat";
 import useSWR from "swr";
 import {
+  GetLastShare,
   GetServerInfo,
   PickFolder,
   StartSharing,
@@ -17,6 +18,10 @@ export function ShareControlSection() {
     () => GetServerInfo(),
   );
   const sharedFolder = serverInfo?.sharedFolder;
+  const { data: lastShare } = useSWR(
+    sharedFolder ? null : "GetLastShare",
+    () => GetLastShare(),
+  );
 
   const tryToShare = cat(async () => {
     const dir = await PickFolder();
@@ -25,8 +30,20 @@ export function ShareControlSection() {
     await mutateServerInfo();
   });
 
+  const resumeLastShare = cat(async () => {
+    if (!lastShare?.root) return;
+    await StartSharing(lastShare.root);
+    await mutateServerInfo();
+  });
+
   return (
-    <Box display="flex" justifyContent="center" alignItems="center">
+    <Box
+      display="flex"
+      flexDirection="column"
+      justifyContent="center"
+      alignItems="center"
+      gap={1}
+    >
       <ButtonGroup>
         <Button color="primary" variant="contained" onClick={tryToShare}>
           {sharedFolder && "选择其他文件夹共享"}
@@ -50,6 +67,19 @@ export function ShareControlSection() {
           <ChatIcon sx={{ fontSize: "14px", color: "inherit" }} />
         </Button>
       </ButtonGroup>
+      {!sharedFolder && lastShare?.root && (
+        <>
+          {lastShare.exists ? (
+            <Button size="small" onClick={resumeLastShare}>
+              继续共享 {lastShare.root}
+            </Button>
+          ) : (
+            <Typography variant="caption" color="action.disabled">
+              上次共享的文件夹已不存在：{lastShare.root}
+            </Typography>
+          )}
+        </>
+      )}
     </Box>
   );
 }
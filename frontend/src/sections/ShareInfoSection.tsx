@@ -1,7 +1,9 @@
-import { Box, Stack } from "@mui/material";
+import { useEffect, useState } from "react";
+import { Box, Chip, MenuItem, Stack, TextField } from "@mui/material";
 import useSWR from "swr";
-import { GetServerInfo } from "wailsjs/go/main/App";
+import { GetServerInfo, SetShareExpiry } from "wailsjs/go/main/App";
 import clsx from "clsx";
+import { cat } from "common/error/catch-and-toast";
 
 import { KV } from "src/components/KV";
 import { TextButton } from "src/components/TextButton";
@@ -18,16 +20,59 @@ function clipText(text: string | undefined, heading: number, tail: number) {
   return text.slice(0, heading) + "..." + text.slice(-tail);
 }
 
+const expiryOptions = [
+  { minutes: 0, label: "不自动停止" },
+  { minutes: 30, label: "30 分钟后停止" },
+  { minutes: 60, label: "1 小时后停止" },
+  { minutes: 120, label: "2 小时后停止" },
+];
+
+function formatCountdown(seconds: number) {
+  const h = Math.floor(seconds / 3600);
+  const m = Math.floor((seconds % 3600) / 60);
+  const s = seconds % 60;
+  const mm = String(m).padStart(2, "0");
+  const ss = String(s).padStart(2, "0");
+  return h > 0 ? `${h}:${mm}:${ss}` : `${mm}:${ss}`;
+}
+
+/** 共享自动停止的倒计时（秒），expiresIn 为拉取 ServerInfo 时的剩余秒数 */
+function useCountdown(expiresIn?: number) {
+  const [left, setLeft] = useState(expiresIn ?? 0);
+  useEffect(() => {
+    setLeft(expiresIn ?? 0);
+    if (!expiresIn) return;
+    const deadline = Date.now() + expiresIn * 1000;
+    const timer = window.setInterval(() => {
+      setLeft(Math.max(0, Math.ceil((deadline - Date.now()) / 1000)));
+    }, 1000);
+    return () => window.clearInterval(timer);
+  }, [expiresIn]);
+  return left;
+}
+
 export interface ShareInfoSectionProps {
   sharedFolder?: string;
   serverUrl?: string;
 }
 
 export function ShareInfoSection() {
-  const { data: serverInfo } = useSWR("GetServerInfo", () => GetServerInfo());
+  const { data: serverInfo, mutate: mutateServerInfo } = useSWR(
+    "GetServerInfo",
+    () => GetServerInfo(),
+  );
+  const [expiryMinutes, setExpiryMinutes] = useState(0);
+  const countdown = useCountdown(serverInfo?.expiresIn);
 
   const sharedFolder = serverInfo?.sharedFolder;
   const serverUrl = serverInfo?.url;
+  const shortUrl = serverInfo?.shortURL;
+
+  const changeExpiry = cat(async (minutes: number) => {
+    setExpiryMinutes(minutes);
+    await SetShareExpiry(minutes);
+    await mutateServerInfo();
+  });
 
   return (
     <div className="py-1 my-2 rounded-md flex flex-col items-center">
@@ -55,6 +100,59 @@ export function ShareInfoSection() {
         }
       />
 
+      {serverInfo?.readOnly && (
+        <Chip
+          size="small"
+          color="warning"
+          label="只读模式：网页端只能浏览和下载"
+          sx={{ my: 0.5 }}
+        />
+      )}
+
+      {serverUrl && (
+        <Stack
+          direction="row"
+          alignItems="center"
+          spacing={1}
+          sx={{ my: 0.5 }}
+        >
+          <TextField
+            select
+            size="small"
+            variant="standard"
+            value={expiryMinutes}
+            onChange={(e) => changeExpiry(Number(e.target.value))}
+            sx={{ fontSize: "0.8em" }}
+          >
+            {expiryOptions.map((opt) => (
+              <MenuItem key={opt.minutes} value={opt.minutes}>
+                {opt.label}
+              </MenuItem>
+            ))}
+          </TextField>
+          {countdown > 0 && (
+            <Chip
+              size="small"
+              color="info"
+              label={`剩余 ${formatCountdown(countdown)}`}
+            />
+          )}
+        </Stack>
+      )}
+
+      {!!serverInfo?.redirectFrom && (
+        <Box sx={{ fontSize: "0.8em", opacity: 0.7 }}>
+          手机上也可直接输入 http://{serverInfo.localIP}
+          {serverInfo.redirectFrom === 80 ? "" : `:${serverInfo.redirectFrom}`}
+        </Box>
+      )}
+
+      {serverInfo?.removable && (
+        <Box sx={{ fontSize: "0.8em", opacity: 0.7 }}>
+          文件夹位于可移动磁盘，拔出后共享会自动停止
+        </Box>
+      )}
+
       <Box height="2px" />
 
       <KV
@@ -80,6 +178,36 @@ export function ShareInfoSection() {
           </Stack>
         }
       />
+
+      <KV
+        k="短链接"
+        hidden={!serverUrl || !shortUrl}
+        sx={{ fontSize: "0.9em" }}
+        v={
+          <Stack direction="row" alignItems="center" spacing={1}>
+            <TextButton
+              disabled={!shortUrl}
+              onClick={() => openUrlInBrowser(shortUrl)}
+            >
+              {shortUrl}
+            </TextButton>
+            <CopyButton
+              disabled={!shortUrl}
+              size="small"
+              title="复制短链接"
+              aria-label="复制短链接"
+              text={shortUrl}
+              sx={{ fontSize: "14px" }}
+            />
+          </Stack>
+        }
+      />
+
+      {serverUrl && serverInfo?.shortCode && (
+        <Box sx={{ fontSize: "0.8em", opacity: 0.7 }}>
+          短码 {serverInfo.shortCode}，口头告诉对方也能打开
+        </Box>
+      )}
     </div>
   );
 }
@@ -1,14 +1,16 @@
-import { useMemo } from "react";
+import { useEffect, useMemo } from "react";
 import useSWR from "swr";
 import { Typography } from "@mui/material";
+import NiceModal from "@ebay/nice-modal-react";
 import { useLoading } from "@zimi/hooks";
 
 import { cat } from "common/error/catch-and-toast";
 import { useRemoteSetting } from "common/storage";
 import { KV } from "src/components/KV";
 import { TextButton } from "src/components/TextButton";
+import { UpdateFailedDialog } from "src/components/UpdateFailedDialog";
 import { checkForUpdate } from "src/utils";
-import { GetVersion } from "wailsjs/go/main/App";
+import { GetUpdateFailure, GetVersion } from "wailsjs/go/main/App";
 
 const UPDATE_CHECK_CLICK_KEY = "local-share:update-check-click" as const;
 const UPDATE_CHECK_TIP_THRESHOLD = 10;
@@ -17,6 +19,17 @@ const UPDATE_CHECK_CLICK_WINDOW_MS = 60 * 60 * 1000; // 1 hour
 export function UpdateSection() {
   const { data: appVersion } = useSWR("GetVersion", () => GetVersion());
 
+  // 上次更新没有生效（更新脚本失败、被拦截等）时提示一次。
+  useEffect(() => {
+    void GetUpdateFailure()
+      .then((failure) => {
+        if (failure) {
+          void NiceModal.show(UpdateFailedDialog, { failure });
+        }
+      })
+      .catch(() => {});
+  }, []);
+
   const [updateCheckClicks, setUpdateCheckClicks] = useRemoteSetting<number[]>(
     UPDATE_CHECK_CLICK_KEY,
     [],
@@ -1,33 +1,98 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 import {main} from '../models';
+import {shareserver} from '../models';
 
-export function ApplyCustomPorts(arg1:string):Promise<main.ServerInfo>;
+export function ApplyCustomPorts(arg1:string):Promise<shareserver.ServerInfo>;
 
 export function ApplyDownloadedUpdate():Promise<void>;
 
+export function CancelChecksums():Promise<void>;
+
+export function CancelFolderSize():Promise<void>;
+
 export function CheckContextMenuExists():Promise<main.ContextMenuStatus>;
 
 export function CheckForUpdate():Promise<main.UpdateInfo>;
 
+export function ClearAccessPass():Promise<void>;
+
+export function ClearLaunchLog():Promise<void>;
+
+export function ComputeFolderSize(arg1:string):Promise<string>;
+
 export function DownloadLatestUpdate():Promise<main.DownloadResult>;
 
+export function DismissUpdateFailure():Promise<void>;
+
+export function GenerateChecksums(arg1:string,arg2:boolean):Promise<string>;
+
+export function GenerateDiagnostics(arg1:boolean):Promise<string>;
+
+export function GetAccessLog(arg1:number):Promise<Array<shareserver.AccessLogEntry>>;
+
+export function GetAccessPassStatus():Promise<shareserver.AccessPassStatus>;
+
 export function GetDownloadsDir():Promise<string>;
 
-export function GetServerInfo():Promise<main.ServerInfo>;
+export function GetFolderShareURL(arg1:string):Promise<main.FolderShareURL>;
+
+export function GetLastShare():Promise<main.LastShareInfo>;
+
+export function GetMarkUploads():Promise<boolean>;
+
+export function GetServerInfo():Promise<shareserver.ServerInfo>;
+
+export function GetServerMeta():Promise<shareserver.Meta>;
 
 export function GetSetting(arg1:string):Promise<string>;
 
+export function GetSettingHistory(arg1:string):Promise<Array<shareserver.SettingHistoryEntry>>;
+
+export function GetSettingsLocation():Promise<main.SettingsLocation>;
+
+export function GetStartupState():Promise<main.StartupState>;
+
+export function GetUpdateFailure():Promise<main.UpdateFailure>;
+
 export function GetVersion():Promise<string>;
 
+export function GetWebServeMode():Promise<string>;
+
+export function ListSharedDirectory(arg1:string):Promise<Array<shareserver.DirectoryItem>>;
+
 export function OpenFolder(arg1:string):Promise<void>;
 
+export function OpenLaunchLogFolder():Promise<void>;
+
 export function PickFolder():Promise<string>;
 
+export function ReadLaunchLog(arg1:number):Promise<string>;
+
+export function ResetUploadQuota(arg1:string):Promise<void>;
+
+export function RevealInShare(arg1:string):Promise<void>;
+
+export function RevertSetting(arg1:string,arg2:number):Promise<void>;
+
+export function RollbackUpdate():Promise<void>;
+
+export function SetAccessPass(arg1:string):Promise<void>;
+
 export function SetContextMenuEnabled(arg1:boolean):Promise<void>;
 
+export function SetMarkUploads(arg1:boolean):Promise<void>;
+
+export function SetReadOnly(arg1:boolean):Promise<void>;
+
 export function SetSetting(arg1:string,arg2:string):Promise<void>;
 
-export function StartSharing(arg1:string):Promise<main.ServerInfo>;
+export function SetShareExpiry(arg1:number):Promise<shareserver.ServerInfo>;
+
+export function SetWebDistDir(arg1:string):Promise<void>;
+
+export function ShareDroppedPaths(arg1:Array<string>):Promise<shareserver.ServerInfo>;
+
+export function StartSharing(arg1:string):Promise<shareserver.StartResult>;
 
 export function StopSharing():Promise<void>;
@@ -10,6 +10,14 @@ export function ApplyDownloadedUpdate() {
   return window['go']['main']['App']['ApplyDownloadedUpdate']();
 }
 
+export function CancelChecksums() {
+  return window['go']['main']['App']['CancelChecksums']();
+}
+
+export function CancelFolderSize() {
+  return window['go']['main']['App']['CancelFolderSize']();
+}
+
 export function CheckContextMenuExists() {
   return window['go']['main']['App']['CheckContextMenuExists']();
 }
@@ -18,42 +26,162 @@ export function CheckForUpdate() {
   return window['go']['main']['App']['CheckForUpdate']();
 }
 
+export function ClearAccessPass() {
+  return window['go']['main']['App']['ClearAccessPass']();
+}
+
+export function ClearLaunchLog() {
+  return window['go']['main']['App']['ClearLaunchLog']();
+}
+
+export function ComputeFolderSize(arg1) {
+  return window['go']['main']['App']['ComputeFolderSize'](arg1);
+}
+
 export function DownloadLatestUpdate() {
   return window['go']['main']['App']['DownloadLatestUpdate']();
 }
 
+export function DismissUpdateFailure() {
+  return window['go']['main']['App']['DismissUpdateFailure']();
+}
+
+export function GenerateChecksums(arg1, arg2) {
+  return window['go']['main']['App']['GenerateChecksums'](arg1, arg2);
+}
+
+export function GenerateDiagnostics(arg1) {
+  return window['go']['main']['App']['GenerateDiagnostics'](arg1);
+}
+
+export function GetAccessLog(arg1) {
+  return window['go']['main']['App']['GetAccessLog'](arg1);
+}
+
+export function GetAccessPassStatus() {
+  return window['go']['main']['App']['GetAccessPassStatus']();
+}
+
 export function GetDownloadsDir() {
   return window['go']['main']['App']['GetDownloadsDir']();
 }
 
+export function GetFolderShareURL(arg1) {
+  return window['go']['main']['App']['GetFolderShareURL'](arg1);
+}
+
+export function GetLastShare() {
+  return window['go']['main']['App']['GetLastShare']();
+}
+
+export function GetMarkUploads() {
+  return window['go']['main']['App']['GetMarkUploads']();
+}
+
 export function GetServerInfo() {
   return window['go']['main']['App']['GetServerInfo']();
 }
 
+export function GetServerMeta() {
+  return window['go']['main']['App']['GetServerMeta']();
+}
+
 export function GetSetting(arg1) {
   return window['go']['main']['App']['GetSetting'](arg1);
 }
 
+export function GetSettingHistory(arg1) {
+  return window['go']['main']['App']['GetSettingHistory'](arg1);
+}
+
+export function GetSettingsLocation() {
+  return window['go']['main']['App']['GetSettingsLocation']();
+}
+
+export function GetStartupState() {
+  return window['go']['main']['App']['GetStartupState']();
+}
+
+export function GetUpdateFailure() {
+  return window['go']['main']['App']['GetUpdateFailure']();
+}
+
 export function GetVersion() {
   return window['go']['main']['App']['GetVersion']();
 }
 
+export function GetWebServeMode() {
+  return window['go']['main']['App']['GetWebServeMode']();
+}
+
+export function ListSharedDirectory(arg1) {
+  return window['go']['main']['App']['ListSharedDirectory'](arg1);
+}
+
 export function OpenFolder(arg1) {
   return window['go']['main']['App']['OpenFolder'](arg1);
 }
 
+export function OpenLaunchLogFolder() {
+  return window['go']['main']['App']['OpenLaunchLogFolder']();
+}
+
 export function PickFolder() {
   return window['go']['main']['App']['PickFolder']();
 }
 
+export function ReadLaunchLog(arg1) {
+  return window['go']['main']['App']['ReadLaunchLog'](arg1);
+}
+
+export function ResetUploadQuota(arg1) {
+  return window['go']['main']['App']['ResetUploadQuota'](arg1);
+}
+
+export function RevealInShare(arg1) {
+  return window['go']['main']['App']['RevealInShare'](arg1);
+}
+
+export function RevertSetting(arg1, arg2) {
+  return window['go']['main']['App']['RevertSetting'](arg1, arg2);
+}
+
+export function RollbackUpdate() {
+  return window['go']['main']['App']['RollbackUpdate']();
+}
+
+export function SetAccessPass(arg1) {
+  return window['go']['main']['App']['SetAccessPass'](arg1);
+}
+
 export function SetContextMenuEnabled(arg1) {
   return window['go']['main']['App']['SetContextMenuEnabled'](arg1);
 }
 
+export function SetMarkUploads(arg1) {
+  return window['go']['main']['App']['SetMarkUploads'](arg1);
+}
+
+export function SetReadOnly(arg1) {
+  return window['go']['main']['App']['SetReadOnly'](arg1);
+}
+
 export function SetSetting(arg1, arg2) {
   return window['go']['main']['App']['SetSetting'](arg1, arg2);
 }
 
+export function SetShareExpiry(arg1) {
+  return window['go']['main']['App']['SetShareExpiry'](arg1);
+}
+
+export function SetWebDistDir(arg1) {
+  return window['go']['main']['App']['SetWebDistDir'](arg1);
+}
+
+export function ShareDroppedPaths(arg1) {
+  return window['go']['main']['App']['ShareDroppedPaths'](arg1);
+}
+
 export function StartSharing(arg1) {
   return window['go']['main']['App']['StartSharing'](arg1);
 }
@@ -34,22 +34,150 @@ export namespace main {
 	        this.backupExePath = source["backupExePath"];
 	    }
 	}
-	export class ServerInfo {
+	export class FolderShareURL {
 	    url: string;
-	    port: number;
-	    localIP: string;
-	    sharedFolder: string;
+	    qrDataURI: string;
 	
 	    static createFrom(source: any = {}) {
-	        return new ServerInfo(source);
+	        return new FolderShareURL(source);
 	    }
 	
 	    constructor(source: any = {}) {
 	        if ('string' === typeof source) source = JSON.parse(source);
 	        this.url = source["url"];
-	        this.port = source["port"];
-	        this.localIP = source["localIP"];
-	        this.sharedFolder = source["sharedFolder"];
+	        this.qrDataURI = source["qrDataURI"];
+	    }
+	}
+	export class InitialShareResult {
+	    info?: shareserver.ServerInfo;
+	    error?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new InitialShareResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.info = this.convertValues(source["info"], shareserver.ServerInfo);
+	        this.error = source["error"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class LastShareInfo {
+	    root: string;
+	    active: boolean;
+	    exists: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new LastShareInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.root = source["root"];
+	        this.active = source["active"];
+	        this.exists = source["exists"];
+	    }
+	}
+	export class SettingsLocation {
+	    path: string;
+	    portable: boolean;
+	    reason: string;
+	    writable: boolean;
+	    error?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new SettingsLocation(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.path = source["path"];
+	        this.portable = source["portable"];
+	        this.reason = source["reason"];
+	        this.writable = source["writable"];
+	        this.error = source["error"];
+	    }
+	}
+	export class StartupState {
+	    launchIntent: string;
+	    sharePath?: string;
+	    sharePending: boolean;
+	    shareResult?: InitialShareResult;
+	    serverInfo?: shareserver.ServerInfo;
+	
+	    static createFrom(source: any = {}) {
+	        return new StartupState(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.launchIntent = source["launchIntent"];
+	        this.sharePath = source["sharePath"];
+	        this.sharePending = source["sharePending"];
+	        this.shareResult = this.convertValues(source["shareResult"], InitialShareResult);
+	        this.serverInfo = this.convertValues(source["serverInfo"], shareserver.ServerInfo);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class UpdateFailure {
+	    fromVersion: string;
+	    toVersion: string;
+	    currentVersion: string;
+	    method: string;
+	    logPath: string;
+	    logTail: string;
+	    backupExePath: string;
+	    canRollback: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new UpdateFailure(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.fromVersion = source["fromVersion"];
+	        this.toVersion = source["toVersion"];
+	        this.currentVersion = source["currentVersion"];
+	        this.method = source["method"];
+	        this.logPath = source["logPath"];
+	        this.logTail = source["logTail"];
+	        this.backupExePath = source["backupExePath"];
+	        this.canRollback = source["canRollback"];
 	    }
 	}
 	export class UpdateInfo {
@@ -81,3 +209,260 @@ export namespace main {
 
 }
 
+export namespace shareserver {
+	
+	export class AccessLogEntry {
+	    // Go type: time
+	    time: any;
+	    method: string;
+	    path: string;
+	    status: number;
+	    bytes: number;
+	    durationMs: number;
+	    clientIP: string;
+	    event?: string;
+	    detail?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new AccessLogEntry(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.time = this.convertValues(source["time"], null);
+	        this.method = source["method"];
+	        this.path = source["path"];
+	        this.status = source["status"];
+	        this.bytes = source["bytes"];
+	        this.durationMs = source["durationMs"];
+	        this.clientIP = source["clientIP"];
+	        this.event = source["event"];
+	        this.detail = source["detail"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class AccessPassStatus {
+	    enabled: boolean;
+	    changedAt?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new AccessPassStatus(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.enabled = source["enabled"];
+	        this.changedAt = source["changedAt"];
+	    }
+	}
+	export class DirectoryItem {
+	    name: string;
+	    type: string;
+	    hidden: boolean;
+	    size: number;
+	    modified: string;
+	    created?: string;
+	    owner?: string;
+	    extension?: string;
+	    preview?: PreviewInfo;
+	    previewable: boolean;
+	    category?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new DirectoryItem(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.type = source["type"];
+	        this.hidden = source["hidden"];
+	        this.size = source["size"];
+	        this.modified = source["modified"];
+	        this.created = source["created"];
+	        this.owner = source["owner"];
+	        this.extension = source["extension"];
+	        this.preview = this.convertValues(source["preview"], PreviewInfo);
+	        this.previewable = source["previewable"];
+	        this.category = source["category"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class Meta {
+	    version: string;
+	    endpoints: string[];
+	    features: string[];
+	    auth: string;
+	    webServeMode: string;
+	    fileCategories: string[];
+	
+	    static createFrom(source: any = {}) {
+	        return new Meta(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.version = source["version"];
+	        this.endpoints = source["endpoints"];
+	        this.features = source["features"];
+	        this.auth = source["auth"];
+	        this.webServeMode = source["webServeMode"];
+	        this.fileCategories = source["fileCategories"];
+	    }
+	}
+	export class PreviewInfo {
+	    supported: boolean;
+	    kind: string;
+	    contentType?: string;
+	    reason?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new PreviewInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.supported = source["supported"];
+	        this.kind = source["kind"];
+	        this.contentType = source["contentType"];
+	        this.reason = source["reason"];
+	    }
+	}
+	export class RootOverlap {
+	    previous: string;
+	    relation: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new RootOverlap(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.previous = source["previous"];
+	        this.relation = source["relation"];
+	    }
+	}
+	export class ServerInfo {
+	    url: string;
+	    port: number;
+	    localIP: string;
+	    sharedFolder: string;
+	    shortCode: string;
+	    shortURL: string;
+	    removable: boolean;
+	    redirectFrom?: number;
+	    readOnly: boolean;
+	    expiresIn?: number;
+	    lastActivity?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new ServerInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.url = source["url"];
+	        this.port = source["port"];
+	        this.localIP = source["localIP"];
+	        this.sharedFolder = source["sharedFolder"];
+	        this.shortCode = source["shortCode"];
+	        this.shortURL = source["shortURL"];
+	        this.removable = source["removable"];
+	        this.redirectFrom = source["redirectFrom"];
+	        this.readOnly = source["readOnly"];
+	        this.expiresIn = source["expiresIn"];
+	        this.lastActivity = source["lastActivity"];
+	    }
+	}
+	export class SettingHistoryEntry {
+	    at?: string;
+	    origin: string;
+	    clientIP?: string;
+	    deleted?: boolean;
+	    value?: any;
+	    valueHash?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new SettingHistoryEntry(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.at = source["at"];
+	        this.origin = source["origin"];
+	        this.clientIP = source["clientIP"];
+	        this.deleted = source["deleted"];
+	        this.value = source["value"];
+	        this.valueHash = source["valueHash"];
+	    }
+	}
+	export class StartResult {
+	    info?: ServerInfo;
+	    warnings?: string[];
+	    overlap?: RootOverlap;
+	
+	    static createFrom(source: any = {}) {
+	        return new StartResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.info = this.convertValues(source["info"], ServerInfo);
+	        this.warnings = source["warnings"];
+	        this.overlap = this.convertValues(source["overlap"], RootOverlap);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"LocalShare/pkg/shareserver"
+)
+
+// headlessMain runs the share server without the Wails GUI and returns the exit code.
+func headlessMain(args []string) int {
+	opts, err := parseHeadlessArgs(args, os.Stderr)
+	if err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+		}
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	s := newHeadlessServer(newSettingsStore(), opts, os.Stdout)
+	if err := runHeadless(ctx, s, opts, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	return 0
+}
+
+// headlessOptions are the CLI flags of `local-share --headless ...`.
+type headlessOptions struct {
+	Dir      string
+	Port     int
+	Pass     string
+	ReadOnly bool
+}
+
+// hasHeadlessFlag reports whether args ask for headless mode.
+func hasHeadlessFlag(args []string) bool {
+	for _, arg := range args {
+		if arg == "--headless" || arg == "-headless" || strings.HasPrefix(arg, "--headless=") || strings.HasPrefix(arg, "-headless=") {
+			return true
+		}
+	}
+	return false
+}
+
+func parseHeadlessArgs(args []string, output io.Writer) (headlessOptions, error) {
+	var opts headlessOptions
+	fs := flag.NewFlagSet("local-share", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.Bool("headless", true, "不启动图形界面，仅运行共享服务")
+	fs.StringVar(&opts.Dir, "dir", "", "要共享的文件夹（必填）")
+	fs.IntVar(&opts.Port, "port", 0, "监听端口，0 表示使用已保存的设置或随机端口")
+	fs.StringVar(&opts.Pass, "pass", "", "访问口令（1-16 位字母或数字）")
+	fs.BoolVar(&opts.ReadOnly, "read-only", false, "只读：禁止上传与删除")
+	fs.Bool("portable", false, "把设置保存在程序所在文件夹（便携模式）")
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+	if fs.NArg() > 0 {
+		return opts, fmt.Errorf("未知参数: %s", strings.Join(fs.Args(), " "))
+	}
+
+	opts.Dir = strings.Trim(strings.TrimSpace(opts.Dir), "\"")
+	if opts.Dir == "" {
+		return opts, errors.New("缺少 --dir 参数")
+	}
+	if opts.Port < 0 || opts.Port > 65535 {
+		return opts, errors.New("无效端口")
+	}
+	opts.Pass = strings.TrimSpace(opts.Pass)
+	if !shareserver.IsValidAccessPass(opts.Pass) {
+		return opts, errors.New("无效访问口令")
+	}
+	return opts, nil
+}
+
+// applyHeadlessOverrides makes the flags win over settings.json for this run only.
+func applyHeadlessOverrides(store *shareserver.SettingsStore, opts headlessOptions) {
+	if opts.Port > 0 {
+		b, _ := json.Marshal(strconv.Itoa(opts.Port))
+		store.Override(shareserver.SettingKeyCustomPort, b)
+	}
+	if opts.Pass != "" {
+		b, _ := json.Marshal(opts.Pass)
+		store.Override(shareserver.SettingKeyAccessPass, b)
+	}
+	if opts.ReadOnly {
+		store.Override(shareserver.SettingKeyReadOnly, json.RawMessage("true"))
+	}
+}
+
+func newHeadlessServer(store *shareserver.SettingsStore, opts headlessOptions, out io.Writer) *shareserver.Server {
+	applyHeadlessOverrides(store, opts)
+	return newShareServer(shareserver.Options{Settings: store})
+}
+
+// runHeadless shares opts.Dir until ctx is canceled, then stops the server.
+func runHeadless(ctx context.Context, s *shareserver.Server, opts headlessOptions, out io.Writer) error {
+	res, err := s.Start(ctx, opts.Dir)
+	if err != nil {
+		return err
+	}
+	info := res.Info
+	if opts.Port > 0 && info.Port != opts.Port {
+		// An explicit --port that can't be bound is an error, not a fallback.
+		_ = s.Stop(context.Background())
+		return fmt.Errorf("端口 %d 不可用", opts.Port)
+	}
+	for _, w := range res.Warnings {
+		fmt.Fprintln(out, shareserver.WarningMessage(w))
+	}
+
+	fmt.Fprintf(out, "共享目录: %s\n", info.SharedFolder)
+	fmt.Fprintf(out, "访问地址: %s\n", info.URL)
+	if info.ShortURL != "" {
+		fmt.Fprintf(out, "短链接:   %s\n", info.ShortURL)
+	}
+	if modules, qrErr := encodeQR(info.URL); qrErr == nil {
+		_ = writeQRASCII(out, modules)
+	}
+	fmt.Fprintln(out, "按 Ctrl+C 停止共享")
+
+	<-ctx.Done()
+	fmt.Fprintln(out, "正在停止共享...")
+	if err := stopShareServer(s, shutdownTimeout); err != nil {
+		return err
+	}
+	fmt.Fprintln(out, "共享已停止")
+	return nil
+}
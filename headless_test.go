@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"LocalShare/pkg/shareserver"
+)
+
+func TestParseHeadlessArgs(t *testing.T) {
+	if !hasHeadlessFlag([]string{"--dir", "x", "--headless"}) {
+		t.Fatalf("expected --headless to be detected")
+	}
+	if hasHeadlessFlag([]string{"--share=C:\\foo"}) {
+		t.Fatalf("--share must not trigger headless mode")
+	}
+
+	opts, err := parseHeadlessArgs([]string{"--headless", "--dir", "/srv/share", "--port", "8080", "--pass", "abc123", "--read-only"}, io.Discard)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	want := headlessOptions{Dir: "/srv/share", Port: 8080, Pass: "abc123", ReadOnly: true}
+	if opts != want {
+		t.Fatalf("unexpected opts: %+v", opts)
+	}
+
+	bad := [][]string{
+		{"--headless"},
+		{"--headless", "--dir", "x", "--port", "70000"},
+		{"--headless", "--dir", "x", "--pass", "not valid!"},
+		{"--headless", "--dir", "x", "extra"},
+		{"--headless", "--dir", "x", "--unknown"},
+	}
+	for _, args := range bad {
+		if _, err := parseHeadlessArgs(args, io.Discard); err == nil {
+			t.Fatalf("expected error for %q", args)
+		}
+	}
+}
+
+func TestApplyHeadlessOverridesDoesNotPersist(t *testing.T) {
+	settingsPath := filepath.Join(t.TempDir(), "settings.json")
+	s := newHeadlessServer(shareserver.NewSettingsStoreAt(settingsPath), headlessOptions{Port: 8080, Pass: "abc123", ReadOnly: true}, io.Discard)
+
+	if raw, ok, err := s.Setting(shareserver.SettingKeyAccessPass); err != nil || !ok || string(raw) != `"abc123"` {
+		t.Fatalf("expected pass override, got %s ok=%v err=%v", raw, ok, err)
+	}
+	if perms := s.Permissions(); perms.Write || perms.Delete || !perms.Read {
+		t.Fatalf("expected read-only permissions, got %+v", perms)
+	}
+	if _, err := os.Stat(settingsPath); !os.IsNotExist(err) {
+		t.Fatalf("overrides must not write settings.json, stat err=%v", err)
+	}
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestRunHeadlessGracefulShutdown(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("hello"), 0o644); err != nil {
+		t.Fatalf("write file failed: %v", err)
+	}
+
+	var out syncBuffer
+	opts := headlessOptions{Dir: root, ReadOnly: true}
+	s := newHeadlessServer(shareserver.NewSettingsStoreAt(filepath.Join(t.TempDir(), "settings.json")), opts, &out)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- runHeadless(ctx, s, opts, &out)
+	}()
+
+	var info *shareserver.ServerInfo
+	deadline := time.Now().Add(5 * time.Second)
+	for info == nil && time.Now().Before(deadline) {
+		info, _ = s.GetServerInfo()
+		if info == nil || !strings.Contains(out.String(), "Ctrl+C") {
+			info = nil
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if info == nil {
+		cancel()
+		t.Fatalf("server did not start, output: %s", out.String())
+	}
+	if !strings.Contains(out.String(), info.URL) {
+		t.Fatalf("expected URL in output, got: %s", out.String())
+	}
+
+	base := fmt.Sprintf("http://127.0.0.1:%d", info.Port)
+	resp, err := http.Get(base + "/api/files")
+	if err != nil {
+		t.Fatalf("GET /api/files failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if perms := s.Permissions(); perms.Write {
+		t.Fatalf("expected read-only share, got %+v", perms)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("runHeadless returned error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("runHeadless did not return after cancel")
+	}
+	if info, _ := s.GetServerInfo(); info != nil {
+		t.Fatalf("expected server stopped, got %+v", info)
+	}
+	if _, err := http.Get(base + "/api/files"); err == nil {
+		t.Fatalf("expected connection error after shutdown")
+	}
+}
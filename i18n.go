@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"LocalShare/pkg/shareserver"
+)
+
+// Languages of the desktop dialogs (SettingKeyLanguage). An empty setting
+// follows the OS.
+const (
+	langZH = "zh-CN"
+	langEN = "en"
+)
+
+// Message IDs of the desktop runtime: dialogs, notifications, toasts sent
+// from Go and the updater. The web UI has its own texts.
+const (
+	msgShareFailedTitle          = "share.failedTitle"
+	msgShareTimeout              = "share.timeout"
+	msgResumeFailed              = "share.resumeFailed"
+	msgPickFolderTitle           = "share.pickFolderTitle"
+	msgWarnCustomPortUnavailable = "warning.customPortUnavailable"
+	msgWarnWatchUnavailable      = "warning.watchUnavailable"
+	msgWarnRootOverlap           = "warning.rootOverlap"
+	msgClientConnectedTitle      = "notify.clientConnectedTitle"
+	msgClientConnectedBody       = "notify.clientConnectedBody"
+	msgCrashTitle                = "crash.title"
+	msgCrashBody                 = "crash.body"
+	msgButtonOpen                = "button.open"
+	msgButtonClose               = "button.close"
+	msgUpdateFailedTitle         = "update.failedTitle"
+	msgUpdateDirNotWritable      = "update.dirNotWritable"
+	msgUpdateDirCreateFailed     = "update.dirCreateFailed"
+	msgUpdateScriptFailed        = "update.scriptFailed"
+	msgUpdaterStartFailed        = "update.updaterStartFailed"
+	msgUpdaterErrorTitle         = "updater.errorTitle"
+	msgUpdaterFailed             = "updater.failed"
+	msgUpdaterOldExe             = "updater.oldExe"
+	msgUpdaterNewExe             = "updater.newExe"
+	msgUpdaterBackup             = "updater.backup"
+	msgUpdaterProcIDEmpty        = "updater.procIdEmpty"
+	msgUpdaterNewExeMissing      = "updater.newExeMissing"
+	msgUpdaterOldExeMissing      = "updater.oldExeMissing"
+)
+
+// messages maps an ID to its text per language; fmt verbs are filled by tr.
+var messages = map[string]map[string]string{
+	msgShareFailedTitle: {langZH: "共享失败", langEN: "Sharing failed"},
+	msgShareTimeout: {
+		langZH: "共享超时，请检查文件夹是否可以访问",
+		langEN: "Sharing timed out. Check that the folder is accessible.",
+	},
+	msgResumeFailed:    {langZH: "恢复共享失败：%v", langEN: "Could not resume sharing: %v"},
+	msgPickFolderTitle: {langZH: "选择要共享的文件夹", langEN: "Choose a folder to share"},
+	msgWarnCustomPortUnavailable: {
+		langZH: "自定义端口不可用，已切换至随机端口",
+		langEN: "The custom port is in use; a random port was used instead",
+	},
+	msgWarnWatchUnavailable: {
+		langZH: "文件夹监听启动超时，网页不会自动刷新",
+		langEN: "Watching the folder timed out; the web page won't refresh by itself",
+	},
+	msgWarnRootOverlap: {
+		langZH: "新共享的文件夹与之前共享的文件夹相互包含，已替换原共享",
+		langEN: "The new folder is inside or around the previously shared one; it replaced that share",
+	},
+	msgClientConnectedTitle: {langZH: "新设备已连接", langEN: "New device connected"},
+	msgClientConnectedBody:  {langZH: "%s 打开了共享页面", langEN: "%s opened the share page"},
+	msgCrashTitle:           {langZH: "程序出错", langEN: "Something went wrong"},
+	msgCrashBody: {
+		langZH: "LocalShare 遇到了意外错误，错误报告已保存到：\n%s\n\n是否打开所在位置？",
+		langEN: "LocalShare ran into an unexpected error. A report was saved to:\n%s\n\nShow it in the file explorer?",
+	},
+	msgButtonOpen:        {langZH: "打开", langEN: "Open"},
+	msgButtonClose:       {langZH: "关闭", langEN: "Close"},
+	msgUpdateFailedTitle: {langZH: "更新失败", langEN: "Update failed"},
+	msgUpdateDirNotWritable: {
+		langZH: "无法写入程序目录：%s\n\n请把程序放到可写目录（如桌面/下载/自建文件夹）后再试。\n\n详细错误：%v",
+		langEN: "Can't write to the program folder: %s\n\nMove the program to a writable folder (Desktop, Downloads or a folder of your own) and try again.\n\nDetails: %v",
+	},
+	msgUpdateDirCreateFailed: {langZH: "无法创建更新目录：%v", langEN: "Can't create the update folder: %v"},
+	msgUpdateScriptFailed:    {langZH: "无法创建更新脚本：%v", langEN: "Can't create the update script: %v"},
+	msgUpdaterStartFailed:    {langZH: "无法启动更新进程：%v", langEN: "Can't start the updater: %v"},
+	msgUpdaterErrorTitle:     {langZH: "LocalShare 更新失败", langEN: "LocalShare update failed"},
+	msgUpdaterFailed:         {langZH: "更新失败：", langEN: "Update failed: "},
+	msgUpdaterOldExe:         {langZH: "原程序：", langEN: "Old program: "},
+	msgUpdaterNewExe:         {langZH: "新版本：", langEN: "New version: "},
+	msgUpdaterBackup:         {langZH: "备份：", langEN: "Backup: "},
+	msgUpdaterProcIDEmpty:    {langZH: "ProcId 为空", langEN: "ProcId is empty"},
+	msgUpdaterNewExeMissing:  {langZH: "更新文件不存在：", langEN: "Update file not found: "},
+	msgUpdaterOldExeMissing:  {langZH: "原程序不存在：", langEN: "Old program not found: "},
+}
+
+// tr returns message id in lang (Chinese when lang is unknown), formatted
+// with args when there are any.
+func tr(lang, id string, args ...any) string {
+	m := messages[id]
+	s, ok := m[lang]
+	if !ok {
+		s, ok = m[langZH]
+	}
+	if !ok {
+		s = id
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(s, args...)
+	}
+	return s
+}
+
+// normalizeLanguage maps a language tag ("zh_CN.UTF-8", "en-US") to langZH or
+// langEN; "" when it is neither.
+func normalizeLanguage(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	switch {
+	case strings.HasPrefix(tag, "zh"):
+		return langZH
+	case strings.HasPrefix(tag, "en"):
+		return langEN
+	}
+	return ""
+}
+
+// languageFrom reads SettingKeyLanguage through get (a Settings.Get),
+// falling back to the OS language.
+func languageFrom(get func(key string) (json.RawMessage, bool, error)) string {
+	if raw, ok, err := get(shareserver.SettingKeyLanguage); err == nil && ok {
+		var v string
+		if json.Unmarshal(raw, &v) == nil {
+			if lang := normalizeLanguage(v); lang != "" {
+				return lang
+			}
+		}
+	}
+	return systemLanguage()
+}
+
+var errInvalidLanguage = errors.New("invalid language")
+
+// validateLanguage accepts "" (follow the OS), langZH and langEN.
+func validateLanguage(raw json.RawMessage) error {
+	var v string
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return errInvalidLanguage
+	}
+	if v != "" && v != langZH && v != langEN {
+		return errInvalidLanguage
+	}
+	return nil
+}
+
+// lang is the language of the app's dialogs, read on every call so a change
+// applies right away.
+func (a *App) lang() string {
+	if a == nil || a.shareServer == nil {
+		return systemLanguage()
+	}
+	return languageFrom(a.shareServer.Setting)
+}
+
+// helperLanguage is lang for the update helpers, which run without an App.
+func helperLanguage() string {
+	return languageFrom(newSettingsStore().Get)
+}
+
+func (a *App) tr(id string, args ...any) string {
+	return tr(a.lang(), id, args...)
+}
+
+// warningText is the toast text of a StartResult warning.
+func (a *App) warningText(code string) string {
+	switch code {
+	case shareserver.WarningCustomPortUnavailable:
+		return a.tr(msgWarnCustomPortUnavailable)
+	case shareserver.WarningWatchUnavailable:
+		return a.tr(msgWarnWatchUnavailable)
+	case shareserver.WarningRootOverlap:
+		return a.tr(msgWarnRootOverlap)
+	}
+	return shareserver.WarningMessage(code)
+}
+
+// updaterErrorMessage is the message box shown by the update helpers.
+func updaterErrorMessage(lang string, err error, oldExe, newExe, backupExe string) string {
+	nl := "\r\n"
+	return tr(lang, msgUpdaterFailed) + err.Error() + nl + nl +
+		tr(lang, msgUpdaterOldExe) + oldExe + nl +
+		tr(lang, msgUpdaterNewExe) + newExe + nl +
+		tr(lang, msgUpdaterBackup) + backupExe
+}
+
+// updateScriptTexts fills the {{...}} placeholders of apply-update.ps1. The
+// texts end up in single-quoted PowerShell strings.
+func updateScriptTexts(lang string) *strings.Replacer {
+	q := func(id string) string { return strings.ReplaceAll(tr(lang, id), "'", "''") }
+	return strings.NewReplacer(
+		"{{procIdEmpty}}", q(msgUpdaterProcIDEmpty),
+		"{{newExeMissing}}", q(msgUpdaterNewExeMissing),
+		"{{oldExeMissing}}", q(msgUpdaterOldExeMissing),
+		"{{failed}}", q(msgUpdaterFailed),
+		"{{oldExe}}", q(msgUpdaterOldExe),
+		"{{newExe}}", q(msgUpdaterNewExe),
+		"{{backup}}", q(msgUpdaterBackup),
+		"{{errorTitle}}", q(msgUpdaterErrorTitle),
+	)
+}
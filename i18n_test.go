@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"LocalShare/pkg/shareserver"
+)
+
+func TestDesktopMessages(t *testing.T) {
+	for id, m := range messages {
+		zh, en := m[langZH], m[langEN]
+		if zh == "" || en == "" {
+			t.Fatalf("message %s lacks a translation: %q", id, m)
+		}
+		if strings.Count(zh, "%") != strings.Count(en, "%") {
+			t.Fatalf("message %s: verbs differ between %q and %q", id, zh, en)
+		}
+	}
+	if got := tr(langEN, msgResumeFailed, "boom"); got != "Could not resume sharing: boom" {
+		t.Fatalf("unexpected en text %q", got)
+	}
+	if got := tr("fr", msgShareFailedTitle); got != "共享失败" {
+		t.Fatalf("expected Chinese fallback, got %q", got)
+	}
+
+	for tag, want := range map[string]string{"zh_CN.UTF-8": langZH, "zh-TW": langZH, "en_US.UTF-8": langEN, "de_DE": ""} {
+		if got := normalizeLanguage(tag); got != want {
+			t.Fatalf("normalizeLanguage(%q) = %q, want %q", tag, got, want)
+		}
+	}
+	for raw, ok := range map[string]bool{`""`: true, `"en"`: true, `"zh-CN"`: true, `"fr"`: false, `1`: false} {
+		if err := validateLanguage(json.RawMessage(raw)); (err == nil) != ok {
+			t.Fatalf("validateLanguage(%s) err=%v", raw, err)
+		}
+	}
+	settings := shareserver.NewMemorySettings()
+	_ = settings.Set(shareserver.SettingKeyLanguage, json.RawMessage(`"en"`))
+	if got := languageFrom(settings.Get); got != langEN {
+		t.Fatalf("expected the setting to win, got %q", got)
+	}
+	if runtime.GOOS != "windows" {
+		_ = settings.Set(shareserver.SettingKeyLanguage, json.RawMessage(`""`))
+		t.Setenv("LC_ALL", "")
+		t.Setenv("LC_MESSAGES", "")
+		t.Setenv("LANG", "de_DE.UTF-8")
+		if got := languageFrom(settings.Get); got != langEN {
+			t.Fatalf("expected English for a non-Chinese locale, got %q", got)
+		}
+		t.Setenv("LANG", "zh_CN.UTF-8")
+		if got := languageFrom(settings.Get); got != langZH {
+			t.Fatalf("expected Chinese for zh_CN, got %q", got)
+		}
+	}
+
+	msg := updaterErrorMessage(langEN, fmt.Errorf("denied"), `C:\a.exe`, `C:\b.exe`, `C:\a.bak`)
+	if !strings.HasPrefix(msg, "Update failed: denied") || !strings.Contains(msg, "Backup: C:\\a.bak") {
+		t.Fatalf("unexpected updater message %q", msg)
+	}
+	script := updateScriptTexts(langEN).Replace(`throw '{{procIdEmpty}}'; Show-Error '{{errorTitle}}' $msg`)
+	if script != `throw 'ProcId is empty'; Show-Error 'LocalShare update failed' $msg` {
+		t.Fatalf("unexpected script %q", script)
+	}
+}
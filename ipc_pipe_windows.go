@@ -0,0 +1,185 @@
+//go:build windows
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// instancePipeName is the single-instance pipe for the current user. The SID
+// is hashed so the name doesn't expose it to other sessions listing pipes.
+func instancePipeName(appID string) (string, error) {
+	user, err := windows.GetCurrentProcessToken().GetTokenUser()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(user.User.Sid.String()))
+	return `\\.\pipe\` + sanitizeMutexName(appID) + "-" + hex.EncodeToString(sum[:8]), nil
+}
+
+// pipeAddr is the net.Addr of both ends of a pipe connection.
+type pipeAddr string
+
+func (a pipeAddr) Network() string { return "pipe" }
+func (a pipeAddr) String() string  { return string(a) }
+
+// pipeListener accepts connections on a named pipe whose DACL only admits the
+// current user. Pipe I/O is synchronous: IPC messages are a few bytes and
+// each connection gets its own goroutine anyway.
+type pipeListener struct {
+	name string
+	sa   *windows.SecurityAttributes
+
+	mu        sync.Mutex
+	next      windows.Handle // instance the next Accept waits on
+	accepting bool
+	closed    bool
+}
+
+func listenPipe(name string) (*pipeListener, error) {
+	user, err := windows.GetCurrentProcessToken().GetTokenUser()
+	if err != nil {
+		return nil, err
+	}
+	sd, err := windows.SecurityDescriptorFromString("D:P(A;;GA;;;" + user.User.Sid.String() + ")")
+	if err != nil {
+		return nil, err
+	}
+	sa := &windows.SecurityAttributes{SecurityDescriptor: sd}
+	sa.Length = uint32(unsafe.Sizeof(*sa))
+
+	l := &pipeListener{name: name, sa: sa}
+	// FIRST_PIPE_INSTANCE: fail rather than join a pipe someone else created
+	// under our name.
+	h, err := l.createInstance(windows.FILE_FLAG_FIRST_PIPE_INSTANCE)
+	if err != nil {
+		return nil, err
+	}
+	l.next = h
+	return l, nil
+}
+
+func (l *pipeListener) createInstance(extraFlags uint32) (windows.Handle, error) {
+	name, err := windows.UTF16PtrFromString(l.name)
+	if err != nil {
+		return windows.InvalidHandle, err
+	}
+	return windows.CreateNamedPipe(
+		name,
+		windows.PIPE_ACCESS_DUPLEX|extraFlags,
+		windows.PIPE_TYPE_BYTE|windows.PIPE_READMODE_BYTE|windows.PIPE_WAIT|windows.PIPE_REJECT_REMOTE_CLIENTS,
+		windows.PIPE_UNLIMITED_INSTANCES,
+		4096, 4096, 0, l.sa,
+	)
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	l.mu.Lock()
+	if l.closed || l.accepting {
+		l.mu.Unlock()
+		return nil, net.ErrClosed
+	}
+	h := l.next
+	l.accepting = true
+	l.mu.Unlock()
+
+	err := windows.ConnectNamedPipe(h, nil)
+	for errors.Is(err, windows.ERROR_NO_DATA) && !l.isClosed() {
+		// A client connected and left before we got here. Reset the
+		// instance and wait for the next one instead of failing the loop.
+		_ = windows.DisconnectNamedPipe(h)
+		err = windows.ConnectNamedPipe(h, nil)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.accepting = false
+	if err != nil && !errors.Is(err, windows.ERROR_PIPE_CONNECTED) && !l.closed {
+		return nil, err
+	}
+	if l.closed {
+		// Woken by Close.
+		_ = windows.CloseHandle(h)
+		l.next = windows.InvalidHandle
+		return nil, net.ErrClosed
+	}
+	// Create the next instance before handing this one out, so a second
+	// client never finds the pipe missing.
+	next, err := l.createInstance(0)
+	if err != nil {
+		_ = windows.CloseHandle(h)
+		l.next = windows.InvalidHandle
+		l.closed = true
+		return nil, err
+	}
+	l.next = next
+	return &pipeConn{File: os.NewFile(uintptr(h), l.name), addr: pipeAddr(l.name)}, nil
+}
+
+func (l *pipeListener) isClosed() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.closed
+}
+
+// Close stops accepting. A blocked ConnectNamedPipe can't be cancelled, so it
+// is completed by connecting to the pipe once; Accept then closes the handle.
+func (l *pipeListener) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	if !l.accepting {
+		if l.next != windows.InvalidHandle {
+			_ = windows.CloseHandle(l.next)
+			l.next = windows.InvalidHandle
+		}
+		l.mu.Unlock()
+		return nil
+	}
+	l.mu.Unlock()
+
+	if f, err := os.OpenFile(l.name, os.O_RDWR, 0); err == nil {
+		_ = f.Close()
+	}
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr { return pipeAddr(l.name) }
+
+// pipeConn is one side of a pipe connection. *os.File reports a closed
+// pipe as io.EOF, which is all handleIPCConn needs.
+type pipeConn struct {
+	*os.File
+	addr pipeAddr
+}
+
+func (c *pipeConn) LocalAddr() net.Addr  { return c.addr }
+func (c *pipeConn) RemoteAddr() net.Addr { return c.addr }
+
+// Deadlines aren't supported on synchronous pipe handles; reads are bounded
+// by the client closing its end instead.
+func (c *pipeConn) SetDeadline(time.Time) error      { return nil }
+func (c *pipeConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *pipeConn) SetWriteDeadline(time.Time) error { return nil }
+
+// dialPipe connects to an existing pipe. A busy pipe fails and is retried by
+// the caller.
+func dialPipe(name string) (net.Conn, error) {
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &pipeConn{File: f, addr: pipeAddr(name)}, nil
+}
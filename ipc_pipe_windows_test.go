@@ -0,0 +1,124 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPipeListenerRoundTrip(t *testing.T) {
+	name := fmt.Sprintf(`\\.\pipe\LocalShare-test-%d-%d`, os.Getpid(), time.Now().UnixNano())
+	ln, err := listenPipe(name)
+	if err != nil {
+		t.Fatalf("listenPipe: %v", err)
+	}
+	defer func() { _ = ln.Close() }()
+
+	// Someone else can't take over the name while we hold it.
+	if other, err := listenPipe(name); err == nil {
+		_ = other.Close()
+		t.Fatalf("expected second listener on %s to fail", name)
+	}
+
+	got := make(chan string, 2)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				close(got)
+				return
+			}
+			data, _ := io.ReadAll(conn)
+			_ = conn.Close()
+			got <- string(data)
+		}
+	}()
+
+	for _, msg := range []string{`C:\Users\me\Docs`, ""} {
+		conn, err := dialPipe(name)
+		if err != nil {
+			t.Fatalf("dialPipe: %v", err)
+		}
+		if _, err := conn.Write([]byte(msg)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		_ = conn.Close()
+		select {
+		case s := <-got:
+			if s != msg {
+				t.Fatalf("expected %q, got %q", msg, s)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q", msg)
+		}
+	}
+
+	if err := ln.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	select {
+	case _, ok := <-got:
+		if ok {
+			t.Fatalf("expected Accept to stop after Close")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Accept still blocked after Close")
+	}
+	if _, err := ln.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("expected net.ErrClosed, got %v", err)
+	}
+}
+
+func TestPipeListenerClientGoneBeforeAccept(t *testing.T) {
+	name := fmt.Sprintf(`\\.\pipe\LocalShare-test-gone-%d-%d`, os.Getpid(), time.Now().UnixNano())
+	ln, err := listenPipe(name)
+	if err != nil {
+		t.Fatalf("listenPipe: %v", err)
+	}
+	defer func() { _ = ln.Close() }()
+
+	// Connect and leave before Accept runs: ConnectNamedPipe then reports
+	// ERROR_NO_DATA, which must not end the accept loop.
+	conn, err := dialPipe(name)
+	if err != nil {
+		t.Fatalf("dialPipe: %v", err)
+	}
+	_ = conn.Close()
+
+	got := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			got <- "error: " + err.Error()
+			return
+		}
+		data, _ := io.ReadAll(conn)
+		_ = conn.Close()
+		got <- string(data)
+	}()
+
+	conn, err = dialPipe(name)
+	for i := 0; err != nil && i < 50; i++ {
+		time.Sleep(20 * time.Millisecond)
+		conn, err = dialPipe(name)
+	}
+	if err != nil {
+		t.Fatalf("dialPipe: %v", err)
+	}
+	_, _ = conn.Write([]byte("hello"))
+	_ = conn.Close()
+	select {
+	case s := <-got:
+		if s != "hello" {
+			t.Fatalf("expected the second client's message, got %q", s)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for the second client")
+	}
+}
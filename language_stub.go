@@ -0,0 +1,24 @@
+//go:build !windows
+
+package main
+
+import "os"
+
+// systemLanguage follows the POSIX locale variables. No locale (or "C") keeps
+// the app's original Chinese.
+func systemLanguage() string {
+	for _, k := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		v := os.Getenv(k)
+		if v == "" {
+			continue
+		}
+		if lang := normalizeLanguage(v); lang != "" {
+			return lang
+		}
+		if v == "C" || v == "POSIX" || v == "C.UTF-8" {
+			return langZH
+		}
+		return langEN
+	}
+	return langZH
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package main
+
+import "golang.org/x/sys/windows"
+
+var procGetUserDefaultUILanguage = windows.NewLazySystemDLL("kernel32.dll").NewProc("GetUserDefaultUILanguage")
+
+// systemLanguage follows the Windows display language: Chinese for any
+// Chinese variant, English otherwise.
+func systemLanguage() string {
+	const langChinese = 0x04
+	r, _, _ := procGetUserDefaultUILanguage.Call()
+	if r == 0 || uint16(r)&0x3ff == langChinese {
+		return langZH
+	}
+	return langEN
+}
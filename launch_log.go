@@ -1,12 +1,34 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
+const (
+	launchLogName = "localshare-launch.log"
+	// launchLogMaxBytes is where the log rotates to launchLogName+".1",
+	// replacing the previous generation.
+	launchLogMaxBytes = 1 << 20
+	// launchLogMaxPerSecond caps the lines one process writes per second; the
+	// rest are counted and reported with the next line that gets through.
+	launchLogMaxPerSecond = 50
+	// launchLogLockStale is how old a lock file may get before it is taken to
+	// be left over from a crashed process.
+	launchLogLockStale = 10 * time.Second
+)
+
+var launchLogLimiter struct {
+	mu      sync.Mutex
+	window  time.Time
+	count   int
+	dropped int
+}
+
 func appendLaunchLogf(format string, args ...any) {
 	appendLaunchLog(fmt.Sprintf(format, args...))
 }
@@ -14,13 +36,129 @@ func appendLaunchLogf(format string, args ...any) {
 func appendLaunchLog(line string) {
 	// 仅用于排查“右键菜单点了没反应/没共享/未唤起 UI”的问题。
 	// 写到临时目录，不影响正常功能。
-	path := filepathJoinSafe(os.TempDir(), "localshare-launch.log")
+	l := &launchLogLimiter
+	l.mu.Lock()
+	now := time.Now()
+	if now.Sub(l.window) >= time.Second {
+		l.window, l.count = now, 0
+	}
+	if l.count >= launchLogMaxPerSecond {
+		l.dropped++
+		l.mu.Unlock()
+		return
+	}
+	l.count++
+	if l.dropped > 0 {
+		line = fmt.Sprintf("(%d lines dropped) %s", l.dropped, line)
+		l.dropped = 0
+	}
+	l.mu.Unlock()
+	appendLaunchLogTo(launchLogPath(), now.Format(time.RFC3339)+" "+line+"\n", launchLogMaxBytes)
+}
+
+func launchLogPath() string {
+	return filepathJoinSafe(os.TempDir(), launchLogName)
+}
+
+// appendLaunchLogTo appends text to path, rotating first when the file has
+// reached maxBytes. The primary and a secondary (notifying) instance can
+// write at the same time: appends use O_APPEND, rotation is done under a lock
+// file.
+func appendLaunchLogTo(path, text string, maxBytes int64) {
+	if st, err := os.Stat(path); err == nil && st.Size() >= maxBytes {
+		withLaunchLogLock(path, func() {
+			// Someone else may have rotated while we waited. On Windows the
+			// rename fails while another process has the file open; the
+			// next append tries again.
+			if st, err := os.Stat(path); err == nil && st.Size() >= maxBytes {
+				_ = os.Rename(path, path+".1")
+			}
+		})
+	}
 	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
 	if err != nil {
 		return
 	}
 	defer f.Close()
-	_, _ = f.WriteString(time.Now().Format(time.RFC3339) + " " + line + "\n")
+	_, _ = f.WriteString(text)
+}
+
+// withLaunchLogLock runs fn holding path+".lock", created with O_EXCL. It
+// gives up (without running fn) after a short wait: logging must never block.
+func withLaunchLogLock(path string, fn func()) bool {
+	lock := path + ".lock"
+	for i := 0; i < 20; i++ {
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			_ = f.Close()
+			defer os.Remove(lock)
+			fn()
+			return true
+		}
+		if st, serr := os.Stat(lock); serr == nil && time.Since(st.ModTime()) > launchLogLockStale {
+			_ = os.Remove(lock)
+			continue
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+// readLaunchLogFrom returns both generations of the log at path, oldest first.
+func readLaunchLogFrom(path string) (string, error) {
+	prev, _ := os.ReadFile(path + ".1")
+	cur, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	if err != nil && len(prev) == 0 {
+		return "", err
+	}
+	return string(prev) + string(cur), nil
+}
+
+func clearLaunchLogAt(path string) error {
+	var err error
+	if !withLaunchLogLock(path, func() {
+		for _, p := range []string{path, path + ".1"} {
+			if rerr := os.Remove(p); rerr != nil && !errors.Is(rerr, os.ErrNotExist) && err == nil {
+				err = rerr
+			}
+		}
+	}) {
+		return errors.New("启动日志正被其他进程使用，请稍后重试")
+	}
+	return err
+}
+
+// ReadLaunchLog returns the last lines of the launch log (all of it when
+// lines <= 0).
+func (a *App) ReadLaunchLog(lines int) (string, error) {
+	s, err := readLaunchLogFrom(launchLogPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if lines > 0 {
+		s = tailLines(s, lines)
+	}
+	return s, nil
+}
+
+// ClearLaunchLog deletes the launch log and its previous generation.
+func (a *App) ClearLaunchLog() error {
+	return clearLaunchLogAt(launchLogPath())
+}
+
+// OpenLaunchLogFolder shows the launch log in the file explorer.
+func (a *App) OpenLaunchLogFolder() error {
+	p := launchLogPath()
+	if _, err := os.Stat(p); err != nil {
+		return openFolderInOS(os.TempDir())
+	}
+	return revealInOS(p)
 }
 
 func filepathJoinSafe(dir, name string) string {
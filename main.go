@@ -4,8 +4,10 @@ import (
 	"embed"
 	"net"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
@@ -16,6 +18,21 @@ import (
 var assets embed.FS
 
 func main() {
+	defer recoverMainCrash()
+
+	if hasApplyUpdateFlag(os.Args[1:]) {
+		// 更新助手模式：PowerShell 不可用时由它替换 exe。
+		os.Exit(applyUpdateMain(os.Args[1:]))
+	}
+	if hasFinishUpdateFlag(os.Args[1:]) {
+		// 新版本完成自我替换：等待旧进程退出后覆盖旧 exe 并重启。
+		os.Exit(finishUpdateMain(os.Args[1:]))
+	}
+	if hasHeadlessFlag(os.Args[1:]) {
+		// 无界面模式：不走单实例 / Wails，直接跑共享服务。
+		os.Exit(headlessMain(os.Args[1:]))
+	}
+
 	initialShare := ""
 	exe, _ := os.Executable()
 	// Wails 在 dev 模式下会运行一个临时的 wailsbindings.exe 来生成绑定。
@@ -33,6 +50,9 @@ func main() {
 	if skipSingleInstance {
 		appendLaunchLogf("single-instance skipped exe=%q", exe)
 	}
+	if exe != "" {
+		go removeStaleUpdateExe(exe)
+	}
 
 	const appID = "LocalShare"
 	primary, releaseMutex, err := true, func() {}, error(nil)
@@ -49,7 +69,11 @@ func main() {
 		}
 		return
 	}
-	defer releaseMutex()
+	// 正常退出、Ctrl+C/kill、Windows 注销/关机都走同一套清理，
+	// 避免留下未停止的共享服务或失效的 instance.json。
+	var hooks shutdownHooks
+	defer hooks.run("exit")
+	hooks.add(releaseMutex)
 	if primary {
 		appendLaunchLogf("single-instance primary")
 	}
@@ -66,7 +90,7 @@ func main() {
 		}
 	}
 	if ipcCleanup != nil {
-		defer ipcCleanup()
+		hooks.add(ipcCleanup)
 	}
 
 	// Create an instance of the app structure
@@ -74,6 +98,23 @@ func main() {
 	if ipcLn != nil {
 		app.setIPCListener(ipcLn)
 	}
+	hooks.add(func() {
+		if err := stopShareServer(app.shareServer, shutdownTimeout); err != nil {
+			appendLaunchLogf("shutdown stop sharing err=%v", err)
+		}
+	})
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-sigCh
+		hooks.run("signal " + sig.String())
+		os.Exit(0)
+	}()
+	watchSessionEnd(func() {
+		hooks.run("session end")
+		os.Exit(0)
+	})
 
 	// Create application with options
 	err = wails.Run(&options.App{
@@ -90,6 +131,7 @@ func main() {
 		},
 		BackgroundColour: &options.RGBA{R: 27, G: 38, B: 54, A: 1},
 		OnStartup:        app.startup,
+		OnDomReady:       app.domReady,
 		Bind: []interface{}{
 			app,
 		},
@@ -4,6 +4,6 @@ package main
 
 import "errors"
 
-func openFolderInOS(path string) error {
+func showDesktopNotification(title, message string) error {
 	return errors.New("仅支持 Windows")
 }
@@ -0,0 +1,108 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+type notifyIconDataW struct {
+	CbSize           uint32
+	HWnd             uintptr
+	UID              uint32
+	UFlags           uint32
+	UCallbackMessage uint32
+	HIcon            uintptr
+	SzTip            [128]uint16
+	DwState          uint32
+	DwStateMask      uint32
+	SzInfo           [256]uint16
+	UTimeoutOrVer    uint32
+	SzInfoTitle      [64]uint16
+	DwInfoFlags      uint32
+	GuidItem         windows.GUID
+	HBalloonIcon     uintptr
+}
+
+const (
+	nimAdd    = 0x0
+	nimDelete = 0x2
+
+	nifIcon = 0x2
+	nifTip  = 0x4
+	nifInfo = 0x10
+
+	niifInfo = 0x1
+
+	idiApplication = 32512
+
+	// Arbitrary but stable id so a new balloon replaces the previous one.
+	notifyIconID = 0x4C53
+)
+
+var (
+	user32          = windows.NewLazySystemDLL("user32.dll")
+	procFindWindowW = user32.NewProc("FindWindowW")
+	procLoadIconW   = user32.NewProc("LoadIconW")
+
+	shell32NotifyIcon    = windows.NewLazySystemDLL("shell32.dll")
+	procShellNotifyIconW = shell32NotifyIcon.NewProc("Shell_NotifyIconW")
+)
+
+// showDesktopNotification shows a shell balloon (rendered as a toast on Windows 10+),
+// anchored to a temporary notification-area icon of the main window.
+// It does not need the window to be visible.
+func showDesktopNotification(title, message string) error {
+	titlePtr, err := windows.UTF16PtrFromString("LocalShare")
+	if err != nil {
+		return err
+	}
+	hwnd, _, _ := procFindWindowW.Call(0, uintptr(unsafe.Pointer(titlePtr)))
+	if hwnd == 0 {
+		return errors.New("main window not found")
+	}
+	icon, _, _ := procLoadIconW.Call(0, uintptr(idiApplication))
+
+	nid := notifyIconDataW{
+		HWnd:        hwnd,
+		UID:         notifyIconID,
+		UFlags:      nifIcon | nifTip | nifInfo,
+		HIcon:       icon,
+		DwInfoFlags: niifInfo,
+	}
+	nid.CbSize = uint32(unsafe.Sizeof(nid))
+	copyUTF16(nid.SzTip[:], "LocalShare")
+	copyUTF16(nid.SzInfoTitle[:], title)
+	copyUTF16(nid.SzInfo[:], message)
+
+	// Remove a leftover icon from a previous notification, then add the new one.
+	_, _, _ = procShellNotifyIconW.Call(nimDelete, uintptr(unsafe.Pointer(&nid)))
+	r1, _, callErr := procShellNotifyIconW.Call(nimAdd, uintptr(unsafe.Pointer(&nid)))
+	if r1 == 0 {
+		return callErr
+	}
+
+	go func() {
+		time.Sleep(10 * time.Second)
+		del := notifyIconDataW{HWnd: hwnd, UID: notifyIconID}
+		del.CbSize = uint32(unsafe.Sizeof(del))
+		_, _, _ = procShellNotifyIconW.Call(nimDelete, uintptr(unsafe.Pointer(&del)))
+	}()
+	return nil
+}
+
+func copyUTF16(dst []uint16, s string) {
+	src, err := windows.UTF16FromString(s)
+	if err != nil {
+		return
+	}
+	if len(src) > len(dst) {
+		src = src[:len(dst)]
+		src[len(src)-1] = 0
+	}
+	copy(dst, src)
+}
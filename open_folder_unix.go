@@ -0,0 +1,83 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+func openFolderInOS(path string) error {
+	path = strings.TrimSpace(path)
+	path = strings.Trim(path, "\"")
+	if path == "" {
+		return nil
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	st, err := os.Stat(abs)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return errors.New("文件夹不存在（可能已被删除）")
+		}
+		return err
+	}
+	return startOpener(openFolderCommand(runtime.GOOS, abs, st.IsDir()))
+}
+
+// revealInOS opens the parent folder with the item selected where the file
+// manager supports it (macOS); xdg-open can only open the parent folder.
+func revealInOS(path string) error {
+	abs, err := filepath.Abs(strings.Trim(strings.TrimSpace(path), "\""))
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(abs); err != nil {
+		if os.IsNotExist(err) {
+			return errors.New("文件不存在（可能已被删除）")
+		}
+		return err
+	}
+	return startOpener(openFolderCommand(runtime.GOOS, abs, false))
+}
+
+// openFolderCommand is the command that opens dir, or shows file in its
+// folder. Paths are passed as separate arguments, never through a shell.
+func openFolderCommand(goos string, abs string, isDir bool) []string {
+	if goos == "darwin" {
+		if isDir {
+			return []string{"open", abs}
+		}
+		return []string{"open", "-R", abs}
+	}
+	if !isDir {
+		abs = filepath.Dir(abs)
+	}
+	return []string{"xdg-open", abs}
+}
+
+// startOpener runs argv without waiting, with a friendly error when there is
+// no desktop to open it on (headless servers).
+func startOpener(argv []string) error {
+	if runtime.GOOS != "darwin" && os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+		return errors.New("没有图形界面，无法打开文件夹")
+	}
+	bin, err := exec.LookPath(argv[0])
+	if err != nil {
+		return errors.New("未找到可用的文件管理器（" + argv[0] + "）")
+	}
+	cmd := exec.Command(bin, argv[1:]...)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// Reap the opener; xdg-open exits as soon as it has handed off.
+	go func() { _ = cmd.Wait() }()
+	return nil
+}
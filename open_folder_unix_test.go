@@ -0,0 +1,28 @@
+//go:build !windows
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOpenFolderCommand(t *testing.T) {
+	cases := []struct {
+		goos  string
+		path  string
+		isDir bool
+		want  []string
+	}{
+		{"darwin", "/Users/me/My Files", true, []string{"open", "/Users/me/My Files"}},
+		{"darwin", "/Users/me/a b.txt", false, []string{"open", "-R", "/Users/me/a b.txt"}},
+		{"linux", "/home/me/$(rm -rf ~)", true, []string{"xdg-open", "/home/me/$(rm -rf ~)"}},
+		{"linux", "/home/me/dir/it's.txt", false, []string{"xdg-open", "/home/me/dir"}},
+		{"freebsd", "/tmp", true, []string{"xdg-open", "/tmp"}},
+	}
+	for _, tc := range cases {
+		if got := openFolderCommand(tc.goos, tc.path, tc.isDir); !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("%s %q: got %q, want %q", tc.goos, tc.path, got, tc.want)
+		}
+	}
+}
@@ -40,3 +40,18 @@ func openFolderInOS(path string) error {
 	}
 	return nil
 }
+
+// revealInOS opens the parent folder with the item selected, for files and directories alike.
+func revealInOS(path string) error {
+	abs, err := filepath.Abs(strings.Trim(strings.TrimSpace(path), "\""))
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(abs); err != nil {
+		if os.IsNotExist(err) {
+			return errors.New("文件不存在（可能已被删除）")
+		}
+		return err
+	}
+	return exec.Command("explorer.exe", "/select,"+abs).Start()
+}
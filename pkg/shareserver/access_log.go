@@ -0,0 +1,221 @@
+package shareserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// accessLogCapacity is how many recent requests are kept in memory.
+const accessLogCapacity = 500
+
+// AccessLogEntry is one served HTTP request. Query values that carry
+// credentials are redacted before the entry is stored.
+type AccessLogEntry struct {
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	DurationMs int64     `json:"durationMs"`
+	ClientIP   string    `json:"clientIP"`
+	// Event flags notable requests, e.g. AccessEventPathForbidden; Detail
+	// is the offending input.
+	Event  string `json:"event,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// sensitiveQueryParams are replaced by "REDACTED" in logged paths.
+var sensitiveQueryParams = map[string]bool{
+	queryShareToken:    true,
+	queryDownloadToken: true,
+	queryLinkToken:     true,
+	queryEntryToken:    true,
+	"pass":             true,
+	"password":         true,
+}
+
+// accessLog is a fixed-size ring buffer of recent requests.
+type accessLog struct {
+	mu      sync.Mutex
+	entries []AccessLogEntry
+	next    int
+	full    bool
+}
+
+func newAccessLog(capacity int) *accessLog {
+	return &accessLog{entries: make([]AccessLogEntry, capacity)}
+}
+
+func (l *accessLog) add(e AccessLogEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries[l.next] = e
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// recent returns up to limit entries, newest first. limit <= 0 means all.
+func (l *accessLog) recent(limit int) []AccessLogEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := l.next
+	if l.full {
+		n = len(l.entries)
+	}
+	if limit <= 0 || limit > n {
+		limit = n
+	}
+	out := make([]AccessLogEntry, 0, limit)
+	for i := 0; i < limit; i++ {
+		idx := (l.next - 1 - i + len(l.entries)) % len(l.entries)
+		out = append(out, l.entries[idx])
+	}
+	return out
+}
+
+// redactedRequestPath returns the request path plus query with credentials masked.
+func redactedRequestPath(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.Path
+	}
+	q, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		// Unparseable query: don't risk logging a token.
+		return u.Path + "?REDACTED"
+	}
+	for key := range q {
+		if sensitiveQueryParams[key] {
+			q[key] = []string{"REDACTED"}
+		}
+	}
+	return u.Path + "?" + q.Encode()
+}
+
+// statusRecorder captures status and size while keeping Flush working for SSE.
+// logf, when set, lets writeJSON report encoding failures; event and detail
+// are copied into the access log entry.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+	logf   func(format string, args ...any)
+	event  string
+	detail string
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Write(p []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(p)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+func (rec *statusRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// responseLogf finds the server's logger through the wrappers around w, or
+// returns nil when w wasn't wrapped by logRequests or recoverPanics.
+func responseLogf(w http.ResponseWriter) func(format string, args ...any) {
+	for w != nil {
+		if rec, ok := w.(*statusRecorder); ok && rec.logf != nil {
+			return rec.logf
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return nil
+		}
+		w = u.Unwrap()
+	}
+	return nil
+}
+
+// markAccessEvent tags the access log entry of the request being answered
+// through w (every statusRecorder around it, since recoverPanics adds its own).
+func markAccessEvent(w http.ResponseWriter, event, detail string) {
+	for w != nil {
+		if rec, ok := w.(*statusRecorder); ok {
+			rec.event, rec.detail = event, detail
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return
+		}
+		w = u.Unwrap()
+	}
+}
+
+// logRequests records every request in the access log (and optionally a file).
+func (s *Server) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, logf: s.logf}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		entry := AccessLogEntry{
+			Time:       start,
+			Method:     r.Method,
+			Path:       redactedRequestPath(r.URL),
+			Status:     rec.status,
+			Bytes:      rec.bytes,
+			DurationMs: time.Since(start).Milliseconds(),
+			ClientIP:   s.clientIP(r),
+			Event:      rec.event,
+			Detail:     rec.detail,
+		}
+		s.accessLog.add(entry)
+		if s.getBoolSetting(SettingKeyAccessLogFile) {
+			s.appendAccessLogFile(entry)
+		}
+	})
+}
+
+// AccessLog returns up to limit recent requests, newest first. limit <= 0 means all.
+func (s *Server) AccessLog(limit int) []AccessLogEntry {
+	return s.accessLog.recent(limit)
+}
+
+func (s *Server) appendAccessLogFile(e AccessLogEntry) {
+	p := s.accessLogPath
+	if p == "" {
+		p = filepath.Join(configDir(), "access.log")
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	s.accessLogFileMu.Lock()
+	defer s.accessLogFileMu.Unlock()
+	_ = os.MkdirAll(filepath.Dir(p), 0o755)
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		s.logf("access log open err=%v", err)
+		return
+	}
+	defer f.Close()
+	_, _ = f.Write(append(b, '\n'))
+}
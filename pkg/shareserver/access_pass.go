@@ -0,0 +1,70 @@
+package shareserver
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// SettingKeyAccessPassChangedAt records (RFC3339) when SetAccessPass last ran.
+const SettingKeyAccessPassChangedAt = "local-share:access-pass-changed-at"
+
+// ErrInvalidAccessPass is returned by SetAccessPass for a pass that
+// IsValidAccessPass rejects.
+var ErrInvalidAccessPass = errors.New("访问口令须为 1-16 位数字或大小写字母")
+
+// AccessPassStatus tells whether a pass is set, never the pass itself.
+type AccessPassStatus struct {
+	Enabled bool `json:"enabled"`
+	// ChangedAt is when the pass was last set or cleared (RFC3339), "" if never.
+	ChangedAt string `json:"changedAt,omitempty"`
+}
+
+// SetAccessPass validates and stores pass ("" clears it) and revokes every
+// token issued so far, even when the pass is unchanged.
+func (s *Server) SetAccessPass(pass string) error {
+	if s.settings == nil {
+		return errSettingsUnavailable
+	}
+	pass = strings.TrimSpace(pass)
+	if !IsValidAccessPass(pass) {
+		return ErrInvalidAccessPass
+	}
+	if admin, _ := s.adminConfig(); pass != "" && pass == admin {
+		return errAdminPassIsAccess
+	}
+	var err error
+	if pass == "" {
+		err = s.settings.Delete(SettingKeyAccessPass)
+	} else {
+		raw, _ := json.Marshal(pass)
+		err = s.settings.Set(SettingKeyAccessPass, raw)
+	}
+	if err != nil {
+		return err
+	}
+	s.auth.revokeAll(authPassChanged)
+	changedAt, _ := json.Marshal(time.Now().UTC().Format(time.RFC3339))
+	return s.settings.Set(SettingKeyAccessPassChangedAt, changedAt)
+}
+
+// ClearAccessPass turns the access pass off.
+func (s *Server) ClearAccessPass() error {
+	return s.SetAccessPass("")
+}
+
+// AccessPassStatus reports whether a pass is required. A stored pass that
+// fails validation counts as set, since requireAuth then refuses everyone.
+func (s *Server) AccessPassStatus() AccessPassStatus {
+	var st AccessPassStatus
+	if s.settings == nil {
+		return st
+	}
+	_, enabled, err := s.getAccessPassFromSettings()
+	st.Enabled = enabled || err != nil
+	if raw, ok, err := s.settings.Get(SettingKeyAccessPassChangedAt); err == nil && ok {
+		_ = json.Unmarshal(raw, &st.ChangedAt)
+	}
+	return st
+}
@@ -0,0 +1,215 @@
+package shareserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Remote administration lets a trusted web client (the host's own phone)
+// stop the share or change permissions. It is off until the host sets an
+// admin pass or grants client IPs; both settings are host-only.
+const (
+	// SettingKeyAdminPass (JSON string) is sent in X-Admin-Pass. It must
+	// differ from the access pass.
+	SettingKeyAdminPass = "local-share:admin-pass"
+	// SettingKeyAdminIPs (JSON string array) are client IPs allowed to
+	// administer without the admin pass.
+	SettingKeyAdminIPs = "local-share:admin-ips"
+)
+
+const headerAdminPass = "X-Admin-Pass"
+
+// Remote admin actions passed to Options.OnRemoteAdmin.
+const (
+	RemoteAdminStop        = "stop"
+	RemoteAdminPermissions = "permissions"
+)
+
+var (
+	errInvalidAdminPass   = errors.New("管理口令须为 8-64 位，且不能包含空白字符")
+	errAdminPassIsAccess  = errors.New("管理口令不能与访问口令相同")
+	errInvalidAdminIPList = errors.New("管理 IP 须为 IP 地址列表")
+)
+
+// validateAdminPass checks a new admin pass ("" turns it off).
+func (s *Server) validateAdminPass(value json.RawMessage) error {
+	var pass string
+	if err := json.Unmarshal(value, &pass); err != nil {
+		return errInvalidAdminPass
+	}
+	if pass == "" {
+		return nil
+	}
+	if len(pass) < 8 || len(pass) > 64 || strings.ContainsAny(pass, " \t\r\n") {
+		return errInvalidAdminPass
+	}
+	if access, enabled, err := s.getAccessPassFromSettings(); err == nil && enabled && access == pass {
+		return errAdminPassIsAccess
+	}
+	return nil
+}
+
+func validateAdminIPs(value json.RawMessage) error {
+	var ips []string
+	if err := json.Unmarshal(value, &ips); err != nil {
+		return errInvalidAdminIPList
+	}
+	for _, ip := range ips {
+		if _, err := netip.ParseAddr(strings.TrimSpace(ip)); err != nil {
+			return errInvalidAdminIPList
+		}
+	}
+	return nil
+}
+
+func (s *Server) adminConfig() (pass string, ips []string) {
+	if s.settings == nil {
+		return "", nil
+	}
+	if raw, ok, err := s.settings.Get(SettingKeyAdminPass); err == nil && ok {
+		_ = json.Unmarshal(raw, &pass)
+	}
+	if raw, ok, err := s.settings.Get(SettingKeyAdminIPs); err == nil && ok {
+		_ = json.Unmarshal(raw, &ips)
+	}
+	// Never accept the access pass as admin pass, however it got stored.
+	if access, enabled, err := s.getAccessPassFromSettings(); err == nil && enabled && access == pass {
+		pass = ""
+	}
+	return pass, ips
+}
+
+// requireAdmin authorizes a remote admin request by IP grant or admin pass
+// and writes the error response otherwise. Every decision is logged.
+func (s *Server) requireAdmin(w http.ResponseWriter, r *http.Request) (ip string, ok bool) {
+	ip = s.clientIP(r)
+	pass, ips := s.adminConfig()
+	if pass == "" && len(ips) == 0 {
+		writeJSON(w, http.StatusNotFound, map[string]string{
+			"error": "远程管理未开启",
+			"code":  "ADMIN_DISABLED",
+		})
+		return ip, false
+	}
+	if addr, err := netip.ParseAddr(ip); err == nil {
+		for _, granted := range ips {
+			if g, err := netip.ParseAddr(strings.TrimSpace(granted)); err == nil && g.Unmap() == addr.Unmap() {
+				return ip, true
+			}
+		}
+	}
+
+	input := r.Header.Get(headerAdminPass)
+	if pass == "" || input == "" {
+		s.logf("admin: %s %s denied ip=%s (no grant)", r.Method, r.URL.Path, ip)
+		writeJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "需要管理口令",
+			"code":  "ADMIN_REQUIRED",
+		})
+		return ip, false
+	}
+	if !s.auth.allow(ip) {
+		retryAfter := s.auth.retryAfter()
+		w.Header().Set("Retry-After", fmt.Sprintf("%d", retryAfter))
+		writeJSON(w, http.StatusTooManyRequests, map[string]any{
+			"error":      "请求过于频繁，请稍后重试",
+			"code":       "AUTH_RATE_LIMITED",
+			"retryAfter": retryAfter,
+		})
+		return ip, false
+	}
+	if len(input) != len(pass) || subtle.ConstantTimeCompare([]byte(input), []byte(pass)) != 1 {
+		s.logf("admin: %s %s denied ip=%s (wrong admin pass)", r.Method, r.URL.Path, ip)
+		writeJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "管理口令错误",
+			"code":  "ADMIN_PASS_INVALID",
+		})
+		return ip, false
+	}
+	return ip, true
+}
+
+// handleAdminStop stops sharing, as the desktop's stop button does. The
+// reply goes out first: stopping closes this very connection.
+func (s *Server) handleAdminStop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "仅支持 POST"})
+		return
+	}
+	ip, ok := s.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+	s.logf("admin: stop sharing by ip=%s", ip)
+	writeJSON(w, http.StatusOK, map[string]any{"success": true})
+
+	go func() {
+		if err := s.Stop(context.Background()); err != nil {
+			s.logf("admin: stop sharing err=%v", err)
+		}
+		if s.onRemoteAdmin != nil {
+			s.onRemoteAdmin(RemoteAdminStop, ip)
+		}
+	}()
+}
+
+// handleAdminPermissions reads (GET) or changes (POST, any of read/write/
+// delete) the share permissions.
+func (s *Server) handleAdminPermissions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "仅支持 GET/POST"})
+		return
+	}
+	ip, ok := s.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+	if r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, permissionsJSON(s.getPermissionsFromSettings()))
+		return
+	}
+	// Edit the granular settings; read-only mode stays on top of them.
+	perms := s.getPermissionSettings()
+
+	var req PermissionSetting
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+	before := perms
+	if req.Read != nil {
+		perms.Read = *req.Read
+	}
+	if req.Write != nil {
+		perms.Write = *req.Write
+	}
+	if req.Delete != nil {
+		perms.Delete = *req.Delete
+	}
+	raw, _ := json.Marshal(permissionsJSON(perms))
+	if err := s.setSettingFrom(SettingKeyPermissions, raw, settingOrigin{source: SettingOriginWeb, clientIP: ip}); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "保存权限失败"})
+		return
+	}
+	s.applySetting(SettingKeyPermissions)
+	s.logf("admin: permissions %+v -> %+v by ip=%s", before, perms, ip)
+	if s.onRemoteAdmin != nil {
+		s.onRemoteAdmin(RemoteAdminPermissions, ip)
+	}
+	writeJSON(w, http.StatusOK, permissionsJSON(perms))
+}
+
+// permissionsJSON is perms in the shape of SettingKeyPermissions.
+func permissionsJSON(perms Permissions) PermissionSetting {
+	return PermissionSetting{Read: &perms.Read, Write: &perms.Write, Delete: &perms.Delete}
+}
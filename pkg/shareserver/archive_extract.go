@@ -0,0 +1,150 @@
+package shareserver
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// SettingKeyArchiveExtractMaxMB (JSON number, MiB) is the largest
+// uncompressed entry /api/archive-extract hands out; default 2048.
+const SettingKeyArchiveExtractMaxMB = "local-share:archive-extract-max-mb"
+
+const defaultArchiveExtractMaxMB = 2048
+
+// zipFlagEncrypted is bit 0 of the general purpose flags: the entry is
+// encrypted, which archive/zip can't read.
+const zipFlagEncrypted = 0x1
+
+func (s *Server) archiveExtractMaxBytes() int64 {
+	return int64(s.getIntSetting(SettingKeyArchiveExtractMaxMB, defaultArchiveExtractMaxMB, 1, 1<<20)) << 20
+}
+
+// handleArchiveExtract streams one entry of a zip file in the share
+// (?path=big.zip&entry=docs/readme.pdf), so a single file can be taken out
+// of a big archive without downloading all of it. entry must equal a name in
+// the archive's directory exactly. Stored entries support Range requests;
+// compressed ones are always sent whole, and their CRC is checked at the
+// end.
+func (s *Server) handleArchiveExtract(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "仅支持 GET"})
+		return
+	}
+
+	s.mu.RLock()
+	root := s.sharedRoot
+	s.mu.RUnlock()
+	if root == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "服务未启动"})
+		return
+	}
+	if !s.requireAuth(w, r) {
+		return
+	}
+	if !s.requirePermission(w, "read") {
+		return
+	}
+
+	q := r.URL.Query()
+	entry := q.Get("entry")
+	if entry == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "缺少 entry 参数"})
+		return
+	}
+	fullPath, ok := s.resolveSharePath(w, r, root, strings.TrimSpace(q.Get("path")))
+	if !ok {
+		return
+	}
+	f, err := os.Open(fullPath)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "文件不存在"})
+		return
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil || !st.Mode().IsRegular() {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "文件不存在"})
+		return
+	}
+	zr, err := zip.NewReader(f, st.Size())
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "不是有效的 zip 文件", "code": "NOT_A_ZIP"})
+		return
+	}
+
+	var zf *zip.File
+	for _, candidate := range zr.File {
+		if candidate.Name == entry {
+			zf = candidate
+			break
+		}
+	}
+	switch {
+	case zf == nil:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "压缩包中没有该文件", "code": "ARCHIVE_ENTRY_NOT_FOUND"})
+		return
+	case zf.FileInfo().IsDir():
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "不能提取文件夹", "code": "ARCHIVE_ENTRY_IS_DIR"})
+		return
+	case zf.Flags&zipFlagEncrypted != 0:
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": "该文件已加密，无法单独提取", "code": "ARCHIVE_ENTRY_ENCRYPTED"})
+		return
+	}
+	if limit := s.archiveExtractMaxBytes(); zf.UncompressedSize64 > uint64(limit) {
+		writeJSON(w, http.StatusRequestEntityTooLarge, map[string]any{
+			"error": fmt.Sprintf("文件过大（超过 %d MB），请下载整个压缩包", limit>>20),
+			"code":  "ARCHIVE_ENTRY_TOO_LARGE",
+			"size":  zf.UncompressedSize64,
+			"limit": limit,
+		})
+		return
+	}
+
+	name := path.Base(zf.Name)
+	w.Header().Set("Content-Type", contentTypeFor(name))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename*=UTF-8''%s", url.PathEscape(name)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if zf.Method == zip.Store {
+		offset, err := zf.DataOffset()
+		if err != nil || zf.CompressedSize64 != zf.UncompressedSize64 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "压缩包已损坏", "code": "ARCHIVE_CORRUPT"})
+			return
+		}
+		// The entry's bytes lie as-is in the file, so Range works as usual.
+		http.ServeContent(w, r, name, zf.Modified, io.NewSectionReader(f, offset, int64(zf.UncompressedSize64)))
+		return
+	}
+
+	rc, err := zf.Open()
+	if err != nil {
+		if errors.Is(err, zip.ErrAlgorithm) {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": "不支持该压缩方式", "code": "ARCHIVE_ENTRY_UNSUPPORTED"})
+			return
+		}
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "压缩包已损坏", "code": "ARCHIVE_CORRUPT"})
+		return
+	}
+	defer rc.Close()
+	size := int64(zf.UncompressedSize64)
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("Accept-Ranges", "none")
+	if r.Method == http.MethodHead {
+		return
+	}
+	// archive/zip refuses to read past the declared size, so a lying header
+	// leaves the body short of Content-Length and the download fails.
+	n, err := io.Copy(w, ctxReader{ctx: r.Context(), r: rc})
+	if err != nil && r.Context().Err() == nil {
+		s.logf("archive extract %s!%s after %d bytes: %v", fullPath, entry, n, err)
+	}
+}
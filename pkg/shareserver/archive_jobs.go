@@ -0,0 +1,456 @@
+package shareserver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Settings for archive jobs (zips prepared on disk before download).
+// SettingKeyArchiveSpoolDir is a JSON string, empty for a folder under
+// TempDir(); SettingKeyArchiveSpoolMaxGB (JSON number) caps the
+// uncompressed size of all live jobs together.
+const (
+	SettingKeyArchiveSpoolDir   = "local-share:archive-spool-dir"
+	SettingKeyArchiveSpoolMaxGB = "local-share:archive-spool-max-gb"
+)
+
+// Archive job states, see archiveJobInfo.State.
+const (
+	ArchiveJobRunning  = "running"
+	ArchiveJobReady    = "ready"
+	ArchiveJobFailed   = "failed"
+	ArchiveJobCanceled = "canceled"
+)
+
+const (
+	// maxArchiveJobs counts the running and ready jobs.
+	maxArchiveJobs        = 4
+	maxFilesInArchiveJob  = 200000
+	defaultArchiveSpoolGB = 50
+	// archiveJobTTL is how long a finished job (and its file) is kept; a
+	// failed one only stays for archiveFailedJobTTL, long enough to be seen.
+	archiveJobTTL       = time.Hour
+	archiveFailedJobTTL = time.Minute
+	// archiveProgressInterval throttles "archiveJob" progress events.
+	archiveProgressInterval = 500 * time.Millisecond
+)
+
+// archiveJobInfo is what /api/archive-jobs and the "archiveJob" event report.
+type archiveJobInfo struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	State      string `json:"state"`
+	FileCount  int    `json:"fileCount"`
+	TotalBytes int64  `json:"totalBytes"`
+	// DoneBytes counts input read so far, out of TotalBytes.
+	DoneBytes int64  `json:"doneBytes"`
+	Error     string `json:"error,omitempty"`
+	// ExpiresAt is set once the job has finished (RFC 3339).
+	ExpiresAt string `json:"expiresAt,omitempty"`
+	// DownloadToken is only set for GET /api/archive-jobs/<id>?downloadToken=1
+	// on a ready job; pass it as ?dl= next to ?job=.
+	DownloadToken string `json:"downloadToken,omitempty"`
+}
+
+type archiveJob struct {
+	info archiveJobInfo
+	// owner is the client IP that created the job; only it can see the job,
+	// get its events or download it without a download token.
+	owner  string
+	path   string
+	cancel context.CancelFunc
+	done   chan struct{}
+	expiry *time.Timer
+}
+
+// archiveJobs builds zips in a spool directory in the background so huge
+// downloads can be fetched (and resumed) with Range requests afterwards.
+type archiveJobs struct {
+	mu   sync.Mutex
+	jobs map[string]*archiveJob
+	// onChange is called, outside the lock, whenever a job changes state
+	// and at most every archiveProgressInterval while it runs.
+	onChange func(owner string, info archiveJobInfo)
+}
+
+func newArchiveJobs() *archiveJobs {
+	return &archiveJobs{jobs: map[string]*archiveJob{}}
+}
+
+func (s *Server) archiveSpoolDir() string {
+	if s.settings != nil {
+		if raw, ok, err := s.settings.Get(SettingKeyArchiveSpoolDir); err == nil && ok && len(raw) > 0 {
+			var dir string
+			if json.Unmarshal(raw, &dir) == nil && strings.TrimSpace(dir) != "" {
+				return strings.TrimSpace(dir)
+			}
+		}
+	}
+	return filepath.Join(s.TempDir(), "local-share-archives")
+}
+
+func (s *Server) archiveSpoolMaxBytes() int64 {
+	return int64(s.getIntSetting(SettingKeyArchiveSpoolMaxGB, defaultArchiveSpoolGB, 1, 4096)) << 30
+}
+
+func newArchiveJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (j *archiveJob) live() bool {
+	return j.info.State == ArchiveJobRunning || j.info.State == ArchiveJobReady
+}
+
+// liveLocked counts the running and ready jobs, for maxArchiveJobs.
+func (a *archiveJobs) liveLocked() int {
+	n := 0
+	for _, j := range a.jobs {
+		if j.live() {
+			n++
+		}
+	}
+	return n
+}
+
+// reserved is the uncompressed size of all live jobs, for the spool limit.
+func (a *archiveJobs) reservedLocked() int64 {
+	var n int64
+	for _, j := range a.jobs {
+		if j.live() {
+			n += j.info.TotalBytes
+		}
+	}
+	return n
+}
+
+// start registers a job of owner for candidates and builds its zip in dir.
+func (a *archiveJobs) start(owner string, dir string, maxBytes int64, name string, candidates []zipCandidate, caseInsensitive, strict bool) (archiveJobInfo, error) {
+	var total int64
+	for _, c := range candidates {
+		total += c.size
+	}
+
+	a.mu.Lock()
+	if a.liveLocked() >= maxArchiveJobs {
+		a.mu.Unlock()
+		return archiveJobInfo{}, &zipError{http.StatusTooManyRequests, "打包任务过多，请先删除已有任务"}
+	}
+	if a.reservedLocked()+total > maxBytes {
+		a.mu.Unlock()
+		return archiveJobInfo{}, &zipError{http.StatusBadRequest, "打包内容超过暂存空间上限"}
+	}
+	if len(a.jobs) == 0 {
+		// Nothing of ours is live: whatever is left came from a crash.
+		removeStaleArchives(dir)
+	}
+	id, err := newArchiveJobID()
+	if err == nil {
+		err = os.MkdirAll(dir, 0o755)
+	}
+	if err != nil {
+		a.mu.Unlock()
+		return archiveJobInfo{}, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &archiveJob{
+		info: archiveJobInfo{
+			ID:         id,
+			Name:       name,
+			State:      ArchiveJobRunning,
+			FileCount:  len(candidates),
+			TotalBytes: total,
+		},
+		owner:  owner,
+		path:   filepath.Join(dir, "archive-"+id+".zip"),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	a.jobs[id] = j
+	info := j.info
+	a.mu.Unlock()
+
+	go a.run(ctx, j, candidates, caseInsensitive, strict)
+	a.notify(owner, info)
+	return info, nil
+}
+
+func removeStaleArchives(dir string) {
+	matches, _ := filepath.Glob(filepath.Join(dir, "archive-*.zip*"))
+	for _, m := range matches {
+		_ = os.Remove(m)
+	}
+}
+
+func (a *archiveJobs) run(ctx context.Context, j *archiveJob, candidates []zipCandidate, caseInsensitive, strict bool) {
+	defer close(j.done)
+
+	part := j.path + ".part"
+	err := func() error {
+		f, err := os.Create(part)
+		if err != nil {
+			return err
+		}
+		var lastNotify time.Time
+		err = writeZip(ctx, f, candidates, caseInsensitive, false, strict, func(n int64) {
+			a.mu.Lock()
+			j.info.DoneBytes += n
+			info := j.info
+			a.mu.Unlock()
+			if time.Since(lastNotify) >= archiveProgressInterval {
+				lastNotify = time.Now()
+				a.notify(j.owner, info)
+			}
+		}, nil)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(part, j.path)
+		}
+		return err
+	}()
+
+	a.mu.Lock()
+	switch {
+	case ctx.Err() != nil:
+		j.info.State = ArchiveJobCanceled
+	case errors.Is(err, errZipFileChanged):
+		j.info.State = ArchiveJobFailed
+		j.info.Error = "有文件在打包期间被修改"
+	case err != nil:
+		j.info.State = ArchiveJobFailed
+		j.info.Error = "打包失败"
+	default:
+		j.info.State = ArchiveJobReady
+	}
+	if err != nil {
+		_ = os.Remove(part)
+	}
+	if j.info.State != ArchiveJobCanceled {
+		ttl := archiveJobTTL
+		if j.info.State == ArchiveJobFailed {
+			ttl = archiveFailedJobTTL
+		}
+		j.info.ExpiresAt = time.Now().Add(ttl).UTC().Format(time.RFC3339)
+		j.expiry = time.AfterFunc(ttl, func() { a.remove(j.info.ID, "") })
+	}
+	info := j.info
+	a.mu.Unlock()
+	a.notify(j.owner, info)
+}
+
+func (a *archiveJobs) notify(owner string, info archiveJobInfo) {
+	if a.onChange != nil {
+		a.onChange(owner, info)
+	}
+}
+
+// get returns the job and, once it is ready, the path of its zip. owner ""
+// skips the owner check, for requests that carry a download token.
+func (a *archiveJobs) get(id string, owner string) (archiveJobInfo, string, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	j, ok := a.jobs[id]
+	if !ok || (owner != "" && j.owner != owner) {
+		return archiveJobInfo{}, "", false
+	}
+	if j.info.State != ArchiveJobReady {
+		return j.info, "", true
+	}
+	return j.info, j.path, true
+}
+
+// remove cancels the job if it is still running and deletes its file. owner
+// "" removes anyone's job.
+func (a *archiveJobs) remove(id string, owner string) bool {
+	a.mu.Lock()
+	j, ok := a.jobs[id]
+	if ok && owner != "" && j.owner != owner {
+		ok = false
+	}
+	if ok {
+		delete(a.jobs, id)
+	}
+	if ok && j.expiry != nil {
+		j.expiry.Stop()
+	}
+	a.mu.Unlock()
+	if !ok {
+		return false
+	}
+	j.cancel()
+	<-j.done
+	_ = os.Remove(j.path)
+	return true
+}
+
+// closeAll cancels and deletes every job, for server stop.
+func (a *archiveJobs) closeAll() {
+	a.mu.Lock()
+	ids := make([]string, 0, len(a.jobs))
+	for id := range a.jobs {
+		ids = append(ids, id)
+	}
+	a.mu.Unlock()
+	for _, id := range ids {
+		a.remove(id, "")
+	}
+}
+
+// handleArchiveJobs serves POST /api/archive-jobs (same body as download-zip)
+// and GET/DELETE /api/archive-jobs/<id>. A ready job is downloaded through
+// /api/download?job=<id>, which supports Range requests.
+func (s *Server) handleArchiveJobs(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	root := s.sharedRoot
+	s.mu.RUnlock()
+	if root == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "服务未启动"})
+		return
+	}
+	if !s.requireAuth(w, r) {
+		return
+	}
+	if !s.requirePermission(w, "read") {
+		return
+	}
+
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/archive-jobs"), "/")
+	if id == "" {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "仅支持 POST"})
+			return
+		}
+		s.createArchiveJob(w, r, root)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		info, zipPath, ok := s.archives.get(id, s.clientIP(r))
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "打包任务不存在"})
+			return
+		}
+		if zipPath != "" && wantsDownloadToken(r) {
+			if st, err := os.Stat(zipPath); err == nil {
+				if passHash, err := s.downloadPassHash(); err == nil {
+					info.DownloadToken = s.downloadTokens.issue("job:"+id, st, root, passHash)
+				}
+			}
+		}
+		writeJSON(w, http.StatusOK, info)
+	case http.MethodDelete:
+		if !s.archives.remove(id, s.clientIP(r)) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "打包任务不存在"})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "仅支持 GET、DELETE"})
+	}
+}
+
+func (s *Server) createArchiveJob(w http.ResponseWriter, r *http.Request, root string) {
+	req, paths, ok := readPathsRequest(w, r)
+	if !ok || !s.checkSharePaths(w, r, root, paths) {
+		return
+	}
+
+	// Same candidates as download-zip, but bounded by the spool instead of
+	// the streaming limits.
+	ignore, _, ok := s.withZipDefaultIgnore(w, r, req.Ignore, req.NoDefaultIgnore)
+	if !ok {
+		return
+	}
+	maxBytes := s.archiveSpoolMaxBytes()
+	var candidates []zipCandidate
+	var total int64
+	err := s.walkZipCandidates(root, paths, zipFilter{ignore: ignore, useIgnoreFiles: req.UseIgnoreFiles}, func(c zipCandidate) error {
+		if len(candidates) >= maxFilesInArchiveJob {
+			return &zipError{http.StatusBadRequest, "打包文件过多，请减少选择"}
+		}
+		total += c.size
+		if total > maxBytes {
+			return &zipError{http.StatusBadRequest, "打包内容超过暂存空间上限"}
+		}
+		candidates = append(candidates, c)
+		return nil
+	})
+	if err == nil && len(candidates) == 0 {
+		err = &zipError{http.StatusBadRequest, "打包内容为空（已全部被忽略）"}
+	}
+	if err != nil {
+		writeZipError(w, err)
+		return
+	}
+
+	info, err := s.archives.start(s.clientIP(r), s.archiveSpoolDir(), maxBytes, zipNameForPaths(paths), candidates, req.CaseInsensitive || isCaseInsensitiveClient(r), req.Strict)
+	if err != nil {
+		var ze *zipError
+		if !errors.As(err, &ze) {
+			s.logf("archive job: %v", err)
+		}
+		writeZipError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, info)
+}
+
+// serveArchiveJob is the ?job=<id> branch of /api/download. claims is the
+// verified download token, if the request came with one; without it only the
+// job's owner gets the file.
+func (s *Server) serveArchiveJob(w http.ResponseWriter, r *http.Request, root string, id string, claims *downloadClaims) {
+	owner := s.clientIP(r)
+	if claims != nil {
+		owner = ""
+	}
+	info, zipPath, ok := s.archives.get(id, owner)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "打包任务不存在"})
+		return
+	}
+	if zipPath == "" {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": fmt.Sprintf("压缩包尚未准备好（%s）", info.State)})
+		return
+	}
+	f, err := os.Open(zipPath)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "打包任务不存在"})
+		return
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "读取压缩包失败"})
+		return
+	}
+	if claims != nil && !claims.matches(st) {
+		downloadTokenStale.write(w)
+		return
+	}
+	if claims == nil && wantsDownloadToken(r) {
+		s.writeDownloadToken(w, r, root, "job:"+id, st)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename*=UTF-8''%s", url.PathEscape(info.Name)))
+	http.ServeContent(w, r, info.Name, st.ModTime(), f)
+}
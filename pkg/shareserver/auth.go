@@ -0,0 +1,515 @@
+package shareserver
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"net/netip"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Settings tuning brute-force protection and token lifetime (JSON numbers).
+// Changes apply to the running server; tokens already issued keep their expiry.
+const (
+	SettingKeyAuthRateWindowSeconds = "local-share:auth-rate-window-seconds"
+	SettingKeyAuthRateMaxRequests   = "local-share:auth-rate-max-requests"
+	SettingKeyTokenTTLMinutes       = "local-share:token-ttl-minutes"
+)
+
+// SettingKeyTokenIPBinding (JSON string) controls which client addresses may
+// use a token: TokenIPBindingStrict (default), TokenIPBindingSubnet or
+// TokenIPBindingOff. Phones hopping between Wi-Fi bands or renewing DHCP
+// leases otherwise get logged out.
+const SettingKeyTokenIPBinding = "local-share:token-ip-binding"
+
+const (
+	// TokenIPBindingStrict: only the IP the token was issued to.
+	TokenIPBindingStrict = "strict"
+	// TokenIPBindingSubnet: any IP in the same /24 (IPv4) or /64 (IPv6).
+	TokenIPBindingSubnet = "subnet"
+	// TokenIPBindingOff: any IP.
+	TokenIPBindingOff = "off"
+)
+
+const (
+	defaultAuthTokenTTL    = 10 * time.Minute
+	defaultAuthRateWindow  = 10 * time.Second
+	defaultAuthRateMax     = 5
+	defaultAuthSweepPeriod = 60 * time.Second
+	// revokedTokenTTL is how long an expired or invalidated token is still
+	// recognised, so the client learns why it stopped working.
+	revokedTokenTTL = 24 * time.Hour
+)
+
+type authTokenEntry struct {
+	ExpiresAt time.Time
+	ClientIP  string
+	PassHash  [32]byte
+	// roamed holds the other addresses already logged as using the token.
+	roamed map[string]bool
+}
+
+// authResult is the outcome of validating a token.
+type authResult int
+
+const (
+	authOK authResult = iota
+	// authUnknown: no token, or one this server never issued (or forgot).
+	authUnknown
+	authExpired
+	// authPassChanged: the access pass changed after the token was issued.
+	authPassChanged
+	// authIPMismatch: the token was issued to another client IP.
+	authIPMismatch
+)
+
+// code and message are what requireAuth puts in its 401 body. Clients can
+// re-auth silently on AUTH_EXPIRED but must ask for the pass otherwise.
+func (r authResult) code() string {
+	switch r {
+	case authExpired:
+		return "AUTH_EXPIRED"
+	case authPassChanged:
+		return "AUTH_PASS_CHANGED"
+	case authIPMismatch:
+		return "AUTH_IP_MISMATCH"
+	}
+	return "AUTH_REQUIRED"
+}
+
+func (r authResult) message() string {
+	switch r {
+	case authExpired:
+		return "登录已过期"
+	case authPassChanged:
+		return "访问口令已更改"
+	case authIPMismatch:
+		return "网络地址已变化，请重新验证"
+	}
+	return "鉴权失败"
+}
+
+// linkTokenEntry is a read-only token embedded in generated download links.
+// It only opens /api/download for files under Dir ("" is the whole share).
+type linkTokenEntry struct {
+	ExpiresAt time.Time
+	PassHash  [32]byte
+	Dir       string
+	// Recursive is false for a manifest of Dir's own files: the token then
+	// doesn't cover its subfolders.
+	Recursive bool
+}
+
+// entryTokenEntry is a one-time token embedded in a folder link (FolderURL).
+// Redeeming it at /api/auth yields a normal token, so the link opens without
+// typing the access pass.
+type entryTokenEntry struct {
+	ExpiresAt time.Time
+	PassHash  [32]byte
+}
+
+type revokedToken struct {
+	reason authResult
+	at     time.Time
+}
+
+type rateWindowState struct {
+	WindowStart time.Time
+	Count       int
+}
+
+// authConfig is the tunable part of authManager.
+type authConfig struct {
+	tokenTTL   time.Duration
+	rateWindow time.Duration
+	rateMax    int
+	ipBinding  string
+}
+
+// authConfig reads the auth settings, keeping today's values as defaults.
+func (s *Server) authConfig() authConfig {
+	return authConfig{
+		tokenTTL:   time.Duration(s.getIntSetting(SettingKeyTokenTTLMinutes, int(defaultAuthTokenTTL/time.Minute), 1, 7*24*60)) * time.Minute,
+		rateWindow: time.Duration(s.getIntSetting(SettingKeyAuthRateWindowSeconds, int(defaultAuthRateWindow/time.Second), 1, 3600)) * time.Second,
+		rateMax:    s.getIntSetting(SettingKeyAuthRateMaxRequests, defaultAuthRateMax, 1, 1000),
+		ipBinding:  s.getTokenIPBinding(),
+	}
+}
+
+func (s *Server) getTokenIPBinding() string {
+	if s.settings == nil {
+		return TokenIPBindingStrict
+	}
+	raw, ok, err := s.settings.Get(SettingKeyTokenIPBinding)
+	if err != nil || !ok || len(raw) == 0 {
+		return TokenIPBindingStrict
+	}
+	var v string
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return TokenIPBindingStrict
+	}
+	switch v = strings.ToLower(strings.TrimSpace(v)); v {
+	case TokenIPBindingSubnet, TokenIPBindingOff:
+		return v
+	}
+	return TokenIPBindingStrict
+}
+
+func (s *Server) onAuthSettingChanged(key string, _ json.RawMessage) {
+	switch key {
+	case SettingKeyTokenTTLMinutes, SettingKeyAuthRateWindowSeconds, SettingKeyAuthRateMaxRequests, SettingKeyTokenIPBinding:
+		s.auth.configure(s.authConfig())
+	}
+}
+
+// authManager issues and validates access tokens and rate-limits guesses
+// (access pass and short code) per client IP. now is replaced in tests.
+type authManager struct {
+	mu  sync.Mutex
+	now func() time.Time
+	// logf records tokens used from a different but allowed address.
+	logf func(format string, args ...any)
+
+	tokenTTL    time.Duration
+	renewBefore time.Duration
+	rateWindow  time.Duration
+	rateMax     int
+	ipBinding   string
+	// sweepPeriod is how often expired tokens and stale rate windows are dropped.
+	sweepPeriod time.Duration
+
+	tokens map[string]authTokenEntry
+	links  map[string]linkTokenEntry
+	// entries are the unredeemed one-time tokens of folder links.
+	entries map[string]entryTokenEntry
+	// revoked remembers why recently dropped tokens stopped working.
+	revoked    map[string]revokedToken
+	rateByIP   map[string]rateWindowState
+	lastSweep  time.Time
+	lastRateGC time.Time
+}
+
+func newAuthManager(now func() time.Time) *authManager {
+	m := &authManager{
+		now:         now,
+		sweepPeriod: defaultAuthSweepPeriod,
+		tokens:      map[string]authTokenEntry{},
+		links:       map[string]linkTokenEntry{},
+		entries:     map[string]entryTokenEntry{},
+		revoked:     map[string]revokedToken{},
+		rateByIP:    map[string]rateWindowState{},
+	}
+	m.configure(authConfig{tokenTTL: defaultAuthTokenTTL, rateWindow: defaultAuthRateWindow, rateMax: defaultAuthRateMax, ipBinding: TokenIPBindingStrict})
+	return m
+}
+
+func (m *authManager) configure(cfg authConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokenTTL = cfg.tokenTTL
+	// Renew during the last fifth of the lifetime (2 of 10 minutes by default).
+	m.renewBefore = cfg.tokenTTL / 5
+	m.rateWindow = cfg.rateWindow
+	m.rateMax = cfg.rateMax
+	m.ipBinding = cfg.ipBinding
+}
+
+// retryAfter is the Retry-After value, in seconds, for a rate-limited client.
+func (m *authManager) retryAfter() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return int(m.rateWindow.Seconds())
+}
+
+// allow counts one guess from ip and reports whether it is within the limit.
+func (m *authManager) allow(ip string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	allowed := m.rateAllowedLocked(ip, now)
+	m.rateGCLocked(now)
+	return allowed
+}
+
+func (m *authManager) rateAllowedLocked(ip string, now time.Time) bool {
+	st := m.rateByIP[ip]
+	if st.WindowStart.IsZero() || now.Sub(st.WindowStart) >= m.rateWindow {
+		st.WindowStart = now
+		st.Count = 0
+	}
+	if st.Count >= m.rateMax {
+		m.rateByIP[ip] = st
+		return false
+	}
+	st.Count++
+	m.rateByIP[ip] = st
+	return true
+}
+
+func (m *authManager) rateGCLocked(now time.Time) {
+	if now.Sub(m.lastRateGC) < m.sweepPeriod {
+		return
+	}
+	m.lastRateGC = now
+	for ip, st := range m.rateByIP {
+		if st.WindowStart.IsZero() {
+			delete(m.rateByIP, ip)
+			continue
+		}
+		if now.Sub(st.WindowStart) > 5*m.rateWindow {
+			delete(m.rateByIP, ip)
+		}
+	}
+}
+
+func (m *authManager) sweepLocked(now time.Time) {
+	if now.Sub(m.lastSweep) < m.sweepPeriod {
+		return
+	}
+	m.lastSweep = now
+	for k, v := range m.tokens {
+		if now.After(v.ExpiresAt) {
+			m.revokeLocked(k, authExpired, now)
+		}
+	}
+	for k, v := range m.links {
+		if now.After(v.ExpiresAt) {
+			delete(m.links, k)
+		}
+	}
+	for k, v := range m.entries {
+		if now.After(v.ExpiresAt) {
+			delete(m.entries, k)
+		}
+	}
+	for k, v := range m.revoked {
+		if now.Sub(v.at) > revokedTokenTTL {
+			delete(m.revoked, k)
+		}
+	}
+}
+
+func (m *authManager) revokeLocked(token string, reason authResult, now time.Time) {
+	delete(m.tokens, token)
+	m.revoked[token] = revokedToken{reason: reason, at: now}
+}
+
+// revokeAll drops every issued token, e.g. when the host sets the pass again.
+func (m *authManager) revokeAll(reason authResult) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	for k := range m.tokens {
+		m.revokeLocked(k, reason, now)
+	}
+	clear(m.links)
+	clear(m.entries)
+}
+
+func accessPassHash(pass string) [32]byte {
+	// Token invalidation: when access pass changes, the hash changes,
+	// making previously issued tokens invalid.
+	return sha256.Sum256([]byte(pass))
+}
+
+// issue creates a token bound to ip and the current access pass. It returns
+// the token's lifetime along with it.
+func (m *authManager) issue(ip string, passHash [32]byte) (string, time.Duration, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", 0, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.tokens[token] = authTokenEntry{ExpiresAt: now.Add(m.tokenTTL), ClientIP: ip, PassHash: passHash}
+	m.sweepLocked(now)
+	return token, m.tokenTTL, nil
+}
+
+// validate checks token against ip and the current access pass, extending it
+// when it is close to expiry.
+func (m *authManager) validate(token string, ip string, passHash [32]byte) authResult {
+	if token == "" {
+		return authUnknown
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.sweepLocked(now)
+	entry, ok := m.tokens[token]
+	if !ok {
+		if r, ok := m.revoked[token]; ok {
+			return r.reason
+		}
+		return authUnknown
+	}
+	if now.After(entry.ExpiresAt) {
+		m.revokeLocked(token, authExpired, now)
+		return authExpired
+	}
+	if subtle.ConstantTimeCompare(entry.PassHash[:], passHash[:]) != 1 {
+		m.revokeLocked(token, authPassChanged, now)
+		return authPassChanged
+	}
+	// IP binding reduces replay across clients. A mismatch keeps the token
+	// valid for its own address.
+	if entry.ClientIP != "" && ip != "" && entry.ClientIP != ip {
+		if !ipBindingAllows(m.ipBinding, entry.ClientIP, ip) {
+			return authIPMismatch
+		}
+		if !entry.roamed[ip] {
+			if entry.roamed == nil {
+				entry.roamed = map[string]bool{}
+				m.tokens[token] = entry
+			}
+			entry.roamed[ip] = true
+			if m.logf != nil {
+				m.logf("auth token issued to %s used from %s (ip binding %s)", entry.ClientIP, ip, m.ipBinding)
+			}
+		}
+	}
+	if entry.ExpiresAt.Sub(now) <= m.renewBefore {
+		entry.ExpiresAt = now.Add(m.tokenTTL)
+		m.tokens[token] = entry
+	}
+	return authOK
+}
+
+// issueLink creates a link token for files under dir (only those directly in
+// it unless recursive), valid for ttl and until the access pass changes. It isn't bound to an IP: the links are meant
+// for download managers, which may not share the browser's address.
+func (m *authManager) issueLink(dir string, recursive bool, passHash [32]byte, ttl time.Duration) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.links[token] = linkTokenEntry{ExpiresAt: now.Add(ttl), PassHash: passHash, Dir: cleanSharePath(dir), Recursive: recursive}
+	m.sweepLocked(now)
+	return token, nil
+}
+
+// validateLink reports whether token is a live link token covering file,
+// and the folder it was issued for.
+func (m *authManager) validateLink(token string, file string, passHash [32]byte) (string, bool) {
+	if token == "" {
+		return "", false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.sweepLocked(now)
+	entry, ok := m.links[token]
+	if !ok {
+		return "", false
+	}
+	if now.After(entry.ExpiresAt) {
+		delete(m.links, token)
+		return "", false
+	}
+	if subtle.ConstantTimeCompare(entry.PassHash[:], passHash[:]) != 1 {
+		delete(m.links, token)
+		return "", false
+	}
+	file = cleanSharePath(file)
+	if !entry.Recursive {
+		parent := path.Dir(file)
+		if parent == "." {
+			parent = ""
+		}
+		return entry.Dir, file != "" && parent == entry.Dir
+	}
+	return entry.Dir, entry.Dir == "" || file == entry.Dir || strings.HasPrefix(file, entry.Dir+"/")
+}
+
+// expiresIn is how long a valid token has left; 0 for anything else.
+func (m *authManager) expiresIn(token string) time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.tokens[token]
+	if !ok {
+		return 0
+	}
+	return max(entry.ExpiresAt.Sub(m.now()), 0)
+}
+
+// ipBindingAllows reports whether a token issued to issuedTo may be used from
+// ip under the given binding mode.
+func ipBindingAllows(mode, issuedTo, ip string) bool {
+	switch mode {
+	case TokenIPBindingOff:
+		return true
+	case TokenIPBindingSubnet:
+		return sameSubnet(issuedTo, ip)
+	}
+	return issuedTo == ip
+}
+
+// sameSubnet compares the /24 of IPv4 or the /64 of IPv6 addresses.
+// IPv4-mapped IPv6 addresses count as IPv4; mixed families never match.
+func sameSubnet(a, b string) bool {
+	pa, err := netip.ParseAddr(a)
+	if err != nil {
+		return false
+	}
+	pb, err := netip.ParseAddr(b)
+	if err != nil {
+		return false
+	}
+	pa, pb = pa.Unmap().WithZone(""), pb.Unmap().WithZone("")
+	if pa.Is4() != pb.Is4() {
+		return false
+	}
+	bits := 64
+	if pa.Is4() {
+		bits = 24
+	}
+	na, _ := pa.Prefix(bits)
+	nb, _ := pb.Prefix(bits)
+	return na == nb
+}
+
+// issueEntry creates a one-time token for a folder link, valid for ttl.
+func (m *authManager) issueEntry(passHash [32]byte, ttl time.Duration) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.entries[token] = entryTokenEntry{ExpiresAt: now.Add(ttl), PassHash: passHash}
+	m.sweepLocked(now)
+	return token, nil
+}
+
+// redeemEntry uses up token and reports whether it was valid.
+func (m *authManager) redeemEntry(token string, passHash [32]byte) bool {
+	if token == "" {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.sweepLocked(now)
+	entry, ok := m.entries[token]
+	if !ok {
+		return false
+	}
+	delete(m.entries, token)
+	return !now.After(entry.ExpiresAt) && subtle.ConstantTimeCompare(entry.PassHash[:], passHash[:]) == 1
+}
@@ -0,0 +1,169 @@
+package shareserver
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// Optional proof-of-work in front of /api/auth, for networks where an
+// attacker controls many addresses and the per-IP limiter isn't enough.
+// While SettingKeyAuthChallenge is on and more than
+// SettingKeyAuthChallengeThreshold wrong passes were tried in the last minute
+// (from any address), a pass is only checked together with a solved challenge:
+// a nonce such that sha256(prefix + ":" + nonce) starts with difficulty zero
+// bits. Solved attempts skip the per-IP limiter.
+const (
+	SettingKeyAuthChallenge           = "local-share:auth-challenge"
+	SettingKeyAuthChallengeDifficulty = "local-share:auth-challenge-difficulty"
+	SettingKeyAuthChallengeThreshold  = "local-share:auth-challenge-threshold"
+)
+
+const (
+	defaultAuthChallengeDifficulty = 16
+	defaultAuthChallengeThreshold  = 20
+	// authFailureWindow is what the threshold counts failures over.
+	authFailureWindow = time.Minute
+	// authChallengeTTL is how long an issued prefix can be answered.
+	authChallengeTTL = 2 * time.Minute
+	// maxAuthChallenges bounds the outstanding prefixes; the oldest go first.
+	maxAuthChallenges = 4096
+	maxAuthFailures   = 10001
+)
+
+// authChallenge is what a 428 AUTH_CHALLENGE answer asks the client to solve.
+type authChallenge struct {
+	Prefix     string `json:"prefix"`
+	Difficulty int    `json:"difficulty"`
+}
+
+// authChallengeSolution is echoed back in the /api/auth body.
+type authChallengeSolution struct {
+	Prefix string `json:"prefix"`
+	Nonce  string `json:"nonce"`
+}
+
+type issuedChallenge struct {
+	difficulty int
+	expiresAt  time.Time
+}
+
+// authChallenges counts failed passes and keeps the outstanding challenges.
+// Each prefix can be used once, whether or not the pass was right.
+type authChallenges struct {
+	mu       sync.Mutex
+	now      func() time.Time
+	failures []time.Time
+	issued   map[string]issuedChallenge
+	order    []string
+}
+
+func newAuthChallenges(now func() time.Time) *authChallenges {
+	return &authChallenges{now: now, issued: map[string]issuedChallenge{}}
+}
+
+// authChallengeConfig returns whether challenges are on and, if so, the
+// failure threshold and difficulty.
+func (s *Server) authChallengeConfig() (enabled bool, threshold int, difficulty int) {
+	if !s.getBoolSetting(SettingKeyAuthChallenge) {
+		return false, 0, 0
+	}
+	return true,
+		s.getIntSetting(SettingKeyAuthChallengeThreshold, defaultAuthChallengeThreshold, 1, maxAuthFailures-1),
+		s.getIntSetting(SettingKeyAuthChallengeDifficulty, defaultAuthChallengeDifficulty, 8, 24)
+}
+
+// recordFailure counts one wrong pass.
+func (c *authChallenges) recordFailure() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	c.pruneFailuresLocked(now)
+	c.failures = append(c.failures, now)
+}
+
+// active reports whether more than threshold failures happened in the window.
+func (c *authChallenges) active(threshold int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pruneFailuresLocked(c.now())
+	return len(c.failures) > threshold
+}
+
+func (c *authChallenges) pruneFailuresLocked(now time.Time) {
+	i := 0
+	for i < len(c.failures) && now.Sub(c.failures[i]) >= authFailureWindow {
+		i++
+	}
+	c.failures = c.failures[i:]
+	// Bound memory under a flood: one more than the largest threshold.
+	if len(c.failures) > maxAuthFailures {
+		c.failures = c.failures[len(c.failures)-maxAuthFailures:]
+	}
+}
+
+// issue returns a fresh challenge of the given difficulty.
+func (c *authChallenges) issue(difficulty int) (authChallenge, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return authChallenge{}, err
+	}
+	prefix := base64.RawURLEncoding.EncodeToString(b)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	c.gcLocked(now)
+	for len(c.order) >= maxAuthChallenges {
+		delete(c.issued, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.issued[prefix] = issuedChallenge{difficulty: difficulty, expiresAt: now.Add(authChallengeTTL)}
+	c.order = append(c.order, prefix)
+	return authChallenge{Prefix: prefix, Difficulty: difficulty}, nil
+}
+
+// verify consumes sol's prefix and reports whether the nonce solves it.
+// Unknown, expired and already used prefixes fail.
+func (c *authChallenges) verify(sol *authChallengeSolution) bool {
+	if sol == nil || sol.Prefix == "" || sol.Nonce == "" || len(sol.Nonce) > 64 {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	c.gcLocked(now)
+	ch, ok := c.issued[sol.Prefix]
+	if !ok {
+		return false
+	}
+	delete(c.issued, sol.Prefix)
+	return leadingZeroBits(sha256.Sum256([]byte(sol.Prefix+":"+sol.Nonce))) >= ch.difficulty
+}
+
+func (c *authChallenges) gcLocked(now time.Time) {
+	i := 0
+	for i < len(c.order) {
+		ch, ok := c.issued[c.order[i]]
+		if ok && now.Before(ch.expiresAt) {
+			break
+		}
+		delete(c.issued, c.order[i])
+		i++
+	}
+	c.order = c.order[i:]
+}
+
+func leadingZeroBits(sum [32]byte) int {
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
@@ -0,0 +1,102 @@
+package shareserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// SettingKeyBasePath (JSON string, e.g. "/share") mounts the web UI and the
+// API under a URL prefix, for reverse proxies that forward
+// https://home.example/share/ as is. Empty means the root, as before.
+const SettingKeyBasePath = "local-share:base-path"
+
+var errInvalidBasePath = errors.New("子路径只能包含字母、数字和 -._~/，且不能包含 . 或 .. 段")
+
+// normalizeBasePath turns "share/", "/share" or " /a/b/ " into "/share" or
+// "/a/b"; "" and "/" mean no prefix. Only unreserved URL characters are
+// allowed, so the result can go into HTML and JS without escaping.
+func normalizeBasePath(p string) (string, error) {
+	p = strings.Trim(strings.TrimSpace(p), "/")
+	if p == "" {
+		return "", nil
+	}
+	for _, seg := range strings.Split(p, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return "", errInvalidBasePath
+		}
+		for _, c := range seg {
+			ok := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+				c == '-' || c == '.' || c == '_' || c == '~'
+			if !ok {
+				return "", errInvalidBasePath
+			}
+		}
+	}
+	return "/" + p, nil
+}
+
+// basePath returns the configured prefix ("" for none). An invalid setting is
+// ignored rather than making the share unreachable.
+func (s *Server) basePath() string {
+	if s.settings == nil {
+		return ""
+	}
+	raw, ok, err := s.settings.Get(SettingKeyBasePath)
+	if err != nil || !ok || len(raw) == 0 {
+		return ""
+	}
+	var v string
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return ""
+	}
+	p, err := normalizeBasePath(v)
+	if err != nil {
+		return ""
+	}
+	return p
+}
+
+type basePathKey struct{}
+
+// requestBasePath is the prefix r was routed through ("" for none).
+func requestBasePath(r *http.Request) string {
+	base, _ := r.Context().Value(basePathKey{}).(string)
+	return base
+}
+
+// underBasePath wraps a handler registered on mux. Without a prefix it is h
+// unchanged. With one (read per request, so a change applies without a
+// restart) a request that hasn't been routed yet must start with the prefix:
+// it is stripped and the request goes through mux again, so every route is
+// available under the prefix and nowhere else. The bare prefix redirects to
+// prefix + "/" so the UI's relative asset URLs resolve.
+func (s *Server) underBasePath(mux *http.ServeMux, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, routed := r.Context().Value(basePathKey{}).(string); routed {
+			h(w, r)
+			return
+		}
+		base := s.basePath()
+		if base == "" {
+			h(w, r)
+			return
+		}
+		if r.URL.Path == base {
+			target := base + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusFound)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, base+"/") {
+			http.NotFound(w, r)
+			return
+		}
+		r = r.WithContext(context.WithValue(r.Context(), basePathKey{}, base))
+		http.StripPrefix(base, mux).ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,371 @@
+package shareserver
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Checksum sidecars are "<name>.sha256" files next to shared files, in the
+// format sha256sum writes ("<hex>  <name>"), so recipients can check a
+// download with `sha256sum -c`. A sidecar only counts while it is at least as
+// new as its file and is the one GenerateChecksums wrote; anything else is
+// ignored and rewritten.
+const checksumSidecarExt = ".sha256"
+
+// checksumProgressInterval is how often GenerateChecksums reports progress.
+const checksumProgressInterval = 200 * time.Millisecond
+
+// ChecksumProgress is reported while GenerateChecksums runs; the last report
+// has Done set. Files and bytes only count what needs hashing: files whose
+// sidecar is up to date are in UpToDate instead, which makes a canceled run
+// cheap to restart.
+type ChecksumProgress struct {
+	// Path is the share-relative selection.
+	Path       string `json:"path"`
+	Files      int    `json:"files"`
+	TotalFiles int    `json:"totalFiles"`
+	Bytes      int64  `json:"bytes"`
+	TotalBytes int64  `json:"totalBytes"`
+	UpToDate   int    `json:"upToDate"`
+	// Failed counts files that couldn't be read, or that changed while being
+	// hashed, and sidecars that couldn't be written.
+	Failed int `json:"failed"`
+	// Current is the share-relative file being hashed.
+	Current  string `json:"current,omitempty"`
+	Done     bool   `json:"done"`
+	Canceled bool   `json:"canceled"`
+}
+
+func isChecksumSidecar(name string) bool {
+	return len(name) > len(checksumSidecarExt) && strings.EqualFold(filepath.Ext(name), checksumSidecarExt)
+}
+
+// checksumSidecars remembers the sidecars GenerateChecksums wrote, with the
+// size and mtime each had then. Only those are trusted: a guest who may
+// upload could otherwise plant a "<name>.sha256" with a forged sum.
+type checksumSidecars struct {
+	mu    sync.Mutex
+	files map[string]sidecarStamp
+}
+
+type sidecarStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+func (c *checksumSidecars) remember(path string, st os.FileInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.files == nil {
+		c.files = map[string]sidecarStamp{}
+	}
+	c.files[path] = sidecarStamp{size: st.Size(), modTime: st.ModTime()}
+}
+
+// trusted reports whether the sidecar at path is still the one written.
+func (c *checksumSidecars) trusted(path string, st os.FileInfo) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stamp, ok := c.files[path]
+	return ok && stamp.size == st.Size() && stamp.modTime.Equal(st.ModTime())
+}
+
+// readChecksumSidecar returns the sum recorded next to path, if the host
+// wrote that sidecar, it is up to date for st and names path (or no file at
+// all).
+func (s *Server) readChecksumSidecar(path string, st os.FileInfo) ([32]byte, bool) {
+	var sum [32]byte
+	side, err := os.Lstat(path + checksumSidecarExt)
+	if err != nil || !side.Mode().IsRegular() || side.Size() > 4096 || side.ModTime().Before(st.ModTime()) {
+		return sum, false
+	}
+	if !s.sidecars.trusted(path+checksumSidecarExt, side) {
+		return sum, false
+	}
+	b, err := os.ReadFile(path + checksumSidecarExt)
+	if err != nil {
+		return sum, false
+	}
+	line, _, _ := strings.Cut(string(b), "\n")
+	hexSum, name, _ := strings.Cut(strings.TrimSpace(line), " ")
+	// "*" marks binary mode in sha256sum output.
+	name = strings.TrimLeft(name, " *")
+	if name != "" && name != filepath.Base(path) {
+		return sum, false
+	}
+	raw, err := hex.DecodeString(hexSum)
+	if err != nil || len(raw) != len(sum) {
+		return sum, false
+	}
+	copy(sum[:], raw)
+	return sum, true
+}
+
+// writeChecksumSidecar replaces the sidecar of path through a temp file, so
+// a reader never sees half a line.
+func writeChecksumSidecar(path string, sum [32]byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".localshare-sha256-*")
+	if err != nil {
+		return err
+	}
+	_, werr := fmt.Fprintf(tmp, "%x  %s\n", sum, filepath.Base(path))
+	if cerr := tmp.Close(); werr == nil {
+		werr = cerr
+	}
+	if werr == nil {
+		werr = os.Rename(tmp.Name(), path+checksumSidecarExt)
+	}
+	if werr != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return werr
+}
+
+// ctxReader stops a long hash when ctx is done and counts what was read.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+	n   func(int)
+}
+
+func (c ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := c.r.Read(p)
+	if c.n != nil && n > 0 {
+		c.n(n)
+	}
+	return n, err
+}
+
+// sha256FileContext hashes path, calling read with the bytes consumed.
+func sha256FileContext(ctx context.Context, path string, read func(int)) ([32]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	defer f.Close()
+	return sha256Reader(ctxReader{ctx: ctx, r: f, n: read})
+}
+
+type checksumTarget struct {
+	path string
+	st   os.FileInfo
+}
+
+// checksumTargets lists the files of the selection fullPath: the file
+// itself, the folder's files, or with recursive everything below it.
+// Sidecars, links and hidden entries are left out.
+func (s *Server) checksumTargets(ctx context.Context, fullPath string, recursive bool) ([]checksumTarget, error) {
+	st, err := os.Stat(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	if !st.IsDir() {
+		if isChecksumSidecar(st.Name()) || !st.Mode().IsRegular() {
+			return nil, errors.New("不能为校验文件生成校验文件")
+		}
+		return []checksumTarget{{fullPath, st}}, nil
+	}
+	rules := s.hiddenRules()
+	var out []checksumTarget
+	err = filepath.WalkDir(fullPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if d != nil && d.IsDir() && p != fullPath {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if p == fullPath {
+			return nil
+		}
+		if isHiddenPath(filepath.Dir(p), d.Name(), rules) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if !recursive {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || isChecksumSidecar(d.Name()) {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			out = append(out, checksumTarget{p, info})
+		}
+		return nil
+	})
+	return out, err
+}
+
+// GenerateChecksums writes a sha256 sidecar next to every file of the
+// selection relPath (a file, or a folder's files; with recursive, every file
+// below it), skipping files whose sidecar is already up to date. progress is
+// called at most every checksumProgressInterval and once more at the end.
+// Canceling ctx stops it between reads; finished sidecars are kept, so
+// running it again picks up where it stopped.
+func (s *Server) GenerateChecksums(ctx context.Context, relPath string, recursive bool, progress func(ChecksumProgress)) (ChecksumProgress, error) {
+	s.mu.RLock()
+	root := s.sharedRoot
+	s.mu.RUnlock()
+	fullPath, err := s.resolveSharedPath(relPath)
+	if err != nil {
+		return ChecksumProgress{}, err
+	}
+	res := ChecksumProgress{Path: relativeSharePath(root, fullPath)}
+	finish := func() (ChecksumProgress, error) {
+		res.Current = ""
+		res.Done = true
+		res.Canceled = ctx.Err() != nil
+		if progress != nil {
+			progress(res)
+		}
+		return res, nil
+	}
+
+	targets, err := s.checksumTargets(ctx, fullPath, recursive)
+	if err != nil {
+		if ctx.Err() != nil {
+			return finish()
+		}
+		return res, err
+	}
+	var todo []checksumTarget
+	for _, t := range targets {
+		if _, ok := s.readChecksumSidecar(t.path, t.st); ok {
+			res.UpToDate++
+			continue
+		}
+		todo = append(todo, t)
+		res.TotalFiles++
+		res.TotalBytes += t.st.Size()
+	}
+
+	lastReport := time.Time{}
+	report := func(force bool) {
+		if progress != nil && (force || time.Since(lastReport) >= checksumProgressInterval) {
+			lastReport = time.Now()
+			progress(res)
+		}
+	}
+	report(true)
+	for _, t := range todo {
+		if ctx.Err() != nil {
+			break
+		}
+		res.Current = relativeSharePath(root, t.path)
+		report(false)
+		start := res.Bytes
+		sum, err := sha256FileContext(ctx, t.path, func(n int) {
+			res.Bytes += int64(n)
+			report(false)
+		})
+		// Keep Bytes exact when the file was shorter or longer than listed.
+		res.Bytes = start + t.st.Size()
+		if err != nil {
+			if ctx.Err() != nil {
+				res.Bytes = start
+				break
+			}
+			res.Failed++
+			continue
+		}
+		// A file written to while it was hashed gets no (wrong) sidecar.
+		if now, err := os.Stat(t.path); err != nil || now.Size() != t.st.Size() || !now.ModTime().Equal(t.st.ModTime()) {
+			res.Failed++
+			continue
+		}
+		if err := writeChecksumSidecar(t.path, sum); err != nil {
+			s.logf("write checksum %s: %v", t.path, err)
+			res.Failed++
+			continue
+		}
+		if side, err := os.Lstat(t.path + checksumSidecarExt); err == nil {
+			s.sidecars.remember(t.path+checksumSidecarExt, side)
+		}
+		s.uploadHashes.store(filepath.Dir(t.path), filepath.Base(t.path), fileHashEntry{size: t.st.Size(), modTime: t.st.ModTime(), sum: sum})
+		res.Files++
+	}
+	return finish()
+}
+
+type hashResponse struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	// Source is "sidecar" (an up-to-date .sha256 file), "cache" or
+	// "computed".
+	Source string `json:"source"`
+}
+
+// handleHash answers the SHA-256 of a shared file, read from its sidecar
+// when that is up to date, so big files aren't hashed again for every
+// recipient.
+func (s *Server) handleHash(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "仅支持 GET"})
+		return
+	}
+
+	s.mu.RLock()
+	root := s.sharedRoot
+	s.mu.RUnlock()
+	if root == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "服务未启动"})
+		return
+	}
+	if !s.requireAuth(w, r) {
+		return
+	}
+	if !s.requirePermission(w, "read") {
+		return
+	}
+
+	fullPath, ok := s.resolveSharePath(w, r, root, strings.TrimSpace(r.URL.Query().Get("path")))
+	if !ok {
+		return
+	}
+	st, err := os.Stat(fullPath)
+	if err != nil || !st.Mode().IsRegular() {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "文件不存在"})
+		return
+	}
+
+	resp := hashResponse{Path: relativeSharePath(root, fullPath), Size: st.Size()}
+	dir, name := filepath.Dir(fullPath), filepath.Base(fullPath)
+	if sum, ok := s.readChecksumSidecar(fullPath, st); ok {
+		resp.SHA256, resp.Source = hex.EncodeToString(sum[:]), "sidecar"
+	} else if sum, ok := s.uploadHashes.lookup(dir, name, st.Size(), st.ModTime()); ok {
+		resp.SHA256, resp.Source = hex.EncodeToString(sum[:]), "cache"
+	} else {
+		sum, err := sha256FileContext(r.Context(), fullPath, nil)
+		if err != nil {
+			if r.Context().Err() == nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "读取文件失败"})
+			}
+			return
+		}
+		s.uploadHashes.store(dir, name, fileHashEntry{size: st.Size(), modTime: st.ModTime(), sum: sum})
+		resp.SHA256, resp.Source = hex.EncodeToString(sum[:]), "computed"
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,128 @@
+package shareserver
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// SettingKeyTrustedProxies lists reverse proxies (JSON array of IPs/CIDRs)
+// whose X-Forwarded-For / Forwarded headers are believed. Not exposed over HTTP.
+const SettingKeyTrustedProxies = "local-share:trusted-proxies"
+
+// clientIP is the address rate limits, token binding and stats are keyed on.
+// Forwarding headers only count when the direct peer is a trusted proxy;
+// otherwise anyone could pick their own IP by sending one.
+func (s *Server) clientIP(r *http.Request) string {
+	peer := getClientIP(r)
+	trusted := s.trustedProxies()
+	if len(trusted) == 0 {
+		return peer
+	}
+	peerAddr, err := netip.ParseAddr(peer)
+	if err != nil || !isTrustedProxy(peerAddr, trusted) {
+		return peer
+	}
+
+	chain := forwardedForChain(r.Header)
+	// Walk from the nearest hop outwards and stop at the first address we don't
+	// trust: everything left of it may have been written by the client.
+	client := peerAddr
+	for i := len(chain) - 1; i >= 0; i-- {
+		addr, ok := parseForwardedAddr(chain[i])
+		if !ok {
+			break
+		}
+		client = addr
+		if !isTrustedProxy(addr, trusted) {
+			break
+		}
+	}
+	return client.String()
+}
+
+func (s *Server) trustedProxies() []netip.Prefix {
+	if s.settings == nil {
+		return nil
+	}
+	raw, ok, err := s.settings.Get(SettingKeyTrustedProxies)
+	if err != nil || !ok || len(raw) == 0 {
+		return nil
+	}
+	var entries []string
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return nil
+	}
+	out := make([]netip.Prefix, 0, len(entries))
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if p, err := netip.ParsePrefix(e); err == nil {
+			out = append(out, p.Masked())
+			continue
+		}
+		if a, err := netip.ParseAddr(e); err == nil {
+			a = a.Unmap()
+			out = append(out, netip.PrefixFrom(a, a.BitLen()))
+		}
+	}
+	return out
+}
+
+func isTrustedProxy(addr netip.Addr, trusted []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, p := range trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedForChain returns the client chain from X-Forwarded-For, or from the
+// for= parameters of Forwarded (RFC 7239) when there is no X-Forwarded-For.
+// Entries are in header order: original client first, nearest proxy last.
+func forwardedForChain(h http.Header) []string {
+	var chain []string
+	for _, v := range h.Values("X-Forwarded-For") {
+		for _, part := range strings.Split(v, ",") {
+			chain = append(chain, strings.TrimSpace(part))
+		}
+	}
+	if len(chain) > 0 {
+		return chain
+	}
+	for _, v := range h.Values("Forwarded") {
+		for _, elem := range strings.Split(v, ",") {
+			// An element without for= still is a hop; keep it so it stops the walk.
+			hop := ""
+			for _, pair := range strings.Split(elem, ";") {
+				k, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(strings.TrimSpace(k), "for") {
+					hop = strings.Trim(strings.TrimSpace(val), `"`)
+				}
+			}
+			chain = append(chain, hop)
+		}
+	}
+	return chain
+}
+
+// parseForwardedAddr accepts "ip", "ip:port", "[ipv6]" and "[ipv6]:port".
+// Obfuscated identifiers such as "unknown" or "_hidden" are rejected.
+func parseForwardedAddr(v string) (netip.Addr, bool) {
+	v = strings.TrimSpace(v)
+	if a, err := netip.ParseAddr(v); err == nil {
+		return a.Unmap(), true
+	}
+	if host, _, err := net.SplitHostPort(v); err == nil {
+		v = host
+	}
+	v = strings.TrimSuffix(strings.TrimPrefix(v, "["), "]")
+	a, err := netip.ParseAddr(v)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return a.Unmap(), true
+}
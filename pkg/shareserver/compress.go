@@ -0,0 +1,120 @@
+package shareserver
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// gzipMinBytes is the smallest response worth compressing; below it the gzip
+// header and the extra CPU cost more than they save.
+const gzipMinBytes = 1024
+
+// gzipJSON compresses the response of a JSON endpoint when the client accepts
+// gzip and the body reaches gzipMinBytes. Only wrap handlers that answer with
+// small-to-medium JSON: downloads, zips, previews and SSE must stream as-is.
+func gzipJSON(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r) {
+			next(w, r)
+			return
+		}
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		next(gw, r)
+		// Not deferred: after a panic recoverPanics must still be able to
+		// write its own 500 to the untouched response.
+		gw.finish()
+	}
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		// "gzip;q=0" explicitly refuses it.
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(strings.TrimSpace(q), 64); err == nil && v == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipResponseWriter holds the body back until it knows whether it reaches
+// gzipMinBytes, then either starts a gzip stream or writes it unchanged.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	status  int
+	buf     []byte
+	gz      *gzip.Writer
+	decided bool
+}
+
+func (g *gzipResponseWriter) WriteHeader(code int) {
+	if g.status == 0 {
+		g.status = code
+	}
+}
+
+func (g *gzipResponseWriter) Write(p []byte) (int, error) {
+	if g.gz != nil {
+		return g.gz.Write(p)
+	}
+	if g.decided {
+		return g.ResponseWriter.Write(p)
+	}
+	g.buf = append(g.buf, p...)
+	if len(g.buf) >= gzipMinBytes {
+		if err := g.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// decide sends the headers and the buffered body, compressed or not.
+func (g *gzipResponseWriter) decide(compress bool) error {
+	g.decided = true
+	h := g.ResponseWriter.Header()
+	if h.Get("Content-Encoding") != "" {
+		compress = false
+	}
+	if g.status == 0 {
+		g.status = http.StatusOK
+	}
+	buf := g.buf
+	g.buf = nil
+	if compress {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		g.ResponseWriter.WriteHeader(g.status)
+		g.gz = gzip.NewWriter(g.ResponseWriter)
+		_, err := g.gz.Write(buf)
+		return err
+	}
+	g.ResponseWriter.WriteHeader(g.status)
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := g.ResponseWriter.Write(buf)
+	return err
+}
+
+func (g *gzipResponseWriter) finish() {
+	if !g.decided {
+		_ = g.decide(false)
+	}
+	if g.gz != nil {
+		_ = g.gz.Close()
+	}
+}
+
+func (g *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
@@ -0,0 +1,122 @@
+package shareserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// SettingKeyCORSOrigins (JSON array of origins such as
+// "http://localhost:5173" or "chrome-extension://<id>") lets companion apps on
+// those origins call /api. Empty or missing disables CORS: no header is sent
+// and preflights are refused. Only the desktop can change it.
+const SettingKeyCORSOrigins = "local-share:cors-origins"
+
+const (
+	corsAllowMethods = "GET, POST, PUT, DELETE, OPTIONS"
+	corsAllowHeaders = "X-Share-Token, Content-Type, Range, Last-Event-ID, X-Upload-Id, X-Admin-Pass"
+	// corsExposeHeaders are the response headers the web UI itself reads.
+	corsExposeHeaders = "Content-Disposition, Content-Length, Content-Range, Accept-Ranges, X-Estimated-Uncompressed-Size, X-Last-Event-ID, X-Zip-Default-Ignore"
+	corsMaxAgeSeconds = "600"
+)
+
+var errInvalidCORSOrigins = errors.New("跨域来源格式错误，应为 scheme://host[:port]")
+
+// normalizeCORSOrigin returns origin the way browsers send it in the Origin
+// header (lower-case, no path or trailing slash), or "" if it isn't one.
+func normalizeCORSOrigin(origin string) string {
+	u, err := url.Parse(strings.TrimSpace(origin))
+	if err != nil || u.Scheme == "" || u.Host == "" || strings.Contains(u.Host, "*") {
+		return ""
+	}
+	if (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return ""
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host)
+}
+
+func validateCORSOrigins(value json.RawMessage) error {
+	var list []string
+	if err := json.Unmarshal(value, &list); err != nil {
+		return errInvalidCORSOrigins
+	}
+	for _, o := range list {
+		if normalizeCORSOrigin(o) == "" {
+			return errInvalidCORSOrigins
+		}
+	}
+	return nil
+}
+
+// corsOrigins returns the allowed origins, normalized; nil while disabled.
+func (s *Server) corsOrigins() map[string]bool {
+	if s.settings == nil {
+		return nil
+	}
+	raw, ok, err := s.settings.Get(SettingKeyCORSOrigins)
+	if err != nil || !ok {
+		return nil
+	}
+	var list []string
+	if json.Unmarshal(raw, &list) != nil {
+		return nil
+	}
+	var allowed map[string]bool
+	for _, o := range list {
+		if o = normalizeCORSOrigin(o); o != "" {
+			if allowed == nil {
+				allowed = map[string]bool{}
+			}
+			allowed[o] = true
+		}
+	}
+	return allowed
+}
+
+// cors adds CORS headers to /api responses for whitelisted origins and
+// answers their preflight requests. The origin is echoed, never "*", because
+// requests may carry the web UI cookie.
+func (s *Server) cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		p := r.URL.Path
+		if base := s.basePath(); base != "" {
+			p = strings.TrimPrefix(p, base)
+		}
+		if origin == "" || !strings.HasPrefix(p, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		allowed := s.corsOrigins()
+		if allowed == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		ok := allowed[strings.ToLower(origin)]
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if preflight {
+			if !ok {
+				writeJSON(w, http.StatusForbidden, map[string]string{"error": "该来源不允许跨域访问", "code": "CORS_ORIGIN_DENIED"})
+				return
+			}
+			h.Set("Access-Control-Allow-Origin", origin)
+			h.Set("Access-Control-Allow-Credentials", "true")
+			h.Set("Access-Control-Allow-Methods", corsAllowMethods)
+			h.Set("Access-Control-Allow-Headers", corsAllowHeaders)
+			h.Set("Access-Control-Max-Age", corsMaxAgeSeconds)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if ok {
+			h.Set("Access-Control-Allow-Origin", origin)
+			h.Set("Access-Control-Allow-Credentials", "true")
+			h.Set("Access-Control-Expose-Headers", corsExposeHeaders)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,119 @@
+package shareserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// SettingKeyTrashMaxMB (JSON number) is the largest web delete that still goes
+// to the Recycle Bin; SettingKeyTrashTooLarge (JSON string) says what happens
+// to larger ones: "confirm" (default) answers DELETE_TOO_LARGE_FOR_TRASH until
+// the client resends with "permanent": true, "refuse" never deletes them.
+const (
+	SettingKeyTrashMaxMB    = "local-share:trash-max-mb"
+	SettingKeyTrashTooLarge = "local-share:trash-too-large"
+)
+
+// Values of SettingKeyTrashTooLarge.
+const (
+	TrashTooLargeConfirm = "confirm"
+	TrashTooLargeRefuse  = "refuse"
+)
+
+const defaultTrashMaxMB = 20 * 1024
+
+var errInvalidTrashTooLarge = errors.New(`trash-too-large must be "confirm" or "refuse"`)
+
+func (s *Server) trashMaxBytes() int64 {
+	return int64(s.getIntSetting(SettingKeyTrashMaxMB, defaultTrashMaxMB, 1, 1<<30)) << 20
+}
+
+func (s *Server) trashTooLarge() string {
+	if s.settings != nil {
+		if raw, ok, err := s.settings.Get(SettingKeyTrashTooLarge); err == nil && ok {
+			var v string
+			if json.Unmarshal(raw, &v) == nil && v == TrashTooLargeRefuse {
+				return TrashTooLargeRefuse
+			}
+		}
+	}
+	return TrashTooLargeConfirm
+}
+
+func validateTrashTooLarge(raw json.RawMessage) error {
+	var v string
+	if err := json.Unmarshal(raw, &v); err != nil || (v != TrashTooLargeConfirm && v != TrashTooLargeRefuse) {
+		return errInvalidTrashTooLarge
+	}
+	return nil
+}
+
+// selectionSizeOver adds up the regular files under fullPaths (symlinks are
+// not followed) and stops as soon as the total exceeds limit: the answer
+// only needs to be "too large", and walking all of a huge folder is what
+// made these deletes slow in the first place. size is exact when over is
+// false, a lower bound otherwise.
+func selectionSizeOver(ctx context.Context, fullPaths []string, limit int64) (size int64, over bool, err error) {
+	errOver := errors.New("over")
+	for _, full := range fullPaths {
+		err := filepath.WalkDir(full, func(p string, d fs.DirEntry, err error) error {
+			if cerr := ctx.Err(); cerr != nil {
+				return cerr
+			}
+			if err != nil {
+				// Unreadable entries are the delete's problem, not the size's.
+				if d != nil && d.IsDir() && p != full {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			if size += info.Size(); size > limit {
+				return errOver
+			}
+			return nil
+		})
+		if errors.Is(err, errOver) {
+			return size, true, nil
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return size, false, err
+		}
+	}
+	return size, false, nil
+}
+
+// tooLargeForTrashError is the body of a DELETE_TOO_LARGE_FOR_TRASH answer.
+func tooLargeForTrashError(size, limit int64, allowPermanent bool) map[string]any {
+	msg := fmt.Sprintf("所选内容超过 %s，无法移入回收站", trashLimitText(limit))
+	if allowPermanent {
+		msg += "；确认后将永久删除"
+	} else {
+		msg += "，请在电脑上删除"
+	}
+	return map[string]any{
+		"error":          msg,
+		"code":           "DELETE_TOO_LARGE_FOR_TRASH",
+		"sizeAtLeast":    size,
+		"limit":          limit,
+		"allowPermanent": allowPermanent,
+	}
+}
+
+func trashLimitText(limit int64) string {
+	if limit >= 1<<30 {
+		return fmt.Sprintf("%.4g GB", float64(limit)/(1<<30))
+	}
+	return fmt.Sprintf("%d MB", limit>>20)
+}
@@ -0,0 +1,204 @@
+package shareserver
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Download tokens let a browser's own download manager resume a big file or
+// a ready archive job with Range requests after the session token it started
+// with has rotated (Mobile Safari kills long background downloads). They are
+// signed rather than stored, so verifying one never touches the session
+// store, and are bound to the file's path, size and mtime: a changed file
+// invalidates them. The key lives in memory and changes whenever the server
+// starts listening, which invalidates every token handed out before.
+const (
+	// queryDownloadToken carries a download token in /api/download URLs.
+	queryDownloadToken = "dl"
+	// queryWantDownloadToken asks /api/download (and GET
+	// /api/archive-jobs/<id>) for a token instead of the file.
+	queryWantDownloadToken = "downloadToken"
+	// downloadTokenTTL is how long a token keeps working.
+	downloadTokenTTL = 4 * time.Hour
+)
+
+// downloadClaims is the signed part of a download token. Target is a
+// share-relative path or "job:<id>".
+type downloadClaims struct {
+	Target  string `json:"t"`
+	Size    int64  `json:"s"`
+	ModTime int64  `json:"m"`
+	Expires int64  `json:"e"`
+}
+
+// downloadTokenResponse is what ?downloadToken=1 answers.
+type downloadTokenResponse struct {
+	DownloadToken string `json:"downloadToken"`
+	// URL is the /api/download URL with the token, relative to the host.
+	URL       string `json:"url"`
+	ExpiresIn int    `json:"expiresIn"`
+}
+
+type downloadTokens struct {
+	mu  sync.RWMutex
+	key []byte
+	now func() time.Time
+}
+
+func newDownloadTokens(now func() time.Time) *downloadTokens {
+	d := &downloadTokens{now: now}
+	d.rotate()
+	return d
+}
+
+// rotate replaces the signing key.
+func (d *downloadTokens) rotate() {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	d.mu.Lock()
+	d.key = key
+	d.mu.Unlock()
+}
+
+// mac signs payload together with the share root and access pass, so tokens
+// die when either changes.
+func (d *downloadTokens) mac(payload []byte, root string, passHash [32]byte) []byte {
+	d.mu.RLock()
+	h := hmac.New(sha256.New, d.key)
+	d.mu.RUnlock()
+	h.Write(passHash[:])
+	h.Write([]byte(root))
+	h.Write([]byte{0})
+	h.Write(payload)
+	return h.Sum(nil)
+}
+
+// issue returns a token for target in its current state.
+func (d *downloadTokens) issue(target string, st os.FileInfo, root string, passHash [32]byte) string {
+	c := downloadClaims{
+		Target:  target,
+		Size:    st.Size(),
+		ModTime: st.ModTime().UnixNano(),
+		Expires: d.now().Add(downloadTokenTTL).Unix(),
+	}
+	payload, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(d.mac(payload, root, passHash))
+}
+
+// downloadTokenResult is the outcome of parsing a token.
+type downloadTokenResult int
+
+const (
+	downloadTokenOK downloadTokenResult = iota
+	downloadTokenInvalid
+	downloadTokenExpired
+	// downloadTokenStale: the file changed since the token was issued.
+	downloadTokenStale
+)
+
+// verify checks the signature, expiry and target of token.
+func (d *downloadTokens) verify(token string, target string, root string, passHash [32]byte) (downloadClaims, downloadTokenResult) {
+	var c downloadClaims
+	payloadPart, sigPart, ok := strings.Cut(token, ".")
+	if !ok {
+		return c, downloadTokenInvalid
+	}
+	payload, err1 := base64.RawURLEncoding.DecodeString(payloadPart)
+	sig, err2 := base64.RawURLEncoding.DecodeString(sigPart)
+	if err1 != nil || err2 != nil || !hmac.Equal(sig, d.mac(payload, root, passHash)) {
+		return c, downloadTokenInvalid
+	}
+	if err := json.Unmarshal(payload, &c); err != nil || c.Target != target {
+		return c, downloadTokenInvalid
+	}
+	if d.now().Unix() >= c.Expires {
+		return c, downloadTokenExpired
+	}
+	return c, downloadTokenOK
+}
+
+// matches reports whether st is still the file the token was issued for.
+func (c downloadClaims) matches(st os.FileInfo) bool {
+	return st.Size() == c.Size && st.ModTime().UnixNano() == c.ModTime
+}
+
+func (r downloadTokenResult) write(w http.ResponseWriter) {
+	switch r {
+	case downloadTokenExpired:
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "下载链接已过期", "code": "DOWNLOAD_TOKEN_EXPIRED"})
+	case downloadTokenStale:
+		writeJSON(w, http.StatusPreconditionFailed, map[string]string{"error": "文件已变化，请重新下载", "code": "DOWNLOAD_TOKEN_STALE"})
+	default:
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "下载链接无效", "code": "DOWNLOAD_TOKEN_INVALID"})
+	}
+}
+
+// wantsDownloadToken reports whether r asks for a token instead of the file.
+func wantsDownloadToken(r *http.Request) bool {
+	v := r.URL.Query().Get(queryWantDownloadToken)
+	return v == "1" || v == "true"
+}
+
+// downloadPassHash is what download tokens are bound to: the access pass, or
+// nothing while no pass is required.
+func (s *Server) downloadPassHash() ([32]byte, error) {
+	pass, enabled, err := s.getAccessPassFromSettings()
+	if err != nil {
+		return [32]byte{}, err
+	}
+	if !enabled {
+		pass = ""
+	}
+	return accessPassHash(pass), nil
+}
+
+// checkDownloadToken verifies the ?dl= token of r for target. On failure it
+// has already written the error.
+func (s *Server) checkDownloadToken(w http.ResponseWriter, r *http.Request, root string, target string) (downloadClaims, bool) {
+	passHash, err := s.downloadPassHash()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "访问口令配置异常"})
+		return downloadClaims{}, false
+	}
+	c, res := s.downloadTokens.verify(r.URL.Query().Get(queryDownloadToken), target, root, passHash)
+	if res != downloadTokenOK {
+		res.write(w)
+		return c, false
+	}
+	return c, true
+}
+
+// writeDownloadToken answers a ?downloadToken=1 request for target.
+func (s *Server) writeDownloadToken(w http.ResponseWriter, r *http.Request, root string, target string, st os.FileInfo) {
+	passHash, err := s.downloadPassHash()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "访问口令配置异常"})
+		return
+	}
+	token := s.downloadTokens.issue(target, st, root, passHash)
+	q := url.Values{}
+	if job, ok := strings.CutPrefix(target, "job:"); ok {
+		q.Set("job", job)
+	} else {
+		q.Set("path", target)
+	}
+	q.Set(queryDownloadToken, token)
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, downloadTokenResponse{
+		DownloadToken: token,
+		URL:           requestBasePath(r) + "/api/download?" + q.Encode(),
+		ExpiresIn:     int(downloadTokenTTL / time.Second),
+	})
+}
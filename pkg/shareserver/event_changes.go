@@ -0,0 +1,181 @@
+package shareserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// sseHistorySize is how many recent events are kept for replay and polling.
+const sseHistorySize = 256
+
+// changesMaxWaitSeconds caps ?timeout= on /api/changes.
+const changesMaxWaitSeconds = 30
+
+// sseEvent is one broadcast event. IDs count up for the lifetime of the
+// Server, across share restarts.
+type sseEvent struct {
+	ID    uint64          `json:"id"`
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+}
+
+func (e sseEvent) message() []byte {
+	return []byte(fmt.Sprintf("id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Event, e.Data))
+}
+
+// eventHistory is a bounded buffer of recent events. It is guarded by the
+// owning sseHub's mutex.
+type eventHistory struct {
+	events []sseEvent
+	lastID uint64
+	// dropped is the newest ID no longer buffered; asking for anything older
+	// means the caller missed events.
+	dropped uint64
+	// changed is closed on the next add or clear; nil until someone waits.
+	changed chan struct{}
+}
+
+func (h *eventHistory) add(event string, data []byte) sseEvent {
+	h.lastID++
+	ev := sseEvent{ID: h.lastID, Event: event, Data: data}
+	if len(h.events) >= sseHistorySize {
+		h.dropped = h.events[0].ID
+		h.events = append(h.events[:0], h.events[1:]...)
+	}
+	h.events = append(h.events, ev)
+	h.notify()
+	return ev
+}
+
+func (h *eventHistory) clear() {
+	if len(h.events) > 0 {
+		h.dropped = h.lastID
+	}
+	h.events = nil
+	h.notify()
+}
+
+func (h *eventHistory) notify() {
+	if h.changed != nil {
+		close(h.changed)
+		h.changed = nil
+	}
+}
+
+// since returns the buffered events newer than id. reset reports that some
+// events after id are gone (or id is from another server run), so the caller
+// should reload instead of relying on the list.
+func (h *eventHistory) since(id uint64) (events []sseEvent, reset bool) {
+	reset = id < h.dropped || id > h.lastID
+	for _, ev := range h.events {
+		if ev.ID > id {
+			events = append(events, ev)
+		}
+	}
+	return events, reset
+}
+
+func (h *eventHistory) wait() <-chan struct{} {
+	if h.changed == nil {
+		h.changed = make(chan struct{})
+	}
+	return h.changed
+}
+
+// changesSince is eventHistory.since under the hub lock, plus the latest ID
+// and a channel that is closed when anything new arrives.
+func (h *sseHub) changesSince(id uint64) (events []sseEvent, lastID uint64, reset bool, changed <-chan struct{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	events, reset = h.history.since(id)
+	return events, h.history.lastID, reset, h.history.wait()
+}
+
+// lastEventID is the ID an EventSource sends when it reconnects. The query
+// form is for polyfills that can't set headers.
+func lastEventID(r *http.Request) string {
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		return id
+	}
+	return r.URL.Query().Get("lastEventId")
+}
+
+type changesResponse struct {
+	Events      []sseEvent `json:"events"`
+	LastEventID uint64     `json:"lastEventId"`
+	// Reset means events were missed; reload instead of applying Events.
+	Reset bool `json:"reset,omitempty"`
+}
+
+// handleChanges serves the SSE events as JSON for clients without
+// EventSource: GET /api/changes?since=<id>&timeout=<seconds>. With nothing
+// new it answers 204 after up to timeout seconds; X-Last-Event-ID always
+// carries the ID to poll from next. Without since, it starts from now.
+func (s *Server) handleChanges(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "仅支持 GET"})
+		return
+	}
+	if !s.requireAuth(w, r) {
+		return
+	}
+	if !s.requirePermission(w, "read") {
+		return
+	}
+	if s.events == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	q := r.URL.Query()
+	var since uint64
+	hasSince := false
+	if raw := q.Get("since"); raw != "" {
+		v, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "since 参数无效"})
+			return
+		}
+		since, hasSince = v, true
+	}
+	timeout := 0
+	if raw := q.Get("timeout"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "timeout 参数无效"})
+			return
+		}
+		timeout = min(v, changesMaxWaitSeconds)
+	}
+
+	events, lastID, reset, changed := s.events.changesSince(since)
+	if !hasSince {
+		since, events, reset = lastID, nil, false
+	}
+	if len(events) == 0 && !reset && timeout > 0 {
+		timer := time.NewTimer(time.Duration(timeout) * time.Second)
+		defer timer.Stop()
+		select {
+		case <-changed:
+			events, lastID, reset, _ = s.events.changesSince(since)
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Last-Event-ID", strconv.FormatUint(lastID, 10))
+	if len(events) == 0 && !reset {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if events == nil {
+		events = []sseEvent{}
+	}
+	writeJSON(w, http.StatusOK, changesResponse{Events: events, LastEventID: lastID, Reset: reset})
+}
@@ -0,0 +1,39 @@
+package shareserver_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"LocalShare/pkg/shareserver"
+)
+
+// Mount the share API on your own HTTP server instead of calling Start.
+func Example() {
+	dir, _ := os.MkdirTemp("", "share")
+	defer os.RemoveAll(dir)
+	_ = os.WriteFile(filepath.Join(dir, "hello.txt"), []byte("hi"), 0o644)
+
+	srv := shareserver.New(shareserver.Options{Root: dir})
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/files")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Items []shareserver.DirectoryItem `json:"items"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&body)
+	for _, item := range body.Items {
+		fmt.Println(item.Name, item.Type, item.Size)
+	}
+	// Output: hello.txt file 2
+}
@@ -0,0 +1,76 @@
+package shareserver
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Coarse file categories reported on DirectoryItem.Category, so clients pick
+// an icon without keeping their own extension table.
+const (
+	FileCategoryImage    = "image"
+	FileCategoryVideo    = "video"
+	FileCategoryAudio    = "audio"
+	FileCategoryText     = "text"
+	FileCategoryArchive  = "archive"
+	FileCategoryDocument = "document"
+	FileCategoryOther    = "other"
+)
+
+// FileCategories is the full taxonomy, in the order /api/meta reports it.
+var FileCategories = []string{
+	FileCategoryImage,
+	FileCategoryVideo,
+	FileCategoryAudio,
+	FileCategoryText,
+	FileCategoryArchive,
+	FileCategoryDocument,
+	FileCategoryOther,
+}
+
+// Extensions the preview maps don't cover. Images, text and documents come
+// from imagePreviewContentTypes, textPreviewContentTypes and
+// documentContentTypes, so the category can't disagree with handlePreview.
+var (
+	videoExtensions = map[string]bool{
+		".mp4": true, ".m4v": true, ".mov": true, ".mkv": true, ".webm": true,
+		".avi": true, ".wmv": true, ".flv": true, ".3gp": true, ".mpg": true,
+		".mpeg": true,
+	}
+	audioExtensions = map[string]bool{
+		".mp3": true, ".m4a": true, ".aac": true, ".wav": true, ".flac": true,
+		".ogg": true, ".opus": true, ".wma": true, ".amr": true,
+	}
+	archiveExtensions = map[string]bool{
+		".zip": true, ".rar": true, ".7z": true, ".tar": true, ".gz": true,
+		".tgz": true, ".bz2": true, ".tbz2": true, ".xz": true, ".txz": true,
+		".zst": true, ".iso": true, ".dmg": true, ".apk": true,
+	}
+)
+
+// fileCategory returns the category of a file name. Only the last extension
+// matters, which is enough for compound archives: ".tar.gz" ends in ".gz".
+func fileCategory(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == "" {
+		return FileCategoryOther
+	}
+	if _, ok := imagePreviewContentTypes[ext]; ok {
+		return FileCategoryImage
+	}
+	if _, ok := documentContentTypes[ext]; ok {
+		return FileCategoryDocument
+	}
+	switch {
+	case archiveExtensions[ext]:
+		return FileCategoryArchive
+	case videoExtensions[ext]:
+		return FileCategoryVideo
+	case audioExtensions[ext]:
+		return FileCategoryAudio
+	}
+	if _, ok := textPreviewContentTypes[ext]; ok {
+		return FileCategoryText
+	}
+	return FileCategoryOther
+}
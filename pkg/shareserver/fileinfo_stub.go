@@ -0,0 +1,15 @@
+//go:build !windows
+
+package shareserver
+
+import "os"
+
+// fileCreatedTime is unknown here: most Unix filesystems don't expose a
+// birth time through os.FileInfo.
+func fileCreatedTime(_ os.FileInfo) string {
+	return ""
+}
+
+func fileOwner(_ string) string {
+	return ""
+}
@@ -0,0 +1,47 @@
+//go:build windows
+
+package shareserver
+
+import (
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// fileCreatedTime reads the NTFS creation time. Copying a file resets its
+// modified time on some tools but keeps a fresh creation time, which is
+// what users sorting camera dumps actually want.
+func fileCreatedTime(info os.FileInfo) string {
+	d, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok || d == nil {
+		return ""
+	}
+	ns := d.CreationTime.Nanoseconds()
+	if ns <= 0 {
+		return ""
+	}
+	return time.Unix(0, ns).UTC().Format(time.RFC3339)
+}
+
+// fileOwner returns "DOMAIN\user" for the owner of fullPath, or "" when it
+// can't be read (FAT volumes, access denied, orphaned SIDs).
+func fileOwner(fullPath string) string {
+	sd, err := windows.GetNamedSecurityInfo(longPath(fullPath), windows.SE_FILE_OBJECT, windows.OWNER_SECURITY_INFORMATION)
+	if err != nil {
+		return ""
+	}
+	sid, _, err := sd.Owner()
+	if err != nil || sid == nil {
+		return ""
+	}
+	account, domain, _, err := sid.LookupAccount("")
+	if err != nil {
+		return sid.String()
+	}
+	if domain == "" {
+		return account
+	}
+	return domain + `\` + account
+}
@@ -0,0 +1,60 @@
+//go:build windows
+
+package shareserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDirectoryItemCreatedAndOwner(t *testing.T) {
+	tmp := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmp, "new.txt"), []byte("hi"), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	s := newTestShareServerWithSettings(tmp)
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+
+	list := func(target string) []DirectoryItem {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		var resp filesResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode %s: %v", target, err)
+		}
+		if len(resp.Items) != 1 {
+			t.Fatalf("%s: expected 1 item, got %d", target, len(resp.Items))
+		}
+		return resp.Items
+	}
+
+	item := list("/api/files")[0]
+	if item.Created == "" {
+		t.Fatalf("expected a creation time on Windows")
+	}
+	created, err := time.Parse(time.RFC3339, item.Created)
+	if err != nil {
+		t.Fatalf("parse created %q: %v", item.Created, err)
+	}
+	modified, err := time.Parse(time.RFC3339, item.Modified)
+	if err != nil {
+		t.Fatalf("parse modified %q: %v", item.Modified, err)
+	}
+	if created.After(modified) {
+		t.Fatalf("expected created <= modified for a fresh file, got %s > %s", created, modified)
+	}
+	if item.Owner != "" {
+		t.Fatalf("expected no owner without details=1, got %q", item.Owner)
+	}
+
+	if owner := list("/api/files?details=1")[0].Owner; owner == "" {
+		t.Fatalf("expected an owner with details=1")
+	}
+}
@@ -0,0 +1,164 @@
+package shareserver
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// ignoreFileNames are read by zip downloads that set useIgnoreFiles.
+// .localshareignore uses the .gitignore syntax and wins over it.
+var ignoreFileNames = []string{".gitignore", ".localshareignore"}
+
+// ignoreRule is one line of an ignore file.
+type ignoreRule struct {
+	// base is the share-relative directory holding the ignore file ("" for the root).
+	base     string
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+// parseIgnoreFile parses .gitignore syntax: blank lines and "#" comments are
+// skipped, "!" re-includes, a trailing "/" matches directories only, a "/"
+// anywhere else anchors the pattern to base, and "**" spans directories.
+func parseIgnoreFile(data []byte, base string) []ignoreRule {
+	var rules []ignoreRule
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSuffix(sc.Text(), "\r")
+		line = trimIgnoreTrailingSpaces(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r := ignoreRule{base: base}
+		if strings.HasPrefix(line, "!") {
+			r.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		anchored := strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		if !anchored {
+			line = "**/" + line
+		}
+		if runtime.GOOS == "windows" {
+			// Like git's core.ignoreCase default there.
+			line = strings.ToLower(line)
+		}
+		// gitignore negates character classes with "!", path.Match with "^".
+		line = strings.ReplaceAll(line, "[!", "[^")
+		r.segments = strings.Split(line, "/")
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// trimIgnoreTrailingSpaces drops trailing spaces unless escaped with "\".
+func trimIgnoreTrailingSpaces(line string) string {
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-2] + " "
+	}
+	return line
+}
+
+// match reports whether rel (share-relative, slash-separated) is matched.
+func (r ignoreRule) match(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.base != "" {
+		if !strings.HasPrefix(rel, r.base+"/") {
+			return false
+		}
+		rel = rel[len(r.base)+1:]
+	}
+	if runtime.GOOS == "windows" {
+		rel = strings.ToLower(rel)
+	}
+	return matchIgnoreSegments(r.segments, strings.Split(rel, "/"))
+}
+
+func matchIgnoreSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			if len(rest) == 0 {
+				// Trailing "/**": everything inside, but not the directory itself.
+				return len(name) > 0
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchIgnoreSegments(rest, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// ignoreMatcher collects the rules of every ignore file seen during a walk.
+// Later (deeper) files take precedence, and the last matching rule decides.
+type ignoreMatcher struct {
+	rules []ignoreRule
+}
+
+// load reads the ignore files in dir, whose share-relative path is rel.
+func (m *ignoreMatcher) load(dir string, rel string) {
+	for _, name := range ignoreFileNames {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		m.rules = append(m.rules, parseIgnoreFile(data, rel)...)
+	}
+}
+
+// ignored reports whether rel is excluded. Callers walking a tree skip
+// ignored directories, so, as in git, a file can't be re-included when one
+// of its parent directories is excluded; for paths reached directly the
+// parents are checked here.
+func (m *ignoreMatcher) ignored(rel string, isDir bool) bool {
+	if m == nil || len(m.rules) == 0 || rel == "" {
+		return false
+	}
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		if m.matchLast(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return m.matchLast(rel, isDir)
+}
+
+func (m *ignoreMatcher) matchLast(rel string, isDir bool) bool {
+	for i := len(m.rules) - 1; i >= 0; i-- {
+		if m.rules[i].match(rel, isDir) {
+			return !m.rules[i].negate
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package shareserver
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// SettingKeyHiddenRules (JSON object) picks what counts as hidden in listings
+// and zips: {"dotfiles": bool, "hiddenAttr": bool, "systemAttr": bool,
+// "checksums": bool}. The attributes are FILE_ATTRIBUTE_HIDDEN/SYSTEM and only
+// exist on Windows; checksums are the ".sha256" sidecars. Missing fields
+// default to true, except checksums.
+const SettingKeyHiddenRules = "local-share:hidden-rules"
+
+// hiddenRules are the parts of the hidden heuristic that are turned on.
+type hiddenRules struct {
+	Dotfiles   bool
+	HiddenAttr bool
+	SystemAttr bool
+	Checksums  bool
+}
+
+var defaultHiddenRules = hiddenRules{Dotfiles: true, HiddenAttr: true, SystemAttr: true}
+
+type hiddenRulesSetting struct {
+	Dotfiles   *bool `json:"dotfiles"`
+	HiddenAttr *bool `json:"hiddenAttr"`
+	SystemAttr *bool `json:"systemAttr"`
+	Checksums  *bool `json:"checksums"`
+}
+
+var errInvalidHiddenRules = errors.New("invalid hidden rules")
+
+func parseHiddenRules(raw json.RawMessage) (hiddenRules, error) {
+	rules := defaultHiddenRules
+	var input hiddenRulesSetting
+	if err := json.Unmarshal(raw, &input); err != nil {
+		return rules, errInvalidHiddenRules
+	}
+	if input.Dotfiles != nil {
+		rules.Dotfiles = *input.Dotfiles
+	}
+	if input.HiddenAttr != nil {
+		rules.HiddenAttr = *input.HiddenAttr
+	}
+	if input.SystemAttr != nil {
+		rules.SystemAttr = *input.SystemAttr
+	}
+	if input.Checksums != nil {
+		rules.Checksums = *input.Checksums
+	}
+	return rules, nil
+}
+
+// hiddenRules reads SettingKeyHiddenRules; anything unreadable means the
+// defaults.
+func (s *Server) hiddenRules() hiddenRules {
+	if s.settings == nil {
+		return defaultHiddenRules
+	}
+	raw, ok, err := s.settings.Get(SettingKeyHiddenRules)
+	if err != nil || !ok || len(raw) == 0 {
+		return defaultHiddenRules
+	}
+	rules, err := parseHiddenRules(raw)
+	if err != nil {
+		return defaultHiddenRules
+	}
+	return rules
+}
+
+func isHiddenName(name string) bool {
+	return strings.HasPrefix(name, ".") && name != "." && name != ".."
+}
@@ -0,0 +1,7 @@
+//go:build !windows
+
+package shareserver
+
+func isHiddenPath(_ string, name string, rules hiddenRules) bool {
+	return (rules.Dotfiles && isHiddenName(name)) || (rules.Checksums && isChecksumSidecar(name))
+}
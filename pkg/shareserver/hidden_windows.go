@@ -0,0 +1,42 @@
+//go:build windows
+
+package shareserver
+
+import (
+	"path/filepath"
+	"syscall"
+)
+
+func isHiddenPath(dirPath string, name string, rules hiddenRules) bool {
+	// Dotfiles are treated as hidden too.
+	if rules.Dotfiles && isHiddenName(name) {
+		return true
+	}
+	if rules.Checksums && isChecksumSidecar(name) {
+		return true
+	}
+
+	const fileAttributeHidden = 0x2
+	const fileAttributeSystem = 0x4
+	var mask uint32
+	if rules.HiddenAttr {
+		mask |= fileAttributeHidden
+	}
+	if rules.SystemAttr {
+		mask |= fileAttributeSystem
+	}
+	if mask == 0 {
+		return false
+	}
+
+	full := longPath(filepath.Join(dirPath, name))
+	p, err := syscall.UTF16PtrFromString(full)
+	if err != nil {
+		return false
+	}
+	attrs, err := syscall.GetFileAttributes(p)
+	if err != nil {
+		return false
+	}
+	return attrs&mask != 0
+}
@@ -0,0 +1,52 @@
+//go:build windows
+
+package shareserver
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestIsHiddenPathAttributes(t *testing.T) {
+	tmp := t.TempDir()
+	setAttrs := func(name string, attrs uint32) {
+		t.Helper()
+		full := filepath.Join(tmp, name)
+		if err := os.Mkdir(full, 0o755); err != nil {
+			t.Fatalf("mkdir %s: %v", name, err)
+		}
+		p, err := syscall.UTF16PtrFromString(full)
+		if err != nil {
+			t.Fatalf("path %s: %v", name, err)
+		}
+		if err := syscall.SetFileAttributes(p, attrs); err != nil {
+			t.Fatalf("set attributes %s: %v", name, err)
+		}
+		t.Cleanup(func() { _ = syscall.SetFileAttributes(p, syscall.FILE_ATTRIBUTE_DIRECTORY) })
+	}
+	setAttrs("hidden", syscall.FILE_ATTRIBUTE_HIDDEN)
+	setAttrs("system", syscall.FILE_ATTRIBUTE_SYSTEM)
+	setAttrs("plain", syscall.FILE_ATTRIBUTE_DIRECTORY)
+
+	cases := []struct {
+		rules                 hiddenRules
+		hidden, system, plain bool
+	}{
+		{defaultHiddenRules, true, true, false},
+		{hiddenRules{Dotfiles: true, HiddenAttr: true}, true, false, false},
+		{hiddenRules{Dotfiles: true, SystemAttr: true}, false, true, false},
+		{hiddenRules{}, false, false, false},
+	}
+	for _, c := range cases {
+		got := [3]bool{
+			isHiddenPath(tmp, "hidden", c.rules),
+			isHiddenPath(tmp, "system", c.rules),
+			isHiddenPath(tmp, "plain", c.rules),
+		}
+		if want := [3]bool{c.hidden, c.system, c.plain}; got != want {
+			t.Fatalf("rules %+v: got hidden/system/plain %v, want %v", c.rules, got, want)
+		}
+	}
+}
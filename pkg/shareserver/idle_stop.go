@@ -0,0 +1,242 @@
+package shareserver
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// SettingKeyIdleStopMinutes (JSON number) stops sharing after that many
+// minutes nobody used it; 0 or unset keeps sharing. Only the desktop can
+// change it.
+const SettingKeyIdleStopMinutes = "local-share:idle-stop-minutes"
+
+// ShareStopIdle is the serverStopping reason when SettingKeyIdleStopMinutes
+// ran out.
+const ShareStopIdle = "idle"
+
+const (
+	maxIdleStopMinutes = 7 * 24 * 60
+	// defaultIdleCheckInterval is how often a running share looks at its
+	// idle time; minute settings don't need more.
+	defaultIdleCheckInterval = time.Minute
+)
+
+// shareActivity remembers when the share was last used: an authenticated API
+// request, or bytes moving for one. Times are Unix nanoseconds so requests
+// note them without a lock; now is replaced in tests.
+type shareActivity struct {
+	now func() time.Time
+	// since is when the share started; idle time counts from there until
+	// someone shows up.
+	since        atomic.Int64
+	lastRequest  atomic.Int64
+	lastTransfer atomic.Int64
+}
+
+func newShareActivity(now func() time.Time) *shareActivity {
+	a := &shareActivity{now: now}
+	a.reset()
+	return a
+}
+
+// reset starts counting idle time from now, forgetting earlier activity.
+func (a *shareActivity) reset() {
+	a.since.Store(a.now().UnixNano())
+	a.lastRequest.Store(0)
+	a.lastTransfer.Store(0)
+}
+
+func (a *shareActivity) noteRequest() {
+	a.lastRequest.Store(a.now().UnixNano())
+}
+
+func (a *shareActivity) noteTransfer() {
+	a.lastTransfer.Store(a.now().UnixNano())
+}
+
+// last is the latest activity since the reset, zero when there was none.
+func (a *shareActivity) last() time.Time {
+	t := max(a.lastRequest.Load(), a.lastTransfer.Load())
+	if t == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, t)
+}
+
+// idleFor is how long the share has gone unused.
+func (a *shareActivity) idleFor() time.Duration {
+	t := max(a.since.Load(), a.lastRequest.Load(), a.lastTransfer.Load())
+	return a.now().Sub(time.Unix(0, t))
+}
+
+// idleStopAfter is SettingKeyIdleStopMinutes as a duration, 0 when off.
+func (s *Server) idleStopAfter() time.Duration {
+	return time.Duration(s.getIntSetting(SettingKeyIdleStopMinutes, 0, 0, maxIdleStopMinutes)) * time.Minute
+}
+
+// requestActivity lets the bytes of one request count as activity once it
+// has been authenticated, so a stranger hammering the login can't keep an
+// unused share alive.
+type requestActivity struct {
+	counted atomic.Bool
+	note    func()
+}
+
+// activityWriter and activityBody note the bytes of a counted request.
+type activityWriter struct {
+	http.ResponseWriter
+	act *requestActivity
+}
+
+func (aw *activityWriter) Write(p []byte) (int, error) {
+	n, err := aw.ResponseWriter.Write(p)
+	if n > 0 && aw.act.counted.Load() {
+		aw.act.note()
+	}
+	return n, err
+}
+
+func (aw *activityWriter) Flush() {
+	if f, ok := aw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (aw *activityWriter) Unwrap() http.ResponseWriter {
+	return aw.ResponseWriter
+}
+
+type activityBody struct {
+	io.ReadCloser
+	act *requestActivity
+}
+
+func (ab *activityBody) Read(p []byte) (int, error) {
+	n, err := ab.ReadCloser.Read(p)
+	if n > 0 && ab.act.counted.Load() {
+		ab.act.note()
+	}
+	return n, err
+}
+
+// trackActivity wraps each request so its bytes can count as activity; see
+// noteActivity.
+func (s *Server) trackActivity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		act := &requestActivity{note: s.activity.noteTransfer}
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = &activityBody{ReadCloser: r.Body, act: act}
+		}
+		next.ServeHTTP(&activityWriter{ResponseWriter: w, act: act}, r)
+	})
+}
+
+// noteActivity records an authenticated request and lets the bytes it moves
+// from now on count too.
+func (s *Server) noteActivity(w http.ResponseWriter) {
+	s.activity.noteRequest()
+	countActivity(w, true)
+}
+
+// countActivity turns the byte counting of the request answered through w on
+// or off.
+func countActivity(w http.ResponseWriter, on bool) {
+	for w != nil {
+		if aw, ok := w.(*activityWriter); ok {
+			aw.act.counted.Store(on)
+			return
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return
+		}
+		w = u.Unwrap()
+	}
+}
+
+// startIdleCheckLocked starts watching for an unused share; called with s.mu
+// held, stopLocked ends it.
+func (s *Server) startIdleCheckLocked() {
+	s.activity.reset()
+	if s.idleCheckStop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	s.idleCheckStop = stop
+	interval := s.idleCheckInterval
+	if interval <= 0 {
+		interval = defaultIdleCheckInterval
+	}
+	go s.runIdleCheck(stop, interval)
+}
+
+func (s *Server) stopIdleCheckLocked() {
+	if s.idleCheckStop != nil {
+		close(s.idleCheckStop)
+		s.idleCheckStop = nil
+	}
+}
+
+func (s *Server) runIdleCheck(stop <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if s.checkIdle(stop) {
+			return
+		}
+	}
+}
+
+// checkIdle stops the share when it has been unused for longer than
+// SettingKeyIdleStopMinutes, and reports whether it did.
+func (s *Server) checkIdle(stop <-chan struct{}) bool {
+	limit := s.idleStopAfter()
+	if limit <= 0 || s.activity.idleFor() < limit {
+		return false
+	}
+	return s.shareIdle(stop, limit)
+}
+
+// shareIdle stops a share nobody used for limit. Like an expiry, it
+// remembers the share as inactive: it ended on the host's terms.
+func (s *Server) shareIdle(stop <-chan struct{}, limit time.Duration) bool {
+	s.opMu.Lock()
+	s.mu.Lock()
+	select {
+	case <-stop:
+		// Stopped or restarted meanwhile.
+		s.mu.Unlock()
+		s.opMu.Unlock()
+		return false
+	default:
+	}
+	if s.server == nil {
+		s.mu.Unlock()
+		s.opMu.Unlock()
+		return false
+	}
+	root := s.sharedRoot
+	if s.events != nil {
+		s.events.broadcast("serverStopping", map[string]string{"reason": ShareStopIdle})
+	}
+	err := s.stopLocked(context.Background())
+	s.mu.Unlock()
+	if err == nil {
+		s.saveLastShare(LastShare{Root: root, Active: false})
+	}
+	s.opMu.Unlock()
+
+	s.logf("share idle root=%q after=%s stop err=%v", root, limit, err)
+	if s.onShareIdleStopped != nil {
+		s.onShareIdleStopped(root)
+	}
+	return true
+}
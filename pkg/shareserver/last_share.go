@@ -0,0 +1,62 @@
+package shareserver
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// SettingKeyLastShare (JSON LastShare) remembers the last shared folder. It is
+// written only when Options.RememberLastShare is set and, like the access
+// pass, is not exposed over HTTP: it is an absolute path on this machine.
+const SettingKeyLastShare = "local-share:last-share"
+
+// SettingKeyAutoResume (JSON bool) makes the desktop app share the remembered
+// folder again on startup when it was still shared at exit.
+const SettingKeyAutoResume = "local-share:auto-resume"
+
+// LastShare is the most recently shared folder.
+type LastShare struct {
+	Root string `json:"root"`
+	// Active is true unless sharing was stopped explicitly, i.e. it is still
+	// true after the app quit (Shutdown) while sharing.
+	Active bool `json:"active"`
+}
+
+// LastShare returns the remembered share, if any.
+func (s *Server) LastShare() (LastShare, bool) {
+	var last LastShare
+	if s.settings == nil {
+		return last, false
+	}
+	raw, ok, err := s.settings.Get(SettingKeyLastShare)
+	if err != nil || !ok || len(raw) == 0 {
+		return last, false
+	}
+	if err := json.Unmarshal(raw, &last); err != nil || last.Root == "" {
+		return LastShare{}, false
+	}
+	return last, true
+}
+
+func (s *Server) saveLastShare(last LastShare) {
+	if !s.rememberLastShare || s.settings == nil {
+		return
+	}
+	b, err := json.Marshal(last)
+	if err != nil {
+		return
+	}
+	if err := s.settings.Set(SettingKeyLastShare, b); err != nil {
+		s.logf("save last share err=%v", err)
+	}
+}
+
+// Shutdown stops the server like Stop but leaves the remembered share marked
+// active, so it can be resumed on the next start. Use it when the process exits.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.opMu.Lock()
+	defer s.opMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopLocked(ctx)
+}
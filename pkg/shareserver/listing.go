@@ -0,0 +1,170 @@
+package shareserver
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SettingKeyListMaxItems (JSON number) caps how many entries /api/files and
+// /api/path-info return for one folder; larger folders are cut off and flagged
+// "truncated". Streaming listings (?stream=1) are not capped.
+const SettingKeyListMaxItems = "local-share:list-max-items"
+
+const (
+	defaultListMaxItems = 20000
+	// listBatchSize is how many entries are read from the directory at a time,
+	// and how many streamed lines are written between flushes.
+	listBatchSize = 512
+)
+
+// errHostPermissionDenied: the OS won't let the server process read a folder
+// inside the share, so there is nothing a guest can do about it.
+var errHostPermissionDenied = errors.New("主机没有读取此文件夹的权限")
+
+// writeReadDirError answers a failed folder listing: 403
+// HOST_PERMISSION_DENIED when the server process may not read it, else 500.
+func writeReadDirError(w http.ResponseWriter, err error) {
+	if errors.Is(err, fs.ErrPermission) || errors.Is(err, errHostPermissionDenied) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": errHostPermissionDenied.Error(), "code": "HOST_PERMISSION_DENIED"})
+		return
+	}
+	writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "读取文件夹失败"})
+}
+
+func (s *Server) listMaxItems() int {
+	return s.getIntSetting(SettingKeyListMaxItems, defaultListMaxItems, 100, 1000000)
+}
+
+// readDirBatches reads dirPath listBatchSize entries at a time and hands each
+// batch to fn in directory order. It stops early when fn returns false.
+// Entries that vanish between readdir and lstat are skipped.
+func readDirBatches(dirPath string, rules hiddenRules, fn func([]DirectoryItem) bool) error {
+	f, err := os.Open(dirPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for {
+		entries, err := f.ReadDir(listBatchSize)
+		batch := make([]DirectoryItem, 0, len(entries))
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			batch = append(batch, buildDirectoryItem(dirPath, entry.Name(), info, rules))
+		}
+		if len(batch) > 0 && !fn(batch) {
+			return nil
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// listDirectoryItems returns at most max items of dirPath (max <= 0 means no
+// limit), directories first and then by name. truncated reports whether the
+// folder held more; the kept items are then the first ones the OS returned,
+// not the first ones in sorted order. A non-nil readme is shown every item
+// read, cut off or not.
+func listDirectoryItems(dirPath string, max int, rules hiddenRules, readme *readmeFinder) (items []DirectoryItem, truncated bool, err error) {
+	err = readDirBatches(dirPath, rules, func(batch []DirectoryItem) bool {
+		if readme != nil {
+			readme.observe(batch)
+		}
+		if max > 0 && len(items)+len(batch) > max {
+			items = append(items, batch[:max-len(items)]...)
+			truncated = true
+			return false
+		}
+		items = append(items, batch...)
+		return true
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if items == nil {
+		items = []DirectoryItem{}
+	}
+	sortDirectoryItems(items)
+	return items, truncated, nil
+}
+
+func getDirectoryItems(dirPath string, rules hiddenRules) ([]DirectoryItem, error) {
+	items, _, err := listDirectoryItems(dirPath, 0, rules, nil)
+	if errors.Is(err, fs.ErrPermission) {
+		return nil, errHostPermissionDenied
+	}
+	return items, err
+}
+
+// wantDetails reports whether the listing should include the slower
+// per-item fields (owner lookups hit the security descriptor of every file).
+func wantDetails(r *http.Request) bool {
+	return r.URL.Query().Get("details") == "1"
+}
+
+func fillOwners(dirPath string, items []DirectoryItem) {
+	for i := range items {
+		items[i].Owner = fileOwner(filepath.Join(dirPath, items[i].Name))
+	}
+}
+
+func sortDirectoryItems(items []DirectoryItem) {
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Type != items[j].Type {
+			return items[i].Type == "directory"
+		}
+		return strings.ToLower(items[i].Name) < strings.ToLower(items[j].Name)
+	})
+}
+
+// streamDirectoryItems writes dirPath as newline-delimited JSON, one
+// DirectoryItem per line in directory order, flushing after every batch so
+// clients can render huge folders progressively. Errors after the first line
+// can't change the status any more; they end the stream early.
+func (s *Server) streamDirectoryItems(w http.ResponseWriter, dirPath string, details bool) {
+	w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	rc := http.NewResponseController(w)
+	enc := json.NewEncoder(w)
+	started := false
+	err := readDirBatches(dirPath, s.hiddenRules(), func(batch []DirectoryItem) bool {
+		if !started {
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		if details {
+			fillOwners(dirPath, batch)
+		}
+		for i := range batch {
+			if err := enc.Encode(&batch[i]); err != nil {
+				return false
+			}
+		}
+		return rc.Flush() == nil
+	})
+	if err != nil && !started {
+		writeReadDirError(w, err)
+		return
+	}
+	if err != nil {
+		s.logf("stream listing %s: %v", dirPath, err)
+	}
+	if !started {
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !windows
+
+package shareserver
+
+func longPath(p string) string {
+	return p
+}
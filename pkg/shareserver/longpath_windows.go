@@ -0,0 +1,25 @@
+//go:build windows
+
+package shareserver
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Directories are limited to MAX_PATH-12 (room for an 8.3 file name).
+const maxShortPathLen = 248
+
+// longPath returns p with the \\?\ extended-length prefix when it is too long
+// for the classic Win32 APIs. The os package already does this internally, so
+// it is only needed for paths handed to raw syscalls.
+func longPath(p string) string {
+	if len(p) < maxShortPathLen || strings.HasPrefix(p, `\\?\`) || !filepath.IsAbs(p) {
+		return p
+	}
+	p = filepath.Clean(p)
+	if strings.HasPrefix(p, `\\`) {
+		return `\\?\UNC\` + p[2:]
+	}
+	return `\\?\` + p
+}
@@ -0,0 +1,96 @@
+//go:build windows
+
+package shareserver
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// makeLongTree creates root/<seg>/<seg>/.../deep.txt with a full path longer than MAX_PATH.
+func makeLongTree(t *testing.T, root string) (relDir string, fullFile string) {
+	t.Helper()
+	seg := strings.Repeat("d", 60)
+	parts := []string{}
+	for i := 0; i < 6; i++ {
+		parts = append(parts, seg)
+	}
+	relDir = strings.Join(parts, "/")
+	fullDir := filepath.Join(root, filepath.FromSlash(relDir))
+	if err := os.MkdirAll(fullDir, 0o755); err != nil {
+		t.Fatalf("mkdir long path failed: %v", err)
+	}
+	fullFile = filepath.Join(fullDir, "deep.txt")
+	if len(fullFile) <= 260 {
+		t.Fatalf("expected path longer than MAX_PATH, got %d", len(fullFile))
+	}
+	if err := os.WriteFile(fullFile, []byte("deep"), 0o644); err != nil {
+		t.Fatalf("write long path failed: %v", err)
+	}
+	return relDir, fullFile
+}
+
+func TestLongPathPrefix(t *testing.T) {
+	short := `C:\short\path.txt`
+	if got := longPath(short); got != short {
+		t.Fatalf("short path should be unchanged, got %q", got)
+	}
+	long := `C:\` + strings.Repeat(`a\`, 150) + "x.txt"
+	if got := longPath(long); !strings.HasPrefix(got, `\\?\C:\`) {
+		t.Fatalf("expected \\\\?\\ prefix, got %q", got)
+	}
+	unc := `\\server\share\` + strings.Repeat(`a\`, 150) + "x.txt"
+	if got := longPath(unc); !strings.HasPrefix(got, `\\?\UNC\server\share\`) {
+		t.Fatalf("expected UNC long prefix, got %q", got)
+	}
+	if got := stripLongPathPrefix(longPath(unc)); got != filepath.Clean(unc) {
+		t.Fatalf("strip should round-trip, got %q", got)
+	}
+}
+
+func TestLongPathListAndDownload(t *testing.T) {
+	tmp := t.TempDir()
+	relDir, _ := makeLongTree(t, tmp)
+
+	items, err := getDirectoryItems(filepath.Join(tmp, filepath.FromSlash(relDir)), defaultHiddenRules)
+	if err != nil {
+		t.Fatalf("list long dir failed: %v", err)
+	}
+	if len(items) != 1 || items[0].Name != "deep.txt" || items[0].Hidden {
+		t.Fatalf("unexpected items: %+v", items)
+	}
+
+	s := newTestShareServerWithRoot(tmp)
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	resp, err := ts.Client().Get(ts.URL + "/api/download?path=" + url.QueryEscape(relDir+"/deep.txt"))
+	if err != nil {
+		t.Fatalf("GET /api/download failed: %v", err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(b) != "deep" {
+		t.Fatalf("expected deep file content, got %d %q", resp.StatusCode, string(b))
+	}
+}
+
+func TestLongPathMoveToTrash(t *testing.T) {
+	tmp := t.TempDir()
+	_, fullFile := makeLongTree(t, tmp)
+
+	if err := moveToTrash(fullFile); err != nil {
+		t.Fatalf("moveToTrash long path failed: %v", err)
+	}
+	if _, err := os.Stat(fullFile); !os.IsNotExist(err) {
+		t.Fatalf("expected long path file to be gone, stat err=%v", err)
+	}
+}
@@ -0,0 +1,195 @@
+package shareserver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxManifestFiles caps one manifest; larger folders should be split.
+	maxManifestFiles = 5000
+	// linkTokenTTL is how long the links in a manifest keep working.
+	linkTokenTTL = time.Hour
+	// queryLinkToken carries a link token in generated download URLs. It is
+	// separate from queryShareToken so session tokens never end up in files.
+	queryLinkToken = "link"
+)
+
+type manifestFile struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	URL  string `json:"url"`
+}
+
+type manifestResponse struct {
+	Path  string         `json:"path"`
+	Files []manifestFile `json:"files"`
+	// ExpiresIn is the lifetime of the links in seconds, 0 when no pass is set.
+	ExpiresIn int `json:"expiresIn,omitempty"`
+}
+
+// cleanSharePath normalizes a share-relative path for comparisons:
+// forward slashes, no leading slash, no "." or ".." segments.
+func cleanSharePath(p string) string {
+	return strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(p)), "/")
+}
+
+// handleManifest lists direct download URLs for the files in a folder, for
+// download managers that want plain links instead of a zip. recursive=1
+// includes subfolders; format=txt answers one URL per line. Hidden files and
+// the share-wide ignore list are left out, as for download-all.
+func (s *Server) handleManifest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "仅支持 GET"})
+		return
+	}
+
+	s.mu.RLock()
+	root := s.sharedRoot
+	host := net.JoinHostPort(s.localIP, strconv.Itoa(s.port))
+	s.mu.RUnlock()
+	if root == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "服务未启动"})
+		return
+	}
+	if !s.requireAuth(w, r) {
+		return
+	}
+	if !s.requirePermission(w, "read") {
+		return
+	}
+
+	q := r.URL.Query()
+	rel := strings.TrimSpace(q.Get("path"))
+	fullPath, ok := s.resolveSharePath(w, r, root, rel)
+	if !ok {
+		return
+	}
+	st, err := os.Stat(fullPath)
+	if err != nil || !st.IsDir() {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "目录不存在"})
+		return
+	}
+	rel = relativeSharePath(root, fullPath)
+
+	paths := []string{rel}
+	recursive := q.Get("recursive") == "1" || q.Get("recursive") == "true"
+	if !recursive {
+		// Only the folder's own files: select them one by one.
+		entries, err := os.ReadDir(fullPath)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "读取目录失败"})
+			return
+		}
+		paths = paths[:0]
+		rules := s.hiddenRules()
+		for _, e := range entries {
+			if !e.Type().IsRegular() || isHiddenPath(fullPath, e.Name(), rules) {
+				continue
+			}
+			paths = append(paths, path.Join(rel, e.Name()))
+		}
+	}
+
+	var files []zipCandidate
+	err = s.walkZipCandidates(root, paths, zipFilter{skipHidden: true, allowRoot: true}, func(c zipCandidate) error {
+		if len(files) >= maxManifestFiles {
+			return &zipError{http.StatusBadRequest, fmt.Sprintf("文件过多（超过 %d 个），请选择更小的目录", maxManifestFiles)}
+		}
+		files = append(files, c)
+		return nil
+	})
+	if err != nil {
+		writeZipError(w, err)
+		return
+	}
+
+	resp := manifestResponse{Path: rel, Files: make([]manifestFile, 0, len(files))}
+	link := ""
+	if pass, enabled, err := s.getAccessPassFromSettings(); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "读取访问口令失败"})
+		return
+	} else if enabled && pass != "" {
+		token, err := s.auth.issueLink(rel, recursive, accessPassHash(pass), linkTokenTTL)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "生成下载链接失败"})
+			return
+		}
+		link = "&" + queryLinkToken + "=" + url.QueryEscape(token)
+		resp.ExpiresIn = int(linkTokenTTL / time.Second)
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	// The share's own address: the Host header is the client's to choose.
+	base := scheme + "://" + host + requestBasePath(r) + "/api/download?path="
+	for _, f := range files {
+		resp.Files = append(resp.Files, manifestFile{
+			Path: f.zipEntry,
+			Size: f.size,
+			URL:  base + url.QueryEscape(f.zipEntry) + link,
+		})
+	}
+
+	if q.Get("format") == "txt" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		for _, f := range resp.Files {
+			_, _ = fmt.Fprintln(w, f.URL)
+		}
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// requireAuthOrLink is requireAuth for /api/download, which also accepts a
+// manifest link token covering the requested file. viaLink reports that the
+// link token let the request in.
+func (s *Server) requireAuthOrLink(w http.ResponseWriter, r *http.Request, root string) (viaLink bool, ok bool) {
+	q := r.URL.Query()
+	if link := q.Get(queryLinkToken); link != "" && q.Get("job") == "" {
+		pass, enabled, err := s.getAccessPassFromSettings()
+		if err == nil && enabled && pass != "" {
+			file := q.Get("path")
+			if dir, valid := s.auth.validateLink(link, file, accessPassHash(pass)); valid && s.linkListsFile(root, dir, file) {
+				s.noteActivity(w)
+				return true, true
+			}
+		}
+	}
+	return false, s.requireAuth(w, r)
+}
+
+// linkListsFile reports whether the manifest of dir could have listed file:
+// handleManifest leaves out hidden files below dir and the share-wide ignore
+// list, so their links must not work either.
+func (s *Server) linkListsFile(root string, dir string, file string) bool {
+	file = cleanSharePath(file)
+	if newZipIgnore(s.getWatchIgnoreFromSettings()).entry(file) {
+		return false
+	}
+	rules := s.hiddenRules()
+	inside := strings.TrimPrefix(strings.TrimPrefix(file, dir), "/")
+	parent := dir
+	for _, name := range strings.Split(inside, "/") {
+		parentFull, ok := safeJoin(root, parent)
+		if !ok || isHiddenPath(parentFull, name, rules) {
+			return false
+		}
+		parent = path.Join(parent, name)
+	}
+	return true
+}
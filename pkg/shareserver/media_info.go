@@ -0,0 +1,298 @@
+package shareserver
+
+import (
+	"bufio"
+	"encoding/binary"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxMediaInfoFiles bounds one /api/media-info answer; the rest of a huge
+	// folder is left out and Truncated is set.
+	maxMediaInfoFiles = 1000
+	maxMediaInfoCache = 8192
+)
+
+// mediaInfoExts are the image types the standard library can read the size
+// of; other images are left out like non-images.
+var mediaInfoExts = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true}
+
+// MediaInfo is what /api/media-info knows about one image. Width and Height
+// are as stored; an Orientation of 5 to 8 means the photo is shown rotated by
+// 90°, with the two swapped.
+type MediaInfo struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// Taken is EXIF DateTimeOriginal as "2006-01-02T15:04:05", in the
+	// camera's local time (EXIF has no zone).
+	Taken       string `json:"taken,omitempty"`
+	Orientation int    `json:"orientation,omitempty"`
+}
+
+type mediaInfoResponse struct {
+	Path  string               `json:"path"`
+	Items map[string]MediaInfo `json:"items"`
+	// Truncated is set when the folder had more images than are reported.
+	Truncated bool `json:"truncated"`
+}
+
+type cachedMediaInfo struct {
+	size    int64
+	modTime time.Time
+	info    MediaInfo
+}
+
+// mediaInfoCache keeps header results by absolute path, so scrolling back to
+// a photo folder doesn't reopen every file.
+type mediaInfoCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedMediaInfo
+}
+
+func (c *mediaInfoCache) get(p string, st os.FileInfo) (MediaInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[p]
+	if !ok || e.size != st.Size() || !e.modTime.Equal(st.ModTime()) {
+		return MediaInfo{}, false
+	}
+	return e.info, true
+}
+
+func (c *mediaInfoCache) put(p string, st os.FileInfo, info MediaInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = map[string]cachedMediaInfo{}
+	}
+	if len(c.entries) >= maxMediaInfoCache {
+		clear(c.entries)
+	}
+	c.entries[p] = cachedMediaInfo{size: st.Size(), modTime: st.ModTime(), info: info}
+}
+
+// readMediaInfo reads the size, and for JPEGs the EXIF fields, from the
+// headers of the image at p.
+func readMediaInfo(p string) (MediaInfo, bool) {
+	f, err := openShared(p)
+	if err != nil {
+		return MediaInfo{}, false
+	}
+	defer f.Close()
+	cfg, format, err := image.DecodeConfig(bufio.NewReader(f))
+	if err != nil || cfg.Width <= 0 || cfg.Height <= 0 {
+		return MediaInfo{}, false
+	}
+	info := MediaInfo{Width: cfg.Width, Height: cfg.Height}
+	if format == "jpeg" {
+		if _, err := f.Seek(0, io.SeekStart); err == nil {
+			info.Taken, info.Orientation = readJPEGExif(bufio.NewReader(f))
+		}
+	}
+	return info, true
+}
+
+// readJPEGExif finds the APP1 Exif segment before the image data and returns
+// DateTimeOriginal and Orientation from it; missing fields are zero.
+func readJPEGExif(r *bufio.Reader) (taken string, orientation int) {
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil || soi != [2]byte{0xFF, 0xD8} {
+		return "", 0
+	}
+	for {
+		b, err := r.ReadByte()
+		if err != nil || b != 0xFF {
+			return "", 0
+		}
+		marker, err := r.ReadByte()
+		for err == nil && marker == 0xFF {
+			marker, err = r.ReadByte()
+		}
+		if err != nil {
+			return "", 0
+		}
+		switch {
+		case marker == 0xDA || marker == 0xD9:
+			// Start of scan or end of image: no Exif segment.
+			return "", 0
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7):
+			continue
+		}
+		var lenBuf [2]byte
+		if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+			return "", 0
+		}
+		n := int(binary.BigEndian.Uint16(lenBuf[:])) - 2
+		if n < 0 {
+			return "", 0
+		}
+		if marker != 0xE1 || n < 6 {
+			if _, err := r.Discard(n); err != nil {
+				return "", 0
+			}
+			continue
+		}
+		seg := make([]byte, n)
+		if _, err := io.ReadFull(r, seg); err != nil {
+			return "", 0
+		}
+		if string(seg[:6]) != "Exif\x00\x00" {
+			continue
+		}
+		return parseExifTIFF(seg[6:])
+	}
+}
+
+const (
+	exifTagOrientation      = 0x0112
+	exifTagExifIFD          = 0x8769
+	exifTagDateTimeOriginal = 0x9003
+)
+
+// parseExifTIFF reads the two fields from the TIFF structure of an Exif
+// segment: Orientation from IFD0, DateTimeOriginal from the Exif IFD.
+func parseExifTIFF(b []byte) (taken string, orientation int) {
+	if len(b) < 8 {
+		return "", 0
+	}
+	var order binary.ByteOrder
+	switch string(b[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return "", 0
+	}
+	if order.Uint16(b[2:]) != 42 {
+		return "", 0
+	}
+
+	// entries calls fn with tag, type, count and the 4-byte value field of
+	// every entry of the IFD at off.
+	entries := func(off uint32, fn func(tag, typ uint16, count uint32, value []byte)) {
+		if uint64(off)+2 > uint64(len(b)) {
+			return
+		}
+		n := int(order.Uint16(b[off:]))
+		start := int(off) + 2
+		for i := 0; i < n && start+12*(i+1) <= len(b); i++ {
+			e := b[start+12*i:]
+			fn(order.Uint16(e), order.Uint16(e[2:]), order.Uint32(e[4:]), e[8:12])
+		}
+	}
+
+	var exifIFD uint32
+	entries(order.Uint32(b[4:]), func(tag, typ uint16, count uint32, value []byte) {
+		switch {
+		case tag == exifTagOrientation && typ == 3 && count >= 1:
+			if o := int(order.Uint16(value)); o >= 1 && o <= 8 {
+				orientation = o
+			}
+		case tag == exifTagExifIFD && typ == 4 && count == 1:
+			exifIFD = order.Uint32(value)
+		}
+	})
+	if exifIFD == 0 {
+		return "", orientation
+	}
+	entries(exifIFD, func(tag, typ uint16, count uint32, value []byte) {
+		// "YYYY:MM:DD HH:MM:SS\x00" doesn't fit the value field, so it is
+		// always stored at an offset.
+		if tag != exifTagDateTimeOriginal || typ != 2 || count < 19 {
+			return
+		}
+		off := uint64(order.Uint32(value))
+		if off+19 > uint64(len(b)) {
+			return
+		}
+		t, err := time.Parse("2006:01:02 15:04:05", string(b[off:off+19]))
+		if err == nil {
+			taken = t.Format("2006-01-02T15:04:05")
+		}
+	})
+	return taken, orientation
+}
+
+// handleMediaInfo reports the size and EXIF capture date of the images in a
+// folder (?path=photos), read from file headers only, so a photo grid can lay
+// itself out before loading any image. Items are keyed by file name;
+// non-images and files that can't be read are left out.
+func (s *Server) handleMediaInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "仅支持 GET"})
+		return
+	}
+
+	s.mu.RLock()
+	root := s.sharedRoot
+	s.mu.RUnlock()
+	if root == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "服务未启动"})
+		return
+	}
+	if !s.requireAuth(w, r) {
+		return
+	}
+	if !s.requirePermission(w, "read") {
+		return
+	}
+
+	fullPath, ok := s.resolveSharePath(w, r, root, strings.TrimSpace(r.URL.Query().Get("path")))
+	if !ok {
+		return
+	}
+	entries, err := os.ReadDir(fullPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "目录不存在"})
+			return
+		}
+		writeReadDirError(w, err)
+		return
+	}
+
+	rules := s.hiddenRules()
+	resp := mediaInfoResponse{Path: relativeSharePath(root, fullPath), Items: map[string]MediaInfo{}}
+	seen := 0
+	for _, e := range entries {
+		if r.Context().Err() != nil {
+			// The client is gone; nobody reads the answer.
+			return
+		}
+		name := e.Name()
+		if !e.Type().IsRegular() || !mediaInfoExts[strings.ToLower(filepath.Ext(name))] || isHiddenPath(fullPath, name, rules) {
+			continue
+		}
+		if seen >= maxMediaInfoFiles {
+			resp.Truncated = true
+			break
+		}
+		seen++
+		st, err := e.Info()
+		if err != nil {
+			continue
+		}
+		p := filepath.Join(fullPath, name)
+		info, ok := s.mediaInfo.get(p, st)
+		if !ok {
+			if info, ok = readMediaInfo(p); !ok {
+				continue
+			}
+			s.mediaInfo.put(p, st, info)
+		}
+		resp.Items[name] = info
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,216 @@
+package shareserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IPv4Candidate is one address getLocalIPv4 considered and the score its
+// heuristic gave it; the highest score wins.
+type IPv4Candidate struct {
+	Interface string `json:"interface"`
+	IP        string `json:"ip"`
+	Score     int    `json:"score"`
+}
+
+// localIPv4CacheTTL bounds how often getLocalIPv4 enumerates interfaces,
+// which is slow on machines with many virtual adapters (Docker, WSL, Hyper-V).
+const localIPv4CacheTTL = 5 * time.Second
+
+var localIPv4Cache struct {
+	mu  sync.Mutex
+	ip  string
+	err error
+	at  time.Time
+}
+
+// Swapped in tests.
+var (
+	localIPv4Now     = time.Now
+	resolveLocalIPv4 = bestLocalIPv4
+)
+
+// getLocalIPv4 is bestLocalIPv4, cached for localIPv4CacheTTL.
+func getLocalIPv4() (string, error) {
+	c := &localIPv4Cache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := localIPv4Now()
+	if !c.at.IsZero() && now.Sub(c.at) < localIPv4CacheTTL {
+		return c.ip, c.err
+	}
+	c.ip, c.err = resolveLocalIPv4()
+	c.at = now
+	return c.ip, c.err
+}
+
+// InvalidateLocalIPv4 drops the cached address, for callers that learn the
+// network interfaces changed.
+func InvalidateLocalIPv4() {
+	localIPv4Cache.mu.Lock()
+	localIPv4Cache.at = time.Time{}
+	localIPv4Cache.mu.Unlock()
+}
+
+// bestLocalIPv4 returns the highest scored of LocalIPv4Candidates.
+func bestLocalIPv4() (string, error) {
+	cands, err := LocalIPv4Candidates()
+	if err != nil {
+		return "", err
+	}
+	best := -1
+	for i, c := range cands {
+		if best < 0 || c.Score > cands[best].Score {
+			best = i
+		}
+	}
+	if best < 0 {
+		return "", errors.New("未找到可用的 IPv4 地址")
+	}
+	return cands[best].IP, nil
+}
+
+// ifaceAddr is one IPv4 address of an interface that is up, as scoreIPv4
+// sees it.
+type ifaceAddr struct {
+	Name         string
+	IP           net.IP
+	PointToPoint bool
+}
+
+// vpnOrVirtualKeywords mark interface names that rarely face the LAN.
+var vpnOrVirtualKeywords = []string{
+	"radmin",
+	"vpn",
+	"virtualbox",
+	"vmware",
+	"hyper-v",
+	"wintun",
+	"wireguard",
+	"tailscale",
+	"zerotier",
+	"hamachi",
+	"tap",
+	"tun",
+	"utun",
+	"docker",
+	"vethernet",
+	"loopback",
+}
+
+func isRFC1918(ip4 net.IP) bool {
+	// 10.0.0.0/8
+	if ip4[0] == 10 {
+		return true
+	}
+	// 172.16.0.0/12
+	if ip4[0] == 172 && ip4[1] >= 16 && ip4[1] <= 31 {
+		return true
+	}
+	// 192.168.0.0/16
+	return ip4[0] == 192 && ip4[1] == 168
+}
+
+// scoreIPv4 rates how likely a.IP is the address other LAN devices can reach.
+func scoreIPv4(a ifaceAddr) int {
+	ip4 := a.IP.To4()
+	if ip4 == nil {
+		return 0
+	}
+	name := strings.ToLower(a.Name)
+
+	score := 0
+	if isRFC1918(ip4) {
+		score += 100
+	}
+	// 轻微偏好 192.168（常见家庭/小型局域网），但不强制。
+	if ip4[0] == 192 && ip4[1] == 168 {
+		score += 5
+	}
+	// 常见 VirtualBox Host-Only 默认网段，降低优先级。
+	if ip4[0] == 192 && ip4[1] == 168 && ip4[2] == 56 {
+		score -= 50
+	}
+	if strings.Contains(name, "wlan") || strings.Contains(name, "wi-fi") || strings.Contains(name, "wifi") || strings.Contains(name, "wireless") {
+		score += 40
+	}
+	if strings.Contains(name, "ethernet") {
+		score += 5
+	}
+	if a.PointToPoint {
+		score -= 200
+	}
+	for _, k := range vpnOrVirtualKeywords {
+		if strings.Contains(name, k) {
+			score -= 1000
+			break
+		}
+	}
+	return score
+}
+
+// LocalIPv4Candidates lists the usable IPv4 addresses of interfaces that are
+// up, in interface order, scored by how likely they face the LAN.
+func LocalIPv4Candidates() ([]IPv4Candidate, error) {
+	ifs, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var cands []IPv4Candidate
+	for _, iface := range ifs {
+		if iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		if iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+
+		for _, addr := range addrs {
+			var ip net.IP
+			switch v := addr.(type) {
+			case *net.IPNet:
+				ip = v.IP
+			case *net.IPAddr:
+				ip = v.IP
+			default:
+				continue
+			}
+
+			ip4 := ip.To4()
+			if ip4 == nil || ip4.IsLoopback() || ip4.IsLinkLocalUnicast() {
+				continue
+			}
+
+			score := scoreIPv4(ifaceAddr{Name: iface.Name, IP: ip4, PointToPoint: iface.Flags&net.FlagPointToPoint != 0})
+			cands = append(cands, IPv4Candidate{Interface: iface.Name, IP: ip4.String(), Score: score})
+		}
+	}
+	return cands, nil
+}
+
+// listenTCP binds port on all interfaces (0 picks a free one), giving up when
+// ctx is done.
+func listenTCP(ctx context.Context, port int) (net.Listener, error) {
+	var lc net.ListenConfig
+	return lc.Listen(ctx, "tcp", fmt.Sprintf(":%d", port))
+}
+
+func getAvailablePort(ctx context.Context) (int, net.Listener, error) {
+	ln, err := listenTCP(ctx, 0)
+	if err != nil {
+		return 0, nil, err
+	}
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.Port, ln, nil
+}
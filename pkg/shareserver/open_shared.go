@@ -0,0 +1,36 @@
+package shareserver
+
+import (
+	"net/http"
+)
+
+// writeOpenFileError answers a shared file that couldn't be opened: 409
+// FILE_IN_USE when another program holds it exclusively (an Office document
+// being edited), so guests don't think it vanished; 404 otherwise.
+func writeOpenFileError(w http.ResponseWriter, err error) {
+	if isFileInUseError(err) {
+		writeJSON(w, http.StatusConflict, map[string]string{
+			"error": "文件正被其他程序占用，请稍后重试",
+			"code":  "FILE_IN_USE",
+		})
+		return
+	}
+	writeJSON(w, http.StatusNotFound, map[string]string{"error": "文件不存在"})
+}
+
+// serveSharedFile is http.ServeFile for a regular file that other programs
+// may have open for writing (see openShared).
+func serveSharedFile(w http.ResponseWriter, r *http.Request, fullPath string) {
+	f, err := openShared(fullPath)
+	if err != nil {
+		writeOpenFileError(w, err)
+		return
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "读取文件失败"})
+		return
+	}
+	http.ServeContent(w, r, st.Name(), st.ModTime(), f)
+}
@@ -0,0 +1,34 @@
+//go:build windows
+
+package shareserver
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// openShared opens path for reading while allowing others to read, write and
+// delete it. os.Open leaves out FILE_SHARE_DELETE, so it fails on files that
+// Office and many editors keep open with delete access.
+func openShared(path string) (*os.File, error) {
+	p, err := windows.UTF16PtrFromString(longPath(path))
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	h, err := windows.CreateFile(p, windows.GENERIC_READ,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE,
+		nil, windows.OPEN_EXISTING, windows.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	return os.NewFile(uintptr(h), path), nil
+}
+
+// isFileInUseError reports whether err means another program opened the file
+// without letting anyone else read it.
+func isFileInUseError(err error) bool {
+	return errors.Is(err, windows.ERROR_SHARING_VIOLATION) ||
+		errors.Is(err, windows.ERROR_LOCK_VIOLATION)
+}
@@ -0,0 +1,76 @@
+//go:build windows
+
+package shareserver
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/windows"
+)
+
+// holdFileForTest opens path the way another program would, with the given
+// access and share mode, until the test ends.
+func holdFileForTest(t *testing.T, path string, access, share uint32) {
+	t.Helper()
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		t.Fatalf("utf16: %v", err)
+	}
+	h, err := windows.CreateFile(p, access, share, nil, windows.OPEN_EXISTING, windows.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+	t.Cleanup(func() { _ = windows.CloseHandle(h) })
+}
+
+func TestShareServerDownloadFileInUse(t *testing.T) {
+	tmp := t.TempDir()
+	for _, name := range []string{"report.txt", "locked.txt"} {
+		if err := os.WriteFile(filepath.Join(tmp, name), []byte("hello"), 0o644); err != nil {
+			t.Fatalf("write file: %v", err)
+		}
+	}
+	s := newTestShareServerWithSettings(tmp)
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	// Like an editor: open for writing and deleting, readers allowed. os.Open
+	// would fail on this for lack of FILE_SHARE_DELETE.
+	holdFileForTest(t, filepath.Join(tmp, "report.txt"),
+		windows.GENERIC_READ|windows.GENERIC_WRITE|windows.DELETE, windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE)
+	for _, endpoint := range []string{"/api/download", "/api/preview"} {
+		resp, err := ts.Client().Get(ts.URL + endpoint + "?path=" + url.QueryEscape("report.txt"))
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", endpoint, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || string(body) != "hello" {
+			t.Fatalf("GET %s = %d %q", endpoint, resp.StatusCode, body)
+		}
+	}
+
+	// Nobody may read a file held with no sharing at all.
+	holdFileForTest(t, filepath.Join(tmp, "locked.txt"), windows.GENERIC_READ, 0)
+	for _, endpoint := range []string{"/api/download", "/api/preview"} {
+		resp, err := ts.Client().Get(ts.URL + endpoint + "?path=" + url.QueryEscape("locked.txt"))
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", endpoint, err)
+		}
+		var body map[string]any
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusConflict || body["code"] != "FILE_IN_USE" {
+			t.Fatalf("GET %s = %d %v, want 409 FILE_IN_USE", endpoint, resp.StatusCode, body)
+		}
+	}
+}
@@ -0,0 +1,343 @@
+// Package shareserver is the LAN file-sharing HTTP server behind LocalShare:
+// token auth, safe path joining, zip streaming and live change events (SSE).
+// It can run standalone via Start or be mounted elsewhere via Handler.
+package shareserver
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Settings is the key/value backend for share settings. Values are raw JSON.
+// *SettingsStore persists to a file; *MemorySettings keeps them in memory.
+type Settings interface {
+	Get(key string) (json.RawMessage, bool, error)
+	Set(key string, value json.RawMessage) error
+	Delete(key string) error
+	// Watch calls fn after every change (value is nil on delete) until stop is called.
+	Watch(fn func(key string, value json.RawMessage)) (stop func())
+}
+
+// Logger receives diagnostic messages. *log.Logger satisfies it.
+type Logger interface {
+	Printf(format string, args ...any)
+}
+
+// Options configures a Server. Every field is optional.
+type Options struct {
+	// Root is the folder served by Handler before Start is called, for
+	// programs that mount the server on their own http.Server.
+	Root string
+
+	// Settings backs access pass, permissions, custom port etc.
+	// nil means built-in defaults and nothing is persisted.
+	Settings Settings
+
+	// Logger defaults to discarding everything.
+	Logger Logger
+
+	// Version is reported by /api/meta.
+	Version string
+
+	// AccessLogPath is where requests are appended when the access-log-file
+	// setting is on. Defaults to access.log next to the default settings file.
+	AccessLogPath string
+
+	// Assets is the web UI served under "/". nil serves the API only.
+	Assets fs.FS
+	// AssetsNoCache disables browser caching of Assets (useful in dev).
+	AssetsNoCache bool
+	// AssetsPath is where Assets were loaded from, shown on the diagnostic page
+	// served when index.html is missing. Defaults to "web/dist".
+	AssetsPath string
+
+	// RememberLastShare records every started/stopped share under
+	// SettingKeyLastShare, so the desktop app can offer to resume it.
+	RememberLastShare bool
+
+	// OnClientConnected is called on the first request of each client IP.
+	OnClientConnected func(ip string, userAgent string)
+	// OnClientDisconnected is called when the last event stream of an IP closes.
+	OnClientDisconnected func(ip string)
+	// OnPanic is called after a handler panic was answered with a 500; id is
+	// also in the response body and the log.
+	OnPanic func(id string, msg string)
+	// OnCustomPortAvailable is called once when a share that fell back to a
+	// random port finds its custom port free; switched reports whether it
+	// moved there (SettingKeyAutoReclaimPort).
+	OnCustomPortAvailable func(port int, switched bool)
+	// OnShareRootLost is called after sharing stopped because the shared
+	// folder disappeared; reason is ShareRootLostDeviceRemoved or
+	// ShareRootLostUnavailable.
+	OnShareRootLost func(root string, reason string)
+	// OnShareFailed is called after sharing stopped because the server quit
+	// with an error; restarting reports whether SettingKeyAutoRestart will try
+	// to share root again. It is called once more, with restarting false and
+	// the last error, when every try failed.
+	OnShareFailed func(root string, err error, restarting bool)
+	// OnShareRestarted is called when an automatic restart succeeded.
+	OnShareRestarted func(root string, attempt int)
+	// OnShareExpired is called after the timer armed by SetExpiry stopped
+	// sharing root.
+	OnShareExpired func(root string)
+	// OnShareIdleStopped is called after sharing root stopped because nobody
+	// used it for SettingKeyIdleStopMinutes.
+	OnShareIdleStopped func(root string)
+	// OnRemoteAdmin is called after a web client used the admin API; action
+	// is RemoteAdminStop or RemoteAdminPermissions.
+	OnRemoteAdmin func(action string, ip string)
+	// OnPathProbe is called when one IP has requested paths outside the share
+	// several times in a short while (see AccessEventPathForbidden).
+	OnPathProbe func(ip string, attempts int)
+}
+
+var errSettingsUnavailable = errors.New("settings store not available")
+
+// New creates a stopped Server.
+func New(opts Options) *Server {
+	s := &Server{
+		events:                newSSEHub(),
+		stats:                 newShareStats(),
+		uploadHashes:          newUploadHashIndex(),
+		uploadProgress:        newUploadProgresses(),
+		archives:              newArchiveJobs(),
+		pathLocks:             newPathLocks(),
+		settings:              opts.Settings,
+		logger:                opts.Logger,
+		version:               opts.Version,
+		accessLog:             newAccessLog(accessLogCapacity),
+		accessLogPath:         opts.AccessLogPath,
+		assets:                opts.Assets,
+		assetsNoCache:         opts.AssetsNoCache,
+		assetsPath:            opts.AssetsPath,
+		rememberLastShare:     opts.RememberLastShare,
+		onClientConnected:     opts.OnClientConnected,
+		onClientDisconnected:  opts.OnClientDisconnected,
+		onPanic:               opts.OnPanic,
+		onCustomPortAvailable: opts.OnCustomPortAvailable,
+		onShareRootLost:       opts.OnShareRootLost,
+		onShareFailed:         opts.OnShareFailed,
+		onShareRestarted:      opts.OnShareRestarted,
+		onShareExpired:        opts.OnShareExpired,
+		onShareIdleStopped:    opts.OnShareIdleStopped,
+		onRemoteAdmin:         opts.OnRemoteAdmin,
+		onPathProbe:           opts.OnPathProbe,
+		pathProbes:            newPathProbes(),
+		useTrash:              runtime.GOOS == "windows",
+		auth:                  newAuthManager(time.Now),
+		authChallenges:        newAuthChallenges(time.Now),
+		downloadTokens:        newDownloadTokens(time.Now),
+		activity:              newShareActivity(time.Now),
+	}
+	if root := strings.TrimSpace(opts.Root); root != "" {
+		if abs, err := filepath.Abs(root); err == nil {
+			s.sharedRoot = abs
+		}
+	}
+	s.auth.logf = s.logf
+	if s.settings != nil {
+		// Push every change to web clients, whoever made it (desktop UI, HTTP, embedder).
+		s.settings.Watch(s.emitSettingChanged)
+		s.settings.Watch(s.emitPermissionsChanged)
+		s.settings.Watch(s.onWatchSettingChanged)
+		s.settings.Watch(s.onAuthSettingChanged)
+		s.auth.configure(s.authConfig())
+	}
+	s.archives.onChange = func(owner string, info archiveJobInfo) {
+		s.events.sendVolatileTo(owner, "archiveJob", info)
+	}
+	// Only the uploader may follow an upload, as for /api/upload-progress.
+	s.uploadProgress.onChange = func(ip string, info uploadProgressInfo) {
+		s.events.sendVolatileTo(ip, "uploadProgress", info)
+	}
+	s.events.onLastClientGone = func(ip string) {
+		if s.onClientDisconnected != nil {
+			s.onClientDisconnected(ip)
+		}
+	}
+	return s
+}
+
+func (s *Server) logf(format string, args ...any) {
+	if s.logger != nil {
+		s.logger.Printf(format, args...)
+	}
+}
+
+// Handler returns the routes served by Start, for mounting on another server.
+// Live change events need Start, which also watches the shared folder.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	return s.logRequests(s.recoverPanics(s.cors(s.trackClients(s.trackActivity(mux)))))
+}
+
+// Permissions returns the effective read/write/delete permissions.
+func (s *Server) Permissions() Permissions {
+	return s.getPermissionsFromSettings()
+}
+
+// ReadOnly reports whether SettingKeyReadOnly is on.
+func (s *Server) ReadOnly() bool {
+	return s.getBoolSetting(SettingKeyReadOnly)
+}
+
+// BoolSetting reads a JSON boolean setting; anything else counts as false.
+func (s *Server) BoolSetting(key string) bool {
+	return s.getBoolSetting(key)
+}
+
+// Setting returns the raw JSON stored under key.
+func (s *Server) Setting(key string) (json.RawMessage, bool, error) {
+	if s.settings == nil {
+		return nil, false, errSettingsUnavailable
+	}
+	return s.settings.Get(key)
+}
+
+// SetSetting stores value under key and notifies web clients. nil deletes the key.
+func (s *Server) SetSetting(key string, value json.RawMessage) error {
+	if s.settings == nil {
+		return errSettingsUnavailable
+	}
+	if value == nil {
+		if err := s.settings.Delete(key); err != nil {
+			return err
+		}
+		s.applySetting(key)
+		return nil
+	}
+	if key == SettingKeyBasePath {
+		var p string
+		if err := json.Unmarshal(value, &p); err != nil {
+			return errInvalidBasePath
+		}
+		if _, err := normalizeBasePath(p); err != nil {
+			return err
+		}
+	}
+	switch key {
+	case SettingKeyAdminPass:
+		if err := s.validateAdminPass(value); err != nil {
+			return err
+		}
+	case SettingKeyAdminIPs:
+		if err := validateAdminIPs(value); err != nil {
+			return err
+		}
+	case SettingKeyHiddenRules:
+		if _, err := parseHiddenRules(value); err != nil {
+			return err
+		}
+	case SettingKeyTrashTooLarge:
+		if err := validateTrashTooLarge(value); err != nil {
+			return err
+		}
+	case SettingKeyZipIgnoreSuggestions:
+		if err := validateZipIgnoreSuggestions(value); err != nil {
+			return err
+		}
+	case SettingKeyCORSOrigins:
+		if err := validateCORSOrigins(value); err != nil {
+			return err
+		}
+	case SettingKeyZipDefaultIgnore:
+		if err := validateZipDefaultIgnore(value); err != nil {
+			return err
+		}
+	}
+	if err := s.settings.Set(key, value); err != nil {
+		return err
+	}
+	s.applySetting(key)
+	return nil
+}
+
+// applySetting puts a changed setting into effect on a running share, for
+// the few that aren't simply read on each request.
+func (s *Server) applySetting(key string) {
+	if key == SettingKeyPortRedirect {
+		s.mu.Lock()
+		s.stopRedirectLocked()
+		s.startRedirectLocked()
+		s.mu.Unlock()
+	}
+}
+
+// ResetUploadQuota clears the upload counter of ip, or of every client when ip is "".
+func (s *Server) ResetUploadQuota(ip string) {
+	s.stats.resetUploads(strings.TrimSpace(ip))
+}
+
+// ResolvePath maps a share-relative path to an absolute local path.
+func (s *Server) ResolvePath(relPath string) (string, error) {
+	return s.resolveSharedPath(relPath)
+}
+
+// entryTokenTTL is how long the one-time token of a folder link can be redeemed.
+const entryTokenTTL = 30 * time.Minute
+
+// FolderURL returns a link that opens the web UI directly in the shared
+// sub-folder relPath ("" is the root). The path travels in ?path= encoded the
+// way the web UI encodes it: base64url per segment. With an access pass set,
+// the link also carries a one-time token (?ott=) that stands in for the pass.
+func (s *Server) FolderURL(relPath string) (string, error) {
+	info, _ := s.GetServerInfo()
+	if info == nil {
+		return "", errors.New("本地服务器未启用")
+	}
+	fullPath, err := s.resolveSharedPath(relPath)
+	if err != nil {
+		return "", err
+	}
+	st, err := os.Stat(fullPath)
+	if err != nil || !st.IsDir() {
+		return "", errors.New("文件夹不存在")
+	}
+	q := url.Values{}
+	if rel, err := filepath.Rel(info.SharedFolder, fullPath); err == nil && rel != "." {
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		for i, p := range parts {
+			parts[i] = base64.RawURLEncoding.EncodeToString([]byte(p))
+		}
+		q.Set("path", strings.Join(parts, "/"))
+	}
+	pass, enabled, err := s.getAccessPassFromSettings()
+	if err != nil {
+		return "", err
+	}
+	if enabled && pass != "" {
+		token, err := s.auth.issueEntry(accessPassHash(pass), entryTokenTTL)
+		if err != nil {
+			return "", err
+		}
+		q.Set(queryEntryToken, token)
+	}
+	if len(q) == 0 {
+		return info.URL + "/", nil
+	}
+	return info.URL + "/?" + q.Encode(), nil
+}
+
+// ListDirectory lists a directory of the current share exactly as /api/files
+// would, without going through HTTP/auth.
+func (s *Server) ListDirectory(relPath string) ([]DirectoryItem, error) {
+	fullPath, err := s.resolveSharedPath(relPath)
+	if err != nil {
+		return nil, err
+	}
+	st, err := os.Stat(fullPath)
+	if err != nil || !st.IsDir() {
+		return nil, errors.New("路径不存在")
+	}
+	return getDirectoryItems(fullPath, s.hiddenRules())
+}
@@ -0,0 +1,175 @@
+package shareserver
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// AccessEventPathForbidden marks access log entries of requests rejected for
+// naming a path outside the share (../, encoded dots, backslashes, ...).
+const AccessEventPathForbidden = "path_forbidden"
+
+// SettingKeyMaxPathBytes (JSON number) caps the length of a share-relative
+// path sent by a client, in bytes.
+const SettingKeyMaxPathBytes = "local-share:max-path-bytes"
+
+const (
+	defaultMaxPathBytes = 4096
+	// maxPathComponentBytes is the longest file name NTFS and ext4 accept.
+	maxPathComponentBytes = 255
+)
+
+var (
+	errPathNotUTF8      = errors.New("路径不是有效的 UTF-8 文本")
+	errPathControlChars = errors.New("路径包含控制字符")
+	errPathTooLong      = errors.New("路径过长")
+	errPathNameTooLong  = errors.New("文件名过长（超过 255 字节）")
+)
+
+// validatePath checks a client-supplied path before it reaches filepath.Join
+// or a response header: valid UTF-8, no control characters (NUL included),
+// at most maxBytes in total and 255 bytes per component. Both "/" and "\"
+// separate components.
+func validatePath(p string, maxBytes int) error {
+	if !utf8.ValidString(p) {
+		return errPathNotUTF8
+	}
+	if len(p) > maxBytes {
+		return errPathTooLong
+	}
+	if strings.IndexFunc(p, unicode.IsControl) >= 0 {
+		return errPathControlChars
+	}
+	for _, part := range strings.FieldsFunc(p, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if len(part) > maxPathComponentBytes {
+			return errPathNameTooLong
+		}
+	}
+	return nil
+}
+
+func (s *Server) maxPathBytes() int {
+	return s.getIntSetting(SettingKeyMaxPathBytes, defaultMaxPathBytes, 256, 32*1024)
+}
+
+// checkPathInput answers 400 INVALID_PATH unless validatePath accepts p.
+func (s *Server) checkPathInput(w http.ResponseWriter, p string) bool {
+	if body := s.pathInputError(p); body != nil {
+		writeJSON(w, http.StatusBadRequest, body)
+		return false
+	}
+	return true
+}
+
+// pathInputError is the 400 body checkPathInput sends for p, nil if p is fine.
+func (s *Server) pathInputError(p string) map[string]string {
+	if err := validatePath(p, s.maxPathBytes()); err != nil {
+		return map[string]string{
+			"error": err.Error(),
+			"code":  "INVALID_PATH",
+		}
+	}
+	return nil
+}
+
+const (
+	// pathProbeWarnAfter rejected paths from one IP within pathProbeWindow
+	// trigger Options.OnPathProbe.
+	pathProbeWarnAfter = 5
+	pathProbeWindow    = 10 * time.Minute
+)
+
+type pathProbe struct {
+	first time.Time
+	count int
+}
+
+// pathProbes counts rejected paths per client IP.
+type pathProbes struct {
+	mu   sync.Mutex
+	byIP map[string]*pathProbe
+}
+
+func newPathProbes() *pathProbes {
+	return &pathProbes{byIP: map[string]*pathProbe{}}
+}
+
+// add records one attempt and reports the IP's count in the current window;
+// warn is true exactly once per window, when the count reaches the threshold.
+func (p *pathProbes) add(ip string, now time.Time) (count int, warn bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for k, v := range p.byIP {
+		if now.Sub(v.first) > pathProbeWindow {
+			delete(p.byIP, k)
+		}
+	}
+	e := p.byIP[ip]
+	if e == nil {
+		e = &pathProbe{first: now}
+		p.byIP[ip] = e
+	}
+	e.count++
+	return e.count, e.count == pathProbeWarnAfter
+}
+
+// resolveSharePath is safeJoin for request input: malformed paths are
+// answered with 400 INVALID_PATH, paths escaping the share with 403
+// PATH_FORBIDDEN (and recorded). Handlers call it before touching the
+// filesystem, so probes never see a 404 instead.
+func (s *Server) resolveSharePath(w http.ResponseWriter, r *http.Request, root, rel string) (string, bool) {
+	full, status, body := s.sharePathError(w, r, root, rel)
+	if body != nil {
+		writeJSON(w, status, body)
+		return "", false
+	}
+	return full, true
+}
+
+// sharePathError is resolveSharePath for handlers that answer errors
+// themselves: it returns the status and body to send instead of sending them.
+func (s *Server) sharePathError(w http.ResponseWriter, r *http.Request, root, rel string) (string, int, map[string]string) {
+	if body := s.pathInputError(rel); body != nil {
+		return "", http.StatusBadRequest, body
+	}
+	full, ok := safeJoin(root, rel)
+	if !ok {
+		return "", http.StatusForbidden, s.recordRejectedPath(w, r, rel)
+	}
+	return full, 0, nil
+}
+
+// checkSharePaths runs resolveSharePath over a multi-path request, rejecting
+// all of it when one path escapes the share.
+func (s *Server) checkSharePaths(w http.ResponseWriter, r *http.Request, root string, paths []string) bool {
+	for _, rel := range paths {
+		if _, ok := s.resolveSharePath(w, r, root, rel); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) rejectPath(w http.ResponseWriter, r *http.Request, raw string) {
+	writeJSON(w, http.StatusForbidden, s.recordRejectedPath(w, r, raw))
+}
+
+// recordRejectedPath logs a path escaping the share and returns the 403 body.
+func (s *Server) recordRejectedPath(w http.ResponseWriter, r *http.Request, raw string) map[string]string {
+	ip := s.clientIP(r)
+	count, warn := s.pathProbes.add(ip, time.Now())
+	s.logf("security: path forbidden ip=%s %s %s path=%q (%d in %s)", ip, r.Method, r.URL.Path, raw, count, pathProbeWindow)
+	markAccessEvent(w, AccessEventPathForbidden, raw)
+	if warn && s.onPathProbe != nil {
+		s.onPathProbe(ip, count)
+	}
+	return map[string]string{
+		"error": "无权限访问此路径",
+		"code":  "PATH_FORBIDDEN",
+	}
+}
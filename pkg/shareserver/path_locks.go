@@ -0,0 +1,149 @@
+package shareserver
+
+import (
+	"context"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SettingKeyDownloadPathLocks (JSON bool) makes downloads hold a shared lock
+// on their file, so an upload replacing it waits for them instead of racing.
+// Off by default: a slow download then delays the upload's final rename.
+const SettingKeyDownloadPathLocks = "local-share:download-path-locks"
+
+// pathLocks is an in-memory reader/writer lock per share-relative path.
+// Uploads (around the final rename) and deletes lock exclusively; downloads
+// may lock shared. Waiting gives up when the request's context is done, so a
+// client that disconnects never holds or queues for a lock.
+type pathLocks struct {
+	mu    sync.Mutex
+	locks map[string]*pathLockState
+}
+
+type pathLockState struct {
+	readers int
+	writer  bool
+	// writersWaiting makes new readers queue behind a pending writer.
+	writersWaiting int
+	// refs counts holders and waiters; the entry is dropped at zero.
+	refs int
+	// changed is closed and replaced whenever the lock is released.
+	changed chan struct{}
+}
+
+func newPathLocks() *pathLocks {
+	return &pathLocks{locks: map[string]*pathLockState{}}
+}
+
+// pathLockKey normalises a share-relative path. Windows paths are compared
+// case-insensitively, like the filesystem does.
+func pathLockKey(rel string) string {
+	key := strings.Trim(strings.ReplaceAll(rel, `\`, "/"), "/")
+	if runtime.GOOS == "windows" {
+		key = strings.ToLower(key)
+	}
+	return key
+}
+
+// lock acquires every path, exclusive or shared, and returns the function
+// that releases them. Paths are locked in sorted order so that two
+// multi-path operations can't deadlock each other.
+func (l *pathLocks) lock(ctx context.Context, rels []string, exclusive bool) (func(), error) {
+	keys := make([]string, 0, len(rels))
+	seen := make(map[string]bool, len(rels))
+	for _, rel := range rels {
+		key := pathLockKey(rel)
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	held := make([]string, 0, len(keys))
+	release := func() {
+		for i := len(held) - 1; i >= 0; i-- {
+			l.release(held[i], exclusive)
+		}
+	}
+	for _, key := range keys {
+		if err := l.acquire(ctx, key, exclusive); err != nil {
+			release()
+			return nil, err
+		}
+		held = append(held, key)
+	}
+	return release, nil
+}
+
+func (l *pathLocks) acquire(ctx context.Context, key string, exclusive bool) error {
+	l.mu.Lock()
+	st := l.locks[key]
+	if st == nil {
+		st = &pathLockState{changed: make(chan struct{})}
+		l.locks[key] = st
+	}
+	st.refs++
+	if exclusive {
+		st.writersWaiting++
+	}
+	for {
+		if exclusive && !st.writer && st.readers == 0 {
+			st.writersWaiting--
+			st.writer = true
+			l.mu.Unlock()
+			return nil
+		}
+		if !exclusive && !st.writer && st.writersWaiting == 0 {
+			st.readers++
+			l.mu.Unlock()
+			return nil
+		}
+		changed := st.changed
+		l.mu.Unlock()
+		select {
+		case <-changed:
+			l.mu.Lock()
+		case <-ctx.Done():
+			l.mu.Lock()
+			if exclusive {
+				st.writersWaiting--
+				// Readers may have been queued behind us.
+				l.notifyLocked(st)
+			}
+			l.unrefLocked(key, st)
+			l.mu.Unlock()
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *pathLocks) release(key string, exclusive bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	st := l.locks[key]
+	if st == nil {
+		return
+	}
+	if exclusive {
+		st.writer = false
+	} else {
+		st.readers--
+	}
+	l.notifyLocked(st)
+	l.unrefLocked(key, st)
+}
+
+func (l *pathLocks) notifyLocked(st *pathLockState) {
+	close(st.changed)
+	st.changed = make(chan struct{})
+}
+
+func (l *pathLocks) unrefLocked(key string, st *pathLockState) {
+	st.refs--
+	if st.refs == 0 {
+		delete(l.locks, key)
+	}
+}
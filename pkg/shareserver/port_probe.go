@@ -0,0 +1,94 @@
+package shareserver
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// SettingKeyAutoReclaimPort (JSON bool) moves a share that fell back to a
+// random port onto the custom port as soon as the probe finds it free.
+const SettingKeyAutoReclaimPort = "local-share:auto-reclaim-custom-port"
+
+// defaultPortProbeInterval is how often a share on a fallback port checks
+// whether the custom port has been freed.
+const defaultPortProbeInterval = 60 * time.Second
+
+// startPortProbeLocked starts probing for the custom port. It is called with
+// s.mu held when Start had to fall back; stopLocked ends the probe.
+func (s *Server) startPortProbeLocked() {
+	if s.portProbeStop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	s.portProbeStop = stop
+	interval := s.portProbeInterval
+	if interval <= 0 {
+		interval = defaultPortProbeInterval
+	}
+	go s.runPortProbe(stop, interval)
+}
+
+func (s *Server) stopPortProbeLocked() {
+	if s.portProbeStop != nil {
+		close(s.portProbeStop)
+		s.portProbeStop = nil
+	}
+}
+
+// runPortProbe binds the custom port and closes it again right away, so an
+// app that wants the port meanwhile only ever loses a race measured in
+// microseconds. The first success is reported once (and, if the setting is
+// on, acted on); after that the probe ends.
+func (s *Server) runPortProbe(stop <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		want, ok, err := s.getCustomPortFromSettings()
+		if err != nil || !ok {
+			continue
+		}
+		s.mu.RLock()
+		running := s.server != nil
+		current := s.port
+		s.mu.RUnlock()
+		if !running || current == want {
+			return
+		}
+
+		ln, err := listenTCP(context.Background(), want)
+		if err != nil {
+			continue
+		}
+		_ = ln.Close()
+
+		// Stopped while probing: the share is gone, don't report or switch.
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		switched := false
+		if s.getBoolSetting(SettingKeyAutoReclaimPort) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			if _, err := s.ApplyCustomPorts(ctx, strconv.Itoa(want)); err != nil {
+				s.logf("custom port %d free but switching failed err=%v", want, err)
+			} else {
+				switched = true
+			}
+			cancel()
+		}
+		s.logf("custom port %d available switched=%v", want, switched)
+		if s.onCustomPortAvailable != nil {
+			s.onCustomPortAvailable(want, switched)
+		}
+		return
+	}
+}
@@ -0,0 +1,90 @@
+package shareserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SettingKeyPortRedirect (JSON bool) also listens on port 80 (or 8080 when 80
+// is taken) while sharing, redirecting there to the real URL, so a phone user
+// can type just the IP. SetSetting applies it to a running share.
+const SettingKeyPortRedirect = "local-share:port-redirect"
+
+// defaultRedirectPorts are tried in order; the first free one is used.
+var defaultRedirectPorts = []int{80, 8080}
+
+// startRedirectLocked binds the redirect listener if the setting is on and a
+// well-known port is free. Called with s.mu held after the share server is
+// committed; stopLocked tears it down.
+func (s *Server) startRedirectLocked() {
+	if s.redirectServer != nil || s.server == nil || !s.getBoolSetting(SettingKeyPortRedirect) {
+		return
+	}
+	ports := s.redirectPorts
+	if ports == nil {
+		ports = defaultRedirectPorts
+	}
+	for _, port := range ports {
+		if port == s.port {
+			// Already the real port: nothing to redirect.
+			return
+		}
+		ln, err := listenTCP(context.Background(), port)
+		if err != nil {
+			s.logf("port redirect: port %d unavailable err=%v", port, err)
+			continue
+		}
+		srv := &http.Server{
+			Handler:           http.HandlerFunc(s.handlePortRedirect),
+			ReadHeaderTimeout: 10 * time.Second,
+			IdleTimeout:       30 * time.Second,
+		}
+		s.redirectServer = srv
+		s.redirectPort = port
+		go func() {
+			if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				s.logf("port redirect stopped err=%v", err)
+			}
+		}()
+		return
+	}
+}
+
+func (s *Server) stopRedirectLocked() {
+	if s.redirectServer == nil {
+		return
+	}
+	// It never serves content: no need to wait for anything.
+	_ = s.redirectServer.Close()
+	s.redirectServer = nil
+	s.redirectPort = 0
+}
+
+// handlePortRedirect sends every request to the same path and query on the
+// share's real port on the share's own address. The Host header is the
+// client's to choose, so it never picks where the redirect goes.
+func (s *Server) handlePortRedirect(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	port := s.port
+	host := s.localIP
+	s.mu.RUnlock()
+	if port == 0 {
+		http.Error(w, "共享已停止", http.StatusServiceUnavailable)
+		return
+	}
+	// Every path lives under the base path on the real port.
+	uri := r.URL.RequestURI()
+	if base := s.basePath(); base != "" && uri != base && !strings.HasPrefix(uri, base+"/") && !strings.HasPrefix(uri, base+"?") {
+		uri = base + uri
+	}
+	target := fmt.Sprintf("http://%s%s", net.JoinHostPort(host, strconv.Itoa(port)), uri)
+	// The real port can differ next time: don't let browsers cache the 301.
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, target, http.StatusMovedPermanently)
+}
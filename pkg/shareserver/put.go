@@ -0,0 +1,302 @@
+package shareserver
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Conflict policies of PUT /api/put/ (?conflict=).
+const (
+	// putConflictOverwrite replaces an existing file; that needs the delete
+	// permission, as for /api/upload. The default.
+	putConflictOverwrite = "overwrite"
+	// putConflictFail answers 409 UPLOAD_EXISTS when the name is taken.
+	putConflictFail = "fail"
+	// putConflictRename picks a free "name (1).ext".
+	putConflictRename = "rename"
+)
+
+// putMaxRenames is how many "name (n).ext" candidates rename tries.
+const putMaxRenames = 999
+
+// handlePut stores the raw request body at the share-relative path after
+// /api/put/, for `curl -T file http://host/api/put/dir/file`. Content-MD5
+// (base64) and X-Content-Sha256 (hex) are verified when sent. The answer has
+// the shape of /api/upload's.
+func (s *Server) handlePut(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		w.Header().Set("Allow", http.MethodPut)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "仅支持 PUT"})
+		return
+	}
+
+	s.mu.RLock()
+	root := s.sharedRoot
+	s.mu.RUnlock()
+	if root == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "服务未启动"})
+		return
+	}
+	if !s.requireAuth(w, r) {
+		return
+	}
+	perms := s.getPermissionsFromSettings()
+	if !perms.Write {
+		writeJSON(w, http.StatusForbidden, map[string]string{
+			"error": "无写入权限",
+			"code":  "PERMISSION_DENIED_WRITE",
+		})
+		return
+	}
+
+	rel := strings.TrimPrefix(r.URL.Path, "/api/put/")
+	if rel == "" || strings.HasSuffix(rel, "/") {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "缺少文件路径"})
+		return
+	}
+	outPath, ok := s.resolveSharePath(w, r, root, rel)
+	if !ok {
+		return
+	}
+	if relativeSharePath(root, outPath) == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "缺少文件路径"})
+		return
+	}
+
+	policy := r.URL.Query().Get("conflict")
+	switch policy {
+	case "":
+		policy = putConflictOverwrite
+	case putConflictOverwrite, putConflictFail, putConflictRename:
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "conflict 只能是 overwrite、fail 或 rename"})
+		return
+	}
+
+	var checks []putChecksum
+	if v := r.Header.Get("Content-MD5"); v != "" {
+		sum, err := base64.StdEncoding.DecodeString(v)
+		if err != nil || len(sum) != md5.Size {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Content-MD5 格式错误"})
+			return
+		}
+		checks = append(checks, putChecksum{"Content-MD5", md5.New(), sum})
+	}
+	if v := r.Header.Get("X-Content-Sha256"); v != "" {
+		sum, err := hex.DecodeString(v)
+		if err != nil || len(sum) != sha256.Size {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "X-Content-Sha256 格式错误"})
+			return
+		}
+		checks = append(checks, putChecksum{"X-Content-Sha256", sha256.New(), sum})
+	}
+
+	ip := s.clientIP(r)
+	quota, quotaEnabled := s.getUploadQuotaFromSettings()
+	if quotaEnabled && s.stats.uploadedBytes(ip) >= quota {
+		s.writeUploadQuotaExceeded(w, ip, quota)
+		return
+	}
+	// Errors tell the client its remaining quota too, as success does.
+	uploadErr := func(status int, body map[string]string) {
+		s.writeUploadError(w, status, body, ip, quota, quotaEnabled)
+	}
+
+	// Fail early on a taken name when the body would be wasted anyway.
+	if st, err := os.Stat(outPath); err == nil {
+		if st.IsDir() && policy != putConflictRename {
+			uploadErr(http.StatusConflict, map[string]string{"error": "已存在同名目录", "code": "UPLOAD_EXISTS"})
+			return
+		}
+		if policy == putConflictFail {
+			uploadErr(http.StatusConflict, map[string]string{"error": "已存在同名文件", "code": "UPLOAD_EXISTS"})
+			return
+		}
+		if policy == putConflictOverwrite && !perms.Delete {
+			uploadErr(http.StatusForbidden, map[string]string{"error": "无删除权限，不能覆盖同名文件", "code": "PERMISSION_DENIED_DELETE"})
+			return
+		}
+	}
+
+	// Missing folders are only created once the upload is accepted; until
+	// then the body goes to the closest folder that exists.
+	dir := filepath.Dir(outPath)
+	tmpDir, err := nearestExistingDir(root, dir)
+	if err != nil {
+		uploadErr(http.StatusInternalServerError, map[string]string{"error": "创建目录失败"})
+		return
+	}
+
+	// Same limit as /api/upload.
+	body := http.MaxBytesReader(w, r.Body, 10*1024*1024*1024)
+	tmp, err := createUploadTemp(tmpDir)
+	if err != nil {
+		uploadErr(http.StatusInternalServerError, map[string]string{"error": "写入文件失败"})
+		return
+	}
+	dst := io.Writer(tmp)
+	for _, c := range checks {
+		dst = io.MultiWriter(dst, c.h)
+	}
+	src := &quotaReader{r: body, stats: s.stats, ip: ip, limit: quota}
+	size, copyErr := io.Copy(dst, src)
+	closeErr := tmp.Close()
+	fail := func() {
+		src.refund()
+		_ = os.Remove(tmp.Name())
+	}
+	if copyErr != nil || closeErr != nil {
+		fail()
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.Is(copyErr, errUploadQuotaExceeded):
+			s.writeUploadQuotaExceeded(w, ip, quota)
+		case errors.As(copyErr, &tooLarge):
+			uploadErr(http.StatusRequestEntityTooLarge, map[string]string{"error": "文件过大"})
+		default:
+			uploadErr(http.StatusInternalServerError, map[string]string{"error": "写入文件失败"})
+		}
+		return
+	}
+	for _, c := range checks {
+		if !bytes.Equal(c.h.Sum(nil), c.want) {
+			fail()
+			uploadErr(http.StatusBadRequest, map[string]string{
+				"error": c.header + " 校验失败，文件内容与发送时不一致",
+				"code":  "CHECKSUM_MISMATCH",
+			})
+			return
+		}
+	}
+	if s.getBoolSetting(SettingKeyMarkUploads) {
+		if err := writeZoneIdentifier(tmp.Name()); err != nil {
+			s.logf("mark upload %q from web failed: %v", rel, err)
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		fail()
+		uploadErr(http.StatusInternalServerError, map[string]string{"error": "创建目录失败"})
+		return
+	}
+	unlock, finalPath, status, errBody := s.claimPutPath(r, root, outPath, policy, perms.Delete)
+	if unlock == nil {
+		fail()
+		if status != 0 {
+			uploadErr(status, errBody)
+		}
+		return
+	}
+	renameErr := renameUploaded(tmp.Name(), finalPath)
+	if renameErr != nil && (policy != putConflictOverwrite || !perms.Delete) {
+		// Drop our placeholder.
+		_ = os.Remove(finalPath)
+	}
+	unlock()
+	if renameErr != nil {
+		fail()
+		if isFileLockedError(renameErr) {
+			uploadErr(http.StatusConflict, map[string]string{
+				"error": "文件被占用（可能正在被杀毒软件扫描），请稍后重试",
+				"code":  "UPLOAD_FILE_LOCKED",
+			})
+			return
+		}
+		uploadErr(http.StatusInternalServerError, map[string]string{"error": "写入文件失败"})
+		return
+	}
+
+	finalRel := relativeSharePath(root, finalPath)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"success": true,
+		"message": "成功上传 1 个文件",
+		"files": []uploadedFile{{
+			Name:   path.Base(finalRel),
+			Size:   size,
+			Path:   finalRel,
+			Status: "uploaded",
+		}},
+		"quotaRemaining": s.uploadQuotaRemaining(ip, quota, quotaEnabled),
+	})
+}
+
+// nearestExistingDir returns dir, or its closest ancestor that exists, but
+// never one above root.
+func nearestExistingDir(root, dir string) (string, error) {
+	root = filepath.Clean(root)
+	for dir = filepath.Clean(dir); ; dir = filepath.Dir(dir) {
+		st, err := os.Stat(dir)
+		if err == nil {
+			if !st.IsDir() {
+				return "", fmt.Errorf("%s is not a directory", dir)
+			}
+			return dir, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) || dir == root || filepath.Dir(dir) == dir {
+			return "", err
+		}
+	}
+}
+
+type putChecksum struct {
+	header string
+	h      hash.Hash
+	want   []byte
+}
+
+// claimPutPath locks the name the upload will take and, unless it may
+// replace an existing file, claims it with O_EXCL (see claimUploadPath). On
+// failure unlock is nil and status/body is the response (status 0: the
+// client is gone).
+func (s *Server) claimPutPath(r *http.Request, root, outPath, policy string, canDelete bool) (unlock func(), finalPath string, status int, body map[string]string) {
+	candidates := []string{outPath}
+	if policy == putConflictRename {
+		ext := filepath.Ext(outPath)
+		stem := strings.TrimSuffix(outPath, ext)
+		for i := 1; i <= putMaxRenames; i++ {
+			candidates = append(candidates, fmt.Sprintf("%s (%d)%s", stem, i, ext))
+		}
+	}
+	for _, p := range candidates {
+		unlock, err := s.pathLocks.lock(r.Context(), []string{relativeSharePath(root, p)}, true)
+		if err != nil {
+			return nil, "", 0, nil
+		}
+		if policy == putConflictOverwrite && canDelete {
+			if st, err := os.Stat(p); err == nil && st.IsDir() {
+				unlock()
+				return nil, "", http.StatusConflict, map[string]string{"error": "已存在同名目录", "code": "UPLOAD_EXISTS"}
+			}
+			return unlock, p, 0, nil
+		}
+		msg, denied, err := s.claimUploadPath(p)
+		if err != nil {
+			unlock()
+			return nil, "", http.StatusInternalServerError, map[string]string{"error": "写入文件失败"}
+		}
+		if !denied {
+			return unlock, p, 0, nil
+		}
+		unlock()
+		switch policy {
+		case putConflictOverwrite:
+			return nil, "", http.StatusForbidden, map[string]string{"error": msg, "code": "PERMISSION_DENIED_DELETE"}
+		case putConflictFail:
+			return nil, "", http.StatusConflict, map[string]string{"error": "已存在同名文件", "code": "UPLOAD_EXISTS"}
+		}
+	}
+	return nil, "", http.StatusConflict, map[string]string{"error": "同名文件过多，请换个文件名", "code": "UPLOAD_EXISTS"}
+}
@@ -0,0 +1,83 @@
+package shareserver
+
+import (
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxInlineReadmeBytes caps the README /api/files embeds with
+// inlineReadme=1; bigger ones are fetched through /api/preview.
+const maxInlineReadmeBytes = 64 << 10
+
+// readmeInfo points at the README of a listed folder so the web UI can show
+// it above the file list.
+type readmeInfo struct {
+	// Path is share-relative, ready for /api/preview.
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	// Content is the README itself with inlineReadme=1, when it is at most
+	// maxInlineReadmeBytes of UTF-8.
+	Content *string `json:"content,omitempty"`
+}
+
+// readmeRank is how good name is as the folder's README, lower is better;
+// -1 means it isn't one. Matching ignores case.
+func readmeRank(name string) int {
+	switch strings.ToLower(name) {
+	case "readme.md":
+		return 0
+	case "readme.txt":
+		return 1
+	}
+	return -1
+}
+
+// readmeFinder remembers the best README among the items it is shown, so the
+// listing pass finds it without reading the folder again.
+type readmeFinder struct {
+	item *DirectoryItem
+	rank int
+}
+
+func (f *readmeFinder) observe(batch []DirectoryItem) {
+	for i := range batch {
+		it := &batch[i]
+		if it.Type != "file" || it.Hidden {
+			continue
+		}
+		rank := readmeRank(it.Name)
+		if rank < 0 || (f.item != nil && rank >= f.rank) {
+			continue
+		}
+		found := *it
+		f.item, f.rank = &found, rank
+	}
+}
+
+// info describes the README found in dirPath, listed as relDir; with inline
+// its content is embedded when small enough.
+func (f *readmeFinder) info(dirPath, relDir string, inline bool) *readmeInfo {
+	if f.item == nil {
+		return nil
+	}
+	info := &readmeInfo{Path: path.Join(relDir, f.item.Name), Size: f.item.Size}
+	if !inline || f.item.Size > maxInlineReadmeBytes {
+		return info
+	}
+	file, err := openShared(filepath.Join(dirPath, f.item.Name))
+	if err != nil {
+		return info
+	}
+	defer file.Close()
+	b, err := io.ReadAll(io.LimitReader(file, maxInlineReadmeBytes+1))
+	if err != nil || len(b) > maxInlineReadmeBytes || !utf8.Valid(b) {
+		return info
+	}
+	// Notepad starts UTF-8 files with a byte order mark.
+	content := strings.TrimPrefix(string(b), "\uFEFF")
+	info.Content = &content
+	return info
+}
@@ -0,0 +1,48 @@
+package shareserver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+// recoverPanics turns a handler panic into a logged stack trace plus a JSON 500
+// carrying an ID the user can quote, instead of a silently dropped connection.
+func (s *Server) recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, logf: s.logf}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				// Deliberate abort: keep net/http's behaviour.
+				panic(v)
+			}
+			id := newPanicID()
+			s.logf("panic id=%s %s %s: %v\n%s", id, r.Method, redactedRequestPath(r.URL), v, debug.Stack())
+			if rec.status == 0 {
+				writeJSON(rec, http.StatusInternalServerError, map[string]string{
+					"error": "服务器内部错误",
+					"code":  "INTERNAL_ERROR",
+					"id":    id,
+				})
+			}
+			if s.onPanic != nil {
+				s.onPanic(id, fmt.Sprint(v))
+			}
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+func newPanicID() string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package shareserver
+
+// isRemovableDrive is only implemented on Windows.
+func isRemovableDrive(path string) bool {
+	return false
+}
@@ -0,0 +1,19 @@
+//go:build windows
+
+package shareserver
+
+import "golang.org/x/sys/windows"
+
+// isRemovableDrive reports whether path is on removable media such as a USB
+// stick. Folders mounted into another volume resolve to their own volume.
+func isRemovableDrive(path string) bool {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return false
+	}
+	buf := make([]uint16, windows.MAX_LONG_PATH)
+	if err := windows.GetVolumePathName(p, &buf[0], uint32(len(buf))); err != nil {
+		return false
+	}
+	return windows.GetDriveType(&buf[0]) == windows.DRIVE_REMOVABLE
+}
@@ -0,0 +1,108 @@
+package shareserver
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// Reasons passed to Options.OnShareRootLost and in the serverStopping event.
+const (
+	ShareRootLostDeviceRemoved = "device removed"
+	ShareRootLostUnavailable   = "folder unavailable"
+)
+
+const (
+	// defaultRootCheckInterval is how often a running share stats its root.
+	defaultRootCheckInterval = 3 * time.Second
+	// rootCheckFailures failed checks in a row count as lost, so a drive that
+	// is slow to wake up doesn't end the share.
+	rootCheckFailures = 3
+)
+
+// startRootCheckLocked starts watching the shared root; called with s.mu
+// held, stopLocked ends it.
+func (s *Server) startRootCheckLocked() {
+	if s.rootCheckStop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	s.rootCheckStop = stop
+	interval := s.rootCheckInterval
+	if interval <= 0 {
+		interval = defaultRootCheckInterval
+	}
+	go s.runRootCheck(stop, interval)
+}
+
+func (s *Server) stopRootCheckLocked() {
+	if s.rootCheckStop != nil {
+		close(s.rootCheckStop)
+		s.rootCheckStop = nil
+	}
+}
+
+func (s *Server) runRootCheck(stop <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	failures := 0
+	lastRoot := ""
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		s.mu.RLock()
+		root := s.sharedRoot
+		s.mu.RUnlock()
+		if root != lastRoot {
+			// Sharing another folder starts over.
+			lastRoot, failures = root, 0
+		}
+		if st, err := os.Stat(root); err == nil && st.IsDir() {
+			failures = 0
+			continue
+		}
+		if failures++; failures >= rootCheckFailures {
+			s.shareRootLost(stop, root)
+			return
+		}
+	}
+}
+
+// shareRootLost stops a share whose folder is gone, telling web clients why
+// first. The remembered share stays active, as on Shutdown, so it can be
+// resumed once the drive is back.
+func (s *Server) shareRootLost(stop <-chan struct{}, root string) {
+	s.opMu.Lock()
+	s.mu.Lock()
+	select {
+	case <-stop:
+		// Stopped or restarted meanwhile.
+		s.mu.Unlock()
+		s.opMu.Unlock()
+		return
+	default:
+	}
+	if s.server == nil || s.sharedRoot != root {
+		s.mu.Unlock()
+		s.opMu.Unlock()
+		return
+	}
+	reason := ShareRootLostUnavailable
+	if s.rootRemovable {
+		reason = ShareRootLostDeviceRemoved
+	}
+	if s.events != nil {
+		s.events.broadcast("serverStopping", map[string]string{"reason": reason})
+	}
+	err := s.stopLocked(context.Background())
+	s.mu.Unlock()
+	s.opMu.Unlock()
+
+	s.logf("shared folder lost root=%q reason=%s stop err=%v", root, reason, err)
+	if s.onShareRootLost != nil {
+		s.onShareRootLost(root, reason)
+	}
+}
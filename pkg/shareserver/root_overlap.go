@@ -0,0 +1,59 @@
+package shareserver
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// How a newly requested share root relates to the one already shared
+// (RootOverlap.Relation).
+const (
+	// RootOverlapSame: the same folder is shared again.
+	RootOverlapSame = "same"
+	// RootOverlapInside: the new root is a subfolder of the shared one.
+	RootOverlapInside = "inside"
+	// RootOverlapContains: the new root contains the shared one.
+	RootOverlapContains = "contains"
+)
+
+// WarningRootOverlap: Start replaced a share root that overlaps the new one;
+// StartResult.Overlap has the details.
+const WarningRootOverlap = "rootOverlap"
+
+// RootOverlap describes the share root a Start call replaced when the two
+// folders are the same or nested, so the UI can offer to go back.
+type RootOverlap struct {
+	Previous string `json:"previous"`
+	Relation string `json:"relation"`
+}
+
+// rootRelation returns how requested relates to existing (RootOverlapSame,
+// RootOverlapInside, RootOverlapContains) or "" when they are disjoint. Both
+// are absolute; foldCase compares them like a case-insensitive file system.
+func rootRelation(existing, requested string, foldCase bool) string {
+	existing = filepath.Clean(existing)
+	requested = filepath.Clean(requested)
+	if foldCase {
+		existing = strings.ToLower(existing)
+		requested = strings.ToLower(requested)
+	}
+	if existing == requested {
+		return RootOverlapSame
+	}
+	if isWithinDir(existing, requested) {
+		return RootOverlapInside
+	}
+	if isWithinDir(requested, existing) {
+		return RootOverlapContains
+	}
+	return ""
+}
+
+// isWithinDir reports whether p lies below dir.
+func isWithinDir(dir, p string) bool {
+	rel, err := filepath.Rel(dir, p)
+	if err != nil || rel == "." || filepath.IsAbs(rel) {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,130 @@
+package shareserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// SettingKeyAutoRestart (JSON bool) shares the same folder again when the
+// server stopped by error, up to autoRestartTries times with backoff.
+const SettingKeyAutoRestart = "local-share:auto-restart"
+
+const (
+	autoRestartTries = 5
+	// defaultAutoRestartBackoff doubles after every failed try, up to
+	// maxAutoRestartBackoff.
+	defaultAutoRestartBackoff = time.Second
+	maxAutoRestartBackoff     = 30 * time.Second
+)
+
+// serve runs srv on ln until it is shut down. Any other end means nothing is
+// listening anymore: the share is stopped so GetServerInfo tells the truth.
+func (s *Server) serve(srv *http.Server, ln net.Listener) {
+	err := srv.Serve(ln)
+	if err == nil || errors.Is(err, http.ErrServerClosed) {
+		return
+	}
+	s.serveFailed(srv, err)
+}
+
+func (s *Server) serveFailed(srv *http.Server, err error) {
+	s.opMu.Lock()
+	s.mu.Lock()
+	if s.server != srv {
+		// Stopped or replaced meanwhile (e.g. ApplyCustomPorts).
+		s.mu.Unlock()
+		s.opMu.Unlock()
+		return
+	}
+	root := s.sharedRoot
+	if s.events != nil {
+		s.events.broadcast("serverStopping", map[string]string{"reason": "server failed"})
+	}
+	stopErr := s.stopLocked(context.Background())
+	restart := s.getBoolSetting(SettingKeyAutoRestart)
+	var stop chan struct{}
+	if restart {
+		stop = make(chan struct{})
+		s.restartStop = stop
+	}
+	s.mu.Unlock()
+	s.opMu.Unlock()
+
+	// Like a lost folder, the remembered share stays active.
+	s.logf("share server failed root=%q err=%v stop err=%v restart=%v", root, err, stopErr, restart)
+	if s.onShareFailed != nil {
+		s.onShareFailed(root, err, restart)
+	}
+	if restart {
+		go s.runAutoRestart(stop, root)
+	}
+}
+
+func (s *Server) stopRestartLocked() {
+	if s.restartStop != nil {
+		close(s.restartStop)
+		s.restartStop = nil
+	}
+}
+
+// runAutoRestart tries to share root again until it works, the tries run out,
+// or the share is stopped or started by someone else.
+func (s *Server) runAutoRestart(stop <-chan struct{}, root string) {
+	delay := s.restartBackoff
+	if delay <= 0 {
+		delay = defaultAutoRestartBackoff
+	}
+	var err error
+	for attempt := 1; attempt <= autoRestartTries; attempt++ {
+		timer := time.NewTimer(delay)
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if delay *= 2; delay > maxAutoRestartBackoff {
+			delay = maxAutoRestartBackoff
+		}
+
+		s.mu.RLock()
+		running := s.server != nil
+		s.mu.RUnlock()
+		if running {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		var res *StartResult
+		res, err = s.Start(ctx, root)
+		cancel()
+		if err == nil {
+			s.mu.Lock()
+			if s.restartStop == stop {
+				s.restartStop = nil
+			}
+			s.mu.Unlock()
+			s.logf("share restarted root=%q attempt=%d url=%s", root, attempt, res.Info.URL)
+			if s.onShareRestarted != nil {
+				s.onShareRestarted(root, attempt)
+			}
+			return
+		}
+		s.logf("share restart failed root=%q attempt=%d err=%v", root, attempt, err)
+	}
+
+	s.mu.Lock()
+	select {
+	case <-stop:
+		s.mu.Unlock()
+		return
+	default:
+	}
+	s.restartStop = nil
+	s.mu.Unlock()
+	if s.onShareFailed != nil {
+		s.onShareFailed(root, err, false)
+	}
+}
@@ -0,0 +1,75 @@
+package shareserver
+
+import "net/http"
+
+// sessionResponse tells the web UI what it may do, so it can hide actions
+// instead of discovering them through 401/403s.
+type sessionResponse struct {
+	// Authenticated is true for a valid token while a pass is required.
+	Authenticated bool `json:"authenticated"`
+	AuthRequired  bool `json:"authRequired"`
+	// Code says why a required token didn't pass, as in requireAuth's 401.
+	Code string `json:"code,omitempty"`
+	// TokenExpiresIn is in seconds, 0 without a valid token.
+	TokenExpiresIn int                `json:"tokenExpiresIn"`
+	Permissions    sessionPermissions `json:"permissions"`
+	ClientIP       string             `json:"clientIP"`
+	// DropboxMode: uploads are allowed but nothing can be listed or read.
+	DropboxMode bool `json:"dropboxMode"`
+	// ReadOnly: the host switched the whole share to read-only.
+	ReadOnly bool `json:"readOnly"`
+	// ShareExpiresIn is in seconds until the host's share stops by itself,
+	// 0 when it doesn't expire.
+	ShareExpiresIn int `json:"shareExpiresIn,omitempty"`
+}
+
+// sessionPermissions are the effective permissions: none until a required
+// pass has been given.
+type sessionPermissions struct {
+	Read   bool `json:"read"`
+	Write  bool `json:"write"`
+	Delete bool `json:"delete"`
+	// List follows Read, which /api/files requires.
+	List bool `json:"list"`
+}
+
+// handleSession never answers 401: a missing or stale token is reported in
+// the body.
+func (s *Server) handleSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	res, required, err := s.checkAuth(r)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "访问口令配置异常"})
+		return
+	}
+	allowed := res == authOK
+	perms := s.getPermissionsFromSettings()
+	resp := sessionResponse{
+		Authenticated: required && allowed,
+		AuthRequired:  required,
+		Permissions: sessionPermissions{
+			Read:   allowed && perms.Read,
+			Write:  allowed && perms.Write,
+			Delete: allowed && perms.Delete,
+			List:   allowed && perms.Read,
+		},
+		ClientIP:    s.clientIP(r),
+		DropboxMode: perms.Write && !perms.Read,
+		ReadOnly:    s.getBoolSetting(SettingKeyReadOnly),
+	}
+	s.mu.RLock()
+	resp.ShareExpiresIn = s.expiresInLocked()
+	s.mu.RUnlock()
+	if required && !allowed {
+		resp.Code = res.code()
+	}
+	if resp.Authenticated {
+		resp.TokenExpiresIn = int(s.auth.expiresIn(presentedToken(r)).Seconds())
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, resp)
+}
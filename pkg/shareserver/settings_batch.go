@@ -0,0 +1,115 @@
+package shareserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// maxSettingsBatchKeys caps one batch read or write.
+const maxSettingsBatchKeys = 100
+
+type settingsBatchResult struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+	Code  string `json:"code,omitempty"`
+}
+
+// handleSettingsBatch serves /api/settings without a key: GET ?keys=a,b,c
+// answers {"values": {...}} with the keys that are set (unknown and
+// desktop-only keys are left out, as the single-key route answers 404), and
+// PUT {"values": {...}} writes each key on its own, reporting per key.
+func (s *Server) handleSettingsBatch(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodPut:
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.requireAuth(w, r) {
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		var keys []string
+		for _, k := range strings.Split(r.URL.Query().Get("keys"), ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				keys = append(keys, k)
+			}
+		}
+		if len(keys) == 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "missing keys"})
+			return
+		}
+		if len(keys) > maxSettingsBatchKeys {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "too many keys"})
+			return
+		}
+		values := make(map[string]json.RawMessage, len(keys))
+		for _, key := range keys {
+			if httpHiddenSettingKeys[key] || !IsValidSettingKey(key) {
+				continue
+			}
+			raw, ok, err := s.settings.Get(key)
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "read settings failed"})
+				return
+			}
+			if ok {
+				values[key] = raw
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"values": values})
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1024*1024)
+	var req struct {
+		Values map[string]json.RawMessage `json:"values"`
+	}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+	if len(req.Values) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "missing values"})
+		return
+	}
+	if len(req.Values) > maxSettingsBatchKeys {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "too many keys"})
+		return
+	}
+
+	origin := settingOrigin{source: SettingOriginWeb, clientIP: s.clientIP(r)}
+	results := make(map[string]settingsBatchResult, len(req.Values))
+	allOK := true
+	for key, value := range req.Values {
+		res := s.putSettingFromWeb(key, value, origin)
+		results[key] = res
+		allOK = allOK && res.OK
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": allOK, "results": results})
+}
+
+// putSettingFromWeb writes one key of a batch with the checks of the
+// single-key route; null deletes.
+func (s *Server) putSettingFromWeb(key string, value json.RawMessage, origin settingOrigin) settingsBatchResult {
+	if httpHiddenSettingKeys[key] {
+		return settingsBatchResult{Error: "not found", Code: "SETTING_NOT_FOUND"}
+	}
+	if !IsValidSettingKey(key) {
+		return settingsBatchResult{Error: "invalid key", Code: "SETTING_INVALID_KEY"}
+	}
+	if len(value) == 0 || string(value) == "null" {
+		value = nil
+	} else if !json.Valid(value) {
+		return settingsBatchResult{Error: "invalid json value", Code: "SETTING_INVALID_VALUE"}
+	}
+	if err := s.setSettingFrom(key, value, origin); err != nil {
+		return settingsBatchResult{Error: "save setting failed", Code: "SETTING_SAVE_FAILED"}
+	}
+	return settingsBatchResult{OK: true}
+}
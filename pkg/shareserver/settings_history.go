@@ -0,0 +1,220 @@
+package shareserver
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// settingHistoryLimit is how many changes SettingsStore keeps per key.
+const settingHistoryLimit = 5
+
+// settingHistorySecretKeys are recorded as hashes only, never as values.
+var settingHistorySecretKeys = map[string]bool{
+	SettingKeyAccessPass: true,
+	SettingKeyAdminPass:  true,
+}
+
+// Origins of a settings change.
+const (
+	SettingOriginDesktop = "desktop"
+	SettingOriginWeb     = "web"
+	// SettingOriginUnknown marks the value a key had before its history
+	// started, so the first recorded change can still be undone.
+	SettingOriginUnknown = "unknown"
+)
+
+var (
+	errSettingHistoryUnavailable = errors.New("当前设置存储不记录历史")
+	errSettingHistoryIndex       = errors.New("没有这条历史记录")
+	errSettingHistorySecret      = errors.New("此设置的历史只保存摘要，无法恢复")
+)
+
+// SettingHistoryEntry is one value a setting had, newest first in History.
+type SettingHistoryEntry struct {
+	// At is when the value was written (RFC3339); empty for SettingOriginUnknown.
+	At     string `json:"at,omitempty"`
+	Origin string `json:"origin"`
+	// ClientIP is set for SettingOriginWeb.
+	ClientIP string `json:"clientIP,omitempty"`
+	// Deleted means the key was removed.
+	Deleted bool            `json:"deleted,omitempty"`
+	Value   json.RawMessage `json:"value,omitempty"`
+	// ValueHash (sha256, hex) stands in for Value on secret keys.
+	ValueHash string `json:"valueHash,omitempty"`
+}
+
+type settingOrigin struct {
+	source   string
+	clientIP string
+}
+
+// settingsWithHistory is implemented by SettingsStore. Other Settings work
+// too, just without origins or history.
+type settingsWithHistory interface {
+	setFrom(key string, value json.RawMessage, origin settingOrigin) error
+	History(key string) []SettingHistoryEntry
+	Revert(key string, index int) error
+}
+
+// historyPath is settings.json's sibling settings.history.json.
+func (s *SettingsStore) historyPath() string {
+	return strings.TrimSuffix(s.path, filepath.Ext(s.path)) + ".history.json"
+}
+
+func (s *SettingsStore) loadHistoryLocked() {
+	s.history = map[string][]SettingHistoryEntry{}
+	b, err := os.ReadFile(s.historyPath())
+	if err != nil || len(b) == 0 {
+		return
+	}
+	var m map[string][]SettingHistoryEntry
+	// Like settings.json, a corrupted file just starts over.
+	if json.Unmarshal(b, &m) == nil && m != nil {
+		s.history = m
+	}
+}
+
+func (s *SettingsStore) saveHistoryLocked() error {
+	b, err := json.MarshalIndent(s.history, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := s.historyPath()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func newSettingHistoryEntry(key string, value json.RawMessage, origin settingOrigin, at time.Time) SettingHistoryEntry {
+	e := SettingHistoryEntry{Origin: origin.source, ClientIP: origin.clientIP}
+	if !at.IsZero() {
+		e.At = at.UTC().Format(time.RFC3339)
+	}
+	switch {
+	case value == nil:
+		e.Deleted = true
+	case settingHistorySecretKeys[key]:
+		sum := sha256.Sum256(value)
+		e.ValueHash = hex.EncodeToString(sum[:])
+	default:
+		e.Value = append(json.RawMessage(nil), value...)
+	}
+	return e
+}
+
+// recordLocked adds the change of key from old (had reports whether it
+// existed) to value, trimming to settingHistoryLimit. Rewriting the same
+// value is not a change.
+func (s *SettingsStore) recordLocked(key string, old json.RawMessage, had bool, value json.RawMessage, origin settingOrigin) {
+	if had == (value != nil) && bytes.Equal(old, value) {
+		return
+	}
+	if s.history == nil {
+		s.history = map[string][]SettingHistoryEntry{}
+	}
+	list := s.history[key]
+	if len(list) == 0 && had {
+		list = append(list, newSettingHistoryEntry(key, old, settingOrigin{source: SettingOriginUnknown}, time.Time{}))
+	}
+	list = append(list, newSettingHistoryEntry(key, value, origin, time.Now()))
+	if len(list) > settingHistoryLimit {
+		list = append([]SettingHistoryEntry(nil), list[len(list)-settingHistoryLimit:]...)
+	}
+	s.history[key] = list
+}
+
+func (s *SettingsStore) setFrom(key string, value json.RawMessage, origin settingOrigin) error {
+	if err := s.update(func() {
+		old, had := s.data[key]
+		if value == nil {
+			delete(s.data, key)
+		} else {
+			s.data[key] = value
+		}
+		s.recordLocked(key, old, had, value, origin)
+	}); err != nil {
+		return err
+	}
+	s.watchers.notify(key, value)
+	return nil
+}
+
+// History returns the recorded values of key, newest first. Index 0 is the
+// current value unless the key was changed by other means since.
+func (s *SettingsStore) History(key string) []SettingHistoryEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(); err != nil {
+		return nil
+	}
+	list := s.history[key]
+	out := make([]SettingHistoryEntry, len(list))
+	for i, e := range list {
+		out[len(list)-1-i] = e
+	}
+	return out
+}
+
+// Revert writes back the value at index of History(key), recording it as a
+// new desktop change. Secret keys can't be reverted.
+func (s *SettingsStore) Revert(key string, index int) error {
+	list := s.History(key)
+	if index < 0 || index >= len(list) {
+		return errSettingHistoryIndex
+	}
+	e := list[index]
+	if e.ValueHash != "" {
+		return errSettingHistorySecret
+	}
+	var value json.RawMessage
+	if !e.Deleted {
+		value = e.Value
+	}
+	return s.setFrom(key, value, settingOrigin{source: SettingOriginDesktop})
+}
+
+// setSettingFrom writes (nil deletes) a setting, recording origin when the
+// store keeps history.
+func (s *Server) setSettingFrom(key string, value json.RawMessage, origin settingOrigin) error {
+	if s.settings == nil {
+		return errSettingsUnavailable
+	}
+	if h, ok := s.settings.(settingsWithHistory); ok {
+		return h.setFrom(key, value, origin)
+	}
+	if value == nil {
+		return s.settings.Delete(key)
+	}
+	return s.settings.Set(key, value)
+}
+
+// SettingHistory returns the recent values of key, newest first.
+func (s *Server) SettingHistory(key string) ([]SettingHistoryEntry, error) {
+	h, ok := s.settings.(settingsWithHistory)
+	if !ok {
+		return nil, errSettingHistoryUnavailable
+	}
+	return h.History(key), nil
+}
+
+// RevertSetting restores the value at index of SettingHistory(key).
+func (s *Server) RevertSetting(key string, index int) error {
+	h, ok := s.settings.(settingsWithHistory)
+	if !ok {
+		return errSettingHistoryUnavailable
+	}
+	if err := h.Revert(key, index); err != nil {
+		return err
+	}
+	s.applySetting(key)
+	return nil
+}
@@ -0,0 +1,238 @@
+package shareserver
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// SettingsStore persists settings as a JSON object in a single file.
+type SettingsStore struct {
+	mu     sync.Mutex
+	path   string
+	loaded bool
+	data   map[string]json.RawMessage
+
+	// overrides shadow persisted values for this process only (e.g. headless CLI flags).
+	overrides map[string]json.RawMessage
+
+	watchers settingsWatchers
+
+	// history is the recent changes per key, kept in settings.history.json.
+	history map[string][]SettingHistoryEntry
+}
+
+// configDir is <UserConfigDir>/local-share-golang, where settings and logs live.
+func configDir() string {
+	cfgDir, err := os.UserConfigDir()
+	if err != nil || cfgDir == "" {
+		cfgDir = "."
+	}
+	return filepath.Join(cfgDir, "local-share-golang")
+}
+
+// DefaultSettingsDir is the directory NewSettingsStore keeps settings.json in.
+func DefaultSettingsDir() string {
+	return configDir()
+}
+
+// NewSettingsStore uses <UserConfigDir>/local-share-golang/settings.json.
+func NewSettingsStore() *SettingsStore {
+	return NewSettingsStoreAt(filepath.Join(configDir(), "settings.json"))
+}
+
+// NewSettingsStoreAt uses the given settings file, created on first write.
+func NewSettingsStoreAt(path string) *SettingsStore {
+	return &SettingsStore{
+		path: path,
+		data: map[string]json.RawMessage{},
+	}
+}
+
+func (s *SettingsStore) loadLocked() error {
+	if s.loaded {
+		return nil
+	}
+	s.loaded = true
+
+	_ = os.MkdirAll(filepath.Dir(s.path), 0o755)
+	s.loadHistoryLocked()
+
+	b, err := os.ReadFile(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			s.data = map[string]json.RawMessage{}
+			return nil
+		}
+		return err
+	}
+	if len(b) == 0 {
+		s.data = map[string]json.RawMessage{}
+		return nil
+	}
+
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		// If the file is corrupted, don't brick the app; start fresh.
+		s.data = map[string]json.RawMessage{}
+		return nil
+	}
+	if m == nil {
+		m = map[string]json.RawMessage{}
+	}
+	s.data = m
+	return nil
+}
+
+func (s *SettingsStore) saveLocked() error {
+	_ = os.MkdirAll(filepath.Dir(s.path), 0o755)
+	b, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write then rename, so being killed mid-write (e.g. on logoff) can't
+	// leave a truncated settings.json behind.
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	return s.saveHistoryLocked()
+}
+
+func (s *SettingsStore) Get(key string) (json.RawMessage, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(); err != nil {
+		return nil, false, err
+	}
+	if v, ok := s.overrides[key]; ok {
+		return v, true, nil
+	}
+	v, ok := s.data[key]
+	if !ok {
+		return nil, false, nil
+	}
+	return v, true, nil
+}
+
+// Set stores value, recorded in the history as a desktop change.
+func (s *SettingsStore) Set(key string, value json.RawMessage) error {
+	if value == nil {
+		value = json.RawMessage("null")
+	}
+	return s.setFrom(key, value, settingOrigin{source: SettingOriginDesktop})
+}
+
+// Delete removes key, recorded in the history as a desktop change.
+func (s *SettingsStore) Delete(key string) error {
+	return s.setFrom(key, nil, settingOrigin{source: SettingOriginDesktop})
+}
+
+// update applies fn to the loaded data and saves it; watchers are notified
+// by the caller after the lock is released.
+func (s *SettingsStore) update(fn func()) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(); err != nil {
+		return err
+	}
+	if s.data == nil {
+		s.data = map[string]json.RawMessage{}
+	}
+	fn()
+	return s.saveLocked()
+}
+
+// Override makes Get return value for key without writing settings.json.
+func (s *SettingsStore) Override(key string, value json.RawMessage) {
+	s.mu.Lock()
+	if s.overrides == nil {
+		s.overrides = map[string]json.RawMessage{}
+	}
+	s.overrides[key] = value
+	s.mu.Unlock()
+	s.watchers.notify(key, value)
+}
+
+func (s *SettingsStore) Watch(fn func(key string, value json.RawMessage)) (stop func()) {
+	return s.watchers.add(fn)
+}
+
+// MemorySettings keeps settings in memory only; handy for tests and embedding.
+type MemorySettings struct {
+	mu       sync.Mutex
+	data     map[string]json.RawMessage
+	watchers settingsWatchers
+}
+
+func NewMemorySettings() *MemorySettings {
+	return &MemorySettings{data: map[string]json.RawMessage{}}
+}
+
+func (m *MemorySettings) Get(key string) (json.RawMessage, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.data[key]
+	return v, ok, nil
+}
+
+func (m *MemorySettings) Set(key string, value json.RawMessage) error {
+	m.mu.Lock()
+	m.data[key] = append(json.RawMessage(nil), value...)
+	m.mu.Unlock()
+	m.watchers.notify(key, value)
+	return nil
+}
+
+func (m *MemorySettings) Delete(key string) error {
+	m.mu.Lock()
+	delete(m.data, key)
+	m.mu.Unlock()
+	m.watchers.notify(key, nil)
+	return nil
+}
+
+func (m *MemorySettings) Watch(fn func(key string, value json.RawMessage)) (stop func()) {
+	return m.watchers.add(fn)
+}
+
+// settingsWatchers is the subscriber list shared by the Settings implementations.
+type settingsWatchers struct {
+	mu     sync.Mutex
+	nextID int
+	fns    map[int]func(key string, value json.RawMessage)
+}
+
+func (w *settingsWatchers) add(fn func(key string, value json.RawMessage)) func() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.fns == nil {
+		w.fns = map[int]func(key string, value json.RawMessage){}
+	}
+	id := w.nextID
+	w.nextID++
+	w.fns[id] = fn
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.fns, id)
+	}
+}
+
+// notify calls every watcher; value is nil when key was deleted.
+func (w *settingsWatchers) notify(key string, value json.RawMessage) {
+	w.mu.Lock()
+	fns := make([]func(key string, value json.RawMessage), 0, len(w.fns))
+	for _, fn := range w.fns {
+		fns = append(fns, fn)
+	}
+	w.mu.Unlock()
+	for _, fn := range fns {
+		fn(key, value)
+	}
+}
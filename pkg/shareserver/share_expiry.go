@@ -0,0 +1,110 @@
+package shareserver
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+)
+
+// ShareStopExpired is the serverStopping reason when the SetExpiry timer ran
+// out.
+const ShareStopExpired = "expired"
+
+// shareExpiry is the optional timer that stops the share; the fields are
+// guarded by Server.mu.
+type shareExpiry struct {
+	// after is what SetExpiry asked for; every Start arms a fresh timer with
+	// it until it is cleared.
+	after time.Duration
+	timer *time.Timer
+	at    time.Time
+	// gen tells a timer that fired late (after a Stop or a new Start) that it
+	// is no longer the current one.
+	gen uint64
+}
+
+// SetExpiry stops the share after d; d <= 0 clears it. A running share is
+// rearmed from now, and every later Start starts counting from its own start
+// until the expiry is cleared.
+func (s *Server) SetExpiry(d time.Duration) (*ServerInfo, error) {
+	if d < 0 {
+		return nil, errors.New("时长无效")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expiry.after = d
+	if s.server == nil {
+		return nil, nil
+	}
+	s.armExpiryLocked()
+	if s.events != nil {
+		s.events.broadcast("shareExpiryChanged", map[string]int{"expiresIn": s.expiresInLocked()})
+	}
+	return s.serverInfoLocked(), nil
+}
+
+// armExpiryLocked (re)starts the expiry timer of a running share, or cancels
+// it while no expiry is set. Caller holds s.mu.
+func (s *Server) armExpiryLocked() {
+	s.stopExpiryLocked()
+	d := s.expiry.after
+	if d <= 0 || s.server == nil {
+		return
+	}
+	gen := s.expiry.gen
+	s.expiry.at = time.Now().Add(d)
+	s.expiry.timer = time.AfterFunc(d, func() { s.shareExpired(gen) })
+}
+
+// stopExpiryLocked cancels the timer; a callback already on its way sees the
+// new generation and does nothing. Caller holds s.mu.
+func (s *Server) stopExpiryLocked() {
+	if s.expiry.timer != nil {
+		s.expiry.timer.Stop()
+		s.expiry.timer = nil
+	}
+	s.expiry.at = time.Time{}
+	s.expiry.gen++
+}
+
+// expiresInLocked is the whole seconds left on the timer, rounded up so a
+// running timer never reads 0. Caller holds s.mu.
+func (s *Server) expiresInLocked() int {
+	if s.expiry.at.IsZero() {
+		return 0
+	}
+	left := time.Until(s.expiry.at).Seconds()
+	if left <= 0 {
+		return 1
+	}
+	return int(math.Ceil(left))
+}
+
+// shareExpired stops the share whose timer of generation gen ran out. Like
+// Stop, it remembers the share as inactive: the user asked for it to end.
+func (s *Server) shareExpired(gen uint64) {
+	s.opMu.Lock()
+	s.mu.Lock()
+	if gen != s.expiry.gen || s.server == nil {
+		// Stopped, restarted or rearmed meanwhile.
+		s.mu.Unlock()
+		s.opMu.Unlock()
+		return
+	}
+	root := s.sharedRoot
+	if s.events != nil {
+		s.events.broadcast("serverStopping", map[string]string{"reason": ShareStopExpired})
+	}
+	err := s.stopLocked(context.Background())
+	s.mu.Unlock()
+	if err == nil {
+		s.saveLastShare(LastShare{Root: root, Active: false})
+	}
+	s.opMu.Unlock()
+
+	s.logf("share expired root=%q stop err=%v", root, err)
+	if s.onShareExpired != nil {
+		s.onShareExpired(root)
+	}
+}
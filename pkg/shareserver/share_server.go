@@ -0,0 +1,3209 @@
+package shareserver
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/big"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const SettingKeyCustomPort = "local-share:custom-port"
+const SettingKeyAccessPass = "local-share:access-pass"
+const SettingKeyPermissions = "local-share:permissions"
+const SettingKeyUploadQuotaBytes = "local-share:upload-quota-bytes"
+const SettingKeyUploadDedup = "local-share:upload-dedup"
+const SettingKeyNotifyClientConnected = "local-share:notify-client-connected"
+const SettingKeyAccessLogFile = "local-share:access-log-file"
+const SettingKeyProtectWebUI = "local-share:protect-web-ui"
+
+// SettingKeyReadOnly (bool) is the single read-only switch: while true the
+// effective permissions are read-only whatever SettingKeyPermissions says.
+const SettingKeyReadOnly = "local-share:read-only"
+
+// SettingKeyLanguage (JSON string: "zh-CN", "en" or "" for the OS language)
+// is the language of the desktop app's dialogs and notifications.
+const SettingKeyLanguage = "local-share:language"
+
+// SSE tuning (JSON numbers): keep-alive interval, per-client buffer and stream caps.
+const SettingKeySSEKeepAliveSeconds = "local-share:sse-keepalive-seconds"
+const SettingKeySSEBufferSize = "local-share:sse-buffer-size"
+const SettingKeySSEMaxClientsPerIP = "local-share:sse-max-clients-per-ip"
+const SettingKeySSEMaxClients = "local-share:sse-max-clients"
+
+// SettingKeyDownloadAllRoot (JSON bool) lets /api/download-all zip the whole share.
+const SettingKeyDownloadAllRoot = "local-share:download-all-root"
+
+// SettingKeyWebDistDir is a directory (JSON string) holding a built web UI that
+// replaces the bundled one. Like the access pass it is not exposed over HTTP.
+const SettingKeyWebDistDir = "local-share:web-dist-dir"
+
+const headerShareToken = "X-Share-Token"
+const queryShareToken = "token"
+
+// queryEntryToken carries the one-time token of a folder link (FolderURL).
+const queryEntryToken = "ott"
+
+const maxPreviewBytes int64 = 10 * 1024 * 1024
+
+var imagePreviewContentTypes = map[string]string{
+	".ico":  "image/x-icon",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".bmp":  "image/bmp",
+	".svg":  "image/svg+xml",
+	".webp": "image/webp",
+	".avif": "image/avif",
+	".heic": "image/heic",
+	".heif": "image/heif",
+}
+
+// maxPDFPreviewBytes is larger than maxPreviewBytes: scanned PDFs are big and
+// the browser's viewer handles them fine.
+const maxPDFPreviewBytes int64 = 50 * 1024 * 1024
+
+// documentContentTypes are served with their real type so the browser (or the
+// phone) picks the right app; only PDFs are previewed, inline.
+var documentContentTypes = map[string]string{
+	".pdf":  "application/pdf",
+	".epub": "application/epub+zip",
+	".doc":  "application/msword",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".xls":  "application/vnd.ms-excel",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".ppt":  "application/vnd.ms-powerpoint",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".odt":  "application/vnd.oasis.opendocument.text",
+	".ods":  "application/vnd.oasis.opendocument.spreadsheet",
+	".odp":  "application/vnd.oasis.opendocument.presentation",
+	".rtf":  "application/rtf",
+}
+
+var textPreviewContentTypes = map[string]string{
+	".txt":   "text/plain; charset=utf-8",
+	".log":   "text/plain; charset=utf-8",
+	".md":    "text/markdown; charset=utf-8",
+	".csv":   "text/csv; charset=utf-8",
+	".json":  "application/json; charset=utf-8",
+	".html":  "text/html; charset=utf-8",
+	".xml":   "application/xml; charset=utf-8",
+	".yml":   "text/yaml; charset=utf-8",
+	".yaml":  "text/yaml; charset=utf-8",
+	".css":   "text/css; charset=utf-8",
+	".js":    "application/javascript; charset=utf-8",
+	".ts":    "text/plain; charset=utf-8",
+	".go":    "text/plain; charset=utf-8",
+	".py":    "text/plain; charset=utf-8",
+	".java":  "text/plain; charset=utf-8",
+	".c":     "text/plain; charset=utf-8",
+	".h":     "text/plain; charset=utf-8",
+	".cpp":   "text/plain; charset=utf-8",
+	".hpp":   "text/plain; charset=utf-8",
+	".rs":    "text/plain; charset=utf-8",
+	".php":   "text/plain; charset=utf-8",
+	".rb":    "text/plain; charset=utf-8",
+	".cs":    "text/plain; charset=utf-8",
+	".kt":    "text/plain; charset=utf-8",
+	".swift": "text/plain; charset=utf-8",
+	".sh":    "text/plain; charset=utf-8",
+	".bat":   "text/plain; charset=utf-8",
+	".ps1":   "text/plain; charset=utf-8",
+	".sql":   "text/plain; charset=utf-8",
+	".toml":  "text/plain; charset=utf-8",
+	".ini":   "text/plain; charset=utf-8",
+	".env":   "text/plain; charset=utf-8",
+}
+
+type DirectoryItem struct {
+	Name      string       `json:"name"`
+	Type      string       `json:"type"` // "file" | "directory"
+	Hidden    bool         `json:"hidden"`
+	Size      int64        `json:"size"`
+	Modified  string       `json:"modified"`
+	Created   string       `json:"created,omitempty"` // empty where the platform doesn't record it
+	Owner     string       `json:"owner,omitempty"`   // only for listings requested with details=1
+	Extension *string      `json:"extension"`
+	Preview   *PreviewInfo `json:"preview,omitempty"`
+	// Previewable mirrors Preview.Supported; Category is one of FileCategories.
+	// Both are only set for files.
+	Previewable bool   `json:"previewable"`
+	Category    string `json:"category,omitempty"`
+}
+
+type PreviewInfo struct {
+	Supported   bool   `json:"supported"`
+	Kind        string `json:"kind"`
+	ContentType string `json:"contentType,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+type filesResponse struct {
+	Items       []DirectoryItem `json:"items"`
+	RootName    string          `json:"rootName"`
+	CurrentPath string          `json:"currentPath"`
+	ParentPath  *string         `json:"parentPath"`
+	// Truncated is set when the folder held more than SettingKeyListMaxItems.
+	Truncated bool `json:"truncated,omitempty"`
+	// Readme is the folder's README.md or README.txt, if it has a visible one.
+	Readme *readmeInfo `json:"readme,omitempty"`
+}
+
+type pathInfoResponse struct {
+	Kind        string          `json:"kind"`
+	RootName    string          `json:"rootName"`
+	CurrentPath string          `json:"currentPath"`
+	ParentPath  *string         `json:"parentPath"`
+	Item        *DirectoryItem  `json:"item,omitempty"`
+	Items       []DirectoryItem `json:"items,omitempty"`
+	Truncated   bool            `json:"truncated,omitempty"`
+}
+
+// Server is the LAN share server: it serves the web UI, the /api/* endpoints
+// and live change events for one shared folder at a time.
+type Server struct {
+	// opMu serializes Start, Stop, Shutdown and ApplyCustomPorts, which come
+	// from the UI, IPC, the startup resume and the auto-restart at once, and
+	// the stops on a lost root, a failed server or an expired share: each
+	// runs to the end (watcher included) before the next begins, so the last
+	// caller to get it decides the final root. It also guards the watcher
+	// fields below. mu only guards the other fields.
+	opMu     sync.Mutex
+	mu       sync.RWMutex
+	settings Settings
+	logger   Logger
+	version  string
+
+	accessLog       *accessLog
+	accessLogPath   string
+	accessLogFileMu sync.Mutex
+
+	assets        fs.FS
+	assetsNoCache bool
+	assetsPath    string
+
+	rememberLastShare bool
+
+	sharedRoot string
+	localIP    string
+	port       int
+	shortCode  string
+
+	server   *http.Server
+	listener net.Listener
+	// portProbeStop ends the custom-port probe of a share on a fallback port.
+	portProbeStop     chan struct{}
+	portProbeInterval time.Duration
+	// uploadSweepStop ends the sweeps of orphaned upload temp files.
+	uploadSweepStop chan struct{}
+	// rootRemovable is whether sharedRoot is on removable media.
+	rootRemovable bool
+	// rootCheckStop ends the check that stops the share when its folder is gone.
+	rootCheckStop     chan struct{}
+	rootCheckInterval time.Duration
+	// idleCheckStop ends the check that stops an unused share
+	// (SettingKeyIdleStopMinutes).
+	idleCheckStop     chan struct{}
+	idleCheckInterval time.Duration
+	// redirectServer answers on redirectPort (SettingKeyPortRedirect);
+	// redirectPorts overrides defaultRedirectPorts in tests.
+	redirectServer *http.Server
+	redirectPort   int
+	redirectPorts  []int
+	// restartStop ends the automatic restart after the server failed
+	// (SettingKeyAutoRestart); restartBackoff overrides the first delay in tests.
+	restartStop    chan struct{}
+	restartBackoff time.Duration
+	// expiry stops the share after a while (SetExpiry).
+	expiry shareExpiry
+	// activity is when the share was last used.
+	activity *shareActivity
+
+	events *sseHub
+	stats  *shareStats
+
+	uploadHashes   *uploadHashIndex
+	uploadProgress *uploadProgresses
+	pathLocks      *pathLocks
+	archives       *archiveJobs
+	// entrySizes caches the folder sizes /api/zip-defaults reports.
+	entrySizes entrySizes
+	// mediaInfo caches the image headers /api/media-info reports.
+	mediaInfo mediaInfoCache
+	// sidecars are the checksum sidecars GenerateChecksums wrote.
+	sidecars checksumSidecars
+	// uploadClaimHook, set by tests, runs between claimUploadPath's check
+	// and its O_EXCL create.
+	uploadClaimHook func(outPath string)
+	// zipStatHook, set by tests, runs right before a zipped file is compared
+	// with what the candidate pass saw.
+	zipStatHook func(c zipCandidate)
+	// useTrash is whether deletes go to the Recycle Bin; tests turn it on to
+	// exercise the size check.
+	useTrash bool
+
+	// Optional hooks (see Options); called outside of any lock.
+	onClientConnected     func(ip string, userAgent string)
+	onClientDisconnected  func(ip string)
+	onPanic               func(id string, msg string)
+	onCustomPortAvailable func(port int, switched bool)
+	onShareRootLost       func(root string, reason string)
+	onShareFailed         func(root string, err error, restarting bool)
+	onShareRestarted      func(root string, attempt int)
+	onShareExpired        func(root string)
+	onShareIdleStopped    func(root string)
+	onRemoteAdmin         func(action string, ip string)
+	onPathProbe           func(ip string, attempts int)
+
+	auth *authManager
+	// authChallenges is the optional proof-of-work in front of /api/auth.
+	authChallenges *authChallenges
+	// downloadTokens signs resumable /api/download URLs.
+	downloadTokens *downloadTokens
+	pathProbes     *pathProbes
+
+	// watcher, watchRoot and watchGen are guarded by opMu. watchGen changes
+	// whenever the watcher is stopped or replaced, so a watcher built without
+	// holding opMu (onWatchSettingChanged) is only installed if nothing
+	// happened meanwhile.
+	watcher   *directoryWatcher
+	watchRoot string
+	watchGen  uint64
+}
+
+// trackClients reports the first request of each client IP since server start.
+func (s *Server) trackClients(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := s.clientIP(r)
+		if ip != "" && s.stats.markClientSeen(ip) && s.onClientConnected != nil {
+			s.onClientConnected(ip, r.UserAgent())
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func IsValidAccessPass(pass string) bool {
+	if pass == "" {
+		return true
+	}
+	if len(pass) < 1 || len(pass) > 16 {
+		return false
+	}
+	for i := 0; i < len(pass); i++ {
+		c := pass[i]
+		isDigit := c >= '0' && c <= '9'
+		isLower := c >= 'a' && c <= 'z'
+		isUpper := c >= 'A' && c <= 'Z'
+		if !isDigit && !isLower && !isUpper {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) getAccessPassFromSettings() (string, bool, error) {
+	if s.settings == nil {
+		return "", false, nil
+	}
+	raw, ok, err := s.settings.Get(SettingKeyAccessPass)
+	if err != nil {
+		return "", false, err
+	}
+	if !ok || len(raw) == 0 {
+		return "", false, nil
+	}
+	var pass string
+	if err := json.Unmarshal(raw, &pass); err != nil {
+		return "", false, err
+	}
+	pass = strings.TrimSpace(pass)
+	if pass == "" {
+		return "", false, nil
+	}
+	if !IsValidAccessPass(pass) {
+		return "", false, errors.New("无效访问口令")
+	}
+	return pass, true, nil
+}
+
+type PermissionSetting struct {
+	Read   *bool `json:"read"`
+	Write  *bool `json:"write"`
+	Delete *bool `json:"delete"`
+}
+
+type Permissions struct {
+	Read   bool
+	Write  bool
+	Delete bool
+}
+
+// getPermissionsFromSettings returns the effective permissions.
+func (s *Server) getPermissionsFromSettings() Permissions {
+	if s.getBoolSetting(SettingKeyReadOnly) {
+		return Permissions{Read: true, Write: false, Delete: false}
+	}
+	return s.getPermissionSettings()
+}
+
+// getPermissionSettings returns SettingKeyPermissions, ignoring read-only mode.
+func (s *Server) getPermissionSettings() Permissions {
+	perms := Permissions{Read: true, Write: true, Delete: false}
+	if s.settings == nil {
+		return perms
+	}
+	raw, ok, err := s.settings.Get(SettingKeyPermissions)
+	if err != nil || !ok || len(raw) == 0 {
+		return perms
+	}
+	var input PermissionSetting
+	if err := json.Unmarshal(raw, &input); err != nil {
+		return perms
+	}
+	if input.Read != nil {
+		perms.Read = *input.Read
+	}
+	if input.Write != nil {
+		perms.Write = *input.Write
+	}
+	if input.Delete != nil {
+		perms.Delete = *input.Delete
+	}
+	return perms
+}
+
+// getBoolSetting reads a JSON boolean setting; anything else counts as false.
+func (s *Server) getBoolSetting(key string) bool {
+	if s.settings == nil {
+		return false
+	}
+	raw, ok, err := s.settings.Get(key)
+	if err != nil || !ok || len(raw) == 0 {
+		return false
+	}
+	var v bool
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return false
+	}
+	return v
+}
+
+// getIntSetting reads a JSON number setting, falling back to def when it is
+// missing or invalid and clamping it to [lo, hi].
+func (s *Server) getIntSetting(key string, def, lo, hi int) int {
+	if s.settings == nil {
+		return def
+	}
+	raw, ok, err := s.settings.Get(key)
+	if err != nil || !ok || len(raw) == 0 {
+		return def
+	}
+	var v int
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return def
+	}
+	return min(max(v, lo), hi)
+}
+
+// sseConfig returns the event stream settings. The defaults keep mobile
+// proxies happy without letting a reconnect loop pile up goroutines.
+func (s *Server) sseConfig() sseConfig {
+	return sseConfig{
+		keepAlive:  time.Duration(s.getIntSetting(SettingKeySSEKeepAliveSeconds, 20, 5, 300)) * time.Second,
+		bufferSize: s.getIntSetting(SettingKeySSEBufferSize, 16, 1, 1024),
+		maxPerIP:   s.getIntSetting(SettingKeySSEMaxClientsPerIP, 8, 1, 1000),
+		maxClients: s.getIntSetting(SettingKeySSEMaxClients, 128, 1, 10000),
+	}
+}
+
+// getUploadQuotaFromSettings returns the per-IP upload quota in bytes.
+// A missing, zero or invalid value means unlimited.
+func (s *Server) getUploadQuotaFromSettings() (int64, bool) {
+	if s.settings == nil {
+		return 0, false
+	}
+	raw, ok, err := s.settings.Get(SettingKeyUploadQuotaBytes)
+	if err != nil || !ok || len(raw) == 0 {
+		return 0, false
+	}
+	var quota int64
+	if err := json.Unmarshal(raw, &quota); err != nil {
+		var input string
+		if err := json.Unmarshal(raw, &input); err != nil {
+			return 0, false
+		}
+		quota, err = strconv.ParseInt(strings.TrimSpace(input), 10, 64)
+		if err != nil {
+			return 0, false
+		}
+	}
+	if quota <= 0 {
+		return 0, false
+	}
+	return quota, true
+}
+
+func getClientIP(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	addr := strings.TrimSpace(r.RemoteAddr)
+	if addr == "" {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err == nil && host != "" {
+		return host
+	}
+	return addr
+}
+
+func (s *Server) requireAuth(w http.ResponseWriter, r *http.Request) bool {
+	res, _, err := s.checkAuth(r)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "访问口令配置异常"})
+		return false
+	}
+	if res != authOK {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": res.message(),
+			"code":  res.code(),
+		})
+		return false
+	}
+	s.noteActivity(w)
+	return true
+}
+
+// checkAuth validates the token r presents against the current access pass.
+// required is false when no pass is set; res is authOK then.
+func (s *Server) checkAuth(r *http.Request) (res authResult, required bool, err error) {
+	pass, enabled, err := s.getAccessPassFromSettings()
+	if err != nil {
+		return authUnknown, true, err
+	}
+	if !enabled || pass == "" {
+		return authOK, false, nil
+	}
+	return s.auth.validate(presentedToken(r), s.clientIP(r), accessPassHash(pass)), true, nil
+}
+
+// presentedToken prefers the header token and falls back to the query for
+// EventSource / download navigation.
+func presentedToken(r *http.Request) string {
+	token := strings.TrimSpace(r.Header.Get(headerShareToken))
+	if token == "" {
+		token = strings.TrimSpace(r.URL.Query().Get(queryShareToken))
+	}
+	return token
+}
+
+func (s *Server) requirePermission(w http.ResponseWriter, perm string) bool {
+	perms := s.getPermissionsFromSettings()
+	allowed := false
+	code := ""
+	msg := ""
+	switch perm {
+	case "read":
+		allowed = perms.Read
+		code = "PERMISSION_DENIED_READ"
+		msg = "无读取权限"
+	case "write":
+		allowed = perms.Write
+		code = "PERMISSION_DENIED_WRITE"
+		msg = "无写入权限"
+	case "delete":
+		allowed = perms.Delete
+		code = "PERMISSION_DENIED_DELETE"
+		msg = "无删除权限"
+	default:
+		allowed = false
+		code = "PERMISSION_DENIED"
+		msg = "无权限"
+	}
+	if allowed {
+		return true
+	}
+	writeJSON(w, http.StatusForbidden, map[string]string{
+		"error": msg,
+		"code":  code,
+	})
+	return false
+}
+
+func (s *Server) handleAuth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// If pass isn't enabled, return empty token.
+	passSetting, enabled, err := s.getAccessPassFromSettings()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "访问口令配置异常"})
+		return
+	}
+	if !enabled || passSetting == "" {
+		writeJSON(w, http.StatusOK, map[string]any{"token": ""})
+		return
+	}
+
+	var req struct {
+		Pass      string                 `json:"pass"`
+		Challenge *authChallengeSolution `json:"challenge"`
+		// Entry is the one-time token of a folder link, in place of the pass.
+		Entry string `json:"ott"`
+	}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+	input := strings.TrimSpace(req.Pass)
+	ip := s.clientIP(r)
+
+	// Entry tokens are random and single-use: no guessing to rate-limit.
+	if entry := strings.TrimSpace(req.Entry); entry != "" && input == "" {
+		if !s.auth.redeemEntry(entry, accessPassHash(passSetting)) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{
+				"error": "链接已失效，请输入访问口令",
+				"code":  "AUTH_OTT_INVALID",
+			})
+			return
+		}
+		s.writeAuthToken(w, ip, accessPassHash(passSetting))
+		return
+	}
+
+	// Under a flood of wrong passes, a pass is only checked with a solved
+	// challenge; the empty probe still just learns that a pass is needed.
+	// Solved attempts skip the limiter, asking for a challenge doesn't.
+	on, threshold, difficulty := s.authChallengeConfig()
+	challenged := on && input != "" && s.authChallenges.active(threshold)
+	solved := challenged && s.authChallenges.verify(req.Challenge)
+	if !solved && !s.auth.allow(ip) {
+		retryAfter := s.auth.retryAfter()
+		w.Header().Set("Retry-After", fmt.Sprintf("%d", retryAfter))
+		writeJSON(w, http.StatusTooManyRequests, map[string]any{
+			"error":      "请求过于频繁，请稍后重试",
+			"code":       "AUTH_RATE_LIMITED",
+			"retryAfter": retryAfter,
+		})
+		return
+	}
+	if challenged && !solved {
+		ch, err := s.authChallenges.issue(difficulty)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "生成验证失败"})
+			return
+		}
+		writeJSON(w, http.StatusPreconditionRequired, map[string]any{
+			"error":     "尝试次数过多，需要先完成验证",
+			"code":      "AUTH_CHALLENGE",
+			"challenge": ch,
+		})
+		return
+	}
+
+	if input == "" {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "需要访问口令",
+			"code":  "AUTH_REQUIRED",
+		})
+		return
+	}
+	if !IsValidAccessPass(input) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "访问口令格式错误"})
+		return
+	}
+
+	// Constant-time compare (only meaningful when same length, but still good practice).
+	ok := false
+	if len(input) == len(passSetting) {
+		ok = subtle.ConstantTimeCompare([]byte(input), []byte(passSetting)) == 1
+	}
+	if !ok {
+		s.authChallenges.recordFailure()
+		writeJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "访问口令错误",
+			"code":  "AUTH_INVALID",
+		})
+		return
+	}
+
+	s.writeAuthToken(w, ip, accessPassHash(passSetting))
+}
+
+// writeAuthToken answers a successful /api/auth with a new token for ip.
+func (s *Server) writeAuthToken(w http.ResponseWriter, ip string, passHash [32]byte) {
+	token, ttl, terr := s.auth.issue(ip, passHash)
+	if terr != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "生成 token 失败"})
+		return
+	}
+
+	// Also as a cookie so page loads of a protected web UI are authorized.
+	setShareTokenCookie(w, token)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"token":     token,
+		"expiresIn": int(ttl.Seconds()),
+	})
+}
+
+func (s *Server) IsRunning() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.server != nil
+}
+
+func (s *Server) GetServerInfo() (*ServerInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.server == nil {
+		return nil, nil
+	}
+	return s.serverInfoLocked(), nil
+}
+
+// serverInfoLocked snapshots the running server; callers hold s.mu.
+func (s *Server) serverInfoLocked() *ServerInfo {
+	urlStr := fmt.Sprintf("http://%s:%d%s", s.localIP, s.port, s.basePath())
+	info := &ServerInfo{
+		URL:          urlStr,
+		Port:         s.port,
+		LocalIP:      s.localIP,
+		SharedFolder: s.sharedRoot,
+		ShortCode:    s.shortCode,
+		Removable:    s.rootRemovable,
+		RedirectFrom: s.redirectPort,
+		ReadOnly:     s.getBoolSetting(SettingKeyReadOnly),
+		ExpiresIn:    s.expiresInLocked(),
+	}
+	if t := s.activity.last(); !t.IsZero() {
+		info.LastActivity = t.UTC().Format(time.RFC3339)
+	}
+	if s.shortCode != "" {
+		info.ShortURL = urlStr + "/c/" + s.shortCode
+	}
+	return info
+}
+
+// newShortCode returns a random 6-digit code for the /c/<code> entry path.
+func newShortCode() string {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%06d", n.Int64())
+}
+
+// resolveSharedPath maps a share-relative path onto the current shared root.
+func (s *Server) resolveSharedPath(relPath string) (string, error) {
+	s.mu.RLock()
+	root := s.sharedRoot
+	s.mu.RUnlock()
+	if root == "" {
+		return "", errors.New("本地服务器未启用")
+	}
+	fullPath, ok := safeJoin(root, relPath)
+	if !ok {
+		return "", errors.New("无权限访问此路径")
+	}
+	return fullPath, nil
+}
+
+func (s *Server) getCustomPortFromSettings() (int, bool, error) {
+	if s.settings == nil {
+		return 0, false, nil
+	}
+	raw, ok, err := s.settings.Get(SettingKeyCustomPort)
+	if err != nil {
+		return 0, false, err
+	}
+	if !ok || len(raw) == 0 {
+		return 0, false, nil
+	}
+	var input string
+	if err := json.Unmarshal(raw, &input); err != nil {
+		return 0, false, err
+	}
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return 0, false, nil
+	}
+	port, err := strconv.Atoi(input)
+	if err != nil || port <= 0 || port > 65535 {
+		return 0, false, errors.New("无效端口")
+	}
+	return port, true, nil
+}
+
+func (s *Server) buildHTTPServer() *http.Server {
+	return &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       0,
+		WriteTimeout:      0,
+		IdleTimeout:       60 * time.Second,
+	}
+}
+
+// Start shares folderPath. If the server is already running only the folder
+// changes and the port is kept.
+func (s *Server) Start(ctx context.Context, folderPath string) (*StartResult, error) {
+	folderPath = strings.TrimSpace(folderPath)
+	folderPath = strings.Trim(folderPath, "\"")
+	if folderPath == "" {
+		return nil, errors.New("共享文件夹路径为空")
+	}
+
+	absRoot, err := filepath.Abs(folderPath)
+	if err != nil {
+		return nil, err
+	}
+	st, err := statWithContext(ctx, absRoot)
+	if err != nil {
+		return nil, err
+	}
+	if !st.IsDir() {
+		return nil, errors.New("共享路径不是文件夹")
+	}
+	if err := readDirWithContext(ctx, absRoot); err != nil {
+		if errors.Is(err, fs.ErrPermission) {
+			return nil, ErrRootNotReadable
+		}
+		return nil, err
+	}
+	removable := isRemovableDrive(absRoot)
+
+	s.opMu.Lock()
+	defer s.opMu.Unlock()
+
+	s.mu.Lock()
+	if s.server != nil {
+		// 共享服务已在运行时，不要重新绑定端口（避免右键再次共享导致端口变化）。
+		// 仅更新共享目录与（可选）本机 IP / 二维码。
+		overlap := s.rootOverlapLocked(absRoot)
+		s.sharedRoot = absRoot
+		s.rootRemovable = removable
+		if ip, ipErr := getLocalIPv4(); ipErr == nil {
+			s.localIP = ip
+		}
+		s.shortCode = newShortCode()
+		s.armExpiryLocked()
+		s.activity.reset()
+		info := s.serverInfoLocked()
+		s.mu.Unlock()
+		// best-effort: restart watcher for new root
+		return s.startResult(ctx, info, absRoot, false, overlap), nil
+	}
+	s.mu.Unlock()
+
+	ip, err := getLocalIPv4()
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var port int
+	var ln net.Listener
+	customPortUnavailable := false
+	if customPort, ok, perr := s.getCustomPortFromSettings(); perr == nil && ok {
+		l, lerr := listenTCP(ctx, customPort)
+		if lerr != nil {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			customPortUnavailable = true
+		} else {
+			port = customPort
+			ln = l
+		}
+	}
+	if ln == nil {
+		p, l, lerr := getAvailablePort(ctx)
+		if lerr != nil {
+			return nil, lerr
+		}
+		port = p
+		ln = l
+	}
+	if err := ctx.Err(); err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+
+	srv := s.buildHTTPServer()
+
+	// Nothing else sets s.server while we hold opMu.
+	s.mu.Lock()
+	s.sharedRoot = absRoot
+	s.rootRemovable = removable
+	s.localIP = ip
+	s.port = port
+	s.downloadTokens.rotate()
+	s.listener = ln
+	s.server = srv
+	s.shortCode = newShortCode()
+	if customPortUnavailable {
+		s.startPortProbeLocked()
+	}
+	s.startUploadSweepLocked()
+	s.startRootCheckLocked()
+	s.startIdleCheckLocked()
+	s.startRedirectLocked()
+	s.armExpiryLocked()
+	info := s.serverInfoLocked()
+	s.mu.Unlock()
+
+	go s.serve(srv, ln)
+
+	return s.startResult(ctx, info, absRoot, customPortUnavailable, nil), nil
+}
+
+// rootOverlapLocked reports how root relates to the folder being shared, nil
+// when they are disjoint. Caller holds s.mu.
+func (s *Server) rootOverlapLocked(root string) *RootOverlap {
+	if s.sharedRoot == "" {
+		return nil
+	}
+	rel := rootRelation(s.sharedRoot, root, caseInsensitiveFS)
+	if rel == "" {
+		return nil
+	}
+	return &RootOverlap{Previous: s.sharedRoot, Relation: rel}
+}
+
+// startResult finishes a successful Start: it remembers the share, (re)starts
+// the watcher and collects warnings; overlap is the replaced root, if nested.
+// The share is already serving, so a watcher that can't be set up before ctx
+// is done only costs live refresh, not the whole Start.
+func (s *Server) startResult(ctx context.Context, info *ServerInfo, root string, customPortUnavailable bool, overlap *RootOverlap) *StartResult {
+	s.saveLastShare(LastShare{Root: root, Active: true})
+	res := &StartResult{Info: info, Overlap: overlap}
+	if customPortUnavailable {
+		res.Warnings = append(res.Warnings, WarningCustomPortUnavailable)
+	}
+	// Sharing the same folder again is the usual right-click; only nesting
+	// swaps what guests see in a surprising way.
+	if overlap != nil && overlap.Relation != RootOverlapSame {
+		res.Warnings = append(res.Warnings, WarningRootOverlap)
+	}
+	if err := s.resetWatcher(ctx, root); err != nil {
+		s.logf("watcher not started root=%q err=%v", root, err)
+		if ctx.Err() != nil {
+			res.Warnings = append(res.Warnings, WarningWatchUnavailable)
+		}
+	}
+	return res
+}
+
+// statWithContext is os.Stat that stops waiting when ctx is done; a stalled
+// network drive can block a stat for a long time.
+func statWithContext(ctx context.Context, path string) (os.FileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	type result struct {
+		st  os.FileInfo
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		st, err := os.Stat(path)
+		ch <- result{st, err}
+	}()
+	select {
+	case r := <-ch:
+		return r.st, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// ErrRootNotReadable is returned by Start for a folder the app is not
+// allowed to list, such as another user's home or an ACL-restricted share.
+var ErrRootNotReadable = errors.New("没有读取该文件夹的权限，请检查它的访问权限或换一个文件夹")
+
+// readDirWithContext reads the first entry of dir, so a folder that can be
+// stat'ed but not listed is caught before it is shared. Like statWithContext
+// it stops waiting when ctx is done.
+func readDirWithContext(ctx context.Context, dir string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ch := make(chan error, 1)
+	go func() {
+		f, err := os.Open(dir)
+		if err == nil {
+			_, err = f.ReadDir(1)
+			f.Close()
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+		}
+		ch <- err
+	}()
+	select {
+	case err := <-ch:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Server) ApplyCustomPorts(ctx context.Context, input string) (*ServerInfo, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return nil, errors.New("端口不能为空")
+	}
+	port, err := strconv.Atoi(input)
+	if err != nil || port <= 0 || port > 65535 {
+		return nil, errors.New("无效端口")
+	}
+
+	s.opMu.Lock()
+	defer s.opMu.Unlock()
+
+	// Persist the raw input so future starts prefer it.
+	if s.settings != nil {
+		b, _ := json.Marshal(input)
+		_ = s.settings.Set(SettingKeyCustomPort, b)
+	}
+
+	s.mu.RLock()
+	running := s.server != nil
+	root := s.sharedRoot
+	currentPort := s.port
+	shortCode := s.shortCode
+	s.mu.RUnlock()
+	if !running || root == "" {
+		return nil, errors.New("本地服务器未启用")
+	}
+
+	if port == currentPort {
+		return s.GetServerInfo()
+	}
+
+	// Pre-bind to ensure we don't tear down the current server when the port is unavailable.
+	ln, lerr := listenTCP(ctx, port)
+	if lerr != nil {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("端口不可用")
+	}
+
+	ip, err := getLocalIPv4()
+	if err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+
+	// Stop the old server then start a new one on the chosen port.
+	s.mu.Lock()
+	err = s.stopLocked(ctx)
+	s.mu.Unlock()
+	if err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+
+	srv := s.buildHTTPServer()
+
+	s.mu.Lock()
+	s.sharedRoot = root
+	s.localIP = ip
+	s.port = port
+	s.listener = ln
+	s.server = srv
+	// Switching ports is not a new share session: keep the short code.
+	s.shortCode = shortCode
+	s.startRedirectLocked()
+	info := s.serverInfoLocked()
+	s.mu.Unlock()
+
+	go s.serve(srv, ln)
+
+	if err := s.resetWatcher(ctx, root); err != nil {
+		s.logf("watcher not started root=%q err=%v", root, err)
+	}
+	return info, nil
+}
+
+// Stop stops sharing. The remembered share (see LastShare) is marked inactive.
+func (s *Server) Stop(ctx context.Context) error {
+	s.opMu.Lock()
+	defer s.opMu.Unlock()
+	s.mu.Lock()
+	root := s.sharedRoot
+	running := s.server != nil
+	err := s.stopLocked(ctx)
+	s.mu.Unlock()
+	if running && err == nil {
+		s.saveLastShare(LastShare{Root: root, Active: false})
+	}
+	return err
+}
+
+func (s *Server) stopLocked(ctx context.Context) error {
+	// A pending automatic restart would undo the stop.
+	s.stopRestartLocked()
+	if s.server == nil {
+		return nil
+	}
+
+	// Proactively close SSE clients so long-lived event streams don't block shutdown.
+	if s.events != nil {
+		s.events.CloseAll()
+	}
+
+	// Stop directory watcher before tearing down state.
+	s.stopWatcher()
+	s.stopPortProbeLocked()
+	s.stopUploadSweepLocked()
+	s.stopRootCheckLocked()
+	s.stopIdleCheckLocked()
+	s.stopRedirectLocked()
+	s.stopExpiryLocked()
+
+	// Archive jobs are built from the shared folder; drop them with it.
+	s.archives.closeAll()
+
+	// Use a dedicated timeout context here: the app-level ctx may be canceled or
+	// too short-lived for a graceful shutdown.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	defer cancel()
+
+	err := s.server.Shutdown(shutdownCtx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		// Graceful shutdown timed out (likely due to in-flight downloads/uploads).
+		// Force-close to avoid surfacing a noisy error to the user.
+		_ = s.server.Close()
+		err = nil
+	}
+	_ = s.listener.Close()
+
+	s.server = nil
+	s.listener = nil
+	s.port = 0
+	s.localIP = ""
+	s.sharedRoot = ""
+	s.rootRemovable = false
+	s.shortCode = ""
+
+	// Upload quotas are counted since server start.
+	if s.stats != nil {
+		s.stats.resetUploads("")
+	}
+	if s.uploadHashes != nil {
+		s.uploadHashes.clear()
+	}
+	if s.stats != nil {
+		s.stats.resetClients()
+	}
+
+	return err
+}
+
+func (s *Server) registerRoutes(mux *http.ServeMux) {
+	// Without index.html (e.g. the web UI build was skipped) every page would be
+	// a bare 404; explain the situation instead while the API keeps working.
+	var diagnosticPage []byte
+	if !hasIndexHTML(s.assets) {
+		diagnosticPage = s.assetsDiagnosticPage()
+		s.logf("web assets missing: index.html not found (path=%s disk=%v version=%s)", s.assetsPath, s.assetsNoCache, s.version)
+	}
+
+	mux.HandleFunc("/", s.underBasePath(mux, func(w http.ResponseWriter, r *http.Request) {
+		staticFS, noCache, mode := s.webAssets()
+		if mode == WebServeMissing {
+			serveAssetsDiagnostic(w, r, diagnosticPage)
+			return
+		}
+		// In dev, prevent browser caching from masking updated builds.
+		if noCache {
+			w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate")
+			w.Header().Set("Pragma", "no-cache")
+			w.Header().Set("Expires", "0")
+		}
+
+		// Serve embedded static assets.
+		// Avoid http.FileServer's implicit redirects which can cause redirect loops
+		// in some FS/path combinations.
+		if badAssetPath(r) {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		reqPath := r.URL.Path
+		if reqPath == "" || reqPath == "/" {
+			reqPath = "/index.html"
+		}
+
+		clean := path.Clean(reqPath)
+		if !strings.HasPrefix(clean, "/") {
+			clean = "/" + clean
+		}
+		// Never answer an API call with the SPA: clients would choke on HTML.
+		if clean == "/api" || strings.HasPrefix(clean, "/api/") {
+			s.handleUnknownAPI(w, r)
+			return
+		}
+		name := strings.TrimPrefix(clean, "/")
+		if name == "" {
+			name = "index.html"
+		}
+
+		if !s.webUIAuthorized(r) {
+			serveWebLogin(w, r, name != "index.html" && !isBrowsePath(clean) && strings.Contains(path.Base(name), "."))
+			return
+		}
+
+		openAndServe := func(fileName string) bool {
+			// Cleaning above should already guarantee this; check the name
+			// the FS actually gets anyway.
+			if !fs.ValidPath(fileName) {
+				return false
+			}
+			if fileName == "index.html" && s.serveIndexHTML(w, r, staticFS, fileName) {
+				return true
+			}
+			f, err := staticFS.Open(fileName)
+			if err != nil {
+				return false
+			}
+			defer f.Close()
+
+			mod := time.Time{}
+			if st, err := fs.Stat(staticFS, fileName); err == nil {
+				mod = st.ModTime()
+			}
+			if rs, ok := f.(io.ReadSeeker); ok {
+				http.ServeContent(w, r, path.Base(fileName), mod, rs)
+				return true
+			}
+			// Fallback (should be rare): read into memory.
+			data, err := fs.ReadFile(staticFS, fileName)
+			if err != nil {
+				return false
+			}
+			http.ServeContent(w, r, path.Base(fileName), mod, bytes.NewReader(data))
+			return true
+		}
+
+		// Try exact file first.
+		served := openAndServe(name)
+		if !served {
+			// If it's a directory, try index.html inside it.
+			if st, statErr := fs.Stat(staticFS, name); statErr == nil && st.IsDir() {
+				idx := path.Join(name, "index.html")
+				name = idx
+				served = openAndServe(idx)
+			}
+		}
+		if !served {
+			// SPA fallback: if a non-asset route is requested, serve index.html.
+			// Keep missing static assets as 404 (e.g. /assets/*.js).
+			base := path.Base(name)
+			// /browse/ deep links are always pages, even for folders like "v1.2".
+			isAsset := strings.Contains(base, ".") && !isBrowsePath(clean)
+			if !isAsset {
+				name = "index.html"
+				served = openAndServe("index.html")
+			}
+		}
+		if !served {
+			http.NotFound(w, r)
+			return
+		}
+	}))
+
+	for _, route := range s.apiRoutes() {
+		mux.HandleFunc(route.path, s.underBasePath(mux, route.handler))
+	}
+	mux.HandleFunc("/api/", s.underBasePath(mux, s.handleUnknownAPI))
+}
+
+// handleUnknownAPI answers /api/ paths no endpoint is registered for, e.g. a
+// typo like /api/downloads, with a JSON 404.
+func (s *Server) handleUnknownAPI(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusNotFound, map[string]string{
+		"error": "未知的接口",
+		"code":  "NOT_FOUND",
+		"path":  r.URL.Path,
+	})
+}
+
+// apiRoute is one registered endpoint and the feature name reported by /api/meta.
+type apiRoute struct {
+	path    string
+	feature string
+	handler http.HandlerFunc
+}
+
+// apiRoutes is the single source of truth for non-static routes, so /api/meta
+// can't advertise something that isn't registered. JSON endpoints go through
+// gzipJSON; streaming ones (events, downloads, preview) must not.
+func (s *Server) apiRoutes() []apiRoute {
+	return []apiRoute{
+		{"/c/", "short-code", s.handleShortCode},
+		{"/api/meta", "meta", gzipJSON(s.handleMeta)},
+		{"/api/session", "session", gzipJSON(s.handleSession)},
+		{"/api/files", "list", s.handleFiles},
+		{"/api/events", "events", s.handleEvents},
+		{"/api/changes", "changes", s.handleChanges},
+		{"/api/stats", "stats", gzipJSON(s.handleStats)},
+		{"/api/settings/", "settings", gzipJSON(s.handleSettings)},
+		{"/api/settings", "settings", gzipJSON(s.handleSettings)},
+		{"/api/auth", "auth", s.handleAuth},
+		{"/api/download", "download", s.handleDownload},
+		{"/api/download-zip", "download-zip", s.handleDownloadZip},
+		{"/api/download-estimate", "download-estimate", s.handleDownloadEstimate},
+		{"/api/zip-defaults", "zip-defaults", gzipJSON(s.handleZipDefaults)},
+		{"/api/hash", "hash", gzipJSON(s.handleHash)},
+		{"/api/media-info", "media-info", gzipJSON(s.handleMediaInfo)},
+		{"/api/download-all", "download-all", s.handleDownloadAll},
+		{"/api/manifest", "manifest", gzipJSON(s.handleManifest)},
+		{"/api/tree", "tree", s.handleTree},
+		{"/api/archive-jobs", "archive-jobs", s.handleArchiveJobs},
+		{"/api/archive-jobs/", "archive-jobs", s.handleArchiveJobs},
+		{"/api/archive-extract", "archive-extract", s.handleArchiveExtract},
+		{"/api/path-info", "path-info", gzipJSON(s.handlePathInfo)},
+		{"/api/preview", "preview", s.handlePreview},
+		{"/api/upload", "upload", s.handleUpload},
+		{"/api/upload-progress", "upload-progress", s.handleUploadProgress},
+		{"/api/put/", "put", s.handlePut},
+		{"/api/delete", "delete", s.handleDelete},
+		{"/api/admin/stop", "admin", s.handleAdminStop},
+		{"/api/admin/permissions", "admin", s.handleAdminPermissions},
+	}
+}
+
+// metaExtraFeatures are capabilities of existing endpoints, reported in
+// Meta.Features next to the route features:
+//   - zip-estimated-size: download-zip and download-all send
+//     X-Estimated-Uncompressed-Size, the total bytes of the files inside.
+//   - zip-store: download-zip accepts "compression": "store" and then sends
+//     an exact Content-Length.
+//   - download-token: download?downloadToken=1 answers a resumable URL that
+//     works without the session token, see downloadTokens.
+var metaExtraFeatures = []string{"zip-estimated-size", "zip-store", "download-token"}
+
+// Meta describes what this backend supports, for feature detection by clients.
+type Meta struct {
+	Version   string   `json:"version"`
+	Endpoints []string `json:"endpoints"`
+	Features  []string `json:"features"`
+	// Auth is "pass" when an access pass is required, otherwise "none".
+	Auth string `json:"auth"`
+	// WebServeMode is where the web UI comes from, see WebServeEmbedded etc.
+	WebServeMode string `json:"webServeMode"`
+	// FileCategories lists the values DirectoryItem.Category can take.
+	FileCategories []string `json:"fileCategories"`
+}
+
+// Meta reports the backend version, registered endpoints and auth mode.
+func (s *Server) Meta() Meta {
+	meta := Meta{Version: s.version, Auth: "none", WebServeMode: s.WebServeMode(), FileCategories: FileCategories}
+	seen := map[string]bool{}
+	for _, route := range s.apiRoutes() {
+		meta.Endpoints = append(meta.Endpoints, route.path)
+		if !seen[route.feature] {
+			seen[route.feature] = true
+			meta.Features = append(meta.Features, route.feature)
+		}
+	}
+	meta.Features = append(meta.Features, metaExtraFeatures...)
+	// A broken pass setting still blocks access, so report it as "pass" too.
+	if _, ok, err := s.getAccessPassFromSettings(); ok || err != nil {
+		meta.Auth = "pass"
+	}
+	return meta
+}
+
+// handleMeta lets the web UI feature-detect the backend. It is public, so it
+// must never include anything beyond what the static UI could already infer.
+func (s *Server) handleMeta(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Meta())
+}
+
+// handleShortCode redirects /c/<code> to the web UI. Wrong codes count against
+// the same per-IP limiter as /api/auth so the code space can't be scanned quickly.
+func (s *Server) handleShortCode(w http.ResponseWriter, r *http.Request) {
+	code := strings.Trim(strings.TrimPrefix(r.URL.Path, "/c/"), "/")
+
+	s.mu.RLock()
+	want := s.shortCode
+	s.mu.RUnlock()
+
+	if want != "" && subtle.ConstantTimeCompare([]byte(code), []byte(want)) == 1 {
+		http.Redirect(w, r, requestBasePath(r)+"/", http.StatusFound)
+		return
+	}
+
+	if !s.auth.allow(s.clientIP(r)) {
+		w.Header().Set("Retry-After", fmt.Sprintf("%d", s.auth.retryAfter()))
+		http.Error(w, "请求过于频繁，请稍后重试", http.StatusTooManyRequests)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAuth(w, r) {
+		return
+	}
+	if !s.requirePermission(w, "read") {
+		return
+	}
+	// An open tab is not someone using the share: keep-alives and pushed
+	// events must not hold off SettingKeyIdleStopMinutes.
+	countActivity(w, false)
+	if s.events == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	s.events.serve(w, r, s.clientIP(r), s.sseConfig())
+}
+
+// Stats is a snapshot of runtime counters. Nothing here survives a restart.
+type Stats struct {
+	// SSEClients is the number of open /api/events streams.
+	SSEClients int `json:"sseClients"`
+	// SSEDrops counts events discarded because a stream's buffer was full.
+	SSEDrops uint64 `json:"sseDrops"`
+	// SSEDisconnects counts streams closed for not keeping up.
+	SSEDisconnects uint64 `json:"sseDisconnects"`
+	// UploadedBytes counts bytes uploaded per client IP since the last reset.
+	UploadedBytes map[string]int64 `json:"uploadedBytes"`
+}
+
+// Stats returns the current runtime counters.
+func (s *Server) Stats() Stats {
+	m := s.events.metrics()
+	return Stats{
+		SSEClients:     m.Clients,
+		SSEDrops:       m.Drops,
+		SSEDisconnects: m.Disconnects,
+		UploadedBytes:  s.stats.uploadsSnapshot(),
+	}
+}
+
+// handleStats reports counters to web clients. Per-IP upload totals of other
+// clients are left out; they're only for the desktop side.
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.requireAuth(w, r) {
+		return
+	}
+	m := s.events.metrics()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"sseClients":     m.Clients,
+		"sseDrops":       m.Drops,
+		"sseDisconnects": m.Disconnects,
+		"uploadedBytes":  s.stats.uploadedBytes(s.clientIP(r)),
+	})
+}
+
+// emitPermissionsChanged tells web clients to refetch /api/session, since
+// SettingKeyReadOnly itself is hidden from them.
+func (s *Server) emitPermissionsChanged(key string, _ json.RawMessage) {
+	if key != SettingKeyReadOnly && key != SettingKeyPermissions {
+		return
+	}
+	if s == nil || s.events == nil {
+		return
+	}
+	s.events.broadcast("permissionsChanged", map[string]bool{
+		"readOnly": s.getBoolSetting(SettingKeyReadOnly),
+	})
+}
+
+func (s *Server) emitSettingChanged(key string, value json.RawMessage) {
+	if s == nil || s.events == nil {
+		return
+	}
+	// Web clients can't read hidden keys, so don't broadcast them either.
+	if httpHiddenSettingKeys[key] {
+		return
+	}
+	if value == nil {
+		value = json.RawMessage("null")
+	}
+	s.events.broadcast("settingsChanged", map[string]any{
+		"key":   key,
+		"value": value,
+		"ts":    time.Now().UTC().Format(time.RFC3339Nano),
+	})
+}
+
+// httpHiddenSettingKeys can't be read or written through /api/settings.
+var httpHiddenSettingKeys = map[string]bool{
+	SettingKeyAccessPass:          true,
+	SettingKeyAccessPassChangedAt: true,
+	SettingKeyWebDistDir:          true,
+	SettingKeyTrustedProxies:      true,
+	SettingKeyLastShare:           true,
+	// Guests must go through the admin gate in handleAdminPermissions.
+	SettingKeyPermissions: true,
+	SettingKeyCustomPort:  true,
+	// Auth tuning: an authenticated client must not be able to loosen it.
+	SettingKeyTokenIPBinding:          true,
+	SettingKeyTokenTTLMinutes:         true,
+	SettingKeyAuthRateWindowSeconds:   true,
+	SettingKeyAuthRateMaxRequests:     true,
+	SettingKeyAuthChallenge:           true,
+	SettingKeyAuthChallengeDifficulty: true,
+	SettingKeyAuthChallengeThreshold:  true,
+	SettingKeyListMaxItems:            true,
+	SettingKeyArchiveSpoolDir:         true,
+	SettingKeyArchiveSpoolMaxGB:       true,
+	SettingKeyArchiveExtractMaxMB:     true,
+	SettingKeyTempDir:                 true,
+	SettingKeyDownloadPathLocks:       true,
+	SettingKeyAutoReclaimPort:         true,
+	SettingKeyPortRedirect:            true,
+	SettingKeyAutoRestart:             true,
+	SettingKeyHiddenRules:             true,
+	SettingKeyLanguage:                true,
+	SettingKeyTrashMaxMB:              true,
+	SettingKeyTrashTooLarge:           true,
+	SettingKeyMaxPathBytes:            true,
+	// Hardening the host opted into; web clients must not turn it off.
+	SettingKeyMarkUploads: true,
+	SettingKeyReadOnly:    true,
+	SettingKeyAdminPass:   true,
+	SettingKeyAdminIPs:    true,
+	// A browser changing it would cut itself off.
+	SettingKeyBasePath: true,
+	// Would let any page a guest visits read the share with their cookie.
+	SettingKeyCORSOrigins: true,
+	// The host's choice of what never leaves in a zip.
+	SettingKeyZipDefaultIgnore: true,
+	// A guest must not keep a forgotten share alive.
+	SettingKeyIdleStopMinutes: true,
+	// Upload limits are the host's; a guest would lift its own quota.
+	SettingKeyUploadQuotaBytes: true,
+	SettingKeyUploadDedup:      true,
+	// Stream limits: a guest must not undo them.
+	SettingKeySSEKeepAliveSeconds: true,
+	SettingKeySSEBufferSize:       true,
+	SettingKeySSEMaxClientsPerIP:  true,
+	SettingKeySSEMaxClients:       true,
+	// Whole-share downloads stay off once the host turned them off.
+	SettingKeyDownloadAllRoot: true,
+	// Would let a guest make the host share a folder on its next launch.
+	SettingKeyAutoResume: true,
+	// The web UI protection, the access log file and the share-wide
+	// ignore list (which also decides what /api/tree exports) are the
+	// host's.
+	SettingKeyProtectWebUI:  true,
+	SettingKeyAccessLogFile: true,
+	SettingKeyWatchIgnore:   true,
+	// A desktop notification switch.
+	SettingKeyNotifyClientConnected: true,
+	// Watcher tuning is the host's; a guest could max out the dirs.
+	SettingKeyWatchDebounceMs: true,
+	SettingKeyWatchMaxDelayMs: true,
+	SettingKeyWatchMaxDirs:    true,
+	// Decides what every client is offered, like the default zip ignore.
+	SettingKeyZipIgnoreSuggestions: true,
+}
+
+func (s *Server) handleSettings(w http.ResponseWriter, r *http.Request) {
+	if s.settings == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "settings store not available"})
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/api/settings")
+	key = strings.TrimPrefix(key, "/")
+	key = strings.TrimSpace(key)
+	if key == "" {
+		s.handleSettingsBatch(w, r)
+		return
+	}
+	// Settings that would let a web client take over the host stay desktop-only.
+	if httpHiddenSettingKeys[key] {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		return
+	}
+	if !IsValidSettingKey(key) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid key"})
+		return
+	}
+	if !s.requireAuth(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		raw, ok, err := s.settings.Get(key)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "read settings failed"})
+			return
+		}
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+			return
+		}
+		writeJSON(w, http.StatusOK, struct {
+			Value json.RawMessage `json:"value"`
+		}{Value: raw})
+		return
+
+	case http.MethodPut:
+		var req struct {
+			Value json.RawMessage `json:"value"`
+		}
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+			return
+		}
+
+		// Treat null/empty as delete.
+		origin := settingOrigin{source: SettingOriginWeb, clientIP: s.clientIP(r)}
+		if len(req.Value) == 0 || string(req.Value) == "null" {
+			if err := s.setSettingFrom(key, nil, origin); err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "delete setting failed"})
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+			return
+		}
+
+		if !json.Valid(req.Value) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json value"})
+			return
+		}
+		if err := s.setSettingFrom(key, req.Value, origin); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "save setting failed"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+		return
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+}
+
+func IsValidSettingKey(key string) bool {
+	if len(key) == 0 || len(key) > 256 {
+		return false
+	}
+	// Keep URL/path parsing simple and avoid surprising keys.
+	if strings.Contains(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+	return true
+}
+
+// handleFiles compresses regular listings; ?stream=1 listings go out
+// uncompressed because gzipJSON buffers and would defeat the flushing.
+func (s *Server) handleFiles(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("stream") == "1" {
+		s.listFiles(w, r)
+		return
+	}
+	gzipJSON(s.listFiles)(w, r)
+}
+
+func (s *Server) listFiles(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	root := s.sharedRoot
+	s.mu.RUnlock()
+	if root == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "服务未启动"})
+		return
+	}
+	if !s.requireAuth(w, r) {
+		return
+	}
+	if !s.requirePermission(w, "read") {
+		return
+	}
+
+	subPath := r.URL.Query().Get("path")
+	fullPath, ok := s.resolveSharePath(w, r, root, subPath)
+	if !ok {
+		return
+	}
+
+	st, err := os.Stat(fullPath)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "路径不存在"})
+		return
+	}
+	if !st.IsDir() {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "路径不存在"})
+		return
+	}
+
+	if r.URL.Query().Get("stream") == "1" {
+		s.streamDirectoryItems(w, fullPath, wantDetails(r))
+		return
+	}
+
+	var readme readmeFinder
+	items, truncated, err := listDirectoryItems(fullPath, s.listMaxItems(), s.hiddenRules(), &readme)
+	if err != nil {
+		writeReadDirError(w, err)
+		return
+	}
+	if wantDetails(r) {
+		fillOwners(fullPath, items)
+	}
+
+	rootName := filepath.Base(root)
+	if rootName == "" {
+		rootName = root
+	}
+
+	var parentPath *string
+	if strings.TrimSpace(subPath) != "" {
+		p := filepath.ToSlash(filepath.Dir(filepath.FromSlash(subPath)))
+		if p == "." {
+			p = ""
+		}
+		parentPath = &p
+	}
+
+	resp := filesResponse{
+		Items:       items,
+		RootName:    rootName,
+		CurrentPath: subPath,
+		ParentPath:  parentPath,
+		Truncated:   truncated,
+		Readme:      readme.info(fullPath, relativeSharePath(root, fullPath), r.URL.Query().Get("inlineReadme") == "1"),
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handlePathInfo(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	root := s.sharedRoot
+	s.mu.RUnlock()
+	if root == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "服务未启动"})
+		return
+	}
+	if !s.requireAuth(w, r) {
+		return
+	}
+	if !s.requirePermission(w, "read") {
+		return
+	}
+
+	subPath := r.URL.Query().Get("path")
+	fullPath, ok := s.resolveSharePath(w, r, root, subPath)
+	if !ok {
+		return
+	}
+
+	st, err := os.Stat(fullPath)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "路径不存在"})
+		return
+	}
+
+	currentPath := relativeSharePath(root, fullPath)
+	resp := pathInfoResponse{
+		RootName:    sharedRootName(root),
+		CurrentPath: currentPath,
+		ParentPath:  parentSharePath(currentPath),
+	}
+
+	if st.IsDir() {
+		items, truncated, err := listDirectoryItems(fullPath, s.listMaxItems(), s.hiddenRules(), nil)
+		if err != nil {
+			writeReadDirError(w, err)
+			return
+		}
+		if wantDetails(r) {
+			fillOwners(fullPath, items)
+		}
+		resp.Kind = "directory"
+		resp.Items = items
+		resp.Truncated = truncated
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	item := buildDirectoryItem(filepath.Dir(fullPath), filepath.Base(fullPath), st, s.hiddenRules())
+	if wantDetails(r) {
+		item.Owner = fileOwner(fullPath)
+	}
+	resp.Kind = "file"
+	resp.Item = &item
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	root := s.sharedRoot
+	s.mu.RUnlock()
+	if root == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "服务未启动"})
+		return
+	}
+	// A download token stands in for the session: the browser may resume
+	// long after the token it started with has rotated.
+	q := r.URL.Query()
+	var claims *downloadClaims
+	if q.Get(queryDownloadToken) != "" {
+		target := cleanSharePath(q.Get("path"))
+		if job := q.Get("job"); job != "" {
+			target = "job:" + job
+		}
+		c, ok := s.checkDownloadToken(w, r, root, target)
+		if !ok {
+			return
+		}
+		s.noteActivity(w)
+		claims = &c
+	} else if viaLink, ok := s.requireAuthOrLink(w, r, root); !ok {
+		return
+	} else if viaLink && wantsDownloadToken(r) {
+		// A link token must not outlive itself as a 4h download token.
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "下载链接不能换取下载令牌"})
+		return
+	}
+	if !s.requirePermission(w, "read") {
+		return
+	}
+
+	if job := q.Get("job"); job != "" {
+		s.serveArchiveJob(w, r, root, job, claims)
+		return
+	}
+
+	filePath := q.Get("path")
+	if strings.TrimSpace(filePath) == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "缺少文件路径参数"})
+		return
+	}
+
+	fullPath, ok := s.resolveSharePath(w, r, root, filePath)
+	if !ok {
+		return
+	}
+
+	if s.getBoolSetting(SettingKeyDownloadPathLocks) {
+		unlock, err := s.pathLocks.lock(r.Context(), []string{relativeSharePath(root, fullPath)}, false)
+		if err != nil {
+			return
+		}
+		defer unlock()
+	}
+
+	st, err := os.Stat(fullPath)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "文件不存在"})
+		return
+	}
+	if st.IsDir() {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "无法下载文件夹"})
+		return
+	}
+	if claims != nil && !claims.matches(st) {
+		downloadTokenStale.write(w)
+		return
+	}
+	if claims == nil && wantsDownloadToken(r) {
+		s.writeDownloadToken(w, r, root, relativeSharePath(root, fullPath), st)
+		return
+	}
+
+	name := filepath.Base(fullPath)
+	w.Header().Set("Content-Type", contentTypeFor(name))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename*=UTF-8''%s", url.PathEscape(name)))
+	serveSharedFile(w, r, fullPath)
+}
+
+type pathsRequest struct {
+	Paths  []string `json:"paths"`
+	Ignore []string `json:"ignore"`
+	// CaseInsensitive makes zip entry names unique ignoring case.
+	// It is implied for clients that usually extract onto case-insensitive filesystems.
+	CaseInsensitive bool `json:"caseInsensitive"`
+	// UseIgnoreFiles applies .gitignore / .localshareignore on top of Ignore.
+	UseIgnoreFiles bool `json:"useIgnoreFiles"`
+	// NoDefaultIgnore leaves SettingKeyZipDefaultIgnore out; remote admins
+	// only.
+	NoDefaultIgnore bool `json:"noDefaultIgnore"`
+	// Compression is "" / "deflate" (default) or "store", which skips
+	// compression and lets download-zip send an exact Content-Length.
+	Compression string `json:"compression"`
+	// Strict refuses files that changed after they were listed: download-zip
+	// answers 409 ZIP_FILES_CHANGED before streaming, and a change noticed
+	// later cuts the archive short. Without it such files are skipped and
+	// named in MANIFEST-WARNINGS.txt.
+	Strict bool `json:"strict"`
+	// Permanent confirms that a delete too large for the Recycle Bin
+	// (SettingKeyTrashMaxMB) may remove the files for good.
+	Permanent bool `json:"permanent"`
+}
+
+// isCaseInsensitiveClient guesses whether the client OS extracts archives onto a
+// case-insensitive filesystem (Windows, and macOS by default).
+func isCaseInsensitiveClient(r *http.Request) bool {
+	ua := r.UserAgent()
+	return strings.Contains(ua, "Windows") || strings.Contains(ua, "Macintosh")
+}
+
+// entryNameDeduper hands out unique archive entry names, appending " (n)" on
+// collisions. With caseInsensitive, "Readme.md" and "README.md" collide too so
+// that neither overwrites the other when extracted on Windows.
+type entryNameDeduper struct {
+	caseInsensitive bool
+	used            map[string]struct{}
+}
+
+func newEntryNameDeduper(caseInsensitive bool) *entryNameDeduper {
+	return &entryNameDeduper{caseInsensitive: caseInsensitive, used: map[string]struct{}{}}
+}
+
+func (d *entryNameDeduper) key(name string) string {
+	if d.caseInsensitive {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+func (d *entryNameDeduper) unique(name string) string {
+	name = path.Clean(strings.TrimPrefix(name, "/"))
+	if name == "." || name == "" {
+		name = "file"
+	}
+	if _, ok := d.used[d.key(name)]; !ok {
+		d.used[d.key(name)] = struct{}{}
+		return name
+	}
+
+	dir := path.Dir(name)
+	base := path.Base(name)
+	ext := path.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	for c := 1; ; c++ {
+		alt := stem + " (" + strconv.Itoa(c) + ")" + ext
+		if dir != "." {
+			alt = path.Join(dir, alt)
+		}
+		if _, ok := d.used[d.key(alt)]; !ok {
+			d.used[d.key(alt)] = struct{}{}
+			return alt
+		}
+	}
+}
+
+// readPathsRequest decodes a download-zip style body and returns its paths
+// trimmed and de-duplicated. On failure it has already written the error.
+func readPathsRequest(w http.ResponseWriter, r *http.Request) (pathsRequest, []string, bool) {
+	// Avoid zip-bomb/oversized requests.
+	r.Body = http.MaxBytesReader(w, r.Body, 4*1024*1024)
+
+	var req pathsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "请求体解析失败"})
+		return req, nil, false
+	}
+
+	paths := make([]string, 0, len(req.Paths))
+	seen := make(map[string]struct{}, len(req.Paths))
+	for _, p := range req.Paths {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if _, ok := seen[p]; ok {
+			continue
+		}
+		seen[p] = struct{}{}
+		paths = append(paths, p)
+	}
+	if len(paths) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "未选择任何内容"})
+		return req, nil, false
+	}
+	if len(paths) > maxZipPaths {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "一次最多选择 200 个路径"})
+		return req, nil, false
+	}
+	switch req.Compression {
+	case "", zipCompressionDeflate, zipCompressionStore:
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "不支持的压缩方式"})
+		return req, nil, false
+	}
+	return req, paths, true
+}
+
+func (s *Server) handleDownloadZip(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "仅支持 POST"})
+		return
+	}
+
+	s.mu.RLock()
+	root := s.sharedRoot
+	s.mu.RUnlock()
+	if root == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "服务未启动"})
+		return
+	}
+	if !s.requireAuth(w, r) {
+		return
+	}
+	if !s.requirePermission(w, "read") {
+		return
+	}
+
+	req, paths, ok := readPathsRequest(w, r)
+	if !ok || !s.checkSharePaths(w, r, root, paths) {
+		return
+	}
+
+	// 单个文件：保持兼容，直接返回原文件（不打 zip）
+	if len(paths) == 1 {
+		fullPath, ok := s.resolveSharePath(w, r, root, paths[0])
+		if !ok {
+			return
+		}
+		st, err := os.Stat(fullPath)
+		if err != nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "路径不存在"})
+			return
+		}
+		rootClean := filepath.Clean(root)
+		fullClean := filepath.Clean(fullPath)
+		isRoot := fullClean == rootClean
+		if runtime.GOOS == "windows" {
+			isRoot = strings.EqualFold(fullClean, rootClean)
+		}
+		if isRoot {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "禁止下载根目录"})
+			return
+		}
+
+		if !st.IsDir() {
+			name := filepath.Base(fullPath)
+			w.Header().Set("Content-Type", contentTypeFor(name))
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename*=UTF-8''%s", url.PathEscape(name)))
+			serveSharedFile(w, r, fullPath)
+			return
+		}
+	}
+
+	ignore, _, ok := s.withZipDefaultIgnore(w, r, req.Ignore, req.NoDefaultIgnore)
+	if !ok {
+		return
+	}
+	zipName := zipNameForPaths(paths)
+	candidates, err := s.collectZipCandidates(root, paths, zipFilter{ignore: ignore, useIgnoreFiles: req.UseIgnoreFiles})
+	if err != nil {
+		writeZipError(w, err)
+		return
+	}
+	if req.Strict {
+		if changed := changedCandidates(candidates, s.zipStatHook); len(changed) > 0 {
+			if len(changed) > maxZipChangedReported {
+				changed = changed[:maxZipChangedReported]
+			}
+			writeJSON(w, http.StatusConflict, map[string]any{
+				"error": "有文件正在被修改，请稍后重试",
+				"code":  "ZIP_FILES_CHANGED",
+				"files": changed,
+			})
+			return
+		}
+	}
+	s.streamZip(w, zipName, candidates, req.CaseInsensitive || isCaseInsensitiveClient(r), req.Compression == zipCompressionStore, req.Strict)
+}
+
+type downloadEstimateResponse struct {
+	TotalBytes int64 `json:"totalBytes"`
+	FileCount  int   `json:"fileCount"`
+	// LimitExceeded is set when download-zip would refuse the selection;
+	// the totals still cover all of it.
+	LimitExceeded bool  `json:"limitExceeded"`
+	MaxFiles      int   `json:"maxFiles"`
+	MaxBytes      int64 `json:"maxBytes"`
+	// DefaultIgnore are the SettingKeyZipDefaultIgnore entries download-zip
+	// will add to the request's ignore list.
+	DefaultIgnore []string `json:"defaultIgnore,omitempty"`
+}
+
+// handleDownloadEstimate runs only the candidate-collection pass of
+// download-zip for the same request body, so clients can show the size before
+// the user confirms. Nothing is read from the files themselves.
+func (s *Server) handleDownloadEstimate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "仅支持 POST"})
+		return
+	}
+
+	s.mu.RLock()
+	root := s.sharedRoot
+	s.mu.RUnlock()
+	if root == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "服务未启动"})
+		return
+	}
+	if !s.requireAuth(w, r) {
+		return
+	}
+	if !s.requirePermission(w, "read") {
+		return
+	}
+
+	req, paths, ok := readPathsRequest(w, r)
+	if !ok || !s.checkSharePaths(w, r, root, paths) {
+		return
+	}
+
+	resp := downloadEstimateResponse{MaxFiles: maxFilesInZip, MaxBytes: maxZipTotalSize}
+
+	// A single file is served as-is by download-zip: no ignore list, no limits.
+	if len(paths) == 1 {
+		if fullPath, ok := safeJoin(root, paths[0]); ok {
+			if st, err := os.Stat(fullPath); err == nil && st.Mode().IsRegular() {
+				resp.TotalBytes = st.Size()
+				resp.FileCount = 1
+				writeJSON(w, http.StatusOK, resp)
+				return
+			}
+		}
+	}
+
+	ignore, added, ok := s.withZipDefaultIgnore(w, r, req.Ignore, req.NoDefaultIgnore)
+	if !ok {
+		return
+	}
+	resp.DefaultIgnore = added
+
+	// Keep counting past the limits so the client can say by how much.
+	err := s.walkZipCandidates(root, paths, zipFilter{ignore: ignore, useIgnoreFiles: req.UseIgnoreFiles}, func(c zipCandidate) error {
+		resp.FileCount++
+		resp.TotalBytes += c.size
+		return nil
+	})
+	if err != nil {
+		writeZipError(w, err)
+		return
+	}
+	resp.LimitExceeded = resp.FileCount > maxFilesInZip || resp.TotalBytes > maxZipTotalSize
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// zipNameForPaths names the archive after a single selected folder, or after
+// the current time for a mixed selection.
+func zipNameForPaths(paths []string) string {
+	if len(paths) == 1 {
+		base := path.Base(path.Clean(filepath.ToSlash(paths[0])))
+		if base != "." && base != "" {
+			return base + ".zip"
+		}
+	}
+	return "shared-" + time.Now().Format("20060102-150405") + ".zip"
+}
+
+// handleDownloadAll zips one directory for a "download everything" button.
+// Being a GET it also works as a plain link (token via query). Hidden files
+// and the share-wide ignore list are always left out, and so is
+// SettingKeyZipDefaultIgnore unless a remote admin adds noDefaultIgnore=1.
+func (s *Server) handleDownloadAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "仅支持 GET"})
+		return
+	}
+
+	s.mu.RLock()
+	root := s.sharedRoot
+	s.mu.RUnlock()
+	if root == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "服务未启动"})
+		return
+	}
+	if !s.requireAuth(w, r) {
+		return
+	}
+	if !s.requirePermission(w, "read") {
+		return
+	}
+
+	rel := strings.TrimSpace(r.URL.Query().Get("path"))
+	fullPath, ok := s.resolveSharePath(w, r, root, rel)
+	if !ok {
+		return
+	}
+	st, err := os.Stat(fullPath)
+	if err != nil || !st.IsDir() {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "目录不存在"})
+		return
+	}
+
+	ignore, _, ok := s.withZipDefaultIgnore(w, r, nil, r.URL.Query().Get("noDefaultIgnore") == "1")
+	if !ok {
+		return
+	}
+	zipName := filepath.Base(fullPath) + ".zip"
+	candidates, err := s.collectZipCandidates(root, []string{rel}, zipFilter{
+		ignore:     ignore,
+		skipHidden: true,
+		allowRoot:  s.getBoolSetting(SettingKeyDownloadAllRoot),
+	})
+	if err != nil {
+		writeZipError(w, err)
+		return
+	}
+	s.streamZip(w, zipName, candidates, isCaseInsensitiveClient(r), false, false)
+}
+
+// zipFilter decides what collectZipCandidates leaves out.
+type zipFilter struct {
+	// ignore holds names ("node_modules") and share-relative prefixes ("web/dist").
+	// The share-wide SettingKeyWatchIgnore list is always added.
+	ignore []string
+	// skipHidden leaves out hidden files and folders found while walking.
+	skipHidden bool
+	// allowRoot permits selecting the share root itself.
+	allowRoot bool
+	// useIgnoreFiles also applies .gitignore and .localshareignore files
+	// found in the selection's folder and below.
+	useIgnoreFiles bool
+}
+
+type zipCandidate struct {
+	fullPath string
+	zipEntry string
+	modTime  time.Time
+	size     int64
+}
+
+// zipError carries the HTTP status for a request that can't be zipped.
+type zipError struct {
+	status int
+	msg    string
+}
+
+func (e *zipError) Error() string { return e.msg }
+
+func writeZipError(w http.ResponseWriter, err error) {
+	var ze *zipError
+	if errors.As(err, &ze) {
+		writeJSON(w, ze.status, map[string]string{"error": ze.msg})
+		return
+	}
+	writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "打包失败"})
+}
+
+// Limits for one zip download.
+const (
+	maxZipPaths           = 200
+	maxFilesInZip         = 2000
+	maxZipTotalSize int64 = 2 * 1024 * 1024 * 1024 // 2GB (uncompressed)
+)
+
+// collectZipCandidates validates the share-relative paths and lists the files
+// to archive, so errors can still be reported as JSON before streaming starts.
+func (s *Server) collectZipCandidates(root string, paths []string, filter zipFilter) ([]zipCandidate, error) {
+	errTooManyFiles := &zipError{http.StatusBadRequest, "打包文件过多，请减少选择"}
+	errTooLarge := &zipError{http.StatusBadRequest, "打包内容过大，请减少选择"}
+
+	candidates := make([]zipCandidate, 0, len(paths))
+	var totalSize int64
+	err := s.walkZipCandidates(root, paths, filter, func(c zipCandidate) error {
+		if len(candidates) >= maxFilesInZip {
+			return errTooManyFiles
+		}
+		totalSize += c.size
+		if totalSize > maxZipTotalSize {
+			return errTooLarge
+		}
+		candidates = append(candidates, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) == 0 {
+		return nil, &zipError{http.StatusBadRequest, "打包内容为空（已全部被忽略）"}
+	}
+	return candidates, nil
+}
+
+// walkZipCandidates is the candidate-collection pass shared by downloads and
+// estimates: it validates paths, applies the ignore lists and hands every file
+// that would be archived to add, stopping at the first error add returns.
+func (s *Server) walkZipCandidates(root string, paths []string, filter zipFilter, add func(zipCandidate) error) error {
+	ignoreList := append(append([]string(nil), filter.ignore...), s.getWatchIgnoreFromSettings()...)
+	rules := s.hiddenRules()
+	ignore := newZipIgnore(ignoreList)
+
+	addCandidate := func(fullPath string, zipEntry string, modTime time.Time, size int64) error {
+		return add(zipCandidate{fullPath: fullPath, zipEntry: zipEntry, modTime: modTime, size: size})
+	}
+
+	for _, rel := range paths {
+		full, ok := safeJoin(root, rel)
+		if !ok {
+			return &zipError{http.StatusForbidden, "包含无权限访问的路径"}
+		}
+		rootClean := filepath.Clean(root)
+		fullClean := filepath.Clean(full)
+		isRoot := fullClean == rootClean
+		if runtime.GOOS == "windows" {
+			isRoot = strings.EqualFold(fullClean, rootClean)
+		}
+		if isRoot && !filter.allowRoot {
+			return &zipError{http.StatusBadRequest, "禁止下载根目录"}
+		}
+		st, err := os.Lstat(full)
+		if err != nil {
+			return &zipError{http.StatusNotFound, "包含不存在的路径"}
+		}
+		if st.Mode()&os.ModeSymlink != 0 {
+			return &zipError{http.StatusBadRequest, "不支持打包符号链接"}
+		}
+
+		cleanRel := path.Clean(filepath.ToSlash(rel))
+		cleanRel = strings.TrimPrefix(cleanRel, "/")
+		if isRoot {
+			cleanRel = ""
+		}
+		// Also catches a selection that lies inside an ignored prefix.
+		if ignore.entry(cleanRel) {
+			continue
+		}
+
+		var ignoreFiles *ignoreMatcher
+		if filter.useIgnoreFiles {
+			ignoreFiles = &ignoreMatcher{}
+			if !isRoot {
+				// The folder the selection was made in; nested files are
+				// picked up during the walk.
+				parentRel := path.Dir(cleanRel)
+				if parentRel == "." {
+					parentRel = ""
+				}
+				ignoreFiles.load(filepath.Dir(full), parentRel)
+			}
+			if ignoreFiles.ignored(cleanRel, st.IsDir()) {
+				continue
+			}
+		}
+
+		if !st.IsDir() {
+			if !st.Mode().IsRegular() {
+				return &zipError{http.StatusBadRequest, "只支持打包普通文件"}
+			}
+			if err := addCandidate(full, cleanRel, st.ModTime(), st.Size()); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// 目录：递归打包，保留相对路径前缀
+		walkErr := filepath.WalkDir(full, func(p string, d fs.DirEntry, walkErr error) error {
+			if walkErr != nil {
+				return walkErr
+			}
+			if ignore.name(d.Name()) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			// 跳过 symlink（避免穿透共享根目录）
+			if d.Type()&fs.ModeSymlink != 0 {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			// 选中的目录本身即使是隐藏的也照常打包，只过滤其中的隐藏项。
+			if filter.skipHidden && p != full && isHiddenPath(filepath.Dir(p), d.Name(), rules) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			relInside, err := filepath.Rel(full, p)
+			if err != nil {
+				return nil
+			}
+			zipEntry := path.Join(cleanRel, filepath.ToSlash(relInside))
+			if d.IsDir() {
+				if p != full && ignore.entry(zipEntry) {
+					return filepath.SkipDir
+				}
+				if ignoreFiles != nil {
+					if p != full && ignoreFiles.ignored(zipEntry, true) {
+						return filepath.SkipDir
+					}
+					ignoreFiles.load(p, zipEntry)
+				}
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			if ignore.entry(zipEntry) {
+				return nil
+			}
+			if ignoreFiles.ignored(zipEntry, false) {
+				return nil
+			}
+			return addCandidate(p, zipEntry, info.ModTime(), info.Size())
+		})
+		if walkErr != nil {
+			return walkErr
+		}
+	}
+	return nil
+}
+
+// streamZip writes the archive. Errors after the first byte can't be reported,
+// so the stream is just cut short. Every zip gets X-Estimated-Uncompressed-Size;
+// store-only zips also get their exact Content-Length.
+func (s *Server) streamZip(w http.ResponseWriter, zipName string, candidates []zipCandidate, caseInsensitive, store, strict bool) {
+	var total int64
+	for _, c := range candidates {
+		total += c.size
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename*=UTF-8''%s", url.PathEscape(zipName)))
+	w.Header().Set(headerEstimatedUncompressedSize, strconv.FormatInt(total, 10))
+	if store {
+		w.Header().Set("Content-Length", strconv.FormatInt(storeZipSize(zipEntryNames(candidates, caseInsensitive), candidates), 10))
+	}
+	// Response has already started (zip stream). We can't safely switch to JSON.
+	_ = writeZip(context.Background(), w, candidates, caseInsensitive, store, strict, nil, s.zipStatHook)
+}
+
+// zipEntryNames is the name writeZip gives each candidate, in order.
+func zipEntryNames(candidates []zipCandidate, caseInsensitive bool) []string {
+	names := newEntryNameDeduper(caseInsensitive)
+	out := make([]string, len(candidates))
+	for i, c := range candidates {
+		out[i] = names.unique(c.zipEntry)
+	}
+	return out
+}
+
+// writeZip archives candidates into w, stopping at the first error or when
+// ctx is done. progress, if set, is told about every chunk of input read;
+// beforeOpen, if set, runs right before each file is opened.
+// With store, entries aren't compressed and each holds exactly the size seen
+// by the candidate pass, so the output matches storeZipSize; a file that has
+// since shrunk aborts the archive.
+//
+// A file whose size or mtime differs from the candidate pass when it is
+// opened is skipped and listed in a trailing MANIFEST-WARNINGS.txt, or, with
+// strict or store (whose length is already promised), aborts the archive
+// with errZipFileChanged.
+func writeZip(ctx context.Context, w io.Writer, candidates []zipCandidate, caseInsensitive, store, strict bool, progress func(n int64), beforeOpen func(c zipCandidate)) error {
+	zw := zip.NewWriter(w)
+	names := zipEntryNames(candidates, caseInsensitive)
+	method := zip.Deflate
+	if store {
+		method = zip.Store
+	}
+	var changed []string
+
+	addFile := func(c zipCandidate, name string) error {
+		if beforeOpen != nil {
+			beforeOpen(c)
+		}
+		in, err := openShared(c.fullPath)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		st, err := in.Stat()
+		if err != nil {
+			return err
+		}
+		if candidateChanged(c, st) {
+			if strict || store {
+				return errZipFileChanged
+			}
+			changed = append(changed, name)
+			return nil
+		}
+
+		h := &zip.FileHeader{Name: name, Method: method}
+		h.SetModTime(c.modTime)
+		wtr, err := zw.CreateHeader(h)
+		if err != nil {
+			return err
+		}
+		pr := &progressReader{r: in, ctx: ctx, progress: progress}
+		if store {
+			_, err = io.CopyN(wtr, pr, c.size)
+		} else {
+			_, err = io.Copy(wtr, pr)
+		}
+		return err
+	}
+
+	var err error
+	for i, c := range candidates {
+		if err = addFile(c, names[i]); err != nil {
+			break
+		}
+	}
+	if err == nil && len(changed) > 0 {
+		dedupe := newEntryNameDeduper(caseInsensitive)
+		for _, n := range names {
+			dedupe.unique(n)
+		}
+		var wtr io.Writer
+		if wtr, err = zw.Create(dedupe.unique(zipWarningsEntry)); err == nil {
+			_, err = io.WriteString(wtr, zipWarningsText(changed))
+		}
+	}
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// progressReader reports bytes read and stops reading once ctx is done.
+type progressReader struct {
+	r        io.Reader
+	ctx      context.Context
+	progress func(n int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	if err := p.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := p.r.Read(b)
+	if n > 0 && p.progress != nil {
+		p.progress(int64(n))
+	}
+	return n, err
+}
+
+func (s *Server) handlePreview(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	root := s.sharedRoot
+	s.mu.RUnlock()
+	if root == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "服务未启动"})
+		return
+	}
+	if !s.requireAuth(w, r) {
+		return
+	}
+	if !s.requirePermission(w, "read") {
+		return
+	}
+
+	filePath := r.URL.Query().Get("path")
+	if strings.TrimSpace(filePath) == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "缺少文件路径参数"})
+		return
+	}
+
+	fullPath, ok := s.resolveSharePath(w, r, root, filePath)
+	if !ok {
+		return
+	}
+
+	st, err := os.Stat(fullPath)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "文件不存在"})
+		return
+	}
+	if st.IsDir() {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "无法预览文件夹"})
+		return
+	}
+
+	preview := classifyPreview(filepath.Base(fullPath), st.Size())
+	if preview == nil || !preview.Supported {
+		status := http.StatusUnsupportedMediaType
+		message := "不支持的文件类型"
+		if preview != nil && preview.Reason == "file_too_large" {
+			status = http.StatusRequestEntityTooLarge
+			message = "文件过大，暂不支持在线预览"
+		}
+		writeJSON(w, status, map[string]string{"error": message})
+		return
+	}
+	w.Header().Set("Content-Type", preview.ContentType)
+	if preview.Kind == "pdf" {
+		// Open in the browser's viewer rather than download.
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename*=UTF-8''%s", url.PathEscape(filepath.Base(fullPath))))
+	}
+	serveSharedFile(w, r, fullPath)
+}
+
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	root := s.sharedRoot
+	s.mu.RUnlock()
+	if root == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "服务未启动"})
+		return
+	}
+	if !s.requireAuth(w, r) {
+		return
+	}
+	perms := s.getPermissionsFromSettings()
+	markUploads := s.getBoolSetting(SettingKeyMarkUploads)
+	if !perms.Write {
+		writeJSON(w, http.StatusForbidden, map[string]string{
+			"error": "无写入权限",
+			"code":  "PERMISSION_DENIED_WRITE",
+		})
+		return
+	}
+
+	ip := s.clientIP(r)
+	quota, quotaEnabled := s.getUploadQuotaFromSettings()
+	if quotaEnabled && s.stats.uploadedBytes(ip) >= quota {
+		s.writeUploadQuotaExceeded(w, ip, quota)
+		return
+	}
+	// Errors tell the client its remaining quota too, as success does.
+	uploadErr := func(status int, body map[string]string) {
+		s.writeUploadError(w, status, body, ip, quota, quotaEnabled)
+	}
+
+	progress := s.uploadProgress.begin(r.Header.Get(headerUploadID), ip, r.ContentLength)
+	defer progress.close()
+
+	// 10GB
+	r.Body = progress.body(http.MaxBytesReader(w, r.Body, 10*1024*1024*1024))
+
+	if err := r.ParseMultipartForm(64 << 20); err != nil {
+		uploadErr(http.StatusBadRequest, map[string]string{"error": "解析上传数据失败"})
+		return
+	}
+
+	vals := r.MultipartForm.Value
+	targetPath := ""
+	if v, ok := vals["path"]; ok && len(v) > 0 {
+		targetPath = v[0]
+	}
+
+	uploadDir, status, errBody := s.sharePathError(w, r, root, targetPath)
+	if errBody != nil {
+		uploadErr(status, errBody)
+		return
+	}
+	if err := os.MkdirAll(uploadDir, 0o755); err != nil {
+		uploadErr(http.StatusInternalServerError, map[string]string{"error": "创建目录失败"})
+		return
+	}
+
+	files := r.MultipartForm.File["files"]
+	if len(files) == 0 {
+		uploadErr(http.StatusBadRequest, map[string]string{"error": "没有上传文件"})
+		return
+	}
+	for _, fh := range files {
+		if body := s.pathInputError(fh.Filename); body != nil {
+			uploadErr(http.StatusBadRequest, body)
+			return
+		}
+	}
+
+	var results []uploadedFile
+	dedup := s.getBoolSetting(SettingKeyUploadDedup)
+	var writeTotal int64
+	for _, fh := range files {
+		writeTotal += fh.Size
+	}
+	progress.writing(writeTotal)
+
+	for _, fh := range files {
+		f, err := fh.Open()
+		if err != nil {
+			uploadErr(http.StatusInternalServerError, map[string]string{"error": "读取上传文件失败"})
+			return
+		}
+		defer f.Close()
+
+		if dedup {
+			// 内容完全相同的文件已存在时，不再写入，直接返回已有文件路径。
+			existing, dup := s.uploadHashes.findDuplicate(uploadDir, fh.Size, func() ([32]byte, error) {
+				sum, err := sha256Reader(f)
+				if _, serr := f.Seek(0, io.SeekStart); err == nil && serr != nil {
+					err = serr
+				}
+				return sum, err
+			})
+			if dup {
+				progress.skip(fh.Size)
+				rel, _ := filepath.Rel(root, filepath.Join(uploadDir, existing))
+				results = append(results, uploadedFile{
+					Name:   fh.Filename,
+					Size:   fh.Size,
+					Path:   filepath.ToSlash(rel),
+					Status: "duplicate",
+				})
+				continue
+			}
+		}
+
+		outPath := filepath.Join(uploadDir, filepath.Base(fh.Filename))
+		if !perms.Delete {
+			if msg, denied := uploadOverwriteDenied(outPath); denied {
+				uploadErr(http.StatusForbidden, map[string]string{"error": msg, "code": "PERMISSION_DENIED_DELETE"})
+				return
+			}
+		}
+
+		// Write to a temp file next to the target, then rename it into place
+		// under the path lock: concurrent uploads of the same name can't
+		// interleave, and readers see either the old file or the new one.
+		tmp, err := createUploadTemp(uploadDir)
+		if err != nil {
+			uploadErr(http.StatusInternalServerError, map[string]string{"error": "写入文件失败"})
+			return
+		}
+		src := &quotaReader{r: f, stats: s.stats, ip: ip, limit: quota}
+		_, copyErr := io.Copy(tmp, progress.file(fh.Filename, src))
+		progress.finishing()
+		closeErr := tmp.Close()
+		if copyErr != nil || closeErr != nil {
+			src.refund()
+			_ = os.Remove(tmp.Name())
+			if errors.Is(copyErr, errUploadQuotaExceeded) {
+				s.writeUploadQuotaExceeded(w, ip, quota)
+				return
+			}
+			uploadErr(http.StatusInternalServerError, map[string]string{"error": "写入文件失败"})
+			return
+		}
+		// Marked on the temp file: the stream moves with it on rename.
+		if markUploads {
+			if err := writeZoneIdentifier(tmp.Name()); err != nil {
+				s.logf("mark upload %q from web failed: %v", fh.Filename, err)
+			}
+		}
+
+		unlock, err := s.pathLocks.lock(r.Context(), []string{relativeSharePath(root, outPath)}, true)
+		if err != nil {
+			// The client went away while waiting.
+			src.refund()
+			_ = os.Remove(tmp.Name())
+			return
+		}
+		if !perms.Delete {
+			// Another upload may have created it meanwhile, and something
+			// outside LocalShare still can until the rename, so the name is
+			// claimed with O_EXCL: the rename then only replaces our own
+			// empty placeholder.
+			msg, denied, err := s.claimUploadPath(outPath)
+			if err != nil || denied {
+				unlock()
+				src.refund()
+				_ = os.Remove(tmp.Name())
+				if err != nil {
+					uploadErr(http.StatusInternalServerError, map[string]string{"error": "写入文件失败"})
+				} else {
+					uploadErr(http.StatusForbidden, map[string]string{"error": msg, "code": "PERMISSION_DENIED_DELETE"})
+				}
+				return
+			}
+		}
+		renameErr := renameUploaded(tmp.Name(), outPath)
+		if renameErr != nil && !perms.Delete {
+			_ = os.Remove(outPath)
+		}
+		unlock()
+		if renameErr != nil {
+			src.refund()
+			_ = os.Remove(tmp.Name())
+			if isFileLockedError(renameErr) {
+				uploadErr(http.StatusConflict, map[string]string{
+					"error": "文件被占用（可能正在被杀毒软件扫描），请稍后重试",
+					"code":  "UPLOAD_FILE_LOCKED",
+				})
+				return
+			}
+			uploadErr(http.StatusInternalServerError, map[string]string{"error": "写入文件失败"})
+			return
+		}
+
+		rel, _ := filepath.Rel(root, outPath)
+		results = append(results, uploadedFile{
+			Name:   fh.Filename,
+			Size:   fh.Size,
+			Path:   filepath.ToSlash(rel),
+			Status: "uploaded",
+		})
+	}
+
+	progress.done()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"success":        true,
+		"message":        fmt.Sprintf("成功上传 %d 个文件", len(results)),
+		"files":          results,
+		"quotaRemaining": s.uploadQuotaRemaining(ip, quota, quotaEnabled),
+	})
+}
+
+// uploadedFile is one entry of the "files" list in upload responses.
+type uploadedFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	Path   string `json:"path"`
+	Status string `json:"status"` // "uploaded" | "duplicate"
+}
+
+// uploadTempPattern names in-progress uploads; the leading dot keeps them
+// out of listings.
+const uploadTempPattern = uploadTempPrefix + "*.part"
+
+// uploadOverwriteDenied reports whether an upload to outPath would replace
+// something, which needs the delete permission. On case-insensitive file
+// systems "Docs" lands on an existing "docs", so names are compared ignoring
+// case there.
+func uploadOverwriteDenied(outPath string) (string, bool) {
+	st, err := os.Stat(outPath)
+	if err != nil && caseInsensitiveFS {
+		st, err = statFold(outPath)
+	}
+	if err != nil {
+		return "", false
+	}
+	if st.IsDir() {
+		return "无删除权限，不能覆盖同名目录", true
+	}
+	return "无删除权限，不能覆盖同名文件", true
+}
+
+// caseInsensitiveFS is true where shared folders are usually on
+// case-insensitive file systems.
+var caseInsensitiveFS = runtime.GOOS == "windows" || runtime.GOOS == "darwin"
+
+// statFold stats the entry of p's directory whose name equals p's ignoring case.
+func statFold(p string) (fs.FileInfo, error) {
+	dir, name := filepath.Split(p)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if strings.EqualFold(e.Name(), name) {
+			return e.Info()
+		}
+	}
+	return nil, fs.ErrNotExist
+}
+
+// claimUploadPath creates outPath as an empty file with O_EXCL. denied (with
+// the message for the client) means something already exists there.
+func (s *Server) claimUploadPath(outPath string) (msg string, denied bool, err error) {
+	if msg, denied := uploadOverwriteDenied(outPath); denied {
+		return msg, true, nil
+	}
+	if s.uploadClaimHook != nil {
+		s.uploadClaimHook(outPath)
+	}
+	f, err := os.OpenFile(outPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		if !errors.Is(err, fs.ErrExist) {
+			return "", false, err
+		}
+		if msg, denied := uploadOverwriteDenied(outPath); denied {
+			return msg, true, nil
+		}
+		return "无删除权限，不能覆盖同名文件", true, nil
+	}
+	return "", false, f.Close()
+}
+
+// uploadQuotaRemaining returns nil when uploads are unlimited.
+func (s *Server) uploadQuotaRemaining(ip string, quota int64, enabled bool) *int64 {
+	if !enabled {
+		return nil
+	}
+	remaining := quota - s.stats.uploadedBytes(ip)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &remaining
+}
+
+// writeUploadError answers a failed upload with body plus the client's
+// remaining quota, so the upload UI stays current after errors too.
+func (s *Server) writeUploadError(w http.ResponseWriter, status int, body map[string]string, ip string, quota int64, quotaEnabled bool) {
+	resp := make(map[string]any, len(body)+1)
+	for k, v := range body {
+		resp[k] = v
+	}
+	resp["quotaRemaining"] = s.uploadQuotaRemaining(ip, quota, quotaEnabled)
+	writeJSON(w, status, resp)
+}
+
+func (s *Server) writeUploadQuotaExceeded(w http.ResponseWriter, ip string, quota int64) {
+	writeJSON(w, http.StatusTooManyRequests, map[string]any{
+		"error":          "上传配额已用完",
+		"code":           "UPLOAD_QUOTA_EXCEEDED",
+		"quotaRemaining": s.uploadQuotaRemaining(ip, quota, true),
+	})
+}
+
+func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "仅支持 POST"})
+		return
+	}
+
+	s.mu.RLock()
+	root := s.sharedRoot
+	s.mu.RUnlock()
+	if root == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "服务未启动"})
+		return
+	}
+	if !s.requireAuth(w, r) {
+		return
+	}
+	if !s.requirePermission(w, "delete") {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 2*1024*1024)
+	var req pathsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "请求体解析失败"})
+		return
+	}
+
+	paths := make([]string, 0, len(req.Paths))
+	seen := make(map[string]struct{}, len(req.Paths))
+	for _, p := range req.Paths {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if _, ok := seen[p]; ok {
+			continue
+		}
+		seen[p] = struct{}{}
+		paths = append(paths, p)
+	}
+	if len(paths) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "未选择任何内容"})
+		return
+	}
+	if len(paths) > 500 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "一次最多删除 500 个路径"})
+		return
+	}
+	if !s.checkSharePaths(w, r, root, paths) {
+		return
+	}
+
+	lockKeys := make([]string, 0, len(paths))
+	for _, rel := range paths {
+		if full, ok := safeJoin(root, rel); ok {
+			lockKeys = append(lockKeys, relativeSharePath(root, full))
+		}
+	}
+	unlock, err := s.pathLocks.lock(r.Context(), lockKeys, true)
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	// The Recycle Bin is slow for huge folders and refuses what exceeds its
+	// size cap, so check the size before starting a doomed move.
+	trash := s.useTrash
+	if trash {
+		fullPaths := make([]string, 0, len(paths))
+		for _, rel := range paths {
+			if full, ok := safeJoin(root, rel); ok {
+				fullPaths = append(fullPaths, full)
+			}
+		}
+		limit := s.trashMaxBytes()
+		size, over, err := selectionSizeOver(r.Context(), fullPaths, limit)
+		if err != nil {
+			return
+		}
+		if over {
+			allowPermanent := s.trashTooLarge() == TrashTooLargeConfirm
+			if !allowPermanent || !req.Permanent {
+				writeJSON(w, http.StatusConflict, tooLargeForTrashError(size, limit, allowPermanent))
+				return
+			}
+			s.logf("delete too large for trash, removing permanently size>=%d paths=%d", size, len(paths))
+			trash = false
+		}
+	}
+
+	deleted := 0
+	errorsMap := map[string]string{}
+	for _, rel := range paths {
+		full, ok := safeJoin(root, rel)
+		if !ok {
+			errorsMap[rel] = "无权限"
+			continue
+		}
+		rootClean := filepath.Clean(root)
+		fullClean := filepath.Clean(full)
+		isRoot := fullClean == rootClean
+		if runtime.GOOS == "windows" {
+			isRoot = strings.EqualFold(fullClean, rootClean)
+		}
+		if isRoot {
+			errorsMap[rel] = "禁止删除根目录"
+			continue
+		}
+		st, err := os.Stat(full)
+		if err != nil {
+			errorsMap[rel] = "不存在"
+			continue
+		}
+		if trash {
+			if err := moveToTrash(full); err != nil {
+				errorsMap[rel] = "移入回收站失败"
+				continue
+			}
+			deleted++
+			continue
+		}
+		if st.IsDir() {
+			if err := os.RemoveAll(full); err != nil {
+				errorsMap[rel] = "删除失败"
+				continue
+			}
+			deleted++
+			continue
+		}
+		if err := os.Remove(full); err != nil {
+			errorsMap[rel] = "删除失败"
+			continue
+		}
+		deleted++
+	}
+
+	resp := map[string]any{
+		"success":   true,
+		"deleted":   deleted,
+		"requested": len(paths),
+	}
+	if len(errorsMap) > 0 {
+		resp["errors"] = errorsMap
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func safeJoin(sharedRoot string, subPath string) (string, bool) {
+	if runtime.GOOS != "windows" && strings.Contains(subPath, `\`) {
+		// Clients on Windows mean "\" as a separator: refuse what would escape
+		// the share there as well, so probes get the same answer on every host.
+		if _, ok := safeJoin(sharedRoot, strings.ReplaceAll(subPath, `\`, "/")); !ok {
+			return "", false
+		}
+	}
+	root := filepath.Clean(sharedRoot)
+	if runtime.GOOS == "windows" {
+		// Windows volume roots are special:
+		// - filepath.Clean("D:") keeps the trailing separator
+		// - filepath.Clean("D:") and building prefix as root+"\\" would create "D:\\\\" and break HasPrefix
+		// - filepath.Clean("D:") might also become "D:" in some paths; normalize to "D:\\".
+		vol := filepath.VolumeName(root)
+		if vol != "" {
+			// Depending on Go version, Clean("D:") can be "D:", "D:", or even "D:.".
+			if strings.EqualFold(root, vol) || strings.EqualFold(root, vol+".") || strings.EqualFold(root, vol+string(os.PathSeparator)+".") {
+				root = vol + string(os.PathSeparator)
+			}
+		}
+	}
+	sub := filepath.FromSlash(strings.TrimSpace(subPath))
+	full := filepath.Clean(filepath.Join(root, sub))
+
+	// Build prefix with exactly one path separator.
+	prefix := root
+	if !strings.HasSuffix(prefix, string(os.PathSeparator)) {
+		prefix = prefix + string(os.PathSeparator)
+	}
+
+	if runtime.GOOS == "windows" {
+		if strings.EqualFold(full, root) {
+			return full, true
+		}
+		if strings.HasPrefix(strings.ToLower(full), strings.ToLower(prefix)) {
+			return full, true
+		}
+		return "", false
+	}
+
+	if full == root {
+		return full, true
+	}
+	if strings.HasPrefix(full, prefix) {
+		return full, true
+	}
+	return "", false
+}
+
+func buildDirectoryItem(dirPath string, name string, info os.FileInfo, rules hiddenRules) DirectoryItem {
+	isDir := info.IsDir()
+	var ext *string
+	var preview *PreviewInfo
+	category := ""
+	if !isDir {
+		e := strings.ToLower(filepath.Ext(name))
+		ext = &e
+		preview = classifyPreview(name, info.Size())
+		category = fileCategory(name)
+	}
+
+	return DirectoryItem{
+		Name:      name,
+		Type:      map[bool]string{true: "directory", false: "file"}[isDir],
+		Hidden:    isHiddenPath(dirPath, name, rules),
+		Size:      map[bool]int64{true: 0, false: info.Size()}[isDir],
+		Modified:  info.ModTime().UTC().Format(time.RFC3339),
+		Created:   fileCreatedTime(info),
+		Extension: ext,
+		Preview:   preview,
+
+		Previewable: preview != nil && preview.Supported,
+		Category:    category,
+	}
+}
+
+func classifyPreview(name string, size int64) *PreviewInfo {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == ".pdf" {
+		if size > maxPDFPreviewBytes {
+			return &PreviewInfo{Supported: false, Kind: "unsupported", ContentType: documentContentTypes[ext], Reason: "file_too_large"}
+		}
+		return &PreviewInfo{Supported: true, Kind: "pdf", ContentType: documentContentTypes[ext]}
+	}
+	if size > maxPreviewBytes {
+		return &PreviewInfo{Supported: false, Kind: "unsupported", ContentType: contentTypeFor(name), Reason: "file_too_large"}
+	}
+
+	if contentType, ok := imagePreviewContentTypes[ext]; ok {
+		return &PreviewInfo{Supported: true, Kind: "image", ContentType: contentType}
+	}
+	if contentType, ok := textPreviewContentTypes[ext]; ok {
+		return &PreviewInfo{Supported: true, Kind: "text", ContentType: contentType}
+	}
+
+	return &PreviewInfo{Supported: false, Kind: "unsupported", ContentType: contentTypeFor(name), Reason: "extension_not_supported"}
+}
+
+// contentTypeFor is the type a file is served with: the preview maps first,
+// then the system's table, then application/octet-stream.
+func contentTypeFor(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, m := range []map[string]string{imagePreviewContentTypes, textPreviewContentTypes, documentContentTypes} {
+		if ct, ok := m[ext]; ok {
+			return ct
+		}
+	}
+	if ct := mime.TypeByExtension(ext); ct != "" {
+		return ct
+	}
+	return "application/octet-stream"
+}
+
+func sharedRootName(root string) string {
+	rootName := filepath.Base(root)
+	if rootName == "" {
+		return root
+	}
+	return rootName
+}
+
+func parentSharePath(currentPath string) *string {
+	if strings.TrimSpace(currentPath) == "" {
+		return nil
+	}
+	parent := filepath.ToSlash(filepath.Dir(filepath.FromSlash(currentPath)))
+	if parent == "." {
+		parent = ""
+	}
+	return &parent
+}
+
+func relativeSharePath(root string, fullPath string) string {
+	rel, err := filepath.Rel(root, fullPath)
+	if err != nil || rel == "." {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+// writeJSON encodes v before writing anything, so the response gets an exact
+// Content-Length (gzipJSON drops it when compressing) and a value that can't
+// be encoded becomes a logged 500 rather than a truncated body.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		if logf := responseLogf(w); logf != nil {
+			logf("encode %T response (status %d) failed: %v", v, status, err)
+		}
+		buf.Reset()
+		buf.WriteString(`{"code":"INTERNAL_ERROR","error":"服务器内部错误"}` + "\n")
+		status = http.StatusInternalServerError
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(status)
+	_, _ = w.Write(buf.Bytes())
+}
+
+func init() {
+	// Ensure common mime types for ServeFile
+	_ = mime.TypeByExtension(".md")
+}
@@ -0,0 +1,6891 @@
+package shareserver
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func newTestShareServerWithRoot(root string) *Server {
+	// No settings backend: tests must not read the user's real settings.json (which may enable access pass).
+	return New(Options{Root: root})
+}
+
+// newTestShareServerWithSettings backs the server with an in-memory settings store.
+func newTestShareServerWithSettings(root string) *Server {
+	return New(Options{Root: root, Settings: NewMemorySettings()})
+}
+
+func allowDeleteForTest(t *testing.T, s *Server) {
+	t.Helper()
+	if err := s.settings.Set(SettingKeyPermissions, json.RawMessage(`{"delete":true}`)); err != nil {
+		t.Fatalf("set permissions failed: %v", err)
+	}
+}
+
+func postUploadForTest(t *testing.T, ts *httptest.Server, name string, content []byte) *http.Response {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fw, err := mw.CreateFormFile("files", name)
+	if err != nil {
+		t.Fatalf("create form file failed: %v", err)
+	}
+	_, _ = fw.Write(content)
+	_ = mw.Close()
+	resp, err := ts.Client().Post(ts.URL+"/api/upload", mw.FormDataContentType(), &buf)
+	if err != nil {
+		t.Fatalf("POST /api/upload failed: %v", err)
+	}
+	return resp
+}
+
+func TestAccessPassChangeInvalidatesExistingToken(t *testing.T) {
+	tmp := t.TempDir()
+	_ = os.WriteFile(filepath.Join(tmp, "hello.txt"), []byte("hi"), 0o644)
+
+	s := newTestShareServerWithSettings(tmp)
+	pass1, _ := json.Marshal("a1")
+	if err := s.settings.Set(SettingKeyAccessPass, pass1); err != nil {
+		t.Fatalf("set access pass failed: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	// Exchange pass for token.
+	authBody, _ := json.Marshal(map[string]any{"pass": "a1"})
+	resp, err := ts.Client().Post(ts.URL+"/api/auth", "application/json", bytes.NewReader(authBody))
+	if err != nil {
+		t.Fatalf("POST /api/auth failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		t.Fatalf("expected 200 from /api/auth, got %d body=%s", resp.StatusCode, string(b))
+	}
+	var authResp struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&authResp); err != nil {
+		t.Fatalf("decode /api/auth response failed: %v", err)
+	}
+	if strings.TrimSpace(authResp.Token) == "" {
+		t.Fatalf("expected non-empty token")
+	}
+
+	// Token works before pass change.
+	req1, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/files", nil)
+	req1.Header.Set(headerShareToken, authResp.Token)
+	resp1, err := ts.Client().Do(req1)
+	if err != nil {
+		t.Fatalf("GET /api/files failed: %v", err)
+	}
+	_ = resp1.Body.Close()
+	if resp1.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 from /api/files before pass change, got %d", resp1.StatusCode)
+	}
+
+	// Change access pass.
+	pass2, _ := json.Marshal("b2")
+	if err := s.settings.Set(SettingKeyAccessPass, pass2); err != nil {
+		t.Fatalf("update access pass failed: %v", err)
+	}
+
+	// Old token should now be rejected.
+	req2, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/files", nil)
+	req2.Header.Set(headerShareToken, authResp.Token)
+	resp2, err := ts.Client().Do(req2)
+	if err != nil {
+		t.Fatalf("GET /api/files after pass change failed: %v", err)
+	}
+	defer resp2.Body.Close()
+	if resp2.StatusCode != http.StatusUnauthorized {
+		b, _ := io.ReadAll(resp2.Body)
+		t.Fatalf("expected 401 after pass change, got %d body=%s", resp2.StatusCode, string(b))
+	}
+}
+
+// fakeClock is a manually advanced time source for authManager.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func TestAuthManagerTokenLifetime(t *testing.T) {
+	hash := accessPassHash("a1")
+	cases := []struct {
+		name  string
+		steps []time.Duration // clock advance before each validate
+		want  []authResult
+	}{
+		{"valid right away", []time.Duration{0}, []authResult{authOK}},
+		{"valid until ttl", []time.Duration{10 * time.Minute}, []authResult{authOK}},
+		{"expires after ttl", []time.Duration{10*time.Minute + time.Second}, []authResult{authExpired}},
+		{"outside the renew window nothing is extended", []time.Duration{7 * time.Minute, 4 * time.Minute}, []authResult{authOK, authExpired}},
+		{"use near expiry renews", []time.Duration{9 * time.Minute, 9 * time.Minute}, []authResult{authOK, authOK}},
+		{"renewed token still expires", []time.Duration{9 * time.Minute, 10*time.Minute + time.Second}, []authResult{authOK, authExpired}},
+		{"expired token stays gone", []time.Duration{11 * time.Minute, -2 * time.Minute}, []authResult{authExpired, authExpired}},
+	}
+	for _, tc := range cases {
+		clock := &fakeClock{t: time.Unix(1_700_000_000, 0)}
+		m := newAuthManager(clock.now)
+		token, ttl, err := m.issue("10.0.0.2", hash)
+		if err != nil {
+			t.Fatalf("%s: issue: %v", tc.name, err)
+		}
+		if ttl != 10*time.Minute {
+			t.Fatalf("%s: expected default ttl, got %v", tc.name, ttl)
+		}
+		for i, d := range tc.steps {
+			clock.advance(d)
+			if got := m.validate(token, "10.0.0.2", hash); got != tc.want[i] {
+				t.Fatalf("%s: step %d: expected %v, got %v", tc.name, i, tc.want[i], got)
+			}
+		}
+	}
+}
+
+func TestAuthManagerRateWindow(t *testing.T) {
+	cases := []struct {
+		name    string
+		advance []time.Duration // clock advance before each guess
+		want    []bool
+	}{
+		{"limit within a window", []time.Duration{0, 0, 0, 0, 0, 0}, []bool{true, true, true, true, true, false}},
+		{"rollover resets the count", []time.Duration{0, 0, 0, 0, 0, 0, 10 * time.Second}, []bool{true, true, true, true, true, false, true}},
+		{"window starts at the first guess", []time.Duration{0, 9 * time.Second, 0, 0, 0, 0, time.Second}, []bool{true, true, true, true, true, false, true}},
+	}
+	for _, tc := range cases {
+		clock := &fakeClock{t: time.Unix(1_700_000_000, 0)}
+		m := newAuthManager(clock.now)
+		for i, d := range tc.advance {
+			clock.advance(d)
+			if got := m.allow("10.0.0.2"); got != tc.want[i] {
+				t.Fatalf("%s: guess %d: expected %v, got %v", tc.name, i, tc.want[i], got)
+			}
+		}
+		if !m.allow("10.0.0.9") {
+			t.Fatalf("%s: expected other IPs to have their own window", tc.name)
+		}
+	}
+}
+
+func TestAuthManagerFollowsSettings(t *testing.T) {
+	s := newTestShareServerWithSettings("")
+	clock := &fakeClock{t: time.Unix(1_700_000_000, 0)}
+	s.auth.now = clock.now
+
+	for key, v := range map[string]string{
+		SettingKeyTokenTTLMinutes:       "1",
+		SettingKeyAuthRateWindowSeconds: "60",
+		SettingKeyAuthRateMaxRequests:   "2",
+	} {
+		if err := s.SetSetting(key, json.RawMessage(v)); err != nil {
+			t.Fatalf("set %s: %v", key, err)
+		}
+	}
+	if got := s.auth.retryAfter(); got != 60 {
+		t.Fatalf("expected retryAfter 60, got %d", got)
+	}
+
+	token, ttl, _ := s.auth.issue("10.0.0.2", accessPassHash("a1"))
+	if ttl != time.Minute {
+		t.Fatalf("expected 1m ttl, got %v", ttl)
+	}
+	clock.advance(time.Minute + time.Second)
+	if s.auth.validate(token, "10.0.0.2", accessPassHash("a1")) != authExpired {
+		t.Fatalf("expected token to expire after the configured ttl")
+	}
+
+	if !s.auth.allow("10.0.0.2") || !s.auth.allow("10.0.0.2") || s.auth.allow("10.0.0.2") {
+		t.Fatalf("expected the third guess to be limited")
+	}
+	clock.advance(59 * time.Second)
+	if s.auth.allow("10.0.0.2") {
+		t.Fatalf("expected the configured window to still apply")
+	}
+}
+
+func TestShareServerAuthFailureCodes(t *testing.T) {
+	s := newTestShareServerWithSettings(t.TempDir())
+	_ = s.settings.Set(SettingKeyAccessPass, json.RawMessage(`"a1"`))
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+
+	hash := accessPassHash("a1")
+	cases := []struct {
+		name   string
+		token  func() string
+		ip     string
+		status int
+		code   string
+	}{
+		{"no token", func() string { return "" }, "10.0.0.2", http.StatusUnauthorized, "AUTH_REQUIRED"},
+		{"unknown token", func() string { return "bogus" }, "10.0.0.2", http.StatusUnauthorized, "AUTH_REQUIRED"},
+		{"valid token", func() string {
+			token, _, _ := s.auth.issue("10.0.0.2", hash)
+			return token
+		}, "10.0.0.2", http.StatusOK, ""},
+		{"expired", func() string {
+			token, _, _ := s.auth.issue("10.0.0.2", hash)
+			e := s.auth.tokens[token]
+			e.ExpiresAt = time.Now().Add(-time.Second)
+			s.auth.tokens[token] = e
+			return token
+		}, "10.0.0.2", http.StatusUnauthorized, "AUTH_EXPIRED"},
+		{"expired and swept", func() string {
+			token, _, _ := s.auth.issue("10.0.0.2", hash)
+			e := s.auth.tokens[token]
+			e.ExpiresAt = time.Now().Add(-time.Second)
+			s.auth.tokens[token] = e
+			s.auth.lastSweep = time.Time{}
+			s.auth.sweepLocked(time.Now())
+			return token
+		}, "10.0.0.2", http.StatusUnauthorized, "AUTH_EXPIRED"},
+		{"pass changed", func() string {
+			token, _, _ := s.auth.issue("10.0.0.2", accessPassHash("old"))
+			return token
+		}, "10.0.0.2", http.StatusUnauthorized, "AUTH_PASS_CHANGED"},
+		{"ip mismatch", func() string {
+			token, _, _ := s.auth.issue("10.0.0.3", hash)
+			return token
+		}, "10.0.0.2", http.StatusUnauthorized, "AUTH_IP_MISMATCH"},
+	}
+	for _, tc := range cases {
+		// Twice: the second answer comes from the revoked-token memory.
+		token := tc.token()
+		for i := 0; i < 2; i++ {
+			req := httptest.NewRequest(http.MethodGet, "/api/files", nil)
+			req.RemoteAddr = tc.ip + ":5000"
+			if token != "" {
+				req.Header.Set(headerShareToken, token)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			if rec.Code != tc.status {
+				t.Fatalf("%s: expected %d, got %d body=%s", tc.name, tc.status, rec.Code, rec.Body.String())
+			}
+			var body struct {
+				Code string `json:"code"`
+			}
+			_ = json.Unmarshal(rec.Body.Bytes(), &body)
+			if body.Code != tc.code {
+				t.Fatalf("%s: expected code %q, got %q", tc.name, tc.code, body.Code)
+			}
+		}
+	}
+}
+
+// recordingLogger keeps every log line for assertions.
+type recordingLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *recordingLogger) Printf(format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+
+func TestTokenIPBindingModes(t *testing.T) {
+	cases := []struct {
+		mode     string
+		issuedTo string
+		usedFrom string
+		want     authResult
+	}{
+		{TokenIPBindingStrict, "192.168.1.20", "192.168.1.20", authOK},
+		{TokenIPBindingStrict, "192.168.1.20", "192.168.1.21", authIPMismatch},
+		{TokenIPBindingSubnet, "192.168.1.20", "192.168.1.250", authOK},
+		{TokenIPBindingSubnet, "192.168.1.20", "192.168.2.20", authIPMismatch},
+		{TokenIPBindingSubnet, "192.168.1.20", "::ffff:192.168.1.99", authOK},
+		{TokenIPBindingSubnet, "2001:db8:1:2::10", "2001:db8:1:2:abcd::1", authOK},
+		{TokenIPBindingSubnet, "2001:db8:1:2::10", "2001:db8:1:3::10", authIPMismatch},
+		{TokenIPBindingSubnet, "fe80::1%eth0", "fe80::2%wlan0", authOK},
+		{TokenIPBindingSubnet, "192.168.1.20", "2001:db8::1", authIPMismatch},
+		{TokenIPBindingSubnet, "192.168.1.20", "not-an-ip", authIPMismatch},
+		{TokenIPBindingOff, "192.168.1.20", "10.9.8.7", authOK},
+		{"bogus", "192.168.1.20", "192.168.1.21", authIPMismatch},
+	}
+	for _, tc := range cases {
+		log := &recordingLogger{}
+		s := New(Options{Settings: NewMemorySettings(), Logger: log})
+		b, _ := json.Marshal(tc.mode)
+		if err := s.SetSetting(SettingKeyTokenIPBinding, b); err != nil {
+			t.Fatalf("set binding: %v", err)
+		}
+		hash := accessPassHash("a1")
+		token, _, _ := s.auth.issue(tc.issuedTo, hash)
+		if got := s.auth.validate(token, tc.usedFrom, hash); got != tc.want {
+			t.Fatalf("%s %s -> %s: expected %v, got %v", tc.mode, tc.issuedTo, tc.usedFrom, tc.want, got)
+		}
+		// Roaming within what the mode allows is logged; exact matches aren't.
+		wantLog := tc.want == authOK && tc.issuedTo != tc.usedFrom
+		if logged := len(log.lines) > 0; logged != wantLog {
+			t.Fatalf("%s %s -> %s: expected logged=%v, got %v", tc.mode, tc.issuedTo, tc.usedFrom, wantLog, log.lines)
+		}
+		// Only the first use from each address is logged.
+		n := len(log.lines)
+		s.auth.validate(token, tc.usedFrom, hash)
+		if len(log.lines) != n {
+			t.Fatalf("%s %s -> %s: logged again: %v", tc.mode, tc.issuedTo, tc.usedFrom, log.lines)
+		}
+		// The issuing address always keeps working.
+		if got := s.auth.validate(token, tc.issuedTo, hash); got != authOK {
+			t.Fatalf("%s: expected token to stay valid for %s, got %v", tc.mode, tc.issuedTo, got)
+		}
+	}
+}
+
+func TestShareServerRootDoesNotRedirectLoop(t *testing.T) {
+	tmp := t.TempDir()
+	_ = os.WriteFile(filepath.Join(tmp, "hello.txt"), []byte("hi"), 0o644)
+
+	s := newTestShareServerWithRoot(tmp)
+	// The real web UI is embedded by package main; any index.html will do here.
+	s.assets = fstest.MapFS{"index.html": {Data: []byte("<!doctype html>")}}
+
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	client := ts.Client()
+	resp, err := client.Get(ts.URL + "/")
+	if err != nil {
+		t.Fatalf("GET / failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		t.Fatalf("expected 2xx, got %d", resp.StatusCode)
+	}
+}
+
+func TestShareServerStartReportsBusyCustomPort(t *testing.T) {
+	if _, err := getLocalIPv4(); err != nil {
+		t.Skipf("no local IPv4: %v", err)
+	}
+	busy, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer busy.Close()
+	busyPort := busy.Addr().(*net.TCPAddr).Port
+
+	s := newTestShareServerWithSettings("")
+	b, _ := json.Marshal(strconv.Itoa(busyPort))
+	if err := s.settings.Set(SettingKeyCustomPort, b); err != nil {
+		t.Fatalf("set custom port failed: %v", err)
+	}
+
+	res, err := s.Start(context.Background(), t.TempDir())
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer func() { _ = s.Stop(context.Background()) }()
+
+	if res.Info == nil || res.Info.Port == busyPort {
+		t.Fatalf("expected a fallback port, got %+v", res.Info)
+	}
+	if len(res.Warnings) != 1 || res.Warnings[0] != WarningCustomPortUnavailable {
+		t.Fatalf("expected %q warning, got %v", WarningCustomPortUnavailable, res.Warnings)
+	}
+}
+
+func TestShareServerCustomPortProbe(t *testing.T) {
+	if _, err := getLocalIPv4(); err != nil {
+		t.Skipf("no local IPv4: %v", err)
+	}
+	type result struct {
+		port     int
+		switched bool
+	}
+	run := func(auto bool) (*Server, int, result) {
+		t.Helper()
+		busy, err := net.Listen("tcp", ":0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		busyPort := busy.Addr().(*net.TCPAddr).Port
+
+		s := newTestShareServerWithSettings("")
+		s.portProbeInterval = 20 * time.Millisecond
+		got := make(chan result, 2)
+		s.onCustomPortAvailable = func(port int, switched bool) { got <- result{port, switched} }
+		b, _ := json.Marshal(strconv.Itoa(busyPort))
+		_ = s.settings.Set(SettingKeyCustomPort, b)
+		if auto {
+			_ = s.settings.Set(SettingKeyAutoReclaimPort, json.RawMessage("true"))
+		}
+		if _, err := s.Start(context.Background(), t.TempDir()); err != nil {
+			t.Fatalf("Start failed: %v", err)
+		}
+		t.Cleanup(func() { _ = s.Stop(context.Background()) })
+
+		// Nothing is reported while the port stays taken.
+		select {
+		case r := <-got:
+			t.Fatalf("reported %+v while the port was busy", r)
+		case <-time.After(100 * time.Millisecond):
+		}
+		_ = busy.Close()
+		select {
+		case r := <-got:
+			return s, busyPort, r
+		case <-time.After(5 * time.Second):
+			t.Fatalf("custom port never reported available")
+		}
+		return nil, 0, result{}
+	}
+
+	s, port, r := run(false)
+	if r.port != port || r.switched {
+		t.Fatalf("unexpected report %+v", r)
+	}
+	if info, _ := s.GetServerInfo(); info == nil || info.Port == port {
+		t.Fatalf("expected to stay on the fallback port, got %+v", info)
+	}
+
+	s, port, r = run(true)
+	if r.port != port || !r.switched {
+		t.Fatalf("unexpected report %+v", r)
+	}
+	if info, _ := s.GetServerInfo(); info == nil || info.Port != port {
+		t.Fatalf("expected to move to port %d, got %+v", port, info)
+	}
+
+	// Stopping the share ends the probe.
+	s2 := newTestShareServerWithSettings("")
+	s2.portProbeInterval = time.Hour
+	busy, _ := net.Listen("tcp", ":0")
+	defer busy.Close()
+	b, _ := json.Marshal(strconv.Itoa(busy.Addr().(*net.TCPAddr).Port))
+	_ = s2.settings.Set(SettingKeyCustomPort, b)
+	if _, err := s2.Start(context.Background(), t.TempDir()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	s2.mu.RLock()
+	probing := s2.portProbeStop != nil
+	s2.mu.RUnlock()
+	_ = s2.Stop(context.Background())
+	if !probing || s2.portProbeStop != nil {
+		t.Fatalf("expected the probe to run while on a fallback port and stop with the share")
+	}
+}
+
+func TestShareServerStartHonoursCanceledContext(t *testing.T) {
+	s := newTestShareServerWithSettings("")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := s.Start(ctx, t.TempDir()); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if info, _ := s.GetServerInfo(); info != nil {
+		t.Fatalf("expected server not to be running, got %+v", info)
+	}
+
+	dw, err := newDirectoryWatcher(t.TempDir(), nil, defaultWatchCoalesceConfig, nil, nil)
+	if err != nil {
+		t.Fatalf("newDirectoryWatcher: %v", err)
+	}
+	if err := dw.Start(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected watcher Start to give up, got %v", err)
+	}
+	dw.Stop()
+}
+
+func TestShareServerRemembersLastShare(t *testing.T) {
+	if _, err := getLocalIPv4(); err != nil {
+		t.Skipf("no local IPv4: %v", err)
+	}
+	root := t.TempDir()
+	s := New(Options{Settings: NewMemorySettings(), RememberLastShare: true})
+	if _, ok := s.LastShare(); ok {
+		t.Fatalf("expected no last share initially")
+	}
+
+	if _, err := s.Start(context.Background(), root); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if last, ok := s.LastShare(); !ok || last.Root != root || !last.Active {
+		t.Fatalf("expected active last share %q, got %+v ok=%v", root, last, ok)
+	}
+
+	// Quitting the app keeps the share resumable.
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if last, _ := s.LastShare(); !last.Active {
+		t.Fatalf("expected Shutdown to keep the share active, got %+v", last)
+	}
+
+	// Stopping on purpose does not.
+	if _, err := s.Start(context.Background(), root); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	if last, _ := s.LastShare(); last.Root != root || last.Active {
+		t.Fatalf("expected inactive last share %q, got %+v", root, last)
+	}
+
+	// The absolute path is not for web clients.
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/settings/"+SettingKeyLastShare, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected last share hidden over HTTP, got %d", rec.Code)
+	}
+
+	// Without RememberLastShare (e.g. headless) nothing is recorded.
+	other := newTestShareServerWithSettings("")
+	if _, err := other.Start(context.Background(), root); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer func() { _ = other.Stop(context.Background()) }()
+	if _, ok := other.LastShare(); ok {
+		t.Fatalf("expected nothing recorded without RememberLastShare")
+	}
+}
+
+func TestShareServerFolderURL(t *testing.T) {
+	if _, err := getLocalIPv4(); err != nil {
+		t.Skipf("no local IPv4: %v", err)
+	}
+	root := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(root, "照片", "2024"), 0o755)
+	_ = os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0o644)
+
+	s := newTestShareServerWithSettings(root)
+	if _, err := s.FolderURL("照片"); err == nil {
+		t.Fatalf("expected an error while the server is stopped")
+	}
+
+	res, err := s.Start(context.Background(), root)
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer func() { _ = s.Stop(context.Background()) }()
+
+	u, err := s.FolderURL("照片/2024")
+	if err != nil {
+		t.Fatalf("FolderURL failed: %v", err)
+	}
+	enc := base64.RawURLEncoding.EncodeToString
+	want := res.Info.URL + "/?path=" + url.QueryEscape(enc([]byte("照片"))+"/"+enc([]byte("2024")))
+	if u != want {
+		t.Fatalf("expected %q, got %q", want, u)
+	}
+	if u, err := s.FolderURL(""); err != nil || u != res.Info.URL+"/" {
+		t.Fatalf("expected root URL, got %q err=%v", u, err)
+	}
+
+	for _, bad := range []string{"../outside", "a.txt", "missing"} {
+		if _, err := s.FolderURL(bad); err == nil {
+			t.Fatalf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestShareServerFolderURLEntryToken(t *testing.T) {
+	if _, err := getLocalIPv4(); err != nil {
+		t.Skipf("no local IPv4: %v", err)
+	}
+	root := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(root, "docs"), 0o755)
+
+	s := newTestShareServerWithSettings(root)
+	s.assets = fstest.MapFS{"index.html": {Data: []byte("<!doctype html><title>spa</title>")}}
+	_ = s.settings.Set(SettingKeyAccessPass, json.RawMessage(`"a1"`))
+	_ = s.settings.Set(SettingKeyProtectWebUI, json.RawMessage("true"))
+	if _, err := s.Start(context.Background(), root); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer func() { _ = s.Stop(context.Background()) }()
+
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	link, err := s.FolderURL("docs")
+	if err != nil {
+		t.Fatalf("FolderURL failed: %v", err)
+	}
+	u, _ := url.Parse(link)
+	ott := u.Query().Get(queryEntryToken)
+	if ott == "" || u.Query().Get("path") != base64.RawURLEncoding.EncodeToString([]byte("docs")) {
+		t.Fatalf("expected path and one-time token in %q", link)
+	}
+
+	// The protected page answers with the login page, which redeems ?ott=.
+	resp, err := ts.Client().Get(ts.URL + "/?" + u.RawQuery)
+	if err != nil {
+		t.Fatalf("GET / failed: %v", err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized || !strings.Contains(string(b), `searchParams.get("ott")`) {
+		t.Fatalf("expected the login page to redeem the entry token, got %d", resp.StatusCode)
+	}
+	redeem := func() (int, string, string) {
+		t.Helper()
+		resp, err := ts.Client().Post(ts.URL+"/api/auth", "application/json", strings.NewReader(`{"ott":"`+ott+`"}`))
+		if err != nil {
+			t.Fatalf("POST /api/auth failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var body struct {
+			Token string `json:"token"`
+			Code  string `json:"code"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body.Token, body.Code
+	}
+	code, token, _ := redeem()
+	if code != http.StatusOK || token == "" {
+		t.Fatalf("expected a token for the entry token, got %d", code)
+	}
+	if got := s.auth.validate(token, "127.0.0.1", accessPassHash("a1")); got != authOK {
+		t.Fatalf("expected the issued token to work, got %v", got)
+	}
+	if code, _, errCode := redeem(); code != http.StatusUnauthorized || errCode != "AUTH_OTT_INVALID" {
+		t.Fatalf("expected 401 AUTH_OTT_INVALID on reuse, got %d %q", code, errCode)
+	}
+
+	// Changing the pass voids unredeemed links.
+	link, _ = s.FolderURL("")
+	u, _ = url.Parse(link)
+	ott = u.Query().Get(queryEntryToken)
+	_ = s.settings.Set(SettingKeyAccessPass, json.RawMessage(`"b2"`))
+	if code, _, _ := redeem(); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 after the pass changed, got %d", code)
+	}
+}
+
+func TestShareServerMissingWebAssetsDiagnostic(t *testing.T) {
+	tmp := t.TempDir()
+	_ = os.WriteFile(filepath.Join(tmp, "hello.txt"), []byte("hi"), 0o644)
+
+	s := newTestShareServerWithRoot(tmp)
+	s.assets = fstest.MapFS{}
+	s.version = "v9.9.9"
+
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	resp, err := ts.Client().Get(ts.URL + "/")
+	if err != nil {
+		t.Fatalf("GET / failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", resp.StatusCode)
+	}
+	page := string(body)
+	for _, want := range []string{"网页资源缺失", filepath.Join("web/dist", "index.html"), "v9.9.9"} {
+		if !strings.Contains(page, want) {
+			t.Fatalf("diagnostic page missing %q: %s", want, page)
+		}
+	}
+
+	// The API keeps working.
+	resp, err = ts.Client().Get(ts.URL + "/api/files")
+	if err != nil {
+		t.Fatalf("GET /api/files failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected /api/files 200, got %d", resp.StatusCode)
+	}
+}
+
+func TestShareServerWebDistDirOverride(t *testing.T) {
+	tmp := t.TempDir()
+	distDir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(distDir, "index.html"), []byte("custom build"), 0o644)
+
+	s := newTestShareServerWithSettings(tmp)
+	s.assets = fstest.MapFS{"index.html": {Data: []byte("embedded build")}}
+
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	getRoot := func() (int, string, string) {
+		t.Helper()
+		resp, err := ts.Client().Get(ts.URL + "/")
+		if err != nil {
+			t.Fatalf("GET / failed: %v", err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b), resp.Header.Get("Cache-Control")
+	}
+
+	if _, body, _ := getRoot(); body != "embedded build" || s.WebServeMode() != WebServeEmbedded {
+		t.Fatalf("expected embedded build, got %q (mode %s)", body, s.WebServeMode())
+	}
+
+	raw, _ := json.Marshal(distDir)
+	if err := s.SetSetting(SettingKeyWebDistDir, raw); err != nil {
+		t.Fatalf("set web dist dir: %v", err)
+	}
+	status, body, cacheControl := getRoot()
+	if status != http.StatusOK || body != "custom build" || !strings.Contains(cacheControl, "no-store") {
+		t.Fatalf("expected uncached custom build, got %d %q cache=%q", status, body, cacheControl)
+	}
+	if got := s.Meta().WebServeMode; got != WebServeCustom {
+		t.Fatalf("expected meta mode %q, got %q", WebServeCustom, got)
+	}
+
+	// A directory without index.html falls back to the embedded UI.
+	_ = os.Remove(filepath.Join(distDir, "index.html"))
+	if _, body, _ := getRoot(); body != "embedded build" {
+		t.Fatalf("expected fallback to embedded build, got %q", body)
+	}
+
+	// The directory must not be settable by web clients.
+	req, _ := http.NewRequest(http.MethodPut, ts.URL+"/api/settings/"+SettingKeyWebDistDir, strings.NewReader(`{"value":"/"}`))
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("PUT setting failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for web dist dir over HTTP, got %d", resp.StatusCode)
+	}
+}
+
+func TestShareServerRecoversHandlerPanic(t *testing.T) {
+	s := newTestShareServerWithRoot(t.TempDir())
+	var gotID string
+	s.onPanic = func(id string, msg string) { gotID = id }
+
+	ts := httptest.NewServer(s.recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})))
+	defer ts.Close()
+
+	resp, err := ts.Client().Get(ts.URL + "/api/files")
+	if err != nil {
+		t.Fatalf("expected a response, got %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", resp.StatusCode)
+	}
+	var body map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("expected JSON body: %v", err)
+	}
+	if body["code"] != "INTERNAL_ERROR" || body["id"] == "" {
+		t.Fatalf("unexpected body: %v", body)
+	}
+	if gotID != body["id"] {
+		t.Fatalf("OnPanic id %q does not match response id %q", gotID, body["id"])
+	}
+}
+
+func TestShareServerSSEPerIPLimit(t *testing.T) {
+	s := newTestShareServerWithSettings(t.TempDir())
+	if err := s.SetSetting(SettingKeySSEMaxClientsPerIP, json.RawMessage("1")); err != nil {
+		t.Fatalf("set limit: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	openStream := func() *http.Response {
+		t.Helper()
+		resp, err := ts.Client().Get(ts.URL + "/api/events")
+		if err != nil {
+			t.Fatalf("GET /api/events failed: %v", err)
+		}
+		return resp
+	}
+	waitForClients := func(n int) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for s.Stats().SSEClients != n {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %d SSE clients, got %d", n, s.Stats().SSEClients)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	first := openStream()
+	if first.StatusCode != http.StatusOK {
+		t.Fatalf("expected first stream 200, got %d", first.StatusCode)
+	}
+	waitForClients(1)
+
+	second := openStream()
+	second.Body.Close()
+	if second.StatusCode != http.StatusServiceUnavailable || second.Header.Get("Retry-After") == "" {
+		t.Fatalf("expected 503 with Retry-After, got %d %q", second.StatusCode, second.Header.Get("Retry-After"))
+	}
+
+	// Disconnecting frees the slot.
+	first.Body.Close()
+	waitForClients(0)
+	third := openStream()
+	defer third.Body.Close()
+	if third.StatusCode != http.StatusOK {
+		t.Fatalf("expected stream 200 after disconnect, got %d", third.StatusCode)
+	}
+	waitForClients(1)
+}
+
+func TestShareServerGzipJSON(t *testing.T) {
+	tmp := t.TempDir()
+	for i := 0; i < 100; i++ {
+		_ = os.WriteFile(filepath.Join(tmp, fmt.Sprintf("file-with-a-long-name-%03d.txt", i)), []byte("x"), 0o644)
+	}
+	s := newTestShareServerWithSettings(tmp)
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+
+	get := func(target, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Compressed: big listing, client accepts gzip.
+	rec := get("/api/files", "br, gzip")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected gzip 200, got %d %q", rec.Code, rec.Header().Get("Content-Encoding"))
+	}
+	if rec.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("expected Vary: Accept-Encoding, got %q", rec.Header().Get("Vary"))
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("gzip reader: %v", err)
+	}
+	var listing struct {
+		Items []DirectoryItem `json:"items"`
+	}
+	if err := json.NewDecoder(zr).Decode(&listing); err != nil {
+		t.Fatalf("decode gzipped listing: %v", err)
+	}
+	if len(listing.Items) != 100 {
+		t.Fatalf("expected 100 items, got %d", len(listing.Items))
+	}
+
+	// Passthrough: no gzip accepted, refused with q=0, or too small to bother.
+	for _, tc := range []struct{ target, accept string }{
+		{"/api/files", ""},
+		{"/api/files", "gzip;q=0"},
+		{"/api/meta", "gzip"},
+	} {
+		rec := get(tc.target, tc.accept)
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Encoding") != "" {
+			t.Fatalf("%s (%q): expected plain 200, got %d %q", tc.target, tc.accept, rec.Code, rec.Header().Get("Content-Encoding"))
+		}
+		if !json.Valid(rec.Body.Bytes()) {
+			t.Fatalf("%s (%q): expected plain JSON body", tc.target, tc.accept)
+		}
+	}
+
+	// SSE must stream untouched.
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/events", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("GET /api/events failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Encoding") != "" {
+		t.Fatalf("expected SSE not to be compressed, got %q", resp.Header.Get("Content-Encoding"))
+	}
+	line, _ := bufio.NewReader(resp.Body).ReadString('\n')
+	if line != ": connected\n" {
+		t.Fatalf("expected plain SSE preamble, got %q", line)
+	}
+}
+
+func TestShareServerLargeDirectoryListing(t *testing.T) {
+	tmp := t.TempDir()
+	const total = 700 // more than one listBatchSize
+	for i := 0; i < total; i++ {
+		_ = os.WriteFile(filepath.Join(tmp, fmt.Sprintf("f%04d.txt", i)), nil, 0o644)
+	}
+	_ = os.Mkdir(filepath.Join(tmp, "sub"), 0o755)
+	s := newTestShareServerWithSettings(tmp)
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+
+	get := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+	type listing struct {
+		Items     []DirectoryItem `json:"items"`
+		Truncated bool            `json:"truncated"`
+	}
+	decode := func(rec *httptest.ResponseRecorder) listing {
+		t.Helper()
+		var body io.Reader = rec.Body
+		if rec.Header().Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(rec.Body)
+			if err != nil {
+				t.Fatalf("gzip reader: %v", err)
+			}
+			body = zr
+		}
+		var l listing
+		if err := json.NewDecoder(body).Decode(&l); err != nil {
+			t.Fatalf("decode listing: %v", err)
+		}
+		return l
+	}
+
+	// Under the default cap: everything, sorted, not truncated.
+	l := decode(get("/api/files"))
+	if len(l.Items) != total+1 || l.Truncated {
+		t.Fatalf("expected %d items untruncated, got %d truncated=%v", total+1, len(l.Items), l.Truncated)
+	}
+	if l.Items[0].Name != "sub" || l.Items[1].Name != "f0000.txt" {
+		t.Fatalf("expected directories first then by name, got %q, %q", l.Items[0].Name, l.Items[1].Name)
+	}
+
+	// Over the cap: cut off and flagged, for both listing endpoints.
+	if err := s.settings.Set(SettingKeyListMaxItems, json.RawMessage(`100`)); err != nil {
+		t.Fatalf("set list cap: %v", err)
+	}
+	for _, target := range []string{"/api/files", "/api/path-info"} {
+		l := decode(get(target))
+		if len(l.Items) != 100 || !l.Truncated {
+			t.Fatalf("%s: expected 100 items truncated, got %d truncated=%v", target, len(l.Items), l.Truncated)
+		}
+	}
+
+	// Streaming: uncapped NDJSON, one item per line, never gzipped.
+	rec := get("/api/files?stream=1")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("expected plain 200 stream, got %d %q", rec.Code, rec.Header().Get("Content-Encoding"))
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/x-ndjson") {
+		t.Fatalf("expected NDJSON content type, got %q", ct)
+	}
+	if !rec.Flushed {
+		t.Fatalf("expected the stream to be flushed")
+	}
+	seen := map[string]bool{}
+	sc := bufio.NewScanner(rec.Body)
+	for sc.Scan() {
+		var item DirectoryItem
+		if err := json.Unmarshal(sc.Bytes(), &item); err != nil {
+			t.Fatalf("decode line %q: %v", sc.Text(), err)
+		}
+		seen[item.Name] = true
+	}
+	if len(seen) != total+1 || !seen["sub"] {
+		t.Fatalf("expected %d streamed items, got %d", total+1, len(seen))
+	}
+
+	// Errors before the first line are still plain JSON.
+	rec = get("/api/files?stream=1&path=missing")
+	if rec.Code != http.StatusNotFound || !json.Valid(rec.Body.Bytes()) {
+		t.Fatalf("expected JSON 404 for a missing folder, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestDirectoryItemOmitsUnknownCreated(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows records creation times")
+	}
+	tmp := t.TempDir()
+	_ = os.WriteFile(filepath.Join(tmp, "a.txt"), []byte("a"), 0o644)
+	s := newTestShareServerWithSettings(tmp)
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/files?details=1", nil))
+	var resp struct {
+		Items []map[string]any `json:"items"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || len(resp.Items) != 1 {
+		t.Fatalf("decode listing: %v (%d items)", err, len(resp.Items))
+	}
+	for _, key := range []string{"created", "owner"} {
+		if v, ok := resp.Items[0][key]; ok {
+			t.Fatalf("expected %q to be omitted, got %v", key, v)
+		}
+	}
+}
+
+func TestShareServerDownloadEstimate(t *testing.T) {
+	tmp := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(tmp, "dir", "node_modules"), 0o755)
+	_ = os.WriteFile(filepath.Join(tmp, "dir", "a.txt"), []byte("aaa"), 0o644)
+	_ = os.WriteFile(filepath.Join(tmp, "dir", "b.txt"), []byte("bbbbb"), 0o644)
+	_ = os.WriteFile(filepath.Join(tmp, "dir", "node_modules", "x.js"), bytes.Repeat([]byte("x"), 100), 0o644)
+	_ = os.WriteFile(filepath.Join(tmp, "c.txt"), bytes.Repeat([]byte("c"), 10), 0o644)
+	_ = os.MkdirAll(filepath.Join(tmp, "many"), 0o755)
+	for i := 0; i <= maxFilesInZip; i++ {
+		_ = os.WriteFile(filepath.Join(tmp, "many", fmt.Sprintf("%04d.txt", i)), nil, 0o644)
+	}
+
+	s := newTestShareServerWithSettings(tmp)
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	post := func(endpoint string, req map[string]any) *http.Response {
+		t.Helper()
+		body, _ := json.Marshal(req)
+		resp, err := ts.Client().Post(ts.URL+endpoint, "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("POST %s failed: %v", endpoint, err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	estimate := func(req map[string]any) downloadEstimateResponse {
+		t.Helper()
+		resp := post("/api/download-estimate", req)
+		if resp.StatusCode != http.StatusOK {
+			b, _ := io.ReadAll(resp.Body)
+			t.Fatalf("expected 200, got %d, body=%s", resp.StatusCode, b)
+		}
+		var est downloadEstimateResponse
+		if err := json.NewDecoder(resp.Body).Decode(&est); err != nil {
+			t.Fatalf("decode estimate: %v", err)
+		}
+		return est
+	}
+
+	// Same ignore handling as the zip: node_modules is left out.
+	req := map[string]any{"paths": []string{"dir", "c.txt"}, "ignore": []string{"node_modules"}}
+	est := estimate(req)
+	if est.FileCount != 3 || est.TotalBytes != 18 || est.LimitExceeded {
+		t.Fatalf("unexpected estimate %+v", est)
+	}
+	zipResp := post("/api/download-zip", req)
+	zipBytes, _ := io.ReadAll(zipResp.Body)
+	zr, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	if err != nil {
+		t.Fatalf("zip reader failed: %v", err)
+	}
+	if len(zr.File) != est.FileCount {
+		t.Fatalf("estimate says %d files, zip has %d", est.FileCount, len(zr.File))
+	}
+
+	// A single file is sent unzipped, whatever the ignore list says.
+	est = estimate(map[string]any{"paths": []string{"c.txt"}, "ignore": []string{"c.txt"}})
+	if est.FileCount != 1 || est.TotalBytes != 10 {
+		t.Fatalf("unexpected single-file estimate %+v", est)
+	}
+
+	// Over the file limit: the zip is refused, the estimate still counts it all.
+	est = estimate(map[string]any{"paths": []string{"many"}})
+	if est.FileCount != maxFilesInZip+1 || !est.LimitExceeded || est.MaxFiles != maxFilesInZip {
+		t.Fatalf("unexpected over-limit estimate %+v", est)
+	}
+	if resp := post("/api/download-zip", map[string]any{"paths": []string{"many"}}); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected download-zip to refuse, got %d", resp.StatusCode)
+	}
+
+	// Validation errors match download-zip.
+	if resp := post("/api/download-estimate", map[string]any{"paths": []string{"missing"}}); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for a missing path, got %d", resp.StatusCode)
+	}
+	if resp := post("/api/download-estimate", map[string]any{"paths": []string{}}); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an empty selection, got %d", resp.StatusCode)
+	}
+}
+
+func TestShareServerArchiveJobs(t *testing.T) {
+	tmp := t.TempDir()
+	spool := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(tmp, "dir"), 0o755)
+	_ = os.WriteFile(filepath.Join(tmp, "dir", "a.txt"), bytes.Repeat([]byte("a"), 4096), 0o644)
+	_ = os.WriteFile(filepath.Join(tmp, "dir", "b.txt"), []byte("b"), 0o644)
+	_ = os.WriteFile(filepath.Join(spool, "archive-stale.zip.part"), []byte("left over"), 0o644)
+
+	s := newTestShareServerWithSettings(tmp)
+	spoolJSON, _ := json.Marshal(spool)
+	_ = s.settings.Set(SettingKeyArchiveSpoolDir, spoolJSON)
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	do := func(method, target string, body any) *http.Response {
+		t.Helper()
+		var rd io.Reader
+		if body != nil {
+			b, _ := json.Marshal(body)
+			rd = bytes.NewReader(b)
+		}
+		req, _ := http.NewRequest(method, ts.URL+target, rd)
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, target, err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	create := func() archiveJobInfo {
+		t.Helper()
+		resp := do(http.MethodPost, "/api/archive-jobs", map[string]any{"paths": []string{"dir"}})
+		if resp.StatusCode != http.StatusAccepted {
+			b, _ := io.ReadAll(resp.Body)
+			t.Fatalf("expected 202, got %d, body=%s", resp.StatusCode, b)
+		}
+		var info archiveJobInfo
+		_ = json.NewDecoder(resp.Body).Decode(&info)
+		return info
+	}
+
+	job := create()
+	if job.ID == "" || job.Name != "dir.zip" || job.FileCount != 2 || job.TotalBytes != 4097 {
+		t.Fatalf("unexpected job %+v", job)
+	}
+	if _, err := os.Stat(filepath.Join(spool, "archive-stale.zip.part")); !os.IsNotExist(err) {
+		t.Fatalf("expected leftovers from a previous run to be removed")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for job.State == ArchiveJobRunning && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		_ = json.NewDecoder(do(http.MethodGet, "/api/archive-jobs/"+job.ID, nil).Body).Decode(&job)
+	}
+	if job.State != ArchiveJobReady || job.DoneBytes != job.TotalBytes || job.ExpiresAt == "" {
+		t.Fatalf("expected a finished job, got %+v", job)
+	}
+
+	// Served through /api/download with Range support.
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/download?job="+job.ID, nil)
+	req.Header.Set("Range", "bytes=0-1")
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("ranged download failed: %v", err)
+	}
+	head, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent || string(head) != "PK" {
+		t.Fatalf("expected 206 with the zip magic, got %d %q", resp.StatusCode, head)
+	}
+	zipBytes, _ := io.ReadAll(do(http.MethodGet, "/api/download?job="+job.ID, nil).Body)
+	zr, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	if err != nil || len(zr.File) != 2 {
+		t.Fatalf("expected a zip with 2 entries, got %v (%d)", err, len(zipBytes))
+	}
+
+	// Only its creator sees the job and gets the file without a token.
+	for _, c := range []struct{ method, target string }{
+		{http.MethodGet, "/api/archive-jobs/" + job.ID},
+		{http.MethodGet, "/api/download?job=" + job.ID},
+		{http.MethodDelete, "/api/archive-jobs/" + job.ID},
+	} {
+		req := httptest.NewRequest(c.method, c.target, nil)
+		req.RemoteAddr = "192.168.1.77:4000"
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("%s %s from another client = %d, want 404", c.method, c.target, rec.Code)
+		}
+	}
+	if resp := do(http.MethodGet, "/api/preview?job="+job.ID, nil); resp.StatusCode == http.StatusOK {
+		t.Fatalf("expected /api/preview to ignore ?job=")
+	}
+
+	// Capped in number.
+	for i := 1; i < maxArchiveJobs; i++ {
+		create()
+	}
+	if resp := do(http.MethodPost, "/api/archive-jobs", map[string]any{"paths": []string{"dir"}}); resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 over the job cap, got %d", resp.StatusCode)
+	}
+
+	// DELETE drops the job and its file.
+	if resp := do(http.MethodDelete, "/api/archive-jobs/"+job.ID, nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", resp.StatusCode)
+	}
+	if resp := do(http.MethodGet, "/api/download?job="+job.ID, nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 after delete, got %d", resp.StatusCode)
+	}
+
+	// Stopping the server removes whatever is left.
+	s.archives.closeAll()
+	if left, _ := filepath.Glob(filepath.Join(spool, "*")); len(left) != 0 {
+		t.Fatalf("expected an empty spool, got %v", left)
+	}
+}
+
+func TestIgnoreRulesMatch(t *testing.T) {
+	rules := parseIgnoreFile([]byte(`
+# comment
+*.log
+!keep.log
+build/
+/only-top.txt
+docs/**/*.tmp
+**/cache
+out/**
+\#literal
+trailing\ 
+[!a]x.bin
+`), "proj")
+	m := &ignoreMatcher{rules: rules}
+
+	for _, tc := range []struct {
+		rel    string
+		isDir  bool
+		ignore bool
+	}{
+		{"proj/a.log", false, true},
+		{"proj/deep/b.log", false, true},
+		{"proj/keep.log", false, false},
+		{"proj/build", true, true},
+		{"proj/build", false, false}, // "build/" only matches directories
+		{"proj/sub/build/x.go", false, true},
+		{"proj/only-top.txt", false, true},
+		{"proj/sub/only-top.txt", false, false},
+		{"proj/docs/a.tmp", false, true},
+		{"proj/docs/x/y/a.tmp", false, true},
+		{"proj/other/a.tmp", false, false},
+		{"proj/a/b/cache", true, true},
+		{"proj/out", true, false},
+		{"proj/out/x", false, true},
+		{"proj/#literal", false, true},
+		{"proj/trailing ", false, true},
+		{"proj/bx.bin", false, true},
+		{"proj/ax.bin", false, false},
+		{"other/a.log", false, false}, // outside the ignore file's folder
+	} {
+		if got := m.ignored(tc.rel, tc.isDir); got != tc.ignore {
+			t.Errorf("ignored(%q, dir=%v) = %v, want %v", tc.rel, tc.isDir, got, tc.ignore)
+		}
+	}
+}
+
+func TestShareServerZipUseIgnoreFiles(t *testing.T) {
+	tmp := t.TempDir()
+	write := func(rel, content string) {
+		full := filepath.Join(tmp, filepath.FromSlash(rel))
+		_ = os.MkdirAll(filepath.Dir(full), 0o755)
+		_ = os.WriteFile(full, []byte(content), 0o644)
+	}
+	write("proj/.gitignore", "*.log\nnode_modules/\n")
+	write("proj/.localshareignore", "secret.txt\n")
+	write("proj/main.go", "package main")
+	write("proj/debug.log", "x")
+	write("proj/secret.txt", "x")
+	write("proj/node_modules/dep/index.js", "x")
+	// Nested file: re-includes one log and ignores its own generated files.
+	write("proj/sub/.gitignore", "!important.log\n*.gen\n")
+	write("proj/sub/important.log", "x")
+	write("proj/sub/other.log", "x")
+	write("proj/sub/a.gen", "x")
+	write("proj/sub/a.go", "x")
+	// The folder the selection was made in applies; a sibling's doesn't.
+	write(".gitignore", "*.bak\n")
+	write("proj/x.bak", "x")
+	write("other/.gitignore", "*.go\n")
+
+	s := newTestShareServerWithSettings(tmp)
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	zipEntries := func(req map[string]any) []string {
+		t.Helper()
+		body, _ := json.Marshal(req)
+		resp, err := ts.Client().Post(ts.URL+"/api/download-zip", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("POST /api/download-zip failed: %v", err)
+		}
+		defer resp.Body.Close()
+		zipBytes, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d, body=%s", resp.StatusCode, zipBytes)
+		}
+		zr, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+		if err != nil {
+			t.Fatalf("zip reader failed: %v", err)
+		}
+		var names []string
+		for _, f := range zr.File {
+			names = append(names, f.Name)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	got := zipEntries(map[string]any{"paths": []string{"proj"}, "useIgnoreFiles": true})
+	want := []string{
+		"proj/.gitignore",
+		"proj/.localshareignore",
+		"proj/main.go",
+		"proj/sub/.gitignore",
+		"proj/sub/a.go",
+		"proj/sub/important.log",
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("with ignore files:\n got %v\nwant %v", got, want)
+	}
+
+	// Layered on top of the explicit list.
+	got = zipEntries(map[string]any{"paths": []string{"proj"}, "useIgnoreFiles": true, "ignore": []string{"sub"}})
+	if strings.Join(got, ",") != strings.Join(want[:3], ",") {
+		t.Fatalf("with ignore files and explicit ignore: got %v", got)
+	}
+
+	// Opt-in: without the flag everything is archived.
+	if got := zipEntries(map[string]any{"paths": []string{"proj"}}); len(got) != 12 {
+		t.Fatalf("expected all 12 files without useIgnoreFiles, got %v", got)
+	}
+}
+
+func TestPathLocks(t *testing.T) {
+	l := newPathLocks()
+	ctx := context.Background()
+
+	// Shared locks coexist; an exclusive one waits for them.
+	r1, _ := l.lock(ctx, []string{"a.txt"}, false)
+	r2, _ := l.lock(ctx, []string{"a.txt"}, false)
+	got := make(chan struct{})
+	go func() {
+		unlock, _ := l.lock(ctx, []string{"a.txt"}, true)
+		close(got)
+		unlock()
+	}()
+	select {
+	case <-got:
+		t.Fatalf("exclusive lock granted while shared locks are held")
+	case <-time.After(20 * time.Millisecond):
+	}
+	r1()
+	r2()
+	select {
+	case <-got:
+	case <-time.After(time.Second):
+		t.Fatalf("exclusive lock not granted after readers left")
+	}
+
+	// A waiter whose client disconnects gives up and leaves nothing behind.
+	held, _ := l.lock(ctx, []string{"b.txt"}, true)
+	cctx, cancel := context.WithCancel(ctx)
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := l.lock(cctx, []string{"b.txt"}, true)
+		errCh <- err
+	}()
+	cancel()
+	if err := <-errCh; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	held()
+	l.mu.Lock()
+	left := len(l.locks)
+	l.mu.Unlock()
+	if left != 0 {
+		t.Fatalf("expected no lock entries after release, got %d", left)
+	}
+
+	// Multi-path locks in opposite order don't deadlock.
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			unlock, _ := l.lock(ctx, []string{"x", "y"}, true)
+			unlock()
+		}()
+		go func() {
+			defer wg.Done()
+			unlock, _ := l.lock(ctx, []string{"y", "x"}, true)
+			unlock()
+		}()
+	}
+	done := make(chan struct{})
+	go func() { wg.Wait(); close(done) }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("multi-path locks deadlocked")
+	}
+}
+
+func TestShareServerConcurrentUploadsSamePath(t *testing.T) {
+	tmp := t.TempDir()
+	s := newTestShareServerWithSettings(tmp)
+	allowDeleteForTest(t, s)
+	_ = s.settings.Set(SettingKeyDownloadPathLocks, json.RawMessage(`true`))
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	const writers = 8
+	const size = 256 << 10
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(2)
+		content := bytes.Repeat([]byte{byte('a' + i)}, size)
+		go func() {
+			defer wg.Done()
+			resp := postUploadForTest(t, ts, "notes.txt", content)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("upload failed: %d", resp.StatusCode)
+			}
+		}()
+		// Downloads in between must never see a torn file.
+		go func() {
+			defer wg.Done()
+			resp, err := ts.Client().Get(ts.URL + "/api/download?path=notes.txt")
+			if err != nil {
+				t.Errorf("download failed: %v", err)
+				return
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode == http.StatusOK && !isUniformForTest(body, size) {
+				t.Errorf("download saw a torn file (%d bytes)", len(body))
+			}
+		}()
+	}
+	wg.Wait()
+
+	data, err := os.ReadFile(filepath.Join(tmp, "notes.txt"))
+	if err != nil {
+		t.Fatalf("read final file: %v", err)
+	}
+	if !isUniformForTest(data, size) {
+		t.Fatalf("final file is a mixture of uploads (%d bytes)", len(data))
+	}
+	if left, _ := filepath.Glob(filepath.Join(tmp, ".localshare-upload-*")); len(left) != 0 {
+		t.Fatalf("temp files left behind: %v", left)
+	}
+}
+
+func isUniformForTest(b []byte, size int) bool {
+	return len(b) == size && bytes.Count(b, b[:1]) == size
+}
+
+func TestShareServerSPABootstrapInjection(t *testing.T) {
+	tmp := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(tmp, "docs", "reports"), 0o755)
+	page := "<html><head>" + spaBootstrapMarker + "</head><body></body></html>"
+
+	s := newTestShareServerWithSettings(tmp)
+	s.assets = fstest.MapFS{"index.html": {Data: []byte(page)}}
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	bootstrapOf := func(target string) spaBootstrap {
+		t.Helper()
+		resp, err := ts.Client().Get(ts.URL + target)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", target, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if strings.Contains(string(body), spaBootstrapMarker) {
+			t.Fatalf("%s: marker not replaced: %s", target, body)
+		}
+		_, rest, ok := strings.Cut(string(body), "window.__LOCAL_SHARE_BOOTSTRAP__=")
+		if !ok {
+			t.Fatalf("%s: no bootstrap script: %s", target, body)
+		}
+		payload, _, _ := strings.Cut(rest, "</script>")
+		var b spaBootstrap
+		if err := json.Unmarshal([]byte(payload), &b); err != nil {
+			t.Fatalf("%s: decode bootstrap %q: %v", target, payload, err)
+		}
+		return b
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString([]byte("docs")) + "/" + base64.RawURLEncoding.EncodeToString([]byte("reports"))
+	for _, tc := range []struct{ target, path string }{
+		{"/", ""},
+		{"/?path=" + url.QueryEscape(encoded), "docs/reports"},
+		{"/browse/docs/reports", "docs/reports"},
+		{"/browse/../../etc", ""},
+	} {
+		b := bootstrapOf(tc.target)
+		if b.Path != tc.path || b.Auth != "none" || b.RootName != filepath.Base(tmp) {
+			t.Fatalf("%s: unexpected bootstrap %+v", tc.target, b)
+		}
+	}
+
+	// Deep links rebase the relative asset URLs onto the app root.
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/browse/docs/v1.2", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `<base href="../../">`) {
+		t.Fatalf("unexpected deep link page: %d %s", rec.Code, rec.Body.String())
+	}
+
+	// With a pass the root name stays private until the client logs in.
+	_ = s.settings.Set(SettingKeyAccessPass, json.RawMessage(`"abc123"`))
+	if b := bootstrapOf("/"); b.Auth != "pass" || b.RootName != "" {
+		t.Fatalf("unexpected bootstrap with a pass: %+v", b)
+	}
+	_ = s.settings.Delete(SettingKeyAccessPass)
+
+	// Disk-served builds get the same injection.
+	distDir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(distDir, "index.html"), []byte(page), 0o644)
+	raw, _ := json.Marshal(distDir)
+	if err := s.SetSetting(SettingKeyWebDistDir, raw); err != nil {
+		t.Fatalf("set web dist dir: %v", err)
+	}
+	if b := bootstrapOf("/browse/docs"); b.Path != "docs" {
+		t.Fatalf("unexpected disk bootstrap %+v", b)
+	}
+}
+
+func TestShareServerChangesPolling(t *testing.T) {
+	s := newTestShareServerWithSettings(t.TempDir())
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	type changes struct {
+		Events      []sseEvent `json:"events"`
+		LastEventID uint64     `json:"lastEventId"`
+		Reset       bool       `json:"reset"`
+	}
+	poll := func(query string) (int, string, changes) {
+		t.Helper()
+		resp, err := ts.Client().Get(ts.URL + "/api/changes?" + query)
+		if err != nil {
+			t.Fatalf("GET /api/changes?%s: %v", query, err)
+		}
+		defer resp.Body.Close()
+		var c changes
+		if resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&c); err != nil {
+				t.Fatalf("decode changes: %v", err)
+			}
+		}
+		return resp.StatusCode, resp.Header.Get("X-Last-Event-ID"), c
+	}
+
+	if code, id, _ := poll(""); code != http.StatusNoContent || id != "0" {
+		t.Fatalf("expected 204 with id 0, got %d %q", code, id)
+	}
+
+	s.events.broadcast("dirsChanged", map[string]any{"dirs": []string{"a"}})
+	code, id, c := poll("since=0")
+	if code != http.StatusOK || id != "1" || c.LastEventID != 1 || c.Reset || len(c.Events) != 1 {
+		t.Fatalf("unexpected changes: %d %q %+v", code, id, c)
+	}
+	if ev := c.Events[0]; ev.ID != 1 || ev.Event != "dirsChanged" || string(ev.Data) != `{"dirs":["a"]}` {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+	if code, id, _ := poll("since=1"); code != http.StatusNoContent || id != "1" {
+		t.Fatalf("expected 204 with id 1, got %d %q", code, id)
+	}
+
+	// A long poll returns as soon as something is broadcast.
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		s.events.broadcast("dirsChanged", map[string]any{"dirs": []string{"b"}})
+	}()
+	start := time.Now()
+	code, _, c = poll("since=1&timeout=10")
+	if code != http.StatusOK || len(c.Events) != 1 || c.Events[0].ID != 2 {
+		t.Fatalf("unexpected long poll result: %d %+v", code, c)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("long poll was not woken by the broadcast")
+	}
+
+	// Polling from an evicted or unknown ID asks the client to reload.
+	for i := 0; i < sseHistorySize+5; i++ {
+		s.events.broadcast("dirsChanged", map[string]any{"dirs": []string{"c"}})
+	}
+	latest := uint64(sseHistorySize + 7)
+	if _, _, c = poll("since=2"); !c.Reset || c.LastEventID != latest || len(c.Events) != sseHistorySize {
+		t.Fatalf("expected reset after eviction, got reset=%v last=%d n=%d", c.Reset, c.LastEventID, len(c.Events))
+	}
+	if _, _, c = poll(fmt.Sprintf("since=%d", latest+100)); !c.Reset {
+		t.Fatalf("expected reset for a future id, got %+v", c)
+	}
+	if code, _, _ := poll("since=x"); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for bad since, got %d", code)
+	}
+
+	// EventSource reconnects replay what was missed.
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/events", nil)
+	req.Header.Set("Last-Event-ID", fmt.Sprint(latest-1))
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("GET /api/events: %v", err)
+	}
+	br := bufio.NewReader(resp.Body)
+	_, _ = br.ReadString('\n') // ": connected"
+	_, _ = br.ReadString('\n')
+	if line, _ := br.ReadString('\n'); line != fmt.Sprintf("id: %d\n", latest) {
+		t.Fatalf("expected replayed event %d, got %q", latest, line)
+	}
+	resp.Body.Close()
+
+	// Same read permission as the event stream.
+	_ = s.settings.Set(SettingKeyPermissions, json.RawMessage(`{"read":false}`))
+	if code, _, _ := poll("since=0"); code != http.StatusForbidden {
+		t.Fatalf("expected 403 without read permission, got %d", code)
+	}
+}
+
+func TestShareServerSetAccessPass(t *testing.T) {
+	s := newTestShareServerWithSettings(t.TempDir())
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	if st := s.AccessPassStatus(); st.Enabled || st.ChangedAt != "" {
+		t.Fatalf("unexpected initial status %+v", st)
+	}
+	if err := s.SetAccessPass("not valid!"); !errors.Is(err, ErrInvalidAccessPass) {
+		t.Fatalf("expected ErrInvalidAccessPass, got %v", err)
+	}
+	if err := s.SetAccessPass(" abc123 "); err != nil {
+		t.Fatalf("SetAccessPass: %v", err)
+	}
+	st := s.AccessPassStatus()
+	if !st.Enabled || st.ChangedAt == "" {
+		t.Fatalf("unexpected status after set %+v", st)
+	}
+	if b, _ := json.Marshal(st); strings.Contains(string(b), "abc123") {
+		t.Fatalf("status leaks the pass: %s", b)
+	}
+
+	login := func() string {
+		t.Helper()
+		body, _ := json.Marshal(map[string]any{"pass": "abc123"})
+		resp, err := ts.Client().Post(ts.URL+"/api/auth", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("POST /api/auth: %v", err)
+		}
+		defer resp.Body.Close()
+		var out struct {
+			Token string `json:"token"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		if resp.StatusCode != http.StatusOK || out.Token == "" {
+			t.Fatalf("login failed: %d", resp.StatusCode)
+		}
+		return out.Token
+	}
+	list := func(token string) (int, string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/files", nil)
+		req.Header.Set(headerShareToken, token)
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("GET /api/files: %v", err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+
+	// Setting the same pass again still signs everyone out.
+	token := login()
+	if code, _ := list(token); code != http.StatusOK {
+		t.Fatalf("expected 200 with a fresh token, got %d", code)
+	}
+	if err := s.SetAccessPass("abc123"); err != nil {
+		t.Fatalf("SetAccessPass again: %v", err)
+	}
+	if code, body := list(token); code != http.StatusUnauthorized || !strings.Contains(body, "AUTH_PASS_CHANGED") {
+		t.Fatalf("expected revoked token, got %d %s", code, body)
+	}
+
+	// Neither the pass nor its timestamp reaches web clients as an event.
+	events, _, _, _ := s.events.changesSince(0)
+	for _, ev := range events {
+		if strings.Contains(string(ev.Data), "abc123") || strings.Contains(string(ev.Data), "access-pass") {
+			t.Fatalf("access pass broadcast to web clients: %s", ev.Data)
+		}
+	}
+
+	if err := s.ClearAccessPass(); err != nil {
+		t.Fatalf("ClearAccessPass: %v", err)
+	}
+	if st := s.AccessPassStatus(); st.Enabled || st.ChangedAt == "" {
+		t.Fatalf("unexpected status after clear %+v", st)
+	}
+	if code, _ := list(""); code != http.StatusOK {
+		t.Fatalf("expected open access after clear, got %d", code)
+	}
+}
+
+func TestShareServerZipStoreContentLength(t *testing.T) {
+	tmp := t.TempDir()
+	dir := filepath.Join(tmp, "相册")
+	_ = os.MkdirAll(filepath.Join(dir, "sub"), 0o755)
+	_ = os.WriteFile(filepath.Join(dir, "a.txt"), bytes.Repeat([]byte("a"), 1000), 0o644)
+	_ = os.WriteFile(filepath.Join(dir, "sub", "照片.jpg"), []byte("jpeg"), 0o644)
+	_ = os.WriteFile(filepath.Join(dir, "sub", "empty"), nil, 0o644)
+	_ = os.WriteFile(filepath.Join(dir, "Readme.md"), []byte("x"), 0o644)
+	_ = os.WriteFile(filepath.Join(dir, "README.md"), []byte("yy"), 0o644)
+
+	s := newTestShareServerWithSettings(tmp)
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/download-zip", strings.NewReader(body))
+		req.Header.Set("User-Agent", "Windows") // exercise case-insensitive renaming
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := post(`{"paths":["相册"],"compression":"store"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get(headerEstimatedUncompressedSize); got != "1007" {
+		t.Fatalf("unexpected estimated size %q", got)
+	}
+	if got, want := rec.Header().Get("Content-Length"), strconv.Itoa(rec.Body.Len()); got != want {
+		t.Fatalf("Content-Length %s, body is %s bytes", got, want)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatalf("open zip: %v", err)
+	}
+	if len(zr.File) != 5 {
+		t.Fatalf("expected 5 entries, got %d", len(zr.File))
+	}
+	for _, f := range zr.File {
+		if f.Method != zip.Store {
+			t.Fatalf("%s: expected store method, got %d", f.Name, f.Method)
+		}
+	}
+
+	// Deflate keeps streaming without a length but still reports the estimate.
+	rec = post(`{"paths":["相册"]}`)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Length") != "" || rec.Header().Get(headerEstimatedUncompressedSize) != "1007" {
+		t.Fatalf("unexpected deflate headers: %d %v", rec.Code, rec.Header())
+	}
+	if rec = post(`{"paths":["相册"],"compression":"lzma"}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown compression, got %d", rec.Code)
+	}
+
+	features := strings.Join(s.Meta().Features, ",")
+	if !strings.Contains(features, "zip-store") || !strings.Contains(features, "zip-estimated-size") {
+		t.Fatalf("meta features missing zip headers: %s", features)
+	}
+}
+
+// zeroReader yields zero bytes; with io.LimitReader it stands in for huge files.
+type zeroReader struct{}
+
+func (zeroReader) Read(b []byte) (int, error) {
+	clear(b)
+	return len(b), nil
+}
+
+type countingWriter struct{ n int64 }
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	c.n += int64(len(b))
+	return len(b), nil
+}
+
+func TestStoreZipSizeZip64(t *testing.T) {
+	// One entry past 4 GiB switches on 64-bit descriptors, Zip64 extras (the
+	// later entries' offsets too) and the Zip64 end records.
+	mod := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	candidates := []zipCandidate{
+		{zipEntry: "small.txt", size: 10, modTime: mod},
+		{zipEntry: "huge.bin", size: 1<<32 + 5, modTime: mod},
+		{zipEntry: "after.txt", size: 3, modTime: mod},
+	}
+	names := []string{"small.txt", "huge.bin", "after.txt"}
+
+	var cw countingWriter
+	zw := zip.NewWriter(&cw)
+	for _, c := range candidates {
+		h := &zip.FileHeader{Name: c.zipEntry, Method: zip.Store}
+		h.SetModTime(c.modTime)
+		w, err := zw.CreateHeader(h)
+		if err != nil {
+			t.Fatalf("create %s: %v", c.zipEntry, err)
+		}
+		if _, err := io.Copy(w, io.LimitReader(zeroReader{}, c.size)); err != nil {
+			t.Fatalf("write %s: %v", c.zipEntry, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("close zip: %v", err)
+	}
+	if got := storeZipSize(names, candidates); got != cw.n {
+		t.Fatalf("storeZipSize = %d, archive/zip wrote %d", got, cw.n)
+	}
+}
+
+func TestSettingsStoreHistory(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "settings.json")
+	_ = os.WriteFile(path, []byte(`{"local-share:theme":"light"}`), 0o644)
+	store := NewSettingsStoreAt(path)
+
+	// The value found on disk is kept as the oldest entry, then trimmed away.
+	for i := 1; i <= 6; i++ {
+		if err := store.Set("local-share:n", json.RawMessage(strconv.Itoa(i))); err != nil {
+			t.Fatalf("set: %v", err)
+		}
+	}
+	_ = store.Set("local-share:n", json.RawMessage("6")) // unchanged, not recorded
+	h := store.History("local-share:n")
+	if len(h) != settingHistoryLimit || string(h[0].Value) != "6" || string(h[4].Value) != "2" {
+		t.Fatalf("unexpected trimmed history %+v", h)
+	}
+	if h[0].Origin != SettingOriginDesktop || h[0].At == "" {
+		t.Fatalf("unexpected entry %+v", h[0])
+	}
+
+	// Writes through /api/settings record the client IP.
+	s := New(Options{Root: dir, Settings: store})
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	req := httptest.NewRequest(http.MethodPut, "/api/settings/local-share:theme", strings.NewReader(`{"value":"dark"}`))
+	req.RemoteAddr = "192.168.1.50:4321"
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT setting: %d %s", rec.Code, rec.Body.String())
+	}
+	h, err := s.SettingHistory("local-share:theme")
+	if err != nil || len(h) != 2 {
+		t.Fatalf("unexpected theme history %+v %v", h, err)
+	}
+	if h[0].Origin != SettingOriginWeb || h[0].ClientIP != "192.168.1.50" || string(h[0].Value) != `"dark"` {
+		t.Fatalf("unexpected web entry %+v", h[0])
+	}
+	if h[1].Origin != SettingOriginUnknown || h[1].At != "" || string(h[1].Value) != `"light"` {
+		t.Fatalf("unexpected initial entry %+v", h[1])
+	}
+
+	// Reverting writes the old value back as a new desktop change.
+	if err := s.RevertSetting("local-share:theme", 1); err != nil {
+		t.Fatalf("revert: %v", err)
+	}
+	if raw, _, _ := store.Get("local-share:theme"); string(raw) != `"light"` {
+		t.Fatalf("revert wrote %s", raw)
+	}
+	if h, _ = s.SettingHistory("local-share:theme"); len(h) != 3 || h[0].Origin != SettingOriginDesktop {
+		t.Fatalf("unexpected history after revert %+v", h)
+	}
+	if err := s.RevertSetting("local-share:theme", 9); err == nil {
+		t.Fatalf("expected an error for a missing index")
+	}
+
+	// Deletes are entries too and revert to a delete.
+	_ = store.Delete("local-share:n")
+	if h = store.History("local-share:n"); !h[0].Deleted {
+		t.Fatalf("expected a delete entry, got %+v", h[0])
+	}
+	_ = store.Revert("local-share:n", 1)
+	_ = store.Revert("local-share:n", 1)
+	if _, ok, _ := store.Get("local-share:n"); ok {
+		t.Fatalf("expected reverting to the delete to remove the key")
+	}
+
+	// The access pass is only ever recorded as a hash.
+	if err := s.SetAccessPass("abc123"); err != nil {
+		t.Fatalf("SetAccessPass: %v", err)
+	}
+	h, _ = s.SettingHistory(SettingKeyAccessPass)
+	if len(h) != 1 || h[0].Value != nil || len(h[0].ValueHash) != 64 {
+		t.Fatalf("unexpected access pass history %+v", h)
+	}
+	if err := s.RevertSetting(SettingKeyAccessPass, 0); !errors.Is(err, errSettingHistorySecret) {
+		t.Fatalf("expected secret revert to fail, got %v", err)
+	}
+	raw, _ := os.ReadFile(filepath.Join(dir, "settings.history.json"))
+	if len(raw) == 0 || bytes.Contains(raw, []byte("abc123")) {
+		t.Fatalf("history file missing or leaks the pass: %s", raw)
+	}
+
+	// History survives a restart.
+	if h := NewSettingsStoreAt(path).History("local-share:theme"); len(h) != 3 {
+		t.Fatalf("expected persisted history, got %+v", h)
+	}
+}
+
+func TestShareServerUploadFileMode(t *testing.T) {
+	tmp := t.TempDir()
+	// What a plain 0644 create gets under the current umask.
+	ref, err := os.OpenFile(filepath.Join(t.TempDir(), "ref"), os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refSt, _ := ref.Stat()
+	_ = ref.Close()
+
+	s := newTestShareServerWithRoot(tmp)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+	resp := postUploadForTest(t, ts, "a.txt", []byte("abc"))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("upload = %d", resp.StatusCode)
+	}
+	st, err := os.Stat(filepath.Join(tmp, "a.txt"))
+	if err != nil || st.Mode().Perm() != refSt.Mode().Perm() {
+		t.Fatalf("uploaded file mode = %v (%v), want %v", st.Mode().Perm(), err, refSt.Mode().Perm())
+	}
+}
+
+func TestSweepUploadTemps(t *testing.T) {
+	tmp := t.TempDir()
+	sub := filepath.Join(tmp, "a", "b")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	old := time.Now().Add(-2 * uploadTempMaxAge)
+	stale := []string{
+		filepath.Join(tmp, ".localshare-upload-1.part"),
+		filepath.Join(sub, ".localshare-upload-2.part"),
+	}
+	keep := []string{
+		filepath.Join(sub, ".localshare-upload-3.part"), // fresh: may still be written
+		filepath.Join(sub, "localshare-upload-4.part"),
+		filepath.Join(tmp, "notes.txt"),
+	}
+	for _, p := range append(append([]string{}, stale...), keep...) {
+		if err := os.WriteFile(p, []byte("x"), 0o644); err != nil {
+			t.Fatalf("write %s: %v", p, err)
+		}
+	}
+	for _, p := range append(stale, keep[1:]...) {
+		if err := os.Chtimes(p, old, old); err != nil {
+			t.Fatalf("chtimes: %v", err)
+		}
+	}
+
+	if n := sweepUploadTemps(tmp, uploadTempMaxAge); n != len(stale) {
+		t.Fatalf("expected %d removed, got %d", len(stale), n)
+	}
+	for _, p := range stale {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Fatalf("expected %s removed, err=%v", p, err)
+		}
+	}
+	for _, p := range keep {
+		if _, err := os.Stat(p); err != nil {
+			t.Fatalf("expected %s kept: %v", p, err)
+		}
+	}
+}
+
+func TestShareServerSweepUploadTempsWhenIdle(t *testing.T) {
+	root := t.TempDir()
+	var clock atomic.Int64
+	clock.Store(time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC).UnixNano())
+	s := newTestShareServerWithRoot(root)
+	s.activity.now = func() time.Time { return time.Unix(0, clock.Load()) }
+	s.activity.reset()
+	advance := func(d time.Duration) { clock.Add(int64(d)) }
+
+	old := time.Now().Add(-time.Hour)
+	leftover := func(name string) string {
+		t.Helper()
+		p := filepath.Join(root, name)
+		if err := os.WriteFile(p, []byte("x"), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if err := os.Chtimes(p, old, old); err != nil {
+			t.Fatalf("chtimes: %v", err)
+		}
+		return p
+	}
+	exists := func(p string) bool {
+		_, err := os.Stat(p)
+		return err == nil
+	}
+
+	first := leftover(".localshare-upload-1.part")
+	advance(time.Hour)
+	var swept time.Time
+	if swept = s.sweepUploadTempsWhenIdle(swept); !exists(first) {
+		t.Fatalf("an unused share must not sweep")
+	}
+
+	s.activity.noteRequest()
+	advance(uploadTempIdleAge / 2)
+	if swept = s.sweepUploadTempsWhenIdle(swept); !exists(first) {
+		t.Fatalf("a share in use must not sweep")
+	}
+	advance(uploadTempIdleAge)
+	if swept = s.sweepUploadTempsWhenIdle(swept); exists(first) {
+		t.Fatalf("expected the sweep once the share went idle")
+	}
+
+	// Once per idle spell: without new activity nothing is walked again.
+	second := leftover(".localshare-upload-2.part")
+	advance(time.Hour)
+	if swept = s.sweepUploadTempsWhenIdle(swept); !exists(second) {
+		t.Fatalf("expected no second sweep without new activity")
+	}
+	s.activity.noteTransfer()
+	advance(uploadTempIdleAge)
+	if s.sweepUploadTempsWhenIdle(swept); exists(second) {
+		t.Fatalf("expected a sweep after the next idle spell")
+	}
+}
+
+func TestShareServerBasePath(t *testing.T) {
+	tmp := t.TempDir()
+	_ = os.WriteFile(filepath.Join(tmp, "hello.txt"), []byte("hi"), 0o644)
+	page := "<html><head>" + spaBootstrapMarker + "</head><body></body></html>"
+
+	s := newTestShareServerWithSettings(tmp)
+	s.assets = fstest.MapFS{
+		"index.html":    {Data: []byte(page)},
+		"assets/app.js": {Data: []byte("console.log(1)")},
+	}
+	s.mu.Lock()
+	s.sharedRoot = tmp
+	s.shortCode = "123456"
+	s.mu.Unlock()
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	client := ts.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	get := func(target string) (*http.Response, string) {
+		t.Helper()
+		resp, err := client.Get(ts.URL + target)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", target, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+	expect := func(target string, status int) string {
+		t.Helper()
+		resp, body := get(target)
+		if resp.StatusCode != status {
+			t.Fatalf("GET %s: expected %d, got %d: %s", target, status, resp.StatusCode, body)
+		}
+		return body
+	}
+
+	// Unprefixed: everything stays where it was.
+	plain := expect("/", http.StatusOK)
+	expect("/api/files", http.StatusOK)
+	expect("/assets/app.js", http.StatusOK)
+	if resp, _ := get("/c/123456"); resp.Header.Get("Location") != "/" {
+		t.Fatalf("unexpected short code redirect %q", resp.Header.Get("Location"))
+	}
+	if strings.Contains(plain, "basePath") {
+		t.Fatalf("bootstrap mentions basePath without one: %s", plain)
+	}
+
+	if err := s.SetSetting(SettingKeyBasePath, json.RawMessage(`"/a b"`)); !errors.Is(err, errInvalidBasePath) {
+		t.Fatalf("expected invalid base path error, got %v", err)
+	}
+	if err := s.SetSetting(SettingKeyBasePath, json.RawMessage(`"share/"`)); err != nil {
+		t.Fatalf("set base path: %v", err)
+	}
+
+	page = expect("/share/", http.StatusOK)
+	if !strings.Contains(page, `"basePath":"/share"`) {
+		t.Fatalf("bootstrap lacks basePath: %s", page)
+	}
+	expect("/share/api/files", http.StatusOK)
+	expect("/share/assets/app.js", http.StatusOK)
+	expect("/share/browse/docs", http.StatusOK)
+	if body := expect("/share/api/download?path=hello.txt", http.StatusOK); body != "hi" {
+		t.Fatalf("unexpected download %q", body)
+	}
+	if resp, _ := get("/share?path=x"); resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != "/share/?path=x" {
+		t.Fatalf("bare prefix: got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	if resp, _ := get("/share/c/123456"); resp.Header.Get("Location") != "/share/" {
+		t.Fatalf("unexpected short code redirect %q", resp.Header.Get("Location"))
+	}
+	for _, target := range []string{"/", "/api/files", "/assets/app.js", "/c/123456", "/sharex/api/files"} {
+		expect(target, http.StatusNotFound)
+	}
+	expect("/share/api/settings/"+SettingKeyBasePath, http.StatusNotFound)
+
+	s.mu.Lock()
+	s.localIP, s.port = "192.168.1.2", 8080
+	info := s.serverInfoLocked()
+	s.mu.Unlock()
+	if info.URL != "http://192.168.1.2:8080/share" || info.ShortURL != "http://192.168.1.2:8080/share/c/123456" {
+		t.Fatalf("unexpected server info %+v", info)
+	}
+
+	// Removing the prefix restores the plain layout byte for byte.
+	if err := s.SetSetting(SettingKeyBasePath, nil); err != nil {
+		t.Fatalf("clear base path: %v", err)
+	}
+	if got := expect("/", http.StatusOK); got != plain {
+		t.Fatalf("root page changed:\n%s\n%s", plain, got)
+	}
+}
+
+func TestNormalizeBasePath(t *testing.T) {
+	for in, want := range map[string]string{"": "", "/": "", "share": "/share", " /a/b/ ": "/a/b", "x~_.-1": "/x~_.-1"} {
+		if got, err := normalizeBasePath(in); err != nil || got != want {
+			t.Fatalf("normalizeBasePath(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"a//b", "../x", "a/./b", "a?b", "<x>", "中文"} {
+		if _, err := normalizeBasePath(in); err == nil {
+			t.Fatalf("normalizeBasePath(%q) should fail", in)
+		}
+	}
+}
+
+func TestShareServerUploadNoDeleteOverwrite(t *testing.T) {
+	tmp := t.TempDir()
+	if err := os.Mkdir(filepath.Join(tmp, "docs"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	s := newTestShareServerWithSettings(tmp)
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	expectDenied := func(name, wantMsg string) {
+		t.Helper()
+		resp := postUploadForTest(t, ts, name, []byte("new"))
+		defer resp.Body.Close()
+		var body map[string]string
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		if resp.StatusCode != http.StatusForbidden || body["code"] != "PERMISSION_DENIED_DELETE" || body["error"] != wantMsg {
+			t.Fatalf("%s: expected 403 %q, got %d %v", name, wantMsg, resp.StatusCode, body)
+		}
+	}
+
+	// A file appearing between the existence check and the write.
+	raced := filepath.Join(tmp, "raced.txt")
+	s.uploadClaimHook = func(outPath string) {
+		if outPath == raced {
+			_ = os.WriteFile(raced, []byte("theirs"), 0o644)
+		}
+	}
+	expectDenied("raced.txt", "无删除权限，不能覆盖同名文件")
+	if b, _ := os.ReadFile(raced); string(b) != "theirs" {
+		t.Fatalf("raced file was overwritten: %q", b)
+	}
+
+	// "Docs" would land on "docs" where names ignore case.
+	orig := caseInsensitiveFS
+	caseInsensitiveFS = true
+	defer func() { caseInsensitiveFS = orig }()
+	expectDenied("Docs", "无删除权限，不能覆盖同名目录")
+
+	// New names still go through, leaving no placeholder or temp behind.
+	resp := postUploadForTest(t, ts, "fresh.txt", []byte("new"))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected fresh upload to succeed, got %d", resp.StatusCode)
+	}
+	if b, _ := os.ReadFile(filepath.Join(tmp, "fresh.txt")); string(b) != "new" {
+		t.Fatalf("unexpected content %q", b)
+	}
+	entries, _ := os.ReadDir(tmp)
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), uploadTempPrefix) {
+			t.Fatalf("temp file left behind: %s", e.Name())
+		}
+	}
+
+	// Concurrent uploads of one new name: exactly one wins.
+	var wg sync.WaitGroup
+	var ok atomic.Int32
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp := postUploadForTest(t, ts, "once.txt", []byte(fmt.Sprint(i)))
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				ok.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if ok.Load() != 1 {
+		t.Fatalf("expected exactly one upload of once.txt to succeed, got %d", ok.Load())
+	}
+}
+
+func TestShareServerSession(t *testing.T) {
+	tmp := t.TempDir()
+	s := newTestShareServerWithSettings(tmp)
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	getSession := func(token string) sessionResponse {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/session", nil)
+		if token != "" {
+			req.Header.Set(headerShareToken, token)
+		}
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("GET /api/session failed: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", resp.StatusCode)
+		}
+		var out sessionResponse
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			t.Fatalf("decode session: %v", err)
+		}
+		return out
+	}
+
+	// No pass: nothing to authenticate, settings decide.
+	got := getSession("")
+	want := sessionResponse{
+		Permissions: sessionPermissions{Read: true, Write: true, List: true},
+		ClientIP:    "127.0.0.1",
+	}
+	if got != want {
+		t.Fatalf("without pass: got %+v, want %+v", got, want)
+	}
+	if err := s.settings.Set(SettingKeyPermissions, json.RawMessage(`{"read":false,"write":true}`)); err != nil {
+		t.Fatalf("set permissions: %v", err)
+	}
+	if got := getSession(""); !got.DropboxMode || got.Permissions.List {
+		t.Fatalf("expected dropbox mode, got %+v", got)
+	}
+	_ = s.settings.Delete(SettingKeyPermissions)
+
+	// With a pass, everything waits for a token.
+	if err := s.SetAccessPass("a1"); err != nil {
+		t.Fatalf("set access pass: %v", err)
+	}
+	got = getSession("")
+	if got.Authenticated || !got.AuthRequired || got.Code != "AUTH_REQUIRED" || got.Permissions != (sessionPermissions{}) {
+		t.Fatalf("without token: %+v", got)
+	}
+	if got := getSession("bogus"); got.Authenticated || got.Code != "AUTH_REQUIRED" {
+		t.Fatalf("with bogus token: %+v", got)
+	}
+
+	authBody, _ := json.Marshal(map[string]any{"pass": "a1"})
+	resp, err := ts.Client().Post(ts.URL+"/api/auth", "application/json", bytes.NewReader(authBody))
+	if err != nil {
+		t.Fatalf("POST /api/auth failed: %v", err)
+	}
+	var authResp struct {
+		Token string `json:"token"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&authResp)
+	resp.Body.Close()
+
+	got = getSession(authResp.Token)
+	if !got.Authenticated || got.Code != "" || got.TokenExpiresIn <= 0 || got.TokenExpiresIn > int(defaultAuthTokenTTL.Seconds()) {
+		t.Fatalf("with token: %+v", got)
+	}
+	if got.Permissions != (sessionPermissions{Read: true, Write: true, List: true}) {
+		t.Fatalf("unexpected permissions %+v", got.Permissions)
+	}
+
+	// A changed pass is reported, not answered with 401.
+	if err := s.SetAccessPass("b2"); err != nil {
+		t.Fatalf("change access pass: %v", err)
+	}
+	if got := getSession(authResp.Token); got.Authenticated || got.Code != "AUTH_PASS_CHANGED" {
+		t.Fatalf("after pass change: %+v", got)
+	}
+}
+
+func TestShareServerStopsWhenRootLost(t *testing.T) {
+	if _, err := getLocalIPv4(); err != nil {
+		t.Skipf("no local IPv4: %v", err)
+	}
+	root := filepath.Join(t.TempDir(), "share")
+	if err := os.Mkdir(root, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	type lost struct{ root, reason string }
+	got := make(chan lost, 1)
+	s := New(Options{
+		Settings:          NewMemorySettings(),
+		RememberLastShare: true,
+		OnShareRootLost: func(root, reason string) {
+			got <- lost{root, reason}
+		},
+	})
+	s.rootCheckInterval = 10 * time.Millisecond
+	info, err := s.Start(context.Background(), root)
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer func() { _ = s.Stop(context.Background()) }()
+	if info.Info.Removable {
+		t.Fatalf("expected temp dir not removable")
+	}
+
+	if err := os.RemoveAll(root); err != nil {
+		t.Fatalf("remove root: %v", err)
+	}
+	select {
+	case l := <-got:
+		if l.root != root || l.reason != ShareRootLostUnavailable {
+			t.Fatalf("unexpected callback %+v", l)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected share to stop after its folder was removed")
+	}
+	if info, _ := s.GetServerInfo(); info != nil {
+		t.Fatalf("expected server stopped, got %+v", info)
+	}
+	// Still resumable once the folder is back.
+	if last, ok := s.LastShare(); !ok || last.Root != root || !last.Active {
+		t.Fatalf("expected active last share %q, got %+v ok=%v", root, last, ok)
+	}
+}
+
+func TestShareServerManifest(t *testing.T) {
+	tmp := t.TempDir()
+	for _, dir := range []string{"photos/2024", "photos/.thumbs", "photos/cache"} {
+		_ = os.MkdirAll(filepath.Join(tmp, filepath.FromSlash(dir)), 0o755)
+	}
+	_ = os.WriteFile(filepath.Join(tmp, "photos", "a b.jpg"), []byte("a"), 0o644)
+	_ = os.WriteFile(filepath.Join(tmp, "photos", "2024", "b.jpg"), []byte("b"), 0o644)
+	_ = os.WriteFile(filepath.Join(tmp, "photos", ".DS_Store"), []byte("x"), 0o644)
+	_ = os.WriteFile(filepath.Join(tmp, "photos", ".thumbs", "a.jpg"), []byte("x"), 0o644)
+	_ = os.WriteFile(filepath.Join(tmp, "photos", "cache", "c.bin"), []byte("x"), 0o644)
+	_ = os.WriteFile(filepath.Join(tmp, "secret.txt"), []byte("s"), 0o644)
+
+	s := newTestShareServerWithSettings(tmp)
+	if err := s.SetSetting(SettingKeyWatchIgnore, json.RawMessage(`["cache"]`)); err != nil {
+		t.Fatalf("set watch ignore: %v", err)
+	}
+	_ = s.settings.Set(SettingKeyAccessPass, json.RawMessage(`"abc123"`))
+	session, _, err := s.auth.issue("127.0.0.1", accessPassHash("abc123"))
+	if err != nil {
+		t.Fatalf("issue token: %v", err)
+	}
+
+	s.localIP, s.port = "10.0.0.2", 8080
+
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	// The URLs point at the share's own address; send them to ts instead.
+	own := "http://10.0.0.2:8080/"
+	get := func(u string, token string) (int, []byte) {
+		t.Helper()
+		if strings.HasPrefix(u, own) {
+			u = ts.URL + "/" + strings.TrimPrefix(u, own)
+		}
+		req, _ := http.NewRequest(http.MethodGet, u, nil)
+		if token != "" {
+			req.Header.Set(headerShareToken, token)
+		}
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", u, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, body
+	}
+
+	if code, _ := get(ts.URL+"/api/manifest?path=photos", ""); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %d", code)
+	}
+
+	code, body := get(ts.URL+"/api/manifest?path=photos&recursive=1", session)
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", code, body)
+	}
+	var m manifestResponse
+	if err := json.Unmarshal(body, &m); err != nil {
+		t.Fatalf("decode manifest: %v", err)
+	}
+	var got []string
+	for _, f := range m.Files {
+		got = append(got, f.Path)
+		if strings.Contains(f.URL, session) || !strings.Contains(f.URL, queryLinkToken+"=") {
+			t.Fatalf("expected a link token instead of the session token in %q", f.URL)
+		}
+		if !strings.HasPrefix(f.URL, own+"api/download?") {
+			t.Fatalf("expected a URL on the share's own address, got %q", f.URL)
+		}
+	}
+	if strings.Join(got, ",") != "photos/2024/b.jpg,photos/a b.jpg" {
+		t.Fatalf("unexpected files %v", got)
+	}
+	if m.ExpiresIn <= 0 {
+		t.Fatalf("expected expiresIn, got %d", m.ExpiresIn)
+	}
+
+	// The links work on their own, but only inside the folder.
+	if code, body := get(m.Files[1].URL, ""); code != http.StatusOK || string(body) != "a" {
+		t.Fatalf("expected link download to work, got %d %q", code, body)
+	}
+	link := m.Files[0].URL[strings.Index(m.Files[0].URL, "&"+queryLinkToken+"="):]
+	if code, _ := get(ts.URL+"/api/download?path=secret.txt"+link, ""); code != http.StatusUnauthorized {
+		t.Fatalf("expected link token rejected outside its folder, got %d", code)
+	}
+	if code, _ := get(ts.URL+"/api/download?path=photos/../secret.txt"+link, ""); code != http.StatusUnauthorized {
+		t.Fatalf("expected link token rejected for ../ paths, got %d", code)
+	}
+	if code, _ := get(ts.URL+"/api/files?path=photos"+link, ""); code != http.StatusUnauthorized {
+		t.Fatalf("expected link token rejected outside /api/download, got %d", code)
+	}
+	// Nor for what the manifest left out, and it can't mint a download token.
+	for _, p := range []string{"photos/.DS_Store", "photos/.thumbs/a.jpg", "photos/cache/c.bin"} {
+		if code, _ := get(ts.URL+"/api/download?path="+url.QueryEscape(p)+link, ""); code != http.StatusUnauthorized {
+			t.Fatalf("expected link token rejected for %s, got %d", p, code)
+		}
+	}
+	if code, _ := get(m.Files[1].URL+"&"+queryWantDownloadToken+"=1", ""); code != http.StatusForbidden {
+		t.Fatalf("expected no download token for a link, got %d", code)
+	}
+
+	// Without recursive only the folder's own files; txt is one URL per line.
+	code, body = get(ts.URL+"/api/manifest?path=photos&format=txt", session)
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	if code != http.StatusOK || len(lines) != 1 || !strings.Contains(lines[0], "path=photos%2Fa+b.jpg") {
+		t.Fatalf("unexpected txt manifest %d %q", code, body)
+	}
+	// Its link doesn't reach into subfolders either.
+	link = lines[0][strings.Index(lines[0], "&"+queryLinkToken+"="):]
+	if code, _ := get(lines[0], ""); code != http.StatusOK {
+		t.Fatalf("expected non-recursive link download to work, got %d", code)
+	}
+	if code, _ := get(ts.URL+"/api/download?path=photos/2024/b.jpg"+link, ""); code != http.StatusUnauthorized {
+		t.Fatalf("expected non-recursive link rejected in a subfolder, got %d", code)
+	}
+	// A forged Host header doesn't change where the links point.
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/manifest?path=photos&format=txt", nil)
+	req.Host = "evil.example"
+	req.Header.Set(headerShareToken, session)
+	if resp, err := ts.Client().Do(req); err == nil {
+		b, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if strings.Contains(string(b), "evil.example") {
+			t.Fatalf("manifest used the Host header: %q", b)
+		}
+	}
+
+	// Changing the pass invalidates the links.
+	_ = s.settings.Set(SettingKeyAccessPass, json.RawMessage(`"other"`))
+	if code, _ := get(m.Files[1].URL, ""); code != http.StatusUnauthorized {
+		t.Fatalf("expected link rejected after pass change, got %d", code)
+	}
+}
+
+func TestShareServerJSONResponses(t *testing.T) {
+	tmp := t.TempDir()
+	_ = os.WriteFile(filepath.Join(tmp, "a.txt"), []byte("a"), 0o644)
+	log := &recordingLogger{}
+	s := New(Options{Settings: NewMemorySettings(), Logger: log})
+	s.sharedRoot = tmp
+
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	mux.HandleFunc("/test/nan", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]float64{"ratio": math.NaN()})
+	})
+	ts := httptest.NewServer(s.logRequests(s.recoverPanics(mux)))
+	defer ts.Close()
+
+	cases := []struct {
+		method, target string
+		status         int
+		// contains is a fragment the body must have.
+		contains string
+	}{
+		{http.MethodGet, "/api/meta", http.StatusOK, `"version"`},
+		{http.MethodGet, "/api/files", http.StatusOK, `"a.txt"`},
+		{http.MethodGet, "/api/files?path=missing", http.StatusNotFound, `"error"`},
+		{http.MethodGet, "/api/download", http.StatusBadRequest, "缺少文件路径参数"},
+		{http.MethodGet, "/api/settings/local-share:missing", http.StatusNotFound, `"error"`},
+		{http.MethodPost, "/api/download-all", http.StatusMethodNotAllowed, "仅支持 GET"},
+		{http.MethodGet, "/test/nan", http.StatusInternalServerError, `"code":"INTERNAL_ERROR"`},
+	}
+	for _, tc := range cases {
+		req, _ := http.NewRequest(tc.method, ts.URL+tc.target, nil)
+		// Ask for the raw body so Content-Length can be checked.
+		req.Header.Set("Accept-Encoding", "identity")
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", tc.method, tc.target, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tc.status {
+			t.Fatalf("%s %s: expected %d, got %d body=%s", tc.method, tc.target, tc.status, resp.StatusCode, body)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "application/json; charset=utf-8" {
+			t.Fatalf("%s %s: unexpected Content-Type %q", tc.method, tc.target, ct)
+		}
+		if resp.ContentLength != int64(len(body)) || len(resp.TransferEncoding) != 0 {
+			t.Fatalf("%s %s: expected Content-Length %d, got %d %v", tc.method, tc.target, len(body), resp.ContentLength, resp.TransferEncoding)
+		}
+		if !json.Valid(body) || !strings.Contains(string(body), tc.contains) {
+			t.Fatalf("%s %s: expected JSON with %q, got %s", tc.method, tc.target, tc.contains, body)
+		}
+	}
+
+	// The encoding failure is logged, not sent half-written.
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	found := false
+	for _, line := range log.lines {
+		found = found || strings.Contains(line, "unsupported value: NaN")
+	}
+	if !found {
+		t.Fatalf("expected encode failure logged, got %v", log.lines)
+	}
+}
+
+func TestShareServerAdminAPI(t *testing.T) {
+	if _, err := getLocalIPv4(); err != nil {
+		t.Skipf("no local IPv4: %v", err)
+	}
+	root := t.TempDir()
+	log := &recordingLogger{}
+	actions := make(chan string, 4)
+	s := New(Options{
+		// A store that keeps history, to see who changed the permissions.
+		Settings: NewSettingsStoreAt(filepath.Join(t.TempDir(), "settings.json")),
+		Logger:   log,
+		OnRemoteAdmin: func(action, ip string) {
+			actions <- action
+		},
+	})
+	if _, err := s.Start(context.Background(), root); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer func() { _ = s.Stop(context.Background()) }()
+
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	do := func(method, target, adminPass, body string) (int, map[string]any) {
+		t.Helper()
+		req, _ := http.NewRequest(method, ts.URL+target, strings.NewReader(body))
+		if adminPass != "" {
+			req.Header.Set(headerAdminPass, adminPass)
+		}
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, target, err)
+		}
+		defer resp.Body.Close()
+		var out map[string]any
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+
+	// Off by default.
+	if code, body := do(http.MethodPost, "/api/admin/stop", "", ""); code != http.StatusNotFound || body["code"] != "ADMIN_DISABLED" {
+		t.Fatalf("expected admin disabled, got %d %v", code, body)
+	}
+
+	if err := s.SetAccessPass("abcd1234"); err != nil {
+		t.Fatalf("SetAccessPass: %v", err)
+	}
+	if err := s.SetSetting(SettingKeyAdminPass, json.RawMessage(`"short"`)); !errors.Is(err, errInvalidAdminPass) {
+		t.Fatalf("expected short admin pass rejected, got %v", err)
+	}
+	if err := s.SetSetting(SettingKeyAdminPass, json.RawMessage(`"abcd1234"`)); !errors.Is(err, errAdminPassIsAccess) {
+		t.Fatalf("expected access pass rejected as admin pass, got %v", err)
+	}
+	if err := s.SetSetting(SettingKeyAdminPass, json.RawMessage(`"admin-secret-1"`)); err != nil {
+		t.Fatalf("set admin pass: %v", err)
+	}
+	if err := s.SetSetting(SettingKeyAdminIPs, json.RawMessage(`["not-an-ip"]`)); !errors.Is(err, errInvalidAdminIPList) {
+		t.Fatalf("expected bad IP list rejected, got %v", err)
+	}
+
+	// The access pass is not an admin pass.
+	if code, body := do(http.MethodGet, "/api/admin/permissions", "", ""); code != http.StatusUnauthorized || body["code"] != "ADMIN_REQUIRED" {
+		t.Fatalf("expected admin pass required, got %d %v", code, body)
+	}
+	if code, body := do(http.MethodGet, "/api/admin/permissions", "abcd1234", ""); code != http.StatusUnauthorized || body["code"] != "ADMIN_PASS_INVALID" {
+		t.Fatalf("expected wrong admin pass rejected, got %d %v", code, body)
+	}
+
+	code, body := do(http.MethodPost, "/api/admin/permissions", "admin-secret-1", `{"delete":true,"write":false}`)
+	if code != http.StatusOK || body["delete"] != true || body["write"] != false || body["read"] != true {
+		t.Fatalf("expected permissions changed, got %d %v", code, body)
+	}
+	if p := s.getPermissionsFromSettings(); !p.Delete || p.Write || !p.Read {
+		t.Fatalf("expected stored permissions changed, got %+v", p)
+	}
+	if a := <-actions; a != RemoteAdminPermissions {
+		t.Fatalf("expected permissions callback, got %q", a)
+	}
+	if h, err := s.SettingHistory(SettingKeyPermissions); err != nil || len(h) == 0 || h[0].Origin != SettingOriginWeb || h[0].ClientIP != "127.0.0.1" {
+		t.Fatalf("expected a web history entry for the admin change, got %+v %v", h, err)
+	}
+
+	// A granted IP needs no pass.
+	if err := s.SetSetting(SettingKeyAdminIPs, json.RawMessage(`["127.0.0.1"]`)); err != nil {
+		t.Fatalf("set admin IPs: %v", err)
+	}
+	if code, body := do(http.MethodPost, "/api/admin/stop", "", ""); code != http.StatusOK || body["success"] != true {
+		t.Fatalf("expected stop accepted, got %d %v", code, body)
+	}
+	select {
+	case a := <-actions:
+		if a != RemoteAdminStop {
+			t.Fatalf("expected stop callback, got %q", a)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("expected share stopped")
+	}
+	if s.IsRunning() {
+		t.Fatalf("expected server stopped")
+	}
+
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	audit := strings.Join(log.lines, "\n")
+	for _, want := range []string{"wrong admin pass", "permissions", "stop sharing by ip=127.0.0.1"} {
+		if !strings.Contains(audit, want) {
+			t.Fatalf("expected %q in audit log, got %s", want, audit)
+		}
+	}
+}
+
+func TestShareServerPut(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("old"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	s := newTestShareServerWithSettings(root)
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	put := func(target, body string, header map[string]string) (int, map[string]any) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPut, ts.URL+target, strings.NewReader(body))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("PUT %s failed: %v", target, err)
+		}
+		defer resp.Body.Close()
+		var out map[string]any
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+	readFile := func(name string) string {
+		t.Helper()
+		b, err := os.ReadFile(filepath.Join(root, name))
+		if err != nil {
+			t.Fatalf("read %s failed: %v", name, err)
+		}
+		return string(b)
+	}
+
+	// New file in a new folder.
+	code, body := put("/api/put/sub/new.txt", "hello", nil)
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %v", code, body)
+	}
+	files, _ := body["files"].([]any)
+	if len(files) != 1 {
+		t.Fatalf("expected one file, got %v", body)
+	}
+	if f := files[0].(map[string]any); f["path"] != "sub/new.txt" || f["name"] != "new.txt" || f["size"] != float64(5) || f["status"] != "uploaded" {
+		t.Fatalf("unexpected file entry: %v", f)
+	}
+	if got := readFile("sub/new.txt"); got != "hello" {
+		t.Fatalf("unexpected content %q", got)
+	}
+
+	// Overwriting needs the delete permission.
+	if code, body := put("/api/put/a.txt", "new", nil); code != http.StatusForbidden || body["code"] != "PERMISSION_DENIED_DELETE" {
+		t.Fatalf("expected overwrite denied, got %d %v", code, body)
+	}
+	if got := readFile("a.txt"); got != "old" {
+		t.Fatalf("denied overwrite changed the file: %q", got)
+	}
+	if code, body := put("/api/put/a.txt?conflict=fail", "new", nil); code != http.StatusConflict || body["code"] != "UPLOAD_EXISTS" {
+		t.Fatalf("expected conflict, got %d %v", code, body)
+	}
+	code, body = put("/api/put/a.txt?conflict=rename", "renamed", nil)
+	if code != http.StatusOK {
+		t.Fatalf("expected rename to succeed, got %d %v", code, body)
+	}
+	if f := body["files"].([]any)[0].(map[string]any); f["path"] != "a (1).txt" {
+		t.Fatalf("expected a (1).txt, got %v", f)
+	}
+	if got := readFile("a (1).txt"); got != "renamed" {
+		t.Fatalf("unexpected renamed content %q", got)
+	}
+	allowDeleteForTest(t, s)
+	if code, body := put("/api/put/a.txt", "new", nil); code != http.StatusOK {
+		t.Fatalf("expected overwrite, got %d %v", code, body)
+	}
+	if got := readFile("a.txt"); got != "new" {
+		t.Fatalf("unexpected overwritten content %q", got)
+	}
+	if code, _ := put("/api/put/a.txt?conflict=bogus", "x", nil); code != http.StatusBadRequest {
+		t.Fatalf("expected bad conflict policy rejected, got %d", code)
+	}
+	if code, _ := put("/api/put/sub/", "x", nil); code != http.StatusBadRequest {
+		t.Fatalf("expected folder path rejected, got %d", code)
+	}
+
+	// Checksums.
+	md5Sum := "XUFAKrxLKna5cZ2REBfFkg==" // md5("hello")
+	shaSum := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	if code, body := put("/api/put/ok.txt", "hello", map[string]string{"Content-MD5": md5Sum, "X-Content-Sha256": shaSum}); code != http.StatusOK {
+		t.Fatalf("expected matching checksums accepted, got %d %v", code, body)
+	}
+	if code, body := put("/api/put/bad.txt", "hellO", map[string]string{"X-Content-Sha256": shaSum}); code != http.StatusBadRequest || body["code"] != "CHECKSUM_MISMATCH" {
+		t.Fatalf("expected checksum mismatch, got %d %v", code, body)
+	}
+	if code, body := put("/api/put/a.txt", "hellO", map[string]string{"Content-MD5": md5Sum}); code != http.StatusBadRequest || body["code"] != "CHECKSUM_MISMATCH" {
+		t.Fatalf("expected checksum mismatch, got %d %v", code, body)
+	}
+	if code, _ := put("/api/put/bad.txt", "hello", map[string]string{"Content-MD5": "nope"}); code != http.StatusBadRequest {
+		t.Fatalf("expected malformed Content-MD5 rejected, got %d", code)
+	}
+	if code, _ := put("/api/put/never/made/bad.txt", "hellO", map[string]string{"X-Content-Sha256": shaSum}); code != http.StatusBadRequest {
+		t.Fatalf("expected checksum mismatch in a new folder, got %d", code)
+	}
+	if _, err := os.Stat(filepath.Join(root, "never")); !os.IsNotExist(err) {
+		t.Fatalf("rejected upload created its folder: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "bad.txt")); !os.IsNotExist(err) {
+		t.Fatalf("failed upload left bad.txt behind: %v", err)
+	}
+	// Stored like any new file, not with the temp file's 0600.
+	ref := filepath.Join(t.TempDir(), "ref")
+	_ = os.WriteFile(ref, nil, 0o644)
+	refSt, _ := os.Stat(ref)
+	if st, err := os.Stat(filepath.Join(root, "ok.txt")); err != nil {
+		t.Fatalf("stat ok.txt: %v", err)
+	} else if st.Mode().Perm() != refSt.Mode().Perm() {
+		t.Fatalf("PUT file mode = %v, want %v", st.Mode().Perm(), refSt.Mode().Perm())
+	}
+	if got := readFile("a.txt"); got != "new" {
+		t.Fatalf("failed checksum changed the file: %q", got)
+	}
+	entries, _ := os.ReadDir(root)
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), uploadTempPrefix) {
+			t.Fatalf("temp file left behind: %s", e.Name())
+		}
+	}
+}
+
+func TestShareServerRejectsPathTraversal(t *testing.T) {
+	parent := t.TempDir()
+	root := filepath.Join(parent, "share")
+	if err := os.MkdirAll(filepath.Join(root, "sub"), 0o755); err != nil {
+		t.Fatalf("mkdir failed: %v", err)
+	}
+	_ = os.WriteFile(filepath.Join(parent, "secret.txt"), []byte("secret"), 0o644)
+	_ = os.WriteFile(filepath.Join(root, "sub", "a.txt"), []byte("a"), 0o644)
+
+	var probes []string
+	s := New(Options{
+		Root:     root,
+		Settings: NewMemorySettings(),
+		Logger:   &recordingLogger{},
+		OnPathProbe: func(ip string, attempts int) {
+			probes = append(probes, fmt.Sprintf("%s/%d", ip, attempts))
+		},
+	})
+	allowDeleteForTest(t, s)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	payloads := []string{
+		"../secret.txt",
+		"../../etc/passwd",
+		"sub/../../secret.txt",
+		"%2e%2e/%2e%2e/secret.txt", // percent-encoded dots, sent as-is in URLs
+		`..\secret.txt`,
+		`sub\..\..\secret.txt`,
+		`sub/..\../secret.txt`,
+		"./../secret.txt",
+	}
+	decoded := func(p string) string {
+		if v, err := url.PathUnescape(p); err == nil {
+			return v
+		}
+		return p
+	}
+
+	type endpoint struct {
+		name string
+		do   func(p string) *http.Response
+	}
+	get := func(target string) func(p string) *http.Response {
+		return func(p string) *http.Response {
+			q := url.QueryEscape(p)
+			if strings.Contains(p, "%") {
+				q = p
+			}
+			resp, err := ts.Client().Get(ts.URL + target + q)
+			if err != nil {
+				t.Fatalf("GET %s failed: %v", target, err)
+			}
+			return resp
+		}
+	}
+	postPaths := func(target string) func(p string) *http.Response {
+		return func(p string) *http.Response {
+			body, _ := json.Marshal(map[string]any{"paths": []string{"sub/a.txt", decoded(p)}})
+			resp, err := ts.Client().Post(ts.URL+target, "application/json", bytes.NewReader(body))
+			if err != nil {
+				t.Fatalf("POST %s failed: %v", target, err)
+			}
+			return resp
+		}
+	}
+	endpoints := []endpoint{
+		{"files", get("/api/files?path=")},
+		{"path-info", get("/api/path-info?path=")},
+		{"download", get("/api/download?path=")},
+		{"preview", get("/api/preview?path=")},
+		{"download-all", get("/api/download-all?path=")},
+		{"manifest", get("/api/manifest?path=")},
+		{"download-zip", postPaths("/api/download-zip")},
+		{"download-estimate", postPaths("/api/download-estimate")},
+		{"archive-jobs", postPaths("/api/archive-jobs")},
+		{"delete", postPaths("/api/delete")},
+		{"upload", func(p string) *http.Response {
+			var buf bytes.Buffer
+			mw := multipart.NewWriter(&buf)
+			_ = mw.WriteField("path", decoded(p))
+			fw, _ := mw.CreateFormFile("files", "x.txt")
+			_, _ = fw.Write([]byte("x"))
+			_ = mw.Close()
+			resp, err := ts.Client().Post(ts.URL+"/api/upload", mw.FormDataContentType(), &buf)
+			if err != nil {
+				t.Fatalf("POST /api/upload failed: %v", err)
+			}
+			return resp
+		}},
+		{"put", func(p string) *http.Response {
+			// Plain "/../" would be cleaned (and redirected) by the router
+			// before reaching the handler; escaped slashes get through.
+			target := ts.URL + "/api/put/" + url.PathEscape(decoded(p))
+			req, _ := http.NewRequest(http.MethodPut, target, strings.NewReader("x"))
+			resp, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatalf("PUT failed: %v", err)
+			}
+			return resp
+		}},
+	}
+
+	attempts := 0
+	for _, ep := range endpoints {
+		for _, p := range payloads {
+			resp := ep.do(p)
+			var body map[string]any
+			_ = json.NewDecoder(resp.Body).Decode(&body)
+			resp.Body.Close()
+			attempts++
+			if resp.StatusCode != http.StatusForbidden || body["code"] != "PATH_FORBIDDEN" {
+				t.Errorf("%s %q: expected 403 PATH_FORBIDDEN, got %d %v", ep.name, p, resp.StatusCode, body)
+			}
+		}
+	}
+
+	if b, _ := os.ReadFile(filepath.Join(parent, "secret.txt")); string(b) != "secret" {
+		t.Fatalf("secret.txt was modified: %q", b)
+	}
+	if _, err := os.Stat(filepath.Join(root, "sub", "a.txt")); err != nil {
+		t.Fatalf("a request with a forbidden path still deleted sub/a.txt: %v", err)
+	}
+	entries, _ := os.ReadDir(parent)
+	if len(entries) != 2 {
+		t.Fatalf("expected nothing written outside the share, got %d entries", len(entries))
+	}
+
+	forbidden := 0
+	for _, e := range s.AccessLog(0) {
+		if e.Event == AccessEventPathForbidden {
+			forbidden++
+			if e.Detail == "" || e.Status != http.StatusForbidden {
+				t.Fatalf("unexpected access log entry: %+v", e)
+			}
+		}
+	}
+	if forbidden != attempts {
+		t.Fatalf("expected %d path_forbidden access log entries, got %d", attempts, forbidden)
+	}
+	if len(probes) != 1 || probes[0] != fmt.Sprintf("127.0.0.1/%d", pathProbeWarnAfter) {
+		t.Fatalf("expected one probe warning, got %v", probes)
+	}
+
+	// Paths that stay inside the share are still served.
+	resp, err := ts.Client().Get(ts.URL + "/api/download?path=" + url.QueryEscape("sub/../sub/a.txt"))
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected in-share path served, got %d", resp.StatusCode)
+	}
+}
+
+func TestShareServerPortRedirect(t *testing.T) {
+	if _, err := getLocalIPv4(); err != nil {
+		t.Skipf("no local IPv4: %v", err)
+	}
+	freePort := func() int {
+		t.Helper()
+		ln, err := net.Listen("tcp", ":0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		defer ln.Close()
+		return ln.Addr().(*net.TCPAddr).Port
+	}
+	busy, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer busy.Close()
+	redirectPort := freePort()
+
+	s := newTestShareServerWithSettings("")
+	// The first candidate is taken, so the second is used.
+	s.redirectPorts = []int{busy.Addr().(*net.TCPAddr).Port, redirectPort}
+	info, err := s.Start(context.Background(), t.TempDir())
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer func() { _ = s.Stop(context.Background()) }()
+	if info.Info.RedirectFrom != 0 {
+		t.Fatalf("redirect listener started while the setting is off: %+v", info.Info)
+	}
+
+	if err := s.SetSetting(SettingKeyPortRedirect, json.RawMessage("true")); err != nil {
+		t.Fatalf("SetSetting failed: %v", err)
+	}
+	got, _ := s.GetServerInfo()
+	if got.RedirectFrom != redirectPort {
+		t.Fatalf("expected redirectFrom %d, got %+v", redirectPort, got)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	check := func(port int) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/api/files?path=a%%20b", redirectPort), nil)
+		// The Host header doesn't choose where the redirect goes.
+		req.Host = "evil.example"
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("GET via redirect port failed: %v", err)
+		}
+		resp.Body.Close()
+		want := fmt.Sprintf("http://%s/api/files?path=a%%20b", net.JoinHostPort(got.LocalIP, strconv.Itoa(port)))
+		if resp.StatusCode != http.StatusMovedPermanently || resp.Header.Get("Location") != want {
+			t.Fatalf("expected 301 to %s, got %d %q", want, resp.StatusCode, resp.Header.Get("Location"))
+		}
+	}
+	check(got.Port)
+
+	// A port change rebinds the redirect listener, now pointing at the new port.
+	newPort := freePort()
+	if _, err := s.ApplyCustomPorts(context.Background(), strconv.Itoa(newPort)); err != nil {
+		t.Fatalf("ApplyCustomPorts failed: %v", err)
+	}
+	if got, _ := s.GetServerInfo(); got.RedirectFrom != redirectPort {
+		t.Fatalf("redirect listener not restored after port change: %+v", got)
+	}
+	check(newPort)
+
+	// With a base path every redirected URL gets it, not just "/".
+	if err := s.SetSetting(SettingKeyBasePath, json.RawMessage(`"/share"`)); err != nil {
+		t.Fatalf("set base path: %v", err)
+	}
+	for uri, want := range map[string]string{
+		"/":                 "/share/",
+		"/c/123456":         "/share/c/123456",
+		"/api/files?path=a": "/share/api/files?path=a",
+		"/share/api/files":  "/share/api/files",
+		"/shared/a.txt":     "/share/shared/a.txt",
+	} {
+		resp, err := client.Get(fmt.Sprintf("http://127.0.0.1:%d%s", redirectPort, uri))
+		if err != nil {
+			t.Fatalf("GET %s via redirect port failed: %v", uri, err)
+		}
+		resp.Body.Close()
+		full := fmt.Sprintf("http://%s%s", net.JoinHostPort(got.LocalIP, strconv.Itoa(newPort)), want)
+		if loc := resp.Header.Get("Location"); loc != full {
+			t.Fatalf("%s: expected redirect to %s, got %q", uri, full, loc)
+		}
+	}
+	_ = s.SetSetting(SettingKeyBasePath, nil)
+
+	if err := s.SetSetting(SettingKeyPortRedirect, nil); err != nil {
+		t.Fatalf("SetSetting failed: %v", err)
+	}
+	if got, _ := s.GetServerInfo(); got.RedirectFrom != 0 {
+		t.Fatalf("redirect listener kept after the setting was removed: %+v", got)
+	}
+	if _, err := client.Get(fmt.Sprintf("http://127.0.0.1:%d/", redirectPort)); err == nil {
+		t.Fatalf("redirect port still answering after the setting was removed")
+	}
+
+	_ = s.SetSetting(SettingKeyPortRedirect, json.RawMessage("true"))
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	if _, err := client.Get(fmt.Sprintf("http://127.0.0.1:%d/", redirectPort)); err == nil {
+		t.Fatalf("redirect port still answering after Stop")
+	}
+}
+
+func TestShareServerRejectsInvalidPaths(t *testing.T) {
+	root := t.TempDir()
+	_ = os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0o644)
+	s := newTestShareServerWithSettings(root)
+	allowDeleteForTest(t, s)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	long := strings.Repeat("a", 256)
+	query := []string{"%00", "a%00.txt", "a%FFb", "a%0Ab", "%7F", long, "dir/" + long, strings.Repeat("d/", 2100)}
+	for _, target := range []string{"/api/files", "/api/path-info", "/api/download", "/api/preview", "/api/download-all", "/api/manifest"} {
+		for _, p := range query {
+			resp, err := ts.Client().Get(ts.URL + target + "?path=" + p)
+			if err != nil {
+				t.Fatalf("GET %s failed: %v", target, err)
+			}
+			var body map[string]any
+			_ = json.NewDecoder(resp.Body).Decode(&body)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest || body["code"] != "INVALID_PATH" {
+				t.Errorf("GET %s?path=%.40s: expected 400 INVALID_PATH, got %d %v", target, p, resp.StatusCode, body)
+			}
+		}
+	}
+
+	for _, target := range []string{"/api/download-zip", "/api/download-estimate", "/api/archive-jobs", "/api/delete"} {
+		for _, p := range []string{"a\x00.txt", "a\u0085b", "x/" + long} {
+			b, _ := json.Marshal(map[string]any{"paths": []string{"a.txt", p}})
+			resp, err := ts.Client().Post(ts.URL+target, "application/json", bytes.NewReader(b))
+			if err != nil {
+				t.Fatalf("POST %s failed: %v", target, err)
+			}
+			var body map[string]any
+			_ = json.NewDecoder(resp.Body).Decode(&body)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest || body["code"] != "INVALID_PATH" {
+				t.Errorf("POST %s %q: expected 400 INVALID_PATH, got %d %v", target, p, resp.StatusCode, body)
+			}
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "a.txt")); err != nil {
+		t.Fatalf("a request with an invalid path still deleted a.txt: %v", err)
+	}
+
+	resp := postUploadForTest(t, ts, long+".txt", []byte("x"))
+	var body map[string]any
+	_ = json.NewDecoder(resp.Body).Decode(&body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest || body["code"] != "INVALID_PATH" {
+		t.Fatalf("expected upload with a 260-byte name rejected, got %d %v", resp.StatusCode, body)
+	}
+
+	// The limit on the whole path is configurable.
+	_ = s.settings.Set(SettingKeyMaxPathBytes, json.RawMessage("256"))
+	resp, err := ts.Client().Get(ts.URL + "/api/files?path=" + strings.Repeat("d/", 200))
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 with a 256-byte limit, got %d", resp.StatusCode)
+	}
+	resp, err = ts.Client().Get(ts.URL + "/api/download?path=" + url.QueryEscape("a.txt"))
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected a valid path served, got %d", resp.StatusCode)
+	}
+}
+
+// FuzzValidatePathSafeJoin checks that whatever passes validatePath and
+// safeJoin is well-formed and stays inside the share.
+func FuzzValidatePathSafeJoin(f *testing.F) {
+	for _, seed := range []string{
+		"", "a.txt", "dir/sub/file", "../x", `..\x`, "a/../../b", "%2e%2e/x",
+		"a\x00b", "a\xffb", "\u202e.txt", "中文/文件.txt", "/abs", "C:\\x", "a//b/./c",
+		strings.Repeat("a", 256),
+	} {
+		f.Add(seed)
+	}
+	root := f.TempDir()
+	f.Fuzz(func(t *testing.T, p string) {
+		if err := validatePath(p, defaultMaxPathBytes); err != nil {
+			return
+		}
+		if !utf8.ValidString(p) || strings.ContainsRune(p, 0) || len(p) > defaultMaxPathBytes {
+			t.Fatalf("validatePath accepted %q", p)
+		}
+		full, ok := safeJoin(root, p)
+		if !ok {
+			return
+		}
+		rel, err := filepath.Rel(root, full)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+			t.Fatalf("safeJoin(%q) escaped the share: %q", p, full)
+		}
+		if strings.ContainsRune(full, 0) || !utf8.ValidString(full) {
+			t.Fatalf("safeJoin(%q) produced a malformed path %q", p, full)
+		}
+		if strings.Contains(p, `\`) {
+			if _, ok := safeJoin(root, strings.ReplaceAll(p, `\`, "/")); !ok {
+				t.Fatalf("safeJoin(%q) accepted a path that escapes with \\ as separator", p)
+			}
+		}
+	})
+}
+
+func TestShareServerSettingsBatch(t *testing.T) {
+	s := newTestShareServerWithSettings(t.TempDir())
+	_ = s.settings.Set("local-share:a", json.RawMessage(`1`))
+	_ = s.settings.Set("local-share:b", json.RawMessage(`"x"`))
+	_ = s.settings.Set(SettingKeyAdminPass, json.RawMessage(`"secret-pass"`))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	do := func(method, target, body string) (int, map[string]json.RawMessage) {
+		t.Helper()
+		req, _ := http.NewRequest(method, ts.URL+target, strings.NewReader(body))
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, target, err)
+		}
+		defer resp.Body.Close()
+		var out map[string]json.RawMessage
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+
+	code, body := do(http.MethodGet, "/api/settings?keys="+url.QueryEscape("local-share:a, local-share:b,local-share:missing,"+SettingKeyAdminPass+",bad/key"), "")
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %v", code, body)
+	}
+	if got := string(body["values"]); got != `{"local-share:a":1,"local-share:b":"x"}` {
+		t.Fatalf("unexpected values %s", got)
+	}
+	if code, _ := do(http.MethodGet, "/api/settings", ""); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without keys, got %d", code)
+	}
+
+	// One bad key doesn't stop the others.
+	code, body = do(http.MethodPut, "/api/settings", `{"values":{
+		"local-share:a": 2,
+		"local-share:b": null,
+		"local-share:c": {"x": true},
+		"bad\\key": 1,
+		"`+SettingKeyAdminPass+`": "changed-pass"
+	}}`)
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %v", code, body)
+	}
+	if string(body["ok"]) != "false" {
+		t.Fatalf("expected ok=false with failures, got %s", body["ok"])
+	}
+	var results map[string]settingsBatchResult
+	_ = json.Unmarshal(body["results"], &results)
+	want := map[string]string{
+		"local-share:a":     "",
+		"local-share:b":     "",
+		"local-share:c":     "",
+		`bad\key`:           "SETTING_INVALID_KEY",
+		SettingKeyAdminPass: "SETTING_NOT_FOUND",
+	}
+	if len(results) != len(want) {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	for key, code := range want {
+		if r := results[key]; r.OK != (code == "") || r.Code != code {
+			t.Fatalf("%s: expected code %q, got %+v", key, code, r)
+		}
+	}
+	for key, want := range map[string]string{"local-share:a": "2", "local-share:c": `{"x": true}`, SettingKeyAdminPass: `"secret-pass"`} {
+		if raw, _, _ := s.settings.Get(key); string(raw) != want {
+			t.Fatalf("%s: expected %s, got %s", key, want, raw)
+		}
+	}
+	if _, ok, _ := s.settings.Get("local-share:b"); ok {
+		t.Fatalf("null should delete local-share:b")
+	}
+
+	if code, _ := do(http.MethodPut, "/api/settings", `{"values":{}}`); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an empty batch, got %d", code)
+	}
+	if code, _ := do(http.MethodPut, "/api/settings", `{"values":{"local-share:a":}}`); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for malformed json, got %d", code)
+	}
+
+	// Batch routes need the access pass like the single-key ones.
+	pass, _ := json.Marshal("p1")
+	_ = s.settings.Set(SettingKeyAccessPass, pass)
+	if code, _ := do(http.MethodGet, "/api/settings?keys=local-share:a", ""); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %d", code)
+	}
+}
+
+func TestShareServerTempDir(t *testing.T) {
+	s := newTestShareServerWithSettings(t.TempDir())
+	if got := s.TempDir(); got != os.TempDir() {
+		t.Fatalf("default TempDir = %q, want %q", got, os.TempDir())
+	}
+	dir := t.TempDir()
+	raw, _ := json.Marshal(dir)
+	if err := s.SetSetting(SettingKeyTempDir, raw); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.TempDir(); got != dir {
+		t.Fatalf("TempDir = %q, want %q", got, dir)
+	}
+	if got, want := s.archiveSpoolDir(), filepath.Join(dir, "local-share-archives"); got != want {
+		t.Fatalf("archive spool dir = %q, want %q", got, want)
+	}
+
+	// Resolved per call: a directory that went away falls back.
+	if err := os.Remove(dir); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.TempDir(); got != os.TempDir() {
+		t.Fatalf("TempDir after removal = %q, want %q", got, os.TempDir())
+	}
+
+	// Desktop-only.
+	req := httptest.NewRequest(http.MethodGet, "/api/settings/"+SettingKeyTempDir, nil)
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("GET temp dir from web = %d, want 404", rec.Code)
+	}
+}
+
+func TestShareServerZipSkipsChangedFiles(t *testing.T) {
+	tmp := t.TempDir()
+	os.MkdirAll(filepath.Join(tmp, "d"), 0o755)
+	os.WriteFile(filepath.Join(tmp, "d", "a.txt"), []byte("aaa"), 0o644)
+	os.WriteFile(filepath.Join(tmp, "d", "b.txt"), []byte("bbb"), 0o644)
+
+	// Someone keeps writing to a.txt while it is being zipped.
+	grow := 0
+	touch := func(c zipCandidate) {
+		if c.zipEntry == "d/a.txt" {
+			grow++
+			os.WriteFile(c.fullPath, []byte(strings.Repeat("a", 3+grow)), 0o644)
+		}
+	}
+	s := newTestShareServerWithSettings(tmp)
+	s.zipStatHook = touch
+	post := func(req map[string]any) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(req)
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/download-zip", bytes.NewReader(body)))
+		return rec
+	}
+
+	rec := post(map[string]any{"paths": []string{"d"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", rec.Code, rec.Body.String())
+	}
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatalf("zip reader failed: %v", err)
+	}
+	var names []string
+	var warnings string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		if f.Name == zipWarningsEntry {
+			rc, _ := f.Open()
+			b, _ := io.ReadAll(rc)
+			rc.Close()
+			warnings = string(b)
+		}
+	}
+	// The warnings come last.
+	if strings.Join(names, ",") != "d/b.txt,"+zipWarningsEntry {
+		t.Fatalf("entries = %v", names)
+	}
+	if !strings.Contains(warnings, "d/a.txt") || strings.Contains(warnings, "d/b.txt") {
+		t.Fatalf("warnings = %q", warnings)
+	}
+
+	// Strict: refused before the first byte of the zip.
+	rec = post(map[string]any{"paths": []string{"d"}, "strict": true})
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("strict: expected 409, got %d", rec.Code)
+	}
+	var resp struct {
+		Code  string   `json:"code"`
+		Files []string `json:"files"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Code != "ZIP_FILES_CHANGED" || strings.Join(resp.Files, ",") != "d/a.txt" {
+		t.Fatalf("strict: body = %s", rec.Body.String())
+	}
+
+	// Store promises a length: a change aborts rather than skips.
+	var buf bytes.Buffer
+	candidates, err := s.collectZipCandidates(tmp, []string{"d"}, zipFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeZip(context.Background(), &buf, candidates, false, true, false, nil, touch); !errors.Is(err, errZipFileChanged) {
+		t.Fatalf("store: err = %v, want errZipFileChanged", err)
+	}
+
+	// Unchanged files zip as before.
+	s.zipStatHook = nil
+	if rec := post(map[string]any{"paths": []string{"d"}, "strict": true}); rec.Code != http.StatusOK {
+		t.Fatalf("strict without changes: expected 200, got %d", rec.Code)
+	}
+}
+
+func TestPreviewContentTypes(t *testing.T) {
+	tests := []struct {
+		name        string
+		size        int64
+		supported   bool
+		kind        string
+		contentType string
+	}{
+		{"a.PNG", 1, true, "image", "image/png"},
+		{"photo.heic", 1, true, "image", "image/heic"},
+		{"photo.HEIF", 1, true, "image", "image/heif"},
+		{"pic.webp", 1, true, "image", "image/webp"},
+		{"pic.avif", 1, true, "image", "image/avif"},
+		{"notes.md", 1, true, "text", "text/markdown; charset=utf-8"},
+		{"book.pdf", 20 << 20, true, "pdf", "application/pdf"},
+		{"huge.pdf", maxPDFPreviewBytes + 1, false, "unsupported", "application/pdf"},
+		{"book.epub", 1, false, "unsupported", "application/epub+zip"},
+		{"report.docx", 1, false, "unsupported", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{"sheet.xlsx", 1, false, "unsupported", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+		{"slides.ppt", 1, false, "unsupported", "application/vnd.ms-powerpoint"},
+		{"big.png", maxPreviewBytes + 1, false, "unsupported", "image/png"},
+		{"page.wasm", 1, false, "unsupported", "application/wasm"}, // from the mime package
+		{"blob.unknownext", 1, false, "unsupported", "application/octet-stream"},
+		{"noext", 1, false, "unsupported", "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		p := classifyPreview(tt.name, tt.size)
+		if p.Supported != tt.supported || p.Kind != tt.kind || p.ContentType != tt.contentType {
+			t.Errorf("classifyPreview(%q, %d) = %+v, want supported=%v kind=%s type=%s", tt.name, tt.size, *p, tt.supported, tt.kind, tt.contentType)
+		}
+	}
+
+	// PDFs open in the browser's viewer; downloads carry the real type.
+	tmp := t.TempDir()
+	os.WriteFile(filepath.Join(tmp, "book.pdf"), []byte("%PDF-1.4\n"), 0o644)
+	os.WriteFile(filepath.Join(tmp, "book.epub"), []byte("PK"), 0o644)
+	s := newTestShareServerWithSettings(tmp)
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+	rec := get("/api/preview?path=book.pdf")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/pdf" || !strings.HasPrefix(rec.Header().Get("Content-Disposition"), "inline;") {
+		t.Fatalf("preview pdf: %d %q %q", rec.Code, rec.Header().Get("Content-Type"), rec.Header().Get("Content-Disposition"))
+	}
+	rec = get("/api/download?path=book.epub")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/epub+zip" || !strings.HasPrefix(rec.Header().Get("Content-Disposition"), "attachment;") {
+		t.Fatalf("download epub: %d %q %q", rec.Code, rec.Header().Get("Content-Type"), rec.Header().Get("Content-Disposition"))
+	}
+}
+
+func TestShareServerServeFailure(t *testing.T) {
+	if _, err := getLocalIPv4(); err != nil {
+		t.Skipf("no local IPv4: %v", err)
+	}
+	root := t.TempDir()
+	type failure struct {
+		root       string
+		err        error
+		restarting bool
+	}
+	failed := make(chan failure, 2)
+	restarted := make(chan int, 1)
+	s := New(Options{
+		Settings: NewMemorySettings(),
+		OnShareFailed: func(root string, err error, restarting bool) {
+			failed <- failure{root, err, restarting}
+		},
+		OnShareRestarted: func(root string, attempt int) {
+			restarted <- attempt
+		},
+	})
+	s.restartBackoff = 10 * time.Millisecond
+	if _, err := s.Start(context.Background(), root); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer func() { _ = s.Stop(context.Background()) }()
+
+	closeListener := func() {
+		s.mu.RLock()
+		ln := s.listener
+		s.mu.RUnlock()
+		_ = ln.Close()
+	}
+	closeListener()
+	select {
+	case f := <-failed:
+		if f.root != root || f.err == nil || f.restarting {
+			t.Fatalf("unexpected failure %+v", f)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected share to fail after its listener was closed")
+	}
+	if info, _ := s.GetServerInfo(); info != nil || s.IsRunning() {
+		t.Fatalf("expected server stopped, got %+v", info)
+	}
+
+	// With auto-restart on, the same folder is shared again.
+	if err := s.SetSetting(SettingKeyAutoRestart, json.RawMessage(`true`)); err != nil {
+		t.Fatalf("set auto-restart: %v", err)
+	}
+	if _, err := s.Start(context.Background(), root); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	closeListener()
+	select {
+	case f := <-failed:
+		if !f.restarting {
+			t.Fatalf("expected restart, got %+v", f)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected share to fail after its listener was closed")
+	}
+	select {
+	case attempt := <-restarted:
+		if attempt != 1 {
+			t.Fatalf("expected first attempt to work, got %d", attempt)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected share to be restarted")
+	}
+	info, _ := s.GetServerInfo()
+	if info == nil || info.SharedFolder != root {
+		t.Fatalf("expected %q shared again, got %+v", root, info)
+	}
+}
+
+func TestShareServerHiddenRulesDotfiles(t *testing.T) {
+	tmp := t.TempDir()
+	_ = os.WriteFile(filepath.Join(tmp, ".env"), []byte("x"), 0o644)
+	_ = os.WriteFile(filepath.Join(tmp, "a.txt"), []byte("a"), 0o644)
+	s := newTestShareServerWithSettings(tmp)
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+
+	hidden := func() map[string]bool {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/files", nil))
+		var resp filesResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		out := map[string]bool{}
+		for _, it := range resp.Items {
+			out[it.Name] = it.Hidden
+		}
+		return out
+	}
+
+	if got := hidden(); !got[".env"] || got["a.txt"] {
+		t.Fatalf("expected only .env hidden by default, got %v", got)
+	}
+	if err := s.SetSetting(SettingKeyHiddenRules, json.RawMessage(`{"dotfiles":false}`)); err != nil {
+		t.Fatalf("set hidden rules: %v", err)
+	}
+	if got := hidden(); got[".env"] {
+		t.Fatalf("expected .env visible with dotfiles off, got %v", got)
+	}
+	if items, err := s.ListDirectory(""); err != nil || len(items) != 2 || items[0].Hidden || items[1].Hidden {
+		t.Fatalf("expected ListDirectory to agree, got %+v err=%v", items, err)
+	}
+	if err := s.SetSetting(SettingKeyHiddenRules, json.RawMessage(`["dotfiles"]`)); err == nil {
+		t.Fatalf("expected invalid hidden rules to be rejected")
+	}
+}
+
+func TestShareServerUploadProgress(t *testing.T) {
+	tmp := t.TempDir()
+	s := newTestShareServerWithSettings(tmp)
+	var mu sync.Mutex
+	var phases []string
+	var eventIPs []string
+	s.uploadProgress.onChange = func(ip string, info uploadProgressInfo) {
+		mu.Lock()
+		defer mu.Unlock()
+		eventIPs = append(eventIPs, ip)
+		if len(phases) == 0 || phases[len(phases)-1] != info.Phase {
+			phases = append(phases, info.Phase)
+		}
+	}
+	now := time.Now()
+	s.uploadProgress.now = func() time.Time { return now }
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	content := bytes.Repeat([]byte("x"), 100<<10)
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fw, _ := mw.CreateFormFile("files", "big.bin")
+	_, _ = fw.Write(content)
+	_ = mw.Close()
+	bodyLen := int64(buf.Len())
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/api/upload", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set(headerUploadID, "up-1")
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("POST /api/upload failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	getProgress := func(id string) (int, uploadProgressInfo) {
+		t.Helper()
+		resp, err := ts.Client().Get(ts.URL + "/api/upload-progress?id=" + id)
+		if err != nil {
+			t.Fatalf("GET /api/upload-progress failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var info uploadProgressInfo
+		_ = json.NewDecoder(resp.Body).Decode(&info)
+		return resp.StatusCode, info
+	}
+	code, info := getProgress("up-1")
+	if code != http.StatusOK || info.Phase != UploadPhaseDone {
+		t.Fatalf("expected done, got %d %+v", code, info)
+	}
+	if info.ReceivedBytes != bodyLen || info.TotalBytes != bodyLen {
+		t.Fatalf("expected %d bytes received, got %+v", bodyLen, info)
+	}
+	if info.WrittenBytes != int64(len(content)) || info.WriteTotalBytes != int64(len(content)) {
+		t.Fatalf("expected %d bytes written, got %+v", len(content), info)
+	}
+	mu.Lock()
+	got := strings.Join(phases, ",")
+	mu.Unlock()
+	if got != "receiving,writing,finishing,done" {
+		t.Fatalf("unexpected phases %s", got)
+	}
+	mu.Lock()
+	for _, ip := range eventIPs {
+		if ip != "127.0.0.1" {
+			t.Fatalf("progress event addressed to %q, not the uploader", ip)
+		}
+	}
+	mu.Unlock()
+
+	if code, _ := getProgress("nope"); code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown upload, got %d", code)
+	}
+	// Finished uploads are dropped after a while.
+	now = now.Add(uploadProgressTTL + time.Second)
+	if code, _ := getProgress("up-1"); code != http.StatusNotFound {
+		t.Fatalf("expected stale progress to be collected, got %d", code)
+	}
+}
+
+func TestZipIgnoreMatching(t *testing.T) {
+	ignore := []string{"node_modules", "/frontend/dist/", "web/build", ".git"}
+	cases := []struct {
+		entry     string
+		sensitive bool // ignored with exact case
+		folded    bool // ignored on Windows
+	}{
+		{"node_modules", true, true},
+		{"Node_Modules", false, true},
+		{"a/b/node_modules/x.js", true, true},
+		{"a/NODE_MODULES/x.js", false, true},
+		{"frontend/dist", true, true},
+		{"frontend/dist/app.js", true, true},
+		{"Frontend/Dist/app.js", false, true},
+		{"frontend/distribution/app.js", false, false},
+		{"web/build/index.html", true, true},
+		{"WEB/Build", false, true},
+		{"other/frontend/dist/app.js", false, false},
+		{"/frontend/dist/../dist/app.js", true, true},
+		{".GIT/config", false, true},
+		{"src/main.go", false, false},
+		{"", false, false},
+	}
+	for _, fold := range []bool{false, true} {
+		z := newZipIgnoreFold(ignore, fold)
+		for _, tc := range cases {
+			want := tc.sensitive
+			if fold {
+				want = tc.folded
+			}
+			if got := z.entry(tc.entry); got != want {
+				t.Fatalf("foldCase=%v entry %q: got %v, want %v", fold, tc.entry, got, want)
+			}
+		}
+	}
+	names := newZipIgnoreFold([]string{"Thumbs.db", "a/b"}, true)
+	if !names.name("thumbs.DB") || names.name("b") || names.name("") {
+		t.Fatal("name matching should fold case and ignore prefix entries")
+	}
+	if newZipIgnoreFold([]string{"Thumbs.db"}, false).name("thumbs.db") {
+		t.Fatal("name matching should be exact without foldCase")
+	}
+}
+
+func TestShareServerZipIgnoresSelectionInsidePrefix(t *testing.T) {
+	root := t.TempDir()
+	pkg := filepath.Join(root, "frontend", "node_modules", "pkg")
+	if err := os.MkdirAll(pkg, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(pkg, "index.js"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "frontend", "main.js"), []byte("y"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := newTestShareServerWithSettings(root)
+
+	filter := zipFilter{ignore: []string{"frontend/node_modules"}}
+	if _, err := s.collectZipCandidates(root, []string{"frontend/node_modules/pkg"}, filter); err == nil {
+		t.Fatal("a selection inside an ignored prefix should be empty")
+	}
+	got, err := s.collectZipCandidates(root, []string{"frontend"}, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].zipEntry != "frontend/main.js" {
+		t.Fatalf("unexpected candidates %+v", got)
+	}
+}
+
+func TestShareServerReadOnlyMode(t *testing.T) {
+	tmp := t.TempDir()
+	s := newTestShareServerWithSettings(tmp)
+	allowDeleteForTest(t, s)
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	if err := s.SetSetting(SettingKeyReadOnly, json.RawMessage(`true`)); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Permissions(); got != (Permissions{Read: true}) {
+		t.Fatalf("read-only should win over the granular settings, got %+v", got)
+	}
+	if got := s.getPermissionSettings(); !got.Write || !got.Delete {
+		t.Fatalf("granular settings should be kept, got %+v", got)
+	}
+	events, _, _, _ := s.events.changesSince(0)
+	if len(events) == 0 || events[len(events)-1].Event != "permissionsChanged" || string(events[len(events)-1].Data) != `{"readOnly":true}` {
+		t.Fatalf("expected a permissionsChanged event, got %+v", events)
+	}
+
+	resp, err := ts.Client().Get(ts.URL + "/api/session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sess sessionResponse
+	_ = json.NewDecoder(resp.Body).Decode(&sess)
+	resp.Body.Close()
+	if !sess.ReadOnly || sess.Permissions.Write || sess.Permissions.Delete || !sess.Permissions.Read {
+		t.Fatalf("unexpected session %+v", sess)
+	}
+
+	up := postUploadForTest(t, ts, "a.txt", []byte("x"))
+	up.Body.Close()
+	if up.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for uploads while read-only, got %d", up.StatusCode)
+	}
+	req, _ := http.NewRequest(http.MethodPut, ts.URL+"/api/settings/"+SettingKeyReadOnly, strings.NewReader(`{"value":false}`))
+	put, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	put.Body.Close()
+	if put.StatusCode != http.StatusNotFound || !s.ReadOnly() {
+		t.Fatalf("web clients must not turn read-only off, got %d", put.StatusCode)
+	}
+
+	if err := s.SetSetting(SettingKeyReadOnly, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Permissions(); !got.Write || !got.Delete {
+		t.Fatalf("granular settings should apply again, got %+v", got)
+	}
+}
+
+func TestSSEHubDisconnectsStalledClient(t *testing.T) {
+	h := newSSEHub()
+	h.maxDrops = 3
+	now := time.Unix(1_700_000_000, 0)
+	h.now = func() time.Time { return now }
+
+	// Nobody reads this client: it stands for a phone that went to sleep.
+	stalled := &sseClient{ch: make(chan []byte, 2), ip: "10.0.0.2"}
+	live := &sseClient{ch: make(chan []byte, 2), ip: "10.0.0.3"}
+	for _, c := range []*sseClient{stalled, live} {
+		if _, ok := h.addClient(c, 0, 0, ""); !ok {
+			t.Fatal("addClient failed")
+		}
+	}
+	for i := 0; i < 10; i++ {
+		h.broadcast("dirsChanged", map[string]int{"n": i})
+		// The live client drains its buffer between broadcasts.
+		for len(live.ch) > 0 {
+			<-live.ch
+			live.reads.Add(1)
+		}
+	}
+
+	n := 0
+	for range stalled.ch {
+		n++
+	}
+	if n > 2 {
+		t.Fatalf("stalled client got %d buffered messages", n)
+	}
+	if live.kicked {
+		t.Fatal("a client that keeps up must not be disconnected")
+	}
+	m := h.metrics()
+	if m.Disconnects != 1 || m.Drops == 0 {
+		t.Fatalf("unexpected metrics %+v", m)
+	}
+	// Later broadcasts skip the closed client instead of panicking.
+	h.broadcast("dirsChanged", map[string]int{"n": 10})
+	h.removeClient(stalled)
+	if h.count() != 1 {
+		t.Fatalf("expected the live client only, got %d", h.count())
+	}
+
+	// Before maxDrops is reached, a buffer that stays full for stallTimeout
+	// is enough.
+	slow := &sseClient{ch: make(chan []byte, 1), ip: "10.0.0.4"}
+	h.addClient(slow, 0, 0, "")
+	h.broadcast("a", 1)
+	h.broadcast("b", 2)
+	now = now.Add(h.stallTimeout)
+	h.broadcast("c", 3)
+	if !slow.kicked {
+		t.Fatal("expected the slow client to be disconnected after stallTimeout")
+	}
+	if got := h.metrics().Disconnects; got != 2 {
+		t.Fatalf("expected 2 disconnects, got %d", got)
+	}
+}
+
+func TestSSEHubSendVolatileTo(t *testing.T) {
+	h := newSSEHub()
+	mine := &sseClient{ch: make(chan []byte, 2), ip: "10.0.0.2"}
+	other := &sseClient{ch: make(chan []byte, 2), ip: "10.0.0.3"}
+	for _, c := range []*sseClient{mine, other} {
+		h.addClient(c, 0, 0, "")
+	}
+	h.sendVolatileTo("10.0.0.2", "archiveJob", map[string]string{"id": "x"})
+	h.sendVolatileTo("", "archiveJob", map[string]string{"id": "y"})
+	if len(mine.ch) != 1 || len(other.ch) != 0 {
+		t.Fatalf("expected one event for 10.0.0.2 only, got %d and %d", len(mine.ch), len(other.ch))
+	}
+	if got := string(<-mine.ch); !strings.Contains(got, `"id":"x"`) {
+		t.Fatalf("unexpected event %q", got)
+	}
+	if len(h.history.events) != 0 {
+		t.Fatalf("targeted events must not be kept for replay")
+	}
+}
+
+func TestArchiveJobsFailedJobFreesSlot(t *testing.T) {
+	a := newArchiveJobs()
+	var owners []string
+	var mu sync.Mutex
+	a.onChange = func(owner string, info archiveJobInfo) {
+		mu.Lock()
+		owners = append(owners, owner)
+		mu.Unlock()
+	}
+	dir := t.TempDir()
+	missing := []zipCandidate{{fullPath: filepath.Join(dir, "missing"), zipEntry: "missing", size: 1}}
+	for i := 0; i < maxArchiveJobs; i++ {
+		info, err := a.start("10.0.0.2", dir, 1<<30, "x.zip", missing, false, false)
+		if err != nil {
+			t.Fatalf("job %d: %v", i, err)
+		}
+		a.mu.Lock()
+		done := a.jobs[info.ID].done
+		a.mu.Unlock()
+		<-done
+		if got, _, _ := a.get(info.ID, "10.0.0.2"); got.State != ArchiveJobFailed {
+			t.Fatalf("expected a failed job, got %+v", got)
+		}
+		if _, _, ok := a.get(info.ID, "10.0.0.3"); ok {
+			t.Fatalf("another client sees the job")
+		}
+	}
+	if _, err := a.start("10.0.0.2", dir, 1<<30, "x.zip", missing, false, false); err != nil {
+		t.Fatalf("failed jobs still hold the slots: %v", err)
+	}
+	a.closeAll()
+	mu.Lock()
+	defer mu.Unlock()
+	for _, o := range owners {
+		if o != "10.0.0.2" {
+			t.Fatalf("event went to %q", o)
+		}
+	}
+}
+
+func TestShareServerAuthChallenge(t *testing.T) {
+	s := newTestShareServerWithSettings(t.TempDir())
+	if err := s.SetAccessPass("abc123"); err != nil {
+		t.Fatal(err)
+	}
+	for key, v := range map[string]string{
+		SettingKeyAuthChallenge:           "true",
+		SettingKeyAuthChallengeThreshold:  "1",
+		SettingKeyAuthChallengeDifficulty: "8",
+	} {
+		if err := s.SetSetting(key, json.RawMessage(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	type authResp struct {
+		Token     string        `json:"token"`
+		Code      string        `json:"code"`
+		Challenge authChallenge `json:"challenge"`
+	}
+	post := func(body any) (int, authResp) {
+		t.Helper()
+		b, _ := json.Marshal(body)
+		resp, err := ts.Client().Post(ts.URL+"/api/auth", "application/json", bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var out authResp
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+	solve := func(ch authChallenge) string {
+		for i := 0; ; i++ {
+			nonce := strconv.Itoa(i)
+			if leadingZeroBits(sha256.Sum256([]byte(ch.Prefix+":"+nonce))) >= ch.Difficulty {
+				return nonce
+			}
+		}
+	}
+
+	// Below the threshold passes are checked directly.
+	if code, _ := post(map[string]string{"pass": "wrong1"}); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", code)
+	}
+	if code, _ := post(map[string]string{"pass": "wrong2"}); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", code)
+	}
+	// The empty probe is never challenged.
+	if code, out := post(map[string]string{"pass": ""}); code != http.StatusUnauthorized || out.Code != "AUTH_REQUIRED" {
+		t.Fatalf("expected AUTH_REQUIRED for the probe, got %d %+v", code, out)
+	}
+
+	code, first := post(map[string]string{"pass": "abc123"})
+	if code != http.StatusPreconditionRequired || first.Code != "AUTH_CHALLENGE" || first.Challenge.Prefix == "" || first.Challenge.Difficulty != 8 {
+		t.Fatalf("expected a challenge, got %d %+v", code, first)
+	}
+	_, second := post(map[string]string{"pass": "abc123"})
+	// The per-IP limit (5 per window) is used up now.
+	if code, _ := post(map[string]string{"pass": "abc123"}); code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 for unsolved attempts, got %d", code)
+	}
+
+	// A wrong nonce is rejected and uses up the prefix.
+	bad := authChallengeSolution{Prefix: second.Challenge.Prefix, Nonce: "x"}
+	for leadingZeroBits(sha256.Sum256([]byte(bad.Prefix+":"+bad.Nonce))) >= 8 {
+		bad.Nonce += "x"
+	}
+	if code, _ := post(map[string]any{"pass": "abc123", "challenge": bad}); code != http.StatusTooManyRequests {
+		t.Fatalf("expected an unsolved attempt to hit the limiter, got %d", code)
+	}
+
+	// A solved challenge skips the limiter.
+	sol := authChallengeSolution{Prefix: first.Challenge.Prefix, Nonce: solve(first.Challenge)}
+	code, ok := post(map[string]any{"pass": "abc123", "challenge": sol})
+	if code != http.StatusOK || ok.Token == "" {
+		t.Fatalf("expected a token for a solved challenge, got %d %+v", code, ok)
+	}
+	// Replaying the same solution doesn't work.
+	if code, _ := post(map[string]any{"pass": "abc123", "challenge": sol}); code == http.StatusOK {
+		t.Fatal("a solution must not be accepted twice")
+	}
+	// The prefix of the wrong attempt is used up, even for the right nonce.
+	if s.authChallenges.verify(&authChallengeSolution{Prefix: second.Challenge.Prefix, Nonce: solve(second.Challenge)}) {
+		t.Fatal("a prefix must be usable only once")
+	}
+}
+
+func TestFileCategory(t *testing.T) {
+	cases := []struct {
+		name        string
+		category    string
+		previewable bool
+	}{
+		{"backup.tar.gz", FileCategoryArchive, false},
+		{"release.TGZ", FileCategoryArchive, false},
+		{"photo.JPEG", FileCategoryImage, true},
+		{"IMG_0001.heic", FileCategoryImage, true},
+		{"Makefile", FileCategoryOther, false},
+		{".bashrc", FileCategoryOther, false},
+		{"notes.md", FileCategoryText, true},
+		{"report.pdf", FileCategoryDocument, true},
+		{"slides.pptx", FileCategoryDocument, false},
+		{"clip.mp4", FileCategoryVideo, false},
+		{"song.flac", FileCategoryAudio, false},
+	}
+	for _, tc := range cases {
+		if got := fileCategory(tc.name); got != tc.category {
+			t.Errorf("fileCategory(%q) = %q, want %q", tc.name, got, tc.category)
+		}
+		if got := classifyPreview(tc.name, 10).Supported; got != tc.previewable {
+			t.Errorf("classifyPreview(%q).Supported = %v, want %v", tc.name, got, tc.previewable)
+		}
+	}
+	for _, tc := range cases {
+		found := false
+		for _, c := range FileCategories {
+			found = found || c == tc.category
+		}
+		if !found {
+			t.Errorf("category %q missing from FileCategories", tc.category)
+		}
+	}
+}
+
+func TestShareServerDownloadToken(t *testing.T) {
+	tmp := t.TempDir()
+	file := filepath.Join(tmp, "big.bin")
+	_ = os.WriteFile(file, []byte("0123456789"), 0o644)
+
+	s := newTestShareServerWithSettings(tmp)
+	_ = s.settings.Set(SettingKeyAccessPass, json.RawMessage(`"abc123"`))
+	now := time.Now()
+	s.downloadTokens.now = func() time.Time { return now }
+	session, _, err := s.auth.issue("127.0.0.1", accessPassHash("abc123"))
+	if err != nil {
+		t.Fatalf("issue token: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	resp, err := ts.Client().Get(ts.URL + "/api/download?path=big.bin&downloadToken=1&" + queryShareToken + "=" + url.QueryEscape(session))
+	if err != nil {
+		t.Fatalf("GET token: %v", err)
+	}
+	var tok downloadTokenResponse
+	_ = json.NewDecoder(resp.Body).Decode(&tok)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || tok.DownloadToken == "" || !strings.Contains(tok.URL, "dl=") {
+		t.Fatalf("token response = %d %+v", resp.StatusCode, tok)
+	}
+
+	// Resumes with Range and no session at all.
+	get := func(u string) (*http.Response, string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+u, nil)
+		req.Header.Set("Range", "bytes=4-")
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("GET %s: %v", u, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+	if resp, body := get(tok.URL); resp.StatusCode != http.StatusPartialContent || body != "456789" {
+		t.Fatalf("resume = %d %q", resp.StatusCode, body)
+	}
+
+	// Bound to the path.
+	other := strings.Replace(tok.URL, "path=big.bin", "path=other.bin", 1)
+	if resp, _ := get(other); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("other path status = %d, want 401", resp.StatusCode)
+	}
+
+	// A new mtime invalidates it.
+	later := time.Now().Add(time.Minute)
+	_ = os.Chtimes(file, later, later)
+	if resp, body := get(tok.URL); resp.StatusCode != http.StatusPreconditionFailed || !strings.Contains(body, "DOWNLOAD_TOKEN_STALE") {
+		t.Fatalf("after mtime change = %d %s", resp.StatusCode, body)
+	}
+
+	// Expiry.
+	st, _ := os.Stat(file)
+	fresh := s.downloadTokens.issue("big.bin", st, tmp, accessPassHash("abc123"))
+	now = now.Add(downloadTokenTTL)
+	if resp, body := get("/api/download?path=big.bin&dl=" + url.QueryEscape(fresh)); resp.StatusCode != http.StatusUnauthorized || !strings.Contains(body, "DOWNLOAD_TOKEN_EXPIRED") {
+		t.Fatalf("expired = %d %s", resp.StatusCode, body)
+	}
+
+	// A restart rotates the key.
+	now = time.Now()
+	fresh = s.downloadTokens.issue("big.bin", st, tmp, accessPassHash("abc123"))
+	s.downloadTokens.rotate()
+	if resp, body := get("/api/download?path=big.bin&dl=" + url.QueryEscape(fresh)); resp.StatusCode != http.StatusUnauthorized || !strings.Contains(body, "DOWNLOAD_TOKEN_INVALID") {
+		t.Fatalf("after rotate = %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestRootRelation(t *testing.T) {
+	p := func(s string) string { return filepath.FromSlash(s) }
+	cases := []struct {
+		existing, requested string
+		fold                bool
+		want                string
+	}{
+		{"/data/projects", "/data/projects", false, RootOverlapSame},
+		{"/data/projects", "/data/projects/", false, RootOverlapSame},
+		{"/data/projects", "/data/projects/secret", false, RootOverlapInside},
+		{"/data/projects/secret", "/data/projects", false, RootOverlapContains},
+		{"/data/projects", "/data/projects-old", false, ""},
+		{"/data/projects", "/data/photos", false, ""},
+		{"/data/..projects", "/data", false, RootOverlapContains},
+		// Case only matters on case-sensitive file systems.
+		{"/data/Projects", "/data/projects", false, ""},
+		{"/data/Projects", "/data/projects", true, RootOverlapSame},
+		{"/data/Projects", "/data/projects/Secret", false, ""},
+		{"/data/Projects", "/data/projects/Secret", true, RootOverlapInside},
+		{"/DATA/projects/secret", "/data", true, RootOverlapContains},
+	}
+	for _, tc := range cases {
+		if got := rootRelation(p(tc.existing), p(tc.requested), tc.fold); got != tc.want {
+			t.Errorf("rootRelation(%q, %q, %v) = %q, want %q", tc.existing, tc.requested, tc.fold, got, tc.want)
+		}
+	}
+}
+
+func TestShareServerStartReportsRootOverlap(t *testing.T) {
+	if _, err := getLocalIPv4(); err != nil {
+		t.Skipf("no local IPv4: %v", err)
+	}
+	tmp := t.TempDir()
+	inner := filepath.Join(tmp, "secret")
+	other := t.TempDir()
+	_ = os.MkdirAll(inner, 0o755)
+
+	s := newTestShareServerWithSettings("")
+	res, err := s.Start(context.Background(), tmp)
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer func() { _ = s.Stop(context.Background()) }()
+	if res.Overlap != nil {
+		t.Fatalf("first start overlap = %+v", res.Overlap)
+	}
+
+	res, err = s.Start(context.Background(), inner)
+	if err != nil {
+		t.Fatalf("Start inner failed: %v", err)
+	}
+	if res.Overlap == nil || res.Overlap.Relation != RootOverlapInside || res.Overlap.Previous != tmp {
+		t.Fatalf("inner overlap = %+v", res.Overlap)
+	}
+	if !slices.Contains(res.Warnings, WarningRootOverlap) {
+		t.Fatalf("inner warnings = %v", res.Warnings)
+	}
+
+	res, err = s.Start(context.Background(), inner)
+	if err != nil {
+		t.Fatalf("Start same failed: %v", err)
+	}
+	if res.Overlap == nil || res.Overlap.Relation != RootOverlapSame || slices.Contains(res.Warnings, WarningRootOverlap) {
+		t.Fatalf("same overlap = %+v, warnings %v", res.Overlap, res.Warnings)
+	}
+
+	res, err = s.Start(context.Background(), other)
+	if err != nil {
+		t.Fatalf("Start other failed: %v", err)
+	}
+	if res.Overlap != nil || slices.Contains(res.Warnings, WarningRootOverlap) {
+		t.Fatalf("disjoint overlap = %+v, warnings %v", res.Overlap, res.Warnings)
+	}
+}
+
+func TestScoreIPv4(t *testing.T) {
+	score := func(name, ip string, p2p bool) int {
+		return scoreIPv4(ifaceAddr{Name: name, IP: net.ParseIP(ip), PointToPoint: p2p})
+	}
+	cases := []struct {
+		name string
+		a, b int // a should beat b
+	}{
+		{"wifi beats ethernet", score("Wi-Fi", "192.168.1.10", false), score("Ethernet", "192.168.1.11", false)},
+		{"private beats public", score("eth0", "10.0.0.5", false), score("eth0", "203.0.113.5", false)},
+		{"192.168 slightly beats 10/8", score("eth0", "192.168.1.2", false), score("eth0", "10.0.0.2", false)},
+		{"host-only 192.168.56 loses", score("eth0", "172.16.0.2", false), score("eth1", "192.168.56.1", false)},
+		{"vpn loses to public", score("eth0", "203.0.113.5", false), score("Tailscale", "100.64.0.1", false)},
+		{"docker loses", score("en0", "10.0.0.2", false), score("docker0", "172.17.0.1", false)},
+		{"vEthernet (WSL) loses", score("WLAN", "192.168.0.3", false), score("vEthernet (WSL)", "172.20.0.1", false)},
+		{"point-to-point loses", score("ppp0-like", "10.0.0.2", false), score("ppp0-like", "10.0.0.3", true)},
+	}
+	for _, tc := range cases {
+		if tc.a <= tc.b {
+			t.Errorf("%s: %d <= %d", tc.name, tc.a, tc.b)
+		}
+	}
+	if got := score("Wi-Fi", "192.168.1.10", false); got != 145 {
+		t.Errorf("Wi-Fi 192.168.1.10 score = %d, want 145", got)
+	}
+	if got := score("VMware Network Adapter", "192.168.56.1", false); got != 100+5-50-1000 {
+		t.Errorf("VMware host-only score = %d", got)
+	}
+}
+
+func TestGetLocalIPv4Cache(t *testing.T) {
+	oldNow, oldResolve := localIPv4Now, resolveLocalIPv4
+	defer func() {
+		localIPv4Now, resolveLocalIPv4 = oldNow, oldResolve
+		InvalidateLocalIPv4()
+	}()
+	now := time.Unix(1000, 0)
+	calls := 0
+	localIPv4Now = func() time.Time { return now }
+	resolveLocalIPv4 = func() (string, error) {
+		calls++
+		return fmt.Sprintf("192.168.1.%d", calls), nil
+	}
+	InvalidateLocalIPv4()
+
+	ip, _ := getLocalIPv4()
+	ip2, _ := getLocalIPv4()
+	if ip != "192.168.1.1" || ip2 != ip || calls != 1 {
+		t.Fatalf("cached lookups = %q %q after %d calls", ip, ip2, calls)
+	}
+	now = now.Add(localIPv4CacheTTL)
+	if ip, _ = getLocalIPv4(); ip != "192.168.1.2" {
+		t.Fatalf("after TTL = %q", ip)
+	}
+	InvalidateLocalIPv4()
+	if ip, _ = getLocalIPv4(); ip != "192.168.1.3" {
+		t.Fatalf("after invalidate = %q", ip)
+	}
+}
+
+func TestShareServerUnknownAPIRouteIsJSON404(t *testing.T) {
+	s := newTestShareServerWithSettings(t.TempDir())
+	s.assets = fstest.MapFS{"index.html": {Data: []byte("<html>spa</html>")}}
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	get := func(target string) (*http.Response, string) {
+		t.Helper()
+		resp, err := ts.Client().Get(ts.URL + target)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", target, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+	checkJSON404 := func(target string) {
+		t.Helper()
+		resp, body := get(target)
+		var got map[string]string
+		if resp.StatusCode != http.StatusNotFound || json.Unmarshal([]byte(body), &got) != nil || got["code"] != "NOT_FOUND" {
+			t.Fatalf("%s = %d %q, want JSON 404", target, resp.StatusCode, body)
+		}
+		if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+			t.Fatalf("%s content type = %q", target, resp.Header.Get("Content-Type"))
+		}
+	}
+	checkSPA := func(target string) {
+		t.Helper()
+		if resp, body := get(target); resp.StatusCode != http.StatusOK || !strings.Contains(body, "spa") {
+			t.Fatalf("%s = %d %q, want the SPA", target, resp.StatusCode, body)
+		}
+	}
+
+	checkJSON404("/api/downloads")
+	checkJSON404("/api/")
+	checkJSON404("/api")
+	checkJSON404("/api/files/extra/segments")
+	checkSPA("/")
+	checkSPA("/browse/docs")
+	checkSPA("/settings")
+	checkSPA("/apidocs")
+	// Real endpoints are unaffected.
+	if resp, _ := get("/api/meta"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("/api/meta = %d", resp.StatusCode)
+	}
+
+	if err := s.SetSetting(SettingKeyBasePath, json.RawMessage(`"/share"`)); err != nil {
+		t.Fatalf("set base path: %v", err)
+	}
+	checkJSON404("/share/api/downloads")
+	checkSPA("/share/browse/docs")
+}
+
+func TestShareServerZipDefaults(t *testing.T) {
+	tmp := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(tmp, "proj", "node_modules", "pkg"), 0o755)
+	_ = os.MkdirAll(filepath.Join(tmp, "proj", ".git"), 0o755)
+	_ = os.MkdirAll(filepath.Join(tmp, "proj", "src", "node_modules"), 0o755)
+	_ = os.WriteFile(filepath.Join(tmp, "proj", "node_modules", "pkg", "index.js"), []byte("12345"), 0o644)
+	_ = os.WriteFile(filepath.Join(tmp, "proj", "node_modules", "a.js"), []byte("123"), 0o644)
+	_ = os.WriteFile(filepath.Join(tmp, "proj", ".git", "HEAD"), []byte("ref"), 0o644)
+	_ = os.WriteFile(filepath.Join(tmp, "proj", ".DS_Store"), []byte("xx"), 0o644)
+	_ = os.WriteFile(filepath.Join(tmp, "proj", "main.go"), []byte("package main"), 0o644)
+
+	s := newTestShareServerWithSettings(tmp)
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	fetch := func() zipDefaultsResponse {
+		t.Helper()
+		resp, err := ts.Client().Get(ts.URL + "/api/zip-defaults?path=proj")
+		if err != nil {
+			t.Fatalf("GET zip-defaults: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %d", resp.StatusCode)
+		}
+		var out zipDefaultsResponse
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return out
+	}
+
+	got := fetch()
+	if got.Path != "proj" || len(got.Suggestions) != 3 {
+		t.Fatalf("suggestions = %+v", got)
+	}
+	// Setting order; src/node_modules is deeper and not suggested.
+	nm, git, ds := got.Suggestions[0], got.Suggestions[1], got.Suggestions[2]
+	if nm.Name != "node_modules" || nm.Type != "directory" || nm.Size != 8 || nm.FileCount != 2 || !nm.Complete {
+		t.Fatalf("node_modules = %+v", nm)
+	}
+	if git.Name != ".git" || git.Size != 3 {
+		t.Fatalf(".git = %+v", git)
+	}
+	if ds.Name != ".DS_Store" || ds.Type != "file" || ds.Size != 2 {
+		t.Fatalf(".DS_Store = %+v", ds)
+	}
+
+	if err := s.SetSetting(SettingKeyZipIgnoreSuggestions, json.RawMessage(`["a/b"]`)); err == nil {
+		t.Fatalf("expected a path to be rejected")
+	}
+	if err := s.SetSetting(SettingKeyZipIgnoreSuggestions, json.RawMessage(`["src","target"]`)); err != nil {
+		t.Fatalf("set suggestions: %v", err)
+	}
+	if got := fetch(); len(got.Suggestions) != 1 || got.Suggestions[0].Name != "src" {
+		t.Fatalf("custom suggestions = %+v", got)
+	}
+
+	_ = s.settings.Set(SettingKeyPermissions, json.RawMessage(`{"read":false}`))
+	resp, err := ts.Client().Get(ts.URL + "/api/zip-defaults?path=proj")
+	if err != nil {
+		t.Fatalf("GET zip-defaults: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("without read permission = %d", resp.StatusCode)
+	}
+}
+
+func TestShareServerConcurrentStart(t *testing.T) {
+	if _, err := getLocalIPv4(); err != nil {
+		t.Skipf("no local IPv4: %v", err)
+	}
+	s := newTestShareServerWithSettings("")
+	const n = 8
+	roots := make([]string, n)
+	for i := range roots {
+		roots[i] = t.TempDir()
+	}
+
+	var wg sync.WaitGroup
+	results := make([]*StartResult, n)
+	errs := make([]error, n)
+	for i := range roots {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = s.Start(context.Background(), roots[i])
+		}(i)
+	}
+	wg.Wait()
+
+	port := 0
+	for i, res := range results {
+		if errs[i] != nil {
+			t.Fatalf("Start %d failed: %v", i, errs[i])
+		}
+		if port == 0 {
+			port = res.Info.Port
+		}
+		if res.Info.Port != port {
+			t.Fatalf("Start %d bound port %d, others %d", i, res.Info.Port, port)
+		}
+	}
+
+	s.mu.RLock()
+	root := s.sharedRoot
+	s.mu.RUnlock()
+	s.opMu.Lock()
+	watchRoot := s.watchRoot
+	s.opMu.Unlock()
+	if !slices.Contains(roots, root) {
+		t.Fatalf("final root %q is none of the requested ones", root)
+	}
+	if !samePath(watchRoot, root) {
+		t.Fatalf("watcher on %q, share on %q", watchRoot, root)
+	}
+
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		t.Fatalf("port %d still bound after Stop: %v", port, err)
+	}
+	_ = ln.Close()
+}
+
+func TestShareServerStartStopToggleNoLeaks(t *testing.T) {
+	if _, err := getLocalIPv4(); err != nil {
+		t.Skipf("no local IPv4: %v", err)
+	}
+	s := newTestShareServerWithSettings("")
+	roots := []string{t.TempDir(), t.TempDir()}
+	for _, root := range roots {
+		for _, dir := range []string{"a/b", "c"} {
+			if err := os.MkdirAll(filepath.Join(root, filepath.FromSlash(dir)), 0o755); err != nil {
+				t.Fatalf("mkdir: %v", err)
+			}
+		}
+	}
+	// One round first, so lazily started runtime goroutines don't count.
+	if _, err := s.Start(context.Background(), roots[0]); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	base := runtime.NumGoroutine()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if (i+j)%2 == 0 {
+					_, _ = s.Start(context.Background(), roots[(i+j)%len(roots)])
+				} else {
+					_ = s.Stop(context.Background())
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("final Stop failed: %v", err)
+	}
+
+	s.opMu.Lock()
+	dw, watchRoot := s.watcher, s.watchRoot
+	s.opMu.Unlock()
+	if dw != nil || watchRoot != "" {
+		t.Fatalf("watcher left on %q after Stop", watchRoot)
+	}
+
+	// Servers and watcher loops wind down asynchronously.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		n := runtime.NumGoroutine()
+		if n <= base+2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("goroutines grew from %d to %d", base, n)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestDirectoryWatcherStopIdempotent(t *testing.T) {
+	dw, err := newDirectoryWatcher(t.TempDir(), nil, watchCoalesceConfig{}, nil, nil)
+	if err != nil {
+		t.Fatalf("newDirectoryWatcher: %v", err)
+	}
+	// Stop before Start must not block, and Start afterwards must refuse.
+	dw.Stop()
+	if err := dw.Start(context.Background()); !errors.Is(err, errWatcherStopped) {
+		t.Fatalf("Start after Stop = %v", err)
+	}
+
+	dw, err = newDirectoryWatcher(t.TempDir(), nil, watchCoalesceConfig{}, nil, nil)
+	if err != nil {
+		t.Fatalf("newDirectoryWatcher: %v", err)
+	}
+	if err := dw.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dw.Stop()
+		}()
+	}
+	wg.Wait()
+}
+
+func TestShareServerCORS(t *testing.T) {
+	tmp := t.TempDir()
+	_ = os.WriteFile(filepath.Join(tmp, "a.txt"), []byte("hello"), 0o644)
+	s := newTestShareServerWithSettings(tmp)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	const allowed, denied = "http://localhost:5173", "https://evil.example"
+	do := func(method, path, origin string, preflight bool) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, ts.URL+path, nil)
+		req.Header.Set("Origin", origin)
+		if preflight {
+			req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+			req.Header.Set("Access-Control-Request-Headers", "x-share-token")
+		}
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	// Disabled by default.
+	if resp := do(http.MethodGet, "/api/meta", allowed, false); resp.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("CORS header while disabled")
+	}
+
+	for _, bad := range []string{`["*"]`, `["http://a.example/path"]`, `["localhost"]`, `"http://a.example"`} {
+		if err := s.SetSetting(SettingKeyCORSOrigins, json.RawMessage(bad)); err == nil {
+			t.Fatalf("SetSetting(%s) accepted", bad)
+		}
+	}
+	if err := s.SetSetting(SettingKeyCORSOrigins, json.RawMessage(`["http://LOCALHOST:5173/"]`)); err != nil {
+		t.Fatalf("SetSetting: %v", err)
+	}
+
+	resp := do(http.MethodOptions, "/api/files", allowed, true)
+	if resp.StatusCode != http.StatusNoContent ||
+		resp.Header.Get("Access-Control-Allow-Origin") != allowed ||
+		resp.Header.Get("Access-Control-Allow-Credentials") != "true" ||
+		!strings.Contains(resp.Header.Get("Access-Control-Allow-Headers"), "X-Share-Token") ||
+		!strings.Contains(resp.Header.Get("Access-Control-Allow-Methods"), "POST") {
+		t.Fatalf("allowed preflight = %d %v", resp.StatusCode, resp.Header)
+	}
+	resp = do(http.MethodOptions, "/api/files", denied, true)
+	if resp.StatusCode != http.StatusForbidden || resp.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("denied preflight = %d %v", resp.StatusCode, resp.Header)
+	}
+
+	for _, path := range []string{"/api/meta", "/api/download?path=a.txt", "/api/events"} {
+		resp = do(http.MethodGet, path, allowed, false)
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Access-Control-Allow-Origin") != allowed ||
+			!strings.Contains(resp.Header.Get("Access-Control-Expose-Headers"), "Content-Disposition") {
+			t.Fatalf("GET %s allowed = %d %v", path, resp.StatusCode, resp.Header)
+		}
+		resp = do(http.MethodGet, path, denied, false)
+		if resp.Header.Get("Access-Control-Allow-Origin") != "" || resp.Header.Get("Access-Control-Allow-Credentials") != "" {
+			t.Fatalf("GET %s denied got CORS headers: %v", path, resp.Header)
+		}
+	}
+
+	// The web UI itself is not an API route.
+	if resp := do(http.MethodGet, "/", allowed, false); resp.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("CORS header outside /api")
+	}
+}
+
+func TestShareServerExpiry(t *testing.T) {
+	if _, err := getLocalIPv4(); err != nil {
+		t.Skipf("no local IPv4: %v", err)
+	}
+	expired := make(chan string, 1)
+	s := New(Options{Settings: NewMemorySettings(), OnShareExpired: func(root string) { expired <- root }})
+	defer s.Stop(context.Background())
+
+	rootA, rootB := t.TempDir(), t.TempDir()
+	if _, err := s.Start(context.Background(), rootA); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	info, err := s.SetExpiry(time.Hour)
+	if err != nil || info == nil || info.ExpiresIn <= 3599 || info.ExpiresIn > 3600 {
+		t.Fatalf("SetExpiry = %+v, %v", info, err)
+	}
+
+	// A timer that fires after the share moved on must not stop it.
+	s.mu.RLock()
+	oldGen := s.expiry.gen
+	s.mu.RUnlock()
+	res, err := s.Start(context.Background(), rootB)
+	if err != nil || res.Info.ExpiresIn == 0 {
+		t.Fatalf("restart = %+v, %v", res, err)
+	}
+	s.shareExpired(oldGen)
+	if info, _ := s.GetServerInfo(); info == nil {
+		t.Fatalf("stale timer stopped the restarted share")
+	}
+
+	if info, _ := s.SetExpiry(0); info == nil || info.ExpiresIn != 0 {
+		t.Fatalf("cleared expiry = %+v", info)
+	}
+
+	if _, err := s.SetExpiry(50 * time.Millisecond); err != nil {
+		t.Fatalf("SetExpiry: %v", err)
+	}
+	select {
+	case root := <-expired:
+		if root != rootB {
+			t.Fatalf("expired root = %q, want %q", root, rootB)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("share did not expire")
+	}
+	if info, _ := s.GetServerInfo(); info != nil {
+		t.Fatalf("still sharing after expiry: %+v", info)
+	}
+
+	// The expiry is kept for the next share, and Stop cancels its timer.
+	res, err = s.Start(context.Background(), rootA)
+	if err != nil || res.Info.ExpiresIn == 0 {
+		t.Fatalf("Start after expiry = %+v, %v", res, err)
+	}
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	s.mu.RLock()
+	timer := s.expiry.timer
+	s.mu.RUnlock()
+	if timer != nil {
+		t.Fatalf("Stop left the expiry timer armed")
+	}
+	if _, err := s.SetExpiry(-time.Second); err == nil {
+		t.Fatalf("negative expiry accepted")
+	}
+}
+
+func TestShareServerHostPermissionDenied(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeReadDirError(rec, &os.PathError{Op: "open", Path: "x", Err: os.ErrPermission})
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), `"HOST_PERMISSION_DENIED"`) {
+		t.Fatalf("permission error = %d %s", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	writeReadDirError(rec, errors.New("disk on fire"))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("other error = %d", rec.Code)
+	}
+
+	// Real permission bits: Unix only, and root reads everything anyway.
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("needs a non-root user on Unix")
+	}
+	tmp := t.TempDir()
+	locked := filepath.Join(tmp, "locked")
+	_ = os.Mkdir(locked, 0o755)
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatalf("chmod: %v", err)
+	}
+	defer os.Chmod(locked, 0o755)
+
+	s := newTestShareServerWithSettings(tmp)
+	if _, err := s.Start(context.Background(), locked); !errors.Is(err, ErrRootNotReadable) {
+		t.Fatalf("Start(locked) err = %v, want ErrRootNotReadable", err)
+	}
+	if _, err := s.ListDirectory("locked"); !errors.Is(err, errHostPermissionDenied) {
+		t.Fatalf("ListDirectory err = %v", err)
+	}
+
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	for _, u := range []string{"/api/files?path=locked", "/api/files?path=locked&stream=1", "/api/path-info?path=locked"} {
+		resp, err := ts.Client().Get(ts.URL + u)
+		if err != nil {
+			t.Fatalf("GET %s: %v", u, err)
+		}
+		var body map[string]string
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden || body["code"] != "HOST_PERMISSION_DENIED" {
+			t.Fatalf("GET %s = %d %v", u, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestShareServerChecksums(t *testing.T) {
+	tmp := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(tmp, "sub"), 0o755)
+	_ = os.WriteFile(filepath.Join(tmp, "a.bin"), []byte("hello"), 0o644)
+	_ = os.WriteFile(filepath.Join(tmp, "sub", "b.txt"), []byte("world!"), 0o644)
+	_ = os.WriteFile(filepath.Join(tmp, ".hidden"), []byte("x"), 0o644)
+	s := newTestShareServerWithSettings(tmp)
+	ctx := context.Background()
+
+	sumA := fmt.Sprintf("%x", sha256.Sum256([]byte("hello")))
+	res, err := s.GenerateChecksums(ctx, "", false, nil)
+	if err != nil || !res.Done || res.Files != 1 || res.TotalBytes != 5 || res.Bytes != 5 {
+		t.Fatalf("flat run = %+v, %v", res, err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(tmp, "a.bin.sha256")); string(b) != sumA+"  a.bin\n" {
+		t.Fatalf("sidecar = %q", b)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, ".hidden.sha256")); err == nil {
+		t.Fatalf("hidden file got a sidecar")
+	}
+
+	// Up-to-date sidecars are skipped; the rest is picked up.
+	var reports []ChecksumProgress
+	res, err = s.GenerateChecksums(ctx, "", true, func(p ChecksumProgress) { reports = append(reports, p) })
+	if err != nil || res.Files != 1 || res.UpToDate != 1 || res.Bytes != 6 || res.TotalBytes != 6 {
+		t.Fatalf("recursive run = %+v, %v", res, err)
+	}
+	if len(reports) < 2 || !reports[len(reports)-1].Done || reports[0].Done {
+		t.Fatalf("progress reports = %+v", reports)
+	}
+
+	// A canceled run writes nothing.
+	_ = os.WriteFile(filepath.Join(tmp, "c.bin"), []byte("later"), 0o644)
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	res, _ = s.GenerateChecksums(canceled, "c.bin", false, nil)
+	if !res.Canceled || !res.Done {
+		t.Fatalf("canceled run = %+v", res)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "c.bin.sha256")); err == nil {
+		t.Fatalf("canceled run wrote a sidecar")
+	}
+
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	hash := func(p string) hashResponse {
+		t.Helper()
+		resp, err := ts.Client().Get(ts.URL + "/api/hash?path=" + url.QueryEscape(p))
+		if err != nil {
+			t.Fatalf("GET hash: %v", err)
+		}
+		defer resp.Body.Close()
+		var out hashResponse
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("hash %s status = %d", p, resp.StatusCode)
+		}
+		return out
+	}
+	if got := hash("a.bin"); got.SHA256 != sumA || got.Source != "sidecar" {
+		t.Fatalf("hash a.bin = %+v", got)
+	}
+	// A file newer than its sidecar is hashed again.
+	later := time.Now().Add(time.Hour)
+	_ = os.WriteFile(filepath.Join(tmp, "a.bin"), []byte("changed"), 0o644)
+	_ = os.Chtimes(filepath.Join(tmp, "a.bin"), later, later)
+	if got := hash("a.bin"); got.Source != "computed" || got.SHA256 != fmt.Sprintf("%x", sha256.Sum256([]byte("changed"))) {
+		t.Fatalf("hash of changed a.bin = %+v", got)
+	}
+	if got := hash("a.bin"); got.Source != "cache" {
+		t.Fatalf("second hash source = %q", got.Source)
+	}
+
+	// Replacing a sidecar is an overwrite like any other.
+	put := func(target string, body string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPut, ts.URL+target, strings.NewReader(body))
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("PUT sidecar: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := put("/api/put/sub/b.txt.sha256?conflict=overwrite", "x"); code != http.StatusForbidden {
+		t.Fatalf("PUT over sidecar without delete permission = %d", code)
+	}
+	// A sidecar the host didn't write is never trusted, however new it is.
+	allowDeleteForTest(t, s)
+	forged := fmt.Sprintf("%x  b.txt\n", sha256.Sum256([]byte("forged")))
+	if code := put("/api/put/sub/b.txt.sha256?conflict=overwrite", forged); code != http.StatusOK {
+		t.Fatalf("PUT over sidecar with delete permission = %d", code)
+	}
+	if got := hash("sub/b.txt"); got.Source == "sidecar" || got.SHA256 != fmt.Sprintf("%x", sha256.Sum256([]byte("world!"))) {
+		t.Fatalf("hash trusted an uploaded sidecar: %+v", got)
+	}
+
+	// Sidecars are only hidden when the rule asks for it.
+	hiddenSidecar := func() bool {
+		items, _ := s.ListDirectory("")
+		for _, it := range items {
+			if it.Name == "a.bin.sha256" {
+				return it.Hidden
+			}
+		}
+		t.Fatalf("sidecar not listed")
+		return false
+	}
+	if hiddenSidecar() {
+		t.Fatalf("sidecar hidden by default")
+	}
+	_ = s.settings.Set(SettingKeyHiddenRules, json.RawMessage(`{"checksums":true}`))
+	if !hiddenSidecar() {
+		t.Fatalf("sidecar not hidden with checksums rule")
+	}
+}
+
+func TestShareServerArchiveExtract(t *testing.T) {
+	tmp := t.TempDir()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	add := func(h *zip.FileHeader, content []byte) {
+		t.Helper()
+		fw, err := zw.CreateHeader(h)
+		if err != nil {
+			t.Fatalf("zip create %s: %v", h.Name, err)
+		}
+		_, _ = fw.Write(content)
+	}
+	add(&zip.FileHeader{Name: "docs/", Method: zip.Store}, nil)
+	add(&zip.FileHeader{Name: "docs/readme.txt", Method: zip.Deflate}, []byte("nested readme"))
+	add(&zip.FileHeader{Name: "stored.bin", Method: zip.Store}, []byte("0123456789"))
+	add(&zip.FileHeader{Name: "huge.bin", Method: zip.Deflate}, make([]byte, 3<<20))
+	add(&zip.FileHeader{Name: "secret.txt", Method: zip.Store, Flags: zipFlagEncrypted}, []byte("ciphertext"))
+	_ = zw.Close()
+	_ = os.WriteFile(filepath.Join(tmp, "big.zip"), buf.Bytes(), 0o644)
+	_ = os.WriteFile(filepath.Join(tmp, "plain.txt"), []byte("not a zip"), 0o644)
+
+	s := newTestShareServerWithSettings(tmp)
+	_ = s.settings.Set(SettingKeyArchiveExtractMaxMB, json.RawMessage(`1`))
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	get := func(p, entry string, header map[string]string) (*http.Response, string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/archive-extract?"+url.Values{"path": {p}, "entry": {entry}}.Encode(), nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("GET %s!%s: %v", p, entry, err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp, string(b)
+	}
+	code := func(body string) string {
+		var m map[string]any
+		_ = json.Unmarshal([]byte(body), &m)
+		c, _ := m["code"].(string)
+		return c
+	}
+
+	resp, body := get("big.zip", "docs/readme.txt", nil)
+	if resp.StatusCode != http.StatusOK || body != "nested readme" ||
+		resp.Header.Get("Content-Type") != "text/plain; charset=utf-8" ||
+		!strings.Contains(resp.Header.Get("Content-Disposition"), "readme.txt") {
+		t.Fatalf("nested entry = %d %q %v", resp.StatusCode, body, resp.Header)
+	}
+	resp, body = get("big.zip", "stored.bin", map[string]string{"Range": "bytes=2-4"})
+	if resp.StatusCode != http.StatusPartialContent || body != "234" {
+		t.Fatalf("stored range = %d %q", resp.StatusCode, body)
+	}
+	resp, _ = get("big.zip", "stored.bin", map[string]string{"Range": "bytes=50-60"})
+	if resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		t.Fatalf("out-of-range status = %d", resp.StatusCode)
+	}
+
+	// Names match exactly: no globbing, no case folding, no directories.
+	for entry, want := range map[string]string{
+		"missing.txt":     "ARCHIVE_ENTRY_NOT_FOUND",
+		"docs/*.txt":      "ARCHIVE_ENTRY_NOT_FOUND",
+		"DOCS/readme.txt": "ARCHIVE_ENTRY_NOT_FOUND",
+		"readme.txt":      "ARCHIVE_ENTRY_NOT_FOUND",
+		"docs/":           "ARCHIVE_ENTRY_IS_DIR",
+		"huge.bin":        "ARCHIVE_ENTRY_TOO_LARGE",
+		"secret.txt":      "ARCHIVE_ENTRY_ENCRYPTED",
+	} {
+		if _, body := get("big.zip", entry, nil); code(body) != want {
+			t.Fatalf("entry %q = %s, want %s", entry, body, want)
+		}
+	}
+	if resp, body := get("plain.txt", "x", nil); resp.StatusCode != http.StatusBadRequest || code(body) != "NOT_A_ZIP" {
+		t.Fatalf("non-zip = %d %s", resp.StatusCode, body)
+	}
+}
+
+// jpegWithExifForTest encodes a w×h JPEG carrying an Exif segment with the
+// given Orientation and DateTimeOriginal ("2006:01:02 15:04:05").
+func jpegWithExifForTest(t *testing.T, w, h, orientation int, taken string) []byte {
+	t.Helper()
+	var img bytes.Buffer
+	if err := jpeg.Encode(&img, image.NewGray(image.Rect(0, 0, w, h)), nil); err != nil {
+		t.Fatalf("encode jpeg: %v", err)
+	}
+	le := binary.LittleEndian
+	tiff := []byte("II\x2a\x00\x08\x00\x00\x00")
+	entry := func(tag, typ uint16, count, value uint32) {
+		tiff = le.AppendUint16(tiff, tag)
+		tiff = le.AppendUint16(tiff, typ)
+		tiff = le.AppendUint32(tiff, count)
+		tiff = le.AppendUint32(tiff, value)
+	}
+	// IFD0 at 8 (30 bytes), the Exif IFD at 38 (18 bytes), the date at 56.
+	tiff = le.AppendUint16(tiff, 2)
+	entry(0x0112, 3, 1, uint32(orientation))
+	entry(0x8769, 4, 1, 38)
+	tiff = le.AppendUint32(tiff, 0)
+	tiff = le.AppendUint16(tiff, 1)
+	entry(0x9003, 2, 20, 56)
+	tiff = le.AppendUint32(tiff, 0)
+	tiff = append(tiff, taken+"\x00"...)
+
+	seg := append([]byte("Exif\x00\x00"), tiff...)
+	out := []byte{0xFF, 0xD8, 0xFF, 0xE1}
+	out = binary.BigEndian.AppendUint16(out, uint16(len(seg)+2))
+	out = append(out, seg...)
+	return append(out, img.Bytes()[2:]...)
+}
+
+func TestShareServerMediaInfo(t *testing.T) {
+	tmp := t.TempDir()
+	photos := filepath.Join(tmp, "photos")
+	if err := os.MkdirAll(photos, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	var png1 bytes.Buffer
+	if err := png.Encode(&png1, image.NewRGBA(image.Rect(0, 0, 3, 5))); err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+	files := map[string][]byte{
+		"IMG_0001.JPG": jpegWithExifForTest(t, 16, 8, 6, "2024:05:06 07:08:09"),
+		"shot.png":     png1.Bytes(),
+		"notes.txt":    []byte("not an image"),
+		"broken.jpg":   []byte("\xff\xd8 truncated"),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(photos, name), data, 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	s := newTestShareServerWithSettings(tmp)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	get := func() (int, mediaInfoResponse) {
+		resp, err := ts.Client().Get(ts.URL + "/api/media-info?path=photos")
+		if err != nil {
+			t.Fatalf("GET /api/media-info failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var body mediaInfoResponse
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body
+	}
+	status, body := get()
+	if status != http.StatusOK || body.Path != "photos" || body.Truncated {
+		t.Fatalf("media-info = %d %+v", status, body)
+	}
+	want := map[string]MediaInfo{
+		"IMG_0001.JPG": {Width: 16, Height: 8, Taken: "2024-05-06T07:08:09", Orientation: 6},
+		"shot.png":     {Width: 3, Height: 5},
+	}
+	if len(body.Items) != len(want) {
+		t.Fatalf("items = %+v, want %+v", body.Items, want)
+	}
+	for name, info := range want {
+		if body.Items[name] != info {
+			t.Fatalf("%s = %+v, want %+v", name, body.Items[name], info)
+		}
+	}
+
+	// Cached by path and mtime: a rewritten file is read again.
+	later := time.Now().Add(time.Minute)
+	pngPath := filepath.Join(photos, "shot.png")
+	png1.Reset()
+	_ = png.Encode(&png1, image.NewRGBA(image.Rect(0, 0, 7, 2)))
+	if err := os.WriteFile(pngPath, png1.Bytes(), 0o644); err != nil {
+		t.Fatalf("rewrite png: %v", err)
+	}
+	_ = os.Chtimes(pngPath, later, later)
+	if _, body = get(); body.Items["shot.png"] != (MediaInfo{Width: 7, Height: 2}) {
+		t.Fatalf("after rewrite shot.png = %+v", body.Items["shot.png"])
+	}
+
+	// A request whose client is gone stops without answering.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "/api/media-info?path=photos", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	s.handleMediaInfo(rec, req)
+	if rec.Body.Len() != 0 {
+		t.Fatalf("canceled request answered %q", rec.Body.String())
+	}
+
+	resp, err := ts.Client().Get(ts.URL + "/api/media-info?path=missing")
+	if err != nil {
+		t.Fatalf("GET missing failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("missing folder = %d", resp.StatusCode)
+	}
+
+	_ = s.settings.Set(SettingKeyPermissions, json.RawMessage(`{"read":false}`))
+	resp, err = ts.Client().Get(ts.URL + "/api/media-info?path=photos")
+	if err != nil {
+		t.Fatalf("GET without read failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("without read permission = %d", resp.StatusCode)
+	}
+}
+
+func TestShareServerZipDefaultIgnore(t *testing.T) {
+	tmp := t.TempDir()
+	for _, dir := range []string{"proj/node_modules/x", "proj/src", "proj/build"} {
+		_ = os.MkdirAll(filepath.Join(tmp, filepath.FromSlash(dir)), 0o755)
+	}
+	for _, f := range []string{"proj/node_modules/x/i.js", "proj/src/main.go", "proj/build/disk.iso", "proj/build/out.bin"} {
+		_ = os.WriteFile(filepath.Join(tmp, filepath.FromSlash(f)), []byte("x"), 0o644)
+	}
+	s := newTestShareServerWithSettings(tmp)
+	for _, bad := range []string{`["build/*.iso"]`, `["["]`, `[""]`, `"x"`} {
+		if err := s.SetSetting(SettingKeyZipDefaultIgnore, json.RawMessage(bad)); !errors.Is(err, errInvalidZipDefaultIgnore) {
+			t.Fatalf("set %s: %v", bad, err)
+		}
+	}
+	if err := s.SetSetting(SettingKeyZipDefaultIgnore, json.RawMessage(`["node_modules","*.iso"]`)); err != nil {
+		t.Fatalf("set zip default ignore: %v", err)
+	}
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	zipNames := func(resp *http.Response) map[string]bool {
+		t.Helper()
+		b, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d body=%s", resp.StatusCode, b)
+		}
+		zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+		if err != nil {
+			t.Fatalf("open zip failed: %v", err)
+		}
+		got := map[string]bool{}
+		for _, f := range zr.File {
+			got[f.Name] = true
+		}
+		return got
+	}
+	post := func(target, body, adminPass string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if adminPass != "" {
+			req.Header.Set(headerAdminPass, adminPass)
+		}
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("POST %s failed: %v", target, err)
+		}
+		return resp
+	}
+
+	// Merged with the request's own list; only what it added is reported.
+	resp := post("/api/download-zip", `{"paths":["proj"],"ignore":["node_modules","out.bin"]}`, "")
+	if h := resp.Header.Get(headerZipDefaultIgnore); h != "%2A.iso" {
+		t.Fatalf("%s = %q", headerZipDefaultIgnore, h)
+	}
+	if got := zipNames(resp); len(got) != 1 || !got["proj/src/main.go"] {
+		t.Fatalf("download-zip entries = %v", got)
+	}
+
+	resp = post("/api/download-estimate", `{"paths":["proj"]}`, "")
+	var est downloadEstimateResponse
+	_ = json.NewDecoder(resp.Body).Decode(&est)
+	resp.Body.Close()
+	if est.FileCount != 2 || !slices.Equal(est.DefaultIgnore, []string{"node_modules", "*.iso"}) {
+		t.Fatalf("estimate = %+v", est)
+	}
+
+	resp, err := ts.Client().Get(ts.URL + "/api/download-all?path=proj")
+	if err != nil {
+		t.Fatalf("GET /api/download-all failed: %v", err)
+	}
+	if got := zipNames(resp); len(got) != 2 || got["proj/build/disk.iso"] || got["proj/node_modules/x/i.js"] {
+		t.Fatalf("download-all entries = %v", got)
+	}
+
+	// Bypassing needs a remote admin.
+	resp = post("/api/download-zip", `{"paths":["proj"],"noDefaultIgnore":true}`, "")
+	var body map[string]any
+	_ = json.NewDecoder(resp.Body).Decode(&body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound || body["code"] != "ADMIN_DISABLED" {
+		t.Fatalf("bypass without admin = %d %v", resp.StatusCode, body)
+	}
+	_ = s.settings.Set(SettingKeyAdminPass, json.RawMessage(`"admin-secret-1"`))
+	resp = post("/api/download-zip", `{"paths":["proj"],"noDefaultIgnore":true}`, "wrong-pass-1")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("bypass with wrong admin pass = %d", resp.StatusCode)
+	}
+	resp = post("/api/download-zip", `{"paths":["proj"],"noDefaultIgnore":true}`, "admin-secret-1")
+	if h := resp.Header.Get(headerZipDefaultIgnore); h != "" {
+		t.Fatalf("bypass still reports %q", h)
+	}
+	if got := zipNames(resp); len(got) != 4 {
+		t.Fatalf("bypassed download-zip entries = %v", got)
+	}
+
+	// Guests can neither see nor change the list.
+	resp, err = ts.Client().Get(ts.URL + "/api/settings/" + url.PathEscape(SettingKeyZipDefaultIgnore))
+	if err != nil {
+		t.Fatalf("GET setting failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		t.Fatalf("zip default ignore readable over HTTP")
+	}
+}
+
+func TestShareServerListingReadme(t *testing.T) {
+	tmp := t.TempDir()
+	for _, dir := range []string{"docs", "big", "none/README.md", "latin1"} {
+		_ = os.MkdirAll(filepath.Join(tmp, filepath.FromSlash(dir)), 0o755)
+	}
+	_ = os.WriteFile(filepath.Join(tmp, "docs", "readme.txt"), []byte("plain"), 0o644)
+	_ = os.WriteFile(filepath.Join(tmp, "docs", "ReadMe.MD"), []byte("\uFEFF# Docs\n"), 0o644)
+	_ = os.WriteFile(filepath.Join(tmp, "big", "README.md"), bytes.Repeat([]byte("x"), maxInlineReadmeBytes+1), 0o644)
+	_ = os.WriteFile(filepath.Join(tmp, "latin1", "README.txt"), []byte("caf\xe9"), 0o644)
+	s := newTestShareServerWithSettings(tmp)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	list := func(query string) filesResponse {
+		t.Helper()
+		resp, err := ts.Client().Get(ts.URL + "/api/files?" + query)
+		if err != nil {
+			t.Fatalf("GET /api/files failed: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET /api/files?%s = %d", query, resp.StatusCode)
+		}
+		var body filesResponse
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		return body
+	}
+
+	// README.md wins over README.txt, whatever the case.
+	got := list("path=docs")
+	if got.Readme == nil || got.Readme.Path != "docs/ReadMe.MD" || got.Readme.Size != 10 || got.Readme.Content != nil {
+		t.Fatalf("docs readme = %+v", got.Readme)
+	}
+	got = list("path=docs&inlineReadme=1")
+	if got.Readme == nil || got.Readme.Content == nil || *got.Readme.Content != "# Docs\n" {
+		t.Fatalf("inline docs readme = %+v", got.Readme)
+	}
+	// Too big or not UTF-8: pointed at, not embedded.
+	for _, dir := range []string{"big", "latin1"} {
+		got = list("path=" + dir + "&inlineReadme=1")
+		if got.Readme == nil || got.Readme.Content != nil {
+			t.Fatalf("%s readme = %+v", dir, got.Readme)
+		}
+	}
+	// A folder named README.md doesn't count.
+	if got = list("path=none"); got.Readme != nil {
+		t.Fatalf("none readme = %+v", got.Readme)
+	}
+
+	// Found even when the listing is cut off before it.
+	_ = s.settings.Set(SettingKeyListMaxItems, json.RawMessage(`100`))
+	for i := 0; i < 150; i++ {
+		_ = os.WriteFile(filepath.Join(tmp, "docs", fmt.Sprintf("f%03d.txt", i)), nil, 0o644)
+	}
+	if got = list("path=docs"); !got.Truncated || got.Readme == nil || got.Readme.Path != "docs/ReadMe.MD" {
+		t.Fatalf("truncated docs: truncated=%v readme=%+v", got.Truncated, got.Readme)
+	}
+}
+
+func TestShareServerStaticPathTraversal(t *testing.T) {
+	tmp := t.TempDir()
+	distDir := filepath.Join(tmp, "dist")
+	_ = os.MkdirAll(filepath.Join(distDir, "assets"), 0o755)
+	_ = os.WriteFile(filepath.Join(distDir, "index.html"), []byte("custom build"), 0o644)
+	_ = os.WriteFile(filepath.Join(distDir, "assets", "app.js"), []byte("app"), 0o644)
+	const secret = "top-secret-settings"
+	_ = os.WriteFile(filepath.Join(tmp, "secret.txt"), []byte(secret), 0o644)
+
+	payloads := []string{
+		"/../secret.txt",
+		"/assets/../../secret.txt",
+		"/%2e%2e/secret.txt",
+		"/%2E%2E%2Fsecret.txt",
+		"/..%2fsecret.txt",
+		"/..%5csecret.txt",
+		"/assets/..%5c..%5csecret.txt",
+		`/..\secret.txt`,
+		`/assets\..\..\secret.txt`,
+		"/%2e%2e%5csecret.txt",
+		"/assets%2f..%2f..%2fsecret.txt",
+		"/index.html%00.js",
+		"/assets/app.js%00",
+		"//secret.txt",
+		"/./../secret.txt",
+		"/browse/..%2f..%2fsecret.txt",
+	}
+
+	s := newTestShareServerWithSettings(t.TempDir())
+	s.assets = fstest.MapFS{
+		"index.html":    {Data: []byte("embedded build")},
+		"assets/app.js": {Data: []byte("app")},
+	}
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+
+	// get follows the mux's own clean-path redirects, like a browser would.
+	get := func(target string) *httptest.ResponseRecorder {
+		t.Helper()
+		for i := 0; ; i++ {
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			loc := rec.Header().Get("Location")
+			if rec.Code/100 != 3 || loc == "" || i == 3 {
+				return rec
+			}
+			target = loc
+		}
+	}
+
+	check := func(mode string) {
+		t.Helper()
+		if rec := get("/assets/app.js"); rec.Code != http.StatusOK || rec.Body.String() != "app" {
+			t.Fatalf("%s: expected app.js to be served, got %d %q", mode, rec.Code, rec.Body.String())
+		}
+		for _, p := range payloads {
+			rec := get(p)
+			if strings.Contains(rec.Body.String(), secret) {
+				t.Fatalf("%s: %q served a file outside the dist directory", mode, p)
+			}
+			if rec.Code != http.StatusBadRequest && rec.Code != http.StatusNotFound {
+				t.Fatalf("%s: expected 400/404 for %q, got %d %q", mode, p, rec.Code, rec.Body.String())
+			}
+		}
+	}
+
+	check(WebServeEmbedded)
+	raw, _ := json.Marshal(distDir)
+	if err := s.SetSetting(SettingKeyWebDistDir, raw); err != nil {
+		t.Fatalf("set web dist dir: %v", err)
+	}
+	if s.WebServeMode() != WebServeCustom {
+		t.Fatalf("expected custom dist mode, got %s", s.WebServeMode())
+	}
+	check(WebServeCustom)
+
+	// Paths the mux leaves alone reach the handler and are refused outright.
+	for _, p := range []string{`/..\secret.txt`, "/%2e%2e%5csecret.txt", "/index.html%00.js"} {
+		if rec := get(p); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %q, got %d", p, rec.Code)
+		}
+	}
+}
+
+func TestShareServerIdleStop(t *testing.T) {
+	if _, err := getLocalIPv4(); err != nil {
+		t.Skipf("no local IPv4: %v", err)
+	}
+	var clock atomic.Int64
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock.Store(start.UnixNano())
+	advance := func(d time.Duration) time.Time {
+		return time.Unix(0, clock.Add(int64(d))).UTC()
+	}
+
+	idle := make(chan string, 1)
+	s := New(Options{Settings: NewMemorySettings(), OnShareIdleStopped: func(root string) { idle <- root }})
+	defer s.Stop(context.Background())
+	s.activity.now = func() time.Time { return time.Unix(0, clock.Load()) }
+	// The ticker is not under test; checkIdle is called directly.
+	s.idleCheckInterval = time.Hour
+
+	root := t.TempDir()
+	_ = os.WriteFile(filepath.Join(root, "a.txt"), []byte("hello"), 0o644)
+	if _, err := s.Start(context.Background(), root); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	s.mu.RLock()
+	stop := s.idleCheckStop
+	s.mu.RUnlock()
+	if stop == nil {
+		t.Fatalf("expected the idle check to run with the share")
+	}
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+	get := func(target string) int {
+		t.Helper()
+		resp, err := ts.Client().Get(ts.URL + target)
+		if err != nil {
+			t.Fatalf("GET %s: %v", target, err)
+		}
+		defer resp.Body.Close()
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return resp.StatusCode
+	}
+
+	// Off by default, however long nobody comes.
+	advance(48 * time.Hour)
+	if s.checkIdle(stop) {
+		t.Fatalf("idle stop must be opt-in")
+	}
+	if info, _ := s.GetServerInfo(); info == nil || info.LastActivity != "" {
+		t.Fatalf("expected no activity yet, got %+v", info)
+	}
+
+	if err := s.SetSetting(SettingKeyIdleStopMinutes, json.RawMessage("30")); err != nil {
+		t.Fatalf("set idle stop: %v", err)
+	}
+	// Idle time counts from the start when nobody showed up.
+	if !s.activity.last().IsZero() || s.activity.idleFor() < 30*time.Minute {
+		t.Fatalf("expected idle time since start, got %s", s.activity.idleFor())
+	}
+
+	// An authenticated request is activity.
+	used := advance(time.Minute)
+	if code := get("/api/files?path="); code != http.StatusOK {
+		t.Fatalf("GET /api/files = %d", code)
+	}
+	if info, _ := s.GetServerInfo(); info == nil || info.LastActivity != used.Format(time.RFC3339) {
+		t.Fatalf("expected lastActivity %s, got %+v", used.Format(time.RFC3339), info)
+	}
+	advance(29 * time.Minute)
+	if s.checkIdle(stop) {
+		t.Fatalf("stopped before the idle time ran out")
+	}
+
+	// A refused request is not.
+	if err := s.SetSetting(SettingKeyAccessPass, json.RawMessage(`"abc123"`)); err != nil {
+		t.Fatalf("set access pass: %v", err)
+	}
+	advance(time.Minute)
+	if code := get("/api/download?path=a.txt"); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a token, got %d", code)
+	}
+	if err := s.SetSetting(SettingKeyAccessPass, nil); err != nil {
+		t.Fatalf("clear access pass: %v", err)
+	}
+	if got := s.activity.last(); !got.Equal(used) {
+		t.Fatalf("refused request counted as activity: %s", got)
+	}
+
+	// An event stream counts when it connects, but what it pushes later
+	// (keep-alives included) does not.
+	connected := advance(time.Minute)
+	resp, err := ts.Client().Get(ts.URL + "/api/events")
+	if err != nil {
+		t.Fatalf("GET /api/events: %v", err)
+	}
+	defer resp.Body.Close()
+	br := bufio.NewReader(resp.Body)
+	if line, _ := br.ReadString('\n'); line != ": connected\n" {
+		t.Fatalf("expected SSE preamble, got %q", line)
+	}
+	advance(10 * time.Minute)
+	s.events.broadcast("ping-for-test", map[string]int{"n": 1})
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading SSE: %v", err)
+		}
+		if strings.Contains(line, "ping-for-test") {
+			break
+		}
+	}
+	if got := s.activity.last(); !got.Equal(connected) {
+		t.Fatalf("SSE traffic counted as activity: got %s, want %s", got, connected)
+	}
+
+	advance(20 * time.Minute)
+	if !s.checkIdle(stop) {
+		t.Fatalf("expected the share to stop after 30 idle minutes")
+	}
+	select {
+	case got := <-idle:
+		if got != root {
+			t.Fatalf("idle root = %q, want %q", got, root)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("OnShareIdleStopped not called")
+	}
+	if info, _ := s.GetServerInfo(); info != nil {
+		t.Fatalf("expected the share to be stopped, got %+v", info)
+	}
+	s.mu.RLock()
+	stopped := s.idleCheckStop == nil
+	s.mu.RUnlock()
+	if !stopped {
+		t.Fatalf("expected the idle check to end with the share")
+	}
+	// A check already on its way after the stop does nothing.
+	if s.checkIdle(stop) {
+		t.Fatalf("stale idle check stopped something")
+	}
+}
+
+func TestShareServerTree(t *testing.T) {
+	tmp := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(tmp, "sub", "deep"), 0o755)
+	_ = os.MkdirAll(filepath.Join(tmp, "node_modules"), 0o755)
+	_ = os.WriteFile(filepath.Join(tmp, "a.txt"), []byte("alpha"), 0o644)
+	_ = os.WriteFile(filepath.Join(tmp, ".secret"), []byte("x"), 0o644)
+	_ = os.WriteFile(filepath.Join(tmp, "node_modules", "m.js"), []byte("x"), 0o644)
+	_ = os.WriteFile(filepath.Join(tmp, "sub", "b.txt"), []byte("bravo"), 0o644)
+	_ = os.WriteFile(filepath.Join(tmp, "sub", "deep", "c.txt"), []byte("charlie"), 0o644)
+	sum := sha256.Sum256([]byte("alpha"))
+
+	s := newTestShareServerWithSettings(tmp)
+	if res, err := s.GenerateChecksums(context.Background(), "a.txt", false, nil); err != nil || res.Files != 1 {
+		t.Fatalf("write sidecar: %+v %v", res, err)
+	}
+	if err := s.SetSetting(SettingKeyWatchIgnore, json.RawMessage(`["node_modules"]`)); err != nil {
+		t.Fatalf("set ignore: %v", err)
+	}
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	get := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+	type treeDoc struct {
+		Path    string      `json:"path"`
+		Entries []treeEntry `json:"entries"`
+		treeSummary
+	}
+	paths := func(entries []treeEntry) string {
+		var out []string
+		for _, e := range entries {
+			out = append(out, e.Path)
+		}
+		slices.Sort(out)
+		return strings.Join(out, ",")
+	}
+
+	rec := get("/api/tree?path=&hashes=1")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("tree = %d %s", rec.Code, rec.Body.String())
+	}
+	var doc treeDoc
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("decode tree document: %v\n%s", err, rec.Body.String())
+	}
+	if got, want := paths(doc.Entries), "a.txt,a.txt.sha256,sub,sub/b.txt,sub/deep,sub/deep/c.txt"; got != want {
+		t.Fatalf("tree entries = %s, want %s", got, want)
+	}
+	if !doc.Done || doc.Count != len(doc.Entries) || doc.Truncated {
+		t.Fatalf("unexpected summary %+v", doc.treeSummary)
+	}
+	for _, e := range doc.Entries {
+		switch e.Path {
+		case "a.txt":
+			if e.SHA256 != fmt.Sprintf("%x", sum) || e.Size != 5 || e.Type != "file" {
+				t.Fatalf("unexpected a.txt entry %+v", e)
+			}
+		case "sub/b.txt":
+			// No sidecar and nothing cached: hashes=1 must not compute it.
+			if e.SHA256 != "" {
+				t.Fatalf("expected no hash for b.txt, got %q", e.SHA256)
+			}
+		case "sub":
+			if e.Type != "directory" {
+				t.Fatalf("unexpected sub entry %+v", e)
+			}
+		}
+	}
+
+	// Depth limiting, relative to the requested folder.
+	for _, tc := range []struct{ target, want string }{
+		{"/api/tree?depth=1", "a.txt,a.txt.sha256,sub"},
+		{"/api/tree?depth=2", "a.txt,a.txt.sha256,sub,sub/b.txt,sub/deep"},
+		{"/api/tree?path=sub&depth=1", "sub/b.txt,sub/deep"},
+		{"/api/tree?path=sub&depth=0", "sub/b.txt,sub/deep,sub/deep/c.txt"},
+	} {
+		var doc treeDoc
+		rec := get(tc.target)
+		if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("%s = %d %s", tc.target, rec.Code, rec.Body.String())
+		}
+		if got := paths(doc.Entries); got != tc.want {
+			t.Fatalf("%s entries = %s, want %s", tc.target, got, tc.want)
+		}
+		for _, e := range doc.Entries {
+			if e.SHA256 != "" {
+				t.Fatalf("%s: hash for %s without hashes=1", tc.target, e.Path)
+			}
+		}
+	}
+
+	// NDJSON: one entry per line, then the summary as the last line.
+	rec = get("/api/tree?path=sub&ndjson=1")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "application/x-ndjson") {
+		t.Fatalf("ndjson tree = %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	body := rec.Body.String()
+	if !strings.HasSuffix(body, "\n") {
+		t.Fatalf("expected NDJSON to end with a newline: %q", body)
+	}
+	lines := strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+	var entries []treeEntry
+	for _, line := range lines[:len(lines)-1] {
+		var e treeEntry
+		if err := json.Unmarshal([]byte(line), &e); err != nil || e.Path == "" {
+			t.Fatalf("bad NDJSON entry line %q: %v", line, err)
+		}
+		entries = append(entries, e)
+	}
+	if got := paths(entries); got != "sub/b.txt,sub/deep,sub/deep/c.txt" {
+		t.Fatalf("ndjson entries = %s", got)
+	}
+	var summary treeSummary
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &summary); err != nil || !summary.Done || summary.Count != len(entries) {
+		t.Fatalf("bad NDJSON summary %q: %v", lines[len(lines)-1], err)
+	}
+
+	if rec := get("/api/tree?depth=-1"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a negative depth, got %d", rec.Code)
+	}
+	if rec := get("/api/tree?path=a.txt"); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a file, got %d", rec.Code)
+	}
+	if err := s.settings.Set(SettingKeyPermissions, json.RawMessage(`{"read":false}`)); err != nil {
+		t.Fatalf("set permissions: %v", err)
+	}
+	if rec := get("/api/tree"); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 without read permission, got %d", rec.Code)
+	}
+}
+
+func TestShareServerHostOnlySettingsHidden(t *testing.T) {
+	s := newTestShareServerWithSettings(t.TempDir())
+	h := s.Handler()
+	for _, key := range []string{
+		SettingKeyUploadQuotaBytes,
+		SettingKeyUploadDedup,
+		SettingKeySSEKeepAliveSeconds,
+		SettingKeySSEBufferSize,
+		SettingKeySSEMaxClientsPerIP,
+		SettingKeySSEMaxClients,
+		SettingKeyDownloadAllRoot,
+		SettingKeyAutoResume,
+		SettingKeyProtectWebUI,
+		SettingKeyAccessLogFile,
+		SettingKeyWatchIgnore,
+		SettingKeyNotifyClientConnected,
+		SettingKeyWatchDebounceMs,
+		SettingKeyWatchMaxDelayMs,
+		SettingKeyWatchMaxDirs,
+		SettingKeyZipIgnoreSuggestions,
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/settings/"+url.PathEscape(key), strings.NewReader(`{"value":0}`)))
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("PUT %s over HTTP = %d, want 404", key, rec.Code)
+		}
+		if _, ok, _ := s.settings.Get(key); ok {
+			t.Fatalf("%s was written over HTTP", key)
+		}
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/settings/"+url.PathEscape(key), nil))
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("GET %s over HTTP = %d, want 404", key, rec.Code)
+		}
+	}
+}
+
+func TestShareServerSettingsRouteCannotChangePermissions(t *testing.T) {
+	s := newTestShareServerWithSettings(t.TempDir())
+	h := s.Handler()
+	put := func(target, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, target, strings.NewReader(body)))
+		return rec
+	}
+
+	grant := `{"read":true,"write":true,"delete":true}`
+	if rec := put("/api/settings/"+url.PathEscape(SettingKeyPermissions), `{"value":`+grant+`}`); rec.Code != http.StatusNotFound {
+		t.Fatalf("PUT permissions over HTTP = %d, want 404", rec.Code)
+	}
+	rec := put("/api/settings", `{"values":{"`+SettingKeyPermissions+`":`+grant+`,"`+SettingKeyCustomPort+`":8080}}`)
+	var out struct {
+		OK      bool                           `json:"ok"`
+		Results map[string]settingsBatchResult `json:"results"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil || out.OK {
+		t.Fatalf("batch PUT = %d %s, want per-key failures", rec.Code, rec.Body.String())
+	}
+	for _, key := range []string{SettingKeyPermissions, SettingKeyCustomPort} {
+		if out.Results[key].Code != "SETTING_NOT_FOUND" {
+			t.Fatalf("batch result for %s = %+v", key, out.Results[key])
+		}
+		if _, ok, _ := s.settings.Get(key); ok {
+			t.Fatalf("%s was written over HTTP", key)
+		}
+	}
+	if perms := s.getPermissionsFromSettings(); perms.Delete {
+		t.Fatalf("guest granted itself %+v", perms)
+	}
+}
+
+func TestShareServerClientIPTrustedProxies(t *testing.T) {
+	s := newTestShareServerWithSettings(t.TempDir())
+
+	newReq := func(remote string, headers map[string]string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/api/files", nil)
+		r.RemoteAddr = remote
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		return r
+	}
+	spoofed := map[string]string{"X-Forwarded-For": "1.2.3.4"}
+
+	// Without trusted proxies the headers are ignored entirely.
+	if got := s.clientIP(newReq("127.0.0.1:5000", spoofed)); got != "127.0.0.1" {
+		t.Fatalf("expected headers ignored without trusted proxies, got %q", got)
+	}
+
+	if err := s.SetSetting(SettingKeyTrustedProxies, json.RawMessage(`["127.0.0.1","10.0.0.0/8"]`)); err != nil {
+		t.Fatalf("set trusted proxies: %v", err)
+	}
+
+	cases := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{"untrusted peer can't spoof", "192.168.1.20:5000", spoofed, "192.168.1.20"},
+		{"untrusted peer can't spoof via Forwarded", "192.168.1.20:5000", map[string]string{"Forwarded": "for=1.2.3.4"}, "192.168.1.20"},
+		{"trusted proxy without header", "127.0.0.1:5000", nil, "127.0.0.1"},
+		{"trusted proxy", "127.0.0.1:5000", map[string]string{"X-Forwarded-For": "192.168.1.30"}, "192.168.1.30"},
+		{"client-prepended entry is skipped", "127.0.0.1:5000", map[string]string{"X-Forwarded-For": "1.2.3.4, 192.168.1.30"}, "192.168.1.30"},
+		{"chain of trusted proxies", "127.0.0.1:5000", map[string]string{"X-Forwarded-For": "192.168.1.30, 10.1.2.3"}, "192.168.1.30"},
+		{"garbage entry stops the walk", "127.0.0.1:5000", map[string]string{"X-Forwarded-For": "192.168.1.30, not-an-ip"}, "127.0.0.1"},
+		{"Forwarded header", "127.0.0.1:5000", map[string]string{"Forwarded": `for="[2001:db8::1]:4711";proto=https`}, "2001:db8::1"},
+	}
+	for _, tc := range cases {
+		if got := s.clientIP(newReq(tc.remote, tc.headers)); got != tc.want {
+			t.Fatalf("%s: expected %q, got %q", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestShareServerWatchIgnoreSetting(t *testing.T) {
+	tmp := t.TempDir()
+	for _, dir := range []string{"src", "target/debug", "web/dist", "web/src"} {
+		if err := os.MkdirAll(filepath.Join(tmp, filepath.FromSlash(dir)), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+	}
+	_ = os.WriteFile(filepath.Join(tmp, "web", "dist", "app.js"), []byte("x"), 0o644)
+	_ = os.WriteFile(filepath.Join(tmp, "web", "src", "app.ts"), []byte("x"), 0o644)
+
+	s := newTestShareServerWithSettings(tmp)
+	s.opMu.Lock()
+	_ = s.resetWatcher(context.Background(), tmp)
+	s.opMu.Unlock()
+	defer func() {
+		s.opMu.Lock()
+		s.stopWatcher()
+		s.opMu.Unlock()
+	}()
+
+	watched := func(rel string) bool {
+		s.opMu.Lock()
+		defer s.opMu.Unlock()
+		_, ok := s.watcher.watched[filepath.Join(tmp, filepath.FromSlash(rel))]
+		return ok
+	}
+	if !watched("target") || !watched("web/dist") {
+		t.Fatalf("expected target and web/dist watched before the setting is set")
+	}
+
+	// Changing the setting rebuilds the running watcher.
+	if err := s.SetSetting(SettingKeyWatchIgnore, json.RawMessage(`["target","web/dist"]`)); err != nil {
+		t.Fatalf("set watch ignore: %v", err)
+	}
+	if watched("target") || watched("target/debug") || watched("web/dist") {
+		t.Fatalf("expected ignored dirs not to be watched")
+	}
+	if !watched("src") || !watched("web/src") {
+		t.Fatalf("expected other dirs still watched")
+	}
+
+	// Zip downloads skip the same directories.
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	body, _ := json.Marshal(map[string]any{"paths": []string{"web"}})
+	resp, err := ts.Client().Post(ts.URL+"/api/download-zip", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST /api/download-zip failed: %v", err)
+	}
+	zipBytes, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	zr, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	if err != nil {
+		t.Fatalf("open zip failed: %v (status %d)", err, resp.StatusCode)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	if len(names) != 1 || names[0] != "web/src/app.ts" {
+		t.Fatalf("expected only web/src/app.ts in zip, got %v", names)
+	}
+}
+
+type fakeBroadcaster struct {
+	mu      sync.Mutex
+	events  []string
+	payload []map[string]any
+}
+
+func (f *fakeBroadcaster) broadcast(event string, payload any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, event)
+	f.payload = append(f.payload, payload.(map[string]any))
+}
+
+func (f *fakeBroadcaster) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.events)
+}
+
+func TestWatchEventCoalescing(t *testing.T) {
+	cfg := watchCoalesceConfig{debounce: 250 * time.Millisecond, maxDelay: 2 * time.Second, maxDirs: 3}
+	hub := &fakeBroadcaster{}
+	var flushed []string
+	c := newEventCoalescer(cfg, hub, func(dirs []string) { flushed = append(flushed, dirs...) })
+
+	// A steady burst keeps debouncing, but never past maxDelay.
+	start := time.Now()
+	if wait := c.add("a", start); wait != cfg.debounce {
+		t.Fatalf("expected debounce wait, got %v", wait)
+	}
+	if wait := c.add("a", start.Add(1900*time.Millisecond)); wait != 100*time.Millisecond {
+		t.Fatalf("expected wait capped by maxDelay, got %v", wait)
+	}
+	if wait := c.add("a", start.Add(3*time.Second)); wait != 0 {
+		t.Fatalf("expected immediate flush once maxDelay passed, got %v", wait)
+	}
+	c.flush()
+	if len(hub.events) != 1 || hub.events[0] != "dirsChanged" {
+		t.Fatalf("expected one dirsChanged, got %v", hub.events)
+	}
+	if dirs := hub.payload[0]["dirs"].([]string); len(dirs) != 1 || dirs[0] != "a" {
+		t.Fatalf("expected duplicate dirs merged, got %v", dirs)
+	}
+
+	// More than maxDirs distinct dirs collapse into their common parent.
+	now := time.Now()
+	for _, d := range []string{"copy/x", "copy/x/1", "copy/y", "copy/z/2"} {
+		c.add(d, now)
+	}
+	c.flush()
+	if len(hub.events) != 2 || hub.events[1] != "subtreeChanged" {
+		t.Fatalf("expected subtreeChanged, got %v", hub.events)
+	}
+	if dir := hub.payload[1]["dir"]; dir != "copy" {
+		t.Fatalf("expected common parent copy, got %v", dir)
+	}
+	// The upload dedup cache still learns every dir.
+	if len(flushed) != 5 {
+		t.Fatalf("expected onFlush to get all dirs, got %v", flushed)
+	}
+
+	// Nothing pending: no event.
+	c.flush()
+	if len(hub.events) != 2 {
+		t.Fatalf("expected no event for an empty flush, got %v", hub.events)
+	}
+
+	if got := commonParentDir([]string{"a/b", "c"}); got != "" {
+		t.Fatalf("expected share root as common parent, got %q", got)
+	}
+}
+
+func TestDirectoryWatcherFlushTiming(t *testing.T) {
+	root := t.TempDir()
+	hub := &fakeBroadcaster{}
+	cfg := watchCoalesceConfig{debounce: 40 * time.Millisecond, maxDelay: time.Second, maxDirs: 32}
+	dw, err := newDirectoryWatcher(root, hub, cfg, nil, nil)
+	if err != nil {
+		t.Fatalf("newDirectoryWatcher: %v", err)
+	}
+	defer dw.watcher.Close()
+
+	events := make(chan fsnotify.Event)
+	done := make(chan struct{})
+	go func() {
+		dw.run(events, nil)
+		close(done)
+	}()
+	send := func(rel string) {
+		events <- fsnotify.Event{Name: filepath.Join(root, filepath.FromSlash(rel)), Op: fsnotify.Create}
+	}
+
+	// Events within the debounce window become one flush, after the window.
+	send("a/1.txt")
+	send("a/2.txt")
+	send("b/3.txt")
+	if n := hub.count(); n != 0 {
+		t.Fatalf("expected nothing flushed before the debounce elapsed, got %d", n)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for hub.count() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := hub.count(); n != 1 {
+		t.Fatalf("expected exactly one flush, got %d", n)
+	}
+	hub.mu.Lock()
+	dirs := hub.payload[0]["dirs"].([]string)
+	hub.mu.Unlock()
+	if len(dirs) != 2 {
+		t.Fatalf("expected dirs a and b, got %v", dirs)
+	}
+
+	// Stopping flushes what is pending exactly once, without waiting for the timer.
+	send("c/4.txt")
+	close(dw.stopCh)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("run did not return after stop")
+	}
+	if n := hub.count(); n != 2 {
+		t.Fatalf("expected the pending dir flushed on stop, got %d events", n)
+	}
+	hub.mu.Lock()
+	last := hub.payload[1]["dirs"].([]string)
+	hub.mu.Unlock()
+	if len(last) != 1 || last[0] != "c" {
+		t.Fatalf("expected c flushed on stop, got %v", last)
+	}
+}
+
+func TestDirectoryWatcherStopAfterFailedStart(t *testing.T) {
+	dw, err := newDirectoryWatcher(t.TempDir(), nil, defaultWatchCoalesceConfig, nil, nil)
+	if err != nil {
+		t.Fatalf("newDirectoryWatcher: %v", err)
+	}
+	// A closed fsnotify watcher makes adding the root fail.
+	_ = dw.watcher.Close()
+	if err := dw.Start(context.Background()); err == nil {
+		t.Fatalf("expected Start to fail")
+	}
+	stopped := make(chan struct{})
+	go func() {
+		dw.Stop()
+		dw.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatalf("Stop blocked after a failed Start")
+	}
+}
+
+func TestShareServerDownloadAll(t *testing.T) {
+	tmp := t.TempDir()
+	for _, dir := range []string{"photos/2024", "photos/.thumbs", "photos/cache"} {
+		_ = os.MkdirAll(filepath.Join(tmp, filepath.FromSlash(dir)), 0o755)
+	}
+	_ = os.WriteFile(filepath.Join(tmp, "photos", "a.jpg"), []byte("a"), 0o644)
+	_ = os.WriteFile(filepath.Join(tmp, "photos", "2024", "b.jpg"), []byte("b"), 0o644)
+	_ = os.WriteFile(filepath.Join(tmp, "photos", ".DS_Store"), []byte("x"), 0o644)
+	_ = os.WriteFile(filepath.Join(tmp, "photos", ".thumbs", "a.jpg"), []byte("x"), 0o644)
+	_ = os.WriteFile(filepath.Join(tmp, "photos", "cache", "c.bin"), []byte("x"), 0o644)
+
+	s := newTestShareServerWithSettings(tmp)
+	if err := s.SetSetting(SettingKeyWatchIgnore, json.RawMessage(`["cache"]`)); err != nil {
+		t.Fatalf("set watch ignore: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	resp, err := ts.Client().Get(ts.URL + "/api/download-all?path=photos")
+	if err != nil {
+		t.Fatalf("GET /api/download-all failed: %v", err)
+	}
+	zipBytes, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", resp.StatusCode, zipBytes)
+	}
+	if cd := resp.Header.Get("Content-Disposition"); !strings.Contains(cd, "photos.zip") {
+		t.Fatalf("expected photos.zip filename, got %q", cd)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	if err != nil {
+		t.Fatalf("open zip failed: %v", err)
+	}
+	got := map[string]bool{}
+	for _, f := range zr.File {
+		got[f.Name] = true
+	}
+	if len(got) != 2 || !got["photos/a.jpg"] || !got["photos/2024/b.jpg"] {
+		t.Fatalf("expected only visible, non-ignored files, got %v", got)
+	}
+
+	// The share root needs an explicit opt-in.
+	resp, err = ts.Client().Get(ts.URL + "/api/download-all")
+	if err != nil {
+		t.Fatalf("GET /api/download-all (root) failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for the share root, got %d", resp.StatusCode)
+	}
+	if err := s.SetSetting(SettingKeyDownloadAllRoot, json.RawMessage("true")); err != nil {
+		t.Fatalf("set download-all-root: %v", err)
+	}
+	resp, err = ts.Client().Get(ts.URL + "/api/download-all")
+	if err != nil {
+		t.Fatalf("GET /api/download-all (root) failed: %v", err)
+	}
+	zipBytes, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 for the share root once allowed, got %d", resp.StatusCode)
+	}
+	zr, err = zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	if err != nil {
+		t.Fatalf("open root zip failed: %v", err)
+	}
+	got = map[string]bool{}
+	for _, f := range zr.File {
+		got[f.Name] = true
+	}
+	if len(got) != 2 || !got["photos/a.jpg"] || !got["photos/2024/b.jpg"] {
+		t.Fatalf("unexpected root zip entries: %v", got)
+	}
+}
+
+func TestShareServerDownloadZip(t *testing.T) {
+	tmp := t.TempDir()
+	_ = os.WriteFile(filepath.Join(tmp, "a.txt"), []byte("aaa"), 0o644)
+	_ = os.WriteFile(filepath.Join(tmp, "b.txt"), []byte("bbb"), 0o644)
+
+	s := newTestShareServerWithRoot(tmp)
+
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	body, _ := json.Marshal(map[string]any{
+		"paths": []string{"a.txt", "b.txt"},
+	})
+	resp, err := ts.Client().Post(ts.URL+"/api/download-zip", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST /api/download-zip failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		t.Fatalf("expected 200, got %d, body=%s", resp.StatusCode, string(b))
+	}
+
+	zipBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read zip body failed: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	if err != nil {
+		t.Fatalf("zip reader failed: %v", err)
+	}
+
+	got := map[string]bool{}
+	for _, f := range zr.File {
+		got[f.Name] = true
+	}
+	if !got["a.txt"] || !got["b.txt"] {
+		t.Fatalf("zip missing files: got=%v", got)
+	}
+}
+
+func TestShareServerDownloadZipMissingPathReturnsJSONError(t *testing.T) {
+	tmp := t.TempDir()
+	_ = os.WriteFile(filepath.Join(tmp, "a.txt"), []byte("aaa"), 0o644)
+
+	s := newTestShareServerWithRoot(tmp)
+
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	body, _ := json.Marshal(map[string]any{
+		"paths": []string{"a.txt", "missing.txt"},
+	})
+	resp, err := ts.Client().Post(ts.URL+"/api/download-zip", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST /api/download-zip failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		t.Fatalf("expected non-200, got %d, body=%s", resp.StatusCode, string(b))
+	}
+
+	ct := strings.ToLower(resp.Header.Get("Content-Type"))
+	if !strings.Contains(ct, "application/json") {
+		b, _ := io.ReadAll(resp.Body)
+		t.Fatalf("expected json error response, ct=%q body=%q", ct, string(b))
+	}
+
+	var payload map[string]any
+	_ = json.NewDecoder(resp.Body).Decode(&payload)
+	if payload["error"] == nil {
+		t.Fatalf("expected error field, payload=%v", payload)
+	}
+}
+
+func TestShareServerDownloadZipCaseCollision(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		t.Skip("needs a case-sensitive filesystem to create both files")
+	}
+	tmp := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(tmp, "proj"), 0o755)
+	_ = os.WriteFile(filepath.Join(tmp, "proj", "Readme.md"), []byte("one"), 0o644)
+	_ = os.WriteFile(filepath.Join(tmp, "proj", "README.md"), []byte("two"), 0o644)
+
+	s := newTestShareServerWithRoot(tmp)
+
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	zipNames := func(caseInsensitive bool) []string {
+		body, _ := json.Marshal(map[string]any{
+			"paths":           []string{"proj"},
+			"caseInsensitive": caseInsensitive,
+		})
+		resp, err := ts.Client().Post(ts.URL+"/api/download-zip", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("POST /api/download-zip failed: %v", err)
+		}
+		defer resp.Body.Close()
+		zipBytes, _ := io.ReadAll(resp.Body)
+		zr, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+		if err != nil {
+			t.Fatalf("zip reader failed: %v", err)
+		}
+		var names []string
+		for _, f := range zr.File {
+			names = append(names, f.Name)
+		}
+		return names
+	}
+
+	got := zipNames(true)
+	lower := map[string]bool{}
+	for _, n := range got {
+		if lower[strings.ToLower(n)] {
+			t.Fatalf("expected case-insensitively distinct entries, got %v", got)
+		}
+		lower[strings.ToLower(n)] = true
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 entries, got %v", got)
+	}
+
+	// Without the flag (and a non-Windows UA) names are kept verbatim.
+	got = zipNames(false)
+	if len(got) != 2 || !(got[0] == "proj/README.md" || got[1] == "proj/README.md") {
+		t.Fatalf("expected original names, got %v", got)
+	}
+}
+
+func TestShareServerDelete(t *testing.T) {
+	tmp := t.TempDir()
+	pa := filepath.Join(tmp, "a.txt")
+	pb := filepath.Join(tmp, "b.txt")
+	_ = os.WriteFile(pa, []byte("aaa"), 0o644)
+	_ = os.WriteFile(pb, []byte("bbb"), 0o644)
+
+	s := newTestShareServerWithSettings(tmp)
+	allowDeleteForTest(t, s)
+
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	body, _ := json.Marshal(map[string]any{
+		"paths": []string{"a.txt", "b.txt"},
+	})
+	resp, err := ts.Client().Post(ts.URL+"/api/delete", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST /api/delete failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		t.Fatalf("expected 200, got %d, body=%s", resp.StatusCode, string(b))
+	}
+
+	if _, err := os.Stat(pa); !os.IsNotExist(err) {
+		t.Fatalf("expected a.txt to be deleted, stat err=%v", err)
+	}
+	if _, err := os.Stat(pb); !os.IsNotExist(err) {
+		t.Fatalf("expected b.txt to be deleted, stat err=%v", err)
+	}
+}
+
+func TestShareServerDeleteTooLargeForTrash(t *testing.T) {
+	tmp := t.TempDir()
+	big := filepath.Join(tmp, "big")
+	mkBig := func() {
+		t.Helper()
+		_ = os.MkdirAll(big, 0o755)
+		f, err := os.Create(filepath.Join(big, "disk.img"))
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		// Sparse: counts 2 MiB without writing them.
+		_ = f.Truncate(2 << 20)
+		_ = f.Close()
+	}
+	mkBig()
+
+	s := newTestShareServerWithSettings(tmp)
+	allowDeleteForTest(t, s)
+	if err := s.SetSetting(SettingKeyTrashMaxMB, json.RawMessage(`1`)); err != nil {
+		t.Fatalf("set trash max: %v", err)
+	}
+	// Only selections over the limit are tested, so nothing reaches the real
+	// Recycle Bin.
+	s.useTrash = true
+
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	del := func(permanent bool) (int, map[string]any) {
+		t.Helper()
+		body, _ := json.Marshal(map[string]any{"paths": []string{"big"}, "permanent": permanent})
+		resp, err := ts.Client().Post(ts.URL+"/api/delete", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("POST /api/delete failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var out map[string]any
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+
+	code, out := del(false)
+	if code != http.StatusConflict || out["code"] != "DELETE_TOO_LARGE_FOR_TRASH" || out["allowPermanent"] != true {
+		t.Fatalf("expected 409 DELETE_TOO_LARGE_FOR_TRASH, got %d %v", code, out)
+	}
+	if size, _ := out["sizeAtLeast"].(float64); size <= 1<<20 {
+		t.Fatalf("expected size over the limit, got %v", out["sizeAtLeast"])
+	}
+	if _, err := os.Stat(big); err != nil {
+		t.Fatalf("expected folder kept, stat err=%v", err)
+	}
+
+	if code, out := del(true); code != http.StatusOK || out["deleted"] != float64(1) {
+		t.Fatalf("expected permanent delete, got %d %v", code, out)
+	}
+	if _, err := os.Stat(big); !os.IsNotExist(err) {
+		t.Fatalf("expected folder deleted, stat err=%v", err)
+	}
+
+	mkBig()
+	if err := s.SetSetting(SettingKeyTrashTooLarge, json.RawMessage(`"refuse"`)); err != nil {
+		t.Fatalf("set trash too large: %v", err)
+	}
+	if code, out := del(true); code != http.StatusConflict || out["allowPermanent"] != false {
+		t.Fatalf("expected refusal, got %d %v", code, out)
+	}
+	if _, err := os.Stat(big); err != nil {
+		t.Fatalf("expected folder kept, stat err=%v", err)
+	}
+	if err := s.SetSetting(SettingKeyTrashTooLarge, json.RawMessage(`"never"`)); err == nil {
+		t.Fatalf("expected invalid value to be rejected")
+	}
+}
+
+func TestShareServerDownloadZipDirectory(t *testing.T) {
+	tmp := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(tmp, "dir"), 0o755)
+	_ = os.WriteFile(filepath.Join(tmp, "dir", "a.txt"), []byte("aaa"), 0o644)
+	_ = os.WriteFile(filepath.Join(tmp, "dir", "b.txt"), []byte("bbb"), 0o644)
+
+	s := newTestShareServerWithRoot(tmp)
+
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	body, _ := json.Marshal(map[string]any{
+		"paths": []string{"dir"},
+	})
+	resp, err := ts.Client().Post(ts.URL+"/api/download-zip", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST /api/download-zip failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		t.Fatalf("expected 200, got %d, body=%s", resp.StatusCode, string(b))
+	}
+
+	zipBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read zip body failed: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	if err != nil {
+		t.Fatalf("zip reader failed: %v", err)
+	}
+
+	got := map[string]bool{}
+	for _, f := range zr.File {
+		got[f.Name] = true
+	}
+	if !got["dir/a.txt"] || !got["dir/b.txt"] {
+		t.Fatalf("zip missing files: got=%v", got)
+	}
+}
+
+func TestShareServerDownloadZipIgnoreNodeModules(t *testing.T) {
+	tmp := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(tmp, "proj", "node_modules", "pkg"), 0o755)
+	_ = os.MkdirAll(filepath.Join(tmp, "proj", "src"), 0o755)
+	_ = os.WriteFile(filepath.Join(tmp, "proj", "node_modules", "pkg", "a.txt"), []byte("aaa"), 0o644)
+	_ = os.WriteFile(filepath.Join(tmp, "proj", "src", "main.ts"), []byte("console.log('hi')"), 0o644)
+
+	s := newTestShareServerWithRoot(tmp)
+
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	body, _ := json.Marshal(map[string]any{
+		"paths":  []string{"proj"},
+		"ignore": []string{"node_modules"},
+	})
+	resp, err := ts.Client().Post(ts.URL+"/api/download-zip", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST /api/download-zip failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		t.Fatalf("expected 200, got %d, body=%s", resp.StatusCode, string(b))
+	}
+
+	zipBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read zip body failed: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	if err != nil {
+		t.Fatalf("zip reader failed: %v", err)
+	}
+
+	got := map[string]bool{}
+	for _, f := range zr.File {
+		got[f.Name] = true
+	}
+	if !got["proj/src/main.ts"] {
+		t.Fatalf("expected src file in zip, got=%v", got)
+	}
+	if got["proj/node_modules/pkg/a.txt"] {
+		t.Fatalf("expected node_modules to be ignored, got=%v", got)
+	}
+}
+
+func TestShareServerDeleteDirectory(t *testing.T) {
+	tmp := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(tmp, "dir"), 0o755)
+	_ = os.WriteFile(filepath.Join(tmp, "dir", "a.txt"), []byte("aaa"), 0o644)
+
+	s := newTestShareServerWithSettings(tmp)
+	allowDeleteForTest(t, s)
+
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	body, _ := json.Marshal(map[string]any{
+		"paths": []string{"dir"},
+	})
+	resp, err := ts.Client().Post(ts.URL+"/api/delete", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST /api/delete failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		t.Fatalf("expected 200, got %d, body=%s", resp.StatusCode, string(b))
+	}
+
+	if _, err := os.Stat(filepath.Join(tmp, "dir")); !os.IsNotExist(err) {
+		t.Fatalf("expected dir to be deleted, stat err=%v", err)
+	}
+}
+
+func TestShareServerUploadQuota(t *testing.T) {
+	tmp := t.TempDir()
+
+	s := newTestShareServerWithSettings(tmp)
+	if err := s.settings.Set(SettingKeyUploadQuotaBytes, json.RawMessage("5")); err != nil {
+		t.Fatalf("set quota failed: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	resp := postUploadForTest(t, ts, "a.txt", []byte("aaa"))
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		t.Fatalf("expected 200, got %d, body=%s", resp.StatusCode, string(b))
+	}
+	var payload struct {
+		QuotaRemaining *int64 `json:"quotaRemaining"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&payload)
+	if payload.QuotaRemaining == nil || *payload.QuotaRemaining != 2 {
+		t.Fatalf("expected quotaRemaining=2, got %v", payload.QuotaRemaining)
+	}
+
+	// Failed uploads report the quota too, and don't use it up.
+	errQuota := func(resp *http.Response, wantStatus int) {
+		t.Helper()
+		defer resp.Body.Close()
+		var body struct {
+			QuotaRemaining *int64 `json:"quotaRemaining"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		if resp.StatusCode != wantStatus || body.QuotaRemaining == nil || *body.QuotaRemaining != 2 {
+			t.Fatalf("expected %d with quotaRemaining=2, got %d %v", wantStatus, resp.StatusCode, body.QuotaRemaining)
+		}
+	}
+	errQuota(postUploadForTest(t, ts, "a.txt", []byte("x")), http.StatusForbidden)
+	req, _ := http.NewRequest(http.MethodPut, ts.URL+"/api/put/a.txt?conflict=fail", strings.NewReader("x"))
+	putResp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("PUT failed: %v", err)
+	}
+	errQuota(putResp, http.StatusConflict)
+
+	resp2 := postUploadForTest(t, ts, "b.txt", []byte("bbb"))
+	defer resp2.Body.Close()
+	if resp2.StatusCode != http.StatusTooManyRequests {
+		b, _ := io.ReadAll(resp2.Body)
+		t.Fatalf("expected 429, got %d, body=%s", resp2.StatusCode, string(b))
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "b.txt")); !os.IsNotExist(err) {
+		t.Fatalf("expected rejected upload to be removed, stat err=%v", err)
+	}
+
+	// Resetting the counters (App.ResetUploadQuota) allows uploads again.
+	s.stats.resetUploads("")
+	resp3 := postUploadForTest(t, ts, "b.txt", []byte("bbb"))
+	defer resp3.Body.Close()
+	if resp3.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp3.Body)
+		t.Fatalf("expected 200 after reset, got %d, body=%s", resp3.StatusCode, string(b))
+	}
+}
+
+func TestShareServerUploadDedup(t *testing.T) {
+	tmp := t.TempDir()
+	_ = os.WriteFile(filepath.Join(tmp, "IMG_0042.jpg"), []byte("same-bytes"), 0o644)
+
+	s := newTestShareServerWithSettings(tmp)
+	if err := s.settings.Set(SettingKeyUploadDedup, json.RawMessage("true")); err != nil {
+		t.Fatalf("set dedup failed: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	type uploadResp struct {
+		Files []struct {
+			Path   string `json:"path"`
+			Status string `json:"status"`
+		} `json:"files"`
+	}
+
+	resp := postUploadForTest(t, ts, "IMG_0042 (1).jpg", []byte("same-bytes"))
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		t.Fatalf("expected 200, got %d, body=%s", resp.StatusCode, string(b))
+	}
+	var payload uploadResp
+	_ = json.NewDecoder(resp.Body).Decode(&payload)
+	if len(payload.Files) != 1 || payload.Files[0].Status != "duplicate" || payload.Files[0].Path != "IMG_0042.jpg" {
+		t.Fatalf("expected duplicate of IMG_0042.jpg, got %+v", payload.Files)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "IMG_0042 (1).jpg")); !os.IsNotExist(err) {
+		t.Fatalf("expected duplicate upload not to be written, stat err=%v", err)
+	}
+
+	// Same size, different content is stored normally.
+	resp2 := postUploadForTest(t, ts, "other.jpg", []byte("diff-bytes"))
+	defer resp2.Body.Close()
+	var payload2 uploadResp
+	_ = json.NewDecoder(resp2.Body).Decode(&payload2)
+	if len(payload2.Files) != 1 || payload2.Files[0].Status != "uploaded" {
+		t.Fatalf("expected uploaded status, got %+v", payload2.Files)
+	}
+	if b, err := os.ReadFile(filepath.Join(tmp, "other.jpg")); err != nil || string(b) != "diff-bytes" {
+		t.Fatalf("expected other.jpg to be written, got %q err=%v", string(b), err)
+	}
+}
+
+func TestUploadHashIndexBoundedForOneDirectory(t *testing.T) {
+	idx := newUploadHashIndex()
+	now := time.Now()
+	for i := 0; i < uploadHashIndexMaxEntries+100; i++ {
+		idx.store("/big", fmt.Sprintf("f%d", i), fileHashEntry{size: 1, modTime: now})
+	}
+	if idx.entries != uploadHashIndexMaxEntries || len(idx.dirs["/big"]) != uploadHashIndexMaxEntries {
+		t.Fatalf("expected %d entries, got %d (%d in the map)", uploadHashIndexMaxEntries, idx.entries, len(idx.dirs["/big"]))
+	}
+	// The newest entry is kept.
+	last := fmt.Sprintf("f%d", uploadHashIndexMaxEntries+99)
+	if _, ok := idx.lookup("/big", last, 1, now); !ok {
+		t.Fatalf("expected %s to stay cached", last)
+	}
+}
+
+func TestShareServerTrackClientsReportsFirstRequestOnly(t *testing.T) {
+	tmp := t.TempDir()
+	s := newTestShareServerWithRoot(tmp)
+
+	var connected []string
+	s.onClientConnected = func(ip string, userAgent string) {
+		connected = append(connected, ip+"|"+userAgent)
+	}
+
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(s.trackClients(mux))
+	defer ts.Close()
+
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/files", nil)
+		req.Header.Set("User-Agent", "test-agent")
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("GET /api/files failed: %v", err)
+		}
+		_ = resp.Body.Close()
+	}
+	if len(connected) != 1 || connected[0] != "127.0.0.1|test-agent" {
+		t.Fatalf("expected exactly one clientConnected, got %v", connected)
+	}
+}
+
+func TestShareServerShortCode(t *testing.T) {
+	tmp := t.TempDir()
+	s := newTestShareServerWithRoot(tmp)
+	s.shortCode = "012345"
+
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	client := ts.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	resp, err := client.Get(ts.URL + "/c/012345")
+	if err != nil {
+		t.Fatalf("GET /c/ failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != "/" {
+		t.Fatalf("expected 302 to /, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	resp, err = client.Get(ts.URL + "/c/999999")
+	if err != nil {
+		t.Fatalf("GET /c/ failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for wrong code, got %d", resp.StatusCode)
+	}
+}
+
+func TestSafeJoinWindowsDriveRoot(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("windows-only")
+	}
+
+	// Ensure drive root with trailing separator works.
+	full, ok := safeJoin(`D:\\`, `Windows`)
+	if !ok {
+		t.Fatalf("expected safeJoin(D:\\\\, Windows) ok")
+	}
+	if !strings.EqualFold(full, filepath.Clean(`D:\\Windows`)) {
+		t.Fatalf("unexpected full path: %q", full)
+	}
+
+	// Ensure bare volume root (D:) is normalized.
+	full2, ok2 := safeJoin(`D:`, `Windows`)
+	if !ok2 {
+		t.Fatalf("expected safeJoin(D:, Windows) ok")
+	}
+	if !strings.EqualFold(full2, filepath.Clean(`D:\\Windows`)) {
+		t.Fatalf("unexpected full path: %q", full2)
+	}
+}
+
+func TestMemorySettingsWatch(t *testing.T) {
+	m := NewMemorySettings()
+	var got []string
+	stop := m.Watch(func(key string, value json.RawMessage) {
+		got = append(got, key+"="+string(value))
+	})
+
+	_ = m.Set("a", json.RawMessage("1"))
+	_ = m.Delete("a")
+	stop()
+	_ = m.Set("b", json.RawMessage("2"))
+
+	if strings.Join(got, ",") != "a=1,a=" {
+		t.Fatalf("unexpected notifications: %v", got)
+	}
+	if _, ok, _ := m.Get("b"); !ok {
+		t.Fatalf("expected b to be stored")
+	}
+}
+
+func TestAccessLogRedactsAndTruncates(t *testing.T) {
+	tmp := t.TempDir()
+	_ = os.WriteFile(filepath.Join(tmp, "a.txt"), []byte("aaa"), 0o644)
+
+	s := newTestShareServerWithRoot(tmp)
+	s.accessLog = newAccessLog(3)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	for _, p := range []string{
+		"/api/files",
+		"/api/files?path=x",
+		"/api/download?path=a.txt&token=secret-token",
+		"/api/files?pass=hunter2",
+	} {
+		resp, err := ts.Client().Get(ts.URL + p)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", p, err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}
+
+	entries := s.AccessLog(0)
+	if len(entries) != 3 {
+		t.Fatalf("expected ring buffer to keep 3 entries, got %d", len(entries))
+	}
+	if entries[2].Path != "/api/files?path=x" {
+		t.Fatalf("expected oldest entry to be dropped, got %q", entries[2].Path)
+	}
+	dl := entries[1]
+	if dl.Path != "/api/download?path=a.txt&token=REDACTED" || dl.Status != http.StatusOK || dl.Bytes != 3 {
+		t.Fatalf("unexpected download entry: %+v", dl)
+	}
+	for _, e := range entries {
+		if strings.Contains(e.Path, "secret-token") || strings.Contains(e.Path, "hunter2") {
+			t.Fatalf("sensitive value logged: %q", e.Path)
+		}
+	}
+	if got := s.AccessLog(1); len(got) != 1 || got[0].Path != "/api/files?pass=REDACTED" {
+		t.Fatalf("expected newest entry first, got %+v", got)
+	}
+	u, _ := url.Parse("/api/download?dl=bearer&link=bearer&path=a.txt")
+	if got := redactedRequestPath(u); got != "/api/download?dl=REDACTED&link=REDACTED&path=a.txt" {
+		t.Fatalf("download tokens not redacted: %q", got)
+	}
+}
+
+func TestShareServerMetaMatchesRegisteredRoutes(t *testing.T) {
+	tmp := t.TempDir()
+	s := New(Options{Root: tmp, Settings: NewMemorySettings(), Version: "1.2.3"})
+
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	getMeta := func() Meta {
+		t.Helper()
+		resp, err := ts.Client().Get(ts.URL + "/api/meta")
+		if err != nil {
+			t.Fatalf("GET /api/meta failed: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", resp.StatusCode)
+		}
+		var meta Meta
+		if err := json.NewDecoder(resp.Body).Decode(&meta); err != nil {
+			t.Fatalf("decode meta failed: %v", err)
+		}
+		return meta
+	}
+
+	meta := getMeta()
+	if meta.Version != "1.2.3" || meta.Auth != "none" {
+		t.Fatalf("unexpected meta: %+v", meta)
+	}
+	for _, endpoint := range meta.Endpoints {
+		req := httptest.NewRequest(http.MethodGet, endpoint, nil)
+		if _, pattern := mux.Handler(req); pattern != endpoint {
+			t.Fatalf("advertised endpoint %q is served by pattern %q", endpoint, pattern)
+		}
+	}
+	for _, feature := range []string{"list", "upload", "download-zip", "events"} {
+		found := false
+		for _, f := range meta.Features {
+			found = found || f == feature
+		}
+		if !found {
+			t.Fatalf("feature %q missing from %v", feature, meta.Features)
+		}
+	}
+
+	pass, _ := json.Marshal("a1")
+	_ = s.settings.Set(SettingKeyAccessPass, pass)
+	meta = getMeta()
+	if meta.Auth != "pass" {
+		t.Fatalf("expected auth=pass, got %q", meta.Auth)
+	}
+}
+
+func TestShareServerProtectedWebUI(t *testing.T) {
+	tmp := t.TempDir()
+	s := newTestShareServerWithSettings(tmp)
+	s.assets = fstest.MapFS{
+		"index.html":      {Data: []byte("<!doctype html><title>spa</title>")},
+		"assets/index.js": {Data: []byte("console.log(1)")},
+	}
+	pass, _ := json.Marshal("a1")
+	_ = s.settings.Set(SettingKeyAccessPass, pass)
+
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	get := func(p string, cookie *http.Cookie) (int, string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+p, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", p, err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+
+	// Off by default: the SPA is public, only /api needs the token.
+	if code, body := get("/", nil); code != http.StatusOK || !strings.Contains(body, "spa") {
+		t.Fatalf("expected public SPA, got %d", code)
+	}
+
+	_ = s.settings.Set(SettingKeyProtectWebUI, json.RawMessage("true"))
+	code, body := get("/", nil)
+	if code != http.StatusUnauthorized || !strings.Contains(body, "/api/auth") || strings.Contains(body, "spa") {
+		t.Fatalf("expected inline login page, got %d %q", code, body)
+	}
+	if code, _ := get("/assets/index.js", nil); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for asset, got %d", code)
+	}
+
+	resp, err := ts.Client().Post(ts.URL+"/api/auth", "application/json", strings.NewReader(`{"pass":"a1"}`))
+	if err != nil {
+		t.Fatalf("POST /api/auth failed: %v", err)
+	}
+	var auth struct {
+		Token string `json:"token"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&auth)
+	_ = resp.Body.Close()
+	var cookie *http.Cookie
+	for _, c := range resp.Cookies() {
+		if c.Name == cookieShareToken {
+			cookie = c
+		}
+	}
+	if auth.Token == "" || cookie == nil || cookie.Value != auth.Token || !cookie.HttpOnly {
+		t.Fatalf("expected token cookie, got token=%q cookie=%+v", auth.Token, cookie)
+	}
+
+	if code, body := get("/", cookie); code != http.StatusOK || !strings.Contains(body, "spa") {
+		t.Fatalf("expected SPA with cookie, got %d", code)
+	}
+	if code, _ := get("/assets/index.js", cookie); code != http.StatusOK {
+		t.Fatalf("expected asset with cookie, got %d", code)
+	}
+	// Token-in-query (EventSource / downloads) keeps working for the API.
+	if code, _ := get("/api/files?token="+auth.Token, nil); code != http.StatusOK {
+		t.Fatalf("expected /api/files with query token to succeed, got %d", code)
+	}
+}
+
+// The login page of the protected web UI answers the auth challenge the way
+// the SPA does: decimal nonces, sent back with the pass.
+func TestShareServerProtectedWebUIChallenge(t *testing.T) {
+	s := newTestShareServerWithSettings(t.TempDir())
+	s.assets = fstest.MapFS{"index.html": {Data: []byte("<!doctype html><title>spa</title>")}}
+	if err := s.SetAccessPass("a1"); err != nil {
+		t.Fatal(err)
+	}
+	for key, v := range map[string]string{
+		SettingKeyProtectWebUI:            "true",
+		SettingKeyAuthChallenge:           "true",
+		SettingKeyAuthChallengeThreshold:  "1",
+		SettingKeyAuthChallengeDifficulty: "8",
+	} {
+		if err := s.SetSetting(key, json.RawMessage(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	resp, err := ts.Client().Get(ts.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	for _, want := range []string{`"AUTH_CHALLENGE"`, "resp.status === 428", "challenge: challenge"} {
+		if !strings.Contains(string(page), want) {
+			t.Fatalf("login page doesn't handle the challenge: missing %s", want)
+		}
+	}
+
+	post := func(body any) *http.Response {
+		t.Helper()
+		b, _ := json.Marshal(body)
+		resp, err := ts.Client().Post(ts.URL+"/api/auth", "application/json", bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	for _, wrong := range []string{"x1", "x2"} {
+		post(map[string]string{"pass": wrong}).Body.Close()
+	}
+	resp = post(map[string]string{"pass": "a1"})
+	var challenged struct {
+		Code      string        `json:"code"`
+		Challenge authChallenge `json:"challenge"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&challenged)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPreconditionRequired || challenged.Code != "AUTH_CHALLENGE" {
+		t.Fatalf("expected a challenge, got %d %+v", resp.StatusCode, challenged)
+	}
+
+	nonce := 0
+	for leadingZeroBits(sha256.Sum256([]byte(challenged.Challenge.Prefix+":"+strconv.Itoa(nonce)))) < challenged.Challenge.Difficulty {
+		nonce++
+	}
+	resp = post(map[string]any{"pass": "a1", "challenge": authChallengeSolution{Prefix: challenged.Challenge.Prefix, Nonce: strconv.Itoa(nonce)}})
+	resp.Body.Close()
+	var cookie *http.Cookie
+	for _, c := range resp.Cookies() {
+		if c.Name == cookieShareToken {
+			cookie = c
+		}
+	}
+	if resp.StatusCode != http.StatusOK || cookie == nil {
+		t.Fatalf("expected a token cookie for the solved challenge, got %d", resp.StatusCode)
+	}
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/", nil)
+	req.AddCookie(cookie)
+	resp, err = ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the SPA after login, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,129 @@
+package shareserver
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// spaBootstrapMarker in index.html is replaced with a script that sets
+// window.__LOCAL_SHARE_BOOTSTRAP__, so the web UI knows where it is without a
+// first round trip to /api. Builds without the marker are served unchanged.
+const spaBootstrapMarker = "<!--local-share:bootstrap-->"
+
+// spaBrowsePrefix is the query-less deep link form: /browse/docs/reports.
+const spaBrowsePrefix = "/browse/"
+
+type spaBootstrap struct {
+	// Auth is "pass" when API calls need a token, like Meta.Auth.
+	Auth string `json:"auth"`
+	// RootName is left out while a pass is required.
+	RootName string `json:"rootName,omitempty"`
+	// Path is the requested share-relative folder, plain (not base64).
+	Path string `json:"path"`
+	// BasePath is the URL prefix the app is served under, see SettingKeyBasePath.
+	BasePath string `json:"basePath,omitempty"`
+}
+
+func (s *Server) spaBootstrap(r *http.Request) spaBootstrap {
+	s.mu.RLock()
+	root := s.sharedRoot
+	s.mu.RUnlock()
+
+	b := spaBootstrap{Auth: s.Meta().Auth, Path: requestedSharePath(r), BasePath: requestBasePath(r)}
+	if root != "" && b.Auth == "none" {
+		b.RootName = sharedRootName(root)
+	}
+	if b.Path != "" {
+		if root == "" {
+			b.Path = ""
+		} else if validatePath(b.Path, s.maxPathBytes()) != nil {
+			b.Path = ""
+		} else if _, ok := safeJoin(root, b.Path); !ok {
+			b.Path = ""
+		}
+	}
+	return b
+}
+
+func isBrowsePath(p string) bool {
+	return strings.HasPrefix(p, spaBrowsePrefix)
+}
+
+// browseBaseHref points relative asset URLs (the build uses base "./") back at
+// the app root from a /browse/ deep link, while still working behind a proxy
+// that mounts the app under a sub-path.
+func browseBaseHref(p string) string {
+	if !isBrowsePath(p) {
+		return ""
+	}
+	return strings.Repeat("../", strings.Count(p, "/")-1)
+}
+
+// requestedSharePath reads ?path= (base64url per segment, as the web UI
+// writes it) or, without it, a /browse/<path> deep link.
+func requestedSharePath(r *http.Request) string {
+	if q := r.URL.Query().Get("path"); q != "" {
+		return decodeSharePathQuery(q)
+	}
+	if isBrowsePath(r.URL.Path) {
+		return normalizeSharePath(strings.TrimPrefix(r.URL.Path, spaBrowsePrefix))
+	}
+	return ""
+}
+
+// decodeSharePathQuery undoes FolderURL's encoding. Like the web UI, it
+// falls back to the raw value when a segment isn't valid base64url.
+func decodeSharePathQuery(q string) string {
+	parts := strings.Split(normalizeSharePath(q), "/")
+	for i, p := range parts {
+		b, err := base64.RawURLEncoding.DecodeString(p)
+		if err != nil {
+			return normalizeSharePath(q)
+		}
+		parts[i] = string(b)
+	}
+	return normalizeSharePath(strings.Join(parts, "/"))
+}
+
+func normalizeSharePath(p string) string {
+	var out []string
+	for _, part := range strings.Split(p, "/") {
+		if part != "" {
+			out = append(out, part)
+		}
+	}
+	return strings.Join(out, "/")
+}
+
+// serveIndexHTML serves index.html with the bootstrap injected. It reports
+// false when the file has no marker, leaving it to the plain static path.
+func (s *Server) serveIndexHTML(w http.ResponseWriter, r *http.Request, staticFS fs.FS, fileName string) bool {
+	data, err := fs.ReadFile(staticFS, fileName)
+	if err != nil || !bytes.Contains(data, []byte(spaBootstrapMarker)) {
+		return false
+	}
+	payload, err := json.Marshal(s.spaBootstrap(r)) // escapes <, > and &
+	if err != nil {
+		return false
+	}
+	var script []byte
+	if href := browseBaseHref(r.URL.Path); href != "" {
+		script = append(script, `<base href="`+href+`">`...)
+	}
+	script = append(script, "<script>window.__LOCAL_SHARE_BOOTSTRAP__="...)
+	script = append(append(script, payload...), "</script>"...)
+	data = bytes.Replace(data, []byte(spaBootstrapMarker), script, 1)
+
+	// The page now depends on the request; never answer 304 from its mtime.
+	if w.Header().Get("Cache-Control") == "" {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	http.ServeContent(w, r, path.Base(fileName), time.Time{}, bytes.NewReader(data))
+	return true
+}
@@ -0,0 +1,37 @@
+package shareserver
+
+import (
+	"net/http"
+	"strings"
+)
+
+// encodedAssetPathTricks are escapes no URL the web UI builds contains: an
+// encoded dot, separator or NUL only shows up when a client tries to sneak a
+// path past the checks on the decoded form. "%25" stays allowed so /browse/
+// links to folders with a "%" in their name keep working; the path is only
+// decoded once.
+var encodedAssetPathTricks = []string{"%2e", "%2f", "%5c", "%00"}
+
+// badAssetPath reports whether a static request path should be refused
+// before it goes near the asset FS. A custom dist directory is served through
+// os.DirFS, where a backslash is a separator on Windows and the rules differ
+// from the embedded FS, so anything that could read differently there is
+// rejected instead of cleaned.
+func badAssetPath(r *http.Request) bool {
+	p := r.URL.Path
+	if strings.ContainsAny(p, "\\\x00") {
+		return true
+	}
+	for _, seg := range strings.Split(p, "/") {
+		if seg == ".." {
+			return true
+		}
+	}
+	raw := strings.ToLower(r.URL.EscapedPath())
+	for _, trick := range encodedAssetPathTricks {
+		if strings.Contains(raw, trick) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package shareserver
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// shareStats 收集共享期间的运行时统计，仅保存在内存中，应用重启后清零。
+type shareStats struct {
+	mu           sync.Mutex
+	uploadedByIP map[string]int64
+	seenClients  map[string]struct{}
+}
+
+func newShareStats() *shareStats {
+	return &shareStats{uploadedByIP: map[string]int64{}, seenClients: map[string]struct{}{}}
+}
+
+// markClientSeen records ip and reports whether it is the first time since the last reset.
+func (st *shareStats) markClientSeen(ip string) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if _, ok := st.seenClients[ip]; ok {
+		return false
+	}
+	st.seenClients[ip] = struct{}{}
+	return true
+}
+
+func (st *shareStats) resetClients() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.seenClients = map[string]struct{}{}
+}
+
+func (st *shareStats) uploadedBytes(ip string) int64 {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.uploadedByIP[ip]
+}
+
+func (st *shareStats) addUploaded(ip string, n int64) {
+	if n == 0 {
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	v := st.uploadedByIP[ip] + n
+	if v <= 0 {
+		delete(st.uploadedByIP, ip)
+		return
+	}
+	st.uploadedByIP[ip] = v
+}
+
+// resetUploads clears the upload counter of ip, or of every client when ip is empty.
+func (st *shareStats) resetUploads(ip string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if ip == "" {
+		st.uploadedByIP = map[string]int64{}
+		return
+	}
+	delete(st.uploadedByIP, ip)
+}
+
+func (st *shareStats) uploadsSnapshot() map[string]int64 {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	out := make(map[string]int64, len(st.uploadedByIP))
+	for ip, n := range st.uploadedByIP {
+		out[ip] = n
+	}
+	return out
+}
+
+var errUploadQuotaExceeded = errors.New("upload quota exceeded")
+
+// quotaReader counts bytes read on behalf of a client IP and stops with
+// errUploadQuotaExceeded once the client's quota is used up.
+// limit <= 0 means unlimited (bytes are still counted).
+type quotaReader struct {
+	r     io.Reader
+	stats *shareStats
+	ip    string
+	limit int64
+	n     int64
+}
+
+func (q *quotaReader) Read(p []byte) (int, error) {
+	if q.limit > 0 {
+		remaining := q.limit - q.stats.uploadedBytes(q.ip)
+		if remaining <= 0 {
+			// The file may end exactly at the quota boundary; only fail if more data follows.
+			var one [1]byte
+			n, err := q.r.Read(one[:])
+			if n == 0 {
+				return 0, err
+			}
+			return 0, errUploadQuotaExceeded
+		}
+		if int64(len(p)) > remaining {
+			p = p[:remaining]
+		}
+	}
+	n, err := q.r.Read(p)
+	q.n += int64(n)
+	q.stats.addUploaded(q.ip, int64(n))
+	return n, err
+}
+
+// refund gives back the bytes counted for an upload that was not kept.
+func (q *quotaReader) refund() {
+	q.stats.addUploaded(q.ip, -q.n)
+	q.n = 0
+}
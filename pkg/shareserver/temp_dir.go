@@ -0,0 +1,32 @@
+package shareserver
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+// SettingKeyTempDir (JSON string) is where temporaries go: archive-job
+// spools (unless SettingKeyArchiveSpoolDir says otherwise), update
+// extraction, diagnostics zips. Empty means the system temp dir. Upload
+// partials stay next to their target so they can be renamed into place.
+const SettingKeyTempDir = "local-share:temp-dir"
+
+// TempDir resolves SettingKeyTempDir. It is read on every call, so an
+// operation keeps the directory it started with when the setting moves; a
+// configured directory that has gone away falls back to os.TempDir().
+func (s *Server) TempDir() string {
+	if s.settings != nil {
+		if raw, ok, err := s.settings.Get(SettingKeyTempDir); err == nil && ok && len(raw) > 0 {
+			var dir string
+			if json.Unmarshal(raw, &dir) == nil && strings.TrimSpace(dir) != "" {
+				dir = strings.TrimSpace(dir)
+				if st, err := os.Stat(dir); err == nil && st.IsDir() {
+					return dir
+				}
+				s.logf("temp dir %q unavailable, using %q", dir, os.TempDir())
+			}
+		}
+	}
+	return os.TempDir()
+}
@@ -0,0 +1,192 @@
+//go:build windows
+
+package shareserver
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	clsidFileOperation = windows.GUID{Data1: 0x3ad05575, Data2: 0x8857, Data3: 0x4850, Data4: [8]byte{0x92, 0x77, 0x11, 0xb8, 0x5b, 0xdb, 0x8e, 0x09}}
+	iidIFileOperation  = windows.GUID{Data1: 0x947aab5f, Data2: 0x0a5c, Data3: 0x4c13, Data4: [8]byte{0xb4, 0xd6, 0x4b, 0xf7, 0x83, 0x6f, 0xc9, 0xf8}}
+	iidIShellItem      = windows.GUID{Data1: 0x43826d1e, Data2: 0xe718, Data3: 0x42ee, Data4: [8]byte{0xbc, 0x55, 0xa1, 0xe2, 0x61, 0xc3, 0x7b, 0xfe}}
+
+	ole32                           = windows.NewLazySystemDLL("ole32.dll")
+	procCoCreateInstance            = ole32.NewProc("CoCreateInstance")
+	shell32Trash                    = windows.NewLazySystemDLL("shell32.dll")
+	procSHCreateItemFromParsingName = shell32Trash.NewProc("SHCreateItemFromParsingName")
+	procSHFileOperationW            = shell32Trash.NewProc("SHFileOperationW")
+)
+
+const (
+	// https://learn.microsoft.com/windows/win32/api/shobjidl_core/nf-shobjidl_core-ifileoperation-setoperationflags
+	fofSilent           = 0x0004
+	fofNoConfirmation   = 0x0010
+	fofAllowUndo        = 0x0040
+	fofNoErrorUI        = 0x0400
+	fofNoConnectedElem  = 0x2000
+	fofxRecycleOnDelete = 0x00080000
+
+	clsctxAll = 0x17
+
+	// IFileOperation vtable slots (IUnknown occupies 0..2).
+	vtblRelease                 = 2
+	vtblSetOperationFlags       = 5
+	vtblDeleteItem              = 18
+	vtblPerformOperations       = 21
+	vtblGetAnyOperationsAborted = 22
+)
+
+// moveToTrash moves a file/folder to the Windows Recycle Bin.
+// It is best-effort and does not show UI.
+//
+// IFileOperation is preferred: unlike SHFileOperationW it copes with paths
+// longer than MAX_PATH and with cloud-backed (OneDrive) folders.
+func moveToTrash(path string) error {
+	if path == "" {
+		return errors.New("empty path")
+	}
+	err := moveToTrashFileOperation(path)
+	if err == nil {
+		return nil
+	}
+	// Very old systems may lack IFileOperation; fall back to the legacy API.
+	if legacyErr := moveToTrashLegacy(path); legacyErr != nil {
+		return fmt.Errorf("%v; legacy: %v", err, legacyErr)
+	}
+	return nil
+}
+
+// comObject mirrors the memory layout of a COM interface pointer.
+type comObject struct {
+	vtbl *[32]uintptr
+}
+
+func comCall(obj *comObject, slot int, args ...uintptr) uintptr {
+	r1, _, _ := syscall.SyscallN(obj.vtbl[slot], append([]uintptr{uintptr(unsafe.Pointer(obj))}, args...)...)
+	return r1
+}
+
+func hresultErr(op string, hr uintptr) error {
+	if int32(hr) >= 0 {
+		return nil
+	}
+	return fmt.Errorf("%s failed: hr=0x%08x", op, uint32(hr))
+}
+
+func moveToTrashFileOperation(path string) error {
+	// COM apartments are per-thread.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	switch err := windows.CoInitializeEx(0, windows.COINIT_APARTMENTTHREADED|windows.COINIT_DISABLE_OLE1DDE); {
+	case err == nil || errors.Is(err, syscall.Errno(0x00000001)): // S_FALSE: already initialized on this thread
+		defer windows.CoUninitialize()
+	case errors.Is(err, syscall.Errno(0x80010106)): // RPC_E_CHANGED_MODE: COM is usable as-is
+	default:
+		return err
+	}
+
+	var op *comObject
+	hr, _, _ := procCoCreateInstance.Call(
+		uintptr(unsafe.Pointer(&clsidFileOperation)),
+		0,
+		clsctxAll,
+		uintptr(unsafe.Pointer(&iidIFileOperation)),
+		uintptr(unsafe.Pointer(&op)),
+	)
+	if err := hresultErr("CoCreateInstance(FileOperation)", hr); err != nil {
+		return err
+	}
+	defer comCall(op, vtblRelease)
+
+	flags := uintptr(fofAllowUndo | fofNoConfirmation | fofSilent | fofNoErrorUI | fofNoConnectedElem | fofxRecycleOnDelete)
+	if err := hresultErr("SetOperationFlags", comCall(op, vtblSetOperationFlags, flags)); err != nil {
+		return err
+	}
+
+	// The shell namespace parser doesn't understand the \\?\ prefix; IFileOperation
+	// itself handles long paths once it has the item.
+	name, err := windows.UTF16PtrFromString(stripLongPathPrefix(path))
+	if err != nil {
+		return err
+	}
+	var item *comObject
+	hr, _, _ = procSHCreateItemFromParsingName.Call(
+		uintptr(unsafe.Pointer(name)),
+		0,
+		uintptr(unsafe.Pointer(&iidIShellItem)),
+		uintptr(unsafe.Pointer(&item)),
+	)
+	if err := hresultErr("SHCreateItemFromParsingName", hr); err != nil {
+		return err
+	}
+	defer comCall(item, vtblRelease)
+
+	if err := hresultErr("DeleteItem", comCall(op, vtblDeleteItem, uintptr(unsafe.Pointer(item)), 0)); err != nil {
+		return err
+	}
+	if err := hresultErr("PerformOperations", comCall(op, vtblPerformOperations)); err != nil {
+		return err
+	}
+	var aborted int32
+	if err := hresultErr("GetAnyOperationsAborted", comCall(op, vtblGetAnyOperationsAborted, uintptr(unsafe.Pointer(&aborted)))); err != nil {
+		return err
+	}
+	if aborted != 0 {
+		return errors.New("move to recycle bin aborted")
+	}
+	return nil
+}
+
+func moveToTrashLegacy(path string) error {
+	// SHFileOperationW expects a double-NUL-terminated string list.
+	p16, err := windows.UTF16FromString(stripLongPathPrefix(path))
+	if err != nil {
+		return err
+	}
+	from := append(p16, 0) // add the extra NUL terminator
+
+	type shFileOpStructW struct {
+		hwnd                  uintptr
+		wFunc                 uint32
+		pFrom                 *uint16
+		pTo                   *uint16
+		fFlags                uint16
+		fAnyOperationsAborted int32
+		hNameMappings         uintptr
+		lpszProgressTitle     *uint16
+	}
+
+	const foDelete = 0x0003
+
+	op := shFileOpStructW{
+		wFunc:  foDelete,
+		pFrom:  &from[0],
+		fFlags: fofAllowUndo | fofNoConfirmation | fofSilent | fofNoErrorUI | fofNoConnectedElem,
+	}
+
+	r1, _, _ := procSHFileOperationW.Call(uintptr(unsafe.Pointer(&op)))
+	if r1 != 0 {
+		// SHFileOperation returns non-zero on failure; it's an HRESULT-like code.
+		return fmt.Errorf("move to recycle bin failed: code=%d", r1)
+	}
+	if op.fAnyOperationsAborted != 0 {
+		return errors.New("move to recycle bin aborted")
+	}
+	return nil
+}
+
+func stripLongPathPrefix(p string) string {
+	if strings.HasPrefix(p, `\\?\UNC\`) {
+		return `\\` + p[len(`\\?\UNC\`):]
+	}
+	return strings.TrimPrefix(p, `\\?\`)
+}
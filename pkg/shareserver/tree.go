@@ -0,0 +1,252 @@
+package shareserver
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxTreeEntries caps one /api/tree answer; the rest is left out and
+// Truncated is set. Mirror scripts can ask for subfolders one by one.
+const maxTreeEntries = 100000
+
+// treeEntry is one file or folder of an /api/tree export.
+type treeEntry struct {
+	// Path is share-relative.
+	Path     string `json:"path"`
+	Type     string `json:"type"` // "file" | "directory"
+	Size     int64  `json:"size"`
+	Modified string `json:"modified"`
+	// SHA256 is only set with hashes=1, for files whose sum is already known
+	// from an up-to-date sidecar or the hash cache.
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// treeSummary ends an /api/tree answer: the last line of an NDJSON stream,
+// the trailing fields of the JSON document. A stream without it was cut
+// short.
+type treeSummary struct {
+	Done      bool `json:"done"`
+	Count     int  `json:"count"`
+	Truncated bool `json:"truncated"`
+}
+
+// treeWriter writes the entries of an /api/tree answer as they are found,
+// flushing every listBatchSize entries. Nothing is written before start, so
+// an error found first can still be answered properly.
+type treeWriter struct {
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	ndjson  bool
+	rel     string
+	started bool
+	count   int
+}
+
+func (tw *treeWriter) start() error {
+	if tw.started {
+		return nil
+	}
+	tw.started = true
+	h := tw.w.Header()
+	if tw.ndjson {
+		h.Set("Content-Type", "application/x-ndjson; charset=utf-8")
+	} else {
+		h.Set("Content-Type", "application/json; charset=utf-8")
+	}
+	h.Set("Cache-Control", "no-store")
+	h.Set("X-Content-Type-Options", "nosniff")
+	tw.w.WriteHeader(http.StatusOK)
+	if tw.ndjson {
+		return nil
+	}
+	p, _ := json.Marshal(tw.rel)
+	_, err := io.WriteString(tw.w, `{"path":`+string(p)+`,"entries":[`)
+	return err
+}
+
+func (tw *treeWriter) entry(e treeEntry) error {
+	if err := tw.start(); err != nil {
+		return err
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	switch {
+	case tw.ndjson:
+		b = append(b, '\n')
+	case tw.count > 0:
+		b = append([]byte{','}, b...)
+	}
+	if _, err := tw.w.Write(b); err != nil {
+		return err
+	}
+	if tw.count++; tw.count%listBatchSize == 0 {
+		return tw.rc.Flush()
+	}
+	return nil
+}
+
+func (tw *treeWriter) finish(truncated bool) {
+	if tw.start() != nil {
+		return
+	}
+	sum := treeSummary{Done: true, Count: tw.count, Truncated: truncated}
+	if tw.ndjson {
+		_ = json.NewEncoder(tw.w).Encode(sum)
+		return
+	}
+	b, _ := json.Marshal(sum)
+	// The summary's fields close the document next to "entries".
+	_, _ = io.WriteString(tw.w, "],"+strings.TrimPrefix(string(b), "{")+"\n")
+}
+
+// handleTree exports the subtree of a folder (?path=docs) in one request, for
+// scripts that mirror the share: ?depth=N stops N levels below the folder (0
+// or unset means all the way down), ?hashes=1 adds the SHA-256 of files whose
+// sum is already known (nothing is hashed for it) and ?ndjson=1 answers one
+// entry per line instead of a JSON document. Hidden entries and the
+// share-wide ignore list are left out, and symlinks aren't followed.
+func (s *Server) handleTree(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "仅支持 GET"})
+		return
+	}
+
+	s.mu.RLock()
+	root := s.sharedRoot
+	s.mu.RUnlock()
+	if root == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "服务未启动"})
+		return
+	}
+	if !s.requireAuth(w, r) {
+		return
+	}
+	if !s.requirePermission(w, "read") {
+		return
+	}
+
+	q := r.URL.Query()
+	depth := 0
+	if v := strings.TrimSpace(q.Get("depth")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "depth 必须是非负整数"})
+			return
+		}
+		depth = n
+	}
+	withHashes := q.Get("hashes") == "1"
+
+	fullPath, ok := s.resolveSharePath(w, r, root, strings.TrimSpace(q.Get("path")))
+	if !ok {
+		return
+	}
+	st, err := os.Stat(fullPath)
+	if err != nil || !st.IsDir() {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "目录不存在"})
+		return
+	}
+	rel := relativeSharePath(root, fullPath)
+
+	rules := s.hiddenRules()
+	ignore := newZipIgnore(s.getWatchIgnoreFromSettings())
+	tw := &treeWriter{w: w, rc: http.NewResponseController(w), ndjson: q.Get("ndjson") == "1", rel: rel}
+	truncated := false
+	err = filepath.WalkDir(fullPath, func(p string, d fs.DirEntry, walkErr error) error {
+		if err := r.Context().Err(); err != nil {
+			return err
+		}
+		if p == fullPath {
+			// The folder itself isn't an entry; failing to read it is the
+			// answer.
+			return walkErr
+		}
+		if walkErr != nil {
+			// An unreadable subfolder is left out, as in a zip.
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type()&fs.ModeSymlink != 0 || ignore.name(d.Name()) || isHiddenPath(filepath.Dir(p), d.Name(), rules) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		relInside, err := filepath.Rel(fullPath, p)
+		if err != nil {
+			return nil
+		}
+		relInside = filepath.ToSlash(relInside)
+		entryPath := path.Join(rel, relInside)
+		if ignore.entry(entryPath) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || (!d.IsDir() && !info.Mode().IsRegular()) {
+			return nil
+		}
+		if tw.count >= maxTreeEntries {
+			truncated = true
+			return fs.SkipAll
+		}
+
+		e := treeEntry{Path: entryPath, Type: "directory", Modified: info.ModTime().UTC().Format(time.RFC3339)}
+		if !d.IsDir() {
+			e.Type, e.Size = "file", info.Size()
+			if withHashes {
+				e.SHA256 = s.knownSHA256(p, info)
+			}
+		}
+		if err := tw.entry(e); err != nil {
+			return err
+		}
+		if d.IsDir() && depth > 0 && strings.Count(relInside, "/")+1 >= depth {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if r.Context().Err() != nil {
+		// The client is gone; nobody reads the rest.
+		return
+	}
+	if err != nil {
+		if !tw.started {
+			writeReadDirError(w, err)
+			return
+		}
+		// Too late for a status: leave the summary out so the client can
+		// tell the answer is incomplete.
+		s.logf("tree %s: %v", fullPath, err)
+		return
+	}
+	tw.finish(truncated)
+}
+
+// knownSHA256 is the hex SHA-256 of the file at p from its sidecar or the
+// hash cache, or "" when neither has it. It never reads the file itself.
+func (s *Server) knownSHA256(p string, st os.FileInfo) string {
+	if sum, ok := s.readChecksumSidecar(p, st); ok {
+		return hex.EncodeToString(sum[:])
+	}
+	if sum, ok := s.uploadHashes.lookup(filepath.Dir(p), filepath.Base(p), st.Size(), st.ModTime()); ok {
+		return hex.EncodeToString(sum[:])
+	}
+	return ""
+}
@@ -0,0 +1,55 @@
+package shareserver
+
+// ServerInfo matches the shape expected by the existing mobile web UI.
+type ServerInfo struct {
+	URL          string `json:"url"`
+	Port         int    `json:"port"`
+	LocalIP      string `json:"localIP"`
+	SharedFolder string `json:"sharedFolder"`
+	// ShortCode is a per-session numeric code; ShortURL is URL + "/c/" + ShortCode.
+	ShortCode string `json:"shortCode"`
+	ShortURL  string `json:"shortURL"`
+	// Removable is true when the shared folder is on removable media (Windows).
+	Removable bool `json:"removable"`
+	// RedirectFrom is the extra port (80 or 8080) redirecting to URL, 0 if none.
+	RedirectFrom int `json:"redirectFrom,omitempty"`
+	// ReadOnly is true while SettingKeyReadOnly forces a read-only share.
+	ReadOnly bool `json:"readOnly"`
+	// ExpiresIn is how many seconds are left before the share stops by
+	// itself (SetExpiry), 0 when it doesn't expire.
+	ExpiresIn int `json:"expiresIn,omitempty"`
+	// LastActivity is when the share was last used (RFC 3339): an
+	// authenticated API request or bytes moving for one. Empty until then.
+	LastActivity string `json:"lastActivity,omitempty"`
+}
+
+// StartResult is what Start did. Warnings are codes such as
+// WarningCustomPortUnavailable; WarningMessage turns them into text.
+type StartResult struct {
+	Info     *ServerInfo `json:"info"`
+	Warnings []string    `json:"warnings,omitempty"`
+	// Overlap is set when a running share switched to a folder that is the
+	// same as, inside, or around the previous one.
+	Overlap *RootOverlap `json:"overlap,omitempty"`
+}
+
+// WarningCustomPortUnavailable: the saved custom port was busy, so a random
+// port was used instead.
+const WarningCustomPortUnavailable = "customPortUnavailable"
+
+// WarningWatchUnavailable: watching the folder didn't finish in time, so the
+// web UI won't refresh by itself.
+const WarningWatchUnavailable = "watchUnavailable"
+
+// WarningMessage returns the user-facing text for a StartResult warning.
+func WarningMessage(code string) string {
+	switch code {
+	case WarningCustomPortUnavailable:
+		return "自定义端口不可用，已切换至随机端口"
+	case WarningWatchUnavailable:
+		return "文件夹监听启动超时，网页不会自动刷新"
+	case WarningRootOverlap:
+		return "新共享的文件夹与之前共享的文件夹相互包含，已替换原共享"
+	}
+	return code
+}
@@ -0,0 +1,175 @@
+package shareserver
+
+import (
+	"crypto/sha256"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// uploadHashIndexMaxEntries bounds how many file hashes are kept in memory.
+const uploadHashIndexMaxEntries = 4096
+
+type fileHashEntry struct {
+	size    int64
+	modTime time.Time
+	sum     [32]byte
+}
+
+// uploadHashIndex caches content hashes of files in upload target directories,
+// so repeated uploads of identical bytes can be detected without rewriting them.
+// Entries are keyed by directory then file name, and are only trusted while
+// size+mtime still match.
+type uploadHashIndex struct {
+	mu      sync.Mutex
+	dirs    map[string]map[string]fileHashEntry
+	order   []string
+	entries int
+}
+
+func newUploadHashIndex() *uploadHashIndex {
+	return &uploadHashIndex{dirs: map[string]map[string]fileHashEntry{}}
+}
+
+func (idx *uploadHashIndex) lookup(dir, name string, size int64, modTime time.Time) ([32]byte, bool) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	e, ok := idx.dirs[dir][name]
+	if !ok || e.size != size || !e.modTime.Equal(modTime) {
+		return [32]byte{}, false
+	}
+	return e.sum, true
+}
+
+func (idx *uploadHashIndex) store(dir, name string, e fileHashEntry) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	m, ok := idx.dirs[dir]
+	if !ok {
+		m = map[string]fileHashEntry{}
+		idx.dirs[dir] = m
+		idx.order = append(idx.order, dir)
+	}
+	if _, exists := m[name]; !exists {
+		idx.entries++
+	}
+	m[name] = e
+
+	// Evict whole directories, oldest first, until we're back under the cap.
+	for idx.entries > uploadHashIndexMaxEntries && len(idx.order) > 1 {
+		oldest := idx.order[0]
+		idx.order = idx.order[1:]
+		idx.entries -= len(idx.dirs[oldest])
+		delete(idx.dirs, oldest)
+	}
+	// A single huge directory: drop other entries of it, in no particular
+	// order, so it stays bounded too.
+	for k := range m {
+		if idx.entries <= uploadHashIndexMaxEntries {
+			break
+		}
+		if k != name {
+			delete(m, k)
+			idx.entries--
+		}
+	}
+}
+
+func (idx *uploadHashIndex) invalidate(dir string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	m, ok := idx.dirs[dir]
+	if !ok {
+		return
+	}
+	idx.entries -= len(m)
+	delete(idx.dirs, dir)
+	for i, d := range idx.order {
+		if d == dir {
+			idx.order = append(idx.order[:i], idx.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// invalidateRel drops cached hashes for directories reported by the watcher
+// (relative to root, forward slashes).
+func (idx *uploadHashIndex) invalidateRel(root string, relDirs []string) {
+	for _, rel := range relDirs {
+		idx.invalidate(filepath.Clean(filepath.Join(root, filepath.FromSlash(rel))))
+	}
+}
+
+func (idx *uploadHashIndex) clear() {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.dirs = map[string]map[string]fileHashEntry{}
+	idx.order = nil
+	idx.entries = 0
+}
+
+// findDuplicate looks for a regular file in dir whose content equals the upload.
+// uploadSum is only called when at least one file of the same size exists.
+func (idx *uploadHashIndex) findDuplicate(dir string, size int64, uploadSum func() ([32]byte, error)) (string, bool) {
+	dir = filepath.Clean(dir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", false
+	}
+
+	var want [32]byte
+	haveWant := false
+	for _, entry := range entries {
+		// Sidecars are derived from other files; never report one as the copy.
+		if !entry.Type().IsRegular() || isChecksumSidecar(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.Size() != size {
+			continue
+		}
+		if !haveWant {
+			sum, err := uploadSum()
+			if err != nil {
+				return "", false
+			}
+			want = sum
+			haveWant = true
+		}
+
+		name := entry.Name()
+		sum, ok := idx.lookup(dir, name, info.Size(), info.ModTime())
+		if !ok {
+			sum, err = sha256File(filepath.Join(dir, name))
+			if err != nil {
+				continue
+			}
+			idx.store(dir, name, fileHashEntry{size: info.Size(), modTime: info.ModTime(), sum: sum})
+		}
+		if sum == want {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func sha256File(path string) ([32]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	defer f.Close()
+	return sha256Reader(f)
+}
+
+func sha256Reader(r io.Reader) ([32]byte, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return [32]byte{}, err
+	}
+	var sum [32]byte
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package shareserver
+
+// isFileLockedError is always false here: open files don't block renames.
+func isFileLockedError(err error) bool {
+	return false
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package shareserver
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+// isFileLockedError reports whether err means another process (typically an
+// antivirus scanner) holds the file. ERROR_ACCESS_DENIED doesn't count: it is
+// as likely to be a read-only file or missing permissions, which no retry
+// fixes.
+func isFileLockedError(err error) bool {
+	return errors.Is(err, windows.ERROR_SHARING_VIOLATION) ||
+		errors.Is(err, windows.ERROR_LOCK_VIOLATION)
+}
@@ -0,0 +1,94 @@
+//go:build windows
+
+package shareserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockFileForTest opens path without sharing anything, the way a scanner
+// holding a fresh download does.
+func lockFileForTest(t *testing.T, path string) windows.Handle {
+	t.Helper()
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := windows.CreateFile(p, windows.GENERIC_READ, 0, nil, windows.OPEN_EXISTING, windows.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	return h
+}
+
+func TestIsFileLockedError(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{&os.LinkError{Op: "rename", Err: windows.ERROR_SHARING_VIOLATION}, true},
+		{&os.LinkError{Op: "rename", Err: windows.ERROR_LOCK_VIOLATION}, true},
+		// A read-only file or missing rights: retrying won't help.
+		{&os.LinkError{Op: "rename", Err: windows.ERROR_ACCESS_DENIED}, false},
+	} {
+		if got := isFileLockedError(tc.err); got != tc.want {
+			t.Fatalf("isFileLockedError(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestShareServerUploadLockedDestination(t *testing.T) {
+	tmp := t.TempDir()
+	dest := filepath.Join(tmp, "setup.exe")
+	if err := os.WriteFile(dest, []byte("old"), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	s := newTestShareServerWithSettings(tmp)
+	allowDeleteForTest(t, s)
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	delays := uploadRenameDelays
+	uploadRenameDelays = []time.Duration{20 * time.Millisecond, 20 * time.Millisecond}
+	defer func() { uploadRenameDelays = delays }()
+
+	h := lockFileForTest(t, dest)
+	resp := postUploadForTest(t, ts, "setup.exe", []byte("new"))
+	var body map[string]any
+	_ = json.NewDecoder(resp.Body).Decode(&body)
+	resp.Body.Close()
+	_ = windows.CloseHandle(h)
+	if resp.StatusCode != http.StatusConflict || body["code"] != "UPLOAD_FILE_LOCKED" {
+		t.Fatalf("expected 409 UPLOAD_FILE_LOCKED, got %d %v", resp.StatusCode, body)
+	}
+	entries, _ := os.ReadDir(tmp)
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), uploadTempPrefix) {
+			t.Fatalf("temp file left behind: %s", e.Name())
+		}
+	}
+
+	// A handle released while retrying doesn't fail the upload.
+	uploadRenameDelays = []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond}
+	h = lockFileForTest(t, dest)
+	time.AfterFunc(150*time.Millisecond, func() { _ = windows.CloseHandle(h) })
+	resp = postUploadForTest(t, ts, "setup.exe", []byte("new"))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected upload to succeed after retry, got %d", resp.StatusCode)
+	}
+	if b, _ := os.ReadFile(dest); string(b) != "new" {
+		t.Fatalf("unexpected content %q", b)
+	}
+}
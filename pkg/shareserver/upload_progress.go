@@ -0,0 +1,254 @@
+package shareserver
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// headerUploadID names a web upload (1-64 letters, digits, "-" or "_") so its
+// server-side progress can be followed with /api/upload-progress and the
+// "uploadProgress" event. Browsers only know what they have handed to the
+// network, which can be far ahead of what the server has written.
+const headerUploadID = "X-Upload-Id"
+
+// Upload progress phases, see uploadProgressInfo.Phase.
+const (
+	UploadPhaseReceiving = "receiving"
+	UploadPhaseWriting   = "writing"
+	UploadPhaseFinishing = "finishing"
+	UploadPhaseDone      = "done"
+	UploadPhaseFailed    = "failed"
+)
+
+const (
+	// uploadProgressInterval throttles "uploadProgress" events per upload;
+	// phase changes are always sent.
+	uploadProgressInterval = 250 * time.Millisecond
+	// uploadProgressTTL is how long a finished upload stays queryable, and
+	// uploadProgressIdleTTL how long one without any update is kept.
+	uploadProgressTTL     = time.Minute
+	uploadProgressIdleTTL = 10 * time.Minute
+	maxUploadProgress     = 256
+)
+
+// uploadProgressInfo is what /api/upload-progress and "uploadProgress" report.
+// The request body is received first (ReceivedBytes of TotalBytes, -1 when
+// the client sent no Content-Length), then the files are written into the
+// share (WrittenBytes of WriteTotalBytes) and renamed into place.
+type uploadProgressInfo struct {
+	ID              string `json:"id"`
+	Phase           string `json:"phase"`
+	ReceivedBytes   int64  `json:"receivedBytes"`
+	TotalBytes      int64  `json:"totalBytes"`
+	WrittenBytes    int64  `json:"writtenBytes"`
+	WriteTotalBytes int64  `json:"writeTotalBytes"`
+	// File is the name being written or renamed.
+	File string `json:"file,omitempty"`
+}
+
+type uploadProgressEntry struct {
+	info       uploadProgressInfo
+	ip         string
+	updated    time.Time
+	lastNotify time.Time
+}
+
+// uploadProgresses tracks uploads that sent headerUploadID. Stale entries are
+// dropped whenever an upload starts or is looked up.
+type uploadProgresses struct {
+	mu      sync.Mutex
+	entries map[string]*uploadProgressEntry
+	// onChange is called, outside the lock, on every phase change and at
+	// most every uploadProgressInterval in between, with the uploader's IP.
+	onChange func(ip string, info uploadProgressInfo)
+	now      func() time.Time
+}
+
+func newUploadProgresses() *uploadProgresses {
+	return &uploadProgresses{entries: map[string]*uploadProgressEntry{}, now: time.Now}
+}
+
+func validUploadID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+func (u *uploadProgresses) gcLocked(now time.Time) {
+	for id, e := range u.entries {
+		finished := e.info.Phase == UploadPhaseDone || e.info.Phase == UploadPhaseFailed
+		if (finished && now.Sub(e.updated) > uploadProgressTTL) || now.Sub(e.updated) > uploadProgressIdleTTL {
+			delete(u.entries, id)
+		}
+	}
+}
+
+// begin starts tracking upload id from ip. It returns nil, which every
+// uploadTracker method accepts, when id is missing or invalid or too many
+// uploads are tracked.
+func (u *uploadProgresses) begin(id, ip string, total int64) *uploadTracker {
+	id = strings.TrimSpace(id)
+	if !validUploadID(id) {
+		return nil
+	}
+	u.mu.Lock()
+	now := u.now()
+	u.gcLocked(now)
+	if _, ok := u.entries[id]; !ok && len(u.entries) >= maxUploadProgress {
+		u.mu.Unlock()
+		return nil
+	}
+	e := &uploadProgressEntry{
+		info:    uploadProgressInfo{ID: id, Phase: UploadPhaseReceiving, TotalBytes: total},
+		ip:      ip,
+		updated: now,
+	}
+	u.entries[id] = e
+	u.mu.Unlock()
+	t := &uploadTracker{u: u, e: e}
+	t.notify(e.info)
+	return t
+}
+
+// get returns upload id, if it was started by ip.
+func (u *uploadProgresses) get(id, ip string) (uploadProgressInfo, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.gcLocked(u.now())
+	e, ok := u.entries[id]
+	if !ok || e.ip != ip {
+		return uploadProgressInfo{}, false
+	}
+	return e.info, true
+}
+
+// uploadTracker updates one upload's entry.
+type uploadTracker struct {
+	u *uploadProgresses
+	e *uploadProgressEntry
+}
+
+func (t *uploadTracker) update(fn func(info *uploadProgressInfo)) {
+	if t == nil {
+		return
+	}
+	t.u.mu.Lock()
+	phase := t.e.info.Phase
+	fn(&t.e.info)
+	now := t.u.now()
+	t.e.updated = now
+	send := t.e.info.Phase != phase || now.Sub(t.e.lastNotify) >= uploadProgressInterval
+	if send {
+		t.e.lastNotify = now
+	}
+	info := t.e.info
+	t.u.mu.Unlock()
+	if send {
+		t.notify(info)
+	}
+}
+
+func (t *uploadTracker) notify(info uploadProgressInfo) {
+	if t.u.onChange != nil {
+		t.u.onChange(t.e.ip, info)
+	}
+}
+
+// body counts what is read from the request body.
+func (t *uploadTracker) body(rc io.ReadCloser) io.ReadCloser {
+	if t == nil {
+		return rc
+	}
+	return &progressReadCloser{ReadCloser: rc, add: func(n int64) {
+		t.update(func(info *uploadProgressInfo) { info.ReceivedBytes += n })
+	}}
+}
+
+// writing switches to writing writeTotal bytes of files.
+func (t *uploadTracker) writing(writeTotal int64) {
+	t.update(func(info *uploadProgressInfo) {
+		info.Phase = UploadPhaseWriting
+		if info.TotalBytes < 0 {
+			info.TotalBytes = info.ReceivedBytes
+		}
+		info.WriteTotalBytes = writeTotal
+	})
+}
+
+// file counts what is copied from r as part of file name; skip counts a file
+// that needs no writing (a duplicate).
+func (t *uploadTracker) file(name string, r io.Reader) io.Reader {
+	if t == nil {
+		return r
+	}
+	t.update(func(info *uploadProgressInfo) {
+		info.Phase = UploadPhaseWriting
+		info.File = name
+	})
+	return &progressReadCloser{ReadCloser: io.NopCloser(r), add: func(n int64) {
+		t.update(func(info *uploadProgressInfo) { info.WrittenBytes += n })
+	}}
+}
+
+func (t *uploadTracker) skip(size int64) {
+	t.update(func(info *uploadProgressInfo) { info.WrittenBytes += size })
+}
+
+func (t *uploadTracker) finishing() {
+	t.update(func(info *uploadProgressInfo) { info.Phase = UploadPhaseFinishing })
+}
+
+func (t *uploadTracker) done() {
+	t.update(func(info *uploadProgressInfo) {
+		info.Phase = UploadPhaseDone
+		info.File = ""
+	})
+}
+
+// close marks an upload that didn't get to done as failed.
+func (t *uploadTracker) close() {
+	t.update(func(info *uploadProgressInfo) {
+		if info.Phase != UploadPhaseDone {
+			info.Phase = UploadPhaseFailed
+		}
+	})
+}
+
+type progressReadCloser struct {
+	io.ReadCloser
+	add func(n int64)
+}
+
+func (p *progressReadCloser) Read(b []byte) (int, error) {
+	n, err := p.ReadCloser.Read(b)
+	if n > 0 {
+		p.add(int64(n))
+	}
+	return n, err
+}
+
+func (s *Server) handleUploadProgress(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "仅支持 GET"})
+		return
+	}
+	if !s.requireAuth(w, r) {
+		return
+	}
+	info, ok := s.uploadProgress.get(r.URL.Query().Get("id"), s.clientIP(r))
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "上传任务不存在"})
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
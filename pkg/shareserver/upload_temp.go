@@ -0,0 +1,154 @@
+package shareserver
+
+import (
+	"errors"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// uploadTempPrefix is the start of uploadTempPattern; the sweep matches on it.
+const uploadTempPrefix = ".localshare-upload-"
+
+const (
+	// uploadTempMaxAge is how old an upload temp file must be before the
+	// sweep treats it as orphaned. Files being written keep a fresh mtime.
+	uploadTempMaxAge = 24 * time.Hour
+	// uploadTempIdleAge is both how long a used share must go idle before it
+	// sweeps again and the age of the files that sweep removes: with nothing
+	// moving, a temp file untouched that long isn't being written.
+	uploadTempIdleAge = 10 * time.Minute
+)
+
+// uploadRenameDelays are the pauses between attempts of the final upload
+// rename while the file is locked (about 2s in total). Scanners usually let
+// go of a fresh exe/zip within that.
+var uploadRenameDelays = []time.Duration{
+	100 * time.Millisecond,
+	200 * time.Millisecond,
+	300 * time.Millisecond,
+	500 * time.Millisecond,
+	900 * time.Millisecond,
+}
+
+// createUploadTemp creates an upload temp file in dir. Unlike os.CreateTemp,
+// which uses 0600, the file gets 0644 minus the umask: the mode moves with it
+// on rename, and uploads should end up like any other new file.
+func createUploadTemp(dir string) (*os.File, error) {
+	for try := 0; ; try++ {
+		name := filepath.Join(dir, strings.Replace(uploadTempPattern, "*", strconv.FormatUint(uint64(rand.Uint32()), 10), 1))
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+		if errors.Is(err, fs.ErrExist) && try < 100 {
+			continue
+		}
+		return f, err
+	}
+}
+
+// renameUploaded moves a finished upload into place, retrying for a moment
+// while the temp file or the destination is held by another process.
+func renameUploaded(tmpPath, outPath string) error {
+	err := os.Rename(tmpPath, outPath)
+	for _, d := range uploadRenameDelays {
+		if err == nil || !isFileLockedError(err) {
+			return err
+		}
+		time.Sleep(d)
+		err = os.Rename(tmpPath, outPath)
+	}
+	return err
+}
+
+// sweepUploadTemps removes upload temp files under root last modified more
+// than olderThan ago, left behind by crashes or by a rename that never got
+// the file back from a scanner. It returns how many were removed.
+func sweepUploadTemps(root string, olderThan time.Duration) int {
+	if root == "" {
+		return 0
+	}
+	cutoff := time.Now().Add(-olderThan)
+	removed := 0
+	_ = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Unreadable folders are skipped, not fatal.
+			if d != nil && d.IsDir() && p != root {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !d.Type().IsRegular() || !strings.HasPrefix(d.Name(), uploadTempPrefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			return nil
+		}
+		if os.Remove(p) == nil {
+			removed++
+		}
+		return nil
+	})
+	return removed
+}
+
+// startUploadSweepLocked sweeps the shared root now, for files left by an
+// earlier run, and again each time the share goes idle after being used, for
+// files this run couldn't remove. Walking the whole share is too costly to do
+// on a timer. Called with s.mu held; stopLocked ends it.
+func (s *Server) startUploadSweepLocked() {
+	if s.uploadSweepStop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	s.uploadSweepStop = stop
+	go s.runUploadSweep(stop)
+}
+
+func (s *Server) stopUploadSweepLocked() {
+	if s.uploadSweepStop != nil {
+		close(s.uploadSweepStop)
+		s.uploadSweepStop = nil
+	}
+}
+
+func (s *Server) runUploadSweep(stop <-chan struct{}) {
+	s.sweepUploadRoot(uploadTempMaxAge)
+	// Only watching the activity times: cheap enough to do every minute.
+	ticker := time.NewTicker(defaultIdleCheckInterval)
+	defer ticker.Stop()
+	var swept time.Time
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		swept = s.sweepUploadTempsWhenIdle(swept)
+	}
+}
+
+// sweepUploadTempsWhenIdle sweeps once the share has been idle for
+// uploadTempIdleAge, if it was used after swept (the activity the last sweep
+// covered). It returns the activity this sweep covers.
+func (s *Server) sweepUploadTempsWhenIdle(swept time.Time) time.Time {
+	last := s.activity.last()
+	if !last.After(swept) || s.activity.idleFor() < uploadTempIdleAge {
+		return swept
+	}
+	s.sweepUploadRoot(uploadTempIdleAge)
+	return last
+}
+
+func (s *Server) sweepUploadRoot(olderThan time.Duration) {
+	// Read the root each time: sharing another folder keeps the server.
+	s.mu.RLock()
+	root := s.sharedRoot
+	s.mu.RUnlock()
+	if n := sweepUploadTemps(root, olderThan); n > 0 {
+		s.logf("removed %d orphaned upload temp files root=%q", n, root)
+	}
+}
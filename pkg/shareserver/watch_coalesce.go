@@ -0,0 +1,121 @@
+package shareserver
+
+import (
+	"path"
+	"strings"
+	"time"
+)
+
+// Watcher tuning (JSON numbers). Changes rebuild the running watcher.
+const (
+	SettingKeyWatchDebounceMs = "local-share:watch-debounce-ms"
+	SettingKeyWatchMaxDelayMs = "local-share:watch-max-delay-ms"
+	SettingKeyWatchMaxDirs    = "local-share:watch-max-dirs"
+)
+
+// eventBroadcaster is the part of sseHub the watcher needs (faked in tests).
+type eventBroadcaster interface {
+	broadcast(event string, payload any)
+}
+
+type watchCoalesceConfig struct {
+	// debounce is the quiet period after the last event before flushing.
+	debounce time.Duration
+	// maxDelay caps how long events are held while changes keep coming.
+	maxDelay time.Duration
+	// maxDirs is how many distinct dirs one flush may list before they are
+	// collapsed into their common parent (subtreeChanged).
+	maxDirs int
+}
+
+var defaultWatchCoalesceConfig = watchCoalesceConfig{
+	debounce: 250 * time.Millisecond,
+	maxDelay: 2 * time.Second,
+	maxDirs:  32,
+}
+
+func (s *Server) watchCoalesceConfig() watchCoalesceConfig {
+	d := defaultWatchCoalesceConfig
+	return watchCoalesceConfig{
+		debounce: time.Duration(s.getIntSetting(SettingKeyWatchDebounceMs, int(d.debounce/time.Millisecond), 50, 5000)) * time.Millisecond,
+		maxDelay: time.Duration(s.getIntSetting(SettingKeyWatchMaxDelayMs, int(d.maxDelay/time.Millisecond), 50, 30000)) * time.Millisecond,
+		maxDirs:  s.getIntSetting(SettingKeyWatchMaxDirs, d.maxDirs, 1, 1000),
+	}
+}
+
+// eventCoalescer batches changed dirs so a big copy into the share turns into
+// a few events instead of one per file.
+type eventCoalescer struct {
+	cfg     watchCoalesceConfig
+	hub     eventBroadcaster
+	onFlush func(dirs []string)
+
+	pending map[string]struct{}
+	first   time.Time
+}
+
+func newEventCoalescer(cfg watchCoalesceConfig, hub eventBroadcaster, onFlush func(dirs []string)) *eventCoalescer {
+	return &eventCoalescer{cfg: cfg, hub: hub, onFlush: onFlush, pending: map[string]struct{}{}}
+}
+
+// add records relDir and returns how long to wait before flushing: the
+// debounce period, but never past maxDelay since the first pending change.
+func (c *eventCoalescer) add(relDir string, now time.Time) time.Duration {
+	if len(c.pending) == 0 {
+		c.first = now
+	}
+	c.pending[relDir] = struct{}{}
+	wait := c.cfg.debounce
+	if left := c.first.Add(c.cfg.maxDelay).Sub(now); left < wait {
+		wait = max(left, 0)
+	}
+	return wait
+}
+
+func (c *eventCoalescer) flush() {
+	if len(c.pending) == 0 {
+		return
+	}
+	dirs := make([]string, 0, len(c.pending))
+	for d := range c.pending {
+		dirs = append(dirs, d)
+	}
+	c.pending = map[string]struct{}{}
+
+	if c.onFlush != nil {
+		c.onFlush(dirs)
+	}
+	if c.hub == nil {
+		return
+	}
+	ts := time.Now().UTC().Format(time.RFC3339Nano)
+	if len(dirs) > c.cfg.maxDirs {
+		c.hub.broadcast("subtreeChanged", map[string]any{
+			"dir": commonParentDir(dirs),
+			"ts":  ts,
+		})
+		return
+	}
+	c.hub.broadcast("dirsChanged", map[string]any{
+		"dirs": dirs,
+		"ts":   ts,
+	})
+}
+
+// commonParentDir returns the deepest dir containing all of dirs
+// (slash-separated, relative; "" is the share root).
+func commonParentDir(dirs []string) string {
+	if len(dirs) == 0 {
+		return ""
+	}
+	common := strings.Split(dirs[0], "/")
+	for _, d := range dirs[1:] {
+		parts := strings.Split(d, "/")
+		n := 0
+		for n < len(common) && n < len(parts) && common[n] == parts[n] {
+			n++
+		}
+		common = common[:n]
+	}
+	return path.Join(common...)
+}
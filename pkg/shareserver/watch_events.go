@@ -0,0 +1,794 @@
+package shareserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// SettingKeyWatchIgnore lists extra directories (JSON array of strings) that
+// neither the change watcher nor zip downloads descend into. Plain names match
+// at any depth ("target"); entries with "/" are share-relative prefixes ("web/dist").
+const SettingKeyWatchIgnore = "local-share:watch-ignore"
+
+func (s *Server) getWatchIgnoreFromSettings() []string {
+	if s.settings == nil {
+		return nil
+	}
+	raw, ok, err := s.settings.Get(SettingKeyWatchIgnore)
+	if err != nil || !ok || len(raw) == 0 {
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil
+	}
+	return list
+}
+
+// onWatchSettingChanged rebuilds the running watcher so a new ignore list or
+// tuning applies without restarting the share. The new watcher is built
+// without holding opMu, so a share operation isn't held up by the walk, and
+// only installed if the watcher wasn't stopped or replaced meanwhile.
+func (s *Server) onWatchSettingChanged(key string, _ json.RawMessage) {
+	switch key {
+	case SettingKeyWatchIgnore, SettingKeyWatchDebounceMs, SettingKeyWatchMaxDelayMs, SettingKeyWatchMaxDirs:
+	default:
+		return
+	}
+	s.opMu.Lock()
+	root, gen := s.watchRoot, s.watchGen
+	s.opMu.Unlock()
+	if root == "" {
+		return
+	}
+	dw, err := s.buildWatcher(context.Background(), root)
+	if err != nil {
+		s.logf("watcher not rebuilt root=%q err=%v", root, err)
+		return
+	}
+	s.opMu.Lock()
+	if s.watchGen != gen {
+		s.opMu.Unlock()
+		dw.Stop()
+		return
+	}
+	old := s.watcher
+	s.watcher = dw
+	s.watchGen++
+	s.opMu.Unlock()
+	if old != nil {
+		old.Stop()
+	}
+}
+
+// resetWatcher watches root unless it is watched already. Caller holds
+// s.opMu.
+func (s *Server) resetWatcher(ctx context.Context, root string) error {
+	root = filepath.Clean(root)
+	if root == "" {
+		s.stopWatcher()
+		return nil
+	}
+
+	// Avoid doing expensive recursive watch if unchanged.
+	if s.watcher != nil && samePath(s.watchRoot, root) {
+		return nil
+	}
+	return s.rebuildWatcher(ctx, root)
+}
+
+// rebuildWatcher replaces the watcher unconditionally. Caller holds s.opMu.
+func (s *Server) rebuildWatcher(ctx context.Context, root string) error {
+	s.stopWatcher()
+	dw, err := s.buildWatcher(ctx, root)
+	if err != nil {
+		return err
+	}
+	s.watcher = dw
+	s.watchRoot = root
+	s.watchGen++
+	return nil
+}
+
+// buildWatcher creates and starts a watcher of root. The recursive add runs
+// in its own goroutine so a huge or slow tree can't hold the caller past ctx;
+// an abandoned attempt notices ctx between directories and cleans up after
+// itself.
+func (s *Server) buildWatcher(ctx context.Context, root string) (*directoryWatcher, error) {
+	dw, err := newDirectoryWatcher(root, s.events, s.watchCoalesceConfig(), s.getWatchIgnoreFromSettings(), func(dirs []string) {
+		if s.uploadHashes != nil {
+			s.uploadHashes.invalidateRel(root, dirs)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	started := make(chan error, 1)
+	go func() { started <- dw.Start(ctx) }()
+	select {
+	case err = <-started:
+	case <-ctx.Done():
+		go func() {
+			<-started
+			dw.Stop()
+		}()
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		dw.Stop()
+		return nil, err
+	}
+	return dw, nil
+}
+
+// stopWatcher stops the watcher, if any. Caller holds s.opMu.
+func (s *Server) stopWatcher() {
+	dw := s.watcher
+	s.watcher = nil
+	s.watchRoot = ""
+	s.watchGen++
+	if dw != nil {
+		dw.Stop()
+	}
+}
+
+func samePath(a, b string) bool {
+	a = filepath.Clean(strings.TrimSpace(a))
+	b = filepath.Clean(strings.TrimSpace(b))
+	if a == b {
+		return true
+	}
+	// Windows is case-insensitive.
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(a, b)
+	}
+	return false
+}
+
+type sseHub struct {
+	mu      sync.Mutex
+	clients map[*sseClient]struct{}
+
+	// onLastClientGone is called when the last stream of a client IP disconnects.
+	onLastClientGone func(ip string)
+
+	// history keeps recent events for Last-Event-ID replay and /api/changes.
+	history eventHistory
+
+	// A client whose buffer was found full maxDrops broadcasts in a row, or
+	// for stallTimeout, without reading anything is disconnected so its
+	// EventSource reconnects and catches up through Last-Event-ID.
+	maxDrops     int
+	stallTimeout time.Duration
+	now          func() time.Time
+
+	// Counters since start, for Stats.
+	drops       uint64
+	disconnects uint64
+}
+
+type sseClient struct {
+	ch        chan []byte
+	ip        string
+	closeOnce sync.Once
+
+	// reads is bumped by the stream goroutine for every message it takes.
+	reads atomic.Uint64
+	// The rest is guarded by sseHub.mu.
+	kicked    bool
+	drops     int
+	fullSince time.Time
+	fullReads uint64
+}
+
+func (c *sseClient) close() {
+	c.closeOnce.Do(func() {
+		close(c.ch)
+	})
+}
+
+// Defaults for sseHub.maxDrops and sseHub.stallTimeout; the stall timeout is
+// also the write deadline of a stream.
+const (
+	sseMaxDrops     = 8
+	sseStallTimeout = 30 * time.Second
+)
+
+func newSSEHub() *sseHub {
+	return &sseHub{
+		clients:      make(map[*sseClient]struct{}),
+		maxDrops:     sseMaxDrops,
+		stallTimeout: sseStallTimeout,
+		now:          time.Now,
+	}
+}
+
+// sseMetrics is the backpressure side of Stats.
+type sseMetrics struct {
+	Clients int
+	// Drops counts messages discarded because a client's buffer was full.
+	Drops uint64
+	// Disconnects counts clients closed for not keeping up.
+	Disconnects uint64
+}
+
+func (h *sseHub) metrics() sseMetrics {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return sseMetrics{Clients: len(h.clients), Drops: h.drops, Disconnects: h.disconnects}
+}
+
+// sseConfig tunes one event stream; see Server.sseConfig for defaults and bounds.
+type sseConfig struct {
+	keepAlive  time.Duration
+	bufferSize int
+	maxPerIP   int
+	maxClients int
+}
+
+// sseRetryAfterSeconds is sent with 503 when a stream is rejected by the limits.
+const sseRetryAfterSeconds = 10
+
+func (h *sseHub) serve(w http.ResponseWriter, r *http.Request, ip string, cfg sseConfig) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	client := &sseClient{ch: make(chan []byte, cfg.bufferSize), ip: ip}
+	replay, ok := h.addClient(client, cfg.maxPerIP, cfg.maxClients, lastEventID(r))
+	if !ok {
+		// Typically a client stuck in a reconnect loop; make it back off.
+		w.Header().Set("Retry-After", strconv.Itoa(sseRetryAfterSeconds))
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "连接数过多，请稍后重试", "code": "TOO_MANY_STREAMS"})
+		return
+	}
+	defer h.removeClient(client)
+
+	w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache, no-transform")
+	w.Header().Set("Connection", "keep-alive")
+
+	// Initial flush so the client considers the connection established.
+	_, _ = io.WriteString(w, ": connected\n\n")
+	for _, ev := range replay {
+		_, _ = w.Write(ev.message())
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(cfg.keepAlive)
+	defer keepAlive.Stop()
+
+	// A peer that stopped reading (a phone asleep with the TCP connection
+	// still up) would otherwise block a write forever.
+	rc := http.NewResponseController(w)
+	write := func(b []byte) bool {
+		_ = rc.SetWriteDeadline(time.Now().Add(h.stallTimeout))
+		if _, err := w.Write(b); err != nil {
+			return false
+		}
+		flusher.Flush()
+		return true
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if !write([]byte(": ping\n\n")) {
+				return
+			}
+		case msg, ok := <-client.ch:
+			if !ok {
+				return
+			}
+			client.reads.Add(1)
+			if len(msg) == 0 {
+				continue
+			}
+			if !write(msg) {
+				return
+			}
+		}
+	}
+}
+
+// addClient registers c unless that would exceed maxPerIP streams for its IP
+// or maxClients in total (<= 0 means no limit). With a Last-Event-ID it also
+// returns the buffered events after it, taken under the same lock so nothing
+// broadcast in between is lost or sent twice.
+func (h *sseHub) addClient(c *sseClient, maxPerIP, maxClients int, lastID string) ([]sseEvent, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if maxClients > 0 && len(h.clients) >= maxClients {
+		return nil, false
+	}
+	if maxPerIP > 0 {
+		n := 0
+		for other := range h.clients {
+			if other.ip == c.ip {
+				n++
+			}
+		}
+		if n >= maxPerIP {
+			return nil, false
+		}
+	}
+	h.clients[c] = struct{}{}
+	var replay []sseEvent
+	if since, err := strconv.ParseUint(lastID, 10, 64); err == nil {
+		// After a gap the client just gets what is left; the next dirsChanged
+		// refreshes it anyway.
+		replay, _ = h.history.since(since)
+	}
+	return replay, true
+}
+
+// count includes clients that were disconnected but whose stream hasn't
+// returned yet.
+func (h *sseHub) count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients)
+}
+
+func (h *sseHub) removeClient(c *sseClient) {
+	h.mu.Lock()
+	_, present := h.clients[c]
+	delete(h.clients, c)
+	c.close()
+	lastForIP := present && c.ip != ""
+	if lastForIP {
+		for other := range h.clients {
+			if other.ip == c.ip {
+				lastForIP = false
+				break
+			}
+		}
+	}
+	onGone := h.onLastClientGone
+	h.mu.Unlock()
+
+	if lastForIP && onGone != nil {
+		onGone(c.ip)
+	}
+}
+
+// CloseAll ends every stream and forgets buffered events, which belonged to
+// the share that is stopping. Event IDs keep counting up.
+func (h *sseHub) CloseAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.clients {
+		c.close()
+		delete(h.clients, c)
+	}
+	h.history.clear()
+}
+
+func (h *sseHub) broadcast(event string, payload any) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sendLocked(h.history.add(event, data).message())
+}
+
+// sendVolatileTo sends an event to the connected streams of one client IP,
+// for events that are nobody else's business. It gets no ID and isn't kept
+// for replay or /api/changes, so frequent progress updates can't push file
+// changes out of the history.
+func (h *sseHub) sendVolatileTo(ip string, event string, payload any) {
+	if ip == "" {
+		return
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sendToLocked(ip, []byte(fmt.Sprintf("event: %s\ndata: %s\n\n", event, data)))
+}
+
+func (h *sseHub) sendLocked(msg []byte) {
+	h.sendToLocked("", msg)
+}
+
+// sendToLocked sends msg to the clients of ip, or to all of them for "".
+func (h *sseHub) sendToLocked(ip string, msg []byte) {
+	for c := range h.clients {
+		if c.kicked || (ip != "" && c.ip != ip) {
+			continue
+		}
+		// Don't let slow clients block the broadcaster.
+		select {
+		case c.ch <- msg:
+			continue
+		default:
+		}
+		if h.slowLocked(c) {
+			continue
+		}
+		// Drop backlog and keep the latest.
+		for {
+			select {
+			case <-c.ch:
+				h.drops++
+				continue
+			default:
+			}
+			break
+		}
+		select {
+		case c.ch <- msg:
+		default:
+			// still full; give up
+			h.drops++
+		}
+	}
+}
+
+// slowLocked records that c's buffer was full and disconnects c when it
+// hasn't read anything for maxDrops broadcasts or stallTimeout. Closing the
+// channel ends its stream; removeClient runs when serve returns.
+func (h *sseHub) slowLocked(c *sseClient) bool {
+	now := h.now()
+	if reads := c.reads.Load(); c.drops == 0 || reads != c.fullReads {
+		c.drops = 0
+		c.fullReads = reads
+		c.fullSince = now
+	}
+	c.drops++
+	if c.drops < h.maxDrops && now.Sub(c.fullSince) < h.stallTimeout {
+		return false
+	}
+	c.kicked = true
+	h.drops += uint64(len(c.ch))
+	h.disconnects++
+	c.close()
+	return true
+}
+
+var errWatcherStopped = errors.New("watcher stopped")
+
+type directoryWatcher struct {
+	watcher    *fsnotify.Watcher
+	root       string
+	ignoreDirs map[string]struct{}
+	// ignorePrefixes are root-relative, slash-separated subtrees to skip.
+	ignorePrefixes []string
+	watched        map[string]struct{}
+	stopCh         chan struct{}
+	stopOnce       sync.Once
+	doneCh         chan struct{}
+	// stateMu guards started and stopped, which let Stop run before (or
+	// instead of) Start.
+	stateMu sync.Mutex
+	started bool
+	stopped bool
+
+	hub      eventBroadcaster
+	coalesce watchCoalesceConfig
+	// onFlush is called with the same relative dirs broadcast as dirsChanged.
+	onFlush func(dirs []string)
+}
+
+const includeWriteEvents = false
+
+func newDirectoryWatcher(root string, hub eventBroadcaster, coalesce watchCoalesceConfig, extraIgnore []string, onFlush func(dirs []string)) (*directoryWatcher, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	dw := &directoryWatcher{
+		watcher:  w,
+		root:     filepath.Clean(root),
+		hub:      hub,
+		coalesce: coalesce,
+		onFlush:  onFlush,
+		ignoreDirs: map[string]struct{}{
+			// VCS
+			".git": {},
+			".hg":  {},
+			".svn": {},
+
+			// JS / frontend deps
+			"node_modules": {},
+
+			// Common caches
+			"__pycache__": {},
+			".cache":      {},
+			".gradle":     {},
+			".m2":         {},
+		},
+		watched: make(map[string]struct{}),
+		stopCh:  make(chan struct{}),
+		doneCh:  make(chan struct{}),
+	}
+	names, prefixes := splitIgnoreList(extraIgnore)
+	for _, name := range names {
+		dw.ignoreDirs[name] = struct{}{}
+	}
+	dw.ignorePrefixes = prefixes
+
+	return dw, nil
+}
+
+// splitIgnoreList separates plain names from "a/b" style prefixes, normalizing
+// the latter to clean slash-separated relative paths.
+func splitIgnoreList(list []string) (names, prefixes []string) {
+	seen := make(map[string]struct{}, len(list))
+	for _, ig := range list {
+		ig = strings.TrimPrefix(filepath.ToSlash(strings.TrimSpace(ig)), "/")
+		if ig == "" {
+			continue
+		}
+		if _, ok := seen[ig]; ok {
+			continue
+		}
+		seen[ig] = struct{}{}
+		if !strings.Contains(ig, "/") {
+			names = append(names, ig)
+			continue
+		}
+		if p := path.Clean(ig); p != "." && p != "" {
+			prefixes = append(prefixes, p)
+		}
+	}
+	return names, prefixes
+}
+
+// Start watches the root and its sub-directories, giving up with ctx.Err()
+// when ctx is done before the walk finishes.
+func (dw *directoryWatcher) Start(ctx context.Context) error {
+	dw.stateMu.Lock()
+	if dw.stopped {
+		dw.stateMu.Unlock()
+		return errWatcherStopped
+	}
+	dw.started = true
+	dw.stateMu.Unlock()
+
+	// Watch root and all sub-directories (skipping ignored).
+	if err := dw.addRecursive(ctx, dw.root); err != nil {
+		_ = dw.watcher.Close()
+		close(dw.doneCh)
+		return err
+	}
+
+	go dw.loop()
+	return nil
+}
+
+// Stop ends the loop, which flushes pending dirs once, and waits for it.
+// It is safe to call more than once, concurrently, before Start and after a
+// failed Start.
+func (dw *directoryWatcher) Stop() {
+	dw.stopOnce.Do(func() {
+		dw.stateMu.Lock()
+		dw.stopped = true
+		started := dw.started
+		dw.stateMu.Unlock()
+		close(dw.stopCh)
+		_ = dw.watcher.Close()
+		if !started {
+			close(dw.doneCh)
+		}
+	})
+	<-dw.doneCh
+}
+
+func (dw *directoryWatcher) loop() {
+	defer close(dw.doneCh)
+	dw.run(dw.watcher.Events, dw.watcher.Errors)
+}
+
+// run coalesces events until stopCh is closed or events is closed, then
+// flushes whatever is still pending.
+func (dw *directoryWatcher) run(events <-chan fsnotify.Event, errs <-chan error) {
+	c := newEventCoalescer(dw.coalesce, dw.hub, dw.onFlush)
+	defer c.flush()
+
+	// One timer for the whole loop. timerC is nil while nothing is pending, so
+	// only an armed timer can fire; since Go 1.23 Reset/Stop also guarantee no
+	// stale tick is left in the channel.
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+	var timerC <-chan time.Time
+
+	for {
+		select {
+		case <-dw.stopCh:
+			return
+		case _, ok := <-errs:
+			if !ok {
+				return
+			}
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			relDir, ok := dw.eventDir(ev)
+			if !ok {
+				continue
+			}
+			timer.Reset(c.add(relDir, time.Now()))
+			timerC = timer.C
+		case <-timerC:
+			timerC = nil
+			c.flush()
+		}
+	}
+}
+
+// eventDir returns the relative dir whose listing ev changes, if it matters.
+func (dw *directoryWatcher) eventDir(ev fsnotify.Event) (string, bool) {
+	// Only care about name-level changes.
+	if ev.Name == "" {
+		return "", false
+	}
+
+	isCreate := ev.Op&fsnotify.Create != 0
+	isRemove := ev.Op&fsnotify.Remove != 0
+	isRename := ev.Op&fsnotify.Rename != 0
+	isWrite := includeWriteEvents && (ev.Op&fsnotify.Write != 0)
+
+	if !(isCreate || isRemove || isRename || isWrite) {
+		return "", false
+	}
+
+	// If a new directory is created, start watching it (unless ignored).
+	if isCreate {
+		if st, err := os.Stat(ev.Name); err == nil && st.IsDir() {
+			_ = dw.addIfDir(ev.Name)
+		}
+	}
+
+	relDir := dw.relativeDirForEvent(ev.Name)
+	if relDir == "__ignored__" {
+		return "", false
+	}
+	return relDir, true
+}
+
+func (dw *directoryWatcher) relativeDirForEvent(fullPath string) string {
+	fullPath = filepath.Clean(fullPath)
+	dir := filepath.Dir(fullPath)
+
+	rel, err := filepath.Rel(dw.root, dir)
+	if err != nil {
+		return "__ignored__"
+	}
+	rel = filepath.Clean(rel)
+	if rel == "." {
+		return ""
+	}
+	// Outside root.
+	if strings.HasPrefix(rel, "..") {
+		return "__ignored__"
+	}
+	// If the dir is inside an ignored subtree, ignore.
+	if dw.isInIgnoredSubtree(rel) {
+		return "__ignored__"
+	}
+	return filepath.ToSlash(rel)
+}
+
+func (dw *directoryWatcher) isInIgnoredSubtree(relDir string) bool {
+	if relDir == "" {
+		return false
+	}
+	relDir = filepath.ToSlash(relDir)
+	parts := strings.Split(relDir, "/")
+	for _, p := range parts {
+		if p == "" {
+			continue
+		}
+		if _, ok := dw.ignoreDirs[p]; ok {
+			return true
+		}
+	}
+	for _, pref := range dw.ignorePrefixes {
+		if relDir == pref || strings.HasPrefix(relDir, pref+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// isIgnoredDir reports whether the directory at fullPath (never the root) is skipped.
+func (dw *directoryWatcher) isIgnoredDir(fullPath string) bool {
+	if _, ok := dw.ignoreDirs[filepath.Base(fullPath)]; ok {
+		return true
+	}
+	if len(dw.ignorePrefixes) == 0 {
+		return false
+	}
+	rel, err := filepath.Rel(dw.root, fullPath)
+	if err != nil || rel == "." {
+		return false
+	}
+	return dw.isInIgnoredSubtree(rel)
+}
+
+func (dw *directoryWatcher) addRecursive(ctx context.Context, root string) error {
+	first := true
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if cerr := ctx.Err(); cerr != nil {
+			return cerr
+		}
+		if err != nil {
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+
+		// Skip ignored subtrees (but never skip the root itself).
+		if p != root && dw.isIgnoredDir(p) {
+			return filepath.SkipDir
+		}
+
+		required := first
+		first = false
+		return dw.addWatchDir(p, required)
+	})
+}
+
+func (dw *directoryWatcher) addIfDir(path string) error {
+	path = filepath.Clean(path)
+	if _, ok := dw.watched[path]; ok {
+		return nil
+	}
+	if dw.isIgnoredDir(path) {
+		return nil
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	if !st.IsDir() {
+		return nil
+	}
+	return dw.addRecursive(context.Background(), path)
+}
+
+func (dw *directoryWatcher) addWatchDir(dir string, required bool) error {
+	dir = filepath.Clean(dir)
+	if _, ok := dw.watched[dir]; ok {
+		return nil
+	}
+	if err := dw.watcher.Add(dir); err != nil {
+		if required {
+			return err
+		}
+		return nil
+	}
+	dw.watched[dir] = struct{}{}
+	return nil
+}
@@ -0,0 +1,81 @@
+package shareserver
+
+import (
+	"bytes"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+)
+
+// assetsDiagnosticTmpl replaces the web UI when the build has no index.html,
+// typically because the web UI build step was skipped.
+var assetsDiagnosticTmpl = template.Must(template.New("diag").Parse(`<!doctype html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>网页资源缺失</title>
+<style>
+body{margin:0;padding:32px 16px;background:#1b2636;color:#fff;font-family:system-ui,sans-serif;line-height:1.6}
+main{max-width:640px;margin:0 auto}
+code{background:#ffffff1a;padding:2px 6px;border-radius:4px;word-break:break-all}
+dt{opacity:.7}
+dd{margin:0 0 12px}
+</style>
+</head>
+<body>
+<main>
+<h1>网页资源缺失</h1>
+<p>当前程序没有包含共享网页（未找到 <code>index.html</code>），通常是构建时跳过了网页端的构建。文件接口（<code>/api/*</code>）仍可正常使用。</p>
+<dl>
+<dt>期望路径</dt>
+<dd><code>{{.Expected}}</code></dd>
+<dt>从磁盘读取（开发模式）</dt>
+<dd>{{if .Disk}}是{{else}}否{{end}}</dd>
+<dt>版本</dt>
+<dd>{{if .Version}}{{.Version}}{{else}}未知{{end}}</dd>
+</dl>
+<p>开发者：请先在 <code>web</code> 目录执行 <code>npm run build</code> 再构建程序。</p>
+</main>
+</body>
+</html>
+`))
+
+// hasIndexHTML reports whether fsys can serve the web UI entry page.
+func hasIndexHTML(fsys fs.FS) bool {
+	if fsys == nil {
+		return false
+	}
+	st, err := fs.Stat(fsys, "index.html")
+	return err == nil && !st.IsDir()
+}
+
+// assetsDiagnosticPage renders the page served on "/" when the web UI is missing.
+func (s *Server) assetsDiagnosticPage() []byte {
+	dir := s.assetsPath
+	if dir == "" {
+		dir = "web/dist"
+	}
+	var buf bytes.Buffer
+	_ = assetsDiagnosticTmpl.Execute(&buf, struct {
+		Expected string
+		Disk     bool
+		Version  string
+	}{
+		Expected: filepath.Join(dir, "index.html"),
+		Disk:     s.assetsNoCache,
+		Version:  s.version,
+	})
+	return buf.Bytes()
+}
+
+func serveAssetsDiagnostic(w http.ResponseWriter, r *http.Request, page []byte) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(page)
+	}
+}
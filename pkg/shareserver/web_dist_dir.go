@@ -0,0 +1,65 @@
+package shareserver
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Web UI serving modes reported by WebServeMode and /api/meta.
+const (
+	WebServeEmbedded = "embedded" // Options.Assets
+	WebServeDisk     = "disk"     // Options.Assets with AssetsNoCache (dev)
+	WebServeCustom   = "custom"   // the directory in SettingKeyWebDistDir
+	WebServeMissing  = "missing"  // no index.html anywhere, diagnostic page
+)
+
+// webDistDirOverride returns the directory from SettingKeyWebDistDir when it
+// holds an index.html, otherwise "". It is cheap enough to call per request.
+func (s *Server) webDistDirOverride() string {
+	if s.settings == nil {
+		return ""
+	}
+	raw, ok, err := s.settings.Get(SettingKeyWebDistDir)
+	if err != nil || !ok || len(raw) == 0 {
+		return ""
+	}
+	var dir string
+	if err := json.Unmarshal(raw, &dir); err != nil {
+		return ""
+	}
+	dir = strings.TrimSpace(dir)
+	if dir == "" || !IsWebDistDir(dir) {
+		return ""
+	}
+	return dir
+}
+
+// IsWebDistDir reports whether dir looks like a built web UI (has index.html).
+func IsWebDistDir(dir string) bool {
+	st, err := os.Stat(filepath.Join(dir, "index.html"))
+	return err == nil && !st.IsDir()
+}
+
+// webAssets picks the FS for the current request: a valid SettingKeyWebDistDir
+// wins over Options.Assets so a new web build can be tried without rebuilding Go.
+func (s *Server) webAssets() (fsys fs.FS, noCache bool, mode string) {
+	if dir := s.webDistDirOverride(); dir != "" {
+		return os.DirFS(dir), true, WebServeCustom
+	}
+	if !hasIndexHTML(s.assets) {
+		return nil, false, WebServeMissing
+	}
+	if s.assetsNoCache {
+		return s.assets, true, WebServeDisk
+	}
+	return s.assets, false, WebServeEmbedded
+}
+
+// WebServeMode reports where the web UI is currently served from.
+func (s *Server) WebServeMode() string {
+	_, _, mode := s.webAssets()
+	return mode
+}
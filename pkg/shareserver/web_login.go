@@ -0,0 +1,231 @@
+package shareserver
+
+import (
+	"net/http"
+	"strings"
+)
+
+// cookieShareToken carries the auth token for page loads of the web UI, which
+// can't send X-Share-Token. API routes keep using the header/query token only.
+const cookieShareToken = "localshare_token"
+
+// webLoginBasePath in webLoginPage is replaced with the request's base path.
+const webLoginBasePath = "{{basePath}}"
+
+// webLoginPage is shown instead of the SPA when the web UI is protected.
+// It must work without any other asset: inline CSS/JS only, no product details.
+const webLoginPage = `<!doctype html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>需要访问口令</title>
+<style>
+body{margin:0;min-height:100vh;display:flex;align-items:center;justify-content:center;background:#1b2636;color:#fff;font-family:system-ui,sans-serif}
+form{display:flex;flex-direction:column;gap:12px;width:min(320px,90vw)}
+input,button{font:inherit;padding:10px;border-radius:6px;border:1px solid #ffffff33}
+input{background:#ffffff0d;color:#fff}
+button{background:#1976d2;color:#fff;border:none;cursor:pointer}
+button:disabled{opacity:.6}
+#err{min-height:1.2em;color:#f48fb1;font-size:14px}
+</style>
+</head>
+<body>
+<form id="f">
+<label for="p">请输入访问口令</label>
+<input id="p" type="password" autocomplete="current-password" maxlength="16" autofocus required>
+<button id="b" type="submit">进入</button>
+<div id="err"></div>
+</form>
+<script>
+// Proof of work for a 428 AUTH_CHALLENGE, as web/src/utils/pow.ts solves it.
+// There's no crypto.subtle over plain http, so SHA-256 is inlined.
+function powSolver() {
+  var K = [
+    0x428a2f98, 0x71374491, 0xb5c0fbcf, 0xe9b5dba5, 0x3956c25b, 0x59f111f1, 0x923f82a4, 0xab1c5ed5,
+    0xd807aa98, 0x12835b01, 0x243185be, 0x550c7dc3, 0x72be5d74, 0x80deb1fe, 0x9bdc06a7, 0xc19bf174,
+    0xe49b69c1, 0xefbe4786, 0x0fc19dc6, 0x240ca1cc, 0x2de92c6f, 0x4a7484aa, 0x5cb0a9dc, 0x76f988da,
+    0x983e5152, 0xa831c66d, 0xb00327c8, 0xbf597fc7, 0xc6e00bf3, 0xd5a79147, 0x06ca6351, 0x14292967,
+    0x27b70a85, 0x2e1b2138, 0x4d2c6dfc, 0x53380d13, 0x650a7354, 0x766a0abb, 0x81c2c92e, 0x92722c85,
+    0xa2bfe8a1, 0xa81a664b, 0xc24b8b70, 0xc76c51a3, 0xd192e819, 0xd6990624, 0xf40e3585, 0x106aa070,
+    0x19a4c116, 0x1e376c08, 0x2748774c, 0x34b0bcb5, 0x391c0cb3, 0x4ed8aa4a, 0x5b9cca4f, 0x682e6ff3,
+    0x748f82ee, 0x78a5636f, 0x84c87814, 0x8cc70208, 0x90befffa, 0xa4506ceb, 0xbef9a3f7, 0xc67178f2
+  ];
+  function rotr(x, n) { return (x >>> n) | (x << (32 - n)); }
+  function sha256(data) {
+    var h = [0x6a09e667, 0xbb67ae85, 0x3c6ef372, 0xa54ff53a, 0x510e527f, 0x9b05688c, 0x1f83d9ab, 0x5be0cd19];
+    var len = data.length, total = Math.ceil((len + 9) / 64) * 64;
+    var buf = new Uint8Array(total), w = new Array(64), i;
+    buf.set(data);
+    buf[len] = 0x80;
+    var bitLen = len * 8;
+    for (i = 1; i <= 4; i++) buf[total - i] = (bitLen >>> (8 * (i - 1))) & 0xff;
+    for (var off = 0; off < total; off += 64) {
+      for (i = 0; i < 16; i++) {
+        var o = off + i * 4;
+        w[i] = (buf[o] << 24) | (buf[o + 1] << 16) | (buf[o + 2] << 8) | buf[o + 3];
+      }
+      for (i = 16; i < 64; i++) {
+        var x = w[i - 15], y = w[i - 2];
+        w[i] = (w[i - 16] + (rotr(x, 7) ^ rotr(x, 18) ^ (x >>> 3)) + w[i - 7] + (rotr(y, 17) ^ rotr(y, 19) ^ (y >>> 10))) | 0;
+      }
+      var a = h[0], b = h[1], c = h[2], d = h[3], e = h[4], f = h[5], g = h[6], hh = h[7];
+      for (i = 0; i < 64; i++) {
+        var t1 = (hh + (rotr(e, 6) ^ rotr(e, 11) ^ rotr(e, 25)) + ((e & f) ^ (~e & g)) + K[i] + w[i]) | 0;
+        var t2 = ((rotr(a, 2) ^ rotr(a, 13) ^ rotr(a, 22)) + ((a & b) ^ (a & c) ^ (b & c))) | 0;
+        hh = g; g = f; f = e; e = (d + t1) | 0; d = c; c = b; b = a; a = (t1 + t2) | 0;
+      }
+      h[0] = (h[0] + a) | 0; h[1] = (h[1] + b) | 0; h[2] = (h[2] + c) | 0; h[3] = (h[3] + d) | 0;
+      h[4] = (h[4] + e) | 0; h[5] = (h[5] + f) | 0; h[6] = (h[6] + g) | 0; h[7] = (h[7] + hh) | 0;
+    }
+    return h;
+  }
+  function zeroBits(h) {
+    for (var n = 0, i = 0; i < 8; i++) {
+      if (h[i] !== 0) return n + Math.clz32(h[i]);
+      n += 32;
+    }
+    return n;
+  }
+  return function (ch) {
+    var enc = new TextEncoder();
+    for (var i = 0; ; i++) {
+      if (zeroBits(sha256(enc.encode(ch.prefix + ":" + i))) >= ch.difficulty) return String(i);
+    }
+  };
+}
+// solveChallenge runs the search in a worker so the page stays responsive.
+function solveChallenge(ch) {
+  return new Promise(function (resolve) {
+    var worker;
+    try {
+      var src = "var solve = (" + powSolver + ")(); onmessage = function (e) { postMessage(solve(e.data)); };";
+      worker = new Worker(URL.createObjectURL(new Blob([src], { type: "text/javascript" })));
+    } catch (_) {
+      resolve(powSolver()(ch));
+      return;
+    }
+    worker.onmessage = function (e) { worker.terminate(); resolve(e.data); };
+    worker.onerror = function () { worker.terminate(); resolve(powSolver()(ch)); };
+    worker.postMessage(ch);
+  });
+}
+// A folder link's one-time token (?ott=) stands in for the pass, once.
+(function () {
+  var url = new URL(location.href);
+  var ott = url.searchParams.get("ott");
+  if (!ott) return;
+  url.searchParams.delete("ott");
+  history.replaceState(null, "", url.toString());
+  fetch("{{basePath}}/api/auth", {
+    method: "POST",
+    headers: { "Content-Type": "application/json", Accept: "application/json" },
+    body: JSON.stringify({ ott: ott }),
+    credentials: "same-origin"
+  }).then(function (resp) {
+    return resp.ok ? resp.json() : null;
+  }).then(function (data) {
+    if (!data) {
+      document.getElementById("err").textContent = "链接已失效，请输入访问口令";
+      return;
+    }
+    try { sessionStorage.setItem("localshare.web.shareToken.v1", data.token || ""); } catch (_) {}
+    location.reload();
+  }).catch(function () {});
+})();
+document.getElementById("f").addEventListener("submit", async function (e) {
+  e.preventDefault();
+  var btn = document.getElementById("b");
+  var err = document.getElementById("err");
+  var pass = document.getElementById("p").value.trim();
+  btn.disabled = true;
+  err.textContent = "";
+  try {
+    var challenge = null;
+    for (var attempt = 0; ; attempt++) {
+      var resp = await fetch("{{basePath}}/api/auth", {
+        method: "POST",
+        headers: { "Content-Type": "application/json", Accept: "application/json" },
+        body: JSON.stringify(challenge ? { pass: pass, challenge: challenge } : { pass: pass }),
+        credentials: "same-origin"
+      });
+      var data = await resp.json().catch(function () { return null; });
+      // The server asks for proof of work after many wrong passes.
+      if (resp.status === 428 && data && data.code === "AUTH_CHALLENGE" && data.challenge && attempt < 2) {
+        err.textContent = "正在验证，请稍候…";
+        challenge = { prefix: data.challenge.prefix, nonce: await solveChallenge(data.challenge) };
+        err.textContent = "";
+        continue;
+      }
+      if (!resp.ok) {
+        err.textContent = (data && data.error) || ("鉴权失败: " + resp.status);
+        return;
+      }
+      try { sessionStorage.setItem("localshare.web.shareToken.v1", (data && data.token) || ""); } catch (_) {}
+      location.reload();
+      return;
+    }
+  } catch (_) {
+    err.textContent = "网络错误，请重试";
+  } finally {
+    btn.disabled = false;
+  }
+});
+</script>
+</body>
+</html>
+`
+
+func setShareTokenCookie(w http.ResponseWriter, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieShareToken,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// webUIAuthorized reports whether the static web UI may be served to r.
+// It only restricts anything when both an access pass and the protect-web-ui
+// setting are on.
+func (s *Server) webUIAuthorized(r *http.Request) bool {
+	if !s.getBoolSetting(SettingKeyProtectWebUI) {
+		return true
+	}
+	pass, enabled, err := s.getAccessPassFromSettings()
+	if err != nil {
+		return false
+	}
+	if !enabled || pass == "" {
+		return true
+	}
+
+	token := ""
+	if c, err := r.Cookie(cookieShareToken); err == nil {
+		token = strings.TrimSpace(c.Value)
+	}
+	if token == "" {
+		token = strings.TrimSpace(r.Header.Get(headerShareToken))
+	}
+	if token == "" {
+		token = strings.TrimSpace(r.URL.Query().Get(queryShareToken))
+	}
+	return s.auth.validate(token, s.clientIP(r), accessPassHash(pass)) == authOK
+}
+
+// serveWebLogin answers an unauthenticated request for the protected web UI.
+// Page navigations get the login form; asset requests just get 401.
+func serveWebLogin(w http.ResponseWriter, r *http.Request, isAsset bool) {
+	w.Header().Set("Cache-Control", "no-store")
+	if isAsset {
+		http.Error(w, "需要访问口令", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusUnauthorized)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write([]byte(strings.Replace(webLoginPage, webLoginBasePath, requestBasePath(r), 1)))
+	}
+}
@@ -0,0 +1,51 @@
+package shareserver
+
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+// zipWarningsEntry is appended to an archive listing the files skipped
+// because they changed after the candidate pass.
+const zipWarningsEntry = "MANIFEST-WARNINGS.txt"
+
+// maxZipChangedReported caps the files named in a 409 ZIP_FILES_CHANGED.
+const maxZipChangedReported = 50
+
+// errZipFileChanged stops an archive that must not skip changed files.
+var errZipFileChanged = errors.New("file changed since it was listed")
+
+// candidateChanged reports whether the file no longer has the size and mtime
+// recorded in the candidate pass.
+func candidateChanged(c zipCandidate, st os.FileInfo) bool {
+	return st.Size() != c.size || !st.ModTime().Equal(c.modTime)
+}
+
+// changedCandidates re-checks every candidate (strict downloads, before any
+// byte is sent) and returns the zip entries of those that changed or are gone.
+// beforeStat, if set, runs right before each file is compared.
+func changedCandidates(candidates []zipCandidate, beforeStat func(c zipCandidate)) []string {
+	var changed []string
+	for _, c := range candidates {
+		if beforeStat != nil {
+			beforeStat(c)
+		}
+		st, err := os.Stat(c.fullPath)
+		if err != nil || candidateChanged(c, st) {
+			changed = append(changed, c.zipEntry)
+		}
+	}
+	return changed
+}
+
+func zipWarningsText(changed []string) string {
+	var b strings.Builder
+	b.WriteString("以下文件在打包期间被修改，已跳过（可稍后重新下载）：\r\n")
+	b.WriteString("These files changed while the archive was built and were left out:\r\n\r\n")
+	for _, name := range changed {
+		b.WriteString(name)
+		b.WriteString("\r\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,92 @@
+package shareserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+)
+
+// SettingKeyZipDefaultIgnore (JSON array of names, globs such as "*.iso", or
+// share-relative prefixes) is left out of every zip download on top of what
+// the request asks for, e.g. ["node_modules", ".git", "*.iso"]. Only the
+// desktop can change it; a remote admin may bypass it per request with
+// noDefaultIgnore.
+const SettingKeyZipDefaultIgnore = "local-share:zip-default-ignore"
+
+// headerZipDefaultIgnore lists the default entries a zip response applied
+// that the request hadn't asked for, each path-escaped, joined by ",".
+const headerZipDefaultIgnore = "X-Zip-Default-Ignore"
+
+var errInvalidZipDefaultIgnore = errors.New("默认忽略列表必须是名称、通配符或路径数组，通配符只能用于名称")
+
+// validateZipDefaultIgnore accepts names, single-name globs and prefixes.
+func validateZipDefaultIgnore(raw json.RawMessage) error {
+	var list []string
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return errInvalidZipDefaultIgnore
+	}
+	for _, ig := range list {
+		ig = strings.TrimSpace(ig)
+		if ig == "" {
+			return errInvalidZipDefaultIgnore
+		}
+		if !isZipIgnoreGlob(ig) {
+			continue
+		}
+		if strings.ContainsAny(ig, `/\`) {
+			return errInvalidZipDefaultIgnore
+		}
+		if _, err := path.Match(ig, ""); err != nil {
+			return errInvalidZipDefaultIgnore
+		}
+	}
+	return nil
+}
+
+func (s *Server) zipDefaultIgnore() []string {
+	if s.settings == nil {
+		return nil
+	}
+	raw, ok, err := s.settings.Get(SettingKeyZipDefaultIgnore)
+	if err != nil || !ok || validateZipDefaultIgnore(raw) != nil {
+		return nil
+	}
+	var list []string
+	_ = json.Unmarshal(raw, &list)
+	return list
+}
+
+// withZipDefaultIgnore returns the request's ignore list with the default
+// one merged in, and reports the entries it added in headerZipDefaultIgnore
+// so the client can tell the user. bypass skips the defaults but needs a
+// remote admin; otherwise the error is written and ok is false.
+func (s *Server) withZipDefaultIgnore(w http.ResponseWriter, r *http.Request, ignore []string, bypass bool) (merged, added []string, ok bool) {
+	if bypass {
+		ip, ok := s.requireAdmin(w, r)
+		if !ok {
+			return nil, nil, false
+		}
+		s.logf("admin: zip without default ignore by ip=%s", ip)
+		return ignore, nil, true
+	}
+	have := newZipIgnore(ignore)
+	defaults := newZipIgnore(s.zipDefaultIgnore())
+	for _, ig := range slices.Concat(defaults.names, defaults.prefixes) {
+		if !have.listed(ig) {
+			added = append(added, ig)
+		}
+	}
+	if len(added) == 0 {
+		return ignore, nil, true
+	}
+	escaped := make([]string, len(added))
+	for i, ig := range added {
+		escaped[i] = url.PathEscape(ig)
+	}
+	w.Header().Set(headerZipDefaultIgnore, strings.Join(escaped, ","))
+	return slices.Concat(ignore, added), added, true
+}
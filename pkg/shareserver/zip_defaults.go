@@ -0,0 +1,223 @@
+package shareserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SettingKeyZipIgnoreSuggestions (JSON array of names) replaces the names
+// /api/zip-defaults looks for, e.g. ["node_modules", "target", ".gradle"].
+const SettingKeyZipIgnoreSuggestions = "local-share:zip-ignore-suggestions"
+
+// defaultZipIgnoreSuggestions are build output, dependencies and VCS data that
+// are rarely wanted in a downloaded archive.
+var defaultZipIgnoreSuggestions = []string{
+	"node_modules",
+	".git",
+	".svn",
+	".hg",
+	"target",
+	"dist",
+	"__pycache__",
+	".venv",
+	"venv",
+	".idea",
+	".DS_Store",
+	"Thumbs.db",
+}
+
+const (
+	// zipSuggestionSizeBudget bounds the size walk of one request; entries not
+	// finished in time are reported with Complete=false.
+	zipSuggestionSizeBudget = 2 * time.Second
+	// maxZipSuggestionSizeFiles stops the walk of one entry early.
+	maxZipSuggestionSizeFiles = 200000
+	// zipSuggestionSizeTTL is how long a computed size is reused.
+	zipSuggestionSizeTTL  = time.Minute
+	maxZipSuggestionSizes = 256
+)
+
+var errInvalidZipIgnoreSuggestions = errors.New("忽略建议必须是名称数组")
+
+// zipSuggestion is one entry of the folder worth ignoring.
+type zipSuggestion struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"` // "file" | "directory"
+	Size      int64  `json:"size"`
+	FileCount int    `json:"fileCount"`
+	// Complete is false when Size and FileCount stopped at a limit.
+	Complete bool `json:"complete"`
+}
+
+type zipDefaultsResponse struct {
+	Path        string          `json:"path"`
+	Suggestions []zipSuggestion `json:"suggestions"`
+}
+
+// validateZipIgnoreSuggestions accepts an array of plain names.
+func validateZipIgnoreSuggestions(raw json.RawMessage) error {
+	var list []string
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return errInvalidZipIgnoreSuggestions
+	}
+	for _, name := range list {
+		name = strings.TrimSpace(name)
+		if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+			return errInvalidZipIgnoreSuggestions
+		}
+	}
+	return nil
+}
+
+func (s *Server) zipIgnoreSuggestionNames() []string {
+	raw, ok, err := s.settings.Get(SettingKeyZipIgnoreSuggestions)
+	if err != nil || !ok || validateZipIgnoreSuggestions(raw) != nil {
+		return defaultZipIgnoreSuggestions
+	}
+	var list []string
+	_ = json.Unmarshal(raw, &list)
+	return list
+}
+
+type cachedEntrySize struct {
+	size     int64
+	files    int
+	complete bool
+	modTime  time.Time
+	at       time.Time
+}
+
+// entrySizes caches subtree sizes by absolute path, so opening the download
+// settings repeatedly doesn't walk node_modules every time.
+type entrySizes struct {
+	mu      sync.Mutex
+	entries map[string]cachedEntrySize
+}
+
+func (c *entrySizes) get(p string, modTime time.Time) (cachedEntrySize, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[p]
+	if !ok || !e.complete || !e.modTime.Equal(modTime) || time.Since(e.at) >= zipSuggestionSizeTTL {
+		return cachedEntrySize{}, false
+	}
+	return e, true
+}
+
+func (c *entrySizes) put(p string, e cachedEntrySize) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = map[string]cachedEntrySize{}
+	}
+	if len(c.entries) >= maxZipSuggestionSizes {
+		clear(c.entries)
+	}
+	c.entries[p] = e
+}
+
+// subtreeSize adds up the regular files below dir without following links.
+func subtreeSize(ctx context.Context, dir string) (size int64, files int, complete bool) {
+	complete = true
+	_ = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if ctx.Err() != nil || files >= maxZipSuggestionSizeFiles {
+			complete = false
+			return filepath.SkipAll
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			size += info.Size()
+			files++
+		}
+		return nil
+	})
+	return size, files, complete
+}
+
+// handleZipDefaults suggests ignore entries for zipping a folder: the names
+// from SettingKeyZipIgnoreSuggestions that exist directly inside it, with
+// their sizes. Only the folder's own children are matched.
+func (s *Server) handleZipDefaults(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "仅支持 GET"})
+		return
+	}
+
+	s.mu.RLock()
+	root := s.sharedRoot
+	s.mu.RUnlock()
+	if root == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "服务未启动"})
+		return
+	}
+	if !s.requireAuth(w, r) {
+		return
+	}
+	if !s.requirePermission(w, "read") {
+		return
+	}
+
+	fullPath, ok := s.resolveSharePath(w, r, root, strings.TrimSpace(r.URL.Query().Get("path")))
+	if !ok {
+		return
+	}
+	entries, err := os.ReadDir(fullPath)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "目录不存在"})
+		return
+	}
+
+	ignore := newZipIgnoreFold(s.zipIgnoreSuggestionNames(), caseInsensitiveFS)
+	ctx, cancel := context.WithTimeout(r.Context(), zipSuggestionSizeBudget)
+	defer cancel()
+
+	resp := zipDefaultsResponse{Path: relativeSharePath(root, fullPath), Suggestions: []zipSuggestion{}}
+	for _, e := range entries {
+		if !ignore.name(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		sug := zipSuggestion{Name: e.Name(), Type: "file", Size: info.Size(), FileCount: 1, Complete: true}
+		if info.IsDir() {
+			sug.Type = "directory"
+			p := filepath.Join(fullPath, e.Name())
+			cached, ok := s.entrySizes.get(p, info.ModTime())
+			if !ok {
+				cached.size, cached.files, cached.complete = subtreeSize(ctx, p)
+				cached.modTime, cached.at = info.ModTime(), time.Now()
+				s.entrySizes.put(p, cached)
+			}
+			sug.Size, sug.FileCount, sug.Complete = cached.size, cached.files, cached.complete
+		} else if !info.Mode().IsRegular() {
+			continue
+		}
+		resp.Suggestions = append(resp.Suggestions, sug)
+	}
+	// Setting order, which is roughly "most useful first".
+	rank := map[string]int{}
+	for i, n := range ignore.names {
+		rank[strings.ToLower(n)] = i
+	}
+	slices.SortStableFunc(resp.Suggestions, func(a, b zipSuggestion) int {
+		return rank[strings.ToLower(a.Name)] - rank[strings.ToLower(b.Name)]
+	})
+	writeJSON(w, http.StatusOK, resp)
+}
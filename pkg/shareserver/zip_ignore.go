@@ -0,0 +1,125 @@
+package shareserver
+
+import (
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// zipIgnore is the ignore list of one zip request: bare names ("node_modules")
+// match any path segment, entries with a slash ("frontend/node_modules") match
+// that share-relative subtree. Both follow the same case rule.
+type zipIgnore struct {
+	names    []string
+	prefixes []string
+	// foldCase compares case-insensitively, like the Windows file system.
+	foldCase bool
+}
+
+// newZipIgnore normalizes list (slashes, leading "/", duplicates) and applies
+// the platform's case rule.
+func newZipIgnore(list []string) *zipIgnore {
+	return newZipIgnoreFold(list, runtime.GOOS == "windows")
+}
+
+func newZipIgnoreFold(list []string, foldCase bool) *zipIgnore {
+	z := &zipIgnore{foldCase: foldCase}
+	seen := make(map[string]struct{}, len(list))
+	for _, ig := range list {
+		ig = strings.TrimSpace(ig)
+		if ig == "" {
+			continue
+		}
+		ig = strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(ig)), "/")
+		if ig == "" {
+			continue
+		}
+		key := ig
+		if foldCase {
+			key = strings.ToLower(ig)
+		}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		if strings.Contains(ig, "/") {
+			z.prefixes = append(z.prefixes, ig)
+		} else {
+			z.names = append(z.names, ig)
+		}
+	}
+	return z
+}
+
+func (z *zipIgnore) equal(a, b string) bool {
+	if z.foldCase {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// name reports whether a single file or folder name is ignored. Names may
+// be globs ("*.iso").
+func (z *zipIgnore) name(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, ig := range z.names {
+		if z.equal(name, ig) {
+			return true
+		}
+		if isZipIgnoreGlob(ig) {
+			pattern, subject := ig, name
+			if z.foldCase {
+				pattern, subject = strings.ToLower(ig), strings.ToLower(name)
+			}
+			if ok, _ := path.Match(pattern, subject); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// listed reports whether the normalized entry ig is in the list itself.
+func (z *zipIgnore) listed(ig string) bool {
+	for _, l := range slices.Concat(z.names, z.prefixes) {
+		if z.equal(l, ig) {
+			return true
+		}
+	}
+	return false
+}
+
+func isZipIgnoreGlob(ig string) bool {
+	return strings.ContainsAny(ig, "*?[")
+}
+
+// entry reports whether a share-relative, slash-separated path is ignored:
+// one of its segments is an ignored name, or it is an ignored prefix or lies
+// inside one.
+func (z *zipIgnore) entry(zipEntry string) bool {
+	if zipEntry == "" {
+		return false
+	}
+	zipEntry = strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(zipEntry)), "/")
+	if zipEntry == "" {
+		return false
+	}
+	for _, p := range strings.Split(zipEntry, "/") {
+		if z.name(p) {
+			return true
+		}
+	}
+	for _, pref := range z.prefixes {
+		if len(zipEntry) < len(pref) || !z.equal(zipEntry[:len(pref)], pref) {
+			continue
+		}
+		if len(zipEntry) == len(pref) || zipEntry[len(pref)] == '/' {
+			return true
+		}
+	}
+	return false
+}
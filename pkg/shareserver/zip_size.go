@@ -0,0 +1,69 @@
+package shareserver
+
+import "math"
+
+// Values of pathsRequest.Compression.
+const (
+	zipCompressionDeflate = "deflate"
+	zipCompressionStore   = "store"
+)
+
+// headerEstimatedUncompressedSize carries the summed size of the files in a
+// zip, known before streaming starts even when the zip's own length isn't.
+const headerEstimatedUncompressedSize = "X-Estimated-Uncompressed-Size"
+
+// Record sizes written by archive/zip, see its struct.go.
+const (
+	zipLocalHeaderLen      = 30
+	zipCentralHeaderLen    = 46
+	zipEndLen              = 22
+	zipDataDescriptorLen   = 16
+	zipDataDescriptor64Len = 24
+	zipEnd64Len            = 56
+	zipEnd64LocatorLen     = 20
+	zipExtTimeExtraLen     = 9 // SetModTime adds an extended timestamp
+	zipUint32Max           = math.MaxUint32
+	zipUint16Max           = math.MaxUint16
+	zip64ExtraHeaderLen    = 4
+	zip64ExtraFieldLength  = 8
+)
+
+// storeZipSize is the exact length writeZip produces in store mode for
+// candidates named names. It mirrors archive/zip's Writer: a local header,
+// the data and a data descriptor per file (64-bit sizes past 4 GiB), then the
+// central directory with Zip64 extras where sizes or offsets reach 4 GiB - 1,
+// and the Zip64 end records when any were needed.
+func storeZipSize(names []string, candidates []zipCandidate) int64 {
+	var offset, central uint64
+	usedZip64 := false
+	for i, c := range candidates {
+		nameLen := uint64(len(names[i]))
+		size := uint64(c.size)
+		entryOffset := offset
+
+		offset += zipLocalHeaderLen + nameLen + zipExtTimeExtraLen + size
+		if size > zipUint32Max {
+			offset += zipDataDescriptor64Len
+		} else {
+			offset += zipDataDescriptorLen
+		}
+
+		central += zipCentralHeaderLen + nameLen + zipExtTimeExtraLen
+		if size >= zipUint32Max || entryOffset >= zipUint32Max {
+			usedZip64 = true
+			central += zip64ExtraHeaderLen
+			if size >= zipUint32Max {
+				central += 2 * zip64ExtraFieldLength // uncompressed and compressed
+			}
+			if entryOffset >= zipUint32Max {
+				central += zip64ExtraFieldLength
+			}
+		}
+	}
+
+	total := offset + central + zipEndLen
+	if usedZip64 || len(candidates) >= zipUint16Max || central >= zipUint32Max || offset >= zipUint32Max {
+		total += zipEnd64Len + zipEnd64LocatorLen
+	}
+	return int64(total)
+}
@@ -0,0 +1,11 @@
+package shareserver
+
+// SettingKeyMarkUploads (JSON bool) tags every uploaded file with
+// Mark-of-the-Web (a Zone.Identifier stream saying "Internet" on Windows), so
+// Explorer and SmartScreen warn before running a received binary. Off by
+// default: nothing is written then.
+const SettingKeyMarkUploads = "local-share:mark-uploads-from-web"
+
+// zoneIdentifierInternet is the Zone.Identifier content browsers write for
+// downloads (zone 3 is Internet).
+const zoneIdentifierInternet = "[ZoneTransfer]\r\nZoneId=3\r\nHostUrl=about:internet\r\n"
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package shareserver
+
+// writeZoneIdentifier is a no-op: Mark-of-the-Web is an NTFS stream.
+func writeZoneIdentifier(string) error {
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build windows
+
+package shareserver
+
+import "os"
+
+// writeZoneIdentifier adds Mark-of-the-Web to the file at path. It fails on
+// volumes without alternate data streams (FAT32, exFAT).
+func writeZoneIdentifier(path string) error {
+	return os.WriteFile(path+":Zone.Identifier", []byte(zoneIdentifierInternet), 0o644)
+}
@@ -0,0 +1,52 @@
+//go:build windows
+
+package shareserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestShareServerUploadMarkOfTheWeb(t *testing.T) {
+	tmp := t.TempDir()
+	s := newTestShareServerWithSettings(tmp)
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	upload := func(name string) {
+		t.Helper()
+		resp := postUploadForTest(t, ts, name, []byte("MZ"))
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("upload %s: expected 200, got %d", name, resp.StatusCode)
+		}
+	}
+
+	// Off by default: no stream at all.
+	upload("plain.exe")
+	if _, err := os.Stat(filepath.Join(tmp, "plain.exe") + ":Zone.Identifier"); !os.IsNotExist(err) {
+		t.Fatalf("expected no Zone.Identifier by default, got err=%v", err)
+	}
+
+	if err := s.SetSetting(SettingKeyMarkUploads, json.RawMessage(`true`)); err != nil {
+		t.Fatalf("set setting: %v", err)
+	}
+	upload("marked.exe")
+	b, err := os.ReadFile(filepath.Join(tmp, "marked.exe") + ":Zone.Identifier")
+	if err != nil {
+		t.Fatalf("read Zone.Identifier: %v", err)
+	}
+	if !strings.Contains(string(b), "ZoneId=3") {
+		t.Fatalf("expected internet zone, got %q", b)
+	}
+	if got, _ := os.ReadFile(filepath.Join(tmp, "marked.exe")); string(got) != "MZ" {
+		t.Fatalf("expected file content untouched, got %q", got)
+	}
+}
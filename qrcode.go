@@ -0,0 +1,431 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+)
+
+// A minimal QR code encoder for the headless CLI and folder links: byte mode,
+// error correction level L, versions 1-40 (up to 2953 bytes), fixed mask 0.
+// That's plenty for a share URL and keeps us free of extra dependencies.
+
+// qrECCPerBlockL and qrBlocksL are the level L error correction codewords per
+// block and the number of blocks, indexed by version (ISO/IEC 18004 table 9).
+var qrECCPerBlockL = [...]int{0,
+	7, 10, 15, 20, 26, 18, 20, 24, 30, 18,
+	20, 24, 26, 30, 22, 24, 28, 30, 28, 28,
+	28, 28, 30, 30, 26, 28, 30, 30, 30, 30,
+	30, 30, 30, 30, 30, 30, 30, 30, 30, 30,
+}
+
+var qrBlocksL = [...]int{0,
+	1, 1, 1, 1, 1, 2, 2, 2, 2, 4,
+	4, 4, 4, 4, 6, 6, 6, 6, 7, 8,
+	8, 9, 9, 10, 12, 12, 12, 13, 14, 15,
+	16, 17, 18, 19, 19, 20, 21, 22, 24, 25,
+}
+
+const qrMaxVersion = 40
+
+var errQRTooLong = errors.New("内容过长，无法生成二维码")
+
+// qrRawModules is how many modules of a version hold data and EC codewords
+// (and remainder bits): everything but the function patterns.
+func qrRawModules(version int) int {
+	n := (16*version+128)*version + 64
+	if version >= 2 {
+		align := version/7 + 2
+		n -= (25*align-10)*align - 55
+		if version >= 7 {
+			n -= 36
+		}
+	}
+	return n
+}
+
+// qrDataCapacity is how many data codewords a level L symbol of version has.
+func qrDataCapacity(version int) int {
+	return qrRawModules(version)/8 - qrECCPerBlockL[version]*qrBlocksL[version]
+}
+
+// qrCountBits is the width of the byte mode character count.
+func qrCountBits(version int) int {
+	if version <= 9 {
+		return 8
+	}
+	return 16
+}
+
+// qrAlignmentPositions returns the alignment pattern centers along one axis.
+func qrAlignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	n := version/7 + 2
+	step := (version*8 + n*3 + 5) / (n*4 - 4) * 2
+	pos := make([]int, n)
+	pos[0] = 6
+	for i, p := n-1, version*4+10; i >= 1; i, p = i-1, p-step {
+		pos[i] = p
+	}
+	return pos
+}
+
+// encodeQR returns the module matrix (true = dark), indexed [y][x], without quiet zone.
+func encodeQR(text string) ([][]bool, error) {
+	data := []byte(text)
+	version := 0
+	for v := 1; v <= qrMaxVersion; v++ {
+		if 4+qrCountBits(v)+8*len(data) <= qrDataCapacity(v)*8 {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, errQRTooLong
+	}
+	codewords := qrInterleave(qrDataCodewords(data, qrCountBits(version), qrDataCapacity(version)), version)
+
+	q := newQRMatrix(version)
+	q.placeData(codewords)
+	q.applyMask0()
+	q.drawFormat(qrFormatBits(0b01, 0))
+	return q.modules, nil
+}
+
+// qrDataCodewords builds the byte-mode bit stream padded to capacity bytes.
+func qrDataCodewords(data []byte, countBits int, capacity int) []byte {
+	var bits []bool
+	appendBits := func(v uint, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bits = append(bits, (v>>uint(i))&1 == 1)
+		}
+	}
+	appendBits(0b0100, 4)
+	appendBits(uint(len(data)), countBits)
+	for _, b := range data {
+		appendBits(uint(b), 8)
+	}
+	terminator := capacity*8 - len(bits)
+	if terminator > 4 {
+		terminator = 4
+	}
+	appendBits(0, terminator)
+	for len(bits)%8 != 0 {
+		bits = append(bits, false)
+	}
+
+	out := make([]byte, 0, capacity)
+	for i := 0; i < len(bits); i += 8 {
+		var b byte
+		for j := 0; j < 8; j++ {
+			b <<= 1
+			if bits[i+j] {
+				b |= 1
+			}
+		}
+		out = append(out, b)
+	}
+	for pad := byte(0xEC); len(out) < capacity; {
+		out = append(out, pad)
+		pad ^= 0xEC ^ 0x11
+	}
+	return out
+}
+
+// qrInterleave splits data into blocks, appends Reed-Solomon EC and
+// interleaves. When the codewords don't divide evenly, the last blocks are
+// one data codeword longer.
+func qrInterleave(data []byte, version int) []byte {
+	numBlocks := qrBlocksL[version]
+	ecc := qrECCPerBlockL[version]
+	raw := qrRawModules(version) / 8
+	short := numBlocks - raw%numBlocks
+	shortLen := raw/numBlocks - ecc
+
+	blocks := make([][]byte, numBlocks)
+	ecs := make([][]byte, numBlocks)
+	for i, off := 0, 0; i < numBlocks; i++ {
+		n := shortLen
+		if i >= short {
+			n++
+		}
+		blocks[i] = data[off : off+n]
+		ecs[i] = qrReedSolomon(blocks[i], ecc)
+		off += n
+	}
+	out := make([]byte, 0, raw)
+	for i := 0; i <= shortLen; i++ {
+		for _, b := range blocks {
+			if i < len(b) {
+				out = append(out, b[i])
+			}
+		}
+	}
+	for i := 0; i < ecc; i++ {
+		for _, e := range ecs {
+			out = append(out, e[i])
+		}
+	}
+	return out
+}
+
+func qrGFMul(a, b byte) byte {
+	var r byte
+	for i := 7; i >= 0; i-- {
+		hi := r & 0x80
+		r <<= 1
+		if hi != 0 {
+			r ^= 0x1D
+		}
+		if (b>>uint(i))&1 == 1 {
+			r ^= a
+		}
+	}
+	return r
+}
+
+// qrReedSolomon returns the n EC codewords for data over GF(256)/0x11D.
+func qrReedSolomon(data []byte, n int) []byte {
+	// Generator polynomial coefficients (highest degree implied), roots α^0..α^(n-1).
+	gen := make([]byte, n)
+	gen[n-1] = 1
+	root := byte(1)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			gen[j] = qrGFMul(gen[j], root)
+			if j+1 < n {
+				gen[j] ^= gen[j+1]
+			}
+		}
+		root = qrGFMul(root, 0x02)
+	}
+
+	rem := make([]byte, n)
+	for _, b := range data {
+		factor := b ^ rem[0]
+		copy(rem, rem[1:])
+		rem[n-1] = 0
+		for j := range rem {
+			rem[j] ^= qrGFMul(gen[j], factor)
+		}
+	}
+	return rem
+}
+
+// qrFormatBits returns the 15-bit masked format information.
+func qrFormatBits(ecLevel, mask int) int {
+	data := ecLevel<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+type qrMatrix struct {
+	size     int
+	modules  [][]bool
+	reserved [][]bool
+}
+
+func newQRMatrix(version int) *qrMatrix {
+	size := version*4 + 17
+	q := &qrMatrix{size: size, modules: make([][]bool, size), reserved: make([][]bool, size)}
+	for y := range q.modules {
+		q.modules[y] = make([]bool, size)
+		q.reserved[y] = make([]bool, size)
+	}
+
+	for i := 0; i < size; i++ {
+		q.setFunc(6, i, i%2 == 0)
+		q.setFunc(i, 6, i%2 == 0)
+	}
+	q.drawFinder(3, 3)
+	q.drawFinder(size-4, 3)
+	q.drawFinder(3, size-4)
+	pos := qrAlignmentPositions(version)
+	last := len(pos) - 1
+	for i, cx := range pos {
+		for j, cy := range pos {
+			// Skip the three corners taken by finder patterns.
+			if i == 0 && j == 0 || i == 0 && j == last || i == last && j == 0 {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					d := max(qrAbs(dx), qrAbs(dy))
+					q.setFunc(cx+dx, cy+dy, d != 1)
+				}
+			}
+		}
+	}
+	if version >= 7 {
+		q.drawVersion(version)
+	}
+	// Reserve the format areas; real bits are drawn after masking.
+	q.drawFormat(0)
+	return q
+}
+
+// drawVersion draws the two 6x3 version information blocks (versions 7+).
+func (q *qrMatrix) drawVersion(version int) {
+	rem := version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	bits := version<<12 | rem
+	for i := 0; i < 18; i++ {
+		dark := (bits>>uint(i))&1 == 1
+		a, b := q.size-11+i%3, i/3
+		q.setFunc(a, b, dark)
+		q.setFunc(b, a, dark)
+	}
+}
+
+func qrAbs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func (q *qrMatrix) setFunc(x, y int, dark bool) {
+	q.modules[y][x] = dark
+	q.reserved[y][x] = true
+}
+
+// drawFinder draws a finder pattern plus its separator around center (cx, cy).
+func (q *qrMatrix) drawFinder(cx, cy int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			x, y := cx+dx, cy+dy
+			if x < 0 || y < 0 || x >= q.size || y >= q.size {
+				continue
+			}
+			d := max(qrAbs(dx), qrAbs(dy))
+			q.setFunc(x, y, d != 2 && d != 4)
+		}
+	}
+}
+
+func (q *qrMatrix) drawFormat(bits int) {
+	bit := func(i int) bool { return (bits>>uint(i))&1 == 1 }
+	for i := 0; i <= 5; i++ {
+		q.setFunc(8, i, bit(i))
+	}
+	q.setFunc(8, 7, bit(6))
+	q.setFunc(8, 8, bit(7))
+	q.setFunc(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.setFunc(14-i, 8, bit(i))
+	}
+	for i := 0; i < 8; i++ {
+		q.setFunc(q.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.setFunc(8, q.size-15+i, bit(i))
+	}
+	q.setFunc(8, q.size-8, true)
+}
+
+// placeData fills non-reserved modules in the standard zigzag order.
+func (q *qrMatrix) placeData(codewords []byte) {
+	i := 0
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < q.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = q.size - 1 - vert
+				}
+				if q.reserved[y][x] {
+					continue
+				}
+				if i < len(codewords)*8 {
+					q.modules[y][x] = (codewords[i>>3]>>uint(7-i&7))&1 == 1
+				}
+				i++
+			}
+		}
+	}
+}
+
+func (q *qrMatrix) applyMask0() {
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if !q.reserved[y][x] && (x+y)%2 == 0 {
+				q.modules[y][x] = !q.modules[y][x]
+			}
+		}
+	}
+}
+
+// writeQRASCII renders modules with half-block characters, two rows per line,
+// light modules drawn as blocks so it scans on dark terminals.
+func writeQRASCII(w io.Writer, modules [][]bool) error {
+	const quiet = 2
+	size := len(modules)
+	light := func(x, y int) bool {
+		x, y = x-quiet, y-quiet
+		if x < 0 || y < 0 || x >= size || y >= size {
+			return true
+		}
+		return !modules[y][x]
+	}
+	var sb strings.Builder
+	total := size + quiet*2
+	for y := 0; y < total; y += 2 {
+		for x := 0; x < total; x++ {
+			top := light(x, y)
+			bottom := y+1 < total && light(x, y+1)
+			switch {
+			case top && bottom:
+				sb.WriteString("█")
+			case top:
+				sb.WriteString("▀")
+			case bottom:
+				sb.WriteString("▄")
+			default:
+				sb.WriteString(" ")
+			}
+		}
+		sb.WriteString("\n")
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// qrPNGDataURI renders modules as a "data:image/png;base64,..." URI with a
+// 4-module quiet zone, scale pixels per module.
+func qrPNGDataURI(modules [][]bool, scale int) (string, error) {
+	const quiet = 4
+	size := len(modules)
+	px := (size + quiet*2) * scale
+	img := image.NewGray(image.Rect(0, 0, px, px))
+	for y := 0; y < px; y++ {
+		for x := 0; x < px; x++ {
+			mx, my := x/scale-quiet, y/scale-quiet
+			c := color.Gray{Y: 0xFF}
+			if mx >= 0 && my >= 0 && mx < size && my < size && modules[my][mx] {
+				c = color.Gray{Y: 0}
+			}
+			img.SetGray(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
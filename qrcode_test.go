@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image/png"
+	"math/bits"
+	"strings"
+	"testing"
+)
+
+func TestQRReedSolomonKnownVector(t *testing.T) {
+	// "HELLO WORLD" 1-M example from the QR spec tutorial.
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := qrReedSolomon(data, 10); !bytes.Equal(got, want) {
+		t.Fatalf("unexpected EC codewords: %v", got)
+	}
+	// Level L, mask 0.
+	if got := qrFormatBits(0b01, 0); got != 0b111011111000100 {
+		t.Fatalf("unexpected format bits: %015b", got)
+	}
+}
+
+func TestEncodeQRShape(t *testing.T) {
+	modules, err := encodeQR("http://192.168.1.10:8080/c/123456")
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	// 34 bytes fits version 3 (29x29) at level L.
+	if len(modules) != 29 || len(modules[0]) != 29 {
+		t.Fatalf("unexpected size %d", len(modules))
+	}
+	// Finder pattern corners are dark, separators light.
+	if !modules[0][0] || !modules[0][28] || !modules[28][0] || modules[7][7] {
+		t.Fatalf("finder patterns misplaced")
+	}
+	if _, err := encodeQR(strings.Repeat("x", 2954)); err == nil {
+		t.Fatalf("expected error for too long input")
+	}
+}
+
+// qrDecodeForTest reads back a level L byte mode symbol without using the
+// encoder: function patterns, alignment positions and block layout come from
+// the tables of ISO/IEC 18004, and every block must pass its Reed-Solomon
+// check.
+func qrDecodeForTest(t *testing.T, modules [][]bool) string {
+	t.Helper()
+	n := len(modules)
+	version := (n - 17) / 4
+	// version -> alignment centers, and blocks as {count, data codewords}.
+	align := map[int][]int{
+		1: nil, 2: {6, 18}, 7: {6, 22, 38}, 10: {6, 28, 50}, 14: {6, 26, 46, 66},
+		25: {6, 32, 58, 84, 110}, 40: {6, 30, 58, 86, 114, 142, 170},
+	}
+	type group struct{ count, data int }
+	blocks := map[int][]group{
+		1: {{1, 19}}, 2: {{1, 34}}, 7: {{2, 78}}, 10: {{2, 68}, {2, 69}}, 14: {{3, 115}, {1, 116}},
+		25: {{8, 106}, {4, 107}}, 40: {{19, 118}, {6, 119}},
+	}
+	eccLen := map[int]int{1: 7, 2: 10, 7: 20, 10: 18, 14: 30, 25: 26, 40: 30}
+	pos, ok := align[version]
+	if !ok {
+		t.Fatalf("no test tables for version %d", version)
+	}
+
+	bch := func(data, gen, genBits int) int {
+		rem := data << (genBits - 1)
+		for i := bits.Len(uint(rem)) - 1; i >= genBits-1; i-- {
+			if rem>>uint(i)&1 == 1 {
+				rem ^= gen << uint(i-genBits+1)
+			}
+		}
+		return rem
+	}
+
+	// Format information, first copy.
+	format := 0
+	fmtBit := func(i int, x, y int) {
+		if modules[y][x] {
+			format |= 1 << uint(i)
+		}
+	}
+	for i := 0; i <= 5; i++ {
+		fmtBit(i, 8, i)
+	}
+	fmtBit(6, 8, 7)
+	fmtBit(7, 8, 8)
+	fmtBit(8, 7, 8)
+	for i := 9; i < 15; i++ {
+		fmtBit(i, 14-i, 8)
+	}
+	format ^= 0x5412
+	if bch(format>>10, 0x537, 11) != format&0x3FF {
+		t.Fatalf("bad format BCH %015b", format)
+	}
+	if ec := format >> 13; ec != 0b01 {
+		t.Fatalf("error correction level bits %02b, want L", ec)
+	}
+	mask := format >> 10 & 7
+	masks := []func(x, y int) bool{
+		func(x, y int) bool { return (x+y)%2 == 0 },
+		func(x, y int) bool { return y%2 == 0 },
+		func(x, y int) bool { return x%3 == 0 },
+		func(x, y int) bool { return (x+y)%3 == 0 },
+		func(x, y int) bool { return (x/3+y/2)%2 == 0 },
+		func(x, y int) bool { return x*y%2+x*y%3 == 0 },
+		func(x, y int) bool { return (x*y%2+x*y%3)%2 == 0 },
+		func(x, y int) bool { return ((x+y)%2+x*y%3)%2 == 0 },
+	}
+
+	if version >= 7 {
+		v := 0
+		for i := 0; i < 18; i++ {
+			if modules[i/3][n-11+i%3] {
+				v |= 1 << uint(i)
+			}
+		}
+		if v>>12 != version || bch(version, 0x1F25, 13) != v&0xFFF {
+			t.Fatalf("bad version information %018b", v)
+		}
+	}
+
+	function := make([][]bool, n)
+	for y := range function {
+		function[y] = make([]bool, n)
+		for x := range function[y] {
+			function[y][x] = x == 6 || y == 6 ||
+				x < 9 && y < 9 || x >= n-8 && y < 9 || x < 9 && y >= n-8 ||
+				version >= 7 && (x >= n-11 && x < n-8 && y < 6 || y >= n-11 && y < n-8 && x < 6)
+		}
+	}
+	for _, cx := range pos {
+		for _, cy := range pos {
+			if cx < 9 && cy < 9 || cx >= n-8 && cy < 9 || cx < 9 && cy >= n-8 {
+				continue // a finder corner
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					function[cy+dy][cx+dx] = true
+				}
+			}
+		}
+	}
+
+	var stream []byte
+	var cur byte
+	nbits := 0
+	upward := true
+	for col := n - 1; col > 0; col -= 2 {
+		if col == 6 {
+			col = 5
+		}
+		for k := 0; k < n; k++ {
+			y := k
+			if upward {
+				y = n - 1 - k
+			}
+			for dx := 0; dx < 2; dx++ {
+				x := col - dx
+				if function[y][x] {
+					continue
+				}
+				cur <<= 1
+				if modules[y][x] != masks[mask](x, y) {
+					cur |= 1
+				}
+				if nbits++; nbits%8 == 0 {
+					stream = append(stream, cur)
+					cur = 0
+				}
+			}
+		}
+		upward = !upward
+	}
+
+	// Undo the interleaving.
+	var lens []int
+	for _, g := range blocks[version] {
+		for i := 0; i < g.count; i++ {
+			lens = append(lens, g.data)
+		}
+	}
+	ecc := eccLen[version]
+	cws := make([][]byte, len(lens))
+	i := 0
+	for k := 0; k < lens[len(lens)-1]; k++ {
+		for b := range cws {
+			if k < lens[b] {
+				cws[b] = append(cws[b], stream[i])
+				i++
+			}
+		}
+	}
+	for k := 0; k < ecc; k++ {
+		for b := range cws {
+			cws[b] = append(cws[b], stream[i])
+			i++
+		}
+	}
+
+	// Reed-Solomon: every syndrome of every block is zero.
+	var exp [512]byte
+	var logt [256]int
+	x := 1
+	for k := 0; k < 255; k++ {
+		exp[k], exp[k+255] = byte(x), byte(x)
+		logt[x] = k
+		if x <<= 1; x&0x100 != 0 {
+			x ^= 0x11D
+		}
+	}
+	for b, cw := range cws {
+		for k := 0; k < ecc; k++ {
+			var syn byte
+			for _, c := range cw {
+				// syn = syn*α^k + c
+				if syn != 0 {
+					syn = exp[logt[syn]+k]
+				}
+				syn ^= c
+			}
+			if syn != 0 {
+				t.Fatalf("version %d: block %d fails Reed-Solomon check %d", version, b, k)
+			}
+		}
+	}
+
+	var data []byte
+	for b := range cws {
+		data = append(data, cws[b][:lens[b]]...)
+	}
+	r := bitReaderForTest{data: data}
+	if mode := r.read(4); mode != 0b0100 {
+		t.Fatalf("mode %04b, want byte mode", mode)
+	}
+	countBits := 8
+	if version >= 10 {
+		countBits = 16
+	}
+	count := r.read(countBits)
+	out := make([]byte, count)
+	for k := range out {
+		out[k] = byte(r.read(8))
+	}
+	return string(out)
+}
+
+type bitReaderForTest struct {
+	data []byte
+	pos  int
+}
+
+func (r *bitReaderForTest) read(n int) int {
+	v := 0
+	for i := 0; i < n; i++ {
+		v = v<<1 | int(r.data[r.pos/8]>>uint(7-r.pos%8)&1)
+		r.pos++
+	}
+	return v
+}
+
+func TestEncodeQRDecodes(t *testing.T) {
+	// The largest byte count of each version at level L.
+	for _, tc := range []struct{ version, size int }{
+		{1, 17}, {2, 32}, {7, 154}, {10, 271}, {14, 458}, {25, 1273}, {40, 2953},
+	} {
+		url := "http://192.168.1.10:8080/?path=" + strings.Repeat("5paH5Lu25aS5/", tc.size)
+		url = url[:tc.size]
+		modules, err := encodeQR(url)
+		if err != nil {
+			t.Fatalf("%d bytes: %v", tc.size, err)
+		}
+		if want := tc.version*4 + 17; len(modules) != want {
+			t.Fatalf("%d bytes: expected version %d (%d modules), got %d", tc.size, tc.version, want, len(modules))
+		}
+		if got := qrDecodeForTest(t, modules); got != url {
+			t.Fatalf("version %d decodes to %q, want %q", tc.version, got, url)
+		}
+	}
+}
+
+func TestQRPNGDataURI(t *testing.T) {
+	modules, err := encodeQR("http://192.168.1.10:8080/?path=Zm9v")
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	uri, err := qrPNGDataURI(modules, 2)
+	if err != nil {
+		t.Fatalf("render failed: %v", err)
+	}
+	b64, ok := strings.CutPrefix(uri, "data:image/png;base64,")
+	if !ok {
+		t.Fatalf("unexpected data URI prefix: %.40s", uri)
+	}
+	raw, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		t.Fatalf("decode base64: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("decode png: %v", err)
+	}
+	want := (len(modules) + 8) * 2
+	if b := img.Bounds(); b.Dx() != want || b.Dy() != want {
+		t.Fatalf("expected %dx%d, got %v", want, want, b)
+	}
+	// Quiet zone is light, the top-left finder corner dark.
+	if r, _, _, _ := img.At(0, 0).RGBA(); r == 0 {
+		t.Fatalf("expected light quiet zone")
+	}
+	if r, _, _, _ := img.At(8, 8).RGBA(); r != 0 {
+		t.Fatalf("expected dark finder module")
+	}
+}
@@ -0,0 +1,6 @@
+//go:build !windows
+
+package main
+
+// watchSessionEnd is Windows-only; elsewhere SIGTERM covers logout/shutdown.
+func watchSessionEnd(onEnd func()) {}
@@ -0,0 +1,107 @@
+//go:build windows
+
+package main
+
+import (
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	wmQueryEndSession = 0x0011
+	wmEndSession      = 0x0016
+)
+
+type wndClassExW struct {
+	CbSize        uint32
+	Style         uint32
+	LpfnWndProc   uintptr
+	CbClsExtra    int32
+	CbWndExtra    int32
+	HInstance     windows.Handle
+	HIcon         windows.Handle
+	HCursor       windows.Handle
+	HbrBackground windows.Handle
+	LpszMenuName  *uint16
+	LpszClassName *uint16
+	HIconSm       windows.Handle
+}
+
+type msgW struct {
+	HWnd    uintptr
+	Message uint32
+	WParam  uintptr
+	LParam  uintptr
+	Time    uint32
+	PtX     int32
+	PtY     int32
+	Private uint32
+}
+
+var (
+	procRegisterClassExW = user32.NewProc("RegisterClassExW")
+	procCreateWindowExW  = user32.NewProc("CreateWindowExW")
+	procDefWindowProcW   = user32.NewProc("DefWindowProcW")
+	procGetMessageW      = user32.NewProc("GetMessageW")
+	procDispatchMessageW = user32.NewProc("DispatchMessageW")
+)
+
+// watchSessionEnd calls onEnd when Windows logs off or shuts down.
+// A GUI process gets no console control events, only WM_ENDSESSION, and Wails
+// doesn't expose it, so a hidden top-level window of our own listens for it.
+// onEnd runs synchronously: the process may be killed as soon as it returns.
+func watchSessionEnd(onEnd func()) {
+	go func() {
+		// The window and its message loop must stay on one OS thread.
+		runtime.LockOSThread()
+
+		className, err := windows.UTF16PtrFromString("LocalShareSessionWatcher")
+		if err != nil {
+			return
+		}
+		wndProc := windows.NewCallback(func(hwnd, msg, wParam, lParam uintptr) uintptr {
+			switch msg {
+			case wmQueryEndSession:
+				return 1
+			case wmEndSession:
+				if wParam != 0 {
+					onEnd()
+				}
+				return 0
+			}
+			r, _, _ := procDefWindowProcW.Call(hwnd, msg, wParam, lParam)
+			return r
+		})
+
+		var hInstance windows.Handle
+		_ = windows.GetModuleHandleEx(0, nil, &hInstance)
+		wc := wndClassExW{
+			LpfnWndProc:   wndProc,
+			HInstance:     hInstance,
+			LpszClassName: className,
+		}
+		wc.CbSize = uint32(unsafe.Sizeof(wc))
+		if r, _, err := procRegisterClassExW.Call(uintptr(unsafe.Pointer(&wc))); r == 0 {
+			appendLaunchLogf("session watcher register class err=%v", err)
+			return
+		}
+		// Never shown; must not be titled "LocalShare" (see showDesktopNotification).
+		hwnd, _, err := procCreateWindowExW.Call(0, uintptr(unsafe.Pointer(className)), uintptr(unsafe.Pointer(className)),
+			0, 0, 0, 0, 0, 0, 0, uintptr(hInstance), 0)
+		if hwnd == 0 {
+			appendLaunchLogf("session watcher create window err=%v", err)
+			return
+		}
+
+		var m msgW
+		for {
+			r, _, _ := procGetMessageW.Call(uintptr(unsafe.Pointer(&m)), 0, 0, 0)
+			if int32(r) <= 0 {
+				return
+			}
+			_, _, _ = procDispatchMessageW.Call(uintptr(unsafe.Pointer(&m)))
+		}
+	}()
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"LocalShare/pkg/shareserver"
+)
+
+// portableMarkerName next to the exe forces portable mode, for people who run
+// the app from a USB stick and don't want to pass --portable every time.
+const portableMarkerName = "localshare.portable"
+
+// Why settings.json lives where it does (SettingsLocation.Reason).
+const (
+	settingsLocationDefault  = "default"
+	settingsLocationFlag     = "flag"
+	settingsLocationMarker   = "marker"
+	settingsLocationFallback = "fallback"
+)
+
+var (
+	settingsLocationOnce sync.Once
+	settingsLocationVal  SettingsLocation
+)
+
+// currentSettingsLocation picks the settings location once per process.
+func currentSettingsLocation() SettingsLocation {
+	settingsLocationOnce.Do(func() {
+		exeDir := ""
+		if exe, err := os.Executable(); err == nil {
+			exeDir = filepath.Dir(exe)
+		}
+		settingsLocationVal = chooseSettingsLocation(os.Args[1:], exeDir, shareserver.DefaultSettingsDir())
+		appendLaunchLogf("settings location path=%q portable=%v reason=%s err=%q",
+			settingsLocationVal.Path, settingsLocationVal.Portable, settingsLocationVal.Reason, settingsLocationVal.Error)
+	})
+	return settingsLocationVal
+}
+
+// newSettingsStore opens settings.json at currentSettingsLocation.
+func newSettingsStore() *shareserver.SettingsStore {
+	return shareserver.NewSettingsStoreAt(currentSettingsLocation().Path)
+}
+
+// chooseSettingsLocation uses exeDir when --portable or the marker file asks
+// for it, otherwise defaultDir; when defaultDir isn't writable (redirected or
+// locked-down %APPDATA%) it falls back to exeDir if that one is.
+func chooseSettingsLocation(args []string, exeDir string, defaultDir string) SettingsLocation {
+	reason := ""
+	if hasPortableFlag(args) {
+		reason = settingsLocationFlag
+	} else if st, err := os.Stat(filepath.Join(exeDir, portableMarkerName)); exeDir != "" && err == nil && !st.IsDir() {
+		reason = settingsLocationMarker
+	}
+	if reason != "" {
+		err := canWriteDir(exeDir)
+		if err == nil {
+			return SettingsLocation{Path: filepath.Join(exeDir, "settings.json"), Portable: true, Reason: reason, Writable: true}
+		}
+		// Asked for portable on a read-only medium: keep settings usable.
+		loc := SettingsLocation{Path: filepath.Join(defaultDir, "settings.json"), Reason: reason, Error: err.Error()}
+		loc.Writable = canWriteSettingsDir(defaultDir) == nil
+		return loc
+	}
+
+	err := canWriteSettingsDir(defaultDir)
+	if err == nil {
+		return SettingsLocation{Path: filepath.Join(defaultDir, "settings.json"), Reason: settingsLocationDefault, Writable: true}
+	}
+	if exeDir != "" && canWriteDir(exeDir) == nil {
+		return SettingsLocation{Path: filepath.Join(exeDir, "settings.json"), Portable: true, Reason: settingsLocationFallback, Writable: true, Error: err.Error()}
+	}
+	return SettingsLocation{Path: filepath.Join(defaultDir, "settings.json"), Reason: settingsLocationDefault, Error: err.Error()}
+}
+
+// canWriteSettingsDir creates dir if needed and checks a file can be written there.
+func canWriteSettingsDir(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	return canWriteDir(dir)
+}
+
+// hasPortableFlag reports whether args ask for settings next to the exe.
+func hasPortableFlag(args []string) bool {
+	for _, arg := range args {
+		if arg == "--portable" || arg == "-portable" || strings.HasPrefix(arg, "--portable=") || strings.HasPrefix(arg, "-portable=") {
+			return !strings.HasSuffix(arg, "=false")
+		}
+	}
+	return false
+}
+
+// GetSettingsLocation tells the UI where settings are kept and why.
+func (a *App) GetSettingsLocation() SettingsLocation {
+	return currentSettingsLocation()
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChooseSettingsLocation(t *testing.T) {
+	exeDir := t.TempDir()
+	cfgDir := filepath.Join(t.TempDir(), "local-share-golang")
+
+	loc := chooseSettingsLocation(nil, exeDir, cfgDir)
+	if loc.Portable || loc.Reason != settingsLocationDefault || !loc.Writable || loc.Path != filepath.Join(cfgDir, "settings.json") {
+		t.Fatalf("unexpected default location %+v", loc)
+	}
+	loc = chooseSettingsLocation([]string{"--portable"}, exeDir, cfgDir)
+	if !loc.Portable || loc.Reason != settingsLocationFlag || loc.Path != filepath.Join(exeDir, "settings.json") {
+		t.Fatalf("unexpected --portable location %+v", loc)
+	}
+
+	// A file where the config dir should be makes it unwritable, even as root.
+	blocked := filepath.Join(t.TempDir(), "blocked")
+	if err := os.WriteFile(blocked, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	loc = chooseSettingsLocation(nil, exeDir, filepath.Join(blocked, "local-share-golang"))
+	if !loc.Portable || loc.Reason != settingsLocationFallback || !loc.Writable || loc.Error == "" {
+		t.Fatalf("expected a fallback next to the exe, got %+v", loc)
+	}
+	loc = chooseSettingsLocation(nil, filepath.Join(exeDir, "missing"), filepath.Join(blocked, "local-share-golang"))
+	if loc.Portable || loc.Writable || loc.Error == "" {
+		t.Fatalf("expected an unwritable location, got %+v", loc)
+	}
+
+	if err := os.WriteFile(filepath.Join(exeDir, portableMarkerName), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	loc = chooseSettingsLocation(nil, exeDir, cfgDir)
+	if !loc.Portable || loc.Reason != settingsLocationMarker {
+		t.Fatalf("expected the marker to force portable mode, got %+v", loc)
+	}
+	if _, err := parseHeadlessArgs([]string{"--headless", "--portable", "--dir", exeDir}, io.Discard); err != nil {
+		t.Fatalf("--portable should be accepted in headless mode: %v", err)
+	}
+}
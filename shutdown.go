@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"LocalShare/pkg/shareserver"
+)
+
+// shutdownTimeout bounds how long an OS-triggered shutdown waits for the share
+// server: Windows only grants a few seconds on logoff before killing us.
+const shutdownTimeout = 3 * time.Second
+
+// stopShareServer stops s, giving up after timeout so a stuck client can't
+// block the rest of the teardown. It uses Shutdown, so a share that was still
+// running stays resumable on the next start.
+func stopShareServer(s *shareserver.Server, timeout time.Duration) error {
+	done := make(chan error, 1)
+	go func() { done <- s.Shutdown(context.Background()) }()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(timeout):
+		return errors.New("停止共享超时")
+	}
+}
+
+// shutdownHooks runs the teardown steps exactly once, whichever way the
+// process ends: normal quit, SIGINT/SIGTERM or Windows session end.
+type shutdownHooks struct {
+	mu   sync.Mutex
+	fns  []func()
+	once sync.Once
+}
+
+// add registers fn; hooks run in reverse order of registration, like defer.
+func (h *shutdownHooks) add(fn func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.fns = append(h.fns, fn)
+}
+
+func (h *shutdownHooks) run(reason string) {
+	h.once.Do(func() {
+		appendLaunchLogf("shutdown begin reason=%s", reason)
+		h.mu.Lock()
+		fns := h.fns
+		h.mu.Unlock()
+		for i := len(fns) - 1; i >= 0; i-- {
+			fns[i]()
+		}
+		appendLaunchLogf("shutdown done reason=%s", reason)
+	})
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestHeadlessSignalShutdown re-runs the test binary as a real headless
+// process and stops it with SIGTERM, like a service manager would.
+func TestHeadlessSignalShutdown(t *testing.T) {
+	if dir := os.Getenv("LOCALSHARE_TEST_HEADLESS_DIR"); dir != "" {
+		os.Exit(headlessMain([]string{"--headless", "--dir", dir}))
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("SIGTERM can't be sent to a process on Windows")
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHeadlessSignalShutdown$")
+	cmd.Env = append(os.Environ(),
+		"LOCALSHARE_TEST_HEADLESS_DIR="+t.TempDir(),
+		// Keep the child's settings away from the real config dir.
+		"XDG_CONFIG_HOME="+t.TempDir(),
+		"HOME="+t.TempDir(),
+	)
+	var out syncBuffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start child: %v", err)
+	}
+	defer func() { _ = cmd.Process.Kill() }()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !strings.Contains(out.String(), "Ctrl+C") {
+		if time.Now().After(deadline) {
+			t.Fatalf("child did not start sharing, output: %s", out.String())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		t.Fatalf("signal child: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("expected clean exit, got %v, output: %s", err, out.String())
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("child did not exit after SIGTERM, output: %s", out.String())
+	}
+	for _, want := range []string{"正在停止共享", "共享已停止"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("expected %q in output, got: %s", want, out.String())
+		}
+	}
+}
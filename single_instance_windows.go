@@ -99,7 +99,26 @@ func readInstanceInfo(appID string) (instanceInfo, error) {
 	return info, nil
 }
 
+// startInstanceIPC listens for later launches on a named pipe only the
+// current user can open. If the pipe can't be created it falls back to a
+// loopback TCP port recorded in instance.json, as older versions did.
 func startInstanceIPC(appID string) (net.Listener, func(), error) {
+	name, err := instancePipeName(appID)
+	if err == nil {
+		var pl *pipeListener
+		if pl, err = listenPipe(name); err == nil {
+			// A leftover port file would only send notifications astray.
+			if p, err := instanceInfoPath(appID); err == nil {
+				_ = os.Remove(p)
+			}
+			return pl, func() { _ = pl.Close() }, nil
+		}
+	}
+	appendLaunchLogf("single-instance pipe err=%v, falling back to tcp", err)
+	return startInstanceTCP(appID)
+}
+
+func startInstanceTCP(appID string) (net.Listener, func(), error) {
 	ln, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
 		return nil, nil, err
@@ -121,6 +140,10 @@ func startInstanceIPC(appID string) (net.Listener, func(), error) {
 	}
 	cleanup := func() {
 		_ = ln.Close()
+		// 避免下次启动读到指向已关闭端口的 instance.json。
+		if p, err := instanceInfoPath(appID); err == nil {
+			_ = os.Remove(p)
+		}
 	}
 	return ln, cleanup, nil
 }
@@ -129,9 +152,20 @@ func notifyExistingInstance(appID string, sharePath string) error {
 	sharePath = strings.TrimSpace(sharePath)
 	sharePath = strings.Trim(sharePath, "\"")
 
+	pipeName, pipeErr := instancePipeName(appID)
+
 	var lastErr error
 	deadline := time.Now().Add(2 * time.Second)
 	for time.Now().Before(deadline) {
+		if pipeErr == nil {
+			if conn, err := dialPipe(pipeName); err == nil {
+				_, _ = conn.Write([]byte(sharePath))
+				_ = conn.Close()
+				return nil
+			}
+		}
+
+		// The primary instance may be on the TCP fallback.
 		info, err := readInstanceInfo(appID)
 		if err != nil {
 			lastErr = err
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+
+	"LocalShare/pkg/shareserver"
+)
+
+// Launch intents reported by GetStartupState.
+const (
+	LaunchIntentOpen  = "open"
+	LaunchIntentShare = "share"
+)
+
+// maxPendingIPC bounds the share requests kept while the window loads; a
+// burst of right-clicks beyond it only shares the first ones.
+const maxPendingIPC = 8
+
+// launchState is what happened before the frontend could receive events.
+// The --share attempt runs in startup, before the frontend is mounted, so its
+// serverInfoChanged may be missed; GetStartupState hands the result over
+// instead. Guarded by App.launchMu.
+type launchState struct {
+	// shareDone is set once the --share attempt finished, with its outcome.
+	shareDone bool
+	shareInfo *shareserver.ServerInfo
+	shareErr  string
+	// ready is set by domReady: from then on events reach the frontend and
+	// dialogs have a window to belong to.
+	ready bool
+	// pendingIPC are share requests from other instances that arrived
+	// before ready, oldest first.
+	pendingIPC []string
+}
+
+// recordInitialShare keeps the outcome of the --share attempt for
+// GetStartupState.
+func (a *App) recordInitialShare(info *shareserver.ServerInfo, err error) {
+	a.launchMu.Lock()
+	defer a.launchMu.Unlock()
+	a.launch.shareDone = true
+	a.launch.shareInfo = info
+	a.launch.shareErr = ""
+	if err != nil {
+		a.launch.shareErr = err.Error()
+	}
+}
+
+// GetStartupState is called by the frontend once it is mounted, so a share
+// started by --share before that is shown without waiting for the next
+// change.
+func (a *App) GetStartupState() StartupState {
+	info, _ := a.shareServer.GetServerInfo()
+	sharePath := strings.TrimSpace(a.initialShare)
+
+	a.launchMu.Lock()
+	defer a.launchMu.Unlock()
+	state := StartupState{LaunchIntent: LaunchIntentOpen, ServerInfo: info}
+	if sharePath == "" {
+		return state
+	}
+	state.LaunchIntent = LaunchIntentShare
+	state.SharePath = sharePath
+	if !a.launch.shareDone {
+		state.SharePending = true
+		return state
+	}
+	state.ShareResult = &InitialShareResult{Info: a.launch.shareInfo, Error: a.launch.shareErr}
+	return state
+}
+
+// queueIPCShare keeps an IPC share request that arrived before the window
+// was ready; it reports false once requests can be handled right away.
+func (a *App) queueIPCShare(sharePath string) bool {
+	a.launchMu.Lock()
+	defer a.launchMu.Unlock()
+	if a.launch.ready {
+		return false
+	}
+	if len(a.launch.pendingIPC) >= maxPendingIPC {
+		appendLaunchLogf("ipc --share=%q dropped: too many requests while starting", sharePath)
+		return true
+	}
+	a.launch.pendingIPC = append(a.launch.pendingIPC, sharePath)
+	appendLaunchLogf("ipc --share=%q queued until the window is ready", sharePath)
+	return true
+}
+
+// launchReady marks the window ready and returns the queued IPC requests.
+func (a *App) launchReady() []string {
+	a.launchMu.Lock()
+	defer a.launchMu.Unlock()
+	a.launch.ready = true
+	pending := a.launch.pendingIPC
+	a.launch.pendingIPC = nil
+	return pending
+}
+
+// replayIPCShares handles the requests queued during startup, in order.
+func (a *App) replayIPCShares(pending []string) {
+	defer a.recoverCrash("ipc replay")
+	for _, sharePath := range pending {
+		a.handleIPCShare(sharePath)
+	}
+}
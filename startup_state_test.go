@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"LocalShare/pkg/shareserver"
+)
+
+func TestStartupStateAndIPCQueue(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir()) // the launch log
+	a := &App{
+		shareServer:  shareserver.New(shareserver.Options{Settings: shareserver.NewMemorySettings()}),
+		initialShare: " /photos ",
+	}
+
+	st := a.GetStartupState()
+	if st.LaunchIntent != LaunchIntentShare || st.SharePath != "/photos" || !st.SharePending || st.ShareResult != nil {
+		t.Fatalf("before the --share attempt: %+v", st)
+	}
+	a.recordInitialShare(nil, fmt.Errorf("boom"))
+	st = a.GetStartupState()
+	if st.SharePending || st.ShareResult == nil || st.ShareResult.Error != "boom" || st.ServerInfo != nil {
+		t.Fatalf("after a failed --share: %+v", st)
+	}
+	if st := (&App{shareServer: a.shareServer}).GetStartupState(); st.LaunchIntent != LaunchIntentOpen || st.SharePending {
+		t.Fatalf("normal open: %+v", st)
+	}
+
+	// Requests before domReady are kept in order, up to maxPendingIPC.
+	for i := 0; i < maxPendingIPC+2; i++ {
+		if !a.queueIPCShare(fmt.Sprintf("/dir%d", i)) {
+			t.Fatalf("request %d not queued before ready", i)
+		}
+	}
+	pending := a.launchReady()
+	if len(pending) != maxPendingIPC || pending[0] != "/dir0" || pending[maxPendingIPC-1] != fmt.Sprintf("/dir%d", maxPendingIPC-1) {
+		t.Fatalf("pending = %q", pending)
+	}
+	if a.queueIPCShare("/later") {
+		t.Fatalf("request queued after ready")
+	}
+	if again := a.launchReady(); len(again) != 0 {
+		t.Fatalf("queue not drained: %q", again)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// tempDir is where the app writes temporaries (update extraction,
+// diagnostics), see shareserver.SettingKeyTempDir. Resolve it per operation.
+func (a *App) tempDir() string {
+	if a.shareServer == nil {
+		return os.TempDir()
+	}
+	return a.shareServer.TempDir()
+}
+
+// validateTempDir checks a new SettingKeyTempDir value: "" (system temp dir)
+// or an existing, writable absolute directory.
+func validateTempDir(raw json.RawMessage) error {
+	var dir string
+	if err := json.Unmarshal(raw, &dir); err != nil {
+		return errors.New("临时目录必须是字符串")
+	}
+	dir = strings.TrimSpace(dir)
+	if dir == "" {
+		return nil
+	}
+	if !filepath.IsAbs(dir) {
+		return errors.New("临时目录必须是绝对路径")
+	}
+	st, err := os.Stat(dir)
+	if err != nil || !st.IsDir() {
+		return fmt.Errorf("临时目录不存在：%s", dir)
+	}
+	if err := canWriteDir(dir); err != nil {
+		return fmt.Errorf("临时目录不可写：%v", err)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateTempDir(t *testing.T) {
+	dir := t.TempDir()
+	ok := func(v string) json.RawMessage { b, _ := json.Marshal(v); return b }
+	for _, v := range []json.RawMessage{ok(""), ok(dir)} {
+		if err := validateTempDir(v); err != nil {
+			t.Fatalf("validateTempDir(%s) = %v", v, err)
+		}
+	}
+	file := filepath.Join(dir, "f")
+	os.WriteFile(file, nil, 0o644)
+	for _, v := range []json.RawMessage{json.RawMessage(`1`), ok("relative/dir"), ok(filepath.Join(dir, "missing")), ok(file)} {
+		if err := validateTempDir(v); err == nil {
+			t.Fatalf("validateTempDir(%s) should fail", v)
+		}
+	}
+}
@@ -1,17 +1,62 @@
 package main
 
-// ServerInfo matches the shape expected by the existing mobile web UI.
-type ServerInfo struct {
-	URL          string `json:"url"`
-	Port         int    `json:"port"`
-	LocalIP      string `json:"localIP"`
-	SharedFolder string `json:"sharedFolder"`
-}
+import "LocalShare/pkg/shareserver"
 
 type ContextMenuStatus struct {
 	Exists bool `json:"exists"`
 }
 
+// StartupState tells a freshly mounted frontend what happened before it
+// could receive events.
+type StartupState struct {
+	// LaunchIntent is "share" when started with --share (the context menu),
+	// else "open".
+	LaunchIntent string `json:"launchIntent"`
+	SharePath    string `json:"sharePath,omitempty"`
+	// SharePending is true while the --share attempt is still running.
+	SharePending bool                `json:"sharePending"`
+	ShareResult  *InitialShareResult `json:"shareResult,omitempty"`
+	// ServerInfo is the current share, null when not sharing.
+	ServerInfo *shareserver.ServerInfo `json:"serverInfo"`
+}
+
+// InitialShareResult is how the --share attempt at startup went.
+type InitialShareResult struct {
+	Info  *shareserver.ServerInfo `json:"info,omitempty"`
+	Error string                  `json:"error,omitempty"`
+}
+
+// LastShareInfo is the folder shared last time, for the "resume sharing" button.
+type LastShareInfo struct {
+	Root string `json:"root"`
+	// Active is true when the folder was still shared when the app quit.
+	Active bool `json:"active"`
+	// Exists is false when the folder has been moved or deleted since.
+	Exists bool `json:"exists"`
+}
+
+// FolderShareURL is a link that opens the web UI in one shared sub-folder.
+type FolderShareURL struct {
+	URL string `json:"url"`
+	// QRDataURI is a PNG data URI of URL.
+	QRDataURI string `json:"qrDataURI"`
+}
+
+// SettingsLocation is where this process keeps settings.json; also sent to
+// the UI as "settingsLocation" and included in diagnostics.
+type SettingsLocation struct {
+	Path     string `json:"path"`
+	Portable bool   `json:"portable"`
+	// Reason is "default", "flag" (--portable), "marker" (localshare.portable
+	// next to the exe) or "fallback" (the config dir wasn't writable).
+	Reason string `json:"reason"`
+	// Writable is false when no candidate directory could be written to:
+	// changes then only last until the app quits.
+	Writable bool `json:"writable"`
+	// Error is why the preferred directory couldn't be used.
+	Error string `json:"error,omitempty"`
+}
+
 // UpdateInfo is returned to the frontend for update UI.
 type UpdateInfo struct {
 	CurrentVersion string `json:"currentVersion"`
@@ -34,3 +79,16 @@ type DownloadResult struct {
 	ExtractedExePath string `json:"extractedExePath"`
 	BackupExePath    string `json:"backupExePath"`
 }
+
+// UpdateFailure describes an update that didn't take effect: after it the app
+// still (or again) runs a version other than the one it updated to.
+type UpdateFailure struct {
+	FromVersion    string `json:"fromVersion"`
+	ToVersion      string `json:"toVersion"`
+	CurrentVersion string `json:"currentVersion"`
+	Method         string `json:"method"`
+	LogPath        string `json:"logPath"`
+	LogTail        string `json:"logTail"`
+	BackupExePath  string `json:"backupExePath"`
+	CanRollback    bool   `json:"canRollback"`
+}
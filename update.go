@@ -143,7 +143,7 @@ func (a *App) DownloadLatestUpdate() (*DownloadResult, error) {
 		return nil, fmt.Errorf("SHA256 校验失败：期望 %s，实际 %s（文件：%s）", expected, actual, zipPath)
 	}
 
-	extractedExePath, err := extractInnerExe(zipPath, downloadsDir, rel.TagName)
+	extractedExePath, err := extractInnerExe(zipPath, a.tempDir(), rel.TagName)
 	if err != nil {
 		appendLaunchLogf("update extract err=%v", err)
 		return nil, err
@@ -204,23 +204,69 @@ func (a *App) ApplyDownloadedUpdate() error {
 	// Pre-check directory writable (so we can fail fast with a system dialog before quitting).
 	exeDir := filepath.Dir(oldExe)
 	if err := canWriteDir(exeDir); err != nil {
-		a.showSystemError("更新失败", fmt.Sprintf("无法写入程序目录：%s\n\n请把程序放到可写目录（如桌面/下载/自建文件夹）后再试。\n\n详细错误：%v", exeDir, err))
+		a.showSystemError(a.tr(msgUpdateFailedTitle), a.tr(msgUpdateDirNotWritable, exeDir, err))
 		return err
 	}
 
-	ps1Path, err := writeUpdateScript(pu.downloadsDir, pu.latestTag)
+	updateDir := filepath.Join(pu.downloadsDir, "LocalShare-Update", sanitizePathPart(pu.latestTag))
+	return a.launchUpdater(pu.downloadsDir, updateDir, pu.latestTag, pu.extractedExePath, pu.backupExePath, updateMethodFinish)
+}
+
+// launchUpdater starts the script (or, when PowerShell can't run it, the
+// fallback method) that replaces the running exe with newExe once this
+// process has exited, records the attempt and quits.
+func (a *App) launchUpdater(downloadsDir, updateDir, toVersion, newExe, backupExe, fallback string) error {
+	oldExe, err := os.Executable()
 	if err != nil {
-		a.showSystemError("更新失败", fmt.Sprintf("无法创建更新脚本：%v", err))
 		return err
 	}
+	if err := os.MkdirAll(updateDir, 0o755); err != nil {
+		a.showSystemError(a.tr(msgUpdateFailedTitle), a.tr(msgUpdateDirCreateFailed, err))
+		return err
+	}
+	logPath := filepath.Join(updateDir, "apply-update.log")
+
+	method := updateMethodPowerShell
+	if err := checkPowerShellUsable(); err != nil {
+		appendLaunchLogf("update powershell unusable, using %s: %v", fallback, err)
+		method = fallback
+	}
+	attempt := updateAttempt{
+		FromVersion: Version,
+		ToVersion:   toVersion,
+		Method:      method,
+		UpdateDir:   updateDir,
+		LogPath:     logPath,
+		BackupExe:   backupExe,
+		StartedAt:   time.Now(),
+	}
+	if err := saveUpdateAttempt(downloadsDir, attempt); err != nil {
+		appendLaunchLogf("update save attempt err=%v", err)
+	}
 
 	// Kick off the updater and quit.
-	if err := startWindowsUpdaterPowerShell(ps1Path, os.Getpid(), oldExe, pu.extractedExePath, pu.backupExePath); err != nil {
-		a.showSystemError("更新失败", fmt.Sprintf("无法启动更新进程：%v", err))
-		appendLaunchLogf("update apply start updater err=%v", err)
+	switch method {
+	case updateMethodPowerShell:
+		var ps1Path string
+		ps1Path, err = writeUpdateScript(downloadsDir, toVersion, a.lang())
+		if err != nil {
+			a.showSystemError(a.tr(msgUpdateFailedTitle), a.tr(msgUpdateScriptFailed, err))
+			clearUpdateAttempt(downloadsDir)
+			return err
+		}
+		err = startWindowsUpdaterPowerShell(ps1Path, os.Getpid(), oldExe, newExe, backupExe, logPath)
+	case updateMethodFinish:
+		err = startFinishUpdate(os.Getpid(), oldExe, newExe, backupExe, logPath)
+	default:
+		err = startUpdaterHelper(updateDir, os.Getpid(), oldExe, newExe, backupExe, logPath)
+	}
+	if err != nil {
+		clearUpdateAttempt(downloadsDir)
+		a.showSystemError(a.tr(msgUpdateFailedTitle), a.tr(msgUpdaterStartFailed, err))
+		appendLaunchLogf("update apply start updater method=%s err=%v", method, err)
 		return err
 	}
-	appendLaunchLogf("update apply updater started ps1=%q", ps1Path)
+	appendLaunchLogf("update apply updater started method=%s log=%q", method, logPath)
 
 	// Quit immediately. The updater waits for PID to exit.
 	if a.ctx != nil {
@@ -446,6 +492,11 @@ func getDownloadsDir() (string, error) {
 			return filepath.Join(home, "Downloads"), nil
 		}
 	}
+	if runtime.GOOS != "windows" && runtime.GOOS != "darwin" {
+		if p, err := getDownloadsDirXDG(); err == nil {
+			return p, nil
+		}
+	}
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return "", err
@@ -543,7 +594,8 @@ func sha256FileHex(path string) (string, error) {
 	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
-func extractInnerExe(zipPath, downloadsDir, latestTag string) (string, error) {
+// extractInnerExe unpacks the exe of the release zip under baseDir.
+func extractInnerExe(zipPath, baseDir, latestTag string) (string, error) {
 	zr, err := zip.OpenReader(zipPath)
 	if err != nil {
 		return "", err
@@ -583,7 +635,7 @@ func extractInnerExe(zipPath, downloadsDir, latestTag string) (string, error) {
 		return "", fmt.Errorf("zip 条目是目录：%s", target.Name)
 	}
 
-	updateDir := filepath.Join(downloadsDir, "LocalShare-Update", sanitizePathPart(latestTag))
+	updateDir := filepath.Join(baseDir, "LocalShare-Update", sanitizePathPart(latestTag))
 	if err := os.MkdirAll(updateDir, 0o755); err != nil {
 		return "", err
 	}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Ways ApplyDownloadedUpdate can replace the exe.
+const (
+	updateMethodPowerShell = "powershell"
+	updateMethodHelper     = "helper"
+	updateMethodFinish     = "finish-update"
+)
+
+// updateAttempt is written right before the updater starts, so the next
+// start can tell whether the update went through.
+type updateAttempt struct {
+	FromVersion string    `json:"fromVersion"`
+	ToVersion   string    `json:"toVersion"`
+	Method      string    `json:"method"`
+	UpdateDir   string    `json:"updateDir"`
+	LogPath     string    `json:"logPath"`
+	BackupExe   string    `json:"backupExe"`
+	StartedAt   time.Time `json:"startedAt"`
+}
+
+// updateLogTailBytes is how much of the updater log the failure dialog shows.
+const updateLogTailBytes = 4096
+
+func updateAttemptPath(downloadsDir string) string {
+	return filepath.Join(downloadsDir, "LocalShare-Update", "last-update.json")
+}
+
+func saveUpdateAttempt(downloadsDir string, at updateAttempt) error {
+	b, err := json.MarshalIndent(at, "", "  ")
+	if err != nil {
+		return err
+	}
+	p := updateAttemptPath(downloadsDir)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(p, b, 0o644)
+}
+
+func loadUpdateAttempt(downloadsDir string) (*updateAttempt, error) {
+	b, err := os.ReadFile(updateAttemptPath(downloadsDir))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var at updateAttempt
+	if err := json.Unmarshal(b, &at); err != nil {
+		return nil, err
+	}
+	return &at, nil
+}
+
+func clearUpdateAttempt(downloadsDir string) {
+	_ = os.Remove(updateAttemptPath(downloadsDir))
+}
+
+// sameVersion compares versions ignoring a leading "v".
+func sameVersion(a, b string) bool {
+	if va, ok := parseSemver3(a); ok {
+		if vb, ok := parseSemver3(b); ok {
+			return compareSemver3(va, vb) == 0
+		}
+	}
+	return strings.EqualFold(strings.TrimPrefix(strings.TrimSpace(a), "v"), strings.TrimPrefix(strings.TrimSpace(b), "v"))
+}
+
+// updateFailureFor checks the last attempt against the running version: nil
+// when there was none or it worked.
+func updateFailureFor(at *updateAttempt, current string) *UpdateFailure {
+	if at == nil || sameVersion(current, at.ToVersion) {
+		return nil
+	}
+	f := &UpdateFailure{
+		FromVersion:    at.FromVersion,
+		ToVersion:      at.ToVersion,
+		CurrentVersion: current,
+		Method:         at.Method,
+		LogPath:        at.LogPath,
+		LogTail:        readFileTail(at.LogPath, updateLogTailBytes),
+		BackupExePath:  at.BackupExe,
+	}
+	// The exe did change, just not into the target: the backup can bring
+	// back the version the update started from.
+	if at.BackupExe != "" && !sameVersion(current, at.FromVersion) {
+		if _, err := os.Stat(at.BackupExe); err == nil {
+			f.CanRollback = true
+		}
+	}
+	return f
+}
+
+func readFileTail(path string, n int64) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	if st, err := f.Stat(); err == nil && st.Size() > n {
+		_, _ = f.Seek(-n, io.SeekEnd)
+	}
+	b, _ := io.ReadAll(io.LimitReader(f, n))
+	return strings.ToValidUTF8(string(b), "")
+}
+
+// checkLastUpdate runs at startup: a finished update is forgotten, a failed
+// one is kept for GetUpdateFailure until the user dismisses it.
+func (a *App) checkLastUpdate() {
+	dir, err := getDownloadsDir()
+	if err != nil {
+		return
+	}
+	at, err := loadUpdateAttempt(dir)
+	if err != nil {
+		appendLaunchLogf("update attempt read err=%v", err)
+		clearUpdateAttempt(dir)
+		return
+	}
+	if at == nil {
+		return
+	}
+	if updateFailureFor(at, Version) == nil {
+		appendLaunchLogf("update ok from=%q to=%q method=%s", at.FromVersion, at.ToVersion, at.Method)
+		clearUpdateAttempt(dir)
+		return
+	}
+	appendLaunchLogf("update failed from=%q to=%q current=%q method=%s log=%q", at.FromVersion, at.ToVersion, Version, at.Method, at.LogPath)
+}
+
+// GetUpdateFailure returns the last update that didn't take effect, or nil.
+func (a *App) GetUpdateFailure() *UpdateFailure {
+	dir, err := getDownloadsDir()
+	if err != nil {
+		return nil
+	}
+	at, err := loadUpdateAttempt(dir)
+	if err != nil {
+		return nil
+	}
+	return updateFailureFor(at, Version)
+}
+
+// DismissUpdateFailure forgets a failed update (also done before a retry).
+func (a *App) DismissUpdateFailure() error {
+	dir, err := getDownloadsDir()
+	if err != nil {
+		return err
+	}
+	clearUpdateAttempt(dir)
+	return nil
+}
+
+// RollbackUpdate puts back the exe backed up by the failed update and
+// restarts into it, the same way an update is applied.
+func (a *App) RollbackUpdate() error {
+	dir, err := getDownloadsDir()
+	if err != nil {
+		return err
+	}
+	at, err := loadUpdateAttempt(dir)
+	if err != nil {
+		return err
+	}
+	f := updateFailureFor(at, Version)
+	if f == nil || !f.CanRollback {
+		return errors.New("没有可回滚的版本")
+	}
+	// The updater moves the new exe into place; keep the backup itself.
+	updateDir := at.UpdateDir
+	if updateDir == "" {
+		updateDir = filepath.Dir(at.BackupExe)
+	}
+	restore := filepath.Join(updateDir, "rollback-"+sanitizePathPart(at.FromVersion)+".exe")
+	if err := copyFile(at.BackupExe, restore); err != nil {
+		return fmt.Errorf("复制备份失败：%v", err)
+	}
+	// The backup may predate --finish-update: without PowerShell, let this
+	// exe do the swap instead.
+	return a.launchUpdater(dir, updateDir, at.FromVersion, restore, at.BackupExe, updateMethodHelper)
+}
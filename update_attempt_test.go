@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUpdateAttemptFailure(t *testing.T) {
+	dir := t.TempDir()
+	if at, err := loadUpdateAttempt(dir); at != nil || err != nil {
+		t.Fatalf("load without attempt = %v, %v", at, err)
+	}
+	updateDir := filepath.Join(dir, "LocalShare-Update", "v1.2.0")
+	os.MkdirAll(updateDir, 0o755)
+	logPath := filepath.Join(updateDir, "apply-update.log")
+	backup := filepath.Join(updateDir, "backup.exe")
+	os.WriteFile(logPath, []byte(strings.Repeat("x", updateLogTailBytes)+"failed: locked"), 0o644)
+	os.WriteFile(backup, []byte("old"), 0o755)
+
+	want := updateAttempt{FromVersion: "v1.1.0", ToVersion: "v1.2.0", Method: updateMethodHelper, UpdateDir: updateDir, LogPath: logPath, BackupExe: backup}
+	if err := saveUpdateAttempt(dir, want); err != nil {
+		t.Fatal(err)
+	}
+	at, err := loadUpdateAttempt(dir)
+	if err != nil || at == nil || *at != want {
+		t.Fatalf("load = %+v, %v", at, err)
+	}
+
+	if f := updateFailureFor(at, "1.2.0"); f != nil {
+		t.Fatalf("update to 1.2.0 worked, got failure %+v", f)
+	}
+	f := updateFailureFor(at, "v1.1.0")
+	if f == nil || f.CanRollback {
+		t.Fatalf("still on the old version: want failure without rollback, got %+v", f)
+	}
+	if len(f.LogTail) != updateLogTailBytes || !strings.HasSuffix(f.LogTail, "failed: locked") {
+		t.Fatalf("log tail = %d bytes %q...", len(f.LogTail), f.LogTail[:20])
+	}
+	if f := updateFailureFor(at, "v1.1.5"); f == nil || !f.CanRollback {
+		t.Fatalf("on a third version: want rollback, got %+v", f)
+	}
+
+	clearUpdateAttempt(dir)
+	if at, _ := loadUpdateAttempt(dir); at != nil {
+		t.Fatalf("attempt not cleared")
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// finishUpdateFlag is passed to the downloaded exe, copied next to the app as
+// updateExeName: it waits for the old process, puts itself in place of the
+// old exe and starts it. No PowerShell involved.
+const finishUpdateFlag = "--finish-update"
+
+// updateExeName is the copy of the new version that finishes the update.
+const updateExeName = "local-share-golang.update.exe"
+
+// finishUpdateOptions are the flags of `local-share-golang.update.exe --finish-update ...`.
+type finishUpdateOptions struct {
+	OldPID    int
+	OldExe    string
+	BackupExe string
+}
+
+func finishUpdateArgs(oldPID int, oldExe, backupExe string) []string {
+	return []string{
+		finishUpdateFlag,
+		"--old-pid=" + strconv.Itoa(oldPID),
+		"--old-exe=" + oldExe,
+		"--backup=" + backupExe,
+	}
+}
+
+// hasFinishUpdateFlag reports whether args ask to finish an update.
+func hasFinishUpdateFlag(args []string) bool {
+	return len(args) > 0 && args[0] == finishUpdateFlag
+}
+
+func parseFinishUpdateArgs(args []string) (finishUpdateOptions, error) {
+	var opts finishUpdateOptions
+	fs := flag.NewFlagSet("finish-update", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.IntVar(&opts.OldPID, "old-pid", 0, "")
+	fs.StringVar(&opts.OldExe, "old-exe", "", "")
+	fs.StringVar(&opts.BackupExe, "backup", "", "")
+	if len(args) > 0 && args[0] == finishUpdateFlag {
+		args = args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+	if opts.OldExe == "" {
+		return opts, errors.New("缺少 --old-exe")
+	}
+	return opts, nil
+}
+
+// finishUpdateMain is the entry point of the update copy. Its stdout/stderr
+// already go to the update log (see startFinishUpdate).
+func finishUpdateMain(args []string) int {
+	logf := func(format string, args ...any) {
+		fmt.Printf(time.Now().Format("2006-01-02T15:04:05")+" "+format+"\n", args...)
+	}
+	opts, err := parseFinishUpdateArgs(args)
+	if err != nil {
+		logf("failed: %v", err)
+		return 2
+	}
+	self, err := os.Executable()
+	if err != nil {
+		logf("failed: %v", err)
+		return 1
+	}
+	start := func(exe string) error { return exec.Command(exe).Start() }
+	if err := runFinishUpdate(opts, self, logf, start); err != nil {
+		logf("failed: %v", err)
+		lang := helperLanguage()
+		showUpdateErrorBox(tr(lang, msgUpdaterErrorTitle), updaterErrorMessage(lang, err, opts.OldExe, self, opts.BackupExe))
+		return 1
+	}
+	return 0
+}
+
+// finishUpdateRetries x finishUpdateRetryDelay is how long the swap waits for
+// the old exe to be released (antivirus, the loader).
+const (
+	finishUpdateRetries    = 40
+	finishUpdateRetryDelay = 250 * time.Millisecond
+)
+
+// runFinishUpdate waits for the old process, backs up the old exe once and
+// replaces it with newExe (the running update copy), then starts it. newExe
+// is copied beside the old exe first and renamed over it, so a failure never
+// leaves a half-written exe behind.
+func runFinishUpdate(opts finishUpdateOptions, newExe string, logf func(format string, args ...any), start func(exe string) error) error {
+	if opts.OldPID > 0 {
+		logf("waiting for process %d", opts.OldPID)
+		if err := waitProcessExit(opts.OldPID, time.Minute); err != nil {
+			return err
+		}
+	}
+	if _, err := os.Stat(opts.OldExe); err != nil {
+		return fmt.Errorf("原程序不存在：%s", opts.OldExe)
+	}
+	if opts.BackupExe != "" {
+		if _, err := os.Stat(opts.BackupExe); err != nil {
+			logf("backup %s -> %s", opts.OldExe, opts.BackupExe)
+			if err := copyFile(opts.OldExe, opts.BackupExe); err != nil {
+				logf("backup failed: %v", err)
+			}
+		}
+	}
+
+	tmp := opts.OldExe + ".new"
+	logf("copy %s -> %s", newExe, tmp)
+	if err := copyFile(newExe, tmp); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	logf("replace %s", opts.OldExe)
+	var err error
+	for i := 0; i < finishUpdateRetries; i++ {
+		if err = os.Rename(tmp, opts.OldExe); err == nil || !isSharingViolation(err) {
+			break
+		}
+		time.Sleep(finishUpdateRetryDelay)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	logf("start %s", opts.OldExe)
+	if err := start(opts.OldExe); err != nil {
+		return err
+	}
+	logf("done")
+	return nil
+}
+
+// removeStaleUpdateExe deletes the update copy left next to exe by a finished
+// update. The copy may still be exiting, so it retries for a few seconds.
+func removeStaleUpdateExe(exe string) {
+	p := filepath.Join(filepath.Dir(exe), updateExeName)
+	if filepath.Base(exe) == updateExeName {
+		return
+	}
+	for i := 0; i < 10; i++ {
+		err := os.Remove(p)
+		if err == nil || errors.Is(err, os.ErrNotExist) {
+			return
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
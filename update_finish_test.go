@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// updateTestMarkerEnv turns the test binary into the dummy executables of
+// TestFinishUpdateIntegration; its value is the file the restarted app writes.
+const updateTestMarkerEnv = "LOCALSHARE_UPDATE_TEST_MARKER"
+
+func TestMain(m *testing.M) {
+	if marker := os.Getenv(updateTestMarkerEnv); marker != "" {
+		switch {
+		case hasFinishUpdateFlag(os.Args[1:]):
+			os.Exit(finishUpdateMain(os.Args[1:]))
+		case len(os.Args) > 1 && os.Args[1] == "--sleep":
+			// The "old app" the update waits for.
+			time.Sleep(500 * time.Millisecond)
+			os.Exit(0)
+		default:
+			// The restarted app.
+			exe, _ := os.Executable()
+			_ = os.WriteFile(marker, []byte(exe), 0o644)
+			os.Exit(0)
+		}
+	}
+	os.Exit(m.Run())
+}
+
+func TestFinishUpdateIntegration(t *testing.T) {
+	opts, err := parseFinishUpdateArgs(finishUpdateArgs(7, `C:\a b\LocalShare.exe`, `C:\dl\backup.exe`))
+	if err != nil || opts != (finishUpdateOptions{OldPID: 7, OldExe: `C:\a b\LocalShare.exe`, BackupExe: `C:\dl\backup.exe`}) {
+		t.Fatalf("parse = %+v, %v", opts, err)
+	}
+	if _, err := parseFinishUpdateArgs([]string{finishUpdateFlag, "--old-pid=7"}); err == nil {
+		t.Fatalf("missing --old-exe must fail")
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin, err := os.ReadFile(self)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Old and new version: the test binary with a different trailer.
+	dir := t.TempDir()
+	oldExe := filepath.Join(dir, "LocalShare.exe")
+	updateExe := filepath.Join(dir, updateExeName)
+	backup := filepath.Join(dir, "LocalShare.backup.exe")
+	marker := filepath.Join(dir, "started.txt")
+	if err := os.WriteFile(oldExe, append(bin[:len(bin):len(bin)], "OLD"...), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(updateExe, append(bin[:len(bin):len(bin)], "NEW"...), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	env := append(os.Environ(), updateTestMarkerEnv+"="+marker)
+
+	app := exec.Command(oldExe, "--sleep")
+	app.Env = env
+	if err := app.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// Reap it, or the update would wait for a zombie.
+	go app.Wait()
+
+	update := exec.Command(updateExe, finishUpdateArgs(app.Process.Pid, oldExe, backup)...)
+	update.Env = env
+	out, err := update.CombinedOutput()
+	if err != nil {
+		t.Fatalf("finish update: %v\n%s", err, out)
+	}
+	if !strings.Contains(string(out), "waiting for process") || !strings.Contains(string(out), "done") {
+		t.Fatalf("update log missing steps:\n%s", out)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	var started []byte
+	for time.Now().Before(deadline) {
+		if started, err = os.ReadFile(marker); err == nil {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("updated app was not started: %v", err)
+	}
+	if string(started) != oldExe {
+		t.Fatalf("started %q, want %q", started, oldExe)
+	}
+	if b, _ := os.ReadFile(oldExe); !bytes.HasSuffix(b, []byte("NEW")) {
+		t.Fatalf("old exe was not replaced")
+	}
+	if b, _ := os.ReadFile(backup); !bytes.HasSuffix(b, []byte("OLD")) {
+		t.Fatalf("backup is not the old exe")
+	}
+	if _, err := os.Stat(oldExe + ".new"); !os.IsNotExist(err) {
+		t.Fatalf("temp copy left behind, stat err=%v", err)
+	}
+
+	removeStaleUpdateExe(oldExe)
+	if _, err := os.Stat(updateExe); !os.IsNotExist(err) {
+		t.Fatalf("update exe not cleaned up, stat err=%v", err)
+	}
+
+	// A missing target fails without starting anything.
+	err = runFinishUpdate(finishUpdateOptions{OldExe: filepath.Join(dir, "gone.exe")}, updateExe, func(string, ...any) {},
+		func(string) error { t.Fatalf("must not start"); return nil })
+	if err == nil {
+		t.Fatalf("missing old exe must fail")
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// applyUpdateFlag runs the exe as the updater helper: the Go version of
+// apply-update.ps1, used when PowerShell can't run scripts.
+const applyUpdateFlag = "--apply-update"
+
+// applyUpdateOptions are the flags of `LocalShare-updater.exe --apply-update ...`.
+type applyUpdateOptions struct {
+	PID       int
+	OldExe    string
+	NewExe    string
+	BackupExe string
+}
+
+func applyUpdateArgs(pid int, oldExe, newExe, backupExe string) []string {
+	return []string{
+		applyUpdateFlag,
+		"--pid=" + strconv.Itoa(pid),
+		"--old=" + oldExe,
+		"--new=" + newExe,
+		"--backup=" + backupExe,
+	}
+}
+
+// hasApplyUpdateFlag reports whether args ask for updater helper mode.
+func hasApplyUpdateFlag(args []string) bool {
+	return len(args) > 0 && args[0] == applyUpdateFlag
+}
+
+func parseApplyUpdateArgs(args []string) (applyUpdateOptions, error) {
+	var opts applyUpdateOptions
+	fs := flag.NewFlagSet("apply-update", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.IntVar(&opts.PID, "pid", 0, "")
+	fs.StringVar(&opts.OldExe, "old", "", "")
+	fs.StringVar(&opts.NewExe, "new", "", "")
+	fs.StringVar(&opts.BackupExe, "backup", "", "")
+	if len(args) > 0 && args[0] == applyUpdateFlag {
+		args = args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+	if opts.OldExe == "" || opts.NewExe == "" {
+		return opts, errors.New("缺少 --old 或 --new")
+	}
+	return opts, nil
+}
+
+// applyUpdateMain is the helper's entry point. Its stdout/stderr already go
+// to the update log (see startHiddenWithLog).
+func applyUpdateMain(args []string) int {
+	logf := func(format string, args ...any) {
+		fmt.Printf(time.Now().Format("2006-01-02T15:04:05")+" "+format+"\n", args...)
+	}
+	opts, err := parseApplyUpdateArgs(args)
+	if err != nil {
+		logf("failed: %v", err)
+		return 2
+	}
+	start := func(exe string) error { return exec.Command(exe).Start() }
+	if err := runApplyUpdate(opts, logf, start); err != nil {
+		logf("failed: %v", err)
+		lang := helperLanguage()
+		showUpdateErrorBox(tr(lang, msgUpdaterErrorTitle), updaterErrorMessage(lang, err, opts.OldExe, opts.NewExe, opts.BackupExe))
+		return 1
+	}
+	return 0
+}
+
+// runApplyUpdate does what apply-update.ps1 does: wait for the app to exit,
+// back up the old exe once, move the new one over it and start it.
+func runApplyUpdate(opts applyUpdateOptions, logf func(format string, args ...any), start func(exe string) error) error {
+	if opts.PID > 0 {
+		logf("waiting for process %d", opts.PID)
+		if err := waitProcessExit(opts.PID, time.Minute); err != nil {
+			return err
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+	if _, err := os.Stat(opts.NewExe); err != nil {
+		return fmt.Errorf("更新文件不存在：%s", opts.NewExe)
+	}
+	if _, err := os.Stat(opts.OldExe); err != nil {
+		return fmt.Errorf("原程序不存在：%s", opts.OldExe)
+	}
+	if opts.BackupExe != "" {
+		if _, err := os.Stat(opts.BackupExe); err != nil {
+			logf("backup %s -> %s", opts.OldExe, opts.BackupExe)
+			if err := copyFile(opts.OldExe, opts.BackupExe); err != nil {
+				logf("backup failed: %v", err)
+			}
+		}
+	}
+
+	logf("replace %s <- %s", opts.OldExe, opts.NewExe)
+	// The old exe can stay locked for a moment after its process exits
+	// (antivirus, the loader).
+	var err error
+	for i := 0; i < 20; i++ {
+		if err = moveFile(opts.NewExe, opts.OldExe); err == nil {
+			break
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+	if err != nil {
+		return err
+	}
+	logf("start %s", opts.OldExe)
+	if err := start(opts.OldExe); err != nil {
+		return err
+	}
+	logf("done")
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// moveFile renames src over dst, copying when they are on different volumes.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	} else if !isCrossDeviceError(err) {
+		return err
+	}
+	if err := copyFile(src, dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
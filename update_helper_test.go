@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyUpdateHelper(t *testing.T) {
+	if hasApplyUpdateFlag([]string{"--headless", applyUpdateFlag}) {
+		t.Fatalf("%s must come first", applyUpdateFlag)
+	}
+	args := applyUpdateArgs(42, `C:\a b\LocalShare.exe`, `C:\dl\new.exe`, `C:\dl\backup.exe`)
+	if !hasApplyUpdateFlag(args) {
+		t.Fatalf("applyUpdateArgs not detected: %v", args)
+	}
+	opts, err := parseApplyUpdateArgs(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := applyUpdateOptions{PID: 42, OldExe: `C:\a b\LocalShare.exe`, NewExe: `C:\dl\new.exe`, BackupExe: `C:\dl\backup.exe`}
+	if opts != want {
+		t.Fatalf("parse = %+v, want %+v", opts, want)
+	}
+	if _, err := parseApplyUpdateArgs([]string{applyUpdateFlag, "--pid=1"}); err == nil {
+		t.Fatalf("missing --old/--new must fail")
+	}
+
+	dir := t.TempDir()
+	oldExe := filepath.Join(dir, "LocalShare.exe")
+	newExe := filepath.Join(dir, "new.exe")
+	backup := filepath.Join(dir, "backup.exe")
+	os.WriteFile(oldExe, []byte("old"), 0o755)
+	os.WriteFile(newExe, []byte("new"), 0o755)
+	var started string
+	err = runApplyUpdate(applyUpdateOptions{OldExe: oldExe, NewExe: newExe, BackupExe: backup},
+		func(string, ...any) {},
+		func(exe string) error { started = exe; return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(oldExe); string(b) != "new" {
+		t.Fatalf("exe = %q, want new", b)
+	}
+	if b, _ := os.ReadFile(backup); string(b) != "old" {
+		t.Fatalf("backup = %q, want old", b)
+	}
+	if _, err := os.Stat(newExe); !os.IsNotExist(err) {
+		t.Fatalf("new exe should have been moved, stat err=%v", err)
+	}
+	if started != oldExe {
+		t.Fatalf("started %q, want %q", started, oldExe)
+	}
+
+	// A second run keeps the first backup and fails without a new exe.
+	if err := runApplyUpdate(applyUpdateOptions{OldExe: oldExe, NewExe: newExe, BackupExe: backup},
+		func(string, ...any) {}, func(string) error { return nil }); err == nil {
+		t.Fatalf("missing new exe must fail")
+	}
+	if b, _ := os.ReadFile(backup); string(b) != "old" {
+		t.Fatalf("backup overwritten: %q", b)
+	}
+}
@@ -2,17 +2,62 @@
 
 package main
 
-import "errors"
+import (
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
 
 func (a *App) showSystemError(title, message string) {
 	_ = title
 	_ = message
 }
 
-func startWindowsUpdaterPowerShell(ps1Path string, pid int, oldExePath, newExePath, backupExePath string) error {
+func checkPowerShellUsable() error {
 	return errors.New("当前仅支持 Windows 自动更新")
 }
 
-func writeUpdateScript(downloadsDir, latestTag string) (string, error) {
+func startWindowsUpdaterPowerShell(ps1Path string, pid int, oldExePath, newExePath, backupExePath, logPath string) error {
+	return errors.New("当前仅支持 Windows 自动更新")
+}
+
+func startUpdaterHelper(updateDir string, pid int, oldExePath, newExePath, backupExePath, logPath string) error {
+	return errors.New("当前仅支持 Windows 自动更新")
+}
+
+func startFinishUpdate(pid int, oldExePath, newExePath, backupExePath, logPath string) error {
+	return errors.New("当前仅支持 Windows 自动更新")
+}
+
+func writeUpdateScript(downloadsDir, latestTag, lang string) (string, error) {
 	return "", errors.New("当前仅支持 Windows 自动更新")
 }
+
+// waitProcessExit polls until pid is gone or timeout passes.
+func waitProcessExit(pid int, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		p, err := os.FindProcess(pid)
+		if err != nil || p.Signal(syscall.Signal(0)) != nil {
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return errors.New("进程未退出")
+}
+
+func isCrossDeviceError(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
+
+// isSharingViolation reports errors worth retrying while the old exe is
+// still held by its exiting process.
+func isSharingViolation(err error) bool {
+	return errors.Is(err, syscall.ETXTBSY) || errors.Is(err, syscall.EBUSY)
+}
+
+func showUpdateErrorBox(title, message string) {
+	_ = title
+	_ = message
+}
@@ -4,13 +4,19 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"golang.org/x/sys/windows"
 )
 
 func (a *App) showSystemError(title, message string) {
@@ -24,9 +30,49 @@ func (a *App) showSystemError(title, message string) {
 	})
 }
 
-func startWindowsUpdaterPowerShell(ps1Path string, pid int, oldExePath, newExePath, backupExePath string) error {
+// hiddenConsoleAttr keeps console programs (powershell.exe, the helper) from
+// flashing a window.
+func hiddenConsoleAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{HideWindow: true, CreationFlags: windows.CREATE_NO_WINDOW}
+}
+
+// checkPowerShellUsable fails when the update script can't run: Constrained
+// Language Mode (AppLocker/WDAC) or an execution policy enforced by group
+// policy, which -ExecutionPolicy Bypass can't override.
+func checkPowerShellUsable() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "powershell.exe",
+		"-NoProfile", "-NonInteractive",
+		"-ExecutionPolicy", "Bypass",
+		"-Command", "$ExecutionContext.SessionState.LanguageMode; Get-ExecutionPolicy",
+	)
+	cmd.SysProcAttr = hiddenConsoleAttr()
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("powershell probe: %w", err)
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) < 2 {
+		return fmt.Errorf("powershell probe: unexpected output %q", out)
+	}
+	if fields[0] != "FullLanguage" {
+		return fmt.Errorf("powershell language mode %s", fields[0])
+	}
+	switch fields[1] {
+	case "Bypass", "Unrestricted":
+		return nil
+	}
+	return fmt.Errorf("powershell execution policy %s", fields[1])
+}
+
+// startWindowsUpdaterPowerShell runs the update script hidden, its output
+// going to logPath.
+func startWindowsUpdaterPowerShell(ps1Path string, pid int, oldExePath, newExePath, backupExePath, logPath string) error {
 	args := []string{
 		"-NoProfile",
+		"-NonInteractive",
+		"-WindowStyle", "Hidden",
 		"-ExecutionPolicy", "Bypass",
 		"-File", ps1Path,
 		"-ProcId", strconv.Itoa(pid),
@@ -34,13 +80,82 @@ func startWindowsUpdaterPowerShell(ps1Path string, pid int, oldExePath, newExePa
 		"-NewExe", newExePath,
 		"-BackupExe", backupExePath,
 	}
-	cmd := exec.Command("powershell.exe", args...)
-	cmd.Stdout = nil
-	cmd.Stderr = nil
+	return startHiddenWithLog(exec.Command("powershell.exe", args...), logPath)
+}
+
+// startUpdaterHelper runs a copy of this exe in --apply-update mode, for
+// machines where PowerShell can't run the script. The copy lives in the
+// update folder so the exe being replaced isn't running.
+func startUpdaterHelper(updateDir string, pid int, oldExePath, newExePath, backupExePath, logPath string) error {
+	helper := filepath.Join(updateDir, "LocalShare-updater.exe")
+	if err := copyFile(oldExePath, helper); err != nil {
+		return err
+	}
+	return startHiddenWithLog(exec.Command(helper, applyUpdateArgs(pid, oldExePath, newExePath, backupExePath)...), logPath)
+}
+
+// startFinishUpdate copies the new exe next to the old one as updateExeName
+// and runs it with --finish-update, for machines where PowerShell is
+// disabled. The copy is in the app folder, which ApplyDownloadedUpdate has
+// already checked is writable.
+func startFinishUpdate(pid int, oldExePath, newExePath, backupExePath, logPath string) error {
+	updateExe := filepath.Join(filepath.Dir(oldExePath), updateExeName)
+	if err := copyFile(newExePath, updateExe); err != nil {
+		return err
+	}
+	return startHiddenWithLog(exec.Command(updateExe, finishUpdateArgs(pid, oldExePath, backupExePath)...), logPath)
+}
+
+func startHiddenWithLog(cmd *exec.Cmd, logPath string) error {
+	f, err := os.OpenFile(logPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	// The child keeps its own handle.
+	defer f.Close()
+	cmd.Stdout = f
+	cmd.Stderr = f
+	cmd.SysProcAttr = hiddenConsoleAttr()
 	return cmd.Start()
 }
 
-func writeUpdateScript(downloadsDir, latestTag string) (string, error) {
+// waitProcessExit waits up to timeout for pid to exit.
+func waitProcessExit(pid int, timeout time.Duration) error {
+	h, err := windows.OpenProcess(windows.SYNCHRONIZE, false, uint32(pid))
+	if err != nil {
+		// Already gone (or never ours to wait for).
+		return nil
+	}
+	defer windows.CloseHandle(h)
+	ev, err := windows.WaitForSingleObject(h, uint32(timeout/time.Millisecond))
+	if err != nil {
+		return err
+	}
+	if ev == uint32(windows.WAIT_TIMEOUT) {
+		return fmt.Errorf("进程 %d 未退出", pid)
+	}
+	return nil
+}
+
+func isCrossDeviceError(err error) bool {
+	return errors.Is(err, windows.ERROR_NOT_SAME_DEVICE)
+}
+
+// isSharingViolation reports errors worth retrying while the old exe is
+// still held by its exiting process (or scanned by antivirus).
+func isSharingViolation(err error) bool {
+	return errors.Is(err, windows.ERROR_SHARING_VIOLATION) ||
+		errors.Is(err, windows.ERROR_LOCK_VIOLATION) ||
+		errors.Is(err, windows.ERROR_ACCESS_DENIED)
+}
+
+func showUpdateErrorBox(title, message string) {
+	t, _ := windows.UTF16PtrFromString(title)
+	m, _ := windows.UTF16PtrFromString(message)
+	_, _ = windows.MessageBox(0, m, t, windows.MB_OK|windows.MB_ICONERROR)
+}
+
+func writeUpdateScript(downloadsDir, latestTag, lang string) (string, error) {
 	updateDir := filepath.Join(downloadsDir, "LocalShare-Update", sanitizePathPart(latestTag))
 	if err := os.MkdirAll(updateDir, 0o755); err != nil {
 		return "", err
@@ -48,8 +163,10 @@ func writeUpdateScript(downloadsDir, latestTag string) (string, error) {
 	ps1Path := filepath.Join(updateDir, "apply-update.ps1")
 
 	// A self-contained script: waits for process exit, backs up current exe (if backup not exists), replaces, restarts.
-	// On any failure it shows a system message box.
+	// On any failure it shows a system message box. Steps go to stdout (redirected to
+	// apply-update.log by the launcher) and to a transcript next to the script.
 	// NOTE: Use $ProcId (avoid conflict with PowerShell automatic variable $PID).
+	// {{...}} are user-facing texts, filled in by updateScriptTexts.
 	script := strings.TrimSpace(`
 param(
   [Parameter(Mandatory=$true)][int]$ProcId,
@@ -60,6 +177,12 @@ param(
 
 $ErrorActionPreference = 'Stop'
 
+try { Start-Transcript -LiteralPath (Join-Path $PSScriptRoot 'apply-update.transcript.log') -Force | Out-Null } catch {}
+
+function Write-Step([string]$Message) {
+  Write-Output ((Get-Date).ToString('s') + ' ' + $Message)
+}
+
 function Show-Error([string]$Title, [string]$Message) {
   try {
 		Add-Type -AssemblyName System.Windows.Forms -ErrorAction SilentlyContinue | Out-Null
@@ -70,25 +193,35 @@ function Show-Error([string]$Title, [string]$Message) {
 }
 
 try {
-	if (-not $ProcId) { throw 'ProcId 为空' }
+	if (-not $ProcId) { throw '{{procIdEmpty}}' }
+  Write-Step ('waiting for process ' + $ProcId)
   Wait-Process -Id $ProcId -ErrorAction SilentlyContinue
   Start-Sleep -Milliseconds 250
 
-  if (-not (Test-Path -LiteralPath $NewExe)) { throw ('更新文件不存在：' + $NewExe) }
-  if (-not (Test-Path -LiteralPath $OldExe)) { throw ('原程序不存在：' + $OldExe) }
+  if (-not (Test-Path -LiteralPath $NewExe)) { throw ('{{newExeMissing}}' + $NewExe) }
+  if (-not (Test-Path -LiteralPath $OldExe)) { throw ('{{oldExeMissing}}' + $OldExe) }
 
   if (-not (Test-Path -LiteralPath $BackupExe)) {
-    try { Copy-Item -LiteralPath $OldExe -Destination $BackupExe -Force } catch {}
+    Write-Step ('backup ' + $OldExe + ' -> ' + $BackupExe)
+    try { Copy-Item -LiteralPath $OldExe -Destination $BackupExe -Force } catch { Write-Step ('backup failed: ' + $_.Exception.Message) }
   }
 
+  Write-Step ('replace ' + $OldExe + ' <- ' + $NewExe)
   Move-Item -LiteralPath $NewExe -Destination $OldExe -Force
+  Write-Step ('start ' + $OldExe)
   Start-Process -FilePath $OldExe
+  Write-Step 'done'
 } catch {
 	$nl = [Environment]::NewLine
-	$msg = "更新失败：" + $_.Exception.Message + $nl + $nl + "原程序：" + $OldExe + $nl + "新版本：" + $NewExe + $nl + "备份：" + $BackupExe
-  Show-Error 'LocalShare 更新失败' $msg
+	$msg = '{{failed}}' + $_.Exception.Message + $nl + $nl + '{{oldExe}}' + $OldExe + $nl + '{{newExe}}' + $NewExe + $nl + '{{backup}}' + $BackupExe
+  Write-Step ('failed: ' + $_.Exception.Message)
+  Show-Error '{{errorTitle}}' $msg
+  try { Stop-Transcript | Out-Null } catch {}
+  exit 1
 }
+try { Stop-Transcript | Out-Null } catch {}
 `) + "\r\n"
+	script = updateScriptTexts(lang).Replace(script)
 
 	// PowerShell 5.1 may treat script files without BOM as ANSI.
 	// UTF-8 with BOM is the most reliable choice across locales.
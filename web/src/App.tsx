@@ -2,20 +2,30 @@ import { useMemo, useState } from "react";
 import { Alert, Button, Paper } from "@mui/material";
 import toast from "react-hot-toast";
 import useSWR from "swr";
-import { download } from "./utils/fileUtils";
+import { download, formatFileSize } from "./utils/fileUtils";
 import { buildCrumbs } from "./utils/path";
 import {
+  createArchiveJob,
   deletePaths,
   downloadZipWithIgnore,
+  estimateDownload,
+  fetchArchiveJob,
+  fetchManifestText,
   fetchPathInfo,
+  fetchResumableDownloadUrl,
   uploadFilesWithProgress,
+  type ZipSelection,
 } from "./utils/api";
+import { ApiError } from "./utils/http";
+import type { DeleteResponse } from "./types";
 import { toError } from "common/error/utils";
 import { BreadcrumbNav } from "./components/BreadcrumbNav";
 import { DirectoryList } from "./components/DirectoryList";
 import { ImageFilePage } from "./components/ImageFilePage";
+import { PdfFilePage } from "./components/PdfFilePage";
 import { PreviewDialog } from "./components/PreviewDialog";
 import { SelectionBar } from "./components/SelectionBar";
+import { ShareExpiryNotice } from "./components/ShareExpiryNotice";
 import { TextFilePage } from "./components/TextFilePage";
 import { UploadPanel } from "./components/UploadPanel";
 import { UnsupportedFilePage } from "./components/UnsupportedFilePage";
@@ -27,12 +37,14 @@ import {
   type DownloadZipSettingsValue,
 } from "./components/DownloadZipSettingsDialog";
 import { useSelection } from "./hooks/useSelection";
+import { useSession } from "./hooks/useSession";
 import { useSseDirsRefresh } from "./hooks/useSseDirsRefresh";
 import { useSyncedPath } from "./hooks/useSyncedPath";
 import { useRemoteSetting } from "common/storage";
 import NiceModal from "@ebay/nice-modal-react";
 import { cat } from "common/error/catch-and-toast";
 import { ensureShareToken, withTokenQuery } from "./utils/auth";
+import { copyText } from "./utils/copy";
 
 function buildFilePath(currentPath: string, fileName: string) {
   return currentPath ? `${currentPath}/${fileName}` : fileName;
@@ -63,6 +75,11 @@ export default function App() {
       defaultDownloadSettings,
     );
 
+  // 旧版服务端没有 /api/session，拿不到时按原样显示所有操作
+  const { data: session } = useSession();
+  const canWrite = session?.permissions.write ?? true;
+  const canDelete = session?.permissions.delete ?? true;
+
   const {
     data: pathInfo,
     error: pathError,
@@ -120,10 +137,7 @@ export default function App() {
 
   function downloadPath(filePath: string, fileName: string) {
     void (async () => {
-      await ensureShareToken();
-      const downloadUrl = withTokenQuery(
-        `/api/download?path=${encodeURIComponent(filePath)}`,
-      );
+      const downloadUrl = await fetchResumableDownloadUrl({ path: filePath });
       download(downloadUrl, fileName);
     })();
   }
@@ -133,6 +147,28 @@ export default function App() {
     downloadPath(filePath, fileName);
   }
 
+  function downloadAll() {
+    void (async () => {
+      await ensureShareToken();
+      const downloadUrl = withTokenQuery(
+        `/api/download-all?path=${encodeURIComponent(currentPath)}`,
+      );
+      const name = currentPath.split("/").filter(Boolean).pop() || "shared";
+      download(downloadUrl, `${name}.zip`);
+    })();
+  }
+
+  const copyDownloadLinks = cat(async function copyDownloadLinks() {
+    const text = await fetchManifestText(currentPath);
+    const count = text.split("\n").filter(Boolean).length;
+    if (count === 0) {
+      toast("此文件夹中没有可下载的文件");
+      return;
+    }
+    await copyText(text);
+    toast.success(`已复制 ${count} 个下载链接（1 小时内有效）`);
+  });
+
   async function downloadSelected() {
     const paths = Array.from(selected);
     if (paths.length === 0) return;
@@ -148,18 +184,41 @@ export default function App() {
       const relPath = paths[0];
       const fileName =
         (relPath || "").split("/").filter(Boolean).pop() || "download";
-      await ensureShareToken();
-      const downloadUrl = withTokenQuery(
-        `/api/download?path=${encodeURIComponent(relPath)}`,
-      );
+      const downloadUrl = await fetchResumableDownloadUrl({ path: relPath });
       download(downloadUrl, fileName);
       return;
     }
 
+    const selection = {
+      paths,
+      ignore: buildIgnoreList(downloadSettings),
+      useIgnoreFiles: !!downloadSettings.useIgnoreFiles,
+      compression: downloadSettings.storeOnly ? "store" : undefined,
+    } satisfies ZipSelection;
+    const estimate = await estimateDownload(selection).catch(() => null);
+    if (estimate) {
+      const excluded = estimate.defaultIgnore?.length
+        ? `（主机已默认排除 ${estimate.defaultIgnore.join("、")}）`
+        : "";
+      const summary = `${formatFileSize(estimate.totalBytes)}，共 ${estimate.fileCount.toLocaleString()} 个文件${excluded}`;
+      if (estimate.limitExceeded) {
+        if (
+          window.confirm(
+            `所选内容过多（${summary}），无法直接打包。是否在服务端准备压缩包后再下载（支持断点续传）？`,
+          )
+        ) {
+          await downloadViaArchiveJob(selection);
+        }
+        return;
+      }
+      if (!window.confirm(`即将下载 ${summary}，是否继续？`)) {
+        return;
+      }
+    }
+
     const t = toast.loading("打包中...");
     try {
-      const ignore = buildIgnoreList(downloadSettings);
-      const { blob, fileName } = await downloadZipWithIgnore({ paths, ignore });
+      const { blob, fileName } = await downloadZipWithIgnore(selection);
       const url = URL.createObjectURL(blob);
       download(url, fileName);
       window.setTimeout(() => URL.revokeObjectURL(url), 5000);
@@ -172,6 +231,32 @@ export default function App() {
     }
   }
 
+  async function downloadViaArchiveJob(selection: ZipSelection) {
+    const t = toast.loading("服务端打包中...");
+    try {
+      let job = await createArchiveJob(selection);
+      while (job.state === "running") {
+        const pct = job.totalBytes
+          ? Math.floor((job.doneBytes / job.totalBytes) * 100)
+          : 0;
+        toast.loading(`服务端打包中... ${pct}%`, { id: t });
+        await new Promise((r) => window.setTimeout(r, 1000));
+        job = await fetchArchiveJob(job.id);
+      }
+      if (job.state !== "ready") {
+        toast.error(job.error || "打包失败");
+        return;
+      }
+      download(await fetchResumableDownloadUrl({ job: job.id }), job.name);
+      toast.success("开始下载");
+    } catch (e) {
+      const msg = e instanceof Error ? e.message : "打包失败";
+      toast.error(msg);
+    } finally {
+      toast.dismiss(t);
+    }
+  }
+
   async function deleteSelected() {
     const paths = Array.from(selected);
     if (paths.length === 0) return;
@@ -185,7 +270,20 @@ export default function App() {
 
     const t = toast.loading("删除中...");
     try {
-      const payload = await deletePaths(paths);
+      let payload: DeleteResponse;
+      try {
+        payload = await deletePaths(paths);
+      } catch (e) {
+        if (
+          !(e instanceof ApiError) ||
+          e.code !== "DELETE_TOO_LARGE_FOR_TRASH" ||
+          !e.payload?.allowPermanent ||
+          !window.confirm(`${e.message}。\n\n是否永久删除？此操作无法撤销。`)
+        ) {
+          throw e;
+        }
+        payload = await deletePaths(paths, true);
+      }
       const deleted = payload.deleted ?? 0;
       const requested = payload.requested ?? paths.length;
       const errCount = payload.errors ? Object.keys(payload.errors).length : 0;
@@ -295,6 +393,18 @@ export default function App() {
       );
     }
 
+    if (currentFile.preview?.supported && currentFile.preview.kind === "pdf") {
+      return (
+        <PdfFilePage
+          rootName={rootName}
+          currentPath={currentPath}
+          item={currentFile}
+          onNavigate={setPath}
+          onDownload={downloadCurrentFile}
+        />
+      );
+    }
+
     if (currentFile.preview?.supported && currentFile.preview.kind === "text") {
       return (
         <TextFilePage
@@ -326,14 +436,17 @@ export default function App() {
         selectedTotal={selected.size}
         onSelectAll={onSelectAll}
         onDownloadSelected={() => void downloadSelected()}
+        onDownloadAll={currentPath ? downloadAll : undefined}
+        onCopyDownloadLinks={() => void copyDownloadLinks()}
         onOpenChat={cat(async () => NiceModal.show(ChatBox))}
         onOpenDownloadSettings={cat(async () =>
           NiceModal.show(DownloadZipSettingsDialog, {
             value: downloadSettings,
+            path: currentPath,
             onSave: (v) => setDownloadSettings(v),
           }),
         )}
-        onDeleteSelected={() => void deleteSelected()}
+        onDeleteSelected={canDelete ? () => void deleteSelected() : undefined}
         onClearSelection={clearSelection}
       />
 
@@ -346,6 +459,12 @@ export default function App() {
         }}
       >
         <BreadcrumbNav crumbs={crumbs} onNavigate={setPath} />
+        <ShareExpiryNotice expiresIn={session?.shareExpiresIn} />
+        {isDirectory && pathInfo?.truncated && (
+          <Alert severity="warning" sx={{ borderRadius: 0 }}>
+            此文件夹条目过多，仅显示其中 {items.length} 项
+          </Alert>
+        )}
         <DirectoryList
           currentPath={currentPath}
           items={items}
@@ -361,12 +480,14 @@ export default function App() {
           buildFilePath={buildFilePath}
         />
       </Paper>
-      <UploadPanel
-        targetLabel={targetLabel}
-        uploading={uploading}
-        uploadPct={uploadPct}
-        onUpload={handleUpload}
-      />
+      {canWrite && (
+        <UploadPanel
+          targetLabel={targetLabel}
+          uploading={uploading}
+          uploadPct={uploadPct}
+          onUpload={handleUpload}
+        />
+      )}
     </div>
   );
 }
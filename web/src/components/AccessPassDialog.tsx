@@ -27,6 +27,8 @@ function validatePass(input: string): { ok: boolean; helperText: string } {
 }
 
 export type AccessPassDialogProps = {
+  /** Why the pass is asked for again, e.g. it was changed on the host. */
+  hint?: string;
   onSave?: (pass: string) => Promise<void>;
 };
 
@@ -52,6 +54,11 @@ export const AccessPassDialog = NiceModal.create(
       >
         <DialogTitle>请输入访问口令后继续</DialogTitle>
         <DialogContent>
+          {props.hint && (
+            <Typography variant="body2" color="warning.main" sx={{ mb: 1 }}>
+              {props.hint}
+            </Typography>
+          )}
           <Box
             sx={{ pt: 1 }}
             component="form"
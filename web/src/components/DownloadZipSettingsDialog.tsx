@@ -12,9 +12,12 @@ import {
 } from "@mui/material";
 
 import NiceModal, { useModal } from "@ebay/nice-modal-react";
+import useSWR from "swr";
 
 import { muiDialogV5ReplaceOnClose } from "common/utils/muiDialogV5ReplaceOnClose";
 import { useThrottlingState } from "common/utils/useThrottle";
+import { fetchZipDefaults } from "src/utils/api";
+import { formatFileSize } from "src/utils/fileUtils";
 
 export type DownloadZipIgnorePreset = {
   key: string;
@@ -38,6 +41,10 @@ export const DEFAULT_IGNORE_PRESETS: DownloadZipIgnorePreset[] = [
 export type DownloadZipSettingsValue = {
   enabledPresetKeys: string[];
   customIgnore: string;
+  /** 额外应用所选文件夹中的 .gitignore / .localshareignore */
+  useIgnoreFiles?: boolean;
+  /** 只打包不压缩：速度更快，且浏览器能显示准确的下载进度 */
+  storeOnly?: boolean;
 };
 
 export function parseCustomIgnore(input: string) {
@@ -69,6 +76,8 @@ export function buildIgnoreList(value: DownloadZipSettingsValue) {
 
 interface DownloadZipSettingsDialogProps {
   value: DownloadZipSettingsValue;
+  /** 当前文件夹，用于列出其中实际存在的建议忽略项及大小 */
+  path?: string;
   onSave?: (value: DownloadZipSettingsValue) => void;
 }
 
@@ -83,6 +92,11 @@ export const DownloadZipSettingsDialog = NiceModal.create(
     );
 
     const enabled = new Set(value.enabledPresetKeys || []);
+    const { data: zipDefaults } = useSWR(
+      props.path === undefined ? null : ["zip-defaults", props.path],
+      () => fetchZipDefaults(props.path ?? ""),
+    );
+    const suggestions = zipDefaults?.suggestions ?? [];
 
     function togglePreset(key: string, checked: boolean) {
       const next = new Set(value.enabledPresetKeys || []);
@@ -111,6 +125,32 @@ export const DownloadZipSettingsDialog = NiceModal.create(
             配置批量下载打包时要忽略的目录/文件名。
           </Typography>
 
+          {suggestions.length > 0 && (
+            <>
+              <Typography variant="subtitle2" sx={{ mb: 0.5 }}>
+                此文件夹中发现
+              </Typography>
+              <FormGroup sx={{ mb: 2, alignItems: "flex-start" }}>
+                {suggestions.map((it) => (
+                  <FormControlLabel
+                    key={it.name}
+                    label={`忽略 ${it.name}（${formatFileSize(it.size)}${it.complete ? "" : "+"}）`}
+                    sx={{ mr: 0, pr: 2 }}
+                    control={
+                      <Checkbox
+                        size="small"
+                        checked={enabled.has(it.name)}
+                        onChange={(e) =>
+                          togglePreset(it.name, e.target.checked)
+                        }
+                      />
+                    }
+                  />
+                ))}
+              </FormGroup>
+            </>
+          )}
+
           <Typography variant="subtitle2" sx={{ mb: 0.5 }}>
             常见忽略项
           </Typography>
@@ -131,6 +171,34 @@ export const DownloadZipSettingsDialog = NiceModal.create(
             ))}
           </FormGroup>
 
+          <FormControlLabel
+            label="同时遵循 .gitignore / .localshareignore"
+            sx={{ mb: 2 }}
+            control={
+              <Checkbox
+                size="small"
+                checked={!!value.useIgnoreFiles}
+                onChange={(e) =>
+                  setValue({ ...value, useIgnoreFiles: e.target.checked })
+                }
+              />
+            }
+          />
+
+          <FormControlLabel
+            label="只打包不压缩（更快，可显示准确进度）"
+            sx={{ mb: 2 }}
+            control={
+              <Checkbox
+                size="small"
+                checked={!!value.storeOnly}
+                onChange={(e) =>
+                  setValue({ ...value, storeOnly: e.target.checked })
+                }
+              />
+            }
+          />
+
           <Typography variant="subtitle2" sx={{ mb: 0.5 }}>
             自定义忽略
           </Typography>
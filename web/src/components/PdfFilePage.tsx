@@ -0,0 +1,62 @@
+import { Alert, LinearProgress } from "@mui/material";
+import useSWR from "swr";
+import type { DirectoryItem } from "src/types";
+import { useObjectURL } from "src/hooks/useObjectURL";
+import { fetchPreview } from "src/utils/api";
+import { formatFileSize } from "src/utils/fileUtils";
+import { FilePageFrame } from "./FilePageFrame";
+
+type PdfFilePageProps = {
+  rootName: string;
+  currentPath: string;
+  item: DirectoryItem;
+  onNavigate: (path: string) => void;
+  onDownload: () => void;
+};
+
+export function PdfFilePage(props: PdfFilePageProps) {
+  const { rootName, currentPath, item, onNavigate, onDownload } = props;
+
+  const { data, error, isValidating } = useSWR(
+    ["preview", currentPath],
+    async ([, filePath]) => fetchPreview(filePath),
+  );
+  const pdfUrl = useObjectURL(data?.blob ?? null);
+
+  const subtitle = `${formatFileSize(item.size)}  ·  ${new Date(item.modified).toLocaleString()}`;
+
+  return (
+    <FilePageFrame
+      rootName={rootName}
+      currentPath={currentPath}
+      title={item.name}
+      subtitle={subtitle}
+      onNavigate={onNavigate}
+      onDownload={onDownload}
+    >
+      {isValidating && (
+        <div className="py-8">
+          <LinearProgress />
+        </div>
+      )}
+      {!isValidating && error instanceof Error && (
+        <Alert severity="error">{error.message}</Alert>
+      )}
+      {!isValidating && !error && pdfUrl && (
+        <>
+          {/* 部分手机浏览器不支持内嵌 PDF，提供新标签页打开作为兜底 */}
+          <iframe
+            src={pdfUrl}
+            title={item.name}
+            className="block h-[75vh] w-full rounded-md border-0 bg-white"
+          />
+          <div className="pt-2 text-right text-sm">
+            <a href={pdfUrl} target="_blank" rel="noreferrer">
+              在新标签页打开
+            </a>
+          </div>
+        </>
+      )}
+    </FilePageFrame>
+  );
+}
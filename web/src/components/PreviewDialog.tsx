@@ -14,7 +14,7 @@ import { muiDialogV5ReplaceOnClose } from "common/utils/muiDialogV5ReplaceOnClos
 import { SilentError } from "common/error/silent-error";
 
 import { fetchPreview } from "src/utils/api";
-import { isImageType } from "src/utils/fileUtils";
+import { isImageType, isPdfType } from "src/utils/fileUtils";
 import { useObjectURL } from "src/hooks/useObjectURL";
 import { DownloadFileIcon, FileActionIconButton } from "./FileActionIconButton";
 
@@ -40,11 +40,18 @@ export const PreviewDialog = NiceModal.create((props: PreviewDialogProps) => {
       : null,
   );
 
-  const text = imageUrl
-    ? ""
-    : previewError instanceof Error
-      ? previewError.message
-      : (previewData?.text ?? "");
+  const pdfUrl = useObjectURL(
+    isPdfType(previewData?.contentType ?? "")
+      ? (previewData?.blob ?? null)
+      : null,
+  );
+
+  const text =
+    imageUrl || pdfUrl
+      ? ""
+      : previewError instanceof Error
+        ? previewError.message
+        : (previewData?.text ?? "");
 
   return (
     <Dialog
@@ -73,7 +80,14 @@ export const PreviewDialog = NiceModal.create((props: PreviewDialogProps) => {
             className="mx-auto max-h-[70vh] max-w-full rounded-md"
           />
         )}
-        {!previewIsValidating && !imageUrl && (
+        {!previewIsValidating && pdfUrl && (
+          <iframe
+            src={pdfUrl}
+            title={title}
+            className="block h-[70vh] w-full rounded-md border-0 bg-white"
+          />
+        )}
+        {!previewIsValidating && !imageUrl && !pdfUrl && (
           <textarea
             readOnly
             autoFocus
@@ -8,6 +8,8 @@ import {
 } from "@mui/material";
 import SettingsOutlinedIcon from "@mui/icons-material/SettingsOutlined";
 import ChatIcon from "@mui/icons-material/Chat";
+import FolderZipOutlinedIcon from "@mui/icons-material/FolderZipOutlined";
+import LinkIcon from "@mui/icons-material/Link";
 import clsx from "clsx";
 
 export type SelectionBarProps = {
@@ -16,9 +18,14 @@ export type SelectionBarProps = {
   selectedTotal: number;
   onSelectAll: (checked: boolean) => void;
   onDownloadSelected: () => void;
+  /** Omit to hide the "download this folder" button (e.g. at the share root). */
+  onDownloadAll?: () => void;
+  /** Copies direct links of every file in the folder, for download managers. */
+  onCopyDownloadLinks: () => void;
   onOpenDownloadSettings: () => void;
   onOpenChat: () => void;
-  onDeleteSelected: () => void;
+  /** Omit to hide the delete button (no delete permission). */
+  onDeleteSelected?: () => void;
   onClearSelection: () => void;
 };
 
@@ -29,6 +36,8 @@ export function SelectionBar(props: SelectionBarProps) {
     selectedTotal,
     onSelectAll,
     onDownloadSelected,
+    onDownloadAll,
+    onCopyDownloadLinks,
     onOpenDownloadSettings,
     onOpenChat,
     onDeleteSelected,
@@ -76,6 +85,30 @@ export function SelectionBar(props: SelectionBarProps) {
               </IconButton>
             </span>
           </Tooltip>
+          {onDownloadAll && (
+            <Tooltip title="打包下载此文件夹">
+              <span>
+                <IconButton
+                  size="small"
+                  disabled={disabled}
+                  onClick={onDownloadAll}
+                >
+                  <FolderZipOutlinedIcon fontSize="small" />
+                </IconButton>
+              </span>
+            </Tooltip>
+          )}
+          <Tooltip title="复制所有文件的下载链接（用于下载工具）">
+            <span>
+              <IconButton
+                size="small"
+                disabled={disabled}
+                onClick={onCopyDownloadLinks}
+              >
+                <LinkIcon fontSize="small" />
+              </IconButton>
+            </span>
+          </Tooltip>
           <Tooltip title="下载设置">
             <span>
               <IconButton size="small" onClick={onOpenDownloadSettings}>
@@ -91,15 +124,17 @@ export function SelectionBar(props: SelectionBarProps) {
           >
             下载选中
           </Button>
-          <Button
-            variant="contained"
-            color="error"
-            size="small"
-            disabled={selectedTotal === 0}
-            onClick={onDeleteSelected}
-          >
-            删除选中
-          </Button>
+          {onDeleteSelected && (
+            <Button
+              variant="contained"
+              color="error"
+              size="small"
+              disabled={selectedTotal === 0}
+              onClick={onDeleteSelected}
+            >
+              删除选中
+            </Button>
+          )}
           <Button
             variant="outlined"
             size="small"
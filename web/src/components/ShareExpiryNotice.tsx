@@ -0,0 +1,38 @@
+import { useEffect, useState } from "react";
+import { Alert } from "@mui/material";
+
+function formatCountdown(seconds: number) {
+  const h = Math.floor(seconds / 3600);
+  const m = Math.floor((seconds % 3600) / 60);
+  const s = seconds % 60;
+  const mm = String(m).padStart(2, "0");
+  const ss = String(s).padStart(2, "0");
+  return h > 0 ? `${h}:${mm}:${ss}` : `${mm}:${ss}`;
+}
+
+export interface ShareExpiryNoticeProps {
+  /** 拉取 session 时共享剩余的秒数，0 或不传表示不会自动停止 */
+  expiresIn?: number;
+}
+
+/** 主机设置了共享时长时，显示自动停止前的倒计时 */
+export function ShareExpiryNotice({ expiresIn }: ShareExpiryNoticeProps) {
+  const [left, setLeft] = useState(expiresIn ?? 0);
+
+  useEffect(() => {
+    setLeft(expiresIn ?? 0);
+    if (!expiresIn) return;
+    const deadline = Date.now() + expiresIn * 1000;
+    const timer = window.setInterval(() => {
+      setLeft(Math.max(0, Math.ceil((deadline - Date.now()) / 1000)));
+    }, 1000);
+    return () => window.clearInterval(timer);
+  }, [expiresIn]);
+
+  if (left <= 0) return null;
+  return (
+    <Alert severity="info" sx={{ borderRadius: 0 }}>
+      共享将在 {formatCountdown(left)} 后自动停止，请及时下载
+    </Alert>
+  );
+}
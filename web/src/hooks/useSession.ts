@@ -0,0 +1,21 @@
+import { useEffect } from "react";
+import useSWR from "swr";
+import { fetchSession } from "src/utils/api";
+
+/** 当前客户端的登录状态与实际权限，重新登录后自动刷新 */
+export function useSession() {
+  const res = useSWR("session", fetchSession);
+  const { mutate } = res;
+
+  useEffect(() => {
+    function onTokenChanged() {
+      void mutate();
+    }
+    window.addEventListener("shareTokenChanged", onTokenChanged);
+    return () => {
+      window.removeEventListener("shareTokenChanged", onTokenChanged);
+    };
+  }, [mutate]);
+
+  return res;
+}
@@ -1,6 +1,21 @@
 import { useEffect, useRef, useState } from "react";
+import toast from "react-hot-toast";
+import { mutate } from "swr";
+import { pollChanges } from "src/utils/api";
 import { withTokenQuery } from "src/utils/auth";
 
+/** 长轮询每次最多等待的秒数 */
+const POLL_TIMEOUT_SEC = 25;
+
+function serverStoppingMessage(reason: unknown) {
+  if (reason === "expired") return "共享已到时，主机已自动停止共享";
+  if (reason === "idle") return "共享长时间无人使用，主机已自动停止共享";
+  if (reason === "device removed") {
+    return "共享已停止：共享文件夹所在的设备已被移除";
+  }
+  return "共享已停止：共享文件夹已无法访问";
+}
+
 function useTokenTick() {
   const [tokenTick, setTokenTick] = useState(0);
 
@@ -39,20 +54,73 @@ export function useSseDirsRefresh(params: {
     }, 250);
   }
 
+  function handleEvent(event: string, payload: any) {
+    const cur = (currentPath || "").trim();
+    if (event === "dirsChanged") {
+      const dirs = Array.isArray(payload?.dirs) ? payload.dirs : [];
+      if (dirs.includes(cur)) scheduleSilentRefresh();
+    }
+    // Sent instead of dirsChanged when too many dirs changed at once.
+    if (event === "subtreeChanged") {
+      const dir = typeof payload?.dir === "string" ? payload.dir : "";
+      if (dir === "" || cur === dir || cur.startsWith(`${dir}/`)) {
+        scheduleSilentRefresh();
+      }
+    }
+    // 主机切换了只读模式或权限：重新获取 session，隐藏/显示上传与删除
+    if (event === "permissionsChanged") {
+      void mutate("session");
+    }
+    // 主机设置或取消了共享时长：session 里带着新的倒计时
+    if (event === "shareExpiryChanged") {
+      void mutate("session");
+    }
+    if (event === "serverStopping") {
+      toast.error(serverStoppingMessage(payload?.reason));
+    }
+  }
+
+  useEffect(() => {
+    if (typeof window.EventSource !== "undefined") return;
+    // 不支持 EventSource 的浏览器（车机、旧 WebView）改用长轮询
+    let stopped = false;
+    let since: number | null = null;
+    async function loop() {
+      while (!stopped) {
+        try {
+          const res = await pollChanges(since, POLL_TIMEOUT_SEC);
+          if (stopped) return;
+          if (res.reset) scheduleSilentRefresh();
+          else res.events.forEach((ev) => handleEvent(ev.event, ev.data));
+          since = res.lastEventId;
+        } catch {
+          await new Promise((r) => window.setTimeout(r, 5000));
+        }
+      }
+    }
+    void loop();
+    return () => {
+      stopped = true;
+    };
+  }, [currentPath, tokenTick]);
+
   useEffect(() => {
     if (typeof window.EventSource === "undefined") return;
     try {
       const es = new EventSource(withTokenQuery("/api/events"));
-      es.addEventListener("dirsChanged", (ev: MessageEvent) => {
-        try {
-          const payload = JSON.parse(String(ev.data || "{}")) as {
-            dirs?: string[];
-          };
-          const dirs = Array.isArray(payload.dirs) ? payload.dirs : [];
-          const cur = (currentPath || "").trim();
-          if (dirs.includes(cur)) scheduleSilentRefresh();
-        } catch {}
-      });
+      for (const event of [
+        "dirsChanged",
+        "subtreeChanged",
+        "permissionsChanged",
+        "shareExpiryChanged",
+        "serverStopping",
+      ]) {
+        es.addEventListener(event, (ev: MessageEvent) => {
+          try {
+            handleEvent(event, JSON.parse(String(ev.data || "{}")));
+          } catch {}
+        });
+      }
       esRef.current = es;
       return () => {
         es.close();
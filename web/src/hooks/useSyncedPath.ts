@@ -1,5 +1,6 @@
 import { useEffect, useState } from "react";
 import {
+  getInitialPath,
   getPathFromUrl,
   normalizeSharePath,
   syncPathToUrl,
@@ -7,7 +8,7 @@ import {
 
 export function useSyncedPath() {
   const [currentPath, setCurrentPath] = useState<string>(() =>
-    getPathFromUrl(),
+    getInitialPath(),
   );
 
   function setPath(path: string, options?: { replace?: boolean }) {
@@ -1,6 +1,16 @@
 export type DirectoryItemType = "file" | "directory";
 
-export type PreviewKind = "image" | "text" | "unsupported";
+export type PreviewKind = "image" | "text" | "pdf" | "unsupported";
+
+/** 服务端给出的文件大类，取值见 /api/meta 的 fileCategories */
+export type FileCategory =
+  | "image"
+  | "video"
+  | "audio"
+  | "text"
+  | "archive"
+  | "document"
+  | "other";
 
 export interface PreviewInfo {
   supported: boolean;
@@ -15,8 +25,16 @@ export interface DirectoryItem {
   hidden: boolean;
   size: number;
   modified: string;
+  /** 创建时间，仅 Windows 提供 */
+  created?: string;
+  /** 所有者，仅在 details=1 时返回 */
+  owner?: string;
   extension: string | null;
   preview: PreviewInfo | null;
+  /** 是否可在线预览，与 preview.supported 一致；旧版服务端不返回 */
+  previewable?: boolean;
+  /** 文件大类，仅文件有；旧版服务端不返回 */
+  category?: FileCategory;
 }
 
 export interface FilesResponse {
@@ -24,6 +42,15 @@ export interface FilesResponse {
   rootName: string;
   currentPath: string;
   parentPath: string | null;
+  /** 文件夹条目超过服务端上限时为 true，items 只是其中一部分 */
+  truncated?: boolean;
+  /** 当前文件夹中的 README.md / README.txt，可通过 /api/preview 获取 */
+  readme?: {
+    path: string;
+    size: number;
+    /** 请求带 inlineReadme=1 且文件足够小时直接附带内容 */
+    content?: string;
+  };
 }
 
 export interface PathInfoResponse {
@@ -33,6 +60,31 @@ export interface PathInfoResponse {
   parentPath: string | null;
   item?: DirectoryItem | null;
   items?: DirectoryItem[];
+  truncated?: boolean;
+}
+
+/** GET /api/session：当前客户端的登录状态与实际权限 */
+export interface SessionResponse {
+  /** 需要口令且已持有有效 token */
+  authenticated: boolean;
+  authRequired: boolean;
+  /** 未通过鉴权的原因，与 401 响应的 code 相同 */
+  code?: string;
+  /** token 剩余有效秒数 */
+  tokenExpiresIn: number;
+  permissions: {
+    read: boolean;
+    write: boolean;
+    delete: boolean;
+    list: boolean;
+  };
+  clientIP: string;
+  /** 只能上传、不能浏览 */
+  dropboxMode: boolean;
+  /** 主机开启了只读模式：只能浏览和下载 */
+  readOnly?: boolean;
+  /** 共享自动停止前剩余的秒数，不会自动停止时缺省 */
+  shareExpiresIn?: number;
 }
 
 export interface DeleteResponse {
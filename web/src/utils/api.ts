@@ -1,8 +1,14 @@
 import { getWebToken, setWebToken } from "common/storage/web-token";
 
-import type { DeleteResponse, FilesResponse, PathInfoResponse } from "src/types";
-import { ensureShareToken } from "./auth";
-import { http } from "./http";
+import type {
+  DeleteResponse,
+  FilesResponse,
+  PathInfoResponse,
+  SessionResponse,
+} from "src/types";
+import { ensureShareToken, withTokenQuery } from "./auth";
+import { apiUrl, http } from "./http";
+import { isImageType, isPdfType } from "./fileUtils";
 
 export async function fetchPathInfo(path: string) {
   return http
@@ -12,6 +18,10 @@ export async function fetchPathInfo(path: string) {
     .json<PathInfoResponse>();
 }
 
+export async function fetchSession() {
+  return http.get("/api/session").json<SessionResponse>();
+}
+
 export async function fetchFiles(path: string) {
   return http
     .get("/api/files", {
@@ -20,17 +30,155 @@ export async function fetchFiles(path: string) {
     .json<FilesResponse>();
 }
 
-export async function downloadZip(paths: string[]) {
-  return downloadZipWithIgnore({ paths, ignore: [] });
+/** 目录下所有文件的直链（每行一个），供下载工具批量下载 */
+export async function fetchManifestText(path: string) {
+  return http
+    .get("/api/manifest", {
+      searchParams: { path: path || "", recursive: "1", format: "txt" },
+    })
+    .text();
 }
 
-export async function downloadZipWithIgnore(opts: {
+/** 批量打包请求：与 /api/download-zip 的请求体一致 */
+export interface ZipSelection {
   paths: string[];
   ignore?: string[];
-}) {
-  const { paths, ignore } = opts;
+  /** 额外应用所选文件夹中的 .gitignore / .localshareignore */
+  useIgnoreFiles?: boolean;
+  /** "store" 只打包不压缩，服务端会返回准确的 Content-Length */
+  compression?: "deflate" | "store";
+}
+
+function zipSelectionBody(opts: ZipSelection) {
+  const { paths, ignore, useIgnoreFiles, compression } = opts;
+  return {
+    paths,
+    ignore: ignore || [],
+    useIgnoreFiles: !!useIgnoreFiles,
+    compression,
+  };
+}
+
+export interface DownloadEstimate {
+  totalBytes: number;
+  fileCount: number;
+  limitExceeded: boolean;
+  maxFiles: number;
+  maxBytes: number;
+  /** 主机设置的默认忽略项中，本次请求会额外排除的条目 */
+  defaultIgnore?: string[];
+}
+
+export async function estimateDownload(opts: ZipSelection) {
+  return http
+    .post("/api/download-estimate", {
+      json: zipSelectionBody(opts),
+    })
+    .json<DownloadEstimate>();
+}
+
+/** 文件夹下直接存在的建议忽略项，size 为其总大小 */
+export interface ZipSuggestion {
+  name: string;
+  type: "file" | "directory";
+  size: number;
+  fileCount: number;
+  /** 为 false 时 size/fileCount 只统计了一部分（目录过大） */
+  complete: boolean;
+}
+
+export async function fetchZipDefaults(path: string) {
+  return http
+    .get("/api/zip-defaults", {
+      searchParams: { path: path || "" },
+    })
+    .json<{ path: string; suggestions: ZipSuggestion[] }>();
+}
+
+/** 图片的尺寸与拍摄时间（只读取文件头） */
+export interface MediaInfo {
+  width: number;
+  height: number;
+  /** EXIF 拍摄时间，相机本地时间，无时区 */
+  taken?: string;
+  /** EXIF 方向；5~8 表示显示时需旋转 90° */
+  orientation?: number;
+}
+
+export async function fetchMediaInfo(path: string) {
+  return http
+    .get("/api/media-info", {
+      searchParams: { path: path || "" },
+    })
+    .json<{
+      path: string;
+      items: Record<string, MediaInfo>;
+      truncated: boolean;
+    }>();
+}
+
+export interface ArchiveJob {
+  id: string;
+  name: string;
+  state: "running" | "ready" | "failed" | "canceled";
+  fileCount: number;
+  totalBytes: number;
+  doneBytes: number;
+  error?: string;
+  expiresAt?: string;
+}
+
+/** 在服务端准备压缩包，完成后可断点续传下载 */
+export async function createArchiveJob(opts: ZipSelection) {
+  return http
+    .post("/api/archive-jobs", {
+      json: zipSelectionBody(opts),
+    })
+    .json<ArchiveJob>();
+}
+
+export async function fetchArchiveJob(id: string) {
+  return http
+    .get(`/api/archive-jobs/${encodeURIComponent(id)}`)
+    .json<ArchiveJob>();
+}
+
+/**
+ * 可断点续传的下载链接：带服务端签发的下载令牌（dl），不依赖会话 token，
+ * 重新登录后浏览器仍可续传。旧版服务端不支持时回退为带会话 token 的链接。
+ */
+export async function fetchResumableDownloadUrl(
+  target: { path: string } | { job: string },
+) {
+  const params: Record<string, string> =
+    "job" in target ? { job: target.job } : { path: target.path };
+  try {
+    const resp = await http.get("/api/download", {
+      searchParams: { ...params, downloadToken: "1" },
+    });
+    // 旧版服务端会忽略 downloadToken=1 直接返回文件，此时不要读完整个响应体
+    if (!resp.headers.get("content-type")?.includes("application/json")) {
+      void resp.body?.cancel();
+      throw new Error("download token unsupported");
+    }
+    const { downloadToken } = await resp.json<{ downloadToken: string }>();
+    const query = new URLSearchParams({ ...params, dl: downloadToken });
+    return apiUrl(`/api/download?${query}`);
+  } catch {
+    await ensureShareToken();
+    return withTokenQuery(
+      `/api/download?${new URLSearchParams(params).toString()}`,
+    );
+  }
+}
+
+export async function downloadZip(paths: string[]) {
+  return downloadZipWithIgnore({ paths, ignore: [] });
+}
+
+export async function downloadZipWithIgnore(opts: ZipSelection) {
   const resp = await http.post("/api/download-zip", {
-    json: { paths, ignore: ignore || [] },
+    json: zipSelectionBody(opts),
   });
 
   const blob = await resp.blob();
@@ -40,21 +188,59 @@ export async function downloadZipWithIgnore(opts: {
   return { blob, fileName };
 }
 
-export async function deletePaths(paths: string[]) {
+/**
+ * permanent 确认：超过回收站上限（DELETE_TOO_LARGE_FOR_TRASH）的内容直接永久删除
+ */
+export async function deletePaths(paths: string[], permanent = false) {
   return http
     .post("/api/delete", {
-      json: { paths },
+      json: permanent ? { paths, permanent } : { paths },
     })
     .json<DeleteResponse>();
 }
 
+export interface ChangeEvent {
+  id: number;
+  event: string;
+  data: any;
+}
+
+export interface ChangesResult {
+  events: ChangeEvent[];
+  lastEventId: number;
+  /** 有事件已丢失，应整体刷新 */
+  reset: boolean;
+}
+
+/** 不支持 EventSource 时的长轮询；since 为空表示从现在开始 */
+export async function pollChanges(since: number | null, timeoutSec: number) {
+  const searchParams: Record<string, string | number> = {
+    timeout: timeoutSec,
+  };
+  if (since !== null) searchParams.since = since;
+  const resp = await http.get("/api/changes", {
+    searchParams,
+    timeout: (timeoutSec + 10) * 1000,
+  });
+  const lastEventId = Number(resp.headers.get("x-last-event-id") || 0);
+  if (resp.status === 204) {
+    return { events: [], lastEventId, reset: false } as ChangesResult;
+  }
+  const body = await resp.json<Partial<ChangesResult>>();
+  return {
+    events: body.events || [],
+    lastEventId: body.lastEventId ?? lastEventId,
+    reset: !!body.reset,
+  } as ChangesResult;
+}
+
 export async function fetchPreview(filePath: string) {
   const resp = await http.get("/api/preview", {
     searchParams: { path: filePath },
   });
 
   const contentType = resp.headers.get("content-type") || "";
-  if ((contentType || "").toLowerCase().startsWith("image/")) {
+  if (isImageType(contentType) || isPdfType(contentType)) {
     const blob = await resp.blob();
     return { contentType, blob, text: "" };
   }
@@ -63,6 +249,39 @@ export async function fetchPreview(filePath: string) {
   return { contentType, blob: new Blob(), text };
 }
 
+export interface UploadProgress {
+  id: string;
+  phase: "receiving" | "writing" | "finishing" | "done" | "failed";
+  receivedBytes: number;
+  /** 请求体大小，-1 表示未知 */
+  totalBytes: number;
+  writtenBytes: number;
+  writeTotalBytes: number;
+  file?: string;
+}
+
+export async function fetchUploadProgress(id: string) {
+  return http
+    .get("/api/upload-progress", { searchParams: { id } })
+    .json<UploadProgress>();
+}
+
+/** 服务端进度：接收请求体与写入文件各算一份字节，完成前最多 99% */
+function uploadProgressPct(p: UploadProgress) {
+  if (p.phase === "done") return 100;
+  const total = Math.max(p.totalBytes, 0) + p.writeTotalBytes;
+  if (total <= 0) return 0;
+  return Math.min(99, ((p.receivedBytes + p.writtenBytes) / total) * 100);
+}
+
+function newUploadId() {
+  const c = globalThis.crypto;
+  if (c?.randomUUID) return c.randomUUID();
+  return `${Date.now().toString(36)}-${Math.random().toString(36).slice(2)}`;
+}
+
+const UPLOAD_PROGRESS_POLL_MS = 500;
+
 export async function uploadFilesWithProgress(opts: {
   path: string;
   files: File[];
@@ -79,7 +298,7 @@ export async function uploadFilesWithProgress(opts: {
   } catch (e: any) {
     if (e?.status === 401) {
       setWebToken("");
-      await ensureShareToken();
+      await ensureShareToken(e?.code);
       await uploadFilesWithProgressXHR({ formData, onProgress });
       return;
     }
@@ -92,14 +311,34 @@ function uploadFilesWithProgressXHR(opts: {
   onProgress?: ((pct: number) => void) | undefined;
 }) {
   const { formData, onProgress } = opts;
+  const uploadId = newUploadId();
+  // 浏览器的进度只代表已交给网络的部分；能拿到服务端进度时以服务端为准。
+  let serverKnown = false;
+  let stopped = false;
+  const poll = async () => {
+    while (!stopped) {
+      await new Promise((r) => window.setTimeout(r, UPLOAD_PROGRESS_POLL_MS));
+      if (stopped) return;
+      try {
+        const p = await fetchUploadProgress(uploadId);
+        if (stopped) return;
+        serverKnown = true;
+        onProgress?.(uploadProgressPct(p));
+      } catch (e: any) {
+        // 旧版服务端没有该接口：退回浏览器进度。
+        if (e?.status === 404 && !serverKnown) return;
+      }
+    }
+  };
 
   return new Promise<void>((resolve, reject) => {
     const xhr = new XMLHttpRequest();
 
     xhr.upload.addEventListener("progress", (e) => {
-      if (!e.lengthComputable) return;
+      if (!e.lengthComputable || serverKnown) return;
       const pct = (e.loaded / e.total) * 100;
-      onProgress?.(Math.max(0, Math.min(100, pct)));
+      // 发送完毕不代表服务端已写完。
+      onProgress?.(Math.max(0, Math.min(99, pct)));
     });
 
     xhr.addEventListener("load", () => {
@@ -126,7 +365,12 @@ function uploadFilesWithProgressXHR(opts: {
       reject(new Error("上传失败"));
     });
 
-    xhr.open("POST", "/api/upload");
+    xhr.addEventListener("loadend", () => {
+      stopped = true;
+    });
+
+    xhr.open("POST", apiUrl("/api/upload"));
+    xhr.setRequestHeader("X-Upload-Id", uploadId);
     // XHR path keeps manual token injection (upload progress).
     // Token is intentionally stored as a header to avoid leaking into URLs.
     const token = getWebToken();
@@ -136,5 +380,6 @@ function uploadFilesWithProgressXHR(opts: {
       } catch {}
     }
     xhr.send(formData);
+    void poll();
   });
 }
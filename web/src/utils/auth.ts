@@ -3,6 +3,8 @@ import NiceModal from "@ebay/nice-modal-react";
 import { AccessPassDialog } from "src/components/AccessPassDialog";
 import { getWebToken, setWebToken } from "common/storage/web-token";
 import { SilentError } from "common/error/silent-error";
+import { apiUrl } from "./http";
+import { AuthChallenge, solveChallenge } from "./pow";
 
 let inflightEnsure: Promise<string> | null = null;
 
@@ -19,7 +21,45 @@ function clearAuthDeniedCooldown() {
   authDeniedUntil = 0;
 }
 
+// The last pass that worked, kept in memory only, so an expired token can be
+// renewed without asking again.
+let lastPass = "";
+
+// A folder link from the desktop app carries a one-time token (?ott=) that
+// stands in for the access pass. Take it out of the address bar right away so
+// it isn't bookmarked or shared; it is redeemed on the first ensureShareToken.
+let entryToken = takeEntryToken();
+
+function takeEntryToken(): string {
+  const url = new URL(window.location.href);
+  const ott = url.searchParams.get("ott") || "";
+  if (ott) {
+    url.searchParams.delete("ott");
+    window.history.replaceState(window.history.state, "", url.toString());
+  }
+  return ott;
+}
+
+// Why the server rejected the previous token (the 401 "code").
+export type AuthFailureCode =
+  | "AUTH_REQUIRED"
+  | "AUTH_EXPIRED"
+  | "AUTH_PASS_CHANGED"
+  | "AUTH_IP_MISMATCH";
+
+function passHint(reason?: string) {
+  switch (reason) {
+    case "AUTH_PASS_CHANGED":
+      return "访问口令已更改，请输入新的口令";
+    case "AUTH_IP_MISMATCH":
+      return "网络地址已变化，请重新输入访问口令";
+    default:
+      return undefined;
+  }
+}
+
 export function withTokenQuery(url: string): string {
+  url = apiUrl(url);
   const token = getWebToken();
   if (!token) return url;
 
@@ -28,21 +68,44 @@ export function withTokenQuery(url: string): string {
   return `${url}${sep}token=${encodeURIComponent(token)}`;
 }
 
-async function requestAuthToken(pass: string): Promise<string> {
-  const resp = await fetch("/api/auth", {
-    method: "POST",
-    headers: {
-      "Content-Type": "application/json",
-      Accept: "application/json",
-    },
-    body: JSON.stringify({ pass }),
-  });
-
-  const ct = (resp.headers.get("content-type") || "").toLowerCase();
-  const payload = ct.includes("application/json")
-    ? ((await resp.json().catch(() => null)) as any)
-    : null;
+async function requestAuthToken(
+  pass: string,
+  ott?: string,
+): Promise<string> {
+  let challenge: { prefix: string; nonce: string } | undefined;
+  // 服务端在大量错误尝试后会要求先完成工作量证明（428 AUTH_CHALLENGE）
+  for (let attempt = 0; ; attempt++) {
+    const resp = await fetch(apiUrl("/api/auth"), {
+      method: "POST",
+      headers: {
+        "Content-Type": "application/json",
+        Accept: "application/json",
+      },
+      body: JSON.stringify(
+        ott ? { ott } : challenge ? { pass, challenge } : { pass },
+      ),
+    });
+
+    const ct = (resp.headers.get("content-type") || "").toLowerCase();
+    const payload = ct.includes("application/json")
+      ? ((await resp.json().catch(() => null)) as any)
+      : null;
 
+    if (
+      resp.status === 428 &&
+      payload?.code === "AUTH_CHALLENGE" &&
+      payload?.challenge &&
+      attempt < 2
+    ) {
+      const ch = payload.challenge as AuthChallenge;
+      challenge = { prefix: ch.prefix, nonce: await solveChallenge(ch) };
+      continue;
+    }
+    return authTokenFromResponse(resp, payload);
+  }
+}
+
+function authTokenFromResponse(resp: Response, payload: any): string {
   if (!resp.ok) {
     const msg = payload?.error || `鉴权失败: ${resp.status}`;
     const err = new Error(msg) as Error & {
@@ -62,9 +125,13 @@ async function requestAuthToken(pass: string): Promise<string> {
 /**
  * 确保获取到可用 token。
  * - 若服务端未启用口令：返回 ""。
- * - 若已启用：弹窗让用户输入口令并换票。
+ * - 若链接带有一次性 token（?ott=）：用它换票，无需输入口令。
+ * - 若 token 仅是过期（reason 为 AUTH_EXPIRED）：用本次会话记住的口令静默换票。
+ * - 否则：弹窗让用户输入口令并换票。
  */
-export async function ensureShareToken(): Promise<string> {
+export async function ensureShareToken(
+  reason?: AuthFailureCode | string,
+): Promise<string> {
   const token = getWebToken();
   if (token) return token;
   if (Date.now() < authDeniedUntil) {
@@ -73,6 +140,20 @@ export async function ensureShareToken(): Promise<string> {
   if (inflightEnsure) return inflightEnsure;
 
   inflightEnsure = (async () => {
+    if (entryToken) {
+      const ott = entryToken;
+      entryToken = "";
+      try {
+        const t = (await requestAuthToken("", ott)) || "";
+        setWebToken(t);
+        clearAuthDeniedCooldown();
+        return t;
+      } catch (e: any) {
+        // Used or expired: fall back to asking for the pass.
+        if (e?.status !== 401) throw e;
+      }
+    }
+
     // Probe: if auth is disabled, /api/auth with empty pass returns {token:""}.
     try {
       const t = (await requestAuthToken("")) || "";
@@ -83,11 +164,26 @@ export async function ensureShareToken(): Promise<string> {
       if (e?.status !== 401) throw e;
     }
 
+    if (reason === "AUTH_EXPIRED" && lastPass) {
+      try {
+        const t = await requestAuthToken(lastPass);
+        setWebToken(t);
+        clearAuthDeniedCooldown();
+        return t;
+      } catch (e: any) {
+        if (e?.status !== 401) throw e;
+        lastPass = "";
+      }
+    }
+    if (reason === "AUTH_PASS_CHANGED") lastPass = "";
+
     let token = "";
     try {
       await NiceModal.show(AccessPassDialog, {
+        hint: passHint(reason),
         onSave: async (p: string) => {
           token = await requestAuthToken(p);
+          lastPass = p;
           setWebToken(token);
           clearAuthDeniedCooldown();
         },
@@ -1,4 +1,4 @@
-import type { DirectoryItem } from "src/types";
+import type { DirectoryItem, FileCategory } from "src/types";
 
 export function formatFileSize(bytes: number) {
   if (!bytes) return "0 B";
@@ -12,8 +12,13 @@ export function isImageType(contentType: string) {
   return (contentType || "").toLowerCase().startsWith("image/");
 }
 
+export function isPdfType(contentType: string) {
+  return (contentType || "").toLowerCase().startsWith("application/pdf");
+}
+
 export function isPreviewSupported(item: DirectoryItem) {
-  return item.type === "file" && item.preview?.supported === true;
+  if (item.type !== "file") return false;
+  return item.previewable ?? item.preview?.supported === true;
 }
 
 export function getPreviewReasonText(item: DirectoryItem) {
@@ -24,72 +29,20 @@ export function getPreviewReasonText(item: DirectoryItem) {
   return "不支持的文件类型";
 }
 
+const categoryIcons: Record<FileCategory, string> = {
+  image: "🖼️",
+  video: "▶️",
+  audio: "🎵",
+  text: "📝",
+  archive: "📦",
+  document: "📄",
+  other: "❔",
+};
+
 export function getFileIcon(item: DirectoryItem) {
   if (item.type === "directory") return "📁";
-  const ext = item.extension || "";
-  const iconMap: Record<string, string> = {
-    ".ico": "🖼️",
-    ".jpg": "🖼️",
-    ".jpeg": "🖼️",
-    ".png": "🖼️",
-    ".gif": "🖼️",
-    ".bmp": "🖼️",
-    ".svg": "🖼️",
-    ".mp4": "▶️",
-    ".avi": "▶️",
-    ".mkv": "▶️",
-    ".mov": "▶️",
-    ".wmv": "▶️",
-    ".flv": "▶️",
-    ".mp3": "🎵",
-    ".wav": "🎵",
-    ".flac": "🎵",
-    ".aac": "🎵",
-    ".ogg": "🎵",
-    ".pdf": "📄",
-    ".doc": "📝",
-    ".docx": "📝",
-    ".txt": "📝",
-    ".rtf": "📝",
-    ".xls": "📊",
-    ".xlsx": "📊",
-    ".ppt": "📽️",
-    ".pptx": "📽️",
-    ".zip": "📦",
-    ".rar": "📦",
-    ".7z": "📦",
-    ".tar": "📦",
-    ".gz": "📦",
-    ".js": "🧩",
-    ".ts": "🧩",
-    ".json": "🧩",
-    ".xml": "🧩",
-    ".yml": "🧩",
-    ".yaml": "🧩",
-    ".html": "🧩",
-    ".css": "🧩",
-    ".py": "🧩",
-    ".java": "🧩",
-    ".cpp": "🧩",
-    ".hpp": "🧩",
-    ".c": "🧩",
-    ".h": "🧩",
-    ".php": "🧩",
-    ".rb": "🧩",
-    ".go": "🧩",
-    ".rs": "🧩",
-    ".cs": "🧩",
-    ".kt": "🧩",
-    ".swift": "🧩",
-    ".sh": "🧩",
-    ".bat": "🧩",
-    ".ps1": "🧩",
-    ".sql": "🧩",
-    ".toml": "⚙️",
-    ".ini": "⚙️",
-    ".env": "⚙️",
-  };
-  return iconMap[ext] || (isPreviewSupported(item) ? "📄" : "❔");
+  if (item.category) return categoryIcons[item.category] || "❔";
+  return isPreviewSupported(item) ? "📄" : "❔";
 }
 
 export function download(url: string, filename: string) {
@@ -35,18 +35,24 @@ const API_BASE_URL = String((import.meta as any)?.env?.VITE_API_BASE_URL || "")
   .trim()
   .replace(/\/+$/, "");
 
+/**
+ * 服务挂在反向代理子路径下时（见 local-share:base-path），由服务端注入。
+ */
+const BASE_PATH = window.__LOCAL_SHARE_BOOTSTRAP__?.basePath || "";
+
 export function apiUrl(path: string): string {
-  if (!API_BASE_URL) return path;
+  const base = API_BASE_URL || BASE_PATH;
+  if (!base) return path;
   if (/^https?:\/\//i.test(path)) return path;
-  if (!path.startsWith("/")) return `${API_BASE_URL}/${path}`;
-  return `${API_BASE_URL}${path}`;
+  if (!path.startsWith("/")) return `${base}/${path}`;
+  return `${base}${path}`;
 }
 
 function maybeRewriteToBaseUrl(request: Request): Request {
-  if (!API_BASE_URL) return request;
+  if (!API_BASE_URL && !BASE_PATH) return request;
 
   const raw = String(request.url || "");
-  if (raw.startsWith(API_BASE_URL)) return request;
+  if (API_BASE_URL && raw.startsWith(API_BASE_URL)) return request;
 
   try {
     const u = new URL(raw);
@@ -63,7 +69,7 @@ function maybeRewriteToBaseUrl(request: Request): Request {
 function isAuthEndpoint(url: string): boolean {
   try {
     const u = new URL(url, "http://localhost");
-    return u.pathname === "/api/auth";
+    return u.pathname.endsWith("/api/auth");
   } catch {
     return url.includes("/api/auth");
   }
@@ -97,7 +103,7 @@ const DEFAULT_TIMEOUT_MS = 15_000;
  * - baseURL support (optional)
  * - X-Share-Token injection
  * - unified error mapping
- * - 401 -> prompt access pass -> retry once
+ * - 401 -> re-auth (silently when only expired, else prompt) -> retry once
  */
 export const http = ky.create({
   timeout: DEFAULT_TIMEOUT_MS,
@@ -132,8 +138,9 @@ export const http = ky.create({
           !alreadyRetried &&
           !isAuthEndpoint(String(request.url))
         ) {
+          const { code } = await parseErrorPayload(response);
           setWebToken("");
-          await ensureShareToken();
+          await ensureShareToken(code);
 
           const retryHeaders = new Headers(
             (options.headers as any) || request.headers,
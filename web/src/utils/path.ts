@@ -60,6 +60,27 @@ export function getPathFromUrl() {
   return decodeSharePath(params.get("path") || "");
 }
 
+/**
+ * 首次加载时的路径：优先使用服务端注入的 bootstrap（已校验过，也覆盖
+ * /browse/... 形式的深链接），并把地址栏统一成 ?path= 形式。
+ */
+export function getInitialPath() {
+  const bootstrapPath = window.__LOCAL_SHARE_BOOTSTRAP__?.path;
+  if (bootstrapPath === undefined) return getPathFromUrl();
+
+  const path = normalizeSharePath(bootstrapPath);
+  const url = new URL(window.location.href);
+  const browseAt = url.pathname.indexOf("/browse/");
+  if (browseAt >= 0) url.pathname = url.pathname.slice(0, browseAt + 1);
+  const encodedPath = encodeSharePath(path);
+  if (encodedPath) url.searchParams.set("path", encodedPath);
+  else url.searchParams.delete("path");
+  if (url.href !== window.location.href) {
+    window.history.replaceState(null, "", url);
+  }
+  return path;
+}
+
 export function syncPathToUrl(
   path: string,
   options?: { replace?: boolean },
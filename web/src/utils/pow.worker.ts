@@ -0,0 +1,5 @@
+import { AuthChallenge, solveChallengeSync } from "./pow";
+
+self.onmessage = (e: MessageEvent<AuthChallenge>) => {
+  self.postMessage(solveChallengeSync(e.data));
+};
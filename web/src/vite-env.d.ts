@@ -1 +1,12 @@
 /// <reference types="vite/client" />
+
+interface Window {
+  /** 服务端注入到 index.html 的启动信息（见 spa_bootstrap.go） */
+  __LOCAL_SHARE_BOOTSTRAP__?: {
+    auth: "pass" | "none";
+    rootName?: string;
+    path: string;
+    /** 反向代理子路径（如 "/share"），不在子路径下时省略 */
+    basePath?: string;
+  };
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"LocalShare/pkg/shareserver"
+)
+
+//go:embed all:web/dist
+var webAssets embed.FS
+
+func shouldServeWebFromDisk() bool {
+	// In dev, we want the share-server web UI (web/dist) to update without
+	// restarting the Go process. Serving from disk achieves that.
+	//
+	// Production builds should still use embedded assets.
+	if strings.EqualFold(os.Getenv("LOCALSHARE_WEB_DISK"), "1") {
+		return true
+	}
+	return strings.EqualFold(Version, "dev")
+}
+
+func findWebDistDir() (string, bool) {
+	// Try common locations. In `wails dev`, CWD is typically the repo root.
+	candidates := []string{
+		filepath.Join("web", "dist"),
+	}
+	if exe, err := os.Executable(); err == nil {
+		exeDir := filepath.Dir(exe)
+		candidates = append(candidates, filepath.Join(exeDir, "web", "dist"))
+	}
+
+	for _, dir := range candidates {
+		p := dir
+		if st, err := os.Stat(filepath.Join(p, "index.html")); err == nil && !st.IsDir() {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// newShareServer builds the share server used by both the GUI and headless mode,
+// serving the web UI from disk in dev and from the embedded copy otherwise.
+func newShareServer(opts shareserver.Options) *shareserver.Server {
+	if shouldServeWebFromDisk() {
+		if dir, ok := findWebDistDir(); ok {
+			opts.Assets = os.DirFS(dir)
+			opts.AssetsNoCache = true
+			if abs, err := filepath.Abs(dir); err == nil {
+				dir = abs
+			}
+			opts.AssetsPath = dir
+		} else {
+			appendLaunchLogf("web dist dir not found on disk, falling back to embedded assets")
+		}
+	}
+	if opts.Assets == nil {
+		if sub, err := fs.Sub(webAssets, "web/dist"); err == nil {
+			opts.Assets = sub
+		}
+	}
+	if opts.Version == "" {
+		opts.Version = Version
+	}
+	if opts.Logger == nil {
+		opts.Logger = launchLogger{}
+	}
+	return shareserver.New(opts)
+}
+
+// launchLogger forwards server logs to the launch log.
+type launchLogger struct{}
+
+func (launchLogger) Printf(format string, args ...any) {
+	appendLaunchLogf(format, args...)
+}